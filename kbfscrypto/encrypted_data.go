@@ -5,6 +5,8 @@
 package kbfscrypto
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"reflect"
@@ -229,6 +231,45 @@ func DecryptTLFCryptKeys(
 	return oldKeys, nil
 }
 
+// searchIndexKeyDerivationString is mixed into a TLF crypt key to
+// get the key for that TLF's local search index, so the index is
+// never encrypted with a key that's also used for server data.
+const searchIndexKeyDerivationString = "Keybase-Derived-KBFS-Search-Index-1"
+
+func deriveSearchIndexKey(key TLFCryptKey) (derived [32]byte) {
+	keyData := key.Data()
+	mac := hmac.New(sha256.New, keyData[:])
+	mac.Write([]byte(searchIndexKeyDerivationString))
+	copy(derived[:], mac.Sum(nil))
+	return derived
+}
+
+// EncryptedSearchIndex is an encrypted, encoded local search index
+// for a TLF.
+type EncryptedSearchIndex struct {
+	encryptedData
+}
+
+// EncryptSearchIndex encrypts an encoded search index, using a key
+// derived from the given TLF crypt key.
+func EncryptSearchIndex(encodedIndex []byte, key TLFCryptKey) (
+	EncryptedSearchIndex, error) {
+	encryptedData, err := encryptData(
+		encodedIndex, deriveSearchIndexKey(key))
+	if err != nil {
+		return EncryptedSearchIndex{}, err
+	}
+
+	return EncryptedSearchIndex{encryptedData}, nil
+}
+
+// DecryptSearchIndex decrypts a search index, but does not decode it.
+func DecryptSearchIndex(
+	encryptedIndex EncryptedSearchIndex, key TLFCryptKey) ([]byte, error) {
+	return decryptData(
+		encryptedIndex.encryptedData, deriveSearchIndexKey(key))
+}
+
 // EncryptedMerkleLeaf is an encrypted MerkleLeaf object.
 type EncryptedMerkleLeaf struct {
 	encryptedData
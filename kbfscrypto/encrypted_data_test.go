@@ -25,6 +25,25 @@ func TestEncryptDecryptDataSuccess(t *testing.T) {
 	require.Equal(t, data, decryptedData)
 }
 
+func TestEncryptDecryptSearchIndex(t *testing.T) {
+	data := []byte{0x20, 0x30}
+	key := MakeTLFCryptKey([32]byte{0x40, 0x45})
+	encryptedIndex, err := EncryptSearchIndex(data, key)
+	require.NoError(t, err)
+
+	// The index isn't encrypted with the TLF crypt key itself.
+	_, err = decryptData(encryptedIndex.encryptedData, key.Data())
+	require.Equal(t, libkb.DecryptionError{}, errors.Cause(err))
+
+	decryptedData, err := DecryptSearchIndex(encryptedIndex, key)
+	require.NoError(t, err)
+	require.Equal(t, data, decryptedData)
+
+	otherKey := MakeTLFCryptKey([32]byte{0x41, 0x45})
+	_, err = DecryptSearchIndex(encryptedIndex, otherKey)
+	require.Equal(t, libkb.DecryptionError{}, errors.Cause(err))
+}
+
 func TestDecryptDataFailure(t *testing.T) {
 	// Test various failure cases for decryptMetadata().
 	data := []byte{0x20, 0x30}
@@ -24,6 +24,8 @@ var runtimeDir = flag.String("runtime-dir", os.Getenv("KEYBASE_RUNTIME_DIR"), "r
 var label = flag.String("label", os.Getenv("KEYBASE_LABEL"), "label to help identify if running as a service")
 var mountType = flag.String("mount-type", defaultMountType, "mount type: default, force, none")
 var version = flag.Bool("version", false, "Print version")
+var posixUserMap = flag.String("posix-user-map", "", "file mapping Keybase usernames to local uids, one \"<username> <uid>\" pair per line; turns on POSIX ownership and permission emulation")
+var eventStreamSocket = flag.String("event-stream-socket", "", "path of a Unix socket on which to serve TLF change events as HTTP server-sent events")
 
 const usageFormatStr = `Usage:
   kbfsfuse -version
@@ -31,12 +33,14 @@ const usageFormatStr = `Usage:
 To run against remote KBFS servers:
   kbfsfuse
     [-runtime-dir=path/to/dir] [-label=label] [-mount-type=default|force|required|none]
+    [-posix-user-map=path/to/file] [-event-stream-socket=path/to/socket]
 %s
     %s[/path/to/mountpoint]
 
 To run in a local testing environment:
   kbfsfuse
     [-runtime-dir=path/to/dir] [-label=label] [-mount-type=default|force|required|none]
+    [-posix-user-map=path/to/file] [-event-stream-socket=path/to/socket]
 %s
     %s[/path/to/mountpoint]
 
@@ -102,6 +106,8 @@ func start() *libfs.Error {
 		MountErrorIsFatal: *mountType == "required",
 		SkipMount:         *mountType == "none",
 		MountPoint:        mountDir,
+		PosixUserMapFile:  *posixUserMap,
+		EventStreamSocket: *eventStreamSocket,
 	}
 
 	return libfuse.Start(options, ctx)
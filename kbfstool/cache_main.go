@@ -0,0 +1,36 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+)
+
+const cacheUsageStr = `Usage:
+  kbfstool cache [<subcommand>] [<args>]
+
+The possible subcommands are:
+  verify      Check an offline disk block cache for corrupt entries
+`
+
+func cacheMain(ctx context.Context, args []string) (exitStatus int) {
+	if len(args) < 1 {
+		fmt.Print(cacheUsageStr)
+		return 1
+	}
+
+	cmd := args[0]
+	args = args[1:]
+
+	switch cmd {
+	case "verify":
+		return cacheVerify(ctx, args)
+	default:
+		printError("cache", fmt.Errorf("unknown command %q", cmd))
+		return 1
+	}
+}
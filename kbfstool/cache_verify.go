@@ -0,0 +1,62 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+
+	"github.com/keybase/kbfs/kbfscodec"
+	"github.com/keybase/kbfs/libkbfs"
+	"golang.org/x/net/context"
+)
+
+const cacheVerifyUsageStr = `Usage:
+  kbfstool cache verify [-fix] /path/to/cache/dir
+
+Verifies every entry of the disk block cache in the given directory,
+e.g. the kbfs_block_cache or kbfs_sync_cache directory under the KBFS
+storage root, and lists the corrupt ones.  KBFS must not be running
+with that cache.  With -fix, the corrupt entries are also removed.
+
+`
+
+func cacheVerify(ctx context.Context, args []string) (exitStatus int) {
+	flags := flag.NewFlagSet("kbfs cache verify", flag.ContinueOnError)
+	fix := flags.Bool("fix", false, "Remove corrupt entries from the cache.")
+	err := flags.Parse(args)
+	if err != nil {
+		printError("cache verify", err)
+		return 1
+	}
+
+	inputs := flags.Args()
+	if len(inputs) != 1 {
+		fmt.Print(cacheVerifyUsageStr)
+		return 1
+	}
+
+	status, corrupt, err := libkbfs.VerifyDiskBlockCache(
+		ctx, kbfscodec.NewMsgpack(), inputs[0], *fix)
+	if err != nil {
+		printError("cache verify", err)
+		return 1
+	}
+
+	for _, entry := range corrupt {
+		fmt.Printf("%s: %v\n", hex.EncodeToString(entry.Key), entry.Err)
+	}
+	fmt.Printf("Checked %d entries, %d corrupt\n",
+		status.NumChecked, status.NumCorrupt)
+	if len(corrupt) == 0 {
+		return 0
+	}
+	if *fix {
+		fmt.Print("Removed the corrupt entries\n")
+		return 0
+	}
+	return 1
+}
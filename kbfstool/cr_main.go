@@ -0,0 +1,91 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/keybase/kbfs/libfs"
+	"golang.org/x/net/context"
+)
+
+const crUsageStr = `Usage:
+  kbfstool cr [<subcommand>] [<args>]
+
+The possible subcommands are:
+  pause		Pause automatic conflict resolution for a folder
+  resume	Resume automatic conflict resolution for a folder
+  status	List the paths changed by this device's unmerged branch
+  diff		Show the unmerged and merged operations for each changed path
+  resolve	Resolve conflicts, choosing which version of each path to keep
+
+These operate on folders loaded by the running KBFS process, through
+the special files in its mount (e.g. /keybase/private/alice).
+`
+
+// crCheckTlfDir makes sure the given path is a directory in a
+// mounted KBFS folder, by checking for the folder's status file.
+func crCheckTlfDir(tlfDir string) error {
+	_, err := os.Stat(filepath.Join(tlfDir, libfs.StatusFileName))
+	if err != nil {
+		return fmt.Errorf(
+			"%s is not a folder mounted by a running KBFS: %v", tlfDir, err)
+	}
+	return nil
+}
+
+// crWriteSpecialFile writes the given data in a single write to the
+// special file with the given name in a mounted KBFS folder.
+func crWriteSpecialFile(tlfDir, name string, data []byte) error {
+	err := crCheckTlfDir(tlfDir)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(tlfDir, name), data, 0)
+}
+
+func crSetAuto(args []string, name string, fileName string) (exitStatus int) {
+	if len(args) != 1 {
+		fmt.Printf("Usage:\n  kbfstool cr %s /keybase/[public|private|team]/tlf\n",
+			name)
+		return 1
+	}
+
+	err := crWriteSpecialFile(args[0], fileName, []byte("1"))
+	if err != nil {
+		printError("cr "+name, err)
+		return 1
+	}
+	return 0
+}
+
+func crMain(ctx context.Context, args []string) (exitStatus int) {
+	if len(args) < 1 {
+		fmt.Print(crUsageStr)
+		return 1
+	}
+
+	cmd := args[0]
+	args = args[1:]
+
+	switch cmd {
+	case "pause":
+		return crSetAuto(args, cmd, libfs.DisableAutoCRFileName)
+	case "resume":
+		return crSetAuto(args, cmd, libfs.EnableAutoCRFileName)
+	case "status":
+		return crStatus(ctx, args)
+	case "diff":
+		return crDiff(ctx, args)
+	case "resolve":
+		return crResolve(ctx, args)
+	default:
+		printError("cr", fmt.Errorf("unknown command %q", cmd))
+		return 1
+	}
+}
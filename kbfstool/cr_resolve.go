@@ -0,0 +1,79 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/keybase/kbfs/libfs"
+	"github.com/keybase/kbfs/libkbfs"
+	"golang.org/x/net/context"
+)
+
+const crResolveUsageStr = `Usage:
+  kbfstool cr resolve /keybase/[public|private|team]/tlf [path=mine|theirs|both...]
+
+Resolves the conflicts between this device's unmerged branch of the
+given folder and the merged branch.  For each given file (relative to
+the folder root) whose contents conflict, only this device's version
+("mine") or the merged version ("theirs") is kept.  Other conflicted
+paths keep "both" versions, with this device's version renamed.
+
+Automatic conflict resolution must first be paused with "kbfstool cr
+pause", so that it doesn't resolve the folder before this can.  It
+stays paused afterwards, until "kbfstool cr resume" or a restart.
+
+`
+
+// crParseChoices checks the given path=choice arguments, and returns
+// them as the JSON object expected by the folder's resolve file.
+func crParseChoices(args []string) ([]byte, error) {
+	choices := make(map[string]string, len(args))
+	for _, arg := range args {
+		i := strings.LastIndex(arg, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("%q is not of the form path=choice", arg)
+		}
+		_, err := libkbfs.ParseConflictChoice(arg[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		choices[strings.Trim(arg[:i], "/")] = arg[i+1:]
+	}
+	return json.Marshal(choices)
+}
+
+func crResolve(ctx context.Context, args []string) (exitStatus int) {
+	flags := flag.NewFlagSet("kbfs cr resolve", flag.ContinueOnError)
+	err := flags.Parse(args)
+	if err != nil {
+		printError("cr resolve", err)
+		return 1
+	}
+
+	inputs := flags.Args()
+	if len(inputs) < 1 {
+		fmt.Print(crResolveUsageStr)
+		return 1
+	}
+
+	choices, err := crParseChoices(inputs[1:])
+	if err != nil {
+		printError("cr resolve", err)
+		return 1
+	}
+
+	err = crWriteSpecialFile(
+		inputs[0], libfs.ResolveConflictsFileName, choices)
+	if err != nil {
+		printError("cr resolve", err)
+		return 1
+	}
+
+	return 0
+}
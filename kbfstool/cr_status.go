@@ -0,0 +1,200 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/keybase/kbfs/libfs"
+	"github.com/keybase/kbfs/libkbfs"
+	"golang.org/x/net/context"
+)
+
+const crStatusUsageStr = `Usage:
+  kbfstool cr status /keybase/[public|private|team]/tlf
+
+Lists the paths changed by this device's unmerged branch of the
+given mounted folder, and by the merged branch since they diverged.
+Unless automatic conflict resolution is paused with "kbfstool cr
+pause", the folder only stays unmerged if resolving it failed.
+
+`
+
+const crDiffUsageStr = `Usage:
+  kbfstool cr diff /keybase/[public|private|team]/tlf [path...]
+
+Shows the operations made to each changed path (relative to the
+folder root) by this device's unmerged branch ("mine") and by the
+merged branch ("theirs"), for all paths or just the given ones.
+
+`
+
+// crPathOps holds the operations made to one path on each branch.
+type crPathOps struct {
+	mine, theirs []string
+}
+
+// crRelPath converts a path from a conflict resolution summary,
+// which starts with the TLF name, into one relative to the TLF root.
+// Summaries of entries whose paths couldn't be found are returned
+// unchanged.
+func crRelPath(summaryPath string) string {
+	if strings.HasPrefix(summaryPath, "Unknown path") {
+		return summaryPath
+	}
+	parts := strings.SplitN(summaryPath, "/", 2)
+	if len(parts) < 2 {
+		return "."
+	}
+	return parts[1]
+}
+
+// crGetPathOps reads the status of the TLF mounted at the given
+// directory, and returns whether it is still unmerged, along with the
+// operations made to each changed path.
+func crGetPathOps(tlfDir string) (
+	staged bool, ops map[string]*crPathOps, err error) {
+	err = crCheckTlfDir(tlfDir)
+	if err != nil {
+		return false, nil, err
+	}
+	data, err := ioutil.ReadFile(filepath.Join(tlfDir, libfs.StatusFileName))
+	if err != nil {
+		return false, nil, err
+	}
+	var status libkbfs.FolderBranchStatus
+	err = json.Unmarshal(data, &status)
+	if err != nil {
+		return false, nil, err
+	}
+
+	ops = make(map[string]*crPathOps)
+	get := func(summaryPath string) *crPathOps {
+		relPath := crRelPath(summaryPath)
+		pathOps, ok := ops[relPath]
+		if !ok {
+			pathOps = &crPathOps{}
+			ops[relPath] = pathOps
+		}
+		return pathOps
+	}
+	for _, s := range status.Unmerged {
+		pathOps := get(s.Path)
+		pathOps.mine = append(pathOps.mine, s.Ops...)
+	}
+	for _, s := range status.Merged {
+		pathOps := get(s.Path)
+		pathOps.theirs = append(pathOps.theirs, s.Ops...)
+	}
+	return status.Staged, ops, nil
+}
+
+func sortedCRPaths(ops map[string]*crPathOps) []string {
+	paths := make([]string, 0, len(ops))
+	for p := range ops {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func crStatus(ctx context.Context, args []string) (exitStatus int) {
+	flags := flag.NewFlagSet("kbfs cr status", flag.ContinueOnError)
+	err := flags.Parse(args)
+	if err != nil {
+		printError("cr status", err)
+		return 1
+	}
+
+	inputs := flags.Args()
+	if len(inputs) != 1 {
+		fmt.Print(crStatusUsageStr)
+		return 1
+	}
+
+	staged, ops, err := crGetPathOps(inputs[0])
+	if err != nil {
+		printError("cr status", err)
+		return 1
+	}
+	if !staged {
+		fmt.Printf("%s is not unmerged on this device\n", inputs[0])
+		return 0
+	}
+
+	fmt.Printf("%s is unmerged on this device\n", inputs[0])
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "\nPATH\tMINE\tTHEIRS\tCONFLICT\n")
+	for _, p := range sortedCRPaths(ops) {
+		pathOps := ops[p]
+		conflict := ""
+		if len(pathOps.mine) > 0 && len(pathOps.theirs) > 0 {
+			conflict = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\n",
+			p, len(pathOps.mine), len(pathOps.theirs), conflict)
+	}
+	err = w.Flush()
+	if err != nil {
+		printError("cr status", err)
+		return 1
+	}
+	return 0
+}
+
+func crDiff(ctx context.Context, args []string) (exitStatus int) {
+	flags := flag.NewFlagSet("kbfs cr diff", flag.ContinueOnError)
+	err := flags.Parse(args)
+	if err != nil {
+		printError("cr diff", err)
+		return 1
+	}
+
+	inputs := flags.Args()
+	if len(inputs) < 1 {
+		fmt.Print(crDiffUsageStr)
+		return 1
+	}
+
+	staged, ops, err := crGetPathOps(inputs[0])
+	if err != nil {
+		printError("cr diff", err)
+		return 1
+	}
+	if !staged {
+		fmt.Printf("%s is not unmerged on this device\n", inputs[0])
+		return 0
+	}
+
+	paths := inputs[1:]
+	if len(paths) == 0 {
+		paths = sortedCRPaths(ops)
+	}
+	for _, p := range paths {
+		pathOps, ok := ops[p]
+		if !ok {
+			printError("cr diff", fmt.Errorf("%s has no changes", p))
+			return 1
+		}
+		fmt.Printf("%s:\n", p)
+		fmt.Printf("  mine:\n")
+		for _, op := range pathOps.mine {
+			fmt.Printf("    %s\n", op)
+		}
+		fmt.Printf("  theirs:\n")
+		for _, op := range pathOps.theirs {
+			fmt.Printf("    %s\n", op)
+		}
+	}
+	return 0
+}
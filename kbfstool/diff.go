@@ -0,0 +1,102 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/keybase/kbfs/fsrpc"
+	"github.com/keybase/kbfs/kbfsmd"
+	"github.com/keybase/kbfs/libkbfs"
+	"golang.org/x/net/context"
+)
+
+const diffUsageStr = `Usage:
+  kbfstool diff -from=N [-to=M] /keybase/[public|private|team]/tlf
+
+Lists the paths (relative to the folder root) created, modified,
+removed or renamed by revisions N+1 through M of the given folder,
+along with their sizes as of revision M.  M defaults to the latest
+revision.
+
+`
+
+func diffTLF(ctx context.Context, config libkbfs.Config,
+	tlfPathStr string, from, to kbfsmd.Revision) (
+	[]libkbfs.RevisionDiff, error) {
+	p, err := fsrpc.NewPath(tlfPathStr)
+	if err != nil {
+		return nil, err
+	}
+	if p.PathType != fsrpc.TLFPathType || len(p.TLFComponents) > 0 {
+		return nil, fmt.Errorf("%s is not a TLF path", tlfPathStr)
+	}
+
+	n, _, err := p.GetNode(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	if n == nil {
+		return nil, fmt.Errorf("cannot get %s", tlfPathStr)
+	}
+
+	fb := n.GetFolderBranch()
+	if to == kbfsmd.RevisionUninitialized {
+		status, _, err := config.KBFSOps().FolderStatus(ctx, fb)
+		if err != nil {
+			return nil, err
+		}
+		to = status.Revision
+	}
+	return config.KBFSOps().DiffRevisions(ctx, fb, from, to)
+}
+
+func diff(ctx context.Context, config libkbfs.Config,
+	args []string) (exitStatus int) {
+	flags := flag.NewFlagSet("kbfs diff", flag.ContinueOnError)
+	from := flags.Int64("from", 0, "The revision to diff from.")
+	to := flags.Int64("to", 0, "The revision to diff to (default latest).")
+	err := flags.Parse(args)
+	if err != nil {
+		printError("diff", err)
+		return 1
+	}
+
+	inputs := flags.Args()
+	if len(inputs) != 1 {
+		fmt.Print(diffUsageStr)
+		return 1
+	}
+	if *from < int64(kbfsmd.RevisionInitial) {
+		printError("diff", errors.New("a valid -from must be given"))
+		return 1
+	}
+
+	diffs, err := diffTLF(ctx, config, inputs[0],
+		kbfsmd.Revision(*from), kbfsmd.Revision(*to))
+	if err != nil {
+		printError("diff", err)
+		return 1
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	for _, d := range diffs {
+		name := d.Path
+		if d.Type == libkbfs.RevisionDiffRenamed {
+			name = d.OldPath + " -> " + d.Path
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", d.Type, d.EntryType, d.Size, name)
+	}
+	err = w.Flush()
+	if err != nil {
+		printError("diff", err)
+		return 1
+	}
+	return 0
+}
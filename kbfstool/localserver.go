@@ -0,0 +1,79 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/keybase/client/go/logger"
+	"github.com/keybase/kbfs/libkbfs"
+)
+
+const localServerUsageStr = `Usage:
+  kbfstool localserver [-dir=/path/to/dir] /path/to/socket
+
+Serves a single set of local MD, key and block servers on the given
+Unix domain socket, until interrupted.  Other KBFS processes can then
+share it by running with -localuser=<user> and
+
+    -mdserver=unix:/path/to/socket -bserver=unix:/path/to/socket
+
+If -dir is given, data is stored there in the same layout used by
+-mdserver=dir:/path/to/dir and -bserver=dir:/path/to/dir; otherwise it
+is kept in memory.  This is only meant for testing.
+
+`
+
+func localServer(kbCtx libkbfs.Context, args []string) (exitStatus int) {
+	flags := flag.NewFlagSet("kbfs localserver", flag.ContinueOnError)
+	dir := flags.String("dir", "", "Directory to store server data in")
+	err := flags.Parse(args)
+	if err != nil {
+		printError("localserver", err)
+		return 1
+	}
+
+	if len(flags.Args()) != 1 {
+		fmt.Print(localServerUsageStr)
+		return 1
+	}
+	socketPath := flags.Arg(0)
+
+	loggerFn := func(module string) logger.Logger {
+		return logger.New(module)
+	}
+	s, err := libkbfs.NewLocalSharedServer(kbCtx, *dir, loggerFn)
+	if err != nil {
+		printError("localserver", err)
+		return 1
+	}
+	defer s.Shutdown()
+
+	// Clean up a socket left behind by a previous run.
+	err = os.Remove(socketPath)
+	if err != nil && !os.IsNotExist(err) {
+		printError("localserver", err)
+		return 1
+	}
+	l, err := net.Listen("unix", socketPath)
+	if err != nil {
+		printError("localserver", err)
+		return 1
+	}
+	s.Serve(l)
+
+	fmt.Printf("Serving on %s\n", socketPath)
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	sig := <-sigCh
+	fmt.Printf("Received %s, shutting down\n", sig)
+	return 0
+}
@@ -42,6 +42,13 @@ The possible commands are:
   write		Write stdin to file
   md            Operate on metadata objects
   git           Operate on git repositories
+  quota         Show what is using a folder's quota
+  restore       Restore a file or directory from a past revision
+  diff          Show what changed in a folder between two revisions
+  search        Search the contents of a synced folder
+  cr            Inspect and resolve the conflicts of an unmerged folder
+  localserver   Serve local test servers to other processes
+  cache         Operate on disk block caches
 
 `
 
@@ -70,13 +77,33 @@ func realMain() (exitStatus int) {
 		return 1
 	}
 
+	// This runs its own servers, so it doesn't need a full KBFS
+	// config.
+	if flag.Arg(0) == "localserver" {
+		return localServer(kbCtx, flag.Args()[1:])
+	}
+
+	ctx := context.Background()
+
+	// This operates on an offline disk cache, so it doesn't need a
+	// full KBFS config either.
+	if flag.Arg(0) == "cache" {
+		return cacheMain(ctx, flag.Args()[1:])
+	}
+
+	// This goes through the mount of the running KBFS process,
+	// whose loaded folders it operates on.
+	if flag.Arg(0) == "cr" {
+		return crMain(ctx, flag.Args()[1:])
+	}
+
 	log := logger.New("")
 
 	// Turn these off to not interfere with a running kbfs daemon.
 	kbfsParams.EnableJournal = false
 	kbfsParams.DiskCacheMode = libkbfs.DiskCacheModeOff
+	kbfsParams.EnableCacheWarmup = false
 
-	ctx := context.Background()
 	config, err := libkbfs.Init(ctx, kbCtx, *kbfsParams, nil, nil, log)
 	if err != nil {
 		printError("kbfs", err)
@@ -107,6 +134,14 @@ func realMain() (exitStatus int) {
 		return mdMain(ctx, config, args)
 	case "git":
 		return gitMain(ctx, config, args)
+	case "quota":
+		return quota(ctx, config, args)
+	case "restore":
+		return restore(ctx, config, args)
+	case "diff":
+		return diff(ctx, config, args)
+	case "search":
+		return searchTLF(ctx, config, kbfsParams.StorageRoot, args)
 	default:
 		printError("kbfs", fmt.Errorf("unknown command %q", cmd))
 		return 1
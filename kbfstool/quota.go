@@ -0,0 +1,110 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/keybase/kbfs/fsrpc"
+	"github.com/keybase/kbfs/libkbfs"
+	"golang.org/x/net/context"
+)
+
+const quotaUsageStr = `Usage:
+  kbfstool quota [-depth=N] /keybase/[public|private|team]/tlf[/dir]
+
+Prints a breakdown of the quota used by the given directory, by
+writer and by subdirectory, along with how many bytes of the TLF
+haven't been reclaimed yet.  All sizes are encoded block sizes.
+
+`
+
+func quotaDir(ctx context.Context, config libkbfs.Config,
+	dirPathStr string, depth int) error {
+	p, err := fsrpc.NewPath(dirPathStr)
+	if err != nil {
+		return err
+	}
+	if p.PathType != fsrpc.TLFPathType {
+		return fmt.Errorf("%s is not a path within a TLF", dirPathStr)
+	}
+
+	n, err := p.GetDirNode(ctx, config)
+	if err != nil {
+		return err
+	}
+
+	breakdown, err := config.KBFSOps().GetQuotaUsageBreakdown(ctx, n, depth)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("TLF:               %s (revision %d)\n",
+		breakdown.Name, breakdown.Revision)
+	fmt.Printf("Live bytes:        %d\n", breakdown.LiveBytes)
+	fmt.Printf("MD bytes:          %d\n", breakdown.MDBytes)
+	if breakdown.UnreclaimedBytesPartial {
+		fmt.Printf("Unreclaimed bytes: at least %d (too many revisions "+
+			"since the last gc to count them all)\n",
+			breakdown.UnreclaimedBytes)
+	} else {
+		fmt.Printf("Unreclaimed bytes: %d (since revision %d)\n",
+			breakdown.UnreclaimedBytes, breakdown.LastGCRevision)
+	}
+
+	writers := make([]string, 0, len(breakdown.Writers))
+	for writer := range breakdown.Writers {
+		writers = append(writers, writer)
+	}
+	sort.Slice(writers, func(i, j int) bool {
+		return breakdown.Writers[writers[i]] > breakdown.Writers[writers[j]]
+	})
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "\nWRITER\tBYTES\n")
+	for _, writer := range writers {
+		fmt.Fprintf(w, "%s\t%d\n", writer, breakdown.Writers[writer])
+	}
+	fmt.Fprintf(w, "\nDIRECTORY\tBYTES\tFILES\tDIRS\n")
+	for _, dir := range breakdown.Dirs {
+		name := dir.Path
+		if name == "" {
+			name = "."
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\n",
+			name, dir.Bytes, dir.NumFiles, dir.NumDirs)
+	}
+	return w.Flush()
+}
+
+func quota(ctx context.Context, config libkbfs.Config,
+	args []string) (exitStatus int) {
+	flags := flag.NewFlagSet("kbfs quota", flag.ContinueOnError)
+	depth := flags.Int("depth", 1,
+		"How many levels of subdirectories to list.")
+	err := flags.Parse(args)
+	if err != nil {
+		printError("quota", err)
+		return 1
+	}
+
+	inputs := flags.Args()
+	if len(inputs) != 1 {
+		fmt.Print(quotaUsageStr)
+		return 1
+	}
+
+	err = quotaDir(ctx, config, inputs[0], *depth)
+	if err != nil {
+		printError("quota", err)
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,75 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/keybase/kbfs/fsrpc"
+	"github.com/keybase/kbfs/kbfsmd"
+	"github.com/keybase/kbfs/libkbfs"
+	"golang.org/x/net/context"
+)
+
+const restoreUsageStr = `Usage:
+  kbfstool restore -rev=N /keybase/[public|private|team]/tlf/path
+
+Restores the given file or directory, including everything under it,
+to how it was at revision N of its TLF.  The current version stays
+in the TLF's history.
+
+`
+
+func restorePath(ctx context.Context, config libkbfs.Config,
+	pathStr string, rev kbfsmd.Revision) error {
+	p, err := fsrpc.NewPath(pathStr)
+	if err != nil {
+		return err
+	}
+	if p.PathType != fsrpc.TLFPathType || len(p.TLFComponents) == 0 {
+		return fmt.Errorf("%s is not a path within a TLF", pathStr)
+	}
+
+	n, _, err := p.GetNode(ctx, config)
+	if err != nil {
+		return err
+	}
+	if n == nil {
+		return fmt.Errorf("cannot restore %s", pathStr)
+	}
+
+	return config.KBFSOps().RestoreFromRevision(ctx, n, rev)
+}
+
+func restore(ctx context.Context, config libkbfs.Config,
+	args []string) (exitStatus int) {
+	flags := flag.NewFlagSet("kbfs restore", flag.ContinueOnError)
+	rev := flags.Int64("rev", 0, "The revision to restore from.")
+	err := flags.Parse(args)
+	if err != nil {
+		printError("restore", err)
+		return 1
+	}
+
+	inputs := flags.Args()
+	if len(inputs) != 1 {
+		fmt.Print(restoreUsageStr)
+		return 1
+	}
+	if *rev < int64(kbfsmd.RevisionInitial) {
+		printError("restore", errors.New("a valid -rev must be given"))
+		return 1
+	}
+
+	err = restorePath(ctx, config, inputs[0], kbfsmd.Revision(*rev))
+	if err != nil {
+		printError("restore", err)
+		return 1
+	}
+
+	return 0
+}
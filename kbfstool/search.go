@@ -0,0 +1,90 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/keybase/kbfs/fsrpc"
+	"github.com/keybase/kbfs/libkbfs"
+	"github.com/keybase/kbfs/search"
+	"golang.org/x/net/context"
+)
+
+const searchUsageStr = `Usage:
+  kbfstool search [-max=N] /keybase/[public|private|team]/tlf[/path] words...
+
+Lists the text files at or under the given path (relative to the folder
+root) that contain all of the given words, using the search index kept
+by a kbfsfuse daemon started with -enable-search-index.  The folder must
+be synced, and the index reflects the folder as of the last time the
+daemon saw it.
+
+`
+
+func searchTLF(ctx context.Context, config libkbfs.Config,
+	storageRoot string, args []string) (exitStatus int) {
+	flags := flag.NewFlagSet("kbfs search", flag.ContinueOnError)
+	maxResults := flags.Int("max", 0,
+		"The maximum number of results to list (default unlimited).")
+	err := flags.Parse(args)
+	if err != nil {
+		printError("search", err)
+		return 1
+	}
+
+	inputs := flags.Args()
+	if len(inputs) < 2 {
+		fmt.Print(searchUsageStr)
+		return 1
+	}
+	if storageRoot == "" {
+		printError("search", errors.New("no storage root is set"))
+		return 1
+	}
+
+	p, err := fsrpc.NewPath(inputs[0])
+	if err != nil {
+		printError("search", err)
+		return 1
+	}
+	if p.PathType != fsrpc.TLFPathType {
+		printError("search", fmt.Errorf("%s is not a TLF path", inputs[0]))
+		return 1
+	}
+	// The sync config is only loaded with a disk cache, which would
+	// interfere with a running daemon.
+	if cl, ok := config.(*libkbfs.ConfigLocal); ok {
+		err = cl.LoadSyncedTlfs()
+		if err != nil {
+			printError("search", err)
+			return 1
+		}
+	}
+	h, err := fsrpc.ParseTlfHandle(
+		ctx, config.KBPKI(), config.MDOps(), p.TLFName, p.TLFType)
+	if err != nil {
+		printError("search", err)
+		return 1
+	}
+
+	paths, rev, err := search.SearchSavedIndex(ctx, config,
+		filepath.Join(storageRoot, search.IndexFolderName), h,
+		strings.Join(p.TLFComponents, "/"),
+		strings.Join(inputs[1:], " "), *maxResults)
+	if err != nil {
+		printError("search", err)
+		return 1
+	}
+	fmt.Printf("# As of revision %d\n", rev)
+	for _, path := range paths {
+		fmt.Println(path)
+	}
+	return 0
+}
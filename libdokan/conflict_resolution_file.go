@@ -0,0 +1,66 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libdokan
+
+import (
+	"github.com/keybase/kbfs/dokan"
+	"github.com/keybase/kbfs/libfs"
+	"github.com/keybase/kbfs/libkbfs"
+	"golang.org/x/net/context"
+)
+
+// AutoCRFile represents a write-only file where any write of at
+// least one byte either pauses or restarts automatic conflict
+// resolution for the folder.
+type AutoCRFile struct {
+	specialWriteFile
+	folder *Folder
+	enable bool
+}
+
+// WriteFile implements writes for dokan.
+func (f *AutoCRFile) WriteFile(ctx context.Context, fi *dokan.FileInfo,
+	bs []byte, offset int64) (n int, err error) {
+	f.folder.fs.logEnter(ctx, "AutoCRFile Write")
+	defer func() { f.folder.reportErr(ctx, libkbfs.WriteMode, err) }()
+	if len(bs) == 0 {
+		return 0, nil
+	}
+
+	err = f.folder.fs.config.KBFSOps().SetAutoConflictResolution(
+		ctx, f.folder.getFolderBranch(), f.enable)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(bs), nil
+}
+
+// ResolveConflictsFile is a special file used to resolve a folder's
+// unmerged changes, choosing which versions of conflicted files to
+// keep.
+type ResolveConflictsFile struct {
+	specialWriteFile
+	folder *Folder
+}
+
+// WriteFile implements writes for dokan.
+func (f *ResolveConflictsFile) WriteFile(ctx context.Context,
+	fi *dokan.FileInfo, bs []byte, offset int64) (n int, err error) {
+	f.folder.fs.logEnter(ctx, "ResolveConflictsFile Write")
+	defer func() { f.folder.reportErr(ctx, libkbfs.WriteMode, err) }()
+	if offset != 0 {
+		// The whole JSON object must come in a single write.
+		return 0, dokan.ErrAccessDenied
+	}
+
+	err = libfs.ResolveConflicts(
+		ctx, f.folder.fs.config, f.folder.getFolderBranch(), bs)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(bs), nil
+}
@@ -0,0 +1,100 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libdokan
+
+import (
+	"time"
+
+	"github.com/keybase/kbfs/dokan"
+	"github.com/keybase/kbfs/libfs"
+	"github.com/keybase/kbfs/libkbfs"
+	"golang.org/x/net/context"
+)
+
+// DeletedEntriesDir is a node listing the entries recently deleted
+// from a TLF that can still be undeleted.
+type DeletedEntriesDir struct {
+	folder *Folder
+	emptyFile
+}
+
+// GetFileInformation for dokan.
+func (*DeletedEntriesDir) GetFileInformation(ctx context.Context, fi *dokan.FileInfo) (st *dokan.Stat, err error) {
+	return defaultDirectoryInformation()
+}
+
+// open tries to open a file.
+func (d *DeletedEntriesDir) open(ctx context.Context, oc *openContext, path []string) (f dokan.File, cs dokan.CreateStatus, err error) {
+	if len(path) == 0 {
+		return oc.returnDirNoCleanup(d)
+	}
+	d.folder.fs.logEnter(ctx, "DeletedEntriesDir open")
+	defer func() { d.folder.reportErr(ctx, libkbfs.ReadMode, err) }()
+	if len(path) > 1 {
+		return nil, 0, dokan.ErrObjectNameNotFound
+	}
+	name := path[0]
+	_, ok, err := libfs.GetDeletedEntry(
+		ctx, d.folder.fs.config, d.folder.getFolderBranch(), name)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !ok {
+		return nil, 0, dokan.ErrObjectNameNotFound
+	}
+	return oc.returnFileNoCleanup(&SpecialReadFile{
+		read: func(ctx context.Context) ([]byte, time.Time, error) {
+			return libfs.GetEncodedDeletedEntry(ctx, d.folder.fs.config,
+				d.folder.getFolderBranch(), name)
+		},
+		fs: d.folder.fs,
+	})
+}
+
+// FindFiles does readdir for dokan.
+func (d *DeletedEntriesDir) FindFiles(ctx context.Context, fi *dokan.FileInfo, ignored string, callback func(*dokan.NamedStat) error) (err error) {
+	d.folder.fs.logEnter(ctx, "DeletedEntriesDir FindFiles")
+	defer func() { d.folder.reportErr(ctx, libkbfs.ReadMode, err) }()
+	names, err := libfs.GetDeletedEntryNames(
+		ctx, d.folder.fs.config, d.folder.getFolderBranch())
+	if err != nil {
+		return err
+	}
+	var ns dokan.NamedStat
+	ns.FileAttributes = dokan.FileAttributeReadonly
+	for _, name := range names {
+		ns.Name = name
+		err := callback(&ns)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UndeleteFile is a special file used to undelete an entry listed in
+// the DeletedEntriesDir of a TLF.
+type UndeleteFile struct {
+	specialWriteFile
+	folder *Folder
+}
+
+// WriteFile implements writes for dokan.
+func (f *UndeleteFile) WriteFile(ctx context.Context, fi *dokan.FileInfo,
+	bs []byte, offset int64) (n int, err error) {
+	f.folder.fs.logEnter(ctx, "UndeleteFile Write")
+	defer func() { f.folder.reportErr(ctx, libkbfs.WriteMode, err) }()
+	if len(bs) == 0 {
+		return 0, nil
+	}
+
+	err = libfs.Undelete(
+		ctx, f.folder.fs.config, f.folder.getFolderBranch(), bs)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(bs), nil
+}
@@ -309,6 +309,18 @@ func (d *Dir) open(ctx context.Context, oc *openContext, path []string) (dokan.F
 
 		leaf := len(path) == 1
 
+		if path[0] == libfs.DeletedEntriesDirName {
+			return (&DeletedEntriesDir{folder: d.folder}).open(
+				ctx, oc, path[1:])
+		}
+
+		if leaf && path[0] == libfs.QuotaUsageFileName {
+			if err := oc.ReturningFileAllowed(); err != nil {
+				return nil, 0, err
+			}
+			return NewQuotaUsageFile(d.folder.fs, d.node), 0, nil
+		}
+
 		// Check if this is a per-file metainformation file, if so
 		// return the corresponding SpecialReadFile.
 		if leaf && strings.HasPrefix(path[0], libfs.FileInfoPrefix) {
@@ -319,6 +331,22 @@ func (d *Dir) open(ctx context.Context, oc *openContext, path []string) (dokan.F
 			return NewFileInfoFile(d.folder.fs, d.node, name), 0, nil
 		}
 
+		if leaf && strings.HasPrefix(path[0], libfs.FileRevisionsPrefix) {
+			if err := oc.ReturningFileAllowed(); err != nil {
+				return nil, 0, err
+			}
+			name := path[0][len(libfs.FileRevisionsPrefix):]
+			return NewFileRevisionsFile(d.folder.fs, d.node, name), 0, nil
+		}
+
+		if leaf && strings.HasPrefix(path[0], libfs.RestoreFromRevisionPrefix) {
+			if err := oc.ReturningFileAllowed(); err != nil {
+				return nil, 0, err
+			}
+			name := path[0][len(libfs.RestoreFromRevisionPrefix):]
+			return &RestoreFile{folder: d.folder, dir: d.node, name: name}, 0, nil
+		}
+
 		newNode, de, err := d.folder.fs.config.KBFSOps().Lookup(ctx, d.node, path[0])
 
 		// If we are in the final component, check if it is a creation.
@@ -334,6 +362,27 @@ func (d *Dir) open(ctx context.Context, oc *openContext, path []string) (dokan.F
 			}
 		}
 
+		// If this names an older version of a file, open it within
+		// the archived TLF at that revision.
+		if leaf && isNoSuchNameError(err) {
+			rev, filePath, ok, revErr := libfs.FileRevisionPath(
+				ctx, d.folder.fs.config, d.node, path[0])
+			if revErr != nil {
+				return nil, 0, revErr
+			}
+			if ok {
+				archivedTLF := newTLF(
+					d.folder.list, d.folder.h, d.folder.hPreferredName)
+				_, _, err := archivedTLF.loadArchivedDir(
+					ctx, "open", libkbfs.MakeRevBranchName(rev))
+				if err != nil {
+					return nil, 0, err
+				}
+				return archivedTLF.open(
+					ctx, oc, strings.Split(filePath, "/"))
+			}
+		}
+
 		// Return errors from Lookup
 		if err != nil {
 			return nil, 0, err
@@ -0,0 +1,25 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libdokan
+
+import (
+	"time"
+
+	"github.com/keybase/kbfs/libfs"
+	"github.com/keybase/kbfs/libkbfs"
+	"golang.org/x/net/context"
+)
+
+// NewFileRevisionsFile returns a special read file that contains a
+// JSON list of the recent versions of the file `name` in `dir`.
+func NewFileRevisionsFile(
+	fs *FS, dir libkbfs.Node, name string) *SpecialReadFile {
+	return &SpecialReadFile{
+		read: func(ctx context.Context) ([]byte, time.Time, error) {
+			return libfs.GetEncodedFileRevisions(ctx, fs.config, dir, name)
+		},
+		fs: fs,
+	}
+}
@@ -311,6 +311,8 @@ func (f *FS) open(ctx context.Context, oc *openContext, ps []string) (dokan.File
 		return oc.returnFileNoCleanup(NewErrorFile(f))
 	case libfs.MetricsFileName == ps[psl-1]:
 		return oc.returnFileNoCleanup(NewMetricsFile(f))
+	case libfs.PrometheusMetricsFileName == ps[psl-1]:
+		return oc.returnFileNoCleanup(NewPrometheusMetricsFile(f))
 		// TODO: Make the two cases below available from any
 		// directory.
 	case libfs.ProfileListDirName == ps[0]:
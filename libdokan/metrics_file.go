@@ -13,3 +13,10 @@ import (
 func NewMetricsFile(fs *FS) *SpecialReadFile {
 	return &SpecialReadFile{read: libfs.GetEncodedMetrics(fs.config), fs: fs}
 }
+
+// NewPrometheusMetricsFile returns a special read file that contains
+// all metrics in the Prometheus text format.
+func NewPrometheusMetricsFile(fs *FS) *SpecialReadFile {
+	return &SpecialReadFile{
+		read: libfs.GetEncodedPrometheusMetrics(fs.config), fs: fs}
+}
@@ -0,0 +1,52 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libdokan
+
+import (
+	"time"
+
+	"github.com/keybase/kbfs/dokan"
+	"github.com/keybase/kbfs/libfs"
+	"github.com/keybase/kbfs/libkbfs"
+	"golang.org/x/net/context"
+)
+
+// QuotaReclamationPolicyFile is a special file used to set the quota
+// reclamation policy of a TLF.
+type QuotaReclamationPolicyFile struct {
+	specialWriteFile
+	folder *Folder
+}
+
+// WriteFile implements writes for dokan.
+func (f *QuotaReclamationPolicyFile) WriteFile(ctx context.Context,
+	fi *dokan.FileInfo, bs []byte, offset int64) (n int, err error) {
+	f.folder.fs.logEnter(ctx, "QuotaReclamationPolicyFile Write")
+	defer func() { f.folder.reportErr(ctx, libkbfs.WriteMode, err) }()
+	if offset != 0 {
+		// The whole JSON object must come in a single write.
+		return 0, dokan.ErrAccessDenied
+	}
+
+	err = libfs.SetQuotaReclamationPolicy(
+		f.folder.fs.config, f.folder.getFolderBranch(), bs)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(bs), nil
+}
+
+// NewReclaimQuotaDryRunFile returns a special read file that
+// describes what the next quota reclamation of the TLF would delete.
+func NewReclaimQuotaDryRunFile(folder *Folder) *SpecialReadFile {
+	return &SpecialReadFile{
+		read: func(ctx context.Context) ([]byte, time.Time, error) {
+			return libfs.GetEncodedQuotaReclamationDryRun(
+				ctx, folder.fs.config, folder.getFolderBranch())
+		},
+		fs: folder.fs,
+	}
+}
@@ -0,0 +1,24 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libdokan
+
+import (
+	"time"
+
+	"github.com/keybase/kbfs/libfs"
+	"github.com/keybase/kbfs/libkbfs"
+	"golang.org/x/net/context"
+)
+
+// NewQuotaUsageFile returns a special read file that contains a JSON
+// breakdown of the quota used by the given directory.
+func NewQuotaUsageFile(fs *FS, dir libkbfs.Node) *SpecialReadFile {
+	return &SpecialReadFile{
+		read: func(ctx context.Context) ([]byte, time.Time, error) {
+			return libfs.GetEncodedQuotaUsage(ctx, fs.config, dir)
+		},
+		fs: fs,
+	}
+}
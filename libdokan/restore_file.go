@@ -0,0 +1,41 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libdokan
+
+import (
+	"github.com/keybase/kbfs/dokan"
+	"github.com/keybase/kbfs/libfs"
+	"github.com/keybase/kbfs/libkbfs"
+	"golang.org/x/net/context"
+)
+
+// RestoreFile is a special file used to restore a file or directory
+// from a past revision of its TLF.
+type RestoreFile struct {
+	specialWriteFile
+	folder *Folder
+	dir    libkbfs.Node
+	// name is the entry in dir to restore; if empty, dir itself is
+	// restored.
+	name string
+}
+
+// WriteFile implements writes for dokan.
+func (f *RestoreFile) WriteFile(ctx context.Context, fi *dokan.FileInfo,
+	bs []byte, offset int64) (n int, err error) {
+	f.folder.fs.logEnter(ctx, "RestoreFile Write")
+	defer func() { f.folder.reportErr(ctx, libkbfs.WriteMode, err) }()
+	if len(bs) == 0 {
+		return 0, nil
+	}
+
+	err = libfs.RestoreFromRevision(
+		ctx, f.folder.fs.config, f.dir, f.name, bs)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(bs), nil
+}
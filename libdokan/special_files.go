@@ -95,6 +95,50 @@ func handleTLFSpecialFile(name string, folder *Folder) dokan.File {
 			folder: folder,
 			action: libfs.SyncDisable,
 		}
+
+	case libfs.SyncPathsFileName:
+		return &SyncPathsFile{
+			folder: folder,
+		}
+
+	case libfs.DiskCacheSettingsFileName:
+		return &DiskCacheSettingsFile{
+			folder: folder,
+		}
+
+	case libfs.QuotaReclamationPolicyFileName:
+		return &QuotaReclamationPolicyFile{
+			folder: folder,
+		}
+
+	case libfs.ConflictRenameTemplateFileName:
+		return &ConflictRenameTemplateFile{
+			folder: folder,
+		}
+
+	case libfs.DisableAutoCRFileName:
+		return &AutoCRFile{
+			folder: folder,
+		}
+
+	case libfs.EnableAutoCRFileName:
+		return &AutoCRFile{
+			folder: folder,
+			enable: true,
+		}
+
+	case libfs.ResolveConflictsFileName:
+		return &ResolveConflictsFile{
+			folder: folder,
+		}
+
+	case libfs.ReclaimQuotaDryRunFileName:
+		return NewReclaimQuotaDryRunFile(folder)
+
+	case libfs.UndeleteFileName:
+		return &UndeleteFile{
+			folder: folder,
+		}
 	}
 
 	return nil
@@ -0,0 +1,38 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libdokan
+
+import (
+	"github.com/keybase/kbfs/dokan"
+	"github.com/keybase/kbfs/libfs"
+	"github.com/keybase/kbfs/libkbfs"
+	"golang.org/x/net/context"
+)
+
+// SyncPathsFile is a special file used to set the paths of a TLF
+// that are synced for offline use.
+type SyncPathsFile struct {
+	specialWriteFile
+	folder *Folder
+}
+
+// WriteFile implements writes for dokan.
+func (f *SyncPathsFile) WriteFile(ctx context.Context,
+	fi *dokan.FileInfo, bs []byte, offset int64) (n int, err error) {
+	f.folder.fs.logEnter(ctx, "SyncPathsFile Write")
+	defer func() { f.folder.reportErr(ctx, libkbfs.WriteMode, err) }()
+	if offset != 0 {
+		// The whole list of paths must come in a single write.
+		return 0, dokan.ErrAccessDenied
+	}
+
+	err = libfs.SetSyncPaths(ctx, f.folder.fs.config,
+		f.folder.getFolderBranch(), f.folder.h, bs)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(bs), nil
+}
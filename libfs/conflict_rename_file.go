@@ -0,0 +1,23 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libfs
+
+import (
+	"strings"
+
+	"github.com/keybase/kbfs/libkbfs"
+)
+
+// SetConflictRenameTemplate sets the template the given TLF uses to
+// name conflicted entries to the text in `data`, ignoring surrounding
+// whitespace.  Empty text restores the default names.
+func SetConflictRenameTemplate(
+	c libkbfs.Config, fb libkbfs.FolderBranch, data []byte) error {
+	if fb == (libkbfs.FolderBranch{}) {
+		panic("zero fb in SetConflictRenameTemplate")
+	}
+	return c.SetConflictRenameTemplate(
+		fb.Tlf, strings.TrimSpace(string(data)))
+}
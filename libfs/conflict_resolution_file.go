@@ -0,0 +1,42 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/keybase/kbfs/libkbfs"
+	"golang.org/x/net/context"
+)
+
+// ResolveConflicts resolves the conflicts between this device's
+// unmerged changes to the given TLF and the merged branch.  `data` is
+// a JSON object mapping the paths of conflicted files, relative to
+// the TLF root, to the version of each to keep: "mine", "theirs" or
+// "both".  Conflicted entries that aren't mentioned keep both
+// versions.
+func ResolveConflicts(ctx context.Context, c libkbfs.Config,
+	fb libkbfs.FolderBranch, data []byte) error {
+	if fb == (libkbfs.FolderBranch{}) {
+		panic("zero fb in ResolveConflicts")
+	}
+
+	var choiceStrs map[string]string
+	err := json.NewDecoder(bytes.NewReader(data)).Decode(&choiceStrs)
+	if err != nil {
+		return err
+	}
+	choices := make(map[string]libkbfs.ConflictChoice, len(choiceStrs))
+	for p, s := range choiceStrs {
+		choice, err := libkbfs.ParseConflictChoice(s)
+		if err != nil {
+			return err
+		}
+		choices[strings.Trim(p, "/")] = choice
+	}
+	return c.KBFSOps().ResolveConflicts(ctx, fb, choices)
+}
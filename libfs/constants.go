@@ -8,6 +8,11 @@ package libfs
 // reached from any KBFS directory.
 const MetricsFileName = ".kbfs_metrics"
 
+// PrometheusMetricsFileName is the name of the KBFS metrics file in
+// the Prometheus text format -- it can be reached from any KBFS
+// directory.
+const PrometheusMetricsFileName = ".kbfs_metrics.prom"
+
 // ReclaimQuotaFileName is the name of the KBFS quota-reclaiming file
 // -- it can be reached anywhere within a top-level folder.
 const ReclaimQuotaFileName = ".kbfs_reclaim_quota"
@@ -97,6 +102,13 @@ const UpdateHistoryFileName = ".kbfs_update_history"
 // FileInfoPrefix is the prefix of the per-file metadata files.
 const FileInfoPrefix = ".kbfs_fileinfo_"
 
+// RestoreFromRevisionPrefix is the prefix of the per-file files used
+// to restore a file or directory from a past revision: writing a
+// revision number to `.kbfs_restore_from_rev_<name>` restores
+// `<name>` as it was at that revision.  With no name, the directory
+// containing the file is restored.
+const RestoreFromRevisionPrefix = ".kbfs_restore_from_rev_"
+
 // EnableSyncFileName is the name of the file to enable the sync cache for a
 // TLF. It can be reached anywhere within a TLF.
 const EnableSyncFileName = ".kbfs_enable_sync"
@@ -105,6 +117,89 @@ const EnableSyncFileName = ".kbfs_enable_sync"
 // TLF. It can be reached anywhere within a TLF.
 const DisableSyncFileName = ".kbfs_disable_sync"
 
+// SyncPathsFileName is the name of the file to sync only certain
+// paths of a TLF: writing a newline-separated list of paths relative
+// to the TLF root, possibly containing glob patterns, marks them for
+// offline sync, and writing an empty list disables syncing. It can be
+// reached anywhere within a TLF.
+const SyncPathsFileName = ".kbfs_sync_paths"
+
+// DiskCacheSettingsFileName is the name of the file to set how a
+// TLF's blocks are kept in the working set disk cache: writing a
+// JSON object like `{"Pinned": true, "LimitBytes": 1073741824}`
+// replaces the TLF's settings, and writing `{}` resets them. It can
+// be reached anywhere within a TLF.
+const DiskCacheSettingsFileName = ".kbfs_disk_cache_settings"
+
+// QuotaUsageFileName is the name of the file containing a JSON
+// breakdown of the quota used by the directory it's in, by writer
+// and by subdirectory, along with the TLF's unreclaimed bytes. It
+// can be reached anywhere within a TLF.
+const QuotaUsageFileName = ".kbfs_quota_usage"
+
+// QuotaReclamationPolicyFileName is the name of the file to set a
+// TLF's quota reclamation policy on this device: writing a JSON
+// object like `{"MinUnrefAge": "2160h", "Period": "0s"}` replaces
+// the TLF's policy, and writing `{}` resets it to the global
+// defaults. A "0s" period turns off automatic reclamation. It can be
+// reached anywhere within a TLF.
+const QuotaReclamationPolicyFileName = ".kbfs_quota_reclamation_policy"
+
+// ConflictRenameTemplateFileName is the name of the file to set the
+// template a TLF uses to name conflicted entries, like
+// `.conflicts/{{.Base}}.{{.User}}{{.Ext}}`: writing a template
+// replaces the TLF's template, and writing an empty file restores the
+// default names. It can be reached anywhere within a TLF.
+const ConflictRenameTemplateFileName = ".kbfs_conflict_rename_template"
+
+// DisableAutoCRFileName is the name of the file to pause automatic
+// conflict resolution for a TLF until KBFS restarts, so that its
+// unmerged changes can be resolved manually by writing to
+// ResolveConflictsFileName. It can be reached anywhere within a TLF.
+const DisableAutoCRFileName = ".kbfs_disable_auto_cr"
+
+// EnableAutoCRFileName is the name of the file to restart automatic
+// conflict resolution for a TLF. It can be reached anywhere within a
+// TLF.
+const EnableAutoCRFileName = ".kbfs_enable_auto_cr"
+
+// ResolveConflictsFileName is the name of the file to resolve a TLF's
+// unmerged changes: writing a JSON object like `{"a/b": "mine", "c":
+// "theirs"}` resolves them, keeping only the given version of each
+// named file with conflicting contents. It can be reached anywhere
+// within a TLF.
+const ResolveConflictsFileName = ".kbfs_resolve_conflicts"
+
+// ReclaimQuotaDryRunFileName is the name of the file containing a
+// JSON description of what the next quota reclamation of a TLF would
+// delete, without deleting anything. It can be reached anywhere
+// within a TLF.
+const ReclaimQuotaDryRunFileName = ".kbfs_reclaim_quota_dry_run"
+
+// DeletedEntriesDirName is the name of the directory listing the
+// entries recently deleted from a TLF that can still be undeleted,
+// one file per entry, each containing a JSON description of the
+// entry. It can be reached anywhere within a TLF.
+const DeletedEntriesDirName = ".kbfs_deleted"
+
+// UndeleteFileName is the name of the file to undelete an entry:
+// writing the name of a file in DeletedEntriesDirName to it restores
+// that entry from the last revision in which it was live. A
+// directory removed recursively is restored along with its
+// contents. It can be reached anywhere within a TLF.
+const UndeleteFileName = ".kbfs_undelete"
+
+// FileRevisionsPrefix is the prefix of the file that contains a JSON
+// list of the recent versions of the file named by the rest of the
+// name, with the writer, time and size of each version.
+const FileRevisionsPrefix = ".kbfs_revisions_"
+
+// FileRevisionSeparator separates a file name from a TLF revision
+// number in a name that refers directly to the version of that file
+// as of that revision, e.g. "foo.txt@12".  Such names are only
+// resolved when no real entry by that name exists.
+const FileRevisionSeparator = "@"
+
 // ArchivedRevDirPrefix is the prefix to the directory at the root of a
 // TLF that exposes a version of that TLF at the specified revision.
 const ArchivedRevDirPrefix = ".kbfs_archived_rev="
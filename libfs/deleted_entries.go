@@ -0,0 +1,115 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libfs
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/keybase/kbfs/kbfsmd"
+	"github.com/keybase/kbfs/libkbfs"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+var deletedEntryPathEscaper = strings.NewReplacer("%", "%25", "/", "%2F")
+
+// DeletedEntryName returns the name of the file representing `e` in
+// the DeletedEntriesDirName directory.  It is made up of the
+// revision that deleted the entry and the entry's path, with any
+// slashes escaped.
+func DeletedEntryName(e libkbfs.DeletedEntry) string {
+	return fmt.Sprintf(
+		"%d-%s", e.Revision, deletedEntryPathEscaper.Replace(e.Path))
+}
+
+// ParseDeletedEntryName parses a name returned by DeletedEntryName
+// into the path and deletion revision of the entry.
+func ParseDeletedEntryName(name string) (
+	p string, rev kbfsmd.Revision, err error) {
+	i := strings.Index(name, "-")
+	if i < 0 {
+		return "", kbfsmd.RevisionUninitialized,
+			errors.Errorf("Invalid deleted entry name %q", name)
+	}
+	r, err := strconv.ParseInt(name[:i], 10, 64)
+	if err != nil {
+		return "", kbfsmd.RevisionUninitialized, err
+	}
+	p, err = url.PathUnescape(name[i+1:])
+	if err != nil {
+		return "", kbfsmd.RevisionUninitialized, err
+	}
+	return p, kbfsmd.Revision(r), nil
+}
+
+// GetDeletedEntryNames returns the names of all the entries that can
+// currently be undeleted from the given TLF.
+func GetDeletedEntryNames(
+	ctx context.Context, config libkbfs.Config,
+	folderBranch libkbfs.FolderBranch) ([]string, error) {
+	entries, err := config.KBFSOps().GetDeletedEntries(ctx, folderBranch)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, DeletedEntryName(e))
+	}
+	return names, nil
+}
+
+// GetDeletedEntry returns the deleted entry of the given TLF with the
+// given name, if it can still be undeleted.
+func GetDeletedEntry(
+	ctx context.Context, config libkbfs.Config,
+	folderBranch libkbfs.FolderBranch, name string) (
+	e libkbfs.DeletedEntry, ok bool, err error) {
+	entries, err := config.KBFSOps().GetDeletedEntries(ctx, folderBranch)
+	if err != nil {
+		return libkbfs.DeletedEntry{}, false, err
+	}
+	for _, e := range entries {
+		if DeletedEntryName(e) == name {
+			return e, true, nil
+		}
+	}
+	return libkbfs.DeletedEntry{}, false, nil
+}
+
+// GetEncodedDeletedEntry returns serialized JSON describing the
+// deleted entry of the given TLF with the given name.
+func GetEncodedDeletedEntry(
+	ctx context.Context, config libkbfs.Config,
+	folderBranch libkbfs.FolderBranch, name string) (
+	data []byte, t time.Time, err error) {
+	e, ok, err := GetDeletedEntry(ctx, config, folderBranch, name)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if !ok {
+		return nil, time.Time{}, libkbfs.NoSuchNameError{Name: name}
+	}
+	data, err = PrettyJSON(e)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return data, e.Time, nil
+}
+
+// Undelete restores the deleted entry of the given TLF whose name, as
+// listed in DeletedEntriesDirName, is in `data`.
+func Undelete(
+	ctx context.Context, config libkbfs.Config,
+	folderBranch libkbfs.FolderBranch, data []byte) error {
+	p, rev, err := ParseDeletedEntryName(strings.TrimSpace(string(data)))
+	if err != nil {
+		return err
+	}
+	return config.KBFSOps().UndeleteEntry(ctx, folderBranch, p, rev)
+}
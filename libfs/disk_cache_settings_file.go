@@ -0,0 +1,33 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libfs
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/keybase/kbfs/libkbfs"
+	"golang.org/x/net/context"
+)
+
+// SetDiskCacheSettings sets the working set disk cache settings of
+// the given TLF from the JSON-encoded libkbfs.DiskCacheTlfSettings in
+// `data`.  Fields missing from `data` are reset to their defaults.
+func SetDiskCacheSettings(
+	ctx context.Context, c libkbfs.Config, fb libkbfs.FolderBranch,
+	data []byte) error {
+	if fb == (libkbfs.FolderBranch{}) {
+		panic("zero fb in SetDiskCacheSettings")
+	}
+
+	var settings libkbfs.DiskCacheTlfSettings
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&settings)
+	if err != nil {
+		return err
+	}
+	return c.SetDiskCacheTlfSettings(ctx, fb.Tlf, settings)
+}
@@ -0,0 +1,430 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/keybase/client/go/logger"
+	"github.com/keybase/client/go/protocol/keybase1"
+	"github.com/keybase/kbfs/ioutil"
+	"github.com/keybase/kbfs/kbfsmd"
+	"github.com/keybase/kbfs/libkbfs"
+	"github.com/keybase/kbfs/tlf"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+type ctxEventStreamTagKey int
+
+const (
+	ctxEventStreamIDKey ctxEventStreamTagKey = iota
+)
+
+const ctxEventStreamOpID = "EVSTREAM"
+
+// eventStreamKeepAlive is how often an idle stream sends a comment
+// line, so that clients (and the server) notice dead connections.
+const eventStreamKeepAlive = 30 * time.Second
+
+// StreamEvent is a single change reported by an EventStream, encoded
+// as JSON.
+type StreamEvent struct {
+	// Tlf is the canonical path of the changed TLF, e.g.
+	// "/keybase/team/acme".
+	Tlf string `json:"tlf"`
+	// Op is one of the WatchOp strings, e.g. "CREATE".
+	Op string `json:"op"`
+	// Path is the changed path, relative to the root of the TLF.
+	// For renames, it is the new path.
+	Path string `json:"path"`
+	// OldPath is the previous path of a renamed entry.
+	OldPath string `json:"oldPath,omitempty"`
+	// Writer is the user who made the change, if known.
+	Writer string `json:"writer,omitempty"`
+	// Revision is the TLF revision that includes the change.  It is
+	// omitted for writes made on this device that haven't been synced
+	// yet, and for replayed history.
+	Revision kbfsmd.Revision `json:"revision,omitempty"`
+	// ServerTime is when the change was made, in milliseconds since
+	// the epoch.  It is only set for replayed history.
+	ServerTime keybase1.Time `json:"serverTime,omitempty"`
+	// History is true if the event was replayed from the TLF's edit
+	// history, rather than observed live.
+	History bool `json:"history,omitempty"`
+}
+
+// EventStream is an http.Handler that streams changes to one or more
+// TLFs as server-sent events, each carrying a JSON StreamEvent.  It
+// accepts GET requests where each "tlf" query parameter names a TLF
+// to watch (e.g., "/keybase/team/acme" or "private/alice"), an
+// optional "prefix" parameter limits the events to changes at or
+// under that path within each TLF, and "history=1" replays the
+// recent edit history of each TLF, oldest first, before any live
+// events.
+//
+// Live events come from the same change notifications as a Watcher,
+// and replayed ones from the kbfsedits history.  The stream stays
+// open until the client disconnects.
+type EventStream struct {
+	config libkbfs.Config
+	log    logger.Logger
+}
+
+var _ http.Handler = (*EventStream)(nil)
+
+// NewEventStream returns a new EventStream for the given config.
+func NewEventStream(config libkbfs.Config) *EventStream {
+	return &EventStream{
+		config: config,
+		log:    config.MakeLogger("EVSTREAM"),
+	}
+}
+
+// parseEventStreamTlf splits a TLF given to the "tlf" query parameter
+// into its type and name.
+func parseEventStreamTlf(p string) (tlf.Type, string, error) {
+	p = strings.Trim(path.Clean("/"+p), "/")
+	p = strings.TrimPrefix(p, "keybase/")
+	fields := strings.Split(p, "/")
+	if len(fields) != 2 || fields[1] == "" {
+		return tlf.Unknown, "", errors.Errorf("bad TLF %q", p)
+	}
+	t, err := tlf.ParseTlfTypeFromPath(fields[0])
+	if err != nil {
+		return tlf.Unknown, "", err
+	}
+	return t, fields[1], nil
+}
+
+// cleanEventStreamPrefix normalizes a "prefix" query parameter into a
+// path relative to the TLF root, or "" to match everything.
+func cleanEventStreamPrefix(p string) string {
+	p = strings.Trim(path.Clean("/"+p), "/")
+	return p
+}
+
+func eventStreamMatches(prefix, p string) bool {
+	return prefix == "" || p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+func (e StreamEvent) matches(prefix string) bool {
+	return eventStreamMatches(prefix, e.Path) ||
+		(e.OldPath != "" && eventStreamMatches(prefix, e.OldPath))
+}
+
+// eventStreamSub is a single watched TLF within one stream.
+type eventStreamSub struct {
+	fs      *FS
+	tlfPath string
+	watcher *Watcher
+}
+
+func (es *EventStream) subscribe(ctx context.Context, tlfParam string) (
+	*eventStreamSub, error) {
+	t, name, err := parseEventStreamTlf(tlfParam)
+	if err != nil {
+		return nil, err
+	}
+	h, err := libkbfs.GetHandleFromFolderNameAndType(
+		ctx, es.config.KBPKI(), es.config.MDOps(), name, t)
+	if err != nil {
+		return nil, err
+	}
+	fs, err := NewFS(
+		ctx, es.config, h, libkbfs.MasterBranch, "", "",
+		keybase1.MDPriorityNormal)
+	if err != nil {
+		return nil, err
+	}
+	w, err := fs.Watch("", true)
+	if err != nil {
+		return nil, err
+	}
+	return &eventStreamSub{
+		fs:      fs,
+		tlfPath: h.GetCanonicalPath(),
+		watcher: w,
+	}, nil
+}
+
+func streamEventFromWatch(tlfPath string, we WatchEvent) StreamEvent {
+	return StreamEvent{
+		Tlf:      tlfPath,
+		Op:       we.Op.String(),
+		Path:     we.Path,
+		OldPath:  we.OldPath,
+		Writer:   we.Writer.String(),
+		Revision: we.Revision,
+	}
+}
+
+func watchOpFromNotificationType(t keybase1.FSNotificationType) (
+	WatchOp, bool) {
+	switch t {
+	case keybase1.FSNotificationType_FILE_CREATED:
+		return WatchCreate, true
+	case keybase1.FSNotificationType_FILE_MODIFIED:
+		return WatchWrite, true
+	case keybase1.FSNotificationType_FILE_DELETED:
+		return WatchRemove, true
+	case keybase1.FSNotificationType_FILE_RENAMED:
+		return WatchRename, true
+	default:
+		return 0, false
+	}
+}
+
+// history returns the recent edit history of the subscribed TLF as
+// events, oldest first.
+func (sub *eventStreamSub) history(ctx context.Context) (
+	[]StreamEvent, error) {
+	edits, err := sub.fs.config.KBFSOps().GetEditHistory(
+		ctx, sub.fs.root.GetFolderBranch())
+	if err != nil {
+		return nil, err
+	}
+	var events []StreamEvent
+	for _, wh := range edits.History {
+		for _, edit := range wh.Edits {
+			op, ok := watchOpFromNotificationType(edit.NotificationType)
+			if !ok {
+				continue
+			}
+			// History filenames are full canonical paths.
+			p := strings.TrimPrefix(edit.Filename, sub.tlfPath)
+			if p == edit.Filename {
+				continue
+			}
+			events = append(events, StreamEvent{
+				Tlf:        sub.tlfPath,
+				Op:         op.String(),
+				Path:       strings.TrimPrefix(p, "/"),
+				Writer:     wh.WriterName,
+				ServerTime: edit.ServerTime,
+				History:    true,
+			})
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].ServerTime < events[j].ServerTime
+	})
+	return events, nil
+}
+
+type eventStreamWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func (esw eventStreamWriter) send(e StreamEvent) error {
+	buf, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(esw.w, "data: %s\n\n", buf)
+	if err != nil {
+		return err
+	}
+	esw.flusher.Flush()
+	return nil
+}
+
+func (esw eventStreamWriter) keepAlive() error {
+	_, err := fmt.Fprint(esw.w, ": keepalive\n\n")
+	if err != nil {
+		return err
+	}
+	esw.flusher.Flush()
+	return nil
+}
+
+// ServeHTTP implements the http.Handler interface for EventStream.
+func (es *EventStream) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	q := req.URL.Query()
+	tlfParams := q["tlf"]
+	if len(tlfParams) == 0 {
+		http.Error(w, "no tlf given", http.StatusBadRequest)
+		return
+	}
+	prefix := cleanEventStreamPrefix(q.Get("prefix"))
+	history := q.Get("history") == "1" || q.Get("history") == "true"
+
+	ctx, cancel := context.WithCancel(libkbfs.CtxWithRandomIDReplayable(
+		req.Context(), ctxEventStreamIDKey, ctxEventStreamOpID, es.log))
+	es.log.CDebugf(ctx, "Event stream for %v (prefix=%q, history=%t)",
+		tlfParams, prefix, history)
+	defer es.log.CDebugf(ctx, "Event stream done")
+
+	subs := make([]*eventStreamSub, 0, len(tlfParams))
+	var wg sync.WaitGroup
+	defer func() {
+		// Unblock the forwarders, then close the watchers so that
+		// the forwarders finish draining them.
+		cancel()
+		for _, sub := range subs {
+			err := sub.watcher.Close()
+			if err != nil {
+				es.log.CDebugf(ctx, "Couldn't close watcher for %s: %+v",
+					sub.tlfPath, err)
+			}
+		}
+		wg.Wait()
+	}()
+	for _, tlfParam := range tlfParams {
+		sub, err := es.subscribe(ctx, tlfParam)
+		if err != nil {
+			es.log.CDebugf(ctx, "Couldn't watch %s: %+v", tlfParam, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		subs = append(subs, sub)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	esw := eventStreamWriter{w, flusher}
+
+	// Start forwarding live events before replaying history, so
+	// nothing is lost in between.  Each forwarder drains its watcher
+	// until the watcher is closed.
+	events := make(chan StreamEvent)
+	for _, sub := range subs {
+		wg.Add(1)
+		go func(sub *eventStreamSub) {
+			defer wg.Done()
+			for we := range sub.watcher.Events() {
+				e := streamEventFromWatch(sub.tlfPath, we)
+				if !e.matches(prefix) {
+					continue
+				}
+				select {
+				case events <- e:
+				case <-ctx.Done():
+				}
+			}
+		}(sub)
+	}
+
+	if history {
+		for _, sub := range subs {
+			hEvents, err := sub.history(ctx)
+			if err != nil {
+				es.log.CDebugf(ctx, "Couldn't get history for %s: %+v",
+					sub.tlfPath, err)
+				continue
+			}
+			for _, e := range hEvents {
+				if !e.matches(prefix) {
+					continue
+				}
+				if err := esw.send(e); err != nil {
+					return
+				}
+			}
+		}
+	}
+
+	ticker := time.NewTicker(eventStreamKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case e := <-events:
+			if err := esw.send(e); err != nil {
+				es.log.CDebugf(ctx, "Couldn't send event: %+v", err)
+				return
+			}
+		case <-ticker.C:
+			if err := esw.keepAlive(); err != nil {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// ServeEventStream starts serving an EventStream over HTTP on a Unix
+// socket at `socketPath`, which is replaced if it already exists and
+// is only accessible to the current user.  The returned function
+// stops the server and removes the socket.
+func ServeEventStream(config libkbfs.Config, socketPath string) (
+	shutdown func(), err error) {
+	// Bind the socket inside a private directory and only move it
+	// into place once its permissions are restricted, so that other
+	// users can never connect to it.
+	tempDir, err := ioutil.TempDir(
+		filepath.Dir(socketPath), ".kbfs_event_stream")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = ioutil.RemoveAll(tempDir)
+		}
+	}()
+	tempPath := filepath.Join(tempDir, "sock")
+	listener, err := net.Listen("unix", tempPath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			listener.Close()
+		}
+	}()
+	// The socket is removed by `shutdown`, from its final path.
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	err = os.Chmod(tempPath, 0600)
+	if err != nil {
+		return nil, err
+	}
+	err = ioutil.Rename(tempPath, socketPath)
+	if err != nil {
+		return nil, err
+	}
+	err = ioutil.Remove(tempDir)
+	if err != nil {
+		return nil, err
+	}
+
+	es := NewEventStream(config)
+	server := &http.Server{Handler: es}
+	go func() {
+		err := server.Serve(listener)
+		es.log.Debug("Event stream server ended with %+v", err)
+	}()
+	return func() {
+		err := server.Close()
+		if err != nil {
+			es.log.Debug("Couldn't close event stream server: %+v", err)
+		}
+		err = ioutil.Remove(socketPath)
+		if err != nil && !ioutil.IsNotExist(err) {
+			es.log.Debug("Couldn't remove event stream socket: %+v", err)
+		}
+	}, nil
+}
@@ -7,12 +7,13 @@ package libfs
 import (
 	"bytes"
 	"io"
+	"path"
 	"sync"
 	"sync/atomic"
 
 	"github.com/keybase/client/go/protocol/keybase1"
-	"github.com/keybase/kbfs/kbfsmd"
 	"github.com/keybase/kbfs/libkbfs"
+	"github.com/keybase/kbfs/tlf"
 	"github.com/pkg/errors"
 	billy "gopkg.in/src-d/go-billy.v4"
 )
@@ -30,8 +31,13 @@ type File struct {
 
 	lockedLock sync.Mutex
 	locked     bool
+	lockOwner  uint64
 }
 
+// lastFileLockOwner is used to give each locking File its own owner
+// ID in the lock manager.
+var lastFileLockOwner uint64
+
 var _ billy.File = (*File)(nil)
 
 // Name implements the billy.File interface for File.
@@ -95,7 +101,15 @@ func (f *File) ReadAt(p []byte, off int64) (n int, err error) {
 	return int(readBytes), nil
 }
 
-// Seek implements the billy.File interface for File.
+// The whence values for Seek that look for the next data or hole in
+// the file, like SEEK_DATA and SEEK_HOLE on Linux.
+const (
+	SeekData = 3
+	SeekHole = 4
+)
+
+// Seek implements the billy.File interface for File.  Besides the
+// io.Seek* whence values, it supports SeekData and SeekHole.
 func (f *File) Seek(offset int64, whence int) (n int64, err error) {
 	newOffset := offset
 	switch whence {
@@ -109,6 +123,16 @@ func (f *File) Seek(offset int64, whence int) (n int64, err error) {
 			return 0, err
 		}
 		newOffset = int64(ei.Size) + offset
+	case SeekData, SeekHole:
+		if offset < 0 {
+			return 0, errors.Errorf("Cannot seek to offset %d", offset)
+		}
+		off, err := f.fs.config.KBFSOps().SeekDataOrHole(
+			f.fs.ctx, f.node, uint64(offset), whence == SeekHole)
+		if err != nil {
+			return 0, err
+		}
+		newOffset = int64(off)
 	}
 	if newOffset < 0 {
 		return 0, errors.Errorf("Cannot seek to offset %d", newOffset)
@@ -128,6 +152,17 @@ func (f *File) Close() error {
 	return nil
 }
 
+// FileLockID returns the lock ID used by default for a File at `p`,
+// relative to the root of a TLF of type `t`, so that other ways of
+// locking the same file exclude it.
+func FileLockID(t tlf.Type, p string) keybase1.LockID {
+	return keybase1.LockIDFromBytes(
+		bytes.Join([][]byte{
+			[]byte(path.Join("/keybase", t.String())),
+			[]byte(p),
+		}, []byte{'/'}))
+}
+
 func (f *File) getLockID() keybase1.LockID {
 	// If we ever change this lock ID format, we must first come up with a
 	// transition plan and then upgrade all clients before transitioning.
@@ -152,31 +187,20 @@ func (f *File) Lock() (err error) {
 	if f.locked {
 		return nil
 	}
-	defer func() {
-		if err == nil {
-			f.locked = true
-		}
-	}()
-
-	// First, sync all and ask journal to flush all existing writes.
-	err = f.fs.SyncAll()
-	if err != nil {
-		return err
+	if f.lockOwner == 0 {
+		f.lockOwner = atomic.AddUint64(&lastFileLockOwner, 1)
 	}
-	jServer, err := libkbfs.GetJournalServer(f.fs.config)
+
+	// The lock manager flushes all existing writes, and then syncs up
+	// with the server while holding the lock.
+	err = f.fs.config.LockManager().Lock(f.fs.ctx,
+		f.fs.root.GetFolderBranch(), f.getLockID(), f.lockOwner,
+		f.fs.priority)
 	if err != nil {
 		return err
 	}
-	if err = jServer.FinishSingleOp(f.fs.ctx,
-		f.fs.root.GetFolderBranch().Tlf, nil, f.fs.priority); err != nil {
-		return err
-	}
-
-	// Now, sync up with the server, while making sure a lock is held by us. If
-	// lock taking fails, RPC layer retries automatically.
-	lockID := f.getLockID()
-	return f.fs.config.KBFSOps().SyncFromServer(f.fs.ctx,
-		f.fs.root.GetFolderBranch(), &lockID)
+	f.locked = true
+	return nil
 }
 
 // Unlock implements the billy.File interface for File.
@@ -196,62 +220,12 @@ func (f *File) Unlock() (err error) {
 	})
 	defer close(done)
 
-	defer func() {
-		if err == nil {
-			f.locked = false
-		}
-	}()
-
-	err = f.fs.SyncAll()
-	if err != nil {
-		return err
-	}
-	jServer, err := libkbfs.GetJournalServer(f.fs.config)
-	if err != nil {
-		return err
-	}
-	jStatus, _ := jServer.JournalStatus(f.fs.root.GetFolderBranch().Tlf)
-	if jStatus.RevisionStart == kbfsmd.RevisionUninitialized {
-		// Journal MDs are all flushed and we haven't made any more writes.
-		// Calling FinishSingleOp won't make it to the server, so we make a
-		// naked request to server just to release the lock.
-		return f.fs.config.MDServer().ReleaseLock(f.fs.ctx,
-			f.fs.root.GetFolderBranch().Tlf, f.getLockID())
-	}
-
-	if f.fs.config.Mode().Type() == libkbfs.InitSingleOp {
-		err = jServer.FinishSingleOp(f.fs.ctx,
-			f.fs.root.GetFolderBranch().Tlf, &keybase1.LockContext{
-				RequireLockID:       f.getLockID(),
-				ReleaseAfterSuccess: true,
-			}, f.fs.priority)
-		if err != nil {
-			return err
-		}
-	} else {
-		err = jServer.WaitForCompleteFlush(
-			f.fs.ctx, f.fs.root.GetFolderBranch().Tlf)
-		if err != nil {
-			return err
-		}
-
-		f.fs.log.CDebugf(f.fs.ctx, "Releasing the lock")
-
-		// Need to explicitly release the lock from the server. If
-		// single-op mode isn't enabled, then the journal will be
-		// flushing on its own without waiting for the call to
-		// `FinishSingleOp`. That means the journal can already be
-		// completely flushed by the time `FinishSingleOp` is called,
-		// and it will be a no-op. It won't have made any call to the
-		// server to release the lock, so we have to do it explicitly
-		// here.
-		err = f.fs.config.MDServer().ReleaseLock(
-			f.fs.ctx, f.fs.root.GetFolderBranch().Tlf, f.getLockID())
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+	// The lock is given up locally even if unlocking fails, so that
+	// other owners on this device aren't stuck behind it.
+	f.locked = false
+	return f.fs.config.LockManager().Unlock(f.fs.ctx,
+		f.fs.root.GetFolderBranch(), f.getLockID(), f.lockOwner,
+		f.fs.priority)
 }
 
 // Truncate implements the billy.File interface for File.
@@ -259,6 +233,20 @@ func (f *File) Truncate(size int64) error {
 	return f.fs.config.KBFSOps().Truncate(f.fs.ctx, f.node, uint64(size))
 }
 
+// PunchHole deallocates `length` bytes of the file starting at
+// `off`, without changing the file's size, like
+// fallocate(FALLOC_FL_PUNCH_HOLE|FALLOC_FL_KEEP_SIZE).
+func (f *File) PunchHole(off, length int64) error {
+	if f.readOnly {
+		return errors.New("Trying to punch a hole in a read-only file")
+	}
+	if off < 0 || length <= 0 {
+		return errors.Errorf("Invalid hole range: off=%d len=%d", off, length)
+	}
+	return f.fs.config.KBFSOps().PunchHole(
+		f.fs.ctx, f.node, uint64(off), uint64(length))
+}
+
 // GetNode returns the libkbfs.Node associated with this file.
 func (f *File) GetNode() libkbfs.Node {
 	return f.node
@@ -0,0 +1,373 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libfs
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/keybase/client/go/logger"
+	"github.com/keybase/client/go/protocol/keybase1"
+	"github.com/keybase/kbfs/kbfsmd"
+	"github.com/keybase/kbfs/libkbfs"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+	"golang.org/x/sync/errgroup"
+)
+
+// maxFileRevisions is the number of file versions, including the
+// current one, returned by GetFileRevisions.
+const maxFileRevisions = 5
+
+// FileRevisionGetter returns the FileInfo of a single file as of the
+// given TLF revision, or of the current version of the file if `rev`
+// is `kbfsmd.RevisionUninitialized`.
+type FileRevisionGetter func(
+	ctx context.Context, rev kbfsmd.Revision) (os.FileInfo, error)
+
+// FileRevision is one version of a file, along with the TLF revision
+// at which that version was written.
+type FileRevision struct {
+	Revision kbfsmd.Revision
+	FileInfo os.FileInfo
+}
+
+// NewFileRevisionGetter returns a FileRevisionGetter for the file at
+// `filePath`, relative to the root of the TLF `h`.
+func NewFileRevisionGetter(
+	config libkbfs.Config, h *libkbfs.TlfHandle,
+	filePath string) FileRevisionGetter {
+	return func(ctx context.Context, rev kbfsmd.Revision) (
+		os.FileInfo, error) {
+		branch := libkbfs.MasterBranch
+		if rev != kbfsmd.RevisionUninitialized {
+			branch = libkbfs.MakeRevBranchName(rev)
+		}
+		fs, err := NewFS(
+			ctx, config, h, branch, "", "", keybase1.MDPriorityNormal)
+		if err != nil {
+			return nil, err
+		}
+		// Use Lstat so we don't follow symlinks.
+		return fs.Lstat(filePath)
+	}
+}
+
+func prevRevisionsFromFileInfo(fi os.FileInfo) (
+	libkbfs.PrevRevisions, error) {
+	fipr, ok := fi.Sys().(PrevRevisionsGetter)
+	if !ok {
+		return nil, errors.New("Cannot get revisions for non-KBFS path")
+	}
+	return fipr.PrevRevisions(), nil
+}
+
+// GetFileRevisions returns up to five versions of a file, using
+// `getFileInfo` to stat the file as of different TLF revisions.  The
+// first element is always the current version of the file, followed
+// by older versions, newest first.  Versions that have been
+// garbage-collected are omitted.  For `RevisionSpanType_DEFAULT`,
+// the older versions come straight from the file's list of previous
+// revisions; for `RevisionSpanType_LAST_FIVE`, they are the last
+// five consecutive versions of the file.  If `progress` is non-nil,
+// it is called with the number of versions that have been processed
+// since the last call, out of a total of five.
+func GetFileRevisions(
+	ctx context.Context, log logger.Logger, getFileInfo FileRevisionGetter,
+	spanType keybase1.RevisionSpanType, progress func(numDone int64)) (
+	revs []FileRevision, err error) {
+	if progress == nil {
+		progress = func(int64) {}
+	}
+
+	fi, err := getFileInfo(ctx, kbfsmd.RevisionUninitialized)
+	if err != nil {
+		return nil, err
+	}
+	prs, err := prevRevisionsFromFileInfo(fi)
+	if err != nil {
+		return nil, err
+	}
+	if len(prs) == 0 {
+		return nil, errors.New("No previous revisions")
+	}
+
+	currRev := FileRevision{Revision: prs[0].Revision, FileInfo: fi}
+	log.CDebugf(ctx, "Found current revision: %d", prs[0].Revision)
+	progress(1)
+
+	var revsToStat []kbfsmd.Revision
+
+	// The next four depend on the span type.
+	switch spanType {
+	case keybase1.RevisionSpanType_DEFAULT:
+		// Use `prs` for the rest of the revisions.
+		for i := 1; i < len(prs); i++ {
+			revsToStat = append(revsToStat, prs[i].Revision)
+		}
+	case keybase1.RevisionSpanType_LAST_FIVE:
+		expectedCount := uint8(2)
+		nextSlot := 1
+		lastRevision := prs[0].Revision
+
+		// Step back through the previous revisions.  If the next one
+		// in the list happens to be the next in line (because the
+		// count is one more than the current count), use it.
+		// Otherwise, we have to fetch the stats from the MD revision
+		// before the last one we processed, and use the
+		// PreviousRevisions list from that version of the file.
+		for len(revsToStat) < maxFileRevisions-1 && nextSlot < len(prs) {
+			var rev kbfsmd.Revision
+			if prs[nextSlot].Count == expectedCount {
+				rev = prs[nextSlot].Revision
+			} else if lastRevision > kbfsmd.RevisionInitial {
+				log.CDebugf(ctx, "Inspecting revision %d to find previous",
+					lastRevision-1)
+				prevFI, err := getFileInfo(ctx, lastRevision-1)
+				if _, isGC := errors.Cause(err).(libkbfs.RevGarbageCollectedError); isGC {
+					log.CDebugf(ctx, "Hit a GC'd revision: %d",
+						lastRevision-1)
+					break
+				} else if err != nil {
+					return nil, err
+				}
+				prevPRs, err := prevRevisionsFromFileInfo(prevFI)
+				if err != nil {
+					return nil, err
+				}
+				if len(prevPRs) == 0 {
+					// This should never happen, because there is some
+					// next slot in the `prs` list, but it doesn't
+					// match the expected count, which means there
+					// must be _some_ revision in between the last
+					// revision and the one in the next slot, that we
+					// should uncover by looking up `lastRevision-1`.
+					return nil, errors.Errorf(
+						"Revision %s unexpectedly lists no previous revisions",
+						lastRevision-1)
+				}
+				rev = prevPRs[0].Revision
+				prs = prevPRs
+				nextSlot = 0      // will be incremented below
+				expectedCount = 1 // will be incremented below
+			} else {
+				break
+			}
+
+			revsToStat = append(revsToStat, rev)
+			lastRevision = rev
+			nextSlot++
+			expectedCount++
+		}
+	default:
+		return nil, errors.Errorf("Unknown span type: %s", spanType)
+	}
+
+	if len(revsToStat) < maxFileRevisions-1 {
+		// See if the final revision has a predecessor that's
+		// still live, to fill out the list of 5.  An older
+		// revision could have slid off the previous revisions
+		// list because that revision was garbage-collected, but
+		// that doesn't guarantee that the older revision of the
+		// file was garabge-collected too (since it was created,
+		// not deleted, as of that garbage-collected revision).
+		revsToStat = append(revsToStat, prs[len(prs)-1].Revision-1)
+	}
+
+	// Now that we have all the revisions we need, stat them.
+	revs = make([]FileRevision, len(revsToStat)+1)
+	revs[0] = currRev
+
+	if len(revs) < maxFileRevisions {
+		// Discount the revisions that don't exist from the progress.
+		progress(int64(maxFileRevisions - len(revs)))
+	}
+
+	// Fetch all the past revisions in parallel.  Use `ctx` rather
+	// than a group context, since the returned FileInfos may lazily
+	// look up more data using the context they were fetched with.
+	var eg errgroup.Group
+	doStat := func(slot int) error {
+		rev := revsToStat[slot]
+		fi, err := getFileInfo(ctx, rev)
+		if _, isGC := errors.Cause(err).(libkbfs.RevGarbageCollectedError); isGC {
+			log.CDebugf(ctx, "Hit a GC'd revision: %d", rev)
+			return nil
+		} else if os.IsNotExist(errors.Cause(err)) {
+			log.CDebugf(ctx, "Ran out of revisions as of %d", rev)
+			return nil
+		} else if err != nil {
+			return err
+		}
+		revs[slot+1] = FileRevision{Revision: rev, FileInfo: fi}
+		progress(1)
+		return nil
+	}
+	for i := range revsToStat {
+		i := i
+		eg.Go(func() error { return doStat(i) })
+	}
+	err = eg.Wait()
+	if err != nil {
+		return nil, err
+	}
+
+	// Remove any GC'd revisions.
+	for i, r := range revs {
+		if r.Revision == kbfsmd.RevisionUninitialized {
+			revs = revs[:i]
+			break
+		}
+	}
+
+	return revs, nil
+}
+
+// FileRevisionName returns the name under which the version of the
+// file `name` as of TLF revision `rev` can be looked up directly in
+// the file's parent directory.
+func FileRevisionName(name string, rev kbfsmd.Revision) string {
+	return fmt.Sprintf("%s%s%d", name, FileRevisionSeparator, rev)
+}
+
+// ParseFileRevisionName splits a name produced by FileRevisionName
+// back into the file name and the revision.  It returns false if
+// `name` doesn't have the right form.
+func ParseFileRevisionName(name string) (
+	fileName string, rev kbfsmd.Revision, ok bool) {
+	i := strings.LastIndex(name, FileRevisionSeparator)
+	if i <= 0 {
+		return "", kbfsmd.RevisionUninitialized, false
+	}
+	r, err := strconv.ParseInt(name[i+len(FileRevisionSeparator):], 10, 64)
+	if err != nil || kbfsmd.Revision(r) < kbfsmd.RevisionInitial {
+		return "", kbfsmd.RevisionUninitialized, false
+	}
+	return name[:i], kbfsmd.Revision(r), true
+}
+
+// pathInTlf returns the path of the entry `name` in `dir`, relative
+// to the root of the TLF.
+func pathInTlf(
+	ctx context.Context, config libkbfs.Config, dir libkbfs.Node,
+	name string) (string, error) {
+	nmd, err := config.KBFSOps().GetNodeMetadata(ctx, dir)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(nmd.PathFromRoot, name), nil
+}
+
+// FileRevisionPath resolves `name`, of the form produced by
+// FileRevisionName, within `dir`.  It returns the TLF revision and
+// the path of the named file relative to the root of the TLF, or
+// false if `name` isn't of that form, if the file doesn't currently
+// exist in `dir`, or if the revision is newer than the current head
+// or has already been garbage-collected.
+func FileRevisionPath(
+	ctx context.Context, config libkbfs.Config, dir libkbfs.Node,
+	name string) (rev kbfsmd.Revision, filePath string, ok bool, err error) {
+	fileName, rev, ok := ParseFileRevisionName(name)
+	if !ok {
+		return kbfsmd.RevisionUninitialized, "", false, nil
+	}
+	_, _, err = config.KBFSOps().Lookup(ctx, dir, fileName)
+	switch errors.Cause(err).(type) {
+	case nil:
+	case libkbfs.NoSuchNameError:
+		return kbfsmd.RevisionUninitialized, "", false, nil
+	default:
+		return kbfsmd.RevisionUninitialized, "", false, err
+	}
+	status, _, err := config.KBFSOps().FolderStatus(
+		ctx, dir.GetFolderBranch())
+	if err != nil {
+		return kbfsmd.RevisionUninitialized, "", false, err
+	}
+	if rev > status.Revision || rev <= status.LastGCRevision {
+		return kbfsmd.RevisionUninitialized, "", false, nil
+	}
+	filePath, err = pathInTlf(ctx, config, dir, fileName)
+	if err != nil {
+		return kbfsmd.RevisionUninitialized, "", false, err
+	}
+	return rev, filePath, true, nil
+}
+
+// FileRevisionLinkTarget returns the target, relative to `dir`, of a
+// symlink named `name` (of the form produced by FileRevisionName)
+// that points to the version of the file as of the given revision,
+// within the archived view of the TLF at that revision.  It returns
+// false whenever FileRevisionPath does.
+func FileRevisionLinkTarget(
+	ctx context.Context, config libkbfs.Config, dir libkbfs.Node,
+	name string) (target string, ok bool, err error) {
+	rev, filePath, ok, err := FileRevisionPath(ctx, config, dir, name)
+	if err != nil || !ok {
+		return "", false, err
+	}
+	return strings.Repeat("../", strings.Count(filePath, "/")) +
+		ArchivedRevDirPrefix + strconv.FormatInt(int64(rev), 10) + "/" +
+		filePath, true, nil
+}
+
+type fileRevisionJSON struct {
+	Name     string
+	Revision kbfsmd.Revision
+	Writer   string
+	Time     time.Time
+	Size     int64
+}
+
+// GetEncodedFileRevisions returns a JSON list of the recent versions
+// of the file `name` in `dir`, including the writer, modification
+// time and size of each version, and the name under which it can be
+// opened directly in `dir`.
+func GetEncodedFileRevisions(
+	ctx context.Context, config libkbfs.Config, dir libkbfs.Node,
+	name string) (data []byte, t time.Time, err error) {
+	h, err := config.KBFSOps().GetTLFHandle(ctx, dir)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	filePath, err := pathInTlf(ctx, config, dir, name)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	revs, err := GetFileRevisions(
+		ctx, config.MakeLogger(""),
+		NewFileRevisionGetter(config, h, filePath),
+		keybase1.RevisionSpanType_DEFAULT, nil)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	res := make([]fileRevisionJSON, 0, len(revs))
+	for _, r := range revs {
+		var writer string
+		if lwg, ok := r.FileInfo.Sys().(LastWriterGetter); ok {
+			lastWriter, err := lwg.LastWriter()
+			if err != nil {
+				return nil, time.Time{}, err
+			}
+			writer = lastWriter.Username
+		}
+		res = append(res, fileRevisionJSON{
+			Name:     FileRevisionName(name, r.Revision),
+			Revision: r.Revision,
+			Writer:   writer,
+			Time:     r.FileInfo.ModTime(),
+			Size:     r.FileInfo.Size(),
+		})
+	}
+	data, err = PrettyJSON(res)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return data, revs[0].FileInfo.ModTime(), nil
+}
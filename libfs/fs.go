@@ -19,6 +19,7 @@ import (
 
 	"github.com/keybase/client/go/logger"
 	"github.com/keybase/client/go/protocol/keybase1"
+	"github.com/keybase/kbfs/kbfsmd"
 	"github.com/keybase/kbfs/libkbfs"
 	"github.com/pkg/errors"
 	billy "gopkg.in/src-d/go-billy.v4"
@@ -571,29 +572,50 @@ func (fs *FS) TempFile(dir, prefix string) (billy.File, error) {
 		os.O_CREATE|os.O_EXCL, 0600)
 }
 
-func (fs *FS) readDir(n libkbfs.Node) (fis []os.FileInfo, err error) {
-	children, err := fs.config.KBFSOps().GetDirChildren(fs.ctx, n)
+// readDirPageSize is the number of children fetched at a time when
+// listing a directory.
+const readDirPageSize = 1000
+
+func (fs *FS) readDirPaged(n libkbfs.Node, after string, maxEntries int) (
+	fis []os.FileInfo, err error) {
+	children, err := fs.config.KBFSOps().GetDirChildrenPaged(
+		fs.ctx, n, after, maxEntries)
 	if err != nil {
 		return nil, err
 	}
 
 	fis = make([]os.FileInfo, 0, len(children))
-	for name, ei := range children {
-		child, _, err := fs.config.KBFSOps().Lookup(fs.ctx, n, name)
+	for _, c := range children {
+		child, _, err := fs.config.KBFSOps().Lookup(fs.ctx, n, c.Name)
 		if err != nil {
 			return nil, err
 		}
 
 		fis = append(fis, &FileInfo{
 			fs:   fs,
-			ei:   ei,
+			ei:   c.EntryInfo,
 			node: child,
-			name: name,
+			name: c.Name,
 		})
 	}
 	return fis, nil
 }
 
+func (fs *FS) readDir(n libkbfs.Node) (fis []os.FileInfo, err error) {
+	after := ""
+	for {
+		page, err := fs.readDirPaged(n, after, readDirPageSize)
+		if err != nil {
+			return nil, err
+		}
+		fis = append(fis, page...)
+		if len(page) < readDirPageSize {
+			return fis, nil
+		}
+		after = page[len(page)-1].Name()
+	}
+}
+
 // ReadDir implements the billy.Filesystem interface for FS.
 func (fs *FS) ReadDir(p string) (fis []os.FileInfo, err error) {
 	fs.log.CDebugf(fs.ctx, "ReadDir %s", p)
@@ -609,6 +631,28 @@ func (fs *FS) ReadDir(p string) (fis []os.FileInfo, err error) {
 	return fs.readDir(n)
 }
 
+// ReadDirPaged returns up to `maxEntries` entries of the directory at
+// `p`, sorted by name, starting after the entry named `after`.  Pass
+// "" to start at the beginning of the directory, and the name of the
+// last entry returned to fetch the next page.  A page with fewer
+// than `maxEntries` entries is the last one; if `maxEntries` is not
+// positive, all remaining entries are returned.
+func (fs *FS) ReadDirPaged(p string, after string, maxEntries int) (
+	fis []os.FileInfo, err error) {
+	fs.log.CDebugf(fs.ctx, "ReadDirPaged %s after=%q max=%d",
+		p, after, maxEntries)
+	defer func() {
+		fs.deferLog.CDebugf(fs.ctx, "ReadDirPaged done: %+v", err)
+		err = translateErr(err)
+	}()
+
+	n, _, err := fs.lookupOrCreateEntry(p, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	return fs.readDirPaged(n, after, maxEntries)
+}
+
 // MkdirAll implements the billy.Filesystem interface for FS.
 func (fs *FS) MkdirAll(filename string, perm os.FileMode) (err error) {
 	fs.log.CDebugf(fs.ctx, "MkdirAll %s", filename)
@@ -753,6 +797,24 @@ func (fs *FS) Chtimes(name string, atime time.Time, mtime time.Time) (
 	return fs.config.KBFSOps().SetMtime(fs.ctx, n, &mtime)
 }
 
+// RestoreFromRevision restores the file or directory at `name` as it
+// was at revision `rev` of the TLF, in a single MD update.
+func (fs *FS) RestoreFromRevision(name string, rev kbfsmd.Revision) (
+	err error) {
+	fs.log.CDebugf(fs.ctx, "RestoreFromRevision %s rev=%d", name, rev)
+	defer func() {
+		fs.deferLog.CDebugf(fs.ctx, "RestoreFromRevision done: %+v", err)
+		err = translateErr(err)
+	}()
+
+	n, _, err := fs.lookupOrCreateEntry(name, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+
+	return fs.config.KBFSOps().RestoreFromRevision(fs.ctx, n, rev)
+}
+
 // ChrootAsLibFS returns a *FS whose root is p.
 func (fs *FS) ChrootAsLibFS(p string) (newFS *FS, err error) {
 	fs.log.CDebugf(fs.ctx, "Chroot %s", p)
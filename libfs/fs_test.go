@@ -5,10 +5,17 @@
 package libfs
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"path"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -17,6 +24,7 @@ import (
 	"github.com/keybase/kbfs/kbfsmd"
 	"github.com/keybase/kbfs/libkbfs"
 	"github.com/keybase/kbfs/tlf"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	billy "gopkg.in/src-d/go-billy.v4"
@@ -192,6 +200,47 @@ func TestAppendFile(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestSparseFile(t *testing.T) {
+	ctx, _, fs := makeFS(t, "")
+	defer libkbfs.CheckConfigAndShutdown(ctx, t, fs.config)
+
+	f, err := fs.Create("foo")
+	require.NoError(t, err)
+	defer f.Close()
+	data := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	_, err = f.Write(data)
+	require.NoError(t, err)
+
+	// Extending the file by more than a block leaves a hole.
+	const size = 1024 * 1024
+	err = f.Truncate(size)
+	require.NoError(t, err)
+
+	off, err := f.Seek(0, SeekData)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), off)
+	off, err = f.Seek(0, SeekHole)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), off)
+	_, err = f.Seek(int64(len(data)), SeekData)
+	require.IsType(t, libkbfs.NoDataAfterOffsetError{}, errors.Cause(err))
+
+	kbfsFile := f.(*File)
+	err = kbfsFile.PunchHole(2, 3)
+	require.NoError(t, err)
+	gotData := make([]byte, len(data))
+	_, err = f.ReadAt(gotData, 0)
+	require.NoError(t, err)
+	require.Equal(t, []byte{1, 2, 0, 0, 0, 6, 7, 8, 9, 10}, gotData)
+
+	fi, err := fs.Stat("foo")
+	require.NoError(t, err)
+	require.Equal(t, int64(size), fi.Size())
+
+	err = fs.SyncAll()
+	require.NoError(t, err)
+}
+
 func TestRecreateAndExcl(t *testing.T) {
 	ctx, h, fs := makeFS(t, "")
 	defer libkbfs.CheckConfigAndShutdown(ctx, t, fs.config)
@@ -398,6 +447,42 @@ func TestReadDir(t *testing.T) {
 	require.Len(t, expectedNames, 0)
 }
 
+func TestReadDirPaged(t *testing.T) {
+	ctx, h, fs := makeFS(t, "")
+	defer libkbfs.CheckConfigAndShutdown(ctx, t, fs.config)
+
+	rootNode, _, err := fs.config.KBFSOps().GetRootNode(
+		ctx, h, libkbfs.MasterBranch)
+	require.NoError(t, err)
+	aNode, _, err := fs.config.KBFSOps().CreateDir(ctx, rootNode, "a")
+	require.NoError(t, err)
+	for _, name := range []string{"e", "b", "d", "a", "c"} {
+		testCreateFile(t, ctx, fs, "a/"+name, aNode)
+	}
+
+	names := func(fis []os.FileInfo) (names []string) {
+		for _, fi := range fis {
+			names = append(names, fi.Name())
+		}
+		return names
+	}
+
+	fis, err := fs.ReadDirPaged("a", "", 2)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, names(fis))
+	fis, err = fs.ReadDirPaged("a", "b", 2)
+	require.NoError(t, err)
+	require.Equal(t, []string{"c", "d"}, names(fis))
+	fis, err = fs.ReadDirPaged("a", "d", 2)
+	require.NoError(t, err)
+	require.Equal(t, []string{"e"}, names(fis))
+
+	// A full listing is sorted too.
+	fis, err = fs.ReadDir("a")
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b", "c", "d", "e"}, names(fis))
+}
+
 func TestMkdirAll(t *testing.T) {
 	ctx, _, fs := makeFS(t, "")
 	defer libkbfs.CheckConfigAndShutdown(ctx, t, fs.config)
@@ -654,6 +739,43 @@ func TestFileLocking(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestFileLockingExcludesOtherFiles(t *testing.T) {
+	_, _, fs, shutdown := makeFSWithJournal(t, "")
+	defer shutdown()
+
+	f1, err := fs.Create("a")
+	require.NoError(t, err)
+	f2, err := fs.Open("a")
+	require.NoError(t, err)
+	require.Equal(t, FileLockID(tlf.Private, "a"), f1.(*File).getLockID())
+
+	err = f1.Lock()
+	require.NoError(t, err)
+
+	// The second file can't take the lock until the first one
+	// unlocks it.
+	locked := make(chan error, 1)
+	go func() {
+		locked <- f2.Lock()
+	}()
+	select {
+	case err := <-locked:
+		t.Fatalf("Second lock succeeded while the first was held: %+v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	err = f1.Unlock()
+	require.NoError(t, err)
+	select {
+	case err := <-locked:
+		require.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("Timed out waiting for the second lock")
+	}
+	err = f2.Close()
+	require.NoError(t, err)
+}
+
 func TestFileLockingExpiration(t *testing.T) {
 	_, _, fs, shutdown := makeFSWithJournal(t, "")
 	defer shutdown()
@@ -701,3 +823,296 @@ func TestArchivedByRevision(t *testing.T) {
 	require.NoError(t, err)
 	require.Len(t, fis, 0)
 }
+
+func TestFileRevisions(t *testing.T) {
+	ctx, h, fs := makeFS(t, "")
+	defer libkbfs.CheckConfigAndShutdown(ctx, t, fs.config)
+
+	err := fs.MkdirAll("a", 0755)
+	require.NoError(t, err)
+	writeFile := func(data string) {
+		f, err := fs.OpenFile("a/b", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+		require.NoError(t, err)
+		_, err = f.Write([]byte(data))
+		require.NoError(t, err)
+		err = f.Close()
+		require.NoError(t, err)
+		err = fs.SyncAll()
+		require.NoError(t, err)
+	}
+	writeFile("1")
+	writeFile("22")
+	writeFile("333")
+
+	rootNode, _, err := fs.config.KBFSOps().GetRootNode(
+		ctx, h, libkbfs.MasterBranch)
+	require.NoError(t, err)
+	dirNode, _, err := fs.config.KBFSOps().Lookup(ctx, rootNode, "a")
+	require.NoError(t, err)
+
+	data, _, err := GetEncodedFileRevisions(ctx, fs.config, dirNode, "b")
+	require.NoError(t, err)
+	var revs []fileRevisionJSON
+	err = json.Unmarshal(data, &revs)
+	require.NoError(t, err)
+	require.Len(t, revs, 3)
+	for i, r := range revs {
+		require.Equal(t, int64(3-i), r.Size)
+		require.Equal(t, "user1", r.Writer)
+		require.Equal(t, FileRevisionName("b", r.Revision), r.Name)
+	}
+
+	t.Log("Older versions are reachable through the archived TLF")
+	target, ok, err := FileRevisionLinkTarget(
+		ctx, fs.config, dirNode, revs[2].Name)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, fmt.Sprintf("../%s%d/a/b",
+		ArchivedRevDirPrefix, revs[2].Revision), target)
+	fsArchived, err := NewFS(
+		ctx, fs.config, h, libkbfs.MakeRevBranchName(revs[2].Revision), "",
+		"", keybase1.MDPriorityNormal)
+	require.NoError(t, err)
+	fi, err := fsArchived.Stat("a/b")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), fi.Size())
+
+	_, ok, err = FileRevisionLinkTarget(ctx, fs.config, dirNode, "b@x")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	t.Log("Names of missing files and invalid revisions don't resolve")
+	_, ok, err = FileRevisionLinkTarget(ctx, fs.config, dirNode,
+		FileRevisionName("c", revs[2].Revision))
+	require.NoError(t, err)
+	require.False(t, ok)
+	_, ok, err = FileRevisionLinkTarget(ctx, fs.config, dirNode,
+		FileRevisionName("b", revs[0].Revision+100))
+	require.NoError(t, err)
+	require.False(t, ok)
+	_, _, ok = ParseFileRevisionName("@1")
+	require.False(t, ok)
+}
+
+func nextWatchEvent(t *testing.T, w *Watcher, op WatchOp) WatchEvent {
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case e := <-w.Events():
+			if e.Op == op {
+				return e
+			}
+			t.Logf("Skipping event %s", e)
+		case <-timeout:
+			t.Fatalf("Timed out waiting for a %s event", op)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	ctx, h, fs := makeFS(t, "")
+	defer libkbfs.CheckConfigAndShutdown(ctx, t, fs.config)
+
+	err := fs.MkdirAll("a/b", 0755)
+	require.NoError(t, err)
+
+	w, err := fs.Watch("a", true)
+	require.NoError(t, err)
+
+	t.Log("Create a file")
+	f, err := fs.Create("a/b/c")
+	require.NoError(t, err)
+	e := nextWatchEvent(t, w, WatchCreate)
+	require.Equal(t, "a/b/c", e.Path)
+	require.Equal(t, "user1", e.Writer.String())
+	require.Equal(t, kbfsmd.RevisionUninitialized, e.Revision)
+
+	t.Log("Write to it")
+	_, err = f.Write([]byte("hello"))
+	require.NoError(t, err)
+	e = nextWatchEvent(t, w, WatchWrite)
+	require.Equal(t, "a/b/c", e.Path)
+	require.Equal(t, kbfsmd.RevisionUninitialized, e.Revision)
+	err = f.Close()
+	require.NoError(t, err)
+	err = fs.SyncAll()
+	require.NoError(t, err)
+
+	t.Log("Write to it from another device")
+	config2 := libkbfs.ConfigAsUser(
+		fs.config.(*libkbfs.ConfigLocal), "user1")
+	defer libkbfs.CheckConfigAndShutdown(ctx, t, config2)
+	fs2, err := NewFS(
+		ctx, config2, h, libkbfs.MasterBranch, "", "",
+		keybase1.MDPriorityNormal)
+	require.NoError(t, err)
+	f2, err := fs2.OpenFile("a/b/c", os.O_WRONLY, 0600)
+	require.NoError(t, err)
+	_, err = f2.Write([]byte("world"))
+	require.NoError(t, err)
+	err = f2.Close()
+	require.NoError(t, err)
+	err = fs2.SyncAll()
+	require.NoError(t, err)
+	err = fs.config.KBFSOps().SyncFromServer(
+		ctx, fs.root.GetFolderBranch(), nil)
+	require.NoError(t, err)
+	e = nextWatchEvent(t, w, WatchWrite)
+	require.Equal(t, "a/b/c", e.Path)
+	require.Equal(t, "user1", e.Writer.String())
+	require.NotEqual(t, kbfsmd.RevisionUninitialized, e.Revision)
+
+	t.Log("Rename it")
+	err = fs.Rename("a/b/c", "a/d")
+	require.NoError(t, err)
+	e = nextWatchEvent(t, w, WatchRename)
+	require.Equal(t, "a/b/c", e.OldPath)
+	require.Equal(t, "a/d", e.Path)
+	require.Equal(t, kbfsmd.RevisionUninitialized, e.Revision)
+
+	t.Log("Remove it")
+	err = fs.Remove("a/d")
+	require.NoError(t, err)
+	e = nextWatchEvent(t, w, WatchRemove)
+	require.Equal(t, "a/d", e.Path)
+
+	err = w.Close()
+	require.NoError(t, err)
+	for range w.Events() {
+	}
+}
+
+func TestWatchNonRecursive(t *testing.T) {
+	ctx, _, fs := makeFS(t, "")
+	defer libkbfs.CheckConfigAndShutdown(ctx, t, fs.config)
+
+	err := fs.MkdirAll("a/b", 0755)
+	require.NoError(t, err)
+
+	w, err := fs.Watch("a", false)
+	require.NoError(t, err)
+	defer w.Close()
+
+	// Changes further down aren't reported, so the first creation
+	// seen is the one directly in the watched directory.
+	_, err = fs.Create("a/b/c")
+	require.NoError(t, err)
+	_, err = fs.Create("a/d")
+	require.NoError(t, err)
+	e := nextWatchEvent(t, w, WatchCreate)
+	require.Equal(t, "a/d", e.Path)
+}
+
+func nextStreamEvent(
+	t *testing.T, r *bufio.Reader, op WatchOp) StreamEvent {
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		var e StreamEvent
+		err = json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e)
+		require.NoError(t, err)
+		if e.Op == op.String() {
+			return e
+		}
+		t.Logf("Skipping event %+v", e)
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	ctx, _, fs := makeFS(t, "")
+	defer libkbfs.CheckConfigAndShutdown(ctx, t, fs.config)
+
+	tempdir, err := ioutil.TempDir(os.TempDir(), "event_stream")
+	require.NoError(t, err)
+	defer ioutil.RemoveAll(tempdir)
+	socketPath := filepath.Join(tempdir, "events.sock")
+	shutdown, err := ServeEventStream(fs.config, socketPath)
+	require.NoError(t, err)
+	defer shutdown()
+	fi, err := os.Stat(socketPath)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+	// The private directory used to create the socket is gone.
+	fis, err := ioutil.ReadDir(tempdir)
+	require.NoError(t, err)
+	require.Len(t, fis, 1)
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(
+				ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socketPath)
+			},
+		},
+	}
+
+	t.Log("A bad TLF is rejected")
+	resp, err := client.Get("http://kbfs/events?tlf=nope")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	err = fs.MkdirAll("a", 0755)
+	require.NoError(t, err)
+
+	reqCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequest(
+		"GET", "http://kbfs/events?tlf=/keybase/private/user1&prefix=a", nil)
+	require.NoError(t, err)
+	resp, err = client.Do(req.WithContext(reqCtx))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	r := bufio.NewReader(resp.Body)
+
+	t.Log("Changes outside the prefix are filtered out")
+	_, err = fs.Create("b")
+	require.NoError(t, err)
+	_, err = fs.Create("a/c")
+	require.NoError(t, err)
+	e := nextStreamEvent(t, r, WatchCreate)
+	require.Equal(t, StreamEvent{
+		Tlf:      "/keybase/private/user1",
+		Op:       "CREATE",
+		Path:     "a/c",
+		Writer:   "user1",
+		Revision: kbfsmd.RevisionUninitialized,
+	}, e)
+
+	t.Log("Renames out of the prefix are still reported")
+	err = fs.Rename("a/c", "d")
+	require.NoError(t, err)
+	e = nextStreamEvent(t, r, WatchRename)
+	require.Equal(t, "a/c", e.OldPath)
+	require.Equal(t, "d", e.Path)
+
+	t.Log("Synced edits are replayed as history")
+	f, err := fs.Create("a/h")
+	require.NoError(t, err)
+	_, err = f.Write([]byte("h"))
+	require.NoError(t, err)
+	err = f.Close()
+	require.NoError(t, err)
+	err = fs.SyncAll()
+	require.NoError(t, err)
+	req, err = http.NewRequest("GET",
+		"http://kbfs/events?tlf=/keybase/private/user1&prefix=a&history=1",
+		nil)
+	require.NoError(t, err)
+	hResp, err := client.Do(req.WithContext(reqCtx))
+	require.NoError(t, err)
+	defer hResp.Body.Close()
+	require.Equal(t, http.StatusOK, hResp.StatusCode)
+	e = nextStreamEvent(t, bufio.NewReader(hResp.Body), WatchWrite)
+	require.True(t, e.History)
+	require.Equal(t, "/keybase/private/user1", e.Tlf)
+	require.Equal(t, "a/h", e.Path)
+	require.Equal(t, "user1", e.Writer)
+	require.NotZero(t, e.ServerTime)
+}
@@ -24,3 +24,16 @@ func GetEncodedMetrics(config libkbfs.Config) func(context.Context) ([]byte, tim
 		return []byte("Metrics have been turned off.\n"), time.Time{}, nil
 	}
 }
+
+// GetEncodedPrometheusMetrics returns metrics encoded as bytes in the
+// Prometheus text format, for the Prometheus metrics file.
+func GetEncodedPrometheusMetrics(config libkbfs.Config) func(context.Context) ([]byte, time.Time, error) {
+	return func(context.Context) ([]byte, time.Time, error) {
+		if registry := config.MetricsRegistry(); registry != nil {
+			b := bytes.NewBuffer(nil)
+			metricsutil.WritePrometheusMetrics(registry, b)
+			return b.Bytes(), time.Time{}, nil
+		}
+		return []byte("# Metrics have been turned off.\n"), time.Time{}, nil
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/keybase/kbfs/libkbfs"
+	"golang.org/x/net/context"
+)
+
+// quotaReclamationPolicyJSON is the JSON form of a
+// libkbfs.QuotaReclamationTlfPolicy, with durations given as strings
+// like "72h".
+type quotaReclamationPolicyJSON struct {
+	MinUnrefAge string
+	MinHeadAge  string
+	Period      string
+}
+
+func parsePolicyDuration(s string) (*time.Duration, error) {
+	if s == "" {
+		return nil, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// SetQuotaReclamationPolicy sets this device's quota reclamation
+// policy for the given TLF from the JSON object in `data`.  Durations
+// are strings parsable by time.ParseDuration, and fields missing from
+// `data` fall back to the global defaults.
+func SetQuotaReclamationPolicy(
+	c libkbfs.Config, fb libkbfs.FolderBranch, data []byte) error {
+	if fb == (libkbfs.FolderBranch{}) {
+		panic("zero fb in SetQuotaReclamationPolicy")
+	}
+
+	var p quotaReclamationPolicyJSON
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&p)
+	if err != nil {
+		return err
+	}
+
+	var policy libkbfs.QuotaReclamationTlfPolicy
+	policy.MinUnrefAge, err = parsePolicyDuration(p.MinUnrefAge)
+	if err != nil {
+		return err
+	}
+	policy.MinHeadAge, err = parsePolicyDuration(p.MinHeadAge)
+	if err != nil {
+		return err
+	}
+	policy.Period, err = parsePolicyDuration(p.Period)
+	if err != nil {
+		return err
+	}
+	return c.SetQuotaReclamationTlfPolicy(fb.Tlf, policy)
+}
+
+// GetEncodedQuotaReclamationDryRun returns serialized JSON describing
+// what the next quota reclamation of the given TLF would delete.
+func GetEncodedQuotaReclamationDryRun(
+	ctx context.Context, config libkbfs.Config,
+	folderBranch libkbfs.FolderBranch) (
+	data []byte, t time.Time, err error) {
+	dryRun, err := config.KBFSOps().GetQuotaReclamationDryRun(
+		ctx, folderBranch)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	data, err = PrettyJSON(dryRun)
+	return data, time.Time{}, err
+}
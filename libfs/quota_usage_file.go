@@ -0,0 +1,34 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libfs
+
+import (
+	"time"
+
+	"github.com/keybase/kbfs/libkbfs"
+	"golang.org/x/net/context"
+)
+
+// QuotaUsageFileMaxDepth is how many levels of subdirectories are
+// listed in the quota usage file.
+const QuotaUsageFileMaxDepth = 2
+
+// GetEncodedQuotaUsage returns serialized JSON containing the quota
+// usage breakdown for the given directory.
+func GetEncodedQuotaUsage(
+	ctx context.Context, config libkbfs.Config, dir libkbfs.Node) (
+	data []byte, t time.Time, err error) {
+	breakdown, err := config.KBFSOps().GetQuotaUsageBreakdown(
+		ctx, dir, QuotaUsageFileMaxDepth)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	data, err = PrettyJSON(breakdown)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return data, time.Time{}, nil
+}
@@ -0,0 +1,36 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libfs
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/keybase/kbfs/kbfsmd"
+	"github.com/keybase/kbfs/libkbfs"
+	"golang.org/x/net/context"
+)
+
+// RestoreFromRevision restores the entry `name` in `dir` as it was at
+// the revision number written in `data`.  If `name` is empty, `dir`
+// itself is restored.
+func RestoreFromRevision(
+	ctx context.Context, config libkbfs.Config, dir libkbfs.Node,
+	name string, data []byte) error {
+	rev, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return err
+	}
+
+	node := dir
+	if name != "" {
+		node, _, err = config.KBFSOps().Lookup(ctx, dir, name)
+		if err != nil {
+			return err
+		}
+	}
+	return config.KBFSOps().RestoreFromRevision(
+		ctx, node, kbfsmd.Revision(rev))
+}
@@ -6,6 +6,7 @@ package libfs
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/keybase/kbfs/libkbfs"
 	"golang.org/x/net/context"
@@ -58,3 +59,31 @@ func (a SyncAction) Execute(
 	_, _, err = c.KBFSOps().GetRootNode(ctx, h, fb.Branch)
 	return err
 }
+
+// SetSyncPaths marks the paths listed in `data`, one per line, as the
+// only parts of the given TLF to sync for offline use.  Empty lines
+// are ignored, and a list without any paths disables syncing for the
+// TLF.
+func SetSyncPaths(
+	ctx context.Context, c libkbfs.Config, fb libkbfs.FolderBranch,
+	h *libkbfs.TlfHandle, data []byte) error {
+	if fb == (libkbfs.FolderBranch{}) {
+		panic("zero fb in SetSyncPaths")
+	}
+
+	var paths []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		paths = append(paths, line)
+	}
+	err := c.SetTlfSyncPaths(fb.Tlf, paths)
+	if err != nil {
+		return err
+	}
+	// Re-trigger prefetches.
+	_, _, err = c.KBFSOps().GetRootNode(ctx, h, fb.Branch)
+	return err
+}
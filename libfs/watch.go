@@ -0,0 +1,335 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libfs
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/keybase/client/go/libkb"
+	"github.com/keybase/kbfs/kbfsmd"
+	"github.com/keybase/kbfs/libkbfs"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// WatchOp is the kind of change reported by a Watcher.
+type WatchOp int
+
+const (
+	_ WatchOp = iota
+	// WatchCreate indicates that an entry was created.
+	WatchCreate
+	// WatchWrite indicates that a file's contents changed.
+	WatchWrite
+	// WatchRemove indicates that an entry was removed.
+	WatchRemove
+	// WatchRename indicates that an entry was moved to a new path.
+	WatchRename
+	// WatchChmod indicates that an entry's attributes changed.
+	WatchChmod
+)
+
+func (op WatchOp) String() string {
+	switch op {
+	case WatchCreate:
+		return "CREATE"
+	case WatchWrite:
+		return "WRITE"
+	case WatchRemove:
+		return "REMOVE"
+	case WatchRename:
+		return "RENAME"
+	case WatchChmod:
+		return "CHMOD"
+	default:
+		return fmt.Sprintf("WatchOp(%d)", int(op))
+	}
+}
+
+// WatchEvent describes a change to a path watched by a Watcher.
+type WatchEvent struct {
+	Op WatchOp
+	// Path is the changed path, relative to the root of the FS.  For
+	// renames, it is the new path.
+	Path string
+	// OldPath is the previous path of a renamed entry.
+	OldPath string
+	// Writer is the user who made the change.
+	Writer libkb.NormalizedUsername
+	// Revision is the merged TLF revision that includes the change,
+	// or kbfsmd.RevisionUninitialized for changes made on this
+	// device, which are reported before they reach the server.
+	Revision kbfsmd.Revision
+}
+
+func (e WatchEvent) String() string {
+	if e.Op == WatchRename {
+		return fmt.Sprintf("%s %s -> %s", e.Op, e.OldPath, e.Path)
+	}
+	return fmt.Sprintf("%s %s", e.Op, e.Path)
+}
+
+const watchEventsBufSize = 100
+
+// Watcher reports changes to a path within an FS, made either locally
+// or by other devices.  It classifies the change notifications made
+// by libkbfs by looking up the changed entries afterward, so an entry
+// that is created and then quickly removed may be reported as
+// removed twice.
+type Watcher struct {
+	fs        *FS
+	path      string
+	recursive bool
+
+	events        chan WatchEvent
+	notifications *FSNotifications
+	ctx           context.Context
+	cancel        context.CancelFunc
+	closing       chan struct{}
+	closeOnce     sync.Once
+}
+
+var _ libkbfs.Observer = (*Watcher)(nil)
+
+// Watch starts watching the entry at `p`, relative to the root of the
+// FS, along with its children if it's a directory.  If `recursive` is
+// true, everything under `p` is watched.  The caller must drain the
+// channel returned by `Events()`, and call `Close()` when done.
+func (fs *FS) Watch(p string, recursive bool) (w *Watcher, err error) {
+	fs.log.CDebugf(fs.ctx, "Watch %s (recursive=%t)", p, recursive)
+	defer func() {
+		fs.deferLog.CDebugf(fs.ctx, "Watch done: %+v", err)
+	}()
+
+	p = strings.Trim(path.Clean(p), "/")
+	if p == "." {
+		p = ""
+	}
+	if p != "" {
+		// Make sure the path exists.
+		_, err = fs.Lstat(p)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(fs.ctx)
+	w = &Watcher{
+		fs:            fs,
+		path:          p,
+		recursive:     recursive,
+		events:        make(chan WatchEvent, watchEventsBufSize),
+		notifications: NewFSNotifications(fs.log),
+		ctx:           ctx,
+		cancel:        cancel,
+		closing:       make(chan struct{}),
+	}
+	w.notifications.LaunchProcessor(ctx)
+	err = fs.config.Notifier().RegisterForChanges(
+		[]libkbfs.FolderBranch{fs.root.GetFolderBranch()}, w)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Events returns the channel on which changes are reported.  It is
+// closed after `Close()` is called.
+func (w *Watcher) Events() <-chan WatchEvent {
+	return w.events
+}
+
+// Close stops watching for changes.
+func (w *Watcher) Close() (err error) {
+	w.closeOnce.Do(func() {
+		err = w.fs.config.Notifier().UnregisterFromChanges(
+			[]libkbfs.FolderBranch{w.fs.root.GetFolderBranch()}, w)
+		close(w.closing)
+		// No more notifications can be queued now, so this runs
+		// after all the others.
+		w.notifications.QueueNotification(func() {
+			close(w.events)
+			w.cancel()
+		})
+	})
+	return err
+}
+
+func (w *Watcher) watches(p string) bool {
+	if p == w.path {
+		return true
+	}
+	parent := path.Dir(p)
+	if parent == "." {
+		parent = ""
+	}
+	if parent == w.path {
+		return true
+	}
+	if !w.recursive {
+		return false
+	}
+	return w.path == "" || strings.HasPrefix(p, w.path+"/")
+}
+
+func (w *Watcher) send(e WatchEvent) {
+	if !w.watches(e.Path) && (e.OldPath == "" || !w.watches(e.OldPath)) {
+		return
+	}
+	select {
+	case w.events <- e:
+	case <-w.closing:
+	}
+}
+
+// nodePath returns the path of `node` relative to the root of the
+// FS, or false if it is outside of the FS.
+func (w *Watcher) nodePath(node libkbfs.Node) (string, bool, error) {
+	md, err := w.fs.config.KBFSOps().GetNodeMetadata(w.ctx, node)
+	if err != nil {
+		return "", false, err
+	}
+	p := md.PathFromRoot
+	subdir := w.fs.subdir
+	switch {
+	case subdir == "":
+		return p, true, nil
+	case p == subdir:
+		return "", true, nil
+	case strings.HasPrefix(p, subdir+"/"):
+		return strings.TrimPrefix(p, subdir+"/"), true, nil
+	default:
+		return "", false, nil
+	}
+}
+
+func (w *Watcher) getWriter(ci libkbfs.ChangeInfo, ok bool) (
+	libkb.NormalizedUsername, error) {
+	if !ok {
+		session, err := w.fs.config.KBPKI().GetCurrentSession(w.ctx)
+		if err != nil {
+			return "", err
+		}
+		return session.Name, nil
+	}
+	return w.fs.config.KBPKI().GetNormalizedUsername(
+		w.ctx, ci.Writer.AsUserOrTeam())
+}
+
+func (w *Watcher) processBatch(changes []libkbfs.NodeChange,
+	ci libkbfs.ChangeInfo, haveCI bool) {
+	writer, err := w.getWriter(ci, haveCI)
+	if err != nil {
+		w.fs.log.CDebugf(w.ctx, "Couldn't get writer: %+v", err)
+	}
+	event := WatchEvent{
+		Writer:   writer,
+		Revision: kbfsmd.RevisionUninitialized,
+	}
+	if haveCI {
+		event.Revision = ci.Revision
+	}
+
+	var created, removed []string
+	for _, nc := range changes {
+		p, ok, err := w.nodePath(nc.Node)
+		if err != nil {
+			w.fs.log.CDebugf(w.ctx, "Couldn't get path for changed node %s: "+
+				"%+v", nc.Node.GetBasename(), err)
+			continue
+		} else if !ok {
+			continue
+		}
+
+		switch {
+		case len(nc.DirUpdated) > 0:
+			for _, name := range nc.DirUpdated {
+				_, _, err := w.fs.config.KBFSOps().Lookup(w.ctx, nc.Node, name)
+				switch errors.Cause(err).(type) {
+				case nil:
+					created = append(created, path.Join(p, name))
+				case libkbfs.NoSuchNameError:
+					removed = append(removed, path.Join(p, name))
+				default:
+					w.fs.log.CDebugf(w.ctx, "Couldn't look up changed "+
+						"entry %s: %+v", path.Join(p, name), err)
+				}
+			}
+		case len(nc.FileUpdated) > 0:
+			event.Op, event.Path = WatchWrite, p
+			w.send(event)
+		default:
+			event.Op, event.Path = WatchChmod, p
+			w.send(event)
+		}
+	}
+
+	// Each batch of changes comes from a single operation, so one
+	// entry appearing while another disappears is a rename.
+	if len(created) == 1 && len(removed) == 1 {
+		event.Op, event.Path, event.OldPath = WatchRename, created[0], removed[0]
+		w.send(event)
+		return
+	}
+	for _, p := range created {
+		event.Op, event.Path = WatchCreate, p
+		w.send(event)
+	}
+	for _, p := range removed {
+		event.Op, event.Path = WatchRemove, p
+		w.send(event)
+	}
+}
+
+func (w *Watcher) processLocalChange(node libkbfs.Node) {
+	p, ok, err := w.nodePath(node)
+	if err != nil {
+		w.fs.log.CDebugf(w.ctx, "Couldn't get path for changed node %s: "+
+			"%+v", node.GetBasename(), err)
+		return
+	} else if !ok {
+		return
+	}
+	writer, err := w.getWriter(libkbfs.ChangeInfo{}, false)
+	if err != nil {
+		w.fs.log.CDebugf(w.ctx, "Couldn't get writer: %+v", err)
+	}
+	w.send(WatchEvent{
+		Op:       WatchWrite,
+		Path:     p,
+		Writer:   writer,
+		Revision: kbfsmd.RevisionUninitialized,
+	})
+}
+
+// LocalChange implements the libkbfs.Observer interface for Watcher.
+func (w *Watcher) LocalChange(
+	_ context.Context, node libkbfs.Node, _ libkbfs.WriteRange) {
+	// Handle in the background because we shouldn't lock during the
+	// notification.
+	w.notifications.QueueNotification(func() { w.processLocalChange(node) })
+}
+
+// BatchChanges implements the libkbfs.Observer interface for Watcher.
+func (w *Watcher) BatchChanges(
+	ctx context.Context, changes []libkbfs.NodeChange, _ []libkbfs.NodeID) {
+	if len(changes) == 0 {
+		return
+	}
+	ci, haveCI := libkbfs.ChangeInfoFromContext(ctx)
+	// Handle in the background because we shouldn't lock during the
+	// notification.
+	w.notifications.QueueNotification(
+		func() { w.processBatch(changes, ci, haveCI) })
+}
+
+// TlfHandleChange implements the libkbfs.Observer interface for Watcher.
+func (w *Watcher) TlfHandleChange(_ context.Context, _ *libkbfs.TlfHandle) {
+	// Paths are relative to the FS, so they don't change.
+}
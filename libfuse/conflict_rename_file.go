@@ -0,0 +1,56 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libfuse
+
+import (
+	"syscall"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/keybase/kbfs/libfs"
+	"github.com/keybase/kbfs/libkbfs"
+	"golang.org/x/net/context"
+)
+
+// ConflictRenameTemplateFile is a special file used to set the
+// template a TLF uses to name conflicted entries.
+type ConflictRenameTemplateFile struct {
+	folder *Folder
+}
+
+var _ fs.Node = (*ConflictRenameTemplateFile)(nil)
+
+// Attr implements the fs.Node interface for ConflictRenameTemplateFile.
+func (f *ConflictRenameTemplateFile) Attr(
+	ctx context.Context, a *fuse.Attr) error {
+	a.Size = 0
+	a.Mode = 0222
+	return nil
+}
+
+var _ fs.Handle = (*ConflictRenameTemplateFile)(nil)
+
+var _ fs.HandleWriter = (*ConflictRenameTemplateFile)(nil)
+
+// Write implements the fs.HandleWriter interface for
+// ConflictRenameTemplateFile.
+func (f *ConflictRenameTemplateFile) Write(ctx context.Context,
+	req *fuse.WriteRequest, resp *fuse.WriteResponse) (err error) {
+	f.folder.fs.log.CDebugf(ctx, "ConflictRenameTemplateFile Write")
+	defer func() { err = f.folder.processError(ctx, libkbfs.WriteMode, err) }()
+	if req.Offset != 0 {
+		// The whole template must come in a single write.
+		return fuse.Errno(syscall.EINVAL)
+	}
+
+	err = libfs.SetConflictRenameTemplate(
+		f.folder.fs.config, f.folder.getFolderBranch(), req.Data)
+	if err != nil {
+		return err
+	}
+
+	resp.Size = len(req.Data)
+	return nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libfuse
+
+import (
+	"syscall"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/keybase/kbfs/libfs"
+	"github.com/keybase/kbfs/libkbfs"
+	"golang.org/x/net/context"
+)
+
+// AutoCRFile represents a write-only file where any write of at
+// least one byte either pauses or restarts automatic conflict
+// resolution for the folder.
+type AutoCRFile struct {
+	folder *Folder
+	enable bool
+}
+
+var _ fs.Node = (*AutoCRFile)(nil)
+
+// Attr implements the fs.Node interface for AutoCRFile.
+func (f *AutoCRFile) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Size = 0
+	a.Mode = 0222
+	return nil
+}
+
+var _ fs.Handle = (*AutoCRFile)(nil)
+
+var _ fs.HandleWriter = (*AutoCRFile)(nil)
+
+// Write implements the fs.HandleWriter interface for AutoCRFile.
+func (f *AutoCRFile) Write(ctx context.Context, req *fuse.WriteRequest,
+	resp *fuse.WriteResponse) (err error) {
+	f.folder.fs.log.CDebugf(ctx, "AutoCRFile (enable: %t) Write", f.enable)
+	defer func() { err = f.folder.processError(ctx, libkbfs.WriteMode, err) }()
+	if len(req.Data) == 0 {
+		return nil
+	}
+
+	err = f.folder.fs.config.KBFSOps().SetAutoConflictResolution(
+		ctx, f.folder.getFolderBranch(), f.enable)
+	if err != nil {
+		return err
+	}
+
+	resp.Size = len(req.Data)
+	return nil
+}
+
+// ResolveConflictsFile is a special file used to resolve a folder's
+// unmerged changes, choosing which versions of conflicted files to
+// keep.
+type ResolveConflictsFile struct {
+	folder *Folder
+}
+
+var _ fs.Node = (*ResolveConflictsFile)(nil)
+
+// Attr implements the fs.Node interface for ResolveConflictsFile.
+func (f *ResolveConflictsFile) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Size = 0
+	a.Mode = 0222
+	return nil
+}
+
+var _ fs.Handle = (*ResolveConflictsFile)(nil)
+
+var _ fs.HandleWriter = (*ResolveConflictsFile)(nil)
+
+// Write implements the fs.HandleWriter interface for
+// ResolveConflictsFile.
+func (f *ResolveConflictsFile) Write(ctx context.Context,
+	req *fuse.WriteRequest, resp *fuse.WriteResponse) (err error) {
+	f.folder.fs.log.CDebugf(ctx, "ResolveConflictsFile Write")
+	defer func() { err = f.folder.processError(ctx, libkbfs.WriteMode, err) }()
+	if req.Offset != 0 {
+		// The whole JSON object must come in a single write.
+		return fuse.Errno(syscall.EINVAL)
+	}
+
+	err = libfs.ResolveConflicts(
+		ctx, f.folder.fs.config, f.folder.getFolderBranch(), req.Data)
+	if err != nil {
+		return err
+	}
+
+	resp.Size = len(req.Data)
+	return nil
+}
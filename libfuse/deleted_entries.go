@@ -0,0 +1,121 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libfuse
+
+import (
+	"os"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/keybase/kbfs/libfs"
+	"github.com/keybase/kbfs/libkbfs"
+	"golang.org/x/net/context"
+)
+
+// DeletedEntriesDir is a node listing the entries recently deleted
+// from a TLF that can still be undeleted.
+type DeletedEntriesDir struct {
+	folder *Folder
+}
+
+var _ fs.Node = (*DeletedEntriesDir)(nil)
+
+// Attr implements the fs.Node interface for DeletedEntriesDir.
+func (d *DeletedEntriesDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0555
+	return nil
+}
+
+var _ fs.NodeRequestLookuper = (*DeletedEntriesDir)(nil)
+
+// Lookup implements the fs.NodeRequestLookuper interface for
+// DeletedEntriesDir.
+func (d *DeletedEntriesDir) Lookup(ctx context.Context,
+	req *fuse.LookupRequest, resp *fuse.LookupResponse) (
+	node fs.Node, err error) {
+	d.folder.fs.log.CDebugf(ctx, "DeletedEntriesDir Lookup %s", req.Name)
+	defer func() { err = d.folder.processError(ctx, libkbfs.ReadMode, err) }()
+	_, ok, err := libfs.GetDeletedEntry(
+		ctx, d.folder.fs.config, d.folder.getFolderBranch(), req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fuse.ENOENT
+	}
+
+	resp.EntryValid = 0
+	name := req.Name
+	return &SpecialReadFile{
+		read: func(ctx context.Context) ([]byte, time.Time, error) {
+			return libfs.GetEncodedDeletedEntry(ctx, d.folder.fs.config,
+				d.folder.getFolderBranch(), name)
+		},
+	}, nil
+}
+
+var _ fs.Handle = (*DeletedEntriesDir)(nil)
+
+var _ fs.HandleReadDirAller = (*DeletedEntriesDir)(nil)
+
+// ReadDirAll implements the fs.HandleReadDirAller interface for
+// DeletedEntriesDir.
+func (d *DeletedEntriesDir) ReadDirAll(ctx context.Context) (
+	res []fuse.Dirent, err error) {
+	d.folder.fs.log.CDebugf(ctx, "DeletedEntriesDir ReadDirAll")
+	defer func() { err = d.folder.processError(ctx, libkbfs.ReadMode, err) }()
+	names, err := libfs.GetDeletedEntryNames(
+		ctx, d.folder.fs.config, d.folder.getFolderBranch())
+	if err != nil {
+		return nil, err
+	}
+	res = make([]fuse.Dirent, 0, len(names))
+	for _, name := range names {
+		res = append(res, fuse.Dirent{
+			Type: fuse.DT_File,
+			Name: name,
+		})
+	}
+	return res, nil
+}
+
+// UndeleteFile is a special file used to undelete an entry listed in
+// the DeletedEntriesDir of a TLF.
+type UndeleteFile struct {
+	folder *Folder
+}
+
+var _ fs.Node = (*UndeleteFile)(nil)
+
+// Attr implements the fs.Node interface for UndeleteFile.
+func (f *UndeleteFile) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Size = 0
+	a.Mode = 0222
+	return nil
+}
+
+var _ fs.Handle = (*UndeleteFile)(nil)
+
+var _ fs.HandleWriter = (*UndeleteFile)(nil)
+
+// Write implements the fs.HandleWriter interface for UndeleteFile.
+func (f *UndeleteFile) Write(ctx context.Context, req *fuse.WriteRequest,
+	resp *fuse.WriteResponse) (err error) {
+	f.folder.fs.log.CDebugf(ctx, "UndeleteFile Write")
+	defer func() { err = f.folder.processError(ctx, libkbfs.WriteMode, err) }()
+	if len(req.Data) == 0 {
+		return nil
+	}
+
+	err = libfs.Undelete(
+		ctx, f.folder.fs.config, f.folder.getFolderBranch(), req.Data)
+	if err != nil {
+		return err
+	}
+
+	resp.Size = len(req.Data)
+	return nil
+}
@@ -132,6 +132,9 @@ func (f *Folder) forgetNode(node libkbfs.Node) {
 	defer f.nodesMu.Unlock()
 
 	delete(f.nodes, node.GetID())
+	if pa := f.fs.posix; pa != nil {
+		pa.forgetOwner(node.GetID())
+	}
 	if len(f.nodes) == 0 {
 		ctx := libkbfs.BackgroundContextWithCancellationDelayer()
 		defer libkbfs.CleanupCancellationDelayer(ctx)
@@ -240,7 +243,8 @@ func (f *Folder) localChangeInvalidate(ctx context.Context, node libkbfs.Node,
 // BatchChanges is called for changes originating anywhere, including
 // other hosts.
 func (f *Folder) BatchChanges(
-	ctx context.Context, changes []libkbfs.NodeChange, _ []libkbfs.NodeID) {
+	ctx context.Context, changes []libkbfs.NodeChange,
+	affectedNodeIDs []libkbfs.NodeID) {
 	if !f.fs.conn.Protocol().HasInvalidate() {
 		// OSXFUSE 2.x does not support notifications
 		return
@@ -254,11 +258,52 @@ func (f *Folder) BatchChanges(
 
 	// Handle in the background because we shouldn't lock during the
 	// notification.
-	f.fs.queueNotification(func() { f.batchChangesInvalidate(ctx, changes) })
+	f.fs.queueNotification(func() {
+		f.batchChangesInvalidate(ctx, changes, affectedNodeIDs)
+	})
+}
+
+func (f *Folder) invalidateNodeAttr(ctx context.Context, n fs.Node) {
+	if file, ok := n.(*File); ok {
+		file.eiCache.destroy()
+	}
+	if err := f.fs.fuse.InvalidateNodeAttr(n); err != nil && err != fuse.ErrNotCached {
+		// TODO we have no mechanism to do anything about this
+		f.fs.log.CErrorf(ctx, "FUSE invalidate error: %v", err)
+	}
+}
+
+// invalidateUpdatedChildren invalidates the attributes of any child
+// of `dir` now found at one of `names`, and known to the kernel.
+// Such a child has been renamed from another entry, which changed its
+// ctime.
+func (f *Folder) invalidateUpdatedChildren(ctx context.Context,
+	dir libkbfs.Node, names []string,
+	invalidated map[libkbfs.NodeID]bool) {
+	for _, name := range names {
+		child, _, err := f.fs.config.KBFSOps().Lookup(ctx, dir, name)
+		if err != nil || child == nil {
+			// Removed entries, and symlinks, have no node to
+			// invalidate.
+			continue
+		}
+		if invalidated[child.GetID()] {
+			continue
+		}
+		f.nodesMu.Lock()
+		n, ok := f.nodes[child.GetID()]
+		f.nodesMu.Unlock()
+		if !ok {
+			continue
+		}
+		f.invalidateNodeAttr(ctx, n)
+		invalidated[child.GetID()] = true
+	}
 }
 
 func (f *Folder) batchChangesInvalidate(ctx context.Context,
-	changes []libkbfs.NodeChange) {
+	changes []libkbfs.NodeChange, affectedNodeIDs []libkbfs.NodeID) {
+	invalidated := make(map[libkbfs.NodeID]bool, len(changes))
 	for _, v := range changes {
 		f.nodesMu.Lock()
 		n, ok := f.nodes[v.Node.GetID()]
@@ -266,6 +311,7 @@ func (f *Folder) batchChangesInvalidate(ctx context.Context,
 		if !ok {
 			continue
 		}
+		invalidated[v.Node.GetID()] = true
 
 		switch {
 		case len(v.DirUpdated) > 0:
@@ -281,6 +327,8 @@ func (f *Folder) batchChangesInvalidate(ctx context.Context,
 					f.fs.log.CErrorf(ctx, "FUSE invalidate error: %v", err)
 				}
 			}
+			f.invalidateUpdatedChildren(
+				ctx, v.Node, v.DirUpdated, invalidated)
 
 		case len(v.FileUpdated) > 0:
 			for _, write := range v.FileUpdated {
@@ -291,15 +339,26 @@ func (f *Folder) batchChangesInvalidate(ctx context.Context,
 			}
 
 		default:
-			if file, ok := n.(*File); ok {
-				file.eiCache.destroy()
-			}
 			// just the attributes
-			if err := f.fs.fuse.InvalidateNodeAttr(n); err != nil && err != fuse.ErrNotCached {
-				// TODO we have no mechanism to do anything about this
-				f.fs.log.CErrorf(ctx, "FUSE invalidate error: %v", err)
-			}
+			f.invalidateNodeAttr(ctx, n)
+		}
+	}
+
+	// The other affected nodes, such as the parent directories of
+	// the changed entries, now have new blocks and possibly new
+	// sizes and times.
+	for _, id := range affectedNodeIDs {
+		if invalidated[id] {
+			continue
 		}
+		f.nodesMu.Lock()
+		n, ok := f.nodes[id]
+		f.nodesMu.Unlock()
+		if !ok {
+			continue
+		}
+		f.invalidateNodeAttr(ctx, n)
+		invalidated[id] = true
 	}
 }
 
@@ -428,7 +487,7 @@ type DirInterface interface {
 	fs.NodeRenamer
 	fs.NodeRemover
 	fs.Handle
-	fs.HandleReadDirAller
+	fs.HandleReadDirPager
 	fs.NodeForgetter
 	fs.NodeSetattrer
 	fs.NodeFsyncer
@@ -500,6 +559,12 @@ func (d *Dir) attr(ctx context.Context, a *fuse.Attr) (err error) {
 	}
 
 	a.Mode |= os.ModeDir | 0500
+	if pa := d.folder.fs.posix; pa != nil {
+		err = pa.fillAttr(ctx, d.folder.fs.config, d.node, false, a)
+		if err != nil {
+			return err
+		}
+	}
 	a.Inode = d.inode
 	return nil
 }
@@ -526,6 +591,10 @@ func (d *Dir) Lookup(ctx context.Context, req *fuse.LookupRequest, resp *fuse.Lo
 		return specialNode, nil
 	}
 
+	if req.Name == libfs.QuotaUsageFileName {
+		return NewQuotaUsageFile(d.folder.fs, d.node, &resp.EntryValid), nil
+	}
+
 	// Check if this is a per-file metainformation file, if so
 	// return the corresponding SpecialReadFile.
 	if strings.HasPrefix(req.Name, libfs.FileInfoPrefix) {
@@ -533,9 +602,32 @@ func (d *Dir) Lookup(ctx context.Context, req *fuse.LookupRequest, resp *fuse.Lo
 		return NewFileInfoFile(d.folder.fs, d.node, name, &resp.EntryValid), nil
 	}
 
+	if strings.HasPrefix(req.Name, libfs.FileRevisionsPrefix) {
+		name := req.Name[len(libfs.FileRevisionsPrefix):]
+		return NewFileRevisionsFile(
+			d.folder.fs, d.node, name, &resp.EntryValid), nil
+	}
+
+	if strings.HasPrefix(req.Name, libfs.RestoreFromRevisionPrefix) {
+		resp.EntryValid = 0
+		name := req.Name[len(libfs.RestoreFromRevisionPrefix):]
+		return &RestoreFile{folder: d.folder, dir: d.node, name: name}, nil
+	}
+
 	newNode, de, err := d.folder.fs.config.KBFSOps().Lookup(ctx, d.node, req.Name)
 	if err != nil {
 		if _, ok := err.(libkbfs.NoSuchNameError); ok {
+			// Maybe this names an older version of a file, in
+			// which case link to it within the archived TLF.
+			target, ok, linkErr := libfs.FileRevisionLinkTarget(
+				ctx, d.folder.fs.config, d.node, req.Name)
+			if linkErr != nil {
+				return nil, linkErr
+			}
+			if ok {
+				resp.EntryValid = 0
+				return &Alias{realPath: target}, nil
+			}
 			return nil, fuse.ENOENT
 		}
 		return nil, err
@@ -726,11 +818,36 @@ func (d *Dir) Rename(ctx context.Context, req *fuse.RenameRequest,
 		return fuse.Errno(syscall.EIO)
 	}
 
+	var oldPath, newPath string
+	pa := d.folder.fs.posix
+	if pa != nil {
+		oldPath, err = pa.childPath(
+			ctx, d.folder.fs.config, d.node, req.OldName)
+		if err != nil {
+			return err
+		}
+		newPath, err = pa.childPath(
+			ctx, d.folder.fs.config, realNewDir.node, req.NewName)
+		if err != nil {
+			return err
+		}
+	}
+
 	err = d.folder.fs.config.KBFSOps().Rename(ctx,
 		d.node, req.OldName, realNewDir.node, req.NewName)
 
 	switch e := err.(type) {
 	case nil:
+		if pa != nil {
+			// The rename already happened, so don't fail it just
+			// because the read-only bits couldn't be saved.
+			err := pa.rename(d.node.GetFolderBranch().Tlf, oldPath, newPath)
+			if err != nil {
+				d.folder.fs.log.CWarningf(ctx,
+					"Couldn't save read-only bits after renaming %s: %+v",
+					oldPath, err)
+			}
+		}
 		return nil
 	case libkbfs.RenameAcrossDirsError:
 		var execPathErr error
@@ -765,6 +882,15 @@ func (d *Dir) Remove(ctx context.Context, req *fuse.RemoveRequest) (err error) {
 	// node will be removed from Folder.nodes, if it is there in the
 	// first place, by its Forget
 
+	var p string
+	pa := d.folder.fs.posix
+	if pa != nil {
+		p, err = pa.childPath(ctx, d.folder.fs.config, d.node, req.Name)
+		if err != nil {
+			return err
+		}
+	}
+
 	if req.Dir {
 		err = d.folder.fs.config.KBFSOps().RemoveDir(ctx, d.node, req.Name)
 	} else {
@@ -774,26 +900,55 @@ func (d *Dir) Remove(ctx context.Context, req *fuse.RemoveRequest) (err error) {
 		return err
 	}
 
+	if pa != nil {
+		// The removal already happened, so don't fail it just
+		// because the read-only bits couldn't be saved.
+		err := pa.remove(d.node.GetFolderBranch().Tlf, p)
+		if err != nil {
+			d.folder.fs.log.CWarningf(ctx,
+				"Couldn't save read-only bits after removing %s: %+v",
+				p, err)
+		}
+	}
+
 	return nil
 }
 
-// ReadDirAll implements the fs.NodeReadDirAller interface for Dir.
-func (d *Dir) ReadDirAll(ctx context.Context) (res []fuse.Dirent, err error) {
-	ctx = d.folder.fs.config.MaybeStartTrace(
-		ctx, "Dir.ReadDirAll", d.node.GetBasename())
+var _ fs.HandleReadDirPager = (*Dir)(nil)
+
+// ReadDirPage implements the fs.HandleReadDirPager interface for
+// Dir.  The kernel reads the directory a buffer at a time, so only
+// the directory blocks covering each page of children get fetched.
+func (d *Dir) ReadDirPage(ctx context.Context, after string, maxEntries int) (
+	res []fuse.Dirent, err error) {
+	ctx = d.folder.fs.config.MaybeStartTrace(ctx, "Dir.ReadDirPage",
+		fmt.Sprintf("%s after=%q max=%d", d.node.GetBasename(), after,
+			maxEntries))
 	defer func() { d.folder.fs.config.MaybeFinishTrace(ctx, err) }()
 
-	d.folder.fs.log.CDebugf(ctx, "Dir ReadDirAll")
+	d.folder.fs.log.CDebugf(ctx, "Dir ReadDirPage after=%q max=%d",
+		after, maxEntries)
 	defer func() { err = d.folder.processError(ctx, libkbfs.ReadMode, err) }()
 
-	children, err := d.folder.fs.config.KBFSOps().GetDirChildren(ctx, d.node)
+	if maxEntries <= 0 {
+		// A non-positive count would mean all remaining children.
+		return nil, nil
+	}
+	children, err := d.folder.fs.config.KBFSOps().GetDirChildrenPaged(
+		ctx, d.node, after, maxEntries)
 	if err != nil {
 		return nil, err
 	}
+	res = appendDirents(res, children)
+	d.folder.fs.log.CDebugf(ctx, "Returning %d entries", len(res))
+	return res, nil
+}
 
-	for name, ei := range children {
+func appendDirents(
+	res []fuse.Dirent, children []libkbfs.DirChild) []fuse.Dirent {
+	for _, c := range children {
 		fde := fuse.Dirent{
-			Name: name,
+			Name: c.Name,
 			// Technically we should be setting the inode here, but
 			// since we don't have a proper node for each of these
 			// entries yet we can't generate one, because we don't
@@ -801,7 +956,7 @@ func (d *Dir) ReadDirAll(ctx context.Context) (res []fuse.Dirent, err error) {
 			// generate a random one for each entry, but doesn't store
 			// it anywhere, so it's safe.
 		}
-		switch ei.Type {
+		switch c.Type {
 		case libkbfs.File, libkbfs.Exec:
 			fde.Type = fuse.DT_File
 		case libkbfs.Dir:
@@ -811,8 +966,7 @@ func (d *Dir) ReadDirAll(ctx context.Context) (res []fuse.Dirent, err error) {
 		}
 		res = append(res, fde)
 	}
-	d.folder.fs.log.CDebugf(ctx, "Returning %d entries", len(res))
-	return res, nil
+	return res
 }
 
 // Forget kernel reference to this node.
@@ -0,0 +1,55 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libfuse
+
+import (
+	"syscall"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/keybase/kbfs/libfs"
+	"github.com/keybase/kbfs/libkbfs"
+	"golang.org/x/net/context"
+)
+
+// DiskCacheSettingsFile is a special file used to set how the blocks
+// of a TLF are kept in the working set disk cache.
+type DiskCacheSettingsFile struct {
+	folder *Folder
+}
+
+var _ fs.Node = (*DiskCacheSettingsFile)(nil)
+
+// Attr implements the fs.Node interface for DiskCacheSettingsFile.
+func (f *DiskCacheSettingsFile) Attr(
+	ctx context.Context, a *fuse.Attr) error {
+	a.Size = 0
+	a.Mode = 0222
+	return nil
+}
+
+var _ fs.Handle = (*DiskCacheSettingsFile)(nil)
+
+var _ fs.HandleWriter = (*DiskCacheSettingsFile)(nil)
+
+// Write implements the fs.HandleWriter interface for DiskCacheSettingsFile.
+func (f *DiskCacheSettingsFile) Write(ctx context.Context,
+	req *fuse.WriteRequest, resp *fuse.WriteResponse) (err error) {
+	f.folder.fs.log.CDebugf(ctx, "DiskCacheSettingsFile Write")
+	defer func() { err = f.folder.processError(ctx, libkbfs.WriteMode, err) }()
+	if req.Offset != 0 {
+		// The whole JSON object must come in a single write.
+		return fuse.Errno(syscall.EINVAL)
+	}
+
+	err = libfs.SetDiskCacheSettings(ctx, f.folder.fs.config,
+		f.folder.getFolderBranch(), req.Data)
+	if err != nil {
+		return err
+	}
+
+	resp.Size = len(req.Data)
+	return nil
+}
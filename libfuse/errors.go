@@ -76,6 +76,10 @@ func filterError(err error) error {
 		return errorWithErrno{err, syscall.ENOSPC}
 	case libkbfs.RevGarbageCollectedError:
 		return errorWithErrno{err, syscall.ENOENT}
+	case libkbfs.NoDataAfterOffsetError:
+		return errorWithErrno{err, syscall.ENXIO}
+	case libkbfs.LockLeaseExpiredError:
+		return errorWithErrno{err, syscall.ENOLCK}
 	}
 	return err
 }
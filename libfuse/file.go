@@ -6,11 +6,16 @@ package libfuse
 
 import (
 	"fmt"
+	"math"
 	"os"
 	"sync"
+	"syscall"
+	"time"
 
 	"bazil.org/fuse"
 	"bazil.org/fuse/fs"
+	"github.com/keybase/client/go/protocol/keybase1"
+	"github.com/keybase/kbfs/libfs"
 	"github.com/keybase/kbfs/libkbfs"
 	"golang.org/x/net/context"
 )
@@ -75,10 +80,37 @@ func (f *File) fillAttrWithMode(
 		a.Mode |= 0100
 	}
 
+	if pa := f.folder.fs.posix; pa != nil {
+		err = pa.fillAttr(ctx, f.folder.fs.config, f.node, true, a)
+		if err != nil {
+			return err
+		}
+	}
+
 	a.Inode = f.inode
 	return nil
 }
 
+// checkWritable returns an error if the file has been marked
+// read-only through POSIX emulation.
+func (f *File) checkWritable(ctx context.Context) error {
+	pa := f.folder.fs.posix
+	tlfID := f.node.GetFolderBranch().Tlf
+	if pa == nil || !pa.hasReadOnly(tlfID) {
+		// Avoid fetching the path when nothing in the TLF could
+		// be read-only, as fillAttr does.
+		return nil
+	}
+	p, err := pa.nodePath(ctx, f.folder.fs.config, f.node)
+	if err != nil {
+		return err
+	}
+	if pa.isReadOnly(tlfID, p) {
+		return fuse.Errno(syscall.EACCES)
+	}
+	return nil
+}
+
 // Attr implements the fs.Node interface for File.
 func (f *File) Attr(ctx context.Context, a *fuse.Attr) (err error) {
 	ctx = f.folder.fs.config.MaybeStartTrace(
@@ -165,6 +197,9 @@ func (f *File) Access(ctx context.Context, r *fuse.AccessRequest) (err error) {
 		if !iw {
 			return fuse.EPERM
 		}
+		if f.checkWritable(ctx) != nil {
+			return fuse.EPERM
+		}
 	}
 
 	return nil
@@ -240,6 +275,9 @@ func (f *File) Write(ctx context.Context, req *fuse.WriteRequest,
 	defer func() { err = f.folder.processError(ctx, libkbfs.WriteMode, err) }()
 
 	f.eiCache.destroy()
+	if err := f.checkWritable(ctx); err != nil {
+		return err
+	}
 	if err := f.folder.fs.config.KBFSOps().Write(
 		ctx, f.node, req.Data, req.Offset); err != nil {
 		return err
@@ -248,6 +286,239 @@ func (f *File) Write(ctx context.Context, req *fuse.WriteRequest,
 	return nil
 }
 
+var _ fs.HandleFallocater = (*File)(nil)
+
+// Fallocate implements the fs.HandleFallocater interface for File.
+// Only punching holes is supported, since KBFS can't reserve space
+// ahead of writes.
+func (f *File) Fallocate(ctx context.Context, req *fuse.FallocateRequest) (
+	err error) {
+	ctx = f.folder.fs.config.MaybeStartTrace(ctx, "File.Fallocate",
+		fmt.Sprintf("%s off=%d len=%d mode=%s", f.node.GetBasename(),
+			req.Offset, req.Length, req.Mode))
+	defer func() { f.folder.fs.config.MaybeFinishTrace(ctx, err) }()
+
+	f.folder.fs.log.CDebugf(ctx, "File Fallocate off=%d len=%d mode=%s",
+		req.Offset, req.Length, req.Mode)
+	defer func() { err = f.folder.processError(ctx, libkbfs.WriteMode, err) }()
+
+	if req.Mode != fuse.FallocateKeepSize|fuse.FallocatePunchHole {
+		return fuse.Errno(syscall.EOPNOTSUPP)
+	}
+
+	f.eiCache.destroy()
+	if err := f.checkWritable(ctx); err != nil {
+		return err
+	}
+	return f.folder.fs.config.KBFSOps().PunchHole(
+		ctx, f.node, req.Offset, req.Length)
+}
+
+var _ fs.HandleSeeker = (*File)(nil)
+
+// Seek implements the fs.HandleSeeker interface for File.
+func (f *File) Seek(ctx context.Context, req *fuse.SeekRequest,
+	resp *fuse.SeekResponse) (err error) {
+	ctx = f.folder.fs.config.MaybeStartTrace(ctx, "File.Seek",
+		fmt.Sprintf("%s off=%d whence=%d", f.node.GetBasename(),
+			req.Offset, req.Whence))
+	defer func() { f.folder.fs.config.MaybeFinishTrace(ctx, err) }()
+
+	f.folder.fs.log.CDebugf(ctx, "File Seek off=%d whence=%d",
+		req.Offset, req.Whence)
+	defer func() { err = f.folder.processError(ctx, libkbfs.ReadMode, err) }()
+
+	if req.Offset < 0 {
+		return fuse.Errno(syscall.ENXIO)
+	}
+	var hole bool
+	switch req.Whence {
+	case libfs.SeekData:
+	case libfs.SeekHole:
+		hole = true
+	default:
+		return fuse.Errno(syscall.EINVAL)
+	}
+	off, err := f.folder.fs.config.KBFSOps().SeekDataOrHole(
+		ctx, f.node, uint64(req.Offset), hole)
+	if err != nil {
+		return err
+	}
+	resp.Offset = int64(off)
+	return nil
+}
+
+// fileLockTryTimeout is how long a non-blocking lock request waits
+// for the server lock.  The lock manager can't tell that another
+// device holds a lock without trying to take it, so this bounds the
+// try.
+const fileLockTryTimeout = time.Second
+
+// checkLockRange returns ENOLCK unless `lock` covers the whole file,
+// since byte-range locks aren't supported.
+func checkLockRange(lock fuse.FileLock) error {
+	if lock.Start != 0 || lock.End != math.MaxInt64 {
+		return fuse.Errno(syscall.ENOLCK)
+	}
+	return nil
+}
+
+// lockID returns the lock ID shared by all the ways of locking this
+// file.  Byte ranges and lock types aren't supported, so every lock
+// request is for an exclusive lock on the whole file.
+func (f *File) lockID(ctx context.Context) (keybase1.LockID, error) {
+	md, err := f.folder.fs.config.KBFSOps().GetNodeMetadata(ctx, f.node)
+	if err != nil {
+		return 0, err
+	}
+	return libfs.FileLockID(f.folder.list.tlfType, md.PathFromRoot), nil
+}
+
+// lock takes the lock for `owner`.  If `try` is true, it returns
+// EAGAIN rather than waiting for another owner to release it.
+func (f *File) lock(
+	ctx context.Context, owner fuse.LockOwner, try bool) error {
+	lockID, err := f.lockID(ctx)
+	if err != nil {
+		return err
+	}
+	lm := f.folder.fs.config.LockManager()
+	fb := f.node.GetFolderBranch()
+	if !try {
+		return lm.Lock(
+			ctx, fb, lockID, uint64(owner), keybase1.MDPriorityNormal)
+	}
+	err = lm.TryLock(ctx, fb, lockID, uint64(owner),
+		keybase1.MDPriorityNormal, fileLockTryTimeout)
+	if _, ok := err.(libkbfs.LockBusyError); ok {
+		return fuse.Errno(syscall.EAGAIN)
+	}
+	return err
+}
+
+// unlock releases the lock held by `owner`, if any.  Unlocking a
+// lock that `owner` doesn't hold is a no-op, as for local locks.
+func (f *File) unlock(ctx context.Context, owner fuse.LockOwner) error {
+	lockID, err := f.lockID(ctx)
+	if err != nil {
+		return err
+	}
+	fb := f.node.GetFolderBranch()
+	lm := f.folder.fs.config.LockManager()
+	if o, held := lm.QueryLock(fb, lockID); !held || o != uint64(owner) {
+		return nil
+	}
+	return lm.Unlock(
+		ctx, fb, lockID, uint64(owner), keybase1.MDPriorityNormal)
+}
+
+var _ fs.HandleFlockLocker = (*File)(nil)
+var _ fs.HandlePOSIXLocker = (*File)(nil)
+
+// Lock implements the fs.HandleLocker interface for File.
+func (f *File) Lock(ctx context.Context, req *fuse.LockRequest) (err error) {
+	ctx = f.folder.fs.config.MaybeStartTrace(
+		ctx, "File.Lock", f.node.GetBasename())
+	defer func() { f.folder.fs.config.MaybeFinishTrace(ctx, err) }()
+
+	f.folder.fs.log.CDebugf(ctx, "File Lock owner=%s", req.LockOwner)
+	defer func() { err = f.folder.processError(ctx, libkbfs.WriteMode, err) }()
+
+	if err := checkLockRange(req.Lock); err != nil {
+		return err
+	}
+	return f.lock(ctx, req.LockOwner, true)
+}
+
+// LockWait implements the fs.HandleLocker interface for File.
+func (f *File) LockWait(
+	ctx context.Context, req *fuse.LockWaitRequest) (err error) {
+	ctx = f.folder.fs.config.MaybeStartTrace(
+		ctx, "File.LockWait", f.node.GetBasename())
+	defer func() { f.folder.fs.config.MaybeFinishTrace(ctx, err) }()
+
+	f.folder.fs.log.CDebugf(ctx, "File LockWait owner=%s", req.LockOwner)
+	defer func() { err = f.folder.processError(ctx, libkbfs.WriteMode, err) }()
+
+	if err := checkLockRange(req.Lock); err != nil {
+		return err
+	}
+	return f.lock(ctx, req.LockOwner, false)
+}
+
+// Unlock implements the fs.HandleLocker interface for File.
+func (f *File) Unlock(ctx context.Context, req *fuse.UnlockRequest) (err error) {
+	ctx = f.folder.fs.config.MaybeStartTrace(
+		ctx, "File.Unlock", f.node.GetBasename())
+	defer func() { f.folder.fs.config.MaybeFinishTrace(ctx, err) }()
+
+	f.folder.fs.log.CDebugf(ctx, "File Unlock owner=%s", req.LockOwner)
+	defer func() { err = f.folder.processError(ctx, libkbfs.WriteMode, err) }()
+
+	if err := checkLockRange(req.Lock); err != nil {
+		return err
+	}
+	return f.unlock(ctx, req.LockOwner)
+}
+
+// QueryLock implements the fs.HandleLocker interface for File.  It
+// only knows about locks held through this mount.
+func (f *File) QueryLock(ctx context.Context, req *fuse.QueryLockRequest,
+	resp *fuse.QueryLockResponse) (err error) {
+	ctx = f.folder.fs.config.MaybeStartTrace(
+		ctx, "File.QueryLock", f.node.GetBasename())
+	defer func() { f.folder.fs.config.MaybeFinishTrace(ctx, err) }()
+
+	f.folder.fs.log.CDebugf(ctx, "File QueryLock owner=%s", req.LockOwner)
+	defer func() { err = f.folder.processError(ctx, libkbfs.ReadMode, err) }()
+
+	lockID, err := f.lockID(ctx)
+	if err != nil {
+		return err
+	}
+	o, held := f.folder.fs.config.LockManager().QueryLock(
+		f.node.GetFolderBranch(), lockID)
+	if held && o != uint64(req.LockOwner) {
+		resp.Lock = fuse.FileLock{
+			Start: 0,
+			End:   math.MaxInt64,
+			Type:  fuse.LockWrite,
+			PID:   -1,
+		}
+	}
+	return nil
+}
+
+// Flush implements the fs.HandleFlusher interface for File.  Closing
+// any file descriptor releases the POSIX locks of its owner.
+func (f *File) Flush(ctx context.Context, req *fuse.FlushRequest) (err error) {
+	ctx = f.folder.fs.config.MaybeStartTrace(
+		ctx, "File.Flush", f.node.GetBasename())
+	defer func() { f.folder.fs.config.MaybeFinishTrace(ctx, err) }()
+
+	f.folder.fs.log.CDebugf(ctx, "File Flush")
+	defer func() { err = f.folder.processError(ctx, libkbfs.WriteMode, err) }()
+
+	return f.unlock(ctx, fuse.LockOwner(req.LockOwner))
+}
+
+// Release implements the fs.HandleReleaser interface for File.  The
+// final close of a file releases its flock lock.
+func (f *File) Release(ctx context.Context, req *fuse.ReleaseRequest) (err error) {
+	if req.ReleaseFlags&fuse.ReleaseFlockUnlock == 0 {
+		return nil
+	}
+
+	ctx = f.folder.fs.config.MaybeStartTrace(
+		ctx, "File.Release", f.node.GetBasename())
+	defer func() { f.folder.fs.config.MaybeFinishTrace(ctx, err) }()
+
+	f.folder.fs.log.CDebugf(ctx, "File Release")
+	defer func() { err = f.folder.processError(ctx, libkbfs.WriteMode, err) }()
+
+	return f.unlock(ctx, fuse.LockOwner(req.LockOwner))
+}
+
 var _ fs.NodeSetattrer = (*File)(nil)
 
 // Setattr implements the fs.NodeSetattrer interface for File.
@@ -264,6 +535,9 @@ func (f *File) Setattr(ctx context.Context, req *fuse.SetattrRequest,
 	f.eiCache.destroy()
 
 	if valid.Size() {
+		if err := f.checkWritable(ctx); err != nil {
+			return err
+		}
 		if err := f.folder.fs.config.KBFSOps().Truncate(
 			ctx, f.node, req.Size); err != nil {
 			return err
@@ -279,6 +553,19 @@ func (f *File) Setattr(ctx context.Context, req *fuse.SetattrRequest,
 		if err != nil {
 			return err
 		}
+		if pa := f.folder.fs.posix; pa != nil {
+			// Likewise, the user-write bit controls the emulated
+			// read-only bit.
+			p, err := pa.nodePath(ctx, f.folder.fs.config, f.node)
+			if err != nil {
+				return err
+			}
+			err = pa.setReadOnly(
+				f.node.GetFolderBranch().Tlf, p, req.Mode&0200 == 0)
+			if err != nil {
+				return err
+			}
+		}
 		valid &^= fuse.SetattrMode
 	}
 
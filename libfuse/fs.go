@@ -60,6 +60,10 @@ type FS struct {
 
 	inodeLock sync.Mutex
 	nextInode uint64
+
+	// posix, if non-nil, emulates POSIX ownership and permission
+	// bits for entries in TLFs.
+	posix *posixAttrs
 }
 
 func makeTraceHandler(renderFn func(http.ResponseWriter, *http.Request, bool)) func(http.ResponseWriter, *http.Request) {
@@ -16,3 +16,12 @@ func NewMetricsFile(fs *FS, entryValid *time.Duration) *SpecialReadFile {
 	*entryValid = 0
 	return &SpecialReadFile{read: libfs.GetEncodedMetrics(fs.config)}
 }
+
+// NewPrometheusMetricsFile returns a special read file that contains
+// all metrics in the Prometheus text format.
+func NewPrometheusMetricsFile(
+	fs *FS, entryValid *time.Duration) *SpecialReadFile {
+	*entryValid = 0
+	return &SpecialReadFile{
+		read: libfs.GetEncodedPrometheusMetrics(fs.config)}
+}
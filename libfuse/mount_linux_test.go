@@ -0,0 +1,115 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libfuse
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"syscall"
+	"testing"
+
+	"bazil.org/fuse"
+	"github.com/keybase/kbfs/ioutil"
+	"github.com/keybase/kbfs/libfs"
+	"github.com/keybase/kbfs/libkbfs"
+	"golang.org/x/sys/unix"
+)
+
+func TestPunchHoleAndSeek(t *testing.T) {
+	ctx := libkbfs.BackgroundContextWithCancellationDelayer()
+	defer libkbfs.CleanupCancellationDelayer(ctx)
+	config := libkbfs.MakeTestConfigOrBust(t, "jdoe")
+	defer libkbfs.CheckConfigAndShutdown(ctx, t, config)
+	// Use small blocks, so that the hole covers whole blocks.
+	bsplit, err := libkbfs.NewBlockSplitterSimple(1024, 8*1024, config.Codec())
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.SetBlockSplitter(bsplit)
+	mnt, _, cancelFn := makeFS(t, ctx, config)
+	defer mnt.Close()
+	defer cancelFn()
+
+	const size = 64 * 1024
+	const holeStart = 8 * 1024
+	const holeEnd = 56 * 1024
+	input := bytes.Repeat([]byte{'x'}, size)
+	p := path.Join(mnt.Dir, PrivateName, "jdoe", "myfile")
+	if err := ioutil.WriteFile(p, input, 0644); err != nil {
+		t.Fatal(err)
+	}
+	syncFilename(t, p)
+
+	f, err := os.OpenFile(p, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	mode := uint32(fuse.FallocateKeepSize | fuse.FallocatePunchHole)
+	err = unix.Fallocate(int(f.Fd()), mode, holeStart, holeEnd-holeStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Preallocating space isn't supported.
+	err = unix.Fallocate(int(f.Fd()), 0, 0, 2*size)
+	if err != syscall.EOPNOTSUPP {
+		t.Errorf("expected EOPNOTSUPP: %v", err)
+	}
+	if err := f.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mustBeFileWithSize(fi, size); err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := ioutil.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := holeStart; i < holeEnd; i++ {
+		input[i] = 0
+	}
+	if !bytes.Equal(buf, input) {
+		t.Errorf("read wrong content after punching a hole")
+	}
+
+	// The block containing the start of the hole was cut short, so
+	// the hole starts exactly there.
+	off, err := f.Seek(0, libfs.SeekHole)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if off != holeStart {
+		t.Errorf("wrong hole offset: %d != %d", off, holeStart)
+	}
+	// The block containing the end of the hole was only zeroed, so
+	// the data starts somewhere within it.
+	off, err = f.Seek(holeStart, libfs.SeekData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if off <= holeStart || off > holeEnd {
+		t.Errorf("data offset %d not in (%d, %d]", off, holeStart, holeEnd)
+	}
+	// The end of the file counts as a hole.
+	off, err = f.Seek(holeEnd, libfs.SeekHole)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if off != size {
+		t.Errorf("wrong hole offset at the end: %d != %d", off, size)
+	}
+	_, err = f.Seek(size, libfs.SeekData)
+	if pe, ok := err.(*os.PathError); !ok || pe.Err != syscall.ENXIO {
+		t.Errorf("expected ENXIO: %v", err)
+	}
+}
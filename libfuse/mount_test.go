@@ -742,6 +742,63 @@ func TestCreateExecutable(t *testing.T) {
 	}
 }
 
+func TestReadDirInPages(t *testing.T) {
+	ctx := libkbfs.BackgroundContextWithCancellationDelayer()
+	defer libkbfs.CleanupCancellationDelayer(ctx)
+	config := libkbfs.MakeTestConfigOrBust(t, "jdoe")
+	defer libkbfs.CheckConfigAndShutdown(ctx, t, config)
+	mnt, fs, cancelFn := makeFS(t, ctx, config)
+	defer mnt.Close()
+	defer cancelFn()
+
+	// Use enough long names that the listing needs several reads
+	// from the kernel.
+	const numFiles = 300
+	p := path.Join(mnt.Dir, PrivateName, "jdoe", "mydir")
+	if err := ioutil.Mkdir(p, 0755); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for i := 0; i < numFiles; i++ {
+		name := fmt.Sprintf("file-with-a-fairly-long-name-%03d", i)
+		names = append(names, name)
+		err := ioutil.WriteFile(path.Join(p, name), nil, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	syncAll(t, "jdoe", tlf.Private, fs)
+
+	readNames := func(f *os.File) (res []string) {
+		for {
+			page, err := f.Readdirnames(7)
+			res = append(res, page...)
+			if err == io.EOF {
+				return res
+			} else if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if g, e := readNames(f), names; !reflect.DeepEqual(g, e) {
+		t.Errorf("wrong listing: %v != %v", g, e)
+	}
+
+	// Rewinding starts over.
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if g, e := readNames(f), names; !reflect.DeepEqual(g, e) {
+		t.Errorf("wrong listing after rewind: %v != %v", g, e)
+	}
+}
+
 func TestMkdir(t *testing.T) {
 	ctx := libkbfs.BackgroundContextWithCancellationDelayer()
 	defer libkbfs.CleanupCancellationDelayer(ctx)
@@ -2749,6 +2806,194 @@ func TestInvalidateEntryOnDelete(t *testing.T) {
 	}
 }
 
+// makeTwoUserFSes mounts the same shared TLF for two different users,
+// so that changes made through one mount come from another device
+// from the point of view of the other.
+func makeTwoUserFSes(t *testing.T, ctx context.Context) (
+	mnt1, mnt2 *fstestutil.Mount, fs1, fs2 *FS, shutdown func()) {
+	config1 := libkbfs.MakeTestConfigOrBust(t, "user1", "user2")
+	mnt1, fs1, cancelFn1 := makeFS(t, ctx, config1)
+	config2 := libkbfs.ConfigAsUser(config1, "user2")
+	mnt2, fs2, cancelFn2 := makeFS(t, ctx, config2)
+	shutdown = func() {
+		mnt2.Close()
+		cancelFn2()
+		libkbfs.CheckConfigAndShutdown(ctx, t, config2)
+		mnt1.Close()
+		cancelFn1()
+		libkbfs.CheckConfigAndShutdown(ctx, t, config1)
+	}
+	return mnt1, mnt2, fs1, fs2, shutdown
+}
+
+func TestInvalidateEntryOnRemoteCreate(t *testing.T) {
+	ctx := libkbfs.BackgroundContextWithCancellationDelayer()
+	defer libkbfs.CleanupCancellationDelayer(ctx)
+	mnt1, mnt2, fs1, fs2, shutdown := makeTwoUserFSes(t, ctx)
+	defer shutdown()
+
+	if !mnt2.Conn.Protocol().HasInvalidate() {
+		t.Skip("Old FUSE protocol")
+	}
+
+	// Make sure user 2 sees the TLF before caching anything in it.
+	mydir1 := path.Join(mnt1.Dir, PrivateName, "user1,user2", "mydir")
+	if err := ioutil.Mkdir(mydir1, 0755); err != nil {
+		t.Fatal(err)
+	}
+	syncAll(t, "user1,user2", tlf.Private, fs1)
+	syncFolderToServer(t, "user1,user2", fs2)
+
+	// Cache both the directory listing and a negative lookup of the
+	// new file in the second mount.
+	mydir2 := path.Join(mnt2.Dir, PrivateName, "user1,user2", "mydir")
+	if _, err := ioutil.ReadDir(mydir2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.Lstat(path.Join(mydir2, "myfile")); !ioutil.IsNotExist(err) {
+		t.Fatalf("expected ENOENT: %v", err)
+	}
+
+	const input1 = "input round one"
+	p := path.Join(mydir1, "myfile")
+	if err := ioutil.WriteFile(p, []byte(input1), 0644); err != nil {
+		t.Fatal(err)
+	}
+	syncFilename(t, p)
+
+	syncFolderToServer(t, "user1,user2", fs2)
+
+	buf, err := ioutil.ReadFile(path.Join(mydir2, "myfile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, e := string(buf), input1; g != e {
+		t.Errorf("wrong content: %q != %q", g, e)
+	}
+
+	checkDir(t, mydir2, map[string]fileInfoCheck{
+		"myfile": func(fi os.FileInfo) error {
+			return mustBeFileWithSize(fi, int64(len(input1)))
+		},
+	})
+}
+
+func TestInvalidateAttrOnRemoteRename(t *testing.T) {
+	ctx := libkbfs.BackgroundContextWithCancellationDelayer()
+	defer libkbfs.CleanupCancellationDelayer(ctx)
+	mnt1, mnt2, fs1, fs2, shutdown := makeTwoUserFSes(t, ctx)
+	defer shutdown()
+
+	if !mnt2.Conn.Protocol().HasInvalidate() {
+		t.Skip("Old FUSE protocol")
+	}
+
+	const input1 = "input round one"
+	mydir1 := path.Join(mnt1.Dir, PrivateName, "user1,user2", "mydir")
+	if err := ioutil.Mkdir(mydir1, 0755); err != nil {
+		t.Fatal(err)
+	}
+	a1 := path.Join(mydir1, "a")
+	if err := ioutil.WriteFile(a1, []byte(input1), 0644); err != nil {
+		t.Fatal(err)
+	}
+	syncFilename(t, a1)
+
+	syncFolderToServer(t, "user1,user2", fs2)
+
+	// Cache the attributes of the file through an open handle, which
+	// follows the node across the rename.
+	f, err := os.Open(path.Join(
+		mnt2.Dir, PrivateName, "user1,user2", "mydir", "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldCtime := statCtime(fi)
+
+	// Renaming the file changes its ctime, even though the file node
+	// itself isn't part of the remote change.
+	if err := ioutil.Rename(a1, path.Join(mydir1, "b")); err != nil {
+		t.Fatal(err)
+	}
+	syncAll(t, "user1,user2", tlf.Private, fs1)
+
+	syncFolderToServer(t, "user1,user2", fs2)
+
+	fi, err = f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newCtime := statCtime(fi); !newCtime.After(oldCtime) {
+		t.Errorf("ctime not updated after the rename: %s <= %s",
+			newCtime, oldCtime)
+	}
+}
+
+func TestInvalidateParentAttrOnRemoteChange(t *testing.T) {
+	ctx := libkbfs.BackgroundContextWithCancellationDelayer()
+	defer libkbfs.CleanupCancellationDelayer(ctx)
+	mnt1, mnt2, fs1, fs2, shutdown := makeTwoUserFSes(t, ctx)
+	defer shutdown()
+
+	if !mnt2.Conn.Protocol().HasInvalidate() {
+		t.Skip("Old FUSE protocol")
+	}
+
+	mydir1 := path.Join(mnt1.Dir, PrivateName, "user1,user2", "mydir")
+	if err := ioutil.MkdirAll(path.Join(mydir1, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	syncAll(t, "user1,user2", tlf.Private, fs1)
+
+	syncFolderToServer(t, "user1,user2", fs2)
+
+	// Cache the attributes of the grandparent of the new file.
+	d, err := os.Open(path.Join(mnt2.Dir, PrivateName, "user1,user2", "mydir"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	fi, err := d.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldSize := fi.Size()
+
+	// Creating a file in `sub` updates the entry for `sub` within
+	// `mydir`, which changes the size of `mydir` even though only
+	// `sub` is part of the remote change.
+	p := path.Join(mydir1, "sub", "myfile")
+	if err := ioutil.WriteFile(p, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	syncFilename(t, p)
+
+	syncFolderToServer(t, "user1,user2", fs2)
+
+	// Look up the current size through the other mount, which didn't
+	// cache anything.
+	fi2, err := ioutil.Stat(mydir1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi2.Size() == oldSize {
+		t.Skip("The size of the directory didn't change")
+	}
+
+	fi, err = d.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, e := fi.Size(), fi2.Size(); g != e {
+		t.Errorf("stale directory size: %d != %d", g, e)
+	}
+}
+
 func testForErrorText(t *testing.T, path string, expectedErr error,
 	fileType string) {
 	buf, err := ioutil.ReadFile(path)
@@ -9,12 +9,13 @@ package libfuse
 import "bazil.org/fuse"
 
 func getPlatformSpecificMountOptions(dir string, platformParams PlatformParams) ([]fuse.MountOption, error) {
-	return []fuse.MountOption{}, nil
+	// Serve file locks ourselves, so they exclude other devices.
+	return []fuse.MountOption{fuse.LockingFlock(), fuse.LockingPOSIX()}, nil
 }
 
 // GetPlatformSpecificMountOptionsForTest makes cross-platform tests work
 func GetPlatformSpecificMountOptionsForTest() []fuse.MountOption {
-	return []fuse.MountOption{}
+	return []fuse.MountOption{fuse.LockingFlock(), fuse.LockingPOSIX()}
 }
 
 func translatePlatformSpecificError(err error, platformParams PlatformParams) error {
@@ -0,0 +1,378 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libfuse
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"bazil.org/fuse"
+	"github.com/keybase/client/go/libkb"
+	"github.com/keybase/kbfs/libkbfs"
+	"github.com/keybase/kbfs/tlf"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// posixAttrs emulates POSIX ownership and permission bits on top of
+// KBFS's reader/writer model, for the benefit of multi-user machines
+// and tools that look at group and other bits.  It only changes how
+// entries are presented through the mount (and, for the read-only
+// bit, which writes the mount accepts); nothing about it is stored
+// in KBFS itself.
+//
+// Each entry is presented as owned by the local uid that the user
+// map file gives for its last writer, or by the mounting user if
+// there's no mapping.  Group and other get the same read and
+// execute bits as the owner, but never write.  A file can also be
+// marked read-only, by clearing its owner write bit with chmod;
+// that bit is persisted in a local state file, keyed by the TLF and
+// the path of the file within it.  Since it's keyed by path, the bit
+// only follows renames and removals made through this mount; if
+// another device renames a read-only file, the bit stays with the
+// old path, and applies to whatever file is later created there.
+type posixAttrs struct {
+	// statePath is where the read-only bits are saved, or "" if
+	// they should only be kept in memory.
+	statePath string
+	uids      map[libkb.NormalizedUsername]uint32
+
+	lock sync.RWMutex
+	// readOnly maps a TLF ID string to the set of read-only paths
+	// within that TLF.
+	readOnly map[string]map[string]bool
+
+	ownersLock sync.Mutex
+	// owners caches the uid presented for each node, so that
+	// attribute lookups don't need to fetch the node's metadata
+	// every time.
+	owners map[libkbfs.NodeID]posixOwner
+}
+
+// posixOwner is the cached owner of a node.  The last writer of an
+// entry can only change along with its ctime, so the cached uid is
+// valid as long as the ctime is unchanged.
+type posixOwner struct {
+	ctime time.Time
+	uid   uint32
+}
+
+// parseUserMap reads a user map, which has one "<username> <uid>"
+// pair per line.  Blank lines and lines starting with '#' are
+// ignored.
+func parseUserMap(r io.Reader) (
+	map[libkb.NormalizedUsername]uint32, error) {
+	uids := make(map[libkb.NormalizedUsername]uint32)
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf(
+				"line %d: expected \"<username> <uid>\", got %q",
+				lineNum, line)
+		}
+		uid, err := strconv.ParseUint(fields[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad uid %q: %v",
+				lineNum, fields[1], err)
+		}
+		uids[libkb.NewNormalizedUsername(fields[0])] = uint32(uid)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return uids, nil
+}
+
+// newPosixAttrs makes a new posixAttrs using the user map in
+// `userMapFile`, loading and saving read-only bits from `statePath`
+// if it's non-empty.
+func newPosixAttrs(userMapFile, statePath string) (
+	*posixAttrs, error) {
+	f, err := os.Open(userMapFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	uids, err := parseUserMap(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing user map %s", userMapFile)
+	}
+
+	pa := &posixAttrs{
+		statePath: statePath,
+		uids:      uids,
+		readOnly:  make(map[string]map[string]bool),
+		owners:    make(map[libkbfs.NodeID]posixOwner),
+	}
+	if statePath == "" {
+		return pa, nil
+	}
+
+	buf, err := ioutil.ReadFile(statePath)
+	switch {
+	case os.IsNotExist(err):
+		return pa, nil
+	case err != nil:
+		return nil, err
+	}
+	var state map[string][]string
+	err = json.Unmarshal(buf, &state)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing state file %s", statePath)
+	}
+	for tlfID, paths := range state {
+		set := make(map[string]bool, len(paths))
+		for _, p := range paths {
+			set[p] = true
+		}
+		pa.readOnly[tlfID] = set
+	}
+	return pa, nil
+}
+
+// uid returns the local uid for the given KBFS user.
+func (pa *posixAttrs) uid(user libkb.NormalizedUsername) uint32 {
+	if uid, ok := pa.uids[user]; ok {
+		return uid
+	}
+	return uint32(os.Getuid())
+}
+
+// mode fills in the group and other bits of `mode` from the owner's
+// read and execute bits, and clears the owner's write bit if
+// `readOnly` is true.
+func (pa *posixAttrs) mode(mode os.FileMode, readOnly bool) os.FileMode {
+	if readOnly {
+		mode &^= 0200
+	}
+	rx := mode & 0500
+	return mode | rx>>3 | rx>>6
+}
+
+func (pa *posixAttrs) isReadOnly(tlfID tlf.ID, p string) bool {
+	pa.lock.RLock()
+	defer pa.lock.RUnlock()
+	return pa.readOnly[tlfID.String()][p]
+}
+
+// hasReadOnly returns whether any file in the given TLF is marked
+// read-only.
+func (pa *posixAttrs) hasReadOnly(tlfID tlf.ID) bool {
+	pa.lock.RLock()
+	defer pa.lock.RUnlock()
+	return len(pa.readOnly[tlfID.String()]) > 0
+}
+
+// cachedOwner returns the cached uid of the given node, if it was
+// cached with the given ctime.
+func (pa *posixAttrs) cachedOwner(
+	id libkbfs.NodeID, ctime time.Time) (uint32, bool) {
+	pa.ownersLock.Lock()
+	defer pa.ownersLock.Unlock()
+	o, ok := pa.owners[id]
+	if !ok || !o.ctime.Equal(ctime) {
+		return 0, false
+	}
+	return o.uid, true
+}
+
+func (pa *posixAttrs) cacheOwner(
+	id libkbfs.NodeID, ctime time.Time, uid uint32) {
+	pa.ownersLock.Lock()
+	defer pa.ownersLock.Unlock()
+	if pa.owners == nil {
+		pa.owners = make(map[libkbfs.NodeID]posixOwner)
+	}
+	pa.owners[id] = posixOwner{ctime, uid}
+}
+
+// forgetOwner drops the cached owner of a node that the kernel has
+// forgotten.
+func (pa *posixAttrs) forgetOwner(id libkbfs.NodeID) {
+	pa.ownersLock.Lock()
+	defer pa.ownersLock.Unlock()
+	delete(pa.owners, id)
+}
+
+// saveLocked writes out the current read-only bits, if there's a
+// state file.  pa.lock must be held by the caller.
+func (pa *posixAttrs) saveLocked() error {
+	if pa.statePath == "" {
+		return nil
+	}
+	state := make(map[string][]string, len(pa.readOnly))
+	for tlfID, set := range pa.readOnly {
+		paths := make([]string, 0, len(set))
+		for p := range set {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+		state[tlfID] = paths
+	}
+	buf, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temp file and rename it into place, so a crash
+	// never leaves a partial state file behind.
+	err = os.MkdirAll(filepath.Dir(pa.statePath), 0700)
+	if err != nil {
+		return err
+	}
+	tmpPath := pa.statePath + ".tmp"
+	err = ioutil.WriteFile(tmpPath, buf, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, pa.statePath)
+}
+
+// setReadOnly marks or unmarks the file at path `p` in the given TLF
+// as read-only.
+func (pa *posixAttrs) setReadOnly(tlfID tlf.ID, p string, ro bool) error {
+	pa.lock.Lock()
+	defer pa.lock.Unlock()
+	id := tlfID.String()
+	if pa.readOnly[id][p] == ro {
+		return nil
+	}
+	if ro {
+		if pa.readOnly[id] == nil {
+			pa.readOnly[id] = make(map[string]bool)
+		}
+		pa.readOnly[id][p] = true
+	} else {
+		delete(pa.readOnly[id], p)
+		if len(pa.readOnly[id]) == 0 {
+			delete(pa.readOnly, id)
+		}
+	}
+	return pa.saveLocked()
+}
+
+// rename moves the read-only bits for `oldPath`, and for anything
+// under it, to `newPath`.  Any bits already set for `newPath` are
+// dropped, since the rename replaced that entry.
+func (pa *posixAttrs) rename(tlfID tlf.ID, oldPath, newPath string) error {
+	pa.lock.Lock()
+	defer pa.lock.Unlock()
+	set := pa.readOnly[tlfID.String()]
+	if len(set) == 0 || oldPath == newPath {
+		return nil
+	}
+	moved := make(map[string]string)
+	for p := range set {
+		switch {
+		case p == oldPath:
+			moved[p] = newPath
+		case strings.HasPrefix(p, oldPath+"/"):
+			moved[p] = newPath + strings.TrimPrefix(p, oldPath)
+		}
+	}
+	changed := pa.removeLocked(set, newPath)
+	for oldP, newP := range moved {
+		delete(set, oldP)
+		set[newP] = true
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return pa.saveLocked()
+}
+
+// removeLocked drops the read-only bits for `p`, and for anything
+// under it, from `set`.  pa.lock must be held by the caller.
+func (pa *posixAttrs) removeLocked(set map[string]bool, p string) bool {
+	changed := false
+	for setP := range set {
+		if setP == p || strings.HasPrefix(setP, p+"/") {
+			delete(set, setP)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// remove drops the read-only bits for `p`, and for anything under
+// it.
+func (pa *posixAttrs) remove(tlfID tlf.ID, p string) error {
+	pa.lock.Lock()
+	defer pa.lock.Unlock()
+	id := tlfID.String()
+	if !pa.removeLocked(pa.readOnly[id], p) {
+		return nil
+	}
+	if len(pa.readOnly[id]) == 0 {
+		delete(pa.readOnly, id)
+	}
+	return pa.saveLocked()
+}
+
+// fillAttr sets the emulated owner and permission bits for `node`
+// in `a`, which must already have its KBFS mode and ctime filled
+// in.  The node's metadata is only fetched if its owner isn't
+// cached, or if its path is needed to look up its read-only bit.
+func (pa *posixAttrs) fillAttr(ctx context.Context, config libkbfs.Config,
+	node libkbfs.Node, isFile bool, a *fuse.Attr) error {
+	tlfID := node.GetFolderBranch().Tlf
+	uid, ok := pa.cachedOwner(node.GetID(), a.Ctime)
+	readOnly := false
+	if !ok || (isFile && pa.hasReadOnly(tlfID)) {
+		md, err := config.KBFSOps().GetNodeMetadata(ctx, node)
+		if err != nil {
+			return err
+		}
+		uid = pa.uid(md.LastWriterUnverified)
+		pa.cacheOwner(node.GetID(), a.Ctime, uid)
+		readOnly = isFile && pa.isReadOnly(tlfID, md.PathFromRoot)
+	}
+	a.Uid = uid
+	a.Gid = uint32(os.Getgid())
+	a.Mode = pa.mode(a.Mode, readOnly)
+	return nil
+}
+
+// nodePath returns the path of `node` within its TLF.
+func (pa *posixAttrs) nodePath(ctx context.Context, config libkbfs.Config,
+	node libkbfs.Node) (string, error) {
+	md, err := config.KBFSOps().GetNodeMetadata(ctx, node)
+	if err != nil {
+		return "", err
+	}
+	return md.PathFromRoot, nil
+}
+
+// childPath returns the path of the child `name` of `dir`, within
+// the TLF.
+func (pa *posixAttrs) childPath(ctx context.Context, config libkbfs.Config,
+	dir libkbfs.Node, name string) (string, error) {
+	p, err := pa.nodePath(ctx, config, dir)
+	if err != nil {
+		return "", err
+	}
+	if p == "" {
+		return name, nil
+	}
+	return p + "/" + name, nil
+}
@@ -0,0 +1,129 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libfuse
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"bazil.org/fuse"
+	"github.com/keybase/client/go/libkb"
+	"github.com/keybase/kbfs/libkbfs"
+	"github.com/keybase/kbfs/tlf"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func TestParseUserMap(t *testing.T) {
+	uids, err := parseUserMap(strings.NewReader(`
+# A comment.
+alice 1001
+  Bob   1002
+`))
+	require.NoError(t, err)
+	require.Equal(t, map[libkb.NormalizedUsername]uint32{
+		"alice": 1001,
+		"bob":   1002,
+	}, uids)
+
+	_, err = parseUserMap(strings.NewReader("alice"))
+	require.Error(t, err)
+	_, err = parseUserMap(strings.NewReader("alice -1"))
+	require.Error(t, err)
+}
+
+func TestPosixAttrsMode(t *testing.T) {
+	pa := &posixAttrs{}
+	require.Equal(t, os.FileMode(0644), pa.mode(0600, false))
+	require.Equal(t, os.FileMode(0444), pa.mode(0600, true))
+	require.Equal(t, os.FileMode(0755), pa.mode(0700, false))
+	require.Equal(t, os.FileMode(0555), pa.mode(0500, false))
+	require.Equal(t, os.ModeDir|0755, pa.mode(os.ModeDir|0700, false))
+}
+
+func TestPosixAttrsReadOnlyPersistence(t *testing.T) {
+	tempdir, err := ioutil.TempDir(os.TempDir(), "posix_attrs")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempdir)
+	userMapFile := filepath.Join(tempdir, "users")
+	err = ioutil.WriteFile(userMapFile, []byte("alice 1001\n"), 0600)
+	require.NoError(t, err)
+	statePath := filepath.Join(tempdir, "state", "readonly.json")
+
+	pa, err := newPosixAttrs(userMapFile, statePath)
+	require.NoError(t, err)
+	require.Equal(t, uint32(1001), pa.uid("alice"))
+	require.Equal(t, uint32(os.Getuid()), pa.uid("bob"))
+
+	id := tlf.FakeID(1, tlf.Private)
+	require.NoError(t, pa.setReadOnly(id, "a/b", true))
+	require.NoError(t, pa.setReadOnly(id, "a/c", true))
+	require.NoError(t, pa.setReadOnly(id, "d", true))
+	require.NoError(t, pa.setReadOnly(id, "d", false))
+	require.True(t, pa.isReadOnly(id, "a/b"))
+	require.False(t, pa.isReadOnly(id, "d"))
+	require.False(t, pa.isReadOnly(tlf.FakeID(2, tlf.Private), "a/b"))
+
+	t.Log("Renaming a directory moves its children's bits")
+	require.NoError(t, pa.rename(id, "a", "e"))
+	require.False(t, pa.isReadOnly(id, "a/b"))
+	require.True(t, pa.isReadOnly(id, "e/b"))
+
+	t.Log("Removing a file drops its bit")
+	require.NoError(t, pa.remove(id, "e/c"))
+	require.False(t, pa.isReadOnly(id, "e/c"))
+
+	t.Log("Bits survive a restart")
+	pa2, err := newPosixAttrs(userMapFile, statePath)
+	require.NoError(t, err)
+	require.True(t, pa2.isReadOnly(id, "e/b"))
+	require.False(t, pa2.isReadOnly(id, "e/c"))
+}
+
+func TestPosixAttrsOwnerCache(t *testing.T) {
+	ctx := context.Background()
+	config := libkbfs.MakeTestConfigOrBust(t, "alice")
+	defer libkbfs.CheckConfigAndShutdown(ctx, t, config)
+	rootNode := libkbfs.GetRootNodeOrBust(
+		ctx, t, config, "alice", tlf.Private)
+	fileNode, _, err := config.KBFSOps().CreateFile(
+		ctx, rootNode, "a", false, libkbfs.NoExcl)
+	require.NoError(t, err)
+
+	pa := &posixAttrs{
+		uids:     map[libkb.NormalizedUsername]uint32{"alice": 1001},
+		readOnly: make(map[string]map[string]bool),
+	}
+	ctime := time.Unix(1, 0)
+	a := fuse.Attr{Mode: 0600, Ctime: ctime}
+	require.NoError(t, pa.fillAttr(ctx, config, fileNode, true, &a))
+	require.Equal(t, uint32(1001), a.Uid)
+	require.Equal(t, os.FileMode(0644), a.Mode)
+
+	t.Log("The owner is cached while the ctime is unchanged")
+	pa.uids["alice"] = 1002
+	a = fuse.Attr{Mode: 0600, Ctime: ctime}
+	require.NoError(t, pa.fillAttr(ctx, config, fileNode, true, &a))
+	require.Equal(t, uint32(1001), a.Uid)
+
+	t.Log("A new ctime looks the owner up again")
+	a = fuse.Attr{Mode: 0600, Ctime: ctime.Add(time.Second)}
+	require.NoError(t, pa.fillAttr(ctx, config, fileNode, true, &a))
+	require.Equal(t, uint32(1002), a.Uid)
+
+	t.Log("Read-only bits are still applied to cached owners")
+	require.NoError(t, pa.setReadOnly(
+		fileNode.GetFolderBranch().Tlf, "a", true))
+	a = fuse.Attr{Mode: 0600, Ctime: ctime.Add(time.Second)}
+	require.NoError(t, pa.fillAttr(ctx, config, fileNode, true, &a))
+	require.Equal(t, os.FileMode(0444), a.Mode)
+
+	pa.forgetOwner(fileNode.GetID())
+	require.Len(t, pa.owners, 0)
+}
@@ -0,0 +1,70 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libfuse
+
+import (
+	"syscall"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/keybase/kbfs/libfs"
+	"github.com/keybase/kbfs/libkbfs"
+	"golang.org/x/net/context"
+)
+
+// QuotaReclamationPolicyFile is a special file used to set the quota
+// reclamation policy of a TLF.
+type QuotaReclamationPolicyFile struct {
+	folder *Folder
+}
+
+var _ fs.Node = (*QuotaReclamationPolicyFile)(nil)
+
+// Attr implements the fs.Node interface for QuotaReclamationPolicyFile.
+func (f *QuotaReclamationPolicyFile) Attr(
+	ctx context.Context, a *fuse.Attr) error {
+	a.Size = 0
+	a.Mode = 0222
+	return nil
+}
+
+var _ fs.Handle = (*QuotaReclamationPolicyFile)(nil)
+
+var _ fs.HandleWriter = (*QuotaReclamationPolicyFile)(nil)
+
+// Write implements the fs.HandleWriter interface for
+// QuotaReclamationPolicyFile.
+func (f *QuotaReclamationPolicyFile) Write(ctx context.Context,
+	req *fuse.WriteRequest, resp *fuse.WriteResponse) (err error) {
+	f.folder.fs.log.CDebugf(ctx, "QuotaReclamationPolicyFile Write")
+	defer func() { err = f.folder.processError(ctx, libkbfs.WriteMode, err) }()
+	if req.Offset != 0 {
+		// The whole JSON object must come in a single write.
+		return fuse.Errno(syscall.EINVAL)
+	}
+
+	err = libfs.SetQuotaReclamationPolicy(
+		f.folder.fs.config, f.folder.getFolderBranch(), req.Data)
+	if err != nil {
+		return err
+	}
+
+	resp.Size = len(req.Data)
+	return nil
+}
+
+// NewReclaimQuotaDryRunFile returns a special read file that
+// describes what the next quota reclamation of the TLF would delete.
+func NewReclaimQuotaDryRunFile(
+	folder *Folder, entryValid *time.Duration) *SpecialReadFile {
+	*entryValid = 0
+	return &SpecialReadFile{
+		read: func(ctx context.Context) ([]byte, time.Time, error) {
+			return libfs.GetEncodedQuotaReclamationDryRun(
+				ctx, folder.fs.config, folder.getFolderBranch())
+		},
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libfuse
+
+import (
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/keybase/kbfs/libfs"
+	"github.com/keybase/kbfs/libkbfs"
+	"golang.org/x/net/context"
+)
+
+// RestoreFile is a special file used to restore a file or directory
+// from a past revision of its TLF.
+type RestoreFile struct {
+	folder *Folder
+	dir    libkbfs.Node
+	// name is the entry in dir to restore; if empty, dir itself is
+	// restored.
+	name string
+}
+
+var _ fs.Node = (*RestoreFile)(nil)
+
+// Attr implements the fs.Node interface for RestoreFile.
+func (f *RestoreFile) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Size = 0
+	a.Mode = 0222
+	return nil
+}
+
+var _ fs.Handle = (*RestoreFile)(nil)
+
+var _ fs.HandleWriter = (*RestoreFile)(nil)
+
+// Write implements the fs.HandleWriter interface for RestoreFile.
+func (f *RestoreFile) Write(ctx context.Context, req *fuse.WriteRequest,
+	resp *fuse.WriteResponse) (err error) {
+	f.folder.fs.log.CDebugf(ctx, "RestoreFile (name=%s) Write", f.name)
+	defer func() { err = f.folder.processError(ctx, libkbfs.WriteMode, err) }()
+	if len(req.Data) == 0 {
+		return nil
+	}
+
+	err = libfs.RestoreFromRevision(
+		ctx, f.folder.fs.config, f.dir, f.name, req.Data)
+	if err != nil {
+		return err
+	}
+
+	resp.Size = len(req.Data)
+	return nil
+}
@@ -21,6 +21,8 @@ func handleCommonSpecialFile(
 		return NewErrorFile(fs, entryValid)
 	case libfs.MetricsFileName:
 		return NewMetricsFile(fs, entryValid)
+	case libfs.PrometheusMetricsFileName:
+		return NewPrometheusMetricsFile(fs, entryValid)
 	case libfs.ProfileListDirName:
 		return ProfileList{}
 	case libfs.ResetCachesFileName:
@@ -166,6 +168,56 @@ func handleTLFSpecialFile(
 			folder: folder,
 			action: libfs.SyncDisable,
 		}
+
+	case libfs.SyncPathsFileName:
+		return &SyncPathsFile{
+			folder: folder,
+		}
+
+	case libfs.DiskCacheSettingsFileName:
+		return &DiskCacheSettingsFile{
+			folder: folder,
+		}
+
+	case libfs.QuotaReclamationPolicyFileName:
+		return &QuotaReclamationPolicyFile{
+			folder: folder,
+		}
+
+	case libfs.ConflictRenameTemplateFileName:
+		return &ConflictRenameTemplateFile{
+			folder: folder,
+		}
+
+	case libfs.DisableAutoCRFileName:
+		return &AutoCRFile{
+			folder: folder,
+		}
+
+	case libfs.EnableAutoCRFileName:
+		return &AutoCRFile{
+			folder: folder,
+			enable: true,
+		}
+
+	case libfs.ResolveConflictsFileName:
+		return &ResolveConflictsFile{
+			folder: folder,
+		}
+
+	case libfs.ReclaimQuotaDryRunFileName:
+		return NewReclaimQuotaDryRunFile(folder, entryValid)
+
+	case libfs.DeletedEntriesDirName:
+		*entryValid = 0
+		return &DeletedEntriesDir{
+			folder: folder,
+		}
+
+	case libfs.UndeleteFileName:
+		return &UndeleteFile{
+			folder: folder,
+		}
 	}
 
 	return nil
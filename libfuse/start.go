@@ -7,6 +7,8 @@ package libfuse
 import (
 	"os"
 	"path"
+	"path/filepath"
+	"sync"
 
 	"github.com/keybase/client/go/libkb"
 	"github.com/keybase/client/go/logger"
@@ -16,6 +18,7 @@ import (
 	"github.com/keybase/kbfs/libfs"
 	"github.com/keybase/kbfs/libgit"
 	"github.com/keybase/kbfs/libkbfs"
+	"github.com/keybase/kbfs/search"
 	"github.com/keybase/kbfs/simplefs"
 	"golang.org/x/net/context"
 )
@@ -30,13 +33,39 @@ type StartOptions struct {
 	MountErrorIsFatal bool
 	SkipMount         bool
 	MountPoint        string
+	// PosixUserMapFile, if non-empty, turns on POSIX ownership and
+	// permission emulation, using the given file to map KBFS
+	// usernames to local uids.  See posixAttrs.
+	PosixUserMapFile string
+	// EventStreamSocket, if non-empty, is the path of a Unix socket
+	// on which to serve a stream of TLF change events.  See
+	// libfs.EventStream.
+	EventStreamSocket string
 }
 
+// posixStateFileName is the name of the file, under the storage
+// root, where read-only bits are kept when POSIX emulation is on.
+const posixStateFileName = "kbfs_fuse_readonly.json"
+
 func startMounting(ctx context.Context,
 	kbCtx libkbfs.Context, config libkbfs.Config, options StartOptions,
 	log logger.Logger, mi *libfs.MountInterrupter) error {
 	log.CDebugf(ctx, "Mounting: %q", options.MountPoint)
 
+	var posix *posixAttrs
+	if options.PosixUserMapFile != "" {
+		statePath := ""
+		if options.KbfsParams.StorageRoot != "" {
+			statePath = filepath.Join(
+				options.KbfsParams.StorageRoot, posixStateFileName)
+		}
+		var err error
+		posix, err = newPosixAttrs(options.PosixUserMapFile, statePath)
+		if err != nil {
+			return err
+		}
+	}
+
 	var mounter = &mounter{
 		options: options,
 		log:     log,
@@ -49,6 +78,7 @@ func startMounting(ctx context.Context,
 
 	log.CDebugf(ctx, "Creating filesystem")
 	fs := NewFS(config, mounter.c, options.KbfsParams.Debug, options.PlatformParams)
+	fs.posix = posix
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 	ctx = context.WithValue(ctx, libfs.CtxAppIDKey, fs)
@@ -85,11 +115,33 @@ func startMounting(ctx context.Context,
 
 // Start the filesystem
 func Start(options StartOptions, kbCtx libkbfs.Context) *libfs.Error {
-	// Hook simplefs implementation in.
+	// Hook simplefs implementation in, sharing one search indexer
+	// across connections if content search is enabled.
+	var indexerLock sync.Mutex
+	var indexer *search.Indexer
 	createSimpleFS := func(
 		libkbfsCtx libkbfs.Context, config libkbfs.Config) (rpc.Protocol, error) {
-		return keybase1.SimpleFSProtocol(
-			simplefs.NewSimpleFS(libkbfsCtx.GetGlobalContext(), config)), nil
+		if !options.KbfsParams.EnableSearchIndex {
+			return keybase1.SimpleFSProtocol(
+				simplefs.NewSimpleFS(libkbfsCtx.GetGlobalContext(), config)), nil
+		}
+		indexerLock.Lock()
+		defer indexerLock.Unlock()
+		if indexer == nil {
+			dir := ""
+			if options.KbfsParams.StorageRoot != "" {
+				dir = filepath.Join(
+					options.KbfsParams.StorageRoot, search.IndexFolderName)
+			}
+			var err error
+			indexer, err = search.NewIndexer(
+				config, dir, search.DefaultMaxFileSize)
+			if err != nil {
+				return rpc.Protocol{}, err
+			}
+		}
+		return keybase1.SimpleFSProtocol(simplefs.NewSimpleFSWithIndexer(
+			libkbfsCtx.GetGlobalContext(), config, indexer)), nil
 	}
 	// Hook git implementation in.
 	shutdownGit := func() {}
@@ -131,6 +183,22 @@ func Start(options StartOptions, kbCtx libkbfs.Context) *libfs.Error {
 		return libfs.InitError(err.Error())
 	}
 	defer libkbfs.Shutdown()
+	defer func() {
+		indexerLock.Lock()
+		defer indexerLock.Unlock()
+		if indexer != nil {
+			indexer.Shutdown()
+		}
+	}()
+
+	if options.EventStreamSocket != "" {
+		shutdownEvents, err := libfs.ServeEventStream(
+			config, options.EventStreamSocket)
+		if err != nil {
+			return libfs.InitError(err.Error())
+		}
+		defer shutdownEvents()
+	}
 
 	// Report "startup successful" to the supervisor (currently just systemd on
 	// Linux). This isn't necessary for correctness, but it allows commands
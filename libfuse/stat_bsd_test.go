@@ -0,0 +1,18 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+// +build darwin freebsd
+
+package libfuse
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+func statCtime(fi os.FileInfo) time.Time {
+	st := fi.Sys().(*syscall.Stat_t)
+	return time.Unix(st.Ctimespec.Unix())
+}
@@ -0,0 +1,54 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libfuse
+
+import (
+	"syscall"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/keybase/kbfs/libfs"
+	"github.com/keybase/kbfs/libkbfs"
+	"golang.org/x/net/context"
+)
+
+// SyncPathsFile is a special file used to set the paths of a TLF
+// that are synced for offline use.
+type SyncPathsFile struct {
+	folder *Folder
+}
+
+var _ fs.Node = (*SyncPathsFile)(nil)
+
+// Attr implements the fs.Node interface for SyncPathsFile.
+func (f *SyncPathsFile) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Size = 0
+	a.Mode = 0222
+	return nil
+}
+
+var _ fs.Handle = (*SyncPathsFile)(nil)
+
+var _ fs.HandleWriter = (*SyncPathsFile)(nil)
+
+// Write implements the fs.HandleWriter interface for SyncPathsFile.
+func (f *SyncPathsFile) Write(ctx context.Context, req *fuse.WriteRequest,
+	resp *fuse.WriteResponse) (err error) {
+	f.folder.fs.log.CDebugf(ctx, "SyncPathsFile Write")
+	defer func() { err = f.folder.processError(ctx, libkbfs.WriteMode, err) }()
+	if req.Offset != 0 {
+		// The whole list of paths must come in a single write.
+		return fuse.Errno(syscall.EINVAL)
+	}
+
+	err = libfs.SetSyncPaths(ctx, f.folder.fs.config,
+		f.folder.getFolderBranch(), f.folder.h, req.Data)
+	if err != nil {
+		return err
+	}
+
+	resp.Size = len(req.Data)
+	return nil
+}
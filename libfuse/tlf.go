@@ -284,13 +284,14 @@ func (tlf *TLF) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
 	return dir.Remove(ctx, req)
 }
 
-// ReadDirAll implements the fs.NodeReadDirAller interface for TLF.
-func (tlf *TLF) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+// ReadDirPage implements the fs.HandleReadDirPager interface for TLF.
+func (tlf *TLF) ReadDirPage(ctx context.Context, after string,
+	maxEntries int) ([]fuse.Dirent, error) {
 	dir, exitEarly, err := tlf.loadDirAllowNonexistent(ctx)
 	if err != nil || exitEarly {
 		return nil, err
 	}
-	return dir.ReadDirAll(ctx)
+	return dir.ReadDirPage(ctx, after, maxEntries)
 }
 
 // Forget kernel reference to this node.
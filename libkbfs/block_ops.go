@@ -5,6 +5,8 @@
 package libkbfs
 
 import (
+	"sync"
+
 	"github.com/keybase/kbfs/kbfsblock"
 	"github.com/keybase/kbfs/kbfscrypto"
 	"github.com/keybase/kbfs/tlf"
@@ -30,6 +32,11 @@ type BlockOpsStandard struct {
 	config blockOpsConfig
 	log    traceLogger
 	queue  *blockRetrievalQueue
+	// recent tracks the blocks most recently fetched on demand,
+	// for warming up the caches later.  It's nil unless cache
+	// warm-up is enabled.
+	recentLock sync.RWMutex
+	recent     *recentBlockRecorder
 }
 
 var _ BlockOps = (*BlockOpsStandard)(nil)
@@ -53,7 +60,13 @@ func NewBlockOpsStandard(config blockOpsConfig,
 
 // Get implements the BlockOps interface for BlockOpsStandard.
 func (b *BlockOpsStandard) Get(ctx context.Context, kmd KeyMetadata,
-	blockPtr BlockPointer, block Block, lifetime BlockCacheLifetime) error {
+	blockPtr BlockPointer, block Block, lifetime BlockCacheLifetime) (
+	err error) {
+	// Only trace block gets made on behalf of a traced operation.
+	ctx, span := startSpan(ctx, nil, "BlockOps.Get")
+	defer func() { span.Finish(err) }()
+	span.SetAttribute("block", blockPtr.ID)
+
 	// Check the journal explicitly first, so we don't get stuck in
 	// the block-fetching queue.
 	if journalBServer, ok := b.config.BlockServer().(journalBlockServer); ok {
@@ -63,6 +76,7 @@ func (b *BlockOpsStandard) Get(ctx context.Context, kmd KeyMetadata,
 			return err
 		}
 		if found {
+			span.SetAttribute("source", "journal")
 			return assembleBlock(
 				ctx, b.config.keyGetter(), b.config.Codec(),
 				b.config.cryptoPure(), kmd, blockPtr, block, data, serverHalf)
@@ -73,13 +87,34 @@ func (b *BlockOpsStandard) Get(ctx context.Context, kmd KeyMetadata,
 
 	errCh := b.queue.Request(ctx, defaultOnDemandRequestPriority, kmd,
 		blockPtr, block, lifetime)
-	err := <-errCh
+	err = <-errCh
 
 	b.log.LazyTrace(ctx, "BOps: Request fulfilled for %s (err=%v)", blockPtr.ID, err)
 
+	if recent := b.getRecentBlockRecorder(); err == nil && recent != nil {
+		recent.record(kmd, blockPtr, block)
+	}
 	return err
 }
 
+// recordRecentBlocks makes `b` track up to `maxEntries` of the blocks
+// most recently fetched on demand, if it isn't already.
+func (b *BlockOpsStandard) recordRecentBlocks(maxEntries int) {
+	b.recentLock.Lock()
+	defer b.recentLock.Unlock()
+	if b.recent == nil {
+		b.recent = newRecentBlockRecorder(maxEntries)
+	}
+}
+
+// getRecentBlockRecorder returns the recorder of recently fetched
+// blocks, or nil if `b` isn't recording them.
+func (b *BlockOpsStandard) getRecentBlockRecorder() *recentBlockRecorder {
+	b.recentLock.RLock()
+	defer b.recentLock.RUnlock()
+	return b.recent
+}
+
 // GetEncodedSize implements the BlockOps interface for
 // BlockOpsStandard.
 func (b *BlockOpsStandard) GetEncodedSize(ctx context.Context, kmd KeyMetadata,
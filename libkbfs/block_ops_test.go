@@ -340,6 +340,41 @@ func TestBlockOpsGetSuccess(t *testing.T) {
 	require.Equal(t, block, decryptedBlock)
 }
 
+// TestBlockOpsGetRecordsRecentBlocks checks that
+// BlockOpsStandard.Get() only records the blocks it fetches once
+// recording is turned on for cache warm-up.
+func TestBlockOpsGetRecordsRecentBlocks(t *testing.T) {
+	config := makeTestBlockOpsConfig(t)
+	bops := NewBlockOpsStandard(config, testBlockRetrievalWorkerQueueSize,
+		testPrefetchWorkerQueueSize)
+	defer bops.Shutdown()
+
+	tlfID := tlf.FakeID(0, tlf.Private)
+	kmd := makeFakeKeyMetadata(tlfID, kbfsmd.FirstValidKeyGen)
+
+	ctx := context.Background()
+	id, _, readyBlockData, err := bops.Ready(ctx, kmd, &FileBlock{})
+	require.NoError(t, err)
+	bCtx := kbfsblock.MakeFirstContext(
+		keybase1.MakeTestUID(1).AsUserOrTeam(), keybase1.BlockType_DATA)
+	err = config.bserver.Put(ctx, tlfID, id, bCtx,
+		readyBlockData.buf, readyBlockData.serverHalf)
+	require.NoError(t, err)
+	ptr := BlockPointer{ID: id, DataVer: FirstValidDataVer,
+		KeyGen: kbfsmd.FirstValidKeyGen, Context: bCtx}
+
+	err = bops.Get(ctx, kmd, ptr, &FileBlock{}, NoCacheEntry)
+	require.NoError(t, err)
+	require.Nil(t, bops.getRecentBlockRecorder())
+
+	bops.recordRecentBlocks(defaultCacheWarmupMaxEntries)
+	err = bops.Get(ctx, kmd, ptr, &FileBlock{}, NoCacheEntry)
+	require.NoError(t, err)
+	entries := bops.getRecentBlockRecorder().entries()
+	require.Len(t, entries, 1)
+	require.Equal(t, id, entries[0].Ptr.ID)
+}
+
 // TestBlockOpsReadySuccess checks that BlockOpsStandard.Get() fails
 // if it can't retrieve the block from the server.
 func TestBlockOpsGetFailServerGet(t *testing.T) {
@@ -306,7 +306,12 @@ func (brq *blockRetrievalQueue) request(ctx context.Context,
 	}
 
 	// Check caches before locking the mutex.
+	_, span := startSpan(ctx, nil, "BlockRetrievalQueue.Request")
+	defer span.Finish(nil)
+	span.SetAttribute("block", ptr.ID)
+	span.SetAttribute("priority", priority)
 	prefetchStatus, err := brq.checkCaches(ctx, kmd, ptr, block)
+	span.SetAttribute("cached", err == nil)
 	if err == nil {
 		if doPrefetch {
 			brq.Prefetcher().ProcessBlockForPrefetch(ctx, ptr, block, kmd,
@@ -439,8 +444,10 @@ func (brq *blockRetrievalQueue) FinalizeRequest(
 		// We treat this request as not having been prefetched, because the
 		// only way to get here is if the request wasn't already cached.
 		// Need to call with context.Background() because the retrieval's
-		// context will be canceled as soon as this method returns.
-		brq.Prefetcher().ProcessBlockForPrefetch(context.Background(),
+		// context will be canceled as soon as this method returns.  Keep
+		// the retrieval's span, though, so the prefetches can be traced.
+		brq.Prefetcher().ProcessBlockForPrefetch(contextWithSpan(
+			context.Background(), spanFromContext(retrieval.ctx)),
 			retrieval.blockPtr, block, retrieval.kmd, retrieval.priority,
 			retrieval.cacheLifetime, NoPrefetch)
 	} else {
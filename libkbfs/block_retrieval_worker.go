@@ -77,7 +77,14 @@ func (brw *blockRetrievalWorker) HandleRequest() (err error) {
 		block = retrieval.requests[0].block.NewEmpty()
 	}()
 
-	return brw.getBlock(retrieval.ctx, retrieval.kmd, retrieval.blockPtr, block)
+	// The retrieval's context carries the values of its first
+	// request, so this span becomes a child of that request's span.
+	ctx, span := startSpan(
+		retrieval.ctx, nil, "BlockRetrievalWorker.Fetch")
+	defer func() { span.Finish(err) }()
+	span.SetAttribute("block", retrieval.blockPtr.ID)
+
+	return brw.getBlock(ctx, retrieval.kmd, retrieval.blockPtr, block)
 }
 
 // Shutdown shuts down the blockRetrievalWorker once its current work is done.
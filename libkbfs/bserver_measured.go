@@ -8,22 +8,50 @@ import (
 	"github.com/keybase/client/go/protocol/keybase1"
 	"github.com/keybase/kbfs/kbfsblock"
 	"github.com/keybase/kbfs/kbfscrypto"
+	"github.com/keybase/kbfs/metricsutil"
 	"github.com/keybase/kbfs/tlf"
 	metrics "github.com/rcrowley/go-metrics"
 	"golang.org/x/net/context"
 )
 
+// tlfTypeTimers holds one timer per TLF type for a single metric
+// name, with the type in a `tlf_type` label.  Calls for an unknown
+// TLF type are recorded under `tlf_type="unknown"`.
+type tlfTypeTimers map[tlf.Type]metrics.Timer
+
+func newTLFTypeTimers(name string, r metrics.Registry) tlfTypeTimers {
+	timers := tlfTypeTimers{
+		tlf.Unknown: metrics.GetOrRegisterTimer(
+			metricsutil.NameWithLabels(name, "tlf_type", "unknown"), r),
+	}
+	for _, t := range []tlf.Type{tlf.Private, tlf.Public, tlf.SingleTeam} {
+		timers[t] = metrics.GetOrRegisterTimer(
+			metricsutil.NameWithLabels(name, "tlf_type", t.String()), r)
+	}
+	return timers
+}
+
+// Time runs f, recording its duration under the timer for the given
+// TLF type.
+func (timers tlfTypeTimers) Time(t tlf.Type, f func()) {
+	timer, ok := timers[t]
+	if !ok {
+		timer = timers[tlf.Unknown]
+	}
+	timer.Time(f)
+}
+
 // BlockServerMeasured delegates to another BlockServer instance but
 // also keeps track of stats.
 type BlockServerMeasured struct {
 	delegate                    BlockServer
-	getTimer                    metrics.Timer
-	putTimer                    metrics.Timer
-	putAgainTimer               metrics.Timer
-	addBlockReferenceTimer      metrics.Timer
-	removeBlockReferencesTimer  metrics.Timer
-	archiveBlockReferencesTimer metrics.Timer
-	isUnflushedTimer            metrics.Timer
+	getTimer                    tlfTypeTimers
+	putTimer                    tlfTypeTimers
+	putAgainTimer               tlfTypeTimers
+	addBlockReferenceTimer      tlfTypeTimers
+	removeBlockReferencesTimer  tlfTypeTimers
+	archiveBlockReferencesTimer tlfTypeTimers
+	isUnflushedTimer            tlfTypeTimers
 }
 
 var _ BlockServer = BlockServerMeasured{}
@@ -31,16 +59,18 @@ var _ BlockServer = BlockServerMeasured{}
 // NewBlockServerMeasured creates and returns a new
 // BlockServerMeasured instance with the given delegate and registry.
 func NewBlockServerMeasured(delegate BlockServer, r metrics.Registry) BlockServerMeasured {
-	getTimer := metrics.GetOrRegisterTimer("BlockServer.Get", r)
-	putTimer := metrics.GetOrRegisterTimer("BlockServer.Put", r)
-	addBlockReferenceTimer := metrics.GetOrRegisterTimer("BlockServer.AddBlockReference", r)
-	removeBlockReferencesTimer := metrics.GetOrRegisterTimer("BlockServer.RemoveBlockReferences", r)
-	archiveBlockReferencesTimer := metrics.GetOrRegisterTimer("BlockServer.ArchiveBlockReferences", r)
-	isUnflushedTimer := metrics.GetOrRegisterTimer("BlockServer.IsUnflushed", r)
+	getTimer := newTLFTypeTimers("BlockServer.Get", r)
+	putTimer := newTLFTypeTimers("BlockServer.Put", r)
+	putAgainTimer := newTLFTypeTimers("BlockServer.PutAgain", r)
+	addBlockReferenceTimer := newTLFTypeTimers("BlockServer.AddBlockReference", r)
+	removeBlockReferencesTimer := newTLFTypeTimers("BlockServer.RemoveBlockReferences", r)
+	archiveBlockReferencesTimer := newTLFTypeTimers("BlockServer.ArchiveBlockReferences", r)
+	isUnflushedTimer := newTLFTypeTimers("BlockServer.IsUnflushed", r)
 	return BlockServerMeasured{
 		delegate:                    delegate,
 		getTimer:                    getTimer,
 		putTimer:                    putTimer,
+		putAgainTimer:               putAgainTimer,
 		addBlockReferenceTimer:      addBlockReferenceTimer,
 		removeBlockReferencesTimer:  removeBlockReferencesTimer,
 		archiveBlockReferencesTimer: archiveBlockReferencesTimer,
@@ -52,7 +82,7 @@ func NewBlockServerMeasured(delegate BlockServer, r metrics.Registry) BlockServe
 func (b BlockServerMeasured) Get(ctx context.Context, tlfID tlf.ID, id kbfsblock.ID,
 	context kbfsblock.Context) (
 	buf []byte, serverHalf kbfscrypto.BlockCryptKeyServerHalf, err error) {
-	b.getTimer.Time(func() {
+	b.getTimer.Time(tlfID.Type(), func() {
 		buf, serverHalf, err = b.delegate.Get(ctx, tlfID, id, context)
 	})
 	return buf, serverHalf, err
@@ -62,7 +92,7 @@ func (b BlockServerMeasured) Get(ctx context.Context, tlfID tlf.ID, id kbfsblock
 func (b BlockServerMeasured) Put(ctx context.Context, tlfID tlf.ID, id kbfsblock.ID,
 	context kbfsblock.Context, buf []byte,
 	serverHalf kbfscrypto.BlockCryptKeyServerHalf) (err error) {
-	b.putTimer.Time(func() {
+	b.putTimer.Time(tlfID.Type(), func() {
 		err = b.delegate.Put(ctx, tlfID, id, context, buf, serverHalf)
 	})
 	return err
@@ -72,7 +102,7 @@ func (b BlockServerMeasured) Put(ctx context.Context, tlfID tlf.ID, id kbfsblock
 func (b BlockServerMeasured) PutAgain(ctx context.Context, tlfID tlf.ID, id kbfsblock.ID,
 	context kbfsblock.Context, buf []byte,
 	serverHalf kbfscrypto.BlockCryptKeyServerHalf) (err error) {
-	b.putAgainTimer.Time(func() {
+	b.putAgainTimer.Time(tlfID.Type(), func() {
 		err = b.delegate.PutAgain(ctx, tlfID, id, context, buf, serverHalf)
 	})
 	return err
@@ -82,7 +112,7 @@ func (b BlockServerMeasured) PutAgain(ctx context.Context, tlfID tlf.ID, id kbfs
 // BlockServerMeasured.
 func (b BlockServerMeasured) AddBlockReference(ctx context.Context, tlfID tlf.ID,
 	id kbfsblock.ID, context kbfsblock.Context) (err error) {
-	b.addBlockReferenceTimer.Time(func() {
+	b.addBlockReferenceTimer.Time(tlfID.Type(), func() {
 		err = b.delegate.AddBlockReference(ctx, tlfID, id, context)
 	})
 	return err
@@ -93,7 +123,7 @@ func (b BlockServerMeasured) AddBlockReference(ctx context.Context, tlfID tlf.ID
 func (b BlockServerMeasured) RemoveBlockReferences(ctx context.Context,
 	tlfID tlf.ID, contexts kbfsblock.ContextMap) (
 	liveCounts map[kbfsblock.ID]int, err error) {
-	b.removeBlockReferencesTimer.Time(func() {
+	b.removeBlockReferencesTimer.Time(tlfID.Type(), func() {
 		liveCounts, err = b.delegate.RemoveBlockReferences(
 			ctx, tlfID, contexts)
 	})
@@ -104,7 +134,7 @@ func (b BlockServerMeasured) RemoveBlockReferences(ctx context.Context,
 // BlockServerRemote
 func (b BlockServerMeasured) ArchiveBlockReferences(ctx context.Context,
 	tlfID tlf.ID, contexts kbfsblock.ContextMap) (err error) {
-	b.archiveBlockReferencesTimer.Time(func() {
+	b.archiveBlockReferencesTimer.Time(tlfID.Type(), func() {
 		err = b.delegate.ArchiveBlockReferences(ctx, tlfID, contexts)
 	})
 	return err
@@ -113,7 +143,7 @@ func (b BlockServerMeasured) ArchiveBlockReferences(ctx context.Context,
 // IsUnflushed implements the BlockServer interface for BlockServerMeasured.
 func (b BlockServerMeasured) IsUnflushed(ctx context.Context, tlfID tlf.ID,
 	id kbfsblock.ID) (isUnflushed bool, err error) {
-	b.isUnflushedTimer.Time(func() {
+	b.isUnflushedTimer.Time(tlfID.Type(), func() {
 		isUnflushed, err = b.delegate.IsUnflushed(ctx, tlfID, id)
 	})
 	return isUnflushed, err
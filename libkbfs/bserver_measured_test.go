@@ -0,0 +1,39 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"testing"
+
+	"github.com/keybase/client/go/logger"
+	"github.com/keybase/kbfs/kbfsblock"
+	"github.com/keybase/kbfs/metricsutil"
+	"github.com/keybase/kbfs/tlf"
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func TestBlockServerMeasuredLabelsByTlfType(t *testing.T) {
+	r := metrics.NewRegistry()
+	bserver := NewBlockServerMeasured(
+		NewBlockServerMemory(logger.NewTestLogger(t)), r)
+
+	ctx := context.Background()
+	_, err := bserver.IsUnflushed(
+		ctx, tlf.FakeID(1, tlf.Public), kbfsblock.FakeID(1))
+	require.NoError(t, err)
+
+	count := func(label string) int64 {
+		name := metricsutil.NameWithLabels(
+			"BlockServer.IsUnflushed", "tlf_type", label)
+		return r.Get(name).(metrics.Timer).Count()
+	}
+	require.Equal(t, int64(1), count(tlf.Public.String()))
+	require.Equal(t, int64(0), count(tlf.Private.String()))
+	require.Equal(t, int64(0), count(tlf.SingleTeam.String()))
+	require.Equal(t, int64(0), count("unknown"))
+	require.Nil(t, r.Get("BlockServer.IsUnflushed"))
+}
@@ -0,0 +1,333 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"time"
+
+	"github.com/keybase/client/go/protocol/keybase1"
+	"github.com/keybase/go-framed-msgpack-rpc/rpc"
+	"github.com/keybase/kbfs/kbfsblock"
+	"github.com/keybase/kbfs/kbfscrypto"
+	kbgitkbfs "github.com/keybase/kbfs/protocol/kbgitkbfs1"
+	"github.com/keybase/kbfs/tlf"
+	"golang.org/x/net/context"
+)
+
+// BlockServerSocket is a BlockServer that talks to a
+// LocalSharedServer over a Unix domain socket.  It's meant only for
+// testing multiple KBFS processes against the same local data.
+type BlockServerSocket struct {
+	config     Config
+	log        traceLogger
+	deferLog   traceLogger
+	socketPath string
+
+	conn   *localSharedServerClient
+	client kbgitkbfs.LocalServerClient
+}
+
+// Test that BlockServerSocket fully implements the BlockServer interface.
+var _ BlockServer = (*BlockServerSocket)(nil)
+
+// Test that BlockServerSocket fully implements the ConnectionHandler
+// interface.
+var _ rpc.ConnectionHandler = (*BlockServerSocket)(nil)
+
+// NewBlockServerSocket returns a new instance of BlockServerSocket,
+// which connects to the LocalSharedServer listening on `socketPath`.
+func NewBlockServerSocket(config Config, socketPath string,
+	rpcLogFactory rpc.LogFactory) *BlockServerSocket {
+	log := config.MakeLogger("")
+	b := &BlockServerSocket{
+		config:     config,
+		log:        traceLogger{log},
+		deferLog:   traceLogger{log.CloneWithAddedDepth(1)},
+		socketPath: socketPath,
+	}
+	b.conn = newLocalSharedServerClient(newLocalSharedServerConnection(
+		config, socketPath, b, rpcLogFactory))
+	b.client = kbgitkbfs.LocalServerClient{Cli: b.conn}
+	return b
+}
+
+// RemoteAddress returns the socket path of the server this client is
+// talking to.
+func (b *BlockServerSocket) RemoteAddress() string {
+	return b.socketPath
+}
+
+// HandlerName implements the ConnectionHandler interface.
+func (*BlockServerSocket) HandlerName() string {
+	return "BlockServerSocket"
+}
+
+// OnConnect implements the ConnectionHandler interface.
+func (b *BlockServerSocket) OnConnect(ctx context.Context,
+	conn *rpc.Connection, client rpc.GenericClient,
+	server *rpc.Server) error {
+	b.log.CDebugf(ctx, "OnConnect called with a new connection")
+	return localSharedServerHello(ctx, b.config, client)
+}
+
+// OnConnectError implements the ConnectionHandler interface.
+func (b *BlockServerSocket) OnConnectError(err error, wait time.Duration) {
+	b.log.CWarningf(context.TODO(),
+		"BlockServerSocket: connection error: %q; retrying in %s", err, wait)
+}
+
+// OnDoCommandError implements the ConnectionHandler interface.
+func (b *BlockServerSocket) OnDoCommandError(err error, wait time.Duration) {
+	b.log.CWarningf(context.TODO(),
+		"BlockServerSocket: DoCommand error: %q; retrying in %s", err, wait)
+}
+
+// OnDisconnected implements the ConnectionHandler interface.
+func (b *BlockServerSocket) OnDisconnected(ctx context.Context,
+	status rpc.DisconnectStatus) {
+	if status == rpc.StartingNonFirstConnection {
+		b.log.CWarningf(ctx, "BlockServerSocket is disconnected")
+	}
+}
+
+// ShouldRetry implements the ConnectionHandler interface.
+func (b *BlockServerSocket) ShouldRetry(name string, err error) bool {
+	return false
+}
+
+// ShouldRetryOnConnect implements the ConnectionHandler interface.
+func (b *BlockServerSocket) ShouldRetryOnConnect(err error) bool {
+	// The server may just not have been started yet.
+	return true
+}
+
+// RefreshAuthToken implements the BlockServer interface for
+// BlockServerSocket.
+func (b *BlockServerSocket) RefreshAuthToken(ctx context.Context) {}
+
+func (b *BlockServerSocket) encodeBlockArgs(tlfID tlf.ID, id kbfsblock.ID,
+	context kbfsblock.Context) (
+	tlfIDBytes, idBytes, contextBytes []byte, err error) {
+	tlfIDBytes, err = tlfID.MarshalBinary()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	idBytes, err = id.MarshalBinary()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	contextBytes, err = b.config.Codec().Encode(context)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return tlfIDBytes, idBytes, contextBytes, nil
+}
+
+// Get implements the BlockServer interface for BlockServerSocket.
+func (b *BlockServerSocket) Get(ctx context.Context, tlfID tlf.ID,
+	id kbfsblock.ID, context kbfsblock.Context) (
+	buf []byte, serverHalf kbfscrypto.BlockCryptKeyServerHalf, err error) {
+	b.log.LazyTrace(ctx, "BServer: Get %s", id)
+	defer func() {
+		b.deferLog.LazyTrace(ctx, "BServer: Get %s done (err=%v)", id, err)
+	}()
+
+	tlfIDBytes, idBytes, contextBytes, err := b.encodeBlockArgs(
+		tlfID, id, context)
+	if err != nil {
+		return nil, kbfscrypto.BlockCryptKeyServerHalf{}, err
+	}
+	res, err := b.client.GetBlockFromServer(
+		ctx, kbgitkbfs.GetBlockFromServerArg{
+			TlfID:        tlfIDBytes,
+			BlockID:      idBytes,
+			BlockContext: contextBytes,
+		})
+	if err != nil {
+		return nil, kbfscrypto.BlockCryptKeyServerHalf{}, err
+	}
+	err = serverHalf.UnmarshalBinary(res.ServerHalf)
+	if err != nil {
+		return nil, kbfscrypto.BlockCryptKeyServerHalf{}, err
+	}
+	return res.Buf, serverHalf, nil
+}
+
+func (b *BlockServerSocket) put(ctx context.Context, tlfID tlf.ID,
+	id kbfsblock.ID, context kbfsblock.Context, buf []byte,
+	serverHalf kbfscrypto.BlockCryptKeyServerHalf, again bool) error {
+	tlfIDBytes, idBytes, contextBytes, err := b.encodeBlockArgs(
+		tlfID, id, context)
+	if err != nil {
+		return err
+	}
+	serverHalfBytes, err := serverHalf.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return b.client.PutBlockToServer(ctx, kbgitkbfs.PutBlockToServerArg{
+		TlfID:        tlfIDBytes,
+		BlockID:      idBytes,
+		BlockContext: contextBytes,
+		Buf:          buf,
+		ServerHalf:   serverHalfBytes,
+		Again:        again,
+	})
+}
+
+// Put implements the BlockServer interface for BlockServerSocket.
+func (b *BlockServerSocket) Put(ctx context.Context, tlfID tlf.ID,
+	id kbfsblock.ID, context kbfsblock.Context, buf []byte,
+	serverHalf kbfscrypto.BlockCryptKeyServerHalf) (err error) {
+	b.log.LazyTrace(ctx, "BServer: Put %s", id)
+	defer func() {
+		b.deferLog.LazyTrace(ctx, "BServer: Put %s done (err=%v)", id, err)
+	}()
+
+	return b.put(ctx, tlfID, id, context, buf, serverHalf, false)
+}
+
+// PutAgain implements the BlockServer interface for BlockServerSocket.
+func (b *BlockServerSocket) PutAgain(ctx context.Context, tlfID tlf.ID,
+	id kbfsblock.ID, context kbfsblock.Context, buf []byte,
+	serverHalf kbfscrypto.BlockCryptKeyServerHalf) (err error) {
+	b.log.LazyTrace(ctx, "BServer: PutAgain %s", id)
+	defer func() {
+		b.deferLog.LazyTrace(ctx, "BServer: PutAgain %s done (err=%v)", id, err)
+	}()
+
+	return b.put(ctx, tlfID, id, context, buf, serverHalf, true)
+}
+
+// AddBlockReference implements the BlockServer interface for
+// BlockServerSocket.
+func (b *BlockServerSocket) AddBlockReference(ctx context.Context,
+	tlfID tlf.ID, id kbfsblock.ID, context kbfsblock.Context) (err error) {
+	b.log.LazyTrace(ctx, "BServer: AddRef %s", id)
+	defer func() {
+		b.deferLog.LazyTrace(ctx, "BServer: AddRef %s done (err=%v)", id, err)
+	}()
+
+	tlfIDBytes, idBytes, contextBytes, err := b.encodeBlockArgs(
+		tlfID, id, context)
+	if err != nil {
+		return err
+	}
+	return b.client.AddBlockReference(ctx, kbgitkbfs.AddBlockReferenceArg{
+		TlfID:        tlfIDBytes,
+		BlockID:      idBytes,
+		BlockContext: contextBytes,
+	})
+}
+
+// RemoveBlockReferences implements the BlockServer interface for
+// BlockServerSocket.
+func (b *BlockServerSocket) RemoveBlockReferences(ctx context.Context,
+	tlfID tlf.ID, contexts kbfsblock.ContextMap) (
+	liveCounts map[kbfsblock.ID]int, err error) {
+	b.log.LazyTrace(ctx, "BServer: RemRef %v", contexts)
+	defer func() {
+		b.deferLog.LazyTrace(ctx, "BServer: RemRef %v done (err=%v)", contexts, err)
+	}()
+
+	tlfIDBytes, err := tlfID.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	contextsBytes, err := b.config.Codec().Encode(contexts)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := b.client.RemoveBlockReferences(
+		ctx, kbgitkbfs.RemoveBlockReferencesArg{
+			TlfID:    tlfIDBytes,
+			Contexts: contextsBytes,
+		})
+	if err != nil {
+		return nil, err
+	}
+	err = b.config.Codec().Decode(buf, &liveCounts)
+	if err != nil {
+		return nil, err
+	}
+	return liveCounts, nil
+}
+
+// ArchiveBlockReferences implements the BlockServer interface for
+// BlockServerSocket.
+func (b *BlockServerSocket) ArchiveBlockReferences(ctx context.Context,
+	tlfID tlf.ID, contexts kbfsblock.ContextMap) (err error) {
+	b.log.LazyTrace(ctx, "BServer: ArchiveRef %v", contexts)
+	defer func() {
+		b.deferLog.LazyTrace(ctx, "BServer: ArchiveRef %v done (err=%v)", contexts, err)
+	}()
+
+	tlfIDBytes, err := tlfID.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	contextsBytes, err := b.config.Codec().Encode(contexts)
+	if err != nil {
+		return err
+	}
+	return b.client.ArchiveBlockReferences(
+		ctx, kbgitkbfs.ArchiveBlockReferencesArg{
+			TlfID:    tlfIDBytes,
+			Contexts: contextsBytes,
+		})
+}
+
+// IsUnflushed implements the BlockServer interface for
+// BlockServerSocket.
+func (b *BlockServerSocket) IsUnflushed(
+	_ context.Context, _ tlf.ID, _ kbfsblock.ID) (bool, error) {
+	return false, nil
+}
+
+// Shutdown implements the BlockServer interface for BlockServerSocket.
+func (b *BlockServerSocket) Shutdown(ctx context.Context) {
+	b.conn.Shutdown()
+}
+
+// GetUserQuotaInfo implements the BlockServer interface for
+// BlockServerSocket.
+func (b *BlockServerSocket) GetUserQuotaInfo(ctx context.Context) (
+	info *kbfsblock.QuotaInfo, err error) {
+	b.log.LazyTrace(ctx, "BServer: GetUserQuotaInfo")
+	defer func() {
+		b.deferLog.LazyTrace(ctx, "BServer: GetUserQuotaInfo done (err=%v)", err)
+	}()
+
+	buf, err := b.client.GetUserQuotaInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = b.config.Codec().Decode(buf, &info)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// GetTeamQuotaInfo implements the BlockServer interface for
+// BlockServerSocket.
+func (b *BlockServerSocket) GetTeamQuotaInfo(
+	ctx context.Context, tid keybase1.TeamID) (
+	info *kbfsblock.QuotaInfo, err error) {
+	b.log.LazyTrace(ctx, "BServer: GetTeamQuotaInfo %s", tid)
+	defer func() {
+		b.deferLog.LazyTrace(ctx, "BServer: GetTeamQuotaInfo %s done (err=%v)", tid, err)
+	}()
+
+	buf, err := b.client.GetTeamQuotaInfo(ctx, tid)
+	if err != nil {
+		return nil, err
+	}
+	err = b.config.Codec().Decode(buf, &info)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
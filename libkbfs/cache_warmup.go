@@ -0,0 +1,257 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"path/filepath"
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/keybase/client/go/logger"
+	"github.com/keybase/kbfs/ioutil"
+	"github.com/keybase/kbfs/kbfscodec"
+	"github.com/keybase/kbfs/tlf"
+	"golang.org/x/net/context"
+)
+
+const (
+	// cacheWarmupManifestFilename is the name of the file, under
+	// the storage root, that holds the blocks to re-request on
+	// startup.
+	cacheWarmupManifestFilename = "kbfs_cache_warmup_manifest"
+	// defaultCacheWarmupMaxEntries bounds the number of blocks
+	// remembered for warming up the caches.
+	defaultCacheWarmupMaxEntries = 10000
+	// cacheWarmupPriority is the retrieval priority for warm-up
+	// requests, which is lower than that of any prefetch.
+	cacheWarmupPriority = defaultPrefetchPriority - 1
+)
+
+// CtxCacheWarmupTagKey is the type used for unique context tags
+// within the cache warmer.
+type CtxCacheWarmupTagKey int
+
+const (
+	// CtxCacheWarmupIDKey is the type of the tag for unique
+	// operation IDs within the cache warmer.
+	CtxCacheWarmupIDKey CtxCacheWarmupTagKey = iota
+)
+
+// CtxCacheWarmupOpID is the display name for the unique operation
+// cache warmer ID tag.
+const CtxCacheWarmupOpID = "CWID"
+
+// cacheWarmupEntry is a block that was recently requested on demand.
+type cacheWarmupEntry struct {
+	TlfID tlf.ID
+	Ptr   BlockPointer
+	IsDir bool
+}
+
+// cacheWarmupManifest is the on-disk list of blocks to re-request
+// when KBFS starts up.
+type cacheWarmupManifest struct {
+	// Entries are ordered from most to least recently requested.
+	Entries []cacheWarmupEntry
+}
+
+// recentBlockRecorder remembers the blocks most recently requested
+// on demand, up to a fixed number of blocks.
+type recentBlockRecorder struct {
+	recent *lru.Cache
+}
+
+func newRecentBlockRecorder(maxEntries int) *recentBlockRecorder {
+	recent, err := lru.New(maxEntries)
+	if err != nil {
+		// This only happens if maxEntries is non-positive.
+		panic(err)
+	}
+	return &recentBlockRecorder{recent}
+}
+
+// record notes that the given block was just requested.  Only file
+// and directory blocks are recorded, since those are the only kinds
+// that can be re-requested without more context.
+func (r *recentBlockRecorder) record(
+	kmd KeyMetadata, ptr BlockPointer, block Block) {
+	var isDir bool
+	switch block.(type) {
+	case *DirBlock:
+		isDir = true
+	case *FileBlock:
+	default:
+		return
+	}
+	r.recent.Add(ptr.ID, cacheWarmupEntry{kmd.TlfID(), ptr, isDir})
+}
+
+// entries returns the recorded blocks, from most to least recently
+// requested.
+func (r *recentBlockRecorder) entries() []cacheWarmupEntry {
+	keys := r.recent.Keys()
+	entries := make([]cacheWarmupEntry, 0, len(keys))
+	for i := len(keys) - 1; i >= 0; i-- {
+		e, ok := r.recent.Peek(keys[i])
+		if !ok {
+			continue
+		}
+		entries = append(entries, e.(cacheWarmupEntry))
+	}
+	return entries
+}
+
+// cacheWarmer saves a manifest of recently-requested blocks on
+// shutdown, and re-requests them at low priority on startup (or
+// after the caches are reset), so that the block caches are warm
+// before they are needed.
+type cacheWarmer struct {
+	config       Config
+	log          logger.Logger
+	manifestPath string
+
+	lock   sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+	// shutdown is set once the manifest is about to be saved, after
+	// which no more warm-ups may start.
+	shutdown bool
+}
+
+func newCacheWarmer(config Config, storageRoot string) *cacheWarmer {
+	return &cacheWarmer{
+		config: config,
+		log:    config.MakeLogger("CW"),
+		manifestPath: filepath.Join(
+			storageRoot, cacheWarmupManifestFilename),
+	}
+}
+
+// loadManifest reads the saved manifest, if there is one.
+func (cw *cacheWarmer) loadManifest() ([]cacheWarmupEntry, error) {
+	var manifest cacheWarmupManifest
+	err := kbfscodec.DeserializeFromFile(
+		cw.config.Codec(), cw.manifestPath, &manifest)
+	if ioutil.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return manifest.Entries, nil
+}
+
+// saveManifest writes out the given entries as the manifest to use
+// on the next startup.
+func (cw *cacheWarmer) saveManifest(entries []cacheWarmupEntry) error {
+	if len(entries) > defaultCacheWarmupMaxEntries {
+		entries = entries[:defaultCacheWarmupMaxEntries]
+	}
+	return kbfscodec.SerializeToFile(
+		cw.config.Codec(), cacheWarmupManifest{entries}, cw.manifestPath)
+}
+
+// warmUp requests the given blocks in the background, canceling any
+// warm-up already in progress.  It does nothing after `stop`.
+func (cw *cacheWarmer) warmUp(entries []cacheWarmupEntry) {
+	// Hold the lock throughout, so that a concurrent `stop` can't
+	// miss a warm-up that's just starting.
+	cw.lock.Lock()
+	defer cw.lock.Unlock()
+	cw.stopLocked()
+	if cw.shutdown || len(entries) == 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(CtxWithRandomIDReplayable(
+		context.Background(), CtxCacheWarmupIDKey, CtxCacheWarmupOpID,
+		cw.log))
+	done := make(chan struct{})
+	cw.cancel = cancel
+	cw.done = done
+	go func() {
+		defer close(done)
+		cw.requestBlocks(ctx, entries)
+	}()
+}
+
+// requestBlocks requests each of the given blocks, one TLF at a
+// time, and waits for them to be fetched.
+func (cw *cacheWarmer) requestBlocks(
+	ctx context.Context, entries []cacheWarmupEntry) {
+	// Group the entries by TLF, keeping the order within each TLF.
+	var tlfIDs []tlf.ID
+	byTlf := make(map[tlf.ID][]cacheWarmupEntry)
+	for _, e := range entries {
+		if _, ok := byTlf[e.TlfID]; !ok {
+			tlfIDs = append(tlfIDs, e.TlfID)
+		}
+		byTlf[e.TlfID] = append(byTlf[e.TlfID], e)
+	}
+
+	cw.log.CDebugf(ctx, "Warming up the caches with %d blocks from %d TLFs",
+		len(entries), len(tlfIDs))
+	numFetched := 0
+	defer func() {
+		cw.log.CDebugf(ctx, "Warmed up the caches with %d blocks",
+			numFetched)
+	}()
+	for _, tlfID := range tlfIDs {
+		// The latest MD has the keys for all the older key
+		// generations too.
+		irmd, err := cw.config.MDOps().GetForTLF(ctx, tlfID, nil)
+		if err != nil {
+			cw.log.CDebugf(ctx, "Couldn't get the MD for %s: %+v", tlfID, err)
+			continue
+		}
+		if irmd == (ImmutableRootMetadata{}) {
+			continue
+		}
+		errChs := make([]<-chan error, 0, len(byTlf[tlfID]))
+		for _, e := range byTlf[tlfID] {
+			var block Block
+			if e.IsDir {
+				block = NewDirBlock()
+			} else {
+				block = NewFileBlock()
+			}
+			errChs = append(errChs,
+				cw.config.BlockOps().BlockRetriever().RequestNoPrefetch(
+					ctx, cacheWarmupPriority, irmd, e.Ptr, block,
+					TransientEntry))
+		}
+		for _, errCh := range errChs {
+			select {
+			case err := <-errCh:
+				// Blocks may have been deleted since they were
+				// recorded, so just skip over any errors.
+				if err == nil {
+					numFetched++
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// stopLocked cancels any warm-up in progress, and waits for it to
+// finish.  The warm-up goroutine never takes `cw.lock`, so it's safe
+// to wait for it while holding the lock.
+func (cw *cacheWarmer) stopLocked() {
+	if cw.cancel == nil {
+		return
+	}
+	cw.cancel()
+	<-cw.done
+	cw.cancel, cw.done = nil, nil
+}
+
+// stop cancels any warm-up in progress, waits for it to finish, and
+// prevents any more warm-ups from starting.
+func (cw *cacheWarmer) stop() {
+	cw.lock.Lock()
+	defer cw.lock.Unlock()
+	cw.shutdown = true
+	cw.stopLocked()
+}
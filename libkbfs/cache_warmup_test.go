@@ -0,0 +1,94 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"os"
+	"testing"
+
+	"github.com/keybase/kbfs/ioutil"
+	"github.com/keybase/kbfs/tlf"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func TestRecentBlockRecorder(t *testing.T) {
+	r := newRecentBlockRecorder(2)
+	kmd := makeKMD()
+	ptr1 := makeRandomBlockPointer(t)
+	ptr2 := makeRandomBlockPointer(t)
+	ptr3 := makeRandomBlockPointer(t)
+
+	t.Log("Only file and directory blocks are recorded.")
+	r.record(kmd, ptr1, NewFileBlock())
+	r.record(kmd, ptr2, NewDirBlock())
+	r.record(kmd, ptr3, &CommonBlock{})
+	require.Equal(t, []cacheWarmupEntry{
+		{kmd.TlfID(), ptr2, true},
+		{kmd.TlfID(), ptr1, false},
+	}, r.entries())
+
+	t.Log("Re-recording a block makes it the most recent one, and the " +
+		"least recent block is forgotten once the recorder is full.")
+	r.record(kmd, ptr1, NewFileBlock())
+	r.record(kmd, ptr3, NewFileBlock())
+	require.Equal(t, []cacheWarmupEntry{
+		{kmd.TlfID(), ptr3, false},
+		{kmd.TlfID(), ptr1, false},
+	}, r.entries())
+}
+
+func TestCacheWarmupManifest(t *testing.T) {
+	tempdir, err := ioutil.TempDir(os.TempDir(), "cache_warmup")
+	require.NoError(t, err)
+	defer func() {
+		err := ioutil.RemoveAll(tempdir)
+		require.NoError(t, err)
+	}()
+
+	config := MakeTestConfigOrBust(t, "u1")
+	defer CheckConfigAndShutdown(context.Background(), t, config)
+	cw := newCacheWarmer(config, tempdir)
+
+	t.Log("A missing manifest is treated as empty.")
+	entries, err := cw.loadManifest()
+	require.NoError(t, err)
+	require.Len(t, entries, 0)
+
+	tlfID := tlf.FakeID(1, tlf.Private)
+	for i := 0; i < defaultCacheWarmupMaxEntries+1; i++ {
+		entries = append(entries, cacheWarmupEntry{
+			TlfID: tlfID,
+			Ptr:   makeRandomBlockPointer(t),
+			IsDir: i%2 == 0,
+		})
+	}
+	err = cw.saveManifest(entries)
+	require.NoError(t, err)
+
+	t.Log("The saved manifest is bounded in size.")
+	loaded, err := cw.loadManifest()
+	require.NoError(t, err)
+	require.Equal(t, entries[:defaultCacheWarmupMaxEntries], loaded)
+}
+
+func TestCacheWarmupStop(t *testing.T) {
+	config := MakeTestConfigOrBust(t, "u1")
+	defer CheckConfigAndShutdown(context.Background(), t, config)
+	cw := newCacheWarmer(config, "")
+	entries := []cacheWarmupEntry{{
+		TlfID: tlf.FakeID(1, tlf.Private),
+		Ptr:   makeRandomBlockPointer(t),
+	}}
+
+	t.Log("A warm-up is waited for when stopping.")
+	cw.warmUp(entries)
+	cw.stop()
+	require.Nil(t, cw.done)
+
+	t.Log("No warm-up starts after stopping.")
+	cw.warmUp(entries)
+	require.Nil(t, cw.done)
+}
@@ -6,7 +6,10 @@ package libkbfs
 
 import (
 	"flag"
+	"net"
+	"net/http"
 	"os"
+	stdpath "path"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -21,6 +24,7 @@ import (
 	"github.com/keybase/kbfs/kbfscrypto"
 	"github.com/keybase/kbfs/kbfsedits"
 	"github.com/keybase/kbfs/kbfsmd"
+	"github.com/keybase/kbfs/metricsutil"
 	"github.com/keybase/kbfs/tlf"
 	"github.com/pkg/errors"
 	metrics "github.com/rcrowley/go-metrics"
@@ -57,7 +61,10 @@ const (
 	bgFlushPeriodDefault         = 1 * time.Second
 	keyBundlesCacheCapacityBytes = 10 * cache.MB
 	// folder name for persisted config parameters.
-	syncedTlfConfigFolderName = "synced_tlf_config"
+	syncedTlfConfigFolderName    = "synced_tlf_config"
+	diskCacheTlfConfigFolderName = "disk_cache_tlf_config"
+	qrTlfConfigFolderName        = "qr_tlf_config"
+	conflictTlfConfigFolderName  = "conflict_tlf_config"
 
 	// By default, this will be the block type given to all blocks
 	// that aren't explicitly some other type.
@@ -92,17 +99,26 @@ type ConfigLocal struct {
 	clock            Clock
 	kbpki            KBPKI
 	renamer          ConflictRenamer
+	crMergeGlobs     []string
 	userHistory      *kbfsedits.UserHistory
+	lockManager      LockManager
 	registry         metrics.Registry
 	loggerFn         func(prefix string) logger.Logger
 	noBGFlush        bool // logic opposite so the default value is the common setting
 	rwpWaitTime      time.Duration
 	diskLimiter      DiskLimiter
 	syncedTlfs       map[tlf.ID]bool
+	syncedTlfPaths   map[tlf.ID][]string
+	diskCacheTlfs    map[tlf.ID]DiskCacheTlfSettings
+	qrTlfPolicies    map[tlf.ID]QuotaReclamationTlfPolicy
+	conflictTmpls    map[tlf.ID]string
+	cacheWarmer      *cacheWarmer
+	metricsServer    *http.Server
 	defaultBlockType keybase1.BlockType
 	kbfsService      *KBFSService
 	kbCtx            Context
 	rootNodeWrappers []func(Node) Node
+	tlfSyncHandlers  []func(tlf.ID, bool)
 
 	maxNameBytes  uint32
 	maxDirBytes   uint64
@@ -112,6 +128,7 @@ type ConfigLocal struct {
 
 	traceLock    sync.RWMutex
 	traceEnabled bool
+	spanExporter SpanExporter
 
 	delayedCancellationGracePeriod time.Duration
 
@@ -413,17 +430,23 @@ func NewConfigLocal(mode InitMode,
 		diskCacheMode: diskCacheMode,
 		kbCtx:         kbCtx,
 	}
-	if diskCacheMode == DiskCacheModeLocal {
-		config.loadSyncedTlfsLocked()
-	}
 	config.SetClock(wallClock{})
 	config.SetReporter(NewReporterSimple(config.Clock(), 10))
 	config.SetConflictRenamer(WriterDeviceDateConflictRenamer{config})
 	config.ResetCaches()
 	config.SetCodec(kbfscodec.NewMsgpack())
+	if diskCacheMode == DiskCacheModeLocal {
+		// The sync paths are encoded with the codec, so this must
+		// happen after the codec is set.
+		config.loadSyncedTlfsLocked()
+		config.loadDiskCacheTlfSettingsLocked()
+		config.loadQuotaReclamationTlfPoliciesLocked()
+		config.loadConflictRenameTemplatesLocked()
+	}
 	config.SetKeyOps(&KeyOpsStandard{config})
 	config.SetRekeyQueue(NewRekeyQueueStandard(config))
 	config.SetUserHistory(kbfsedits.NewUserHistory())
+	config.SetLockManager(NewLeaseLockManager(config))
 
 	config.maxNameBytes = maxNameBytesDefault
 	config.maxDirBytes = maxDirBytesDefault
@@ -814,6 +837,20 @@ func (c *ConfigLocal) SetConflictRenamer(cr ConflictRenamer) {
 	c.renamer = cr
 }
 
+// ConflictMergeGlobs implements the Config interface for ConfigLocal.
+func (c *ConfigLocal) ConflictMergeGlobs() []string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.crMergeGlobs
+}
+
+// SetConflictMergeGlobs implements the Config interface for ConfigLocal.
+func (c *ConfigLocal) SetConflictMergeGlobs(globs []string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.crMergeGlobs = globs
+}
+
 // UserHistory implements the Config interface for ConfigLocal.
 func (c *ConfigLocal) UserHistory() *kbfsedits.UserHistory {
 	c.lock.RLock()
@@ -828,6 +865,20 @@ func (c *ConfigLocal) SetUserHistory(uh *kbfsedits.UserHistory) {
 	c.userHistory = uh
 }
 
+// LockManager implements the Config interface for ConfigLocal.
+func (c *ConfigLocal) LockManager() LockManager {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.lockManager
+}
+
+// SetLockManager implements the Config interface for ConfigLocal.
+func (c *ConfigLocal) SetLockManager(lm LockManager) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.lockManager = lm
+}
+
 // MetadataVersion implements the Config interface for ConfigLocal.
 func (c *ConfigLocal) MetadataVersion() kbfsmd.MetadataVer {
 	c.lock.RLock()
@@ -990,6 +1041,7 @@ func (c *ConfigLocal) resetCachesWithoutShutdown() DirtyBlockCache {
 // ResetCaches implements the Config interface for ConfigLocal.
 func (c *ConfigLocal) ResetCaches() {
 	oldDirtyBcache := c.resetCachesWithoutShutdown()
+	defer c.warmUpCachesAfterReset()
 	jServer, err := GetJournalServer(c)
 	if err == nil {
 		if err := c.journalizeBcaches(jServer); err != nil {
@@ -1010,6 +1062,107 @@ func (c *ConfigLocal) ResetCaches() {
 	}
 }
 
+// recentBlocks returns the blocks most recently fetched on demand,
+// from most to least recent.
+func (c *ConfigLocal) recentBlocks() []cacheWarmupEntry {
+	bops, ok := c.BlockOps().(*BlockOpsStandard)
+	if !ok {
+		return nil
+	}
+	recent := bops.getRecentBlockRecorder()
+	if recent == nil {
+		return nil
+	}
+	return recent.entries()
+}
+
+// enableCacheWarmup makes this config save the blocks it fetched
+// most recently into a manifest under `storageRoot` on shutdown,
+// and starts re-requesting the blocks from the previous manifest in
+// the background.
+func (c *ConfigLocal) enableCacheWarmup(storageRoot string) error {
+	if bops, ok := c.BlockOps().(*BlockOpsStandard); ok {
+		bops.recordRecentBlocks(defaultCacheWarmupMaxEntries)
+	}
+	cw := newCacheWarmer(c, storageRoot)
+	func() {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		c.cacheWarmer = cw
+	}()
+	entries, err := cw.loadManifest()
+	if err != nil {
+		return err
+	}
+	cw.warmUp(entries)
+	return nil
+}
+
+// warmUpCachesAfterReset re-requests the most recently fetched
+// blocks, if cache warm-up is enabled.
+func (c *ConfigLocal) warmUpCachesAfterReset() {
+	c.lock.RLock()
+	cw := c.cacheWarmer
+	c.lock.RUnlock()
+	if cw == nil {
+		return
+	}
+	cw.warmUp(c.recentBlocks())
+}
+
+// saveCacheWarmupManifest stops any warm-up in progress, and saves
+// the most recently fetched blocks for the next startup, if cache
+// warm-up is enabled.
+func (c *ConfigLocal) saveCacheWarmupManifest() error {
+	c.lock.RLock()
+	cw := c.cacheWarmer
+	c.lock.RUnlock()
+	if cw == nil {
+		return nil
+	}
+	cw.stop()
+	return cw.saveManifest(c.recentBlocks())
+}
+
+// enableMetricsServer starts serving the metrics registry in the
+// Prometheus text format over HTTP, at the /metrics path of the given
+// host:port.
+func (c *ConfigLocal) enableMetricsServer(
+	ctx context.Context, addr string) error {
+	registry := c.MetricsRegistry()
+	if registry == nil {
+		return errors.New("Metrics are turned off")
+	}
+
+	// Listen separately from serving, so we can return errors
+	// like "address already in use".
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	serveMux := http.NewServeMux()
+	serveMux.Handle("/metrics", metricsutil.PrometheusHandler(registry))
+	server := &http.Server{
+		Handler:      serveMux,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+	func() {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		c.metricsServer = server
+	}()
+
+	log := c.MakeLogger("")
+	go func() {
+		err := server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			log.CWarningf(ctx, "Metrics server stopped: %+v", err)
+		}
+	}()
+	return nil
+}
+
 // MakeLogger implements the Config interface for ConfigLocal.
 func (c *ConfigLocal) MakeLogger(module string) logger.Logger {
 	// No need to lock since c.loggerFn is initialized once at
@@ -1044,9 +1197,28 @@ func (c *ConfigLocal) SetTraceOptions(enabled bool) {
 	c.traceEnabled = enabled
 }
 
+// SpanExporter implements the Config interface for ConfigLocal.
+func (c *ConfigLocal) SpanExporter() SpanExporter {
+	c.traceLock.RLock()
+	defer c.traceLock.RUnlock()
+	return c.spanExporter
+}
+
+// SetSpanExporter implements the Config interface for ConfigLocal.
+func (c *ConfigLocal) SetSpanExporter(e SpanExporter) {
+	c.traceLock.Lock()
+	defer c.traceLock.Unlock()
+	c.spanExporter = e
+}
+
 // MaybeStartTrace implements the Config interface for ConfigLocal.
+// If a span exporter is set, it also starts a span named after
+// `family`, which is finished by MaybeFinishTrace.
 func (c *ConfigLocal) MaybeStartTrace(
 	ctx context.Context, family, title string) context.Context {
+	ctx, span := startSpan(ctx, c, family)
+	span.SetAttribute("title", title)
+
 	traceEnabled := func() bool {
 		c.traceLock.RLock()
 		defer c.traceLock.RUnlock()
@@ -1064,6 +1236,7 @@ func (c *ConfigLocal) MaybeStartTrace(
 
 // MaybeFinishTrace implements the Config interface for ConfigLocal.
 func (c *ConfigLocal) MaybeFinishTrace(ctx context.Context, err error) {
+	spanFromContext(ctx).Finish(err)
 	if tr, ok := trace.FromContext(ctx); ok {
 		if err != nil {
 			tr.LazyPrintf("err=%+v", err)
@@ -1114,6 +1287,7 @@ func (c *ConfigLocal) BGFlushPeriod() time.Duration {
 // Shutdown implements the Config interface for ConfigLocal.
 func (c *ConfigLocal) Shutdown(ctx context.Context) error {
 	c.RekeyQueue().Shutdown()
+	c.LockManager().Shutdown()
 	if c.CheckStateOnShutdown() && c.allKnownConfigsForTesting != nil {
 		// Before we do anything, wait for all archiving and
 		// journaling to finish.
@@ -1162,6 +1336,11 @@ func (c *ConfigLocal) Shutdown(ctx context.Context) error {
 		// Continue with shutdown regardless of err.
 		err = nil
 	}
+	err = c.saveCacheWarmupManifest()
+	if err != nil {
+		errorList = append(errorList, err)
+		err = nil
+	}
 	c.BlockOps().Shutdown()
 	c.MDServer().Shutdown()
 	c.KeyServer().Shutdown()
@@ -1184,6 +1363,24 @@ func (c *ConfigLocal) Shutdown(ctx context.Context) error {
 	if kbfsServ != nil {
 		kbfsServ.Shutdown()
 	}
+	c.lock.RLock()
+	metricsServer := c.metricsServer
+	c.lock.RUnlock()
+	if metricsServer != nil {
+		err = metricsServer.Close()
+		if err != nil {
+			errorList = append(errorList, err)
+		}
+	}
+	// Shut down the span exporter last, to flush the spans from
+	// everything shut down above.
+	spanExporter := c.SpanExporter()
+	if spanExporter != nil {
+		err = spanExporter.Shutdown(ctx)
+		if err != nil {
+			errorList = append(errorList, err)
+		}
+	}
 
 	if len(errorList) == 1 {
 		return errorList[0]
@@ -1301,6 +1498,9 @@ func (c *ConfigLocal) EnableJournaling(
 	jServer = makeJournalServer(c, log, journalRoot, c.BlockCache(),
 		c.DirtyBlockCache(), c.BlockServer(), c.MDOps(), branchListener,
 		flushListener)
+	if registry := c.MetricsRegistry(); registry != nil {
+		jServer.registerMetrics(registry)
+	}
 
 	c.SetBlockServer(jServer.blockServer())
 	c.SetMDOps(jServer.mdOps())
@@ -1379,16 +1579,19 @@ func (c *ConfigLocal) openConfigLevelDB(configName string) (*levelDb, error) {
 	return openLevelDB(stor)
 }
 
-func (c *ConfigLocal) loadSyncedTlfsLocked() (err error) {
-	syncedTlfs := make(map[tlf.ID]bool)
+// loadTlfConfigLocked calls `decode` on every entry of the per-TLF
+// config database with the given name, and deletes the entries whose
+// keys aren't TLF IDs or whose values `decode` rejects.  `desc`
+// describes the entries, for logging.  It does nothing in test mode.
+func (c *ConfigLocal) loadTlfConfigLocked(configName, desc string,
+	decode func(tlfID tlf.ID, value []byte) error) error {
 	if c.IsTestMode() {
-		c.syncedTlfs = syncedTlfs
 		return nil
 	}
 	if c.storageRoot == "" {
 		return errors.New("empty storageRoot specified for non-test run")
 	}
-	ldb, err := c.openConfigLevelDB(syncedTlfConfigFolderName)
+	ldb, err := c.openConfigLevelDB(configName)
 	if err != nil {
 		return err
 	}
@@ -1397,22 +1600,101 @@ func (c *ConfigLocal) loadSyncedTlfsLocked() (err error) {
 	defer iter.Release()
 
 	log := c.MakeLogger("")
-	// If there are any un-parseable IDs, delete them.
+	// If there are any un-parseable entries, delete them.
 	deleteBatch := new(leveldb.Batch)
 	for iter.Next() {
 		key := string(iter.Key())
 		tlfID, err := tlf.ParseID(key)
 		if err != nil {
-			log.Debug("deleting TLF %s from synced TLF list", key)
+			log.Debug("deleting TLF %s from %s", key, desc)
+			deleteBatch.Delete(iter.Key())
+			continue
+		}
+		err = decode(tlfID, iter.Value())
+		if err != nil {
+			log.Debug("deleting TLF %s with undecodable %s: %+v",
+				key, desc, err)
 			deleteBatch.Delete(iter.Key())
 			continue
 		}
-		syncedTlfs[tlfID] = true
 	}
-	c.syncedTlfs = syncedTlfs
 	return ldb.Write(deleteBatch, nil)
 }
 
+// storeTlfConfigLocked persists `value`, encoded, as the entry for
+// the given TLF in the per-TLF config database with the given name.
+// A nil value is stored as an empty entry, and if `remove` is true,
+// the entry is deleted instead.  It does nothing in test mode.
+//
+// The caller must hold `c.lock`, so this uses `c.codec` directly
+// rather than `c.Codec()`.
+func (c *ConfigLocal) storeTlfConfigLocked(configName string,
+	tlfID tlf.ID, value interface{}, remove bool) error {
+	if c.IsTestMode() {
+		return nil
+	}
+	if c.storageRoot == "" {
+		return errors.New("empty storageRoot specified for non-test run")
+	}
+	ldb, err := c.openConfigLevelDB(configName)
+	if err != nil {
+		return err
+	}
+	defer ldb.Close()
+	tlfBytes, err := tlfID.MarshalText()
+	if err != nil {
+		return err
+	}
+	if remove {
+		return ldb.Delete(tlfBytes, nil)
+	}
+	var buf []byte
+	if value != nil {
+		buf, err = c.codec.Encode(value)
+		if err != nil {
+			return err
+		}
+	}
+	return ldb.Put(tlfBytes, buf, nil)
+}
+
+func (c *ConfigLocal) loadSyncedTlfsLocked() (err error) {
+	syncedTlfs := make(map[tlf.ID]bool)
+	syncedTlfPaths := make(map[tlf.ID][]string)
+	err = c.loadTlfConfigLocked(syncedTlfConfigFolderName, "synced TLF list",
+		func(tlfID tlf.ID, value []byte) error {
+			// An empty value means the whole TLF is synced;
+			// otherwise the value holds the encoded list of synced
+			// paths.
+			if len(value) == 0 {
+				syncedTlfs[tlfID] = true
+				return nil
+			}
+			var paths []string
+			err := c.codec.Decode(value, &paths)
+			if err != nil {
+				return err
+			}
+			syncedTlfPaths[tlfID] = paths
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+	c.syncedTlfs = syncedTlfs
+	c.syncedTlfPaths = syncedTlfPaths
+	return nil
+}
+
+// LoadSyncedTlfs reads which TLFs are synced for offline use from the
+// storage root.  It's for tools that run without a disk cache next to
+// a KBFS process, which owns the sync config.
+func (c *ConfigLocal) LoadSyncedTlfs() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.loadSyncedTlfsLocked()
+}
+
 // IsSyncedTlf implements the isSyncedTlfGetter interface for ConfigLocal.
 func (c *ConfigLocal) IsSyncedTlf(tlfID tlf.ID) bool {
 	c.lock.RLock()
@@ -1420,11 +1702,59 @@ func (c *ConfigLocal) IsSyncedTlf(tlfID tlf.ID) bool {
 	return c.syncedTlfs[tlfID]
 }
 
-// SetTlfSyncState implements the Config interface for ConfigLocal.
-func (c *ConfigLocal) SetTlfSyncState(tlfID tlf.ID, isSynced bool) error {
-	c.lock.Lock()
-	defer c.lock.Unlock()
-	if isSynced {
+// GetTlfSyncPaths implements the syncedTlfGetterSetter interface for
+// ConfigLocal.
+func (c *ConfigLocal) GetTlfSyncPaths(tlfID tlf.ID) []string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	paths := c.syncedTlfPaths[tlfID]
+	if len(paths) == 0 {
+		return nil
+	}
+	return append([]string(nil), paths...)
+}
+
+// GetPartiallySyncedTlfs implements the syncedTlfGetterSetter
+// interface for ConfigLocal.
+func (c *ConfigLocal) GetPartiallySyncedTlfs() []tlf.ID {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	tlfIDs := make([]tlf.ID, 0, len(c.syncedTlfPaths))
+	for tlfID := range c.syncedTlfPaths {
+		tlfIDs = append(tlfIDs, tlfID)
+	}
+	return tlfIDs
+}
+
+// cleanTlfSyncPaths checks that each of the given sync paths is a
+// valid relative path within a TLF, and returns the cleaned,
+// de-duplicated paths.
+func cleanTlfSyncPaths(paths []string) ([]string, error) {
+	seen := make(map[string]bool, len(paths))
+	cleaned := make([]string, 0, len(paths))
+	for _, p := range paths {
+		cp := stdpath.Clean(strings.Trim(p, "/"))
+		if cp == "." || cp == ".." || strings.HasPrefix(cp, "../") {
+			return nil, InvalidSyncPathError{p}
+		}
+		// Make sure every component is a well-formed pattern.
+		if _, err := stdpath.Match(cp, ""); err != nil {
+			return nil, InvalidSyncPathError{p}
+		}
+		if seen[cp] {
+			continue
+		}
+		seen[cp] = true
+		cleaned = append(cleaned, cp)
+	}
+	return cleaned, nil
+}
+
+// setTlfSyncConfigLocked persists and sets the sync state of the
+// given TLF.  If `isSynced` is true, `paths` must be empty.
+func (c *ConfigLocal) setTlfSyncConfigLocked(
+	tlfID tlf.ID, isSynced bool, paths []string) error {
+	if isSynced || len(paths) > 0 {
 		diskCacheWrapped, ok := c.diskBlockCache.(*diskBlockCacheWrapped)
 		if !ok {
 			return errors.Errorf("invalid disk cache type to set TLF sync "+
@@ -1434,30 +1764,252 @@ func (c *ConfigLocal) SetTlfSyncState(tlfID tlf.ID, isSynced bool) error {
 			return errors.New("sync block cache is not enabled")
 		}
 	}
-	if !c.IsTestMode() {
-		if c.storageRoot == "" {
-			return errors.New("empty storageRoot specified for non-test run")
-		}
-		ldb, err := c.openConfigLevelDB(syncedTlfConfigFolderName)
-		if err != nil {
-			return err
-		}
-		defer ldb.Close()
-		tlfBytes, err := tlfID.MarshalText()
-		if err != nil {
-			return err
-		}
-		if isSynced {
-			err = ldb.Put(tlfBytes, nil, nil)
-		} else {
-			err = ldb.Delete(tlfBytes, nil)
-		}
+	var value interface{}
+	if !isSynced && len(paths) > 0 {
+		value = paths
+	}
+	err := c.storeTlfConfigLocked(syncedTlfConfigFolderName, tlfID, value,
+		!isSynced && len(paths) == 0)
+	if err != nil {
+		return err
+	}
+	if c.syncedTlfs == nil {
+		c.syncedTlfs = make(map[tlf.ID]bool)
+	}
+	if c.syncedTlfPaths == nil {
+		c.syncedTlfPaths = make(map[tlf.ID][]string)
+	}
+	c.syncedTlfs[tlfID] = isSynced
+	if len(paths) > 0 {
+		c.syncedTlfPaths[tlfID] = paths
+	} else {
+		delete(c.syncedTlfPaths, tlfID)
+	}
+	<-c.bops.TogglePrefetcher(true)
+	return nil
+}
+
+// notifySyncStateHandlers calls the TLF sync state handlers.  It
+// must be called without holding `c.lock`, since the handlers may
+// use the config.
+func (c *ConfigLocal) notifySyncStateHandlers(tlfID tlf.ID, isSynced bool) {
+	c.lock.RLock()
+	handlers := c.tlfSyncHandlers[:]
+	c.lock.RUnlock()
+	for _, f := range handlers {
+		f(tlfID, isSynced)
+	}
+}
+
+// SetTlfSyncState implements the Config interface for ConfigLocal.
+func (c *ConfigLocal) SetTlfSyncState(tlfID tlf.ID, isSynced bool) error {
+	err := func() error {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		return c.setTlfSyncConfigLocked(tlfID, isSynced, nil)
+	}()
+	if err != nil {
+		return err
+	}
+	c.notifySyncStateHandlers(tlfID, isSynced)
+	return nil
+}
+
+// SetTlfSyncPaths implements the syncedTlfGetterSetter interface for
+// ConfigLocal.
+func (c *ConfigLocal) SetTlfSyncPaths(tlfID tlf.ID, paths []string) error {
+	paths, err := cleanTlfSyncPaths(paths)
+	if err != nil {
+		return err
+	}
+	err = func() error {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		return c.setTlfSyncConfigLocked(tlfID, false, paths)
+	}()
+	if err != nil {
+		return err
+	}
+	c.notifySyncStateHandlers(tlfID, false)
+	return nil
+}
+
+func (c *ConfigLocal) loadDiskCacheTlfSettingsLocked() (err error) {
+	diskCacheTlfs := make(map[tlf.ID]DiskCacheTlfSettings)
+	err = c.loadTlfConfigLocked(diskCacheTlfConfigFolderName,
+		"disk cache TLF settings", func(tlfID tlf.ID, value []byte) error {
+			var settings DiskCacheTlfSettings
+			err := c.codec.Decode(value, &settings)
+			if err != nil {
+				return err
+			}
+			diskCacheTlfs[tlfID] = settings
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+	c.diskCacheTlfs = diskCacheTlfs
+	return nil
+}
+
+// GetDiskCacheTlfSettings implements the
+// diskCacheTlfSettingsGetterSetter interface for ConfigLocal.
+func (c *ConfigLocal) GetDiskCacheTlfSettings(
+	tlfID tlf.ID) DiskCacheTlfSettings {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.diskCacheTlfs[tlfID]
+}
+
+func (c *ConfigLocal) setDiskCacheTlfSettingsLocked(
+	tlfID tlf.ID, settings DiskCacheTlfSettings) error {
+	isDefault := settings == DiskCacheTlfSettings{}
+	err := c.storeTlfConfigLocked(
+		diskCacheTlfConfigFolderName, tlfID, settings, isDefault)
+	if err != nil {
+		return err
+	}
+	if c.diskCacheTlfs == nil {
+		c.diskCacheTlfs = make(map[tlf.ID]DiskCacheTlfSettings)
+	}
+	if isDefault {
+		delete(c.diskCacheTlfs, tlfID)
+	} else {
+		c.diskCacheTlfs[tlfID] = settings
+	}
+	return nil
+}
+
+// SetDiskCacheTlfSettings implements the
+// diskCacheTlfSettingsGetterSetter interface for ConfigLocal.
+func (c *ConfigLocal) SetDiskCacheTlfSettings(ctx context.Context,
+	tlfID tlf.ID, settings DiskCacheTlfSettings) error {
+	err := func() error {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		return c.setDiskCacheTlfSettingsLocked(tlfID, settings)
+	}()
+	if err != nil {
+		return err
+	}
+	// The disk cache reads the settings back from the config, so
+	// this must happen without holding the config lock.
+	dbc, ok := c.DiskBlockCache().(*diskBlockCacheWrapped)
+	if !ok {
+		return nil
+	}
+	return dbc.updateTlfSettings(ctx, tlfID)
+}
+
+func (c *ConfigLocal) loadQuotaReclamationTlfPoliciesLocked() (err error) {
+	qrTlfPolicies := make(map[tlf.ID]QuotaReclamationTlfPolicy)
+	err = c.loadTlfConfigLocked(qrTlfConfigFolderName, "QR TLF policies",
+		func(tlfID tlf.ID, value []byte) error {
+			var policy QuotaReclamationTlfPolicy
+			err := c.codec.Decode(value, &policy)
+			if err != nil {
+				return err
+			}
+			qrTlfPolicies[tlfID] = policy
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+	c.qrTlfPolicies = qrTlfPolicies
+	return nil
+}
+
+// GetQuotaReclamationTlfPolicy implements the
+// quotaReclamationTlfPolicyGetterSetter interface for ConfigLocal.
+func (c *ConfigLocal) GetQuotaReclamationTlfPolicy(
+	tlfID tlf.ID) QuotaReclamationTlfPolicy {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.qrTlfPolicies[tlfID]
+}
+
+// SetQuotaReclamationTlfPolicy implements the
+// quotaReclamationTlfPolicyGetterSetter interface for ConfigLocal.
+func (c *ConfigLocal) SetQuotaReclamationTlfPolicy(
+	tlfID tlf.ID, policy QuotaReclamationTlfPolicy) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	isDefault := policy == QuotaReclamationTlfPolicy{}
+	err := c.storeTlfConfigLocked(
+		qrTlfConfigFolderName, tlfID, policy, isDefault)
+	if err != nil {
+		return err
+	}
+	if c.qrTlfPolicies == nil {
+		c.qrTlfPolicies = make(map[tlf.ID]QuotaReclamationTlfPolicy)
+	}
+	if isDefault {
+		delete(c.qrTlfPolicies, tlfID)
+	} else {
+		c.qrTlfPolicies[tlfID] = policy
+	}
+	return nil
+}
+
+func (c *ConfigLocal) loadConflictRenameTemplatesLocked() (err error) {
+	conflictTmpls := make(map[tlf.ID]string)
+	err = c.loadTlfConfigLocked(conflictTlfConfigFolderName,
+		"conflict rename templates",
+		func(tlfID tlf.ID, value []byte) error {
+			var text string
+			err := c.codec.Decode(value, &text)
+			if err != nil {
+				return err
+			}
+			conflictTmpls[tlfID] = text
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+	c.conflictTmpls = conflictTmpls
+	return nil
+}
+
+// GetConflictRenameTemplate implements the
+// conflictRenameTemplateGetterSetter interface for ConfigLocal.
+func (c *ConfigLocal) GetConflictRenameTemplate(tlfID tlf.ID) string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.conflictTmpls[tlfID]
+}
+
+// SetConflictRenameTemplate implements the
+// conflictRenameTemplateGetterSetter interface for ConfigLocal.
+func (c *ConfigLocal) SetConflictRenameTemplate(
+	tlfID tlf.ID, text string) error {
+	if text != "" {
+		// Reject bad templates now, rather than during the next
+		// conflict resolution.
+		_, err := NewTemplateConflictRenamer(c, text)
 		if err != nil {
 			return err
 		}
 	}
-	c.syncedTlfs[tlfID] = isSynced
-	<-c.bops.TogglePrefetcher(true)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	isDefault := text == ""
+	err := c.storeTlfConfigLocked(
+		conflictTlfConfigFolderName, tlfID, text, isDefault)
+	if err != nil {
+		return err
+	}
+	if c.conflictTmpls == nil {
+		c.conflictTmpls = make(map[tlf.ID]string)
+	}
+	if isDefault {
+		delete(c.conflictTmpls, tlfID)
+	} else {
+		c.conflictTmpls[tlfID] = text
+	}
 	return nil
 }
 
@@ -1506,3 +2058,11 @@ func (c *ConfigLocal) AddRootNodeWrapper(f func(Node) Node) {
 	defer c.lock.Unlock()
 	c.rootNodeWrappers = append(c.rootNodeWrappers, f)
 }
+
+// AddTlfSyncStateHandler implements the Config interface for
+// ConfigLocal.
+func (c *ConfigLocal) AddTlfSyncStateHandler(f func(tlf.ID, bool)) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.tlfSyncHandlers = append(c.tlfSyncHandlers, f)
+}
@@ -0,0 +1,213 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/keybase/client/go/logger"
+	"github.com/keybase/kbfs/ioutil"
+	"github.com/keybase/kbfs/tlf"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+// makeConfigLocalWithStorage returns a non-test-mode config that
+// persists its per-TLF settings under `storageRoot`.
+func makeConfigLocalWithStorage(
+	t *testing.T, storageRoot string) *ConfigLocal {
+	log := logger.NewTestLogger(t)
+	loggerFn := func(string) logger.Logger { return log }
+	return NewConfigLocal(NewInitModeFromType(InitDefault), loggerFn,
+		storageRoot, DiskCacheModeOff, nil)
+}
+
+// prefetchToggleBlockOps is a BlockOps that only supports toggling
+// the prefetcher, which is all that changing the sync config needs.
+type prefetchToggleBlockOps struct {
+	BlockOps
+}
+
+func (prefetchToggleBlockOps) TogglePrefetcher(bool) <-chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}
+
+// requireDoneSoon fails the test if `f` doesn't return quickly, e.g.
+// because it deadlocked.
+func requireDoneSoon(t *testing.T, f func() error) {
+	errCh := make(chan error, 1)
+	go func() { errCh <- f() }()
+	select {
+	case err := <-errCh:
+		require.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("Timed out; deadlocked?")
+	}
+}
+
+func TestConfigLocalSetTlfSyncConfigPersists(t *testing.T) {
+	tempdir, err := ioutil.TempDir(os.TempDir(), "config_local")
+	require.NoError(t, err)
+	defer func() {
+		err := ioutil.RemoveAll(tempdir)
+		require.NoError(t, err)
+	}()
+	config := makeConfigLocalWithStorage(t, tempdir)
+	// Pretend there's a sync cache, since the config refuses to sync
+	// TLFs without one.
+	config.diskBlockCache = &diskBlockCacheWrapped{
+		syncCache: &DiskBlockCacheLocal{}}
+	config.SetBlockOps(prefetchToggleBlockOps{})
+
+	syncedTlf := tlf.FakeID(1, tlf.Private)
+	partialTlf := tlf.FakeID(2, tlf.Private)
+	unsyncedTlf := tlf.FakeID(3, tlf.Private)
+	requireDoneSoon(t, func() error {
+		return config.SetTlfSyncState(syncedTlf, true)
+	})
+	requireDoneSoon(t, func() error {
+		return config.SetTlfSyncPaths(partialTlf, []string{"a/b"})
+	})
+	requireDoneSoon(t, func() error {
+		return config.SetTlfSyncState(unsyncedTlf, true)
+	})
+	requireDoneSoon(t, func() error {
+		return config.SetTlfSyncState(unsyncedTlf, false)
+	})
+
+	t.Log("A new config reads back the same sync config.")
+	config2 := makeConfigLocalWithStorage(t, tempdir)
+	requireDoneSoon(t, func() error {
+		config2.lock.Lock()
+		defer config2.lock.Unlock()
+		return config2.loadSyncedTlfsLocked()
+	})
+	require.True(t, config2.IsSyncedTlf(syncedTlf))
+	require.False(t, config2.IsSyncedTlf(partialTlf))
+	require.Equal(t, []string{"a/b"}, config2.GetTlfSyncPaths(partialTlf))
+	require.False(t, config2.IsSyncedTlf(unsyncedTlf))
+	require.Empty(t, config2.GetTlfSyncPaths(unsyncedTlf))
+}
+
+func TestConfigLocalSetDiskCacheTlfSettingsPersists(t *testing.T) {
+	tempdir, err := ioutil.TempDir(os.TempDir(), "config_local")
+	require.NoError(t, err)
+	defer func() {
+		err := ioutil.RemoveAll(tempdir)
+		require.NoError(t, err)
+	}()
+	config := makeConfigLocalWithStorage(t, tempdir)
+	ctx := context.Background()
+
+	pinnedTlf := tlf.FakeID(1, tlf.Private)
+	limitedTlf := tlf.FakeID(2, tlf.Private)
+	resetTlf := tlf.FakeID(3, tlf.Private)
+	pinned := DiskCacheTlfSettings{Pinned: true}
+	limited := DiskCacheTlfSettings{LimitBytes: 1024}
+	requireDoneSoon(t, func() error {
+		return config.SetDiskCacheTlfSettings(ctx, pinnedTlf, pinned)
+	})
+	requireDoneSoon(t, func() error {
+		return config.SetDiskCacheTlfSettings(ctx, limitedTlf, limited)
+	})
+	requireDoneSoon(t, func() error {
+		return config.SetDiskCacheTlfSettings(ctx, resetTlf, pinned)
+	})
+	requireDoneSoon(t, func() error {
+		return config.SetDiskCacheTlfSettings(
+			ctx, resetTlf, DiskCacheTlfSettings{})
+	})
+	require.Equal(t, pinned, config.GetDiskCacheTlfSettings(pinnedTlf))
+
+	t.Log("A new config reads back the same settings.")
+	config2 := makeConfigLocalWithStorage(t, tempdir)
+	requireDoneSoon(t, func() error {
+		config2.lock.Lock()
+		defer config2.lock.Unlock()
+		return config2.loadDiskCacheTlfSettingsLocked()
+	})
+	require.Equal(t, pinned, config2.GetDiskCacheTlfSettings(pinnedTlf))
+	require.Equal(t, limited, config2.GetDiskCacheTlfSettings(limitedTlf))
+	require.Equal(t, DiskCacheTlfSettings{},
+		config2.GetDiskCacheTlfSettings(resetTlf))
+}
+
+func TestConfigLocalPerTlfSettingsPersistence(t *testing.T) {
+	tempdir, err := ioutil.TempDir(os.TempDir(), "config_local")
+	require.NoError(t, err)
+	defer func() {
+		err := ioutil.RemoveAll(tempdir)
+		require.NoError(t, err)
+	}()
+	config := makeConfigLocalWithStorage(t, tempdir)
+
+	syncedTlf := tlf.FakeID(1, tlf.Private)
+	partialTlf := tlf.FakeID(2, tlf.Private)
+	unsyncedTlf := tlf.FakeID(3, tlf.Private)
+	settings := DiskCacheTlfSettings{Pinned: true, LimitBytes: 100}
+	period, minHeadAge := time.Hour, time.Duration(0)
+	policy := QuotaReclamationTlfPolicy{
+		MinHeadAge: &minHeadAge,
+		Period:     &period,
+	}
+	conflictTmpl := ".conflicts/{{.Original}}.{{.User}}"
+
+	config.lock.Lock()
+	require.NoError(t, config.storeTlfConfigLocked(
+		syncedTlfConfigFolderName, syncedTlf, nil, false))
+	require.NoError(t, config.storeTlfConfigLocked(
+		syncedTlfConfigFolderName, partialTlf, []string{"a/b"}, false))
+	require.NoError(t, config.storeTlfConfigLocked(
+		syncedTlfConfigFolderName, unsyncedTlf, nil, false))
+	require.NoError(t, config.storeTlfConfigLocked(
+		syncedTlfConfigFolderName, unsyncedTlf, nil, true))
+	require.NoError(t, config.storeTlfConfigLocked(
+		diskCacheTlfConfigFolderName, syncedTlf, settings, false))
+	require.NoError(t, config.storeTlfConfigLocked(
+		qrTlfConfigFolderName, syncedTlf, policy, false))
+	require.NoError(t, config.storeTlfConfigLocked(
+		conflictTlfConfigFolderName, syncedTlf, conflictTmpl, false))
+
+	t.Log("Add entries that can't be parsed; loading drops them.")
+	ldb, err := config.openConfigLevelDB(qrTlfConfigFolderName)
+	require.NoError(t, err)
+	require.NoError(t, ldb.Put([]byte("not a TLF"), nil, nil))
+	partialBytes, err := partialTlf.MarshalText()
+	require.NoError(t, err)
+	require.NoError(t, ldb.Put(partialBytes, []byte{0xc1}, nil))
+	require.NoError(t, ldb.Close())
+
+	require.NoError(t, config.loadSyncedTlfsLocked())
+	require.NoError(t, config.loadDiskCacheTlfSettingsLocked())
+	require.NoError(t, config.loadQuotaReclamationTlfPoliciesLocked())
+	require.NoError(t, config.loadConflictRenameTemplatesLocked())
+	config.lock.Unlock()
+
+	require.True(t, config.IsSyncedTlf(syncedTlf))
+	require.False(t, config.IsSyncedTlf(partialTlf))
+	require.Equal(t, []string{"a/b"}, config.GetTlfSyncPaths(partialTlf))
+	require.False(t, config.IsSyncedTlf(unsyncedTlf))
+	require.Equal(t, settings, config.GetDiskCacheTlfSettings(syncedTlf))
+	require.Equal(t, policy, config.GetQuotaReclamationTlfPolicy(syncedTlf))
+	require.Equal(t, QuotaReclamationTlfPolicy{},
+		config.GetQuotaReclamationTlfPolicy(partialTlf))
+	require.Equal(t, conflictTmpl, config.GetConflictRenameTemplate(syncedTlf))
+	require.Equal(t, "", config.GetConflictRenameTemplate(partialTlf))
+	require.Error(t, config.SetConflictRenameTemplate(partialTlf, "{{.Base"))
+
+	ldb, err = config.openConfigLevelDB(qrTlfConfigFolderName)
+	require.NoError(t, err)
+	defer ldb.Close()
+	has, err := ldb.Has([]byte("not a TLF"), nil)
+	require.NoError(t, err)
+	require.False(t, has)
+	has, err = ldb.Has(partialBytes, nil)
+	require.NoError(t, err)
+	require.False(t, has)
+}
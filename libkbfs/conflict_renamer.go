@@ -5,12 +5,16 @@
 package libkbfs
 
 import (
+	"bytes"
 	"fmt"
+	"strings"
+	"text/template"
 	"time"
 
 	"github.com/keybase/client/go/protocol/keybase1"
 	"github.com/keybase/kbfs/kbfscrypto"
 	"github.com/keybase/kbfs/kbfsmd"
+	"github.com/pkg/errors"
 	"golang.org/x/net/context"
 )
 
@@ -20,19 +24,28 @@ type WriterDeviceDateConflictRenamer struct {
 	config Config
 }
 
+// conflictRenameWriter returns the name of the user and device that
+// wrote the given op, for use in conflicted names.
+func conflictRenameWriter(ctx context.Context, config Config, op op) (
+	user, device string, err error) {
+	winfo := op.getWriterInfo()
+	ui, err := config.KeybaseService().LoadUserPlusKeys(ctx, winfo.uid, "")
+	if err != nil {
+		return "", "", err
+	}
+	return string(ui.Name), ui.KIDNames[winfo.key.KID()], nil
+}
+
 // ConflictRename implements the ConflictRename interface for
 // TimeAndWriterConflictRenamer.
 func (cr WriterDeviceDateConflictRenamer) ConflictRename(
 	ctx context.Context, op op, original string) (string, error) {
 	now := cr.config.Clock().Now()
-	winfo := op.getWriterInfo()
-	ui, err := cr.config.KeybaseService().LoadUserPlusKeys(ctx, winfo.uid, "")
+	user, deviceName, err := conflictRenameWriter(ctx, cr.config, op)
 	if err != nil {
 		return "", err
 	}
-	deviceName := ui.KIDNames[winfo.key.KID()]
-	return cr.ConflictRenameHelper(
-		now, string(ui.Name), deviceName, original), nil
+	return cr.ConflictRenameHelper(now, user, deviceName, original), nil
 }
 
 // ConflictRenameHelper is a helper for ConflictRename especially useful from
@@ -47,6 +60,130 @@ func (WriterDeviceDateConflictRenamer) ConflictRenameHelper(t time.Time, user, d
 		base, user, device, date, ext)
 }
 
+// ConflictRenameData is the data available to the template of a
+// TemplateConflictRenamer.
+type ConflictRenameData struct {
+	// Original is the original name of the conflicted entry, and
+	// Base and Ext are that name split into a base name and an
+	// extension (including the leading dot), which may be empty.
+	Original string
+	Base     string
+	Ext      string
+	// User and Device name the writer of the conflicting change.
+	User   string
+	Device string
+	// Date is the day of the conflict resolution, as YYYY-MM-DD.
+	Date string
+	// Revision is the TLF revision of the conflicting change.
+	Revision kbfsmd.Revision
+}
+
+// TemplateConflictRenamer renames a conflicted entry according to a
+// text/template over ConflictRenameData, e.g.
+// "{{.Base}} (conflict {{.Revision}}){{.Ext}}".  The new name may
+// start with the name of a subdirectory of the conflicted entry's
+// directory, e.g. ".conflicts/{{.Original}}.{{.User}}", in which case
+// conflict resolution puts the conflicted copy of a file whose
+// contents conflict into that subdirectory, creating it if needed.
+// Other conflicted entries are just renamed in place, using the last
+// component of the new name.
+type TemplateConflictRenamer struct {
+	config Config
+	tmpl   *template.Template
+}
+
+var _ ConflictRenamer = (*TemplateConflictRenamer)(nil)
+
+// NewTemplateConflictRenamer returns a new TemplateConflictRenamer
+// for the given template text.
+func NewTemplateConflictRenamer(config Config, text string) (
+	*TemplateConflictRenamer, error) {
+	tmpl, err := template.New("conflict").Option("missingkey=error").Parse(
+		text)
+	if err != nil {
+		return nil, errors.Wrap(err, "Couldn't parse conflict template")
+	}
+	return &TemplateConflictRenamer{config, tmpl}, nil
+}
+
+// ConflictRename implements the ConflictRename interface for
+// TemplateConflictRenamer.
+func (cr *TemplateConflictRenamer) ConflictRename(
+	ctx context.Context, op op, original string) (string, error) {
+	user, device, err := conflictRenameWriter(ctx, cr.config, op)
+	if err != nil {
+		return "", err
+	}
+	return cr.ConflictRenameHelper(
+		cr.config.Clock().Now(), user, device, op.getWriterInfo().revision,
+		original)
+}
+
+// ConflictRenameHelper is a helper for ConflictRename especially
+// useful from tests.
+func (cr *TemplateConflictRenamer) ConflictRenameHelper(
+	t time.Time, user, device string, rev kbfsmd.Revision,
+	original string) (string, error) {
+	if device == "" {
+		device = "unknown"
+	}
+	base, ext := splitExtension(original)
+	data := ConflictRenameData{
+		Original: original,
+		Base:     base,
+		Ext:      ext,
+		User:     user,
+		Device:   device,
+		Date:     t.Format("2006-01-02"),
+		Revision: rev,
+	}
+	var buf bytes.Buffer
+	err := cr.tmpl.Execute(&buf, data)
+	if err != nil {
+		return "", err
+	}
+	name := buf.String()
+	dir, leaf := splitConflictName(name)
+	if !validConflictNameComponent(leaf) ||
+		(dir == "" && (name != leaf || leaf == original)) ||
+		(dir != "" && !validConflictNameComponent(dir)) {
+		return "", errors.Errorf(
+			"Conflict template gave invalid name %q for %q", name, original)
+	}
+	return name, nil
+}
+
+// splitConflictName splits a name given by a ConflictRenamer into
+// the subdirectory the conflicted entry should be placed in (empty
+// for the entry's own directory), and the new name of the entry.
+func splitConflictName(name string) (dir, leaf string) {
+	i := strings.IndexByte(name, '/')
+	if i < 0 {
+		return "", name
+	}
+	return name[:i], name[i+1:]
+}
+
+// conflictRenameInPlace returns the new name `renamer` gives to the
+// conflicted entry `original`, without any subdirectory, for
+// conflicts where the entry must stay in its own directory.
+func conflictRenameInPlace(ctx context.Context, renamer ConflictRenamer,
+	op op, original string) (string, error) {
+	name, err := renamer.ConflictRename(ctx, op, original)
+	if err != nil {
+		return "", err
+	}
+	_, leaf := splitConflictName(name)
+	return leaf, nil
+}
+
+// validConflictNameComponent returns true if `name` can be used as
+// a single path component of a conflicted name.
+func validConflictNameComponent(name string) bool {
+	return name != "" && name != "." && name != ".." &&
+		!strings.ContainsAny(name, `/\`)
+}
+
 // splitExtension splits filename into a base name and the extension.
 func splitExtension(path string) (string, string) {
 	for i := len(path) - 1; i > 0; i-- {
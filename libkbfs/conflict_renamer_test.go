@@ -6,6 +6,10 @@ package libkbfs
 
 import (
 	"testing"
+	"time"
+
+	"github.com/keybase/kbfs/kbfsmd"
+	"github.com/stretchr/testify/require"
 )
 
 func testSplitExtension(t *testing.T, s, base, ext string) {
@@ -30,3 +34,42 @@ func TestSplitExtension(t *testing.T) {
 	testSplitExtension(t, "weird. is this?", "weird. is this?", "")
 	testSplitExtension(t, "", "", "")
 }
+
+func TestTemplateConflictRenamer(t *testing.T) {
+	cr, err := NewTemplateConflictRenamer(
+		nil, "{{.Base}} ({{.User}} {{.Device}} {{.Date}} r{{.Revision}}){{.Ext}}")
+	require.NoError(t, err)
+	now := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	name, err := cr.ConflictRenameHelper(
+		now, "alice", "", kbfsmd.Revision(12), "foo.tar.gz")
+	require.NoError(t, err)
+	require.Equal(t, "foo (alice unknown 2018-01-02 r12).tar.gz", name)
+
+	t.Log("Names that don't change or that leave the directory fail")
+	cr, err = NewTemplateConflictRenamer(nil, "{{.Original}}")
+	require.NoError(t, err)
+	_, err = cr.ConflictRenameHelper(now, "alice", "d", 1, "foo")
+	require.Error(t, err)
+	cr, err = NewTemplateConflictRenamer(nil, "../{{.Original}}")
+	require.NoError(t, err)
+	_, err = cr.ConflictRenameHelper(now, "alice", "d", 1, "foo")
+	require.Error(t, err)
+	cr, err = NewTemplateConflictRenamer(nil, "a/b/{{.Original}}")
+	require.NoError(t, err)
+	_, err = cr.ConflictRenameHelper(now, "alice", "d", 1, "foo")
+	require.Error(t, err)
+
+	t.Log("A single leading subdirectory is allowed")
+	cr, err = NewTemplateConflictRenamer(
+		nil, ".conflicts/{{.Base}}.{{.User}}{{.Ext}}")
+	require.NoError(t, err)
+	name, err = cr.ConflictRenameHelper(now, "alice", "d", 1, "foo.txt")
+	require.NoError(t, err)
+	require.Equal(t, ".conflicts/foo.alice.txt", name)
+	dir, leaf := splitConflictName(name)
+	require.Equal(t, ".conflicts", dir)
+	require.Equal(t, "foo.alice.txt", leaf)
+
+	_, err = NewTemplateConflictRenamer(nil, "{{.Base")
+	require.Error(t, err)
+}
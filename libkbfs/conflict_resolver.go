@@ -70,6 +70,14 @@ type ConflictResolver struct {
 	currCancel    context.CancelFunc
 	lockNextTime  bool
 	canceledCount int
+	// manualChoices maps paths relative to the TLF root to the
+	// version of the file the user wants to keep, for content
+	// conflicts in the next resolution.
+	manualChoices map[string]ConflictChoice
+
+	// manualLock serializes manual resolutions with pausing and
+	// restarting automatic ones.
+	manualLock sync.Mutex
 }
 
 // NewConflictResolver constructs a new ConflictResolver (and launches
@@ -2009,6 +2017,7 @@ func (cr *ConflictResolver) getActionsToMerge(
 	mergedPaths map[BlockPointer]path) (
 	map[BlockPointer]crActionList, error) {
 	actionMap := make(map[BlockPointer]crActionList)
+	renamer := cr.conflictRenamer(ctx)
 	for unmergedMostRecent, unmergedChain := range unmergedChains.byMostRecent {
 		original := unmergedChain.original
 		// If this is a file that has been deleted in the merged
@@ -2032,8 +2041,7 @@ func (cr *ConflictResolver) getActionsToMerge(
 		}
 
 		actions, err := unmergedChain.getActionsToMerge(
-			ctx, cr.config.ConflictRenamer(), mergedPath,
-			mergedChain)
+			ctx, renamer, mergedPath, mergedChain)
 		if err != nil {
 			return nil, err
 		}
@@ -2156,6 +2164,72 @@ func collapseActions(unmergedChains *crChains, unmergedPaths []path,
 	return newUnmergedPaths
 }
 
+// conflictRenamer returns the renamer to use for conflicts in this
+// TLF: a TemplateConflictRenamer if the TLF has its own template,
+// and the global renamer otherwise.
+func (cr *ConflictResolver) conflictRenamer(
+	ctx context.Context) ConflictRenamer {
+	text := cr.config.GetConflictRenameTemplate(cr.fbo.id())
+	if text == "" {
+		return cr.config.ConflictRenamer()
+	}
+	renamer, err := NewTemplateConflictRenamer(cr.config, text)
+	if err != nil {
+		cr.log.CDebugf(ctx, "Ignoring bad conflict template %q: %+v",
+			text, err)
+		return cr.config.ConflictRenamer()
+	}
+	return renamer
+}
+
+// crConflictedPath describes an entry that was renamed while
+// resolving a conflict.
+type crConflictedPath struct {
+	Original string `json:"original"`
+	Renamed  string `json:"renamed"`
+}
+
+// conflictedPaths returns the full original and new paths of every
+// entry renamed because of a conflict by the actions in `actionMap`,
+// which must be keyed by the tail pointers of merged directories.
+func conflictedPaths(actionMap map[BlockPointer]crActionList,
+	mergedPaths map[BlockPointer]path) (res []crConflictedPath) {
+	dirPaths := make(map[BlockPointer]path, len(mergedPaths))
+	for _, p := range mergedPaths {
+		dirPaths[p.tailPointer()] = p
+	}
+	for ptr, actions := range actionMap {
+		dirPath, ok := dirPaths[ptr]
+		if !ok {
+			continue
+		}
+		for _, action := range actions {
+			var fromName, toName string
+			switch a := action.(type) {
+			case *renameUnmergedAction:
+				fromName, toName = a.fromName, a.toName
+			case *renameMergedAction:
+				fromName, toName = a.fromName, a.toName
+			case *copyUnmergedEntryAction:
+				fromName, toName = a.fromName, a.toName
+			default:
+				continue
+			}
+			if fromName == toName {
+				continue
+			}
+			res = append(res, crConflictedPath{
+				Original: dirPath.ChildPathNoPtr(fromName).CanonicalPathString(),
+				Renamed:  dirPath.ChildPathNoPtr(toName).CanonicalPathString(),
+			})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Original < res[j].Original
+	})
+	return res
+}
+
 func (cr *ConflictResolver) computeActions(ctx context.Context,
 	unmergedChains, mergedChains *crChains, unmergedPaths []path,
 	mergedPaths map[BlockPointer]path, recreateOps []*createOp,
@@ -2279,11 +2353,115 @@ func (cr *ConflictResolver) makeFileBlockDeepCopy(ctx context.Context,
 	return newPtr, nil
 }
 
+// crConflictDirKey identifies a conflict subdirectory by the merged
+// pointer of its parent directory and its name.
+type crConflictDirKey struct {
+	parent BlockPointer
+	name   string
+}
+
+// getConflictDir returns the subdirectory `name` of the merged
+// directory at `mergedPath`, into which conflicted copies of files
+// from that directory are put.  It copies the subdirectory's block
+// into `lbc`, or makes a new block there if the subdirectory doesn't
+// exist yet, and returns nil if `name` is taken by a non-directory.
+// Any returned unmerged paths must be resolved along with the rest.
+func (cr *ConflictResolver) getConflictDir(ctx context.Context,
+	lState *lockState, unmergedChains, mergedChains *crChains,
+	unmergedPath, mergedPath path, mergedBlock *DirBlock, name string,
+	conflictDirs map[crConflictDirKey]*crConflictDir,
+	mergedPaths map[BlockPointer]path, lbc localBcache,
+	newFileBlocks fileBlockMap, dirtyBcache DirtyBlockCache) (
+	*crConflictDir, []path, error) {
+	key := crConflictDirKey{mergedPath.tailPointer(), name}
+	if cd, ok := conflictDirs[key]; ok {
+		return cd, nil, nil
+	}
+
+	kmd := mergedChains.mostRecentChainMDInfo
+	cd := &crConflictDir{name: name}
+	if de, ok := mergedBlock.Children[name]; ok {
+		if de.Type != Dir {
+			return nil, nil, nil
+		}
+		cd.ptr = de.BlockPointer
+		block, err := cr.fetchDirBlockCopy(
+			ctx, lState, kmd, mergedPath.ChildPath(name, cd.ptr), lbc)
+		if err != nil {
+			return nil, nil, err
+		}
+		cd.block = block
+		original, err := mergedChains.originalFromMostRecentOrSame(cd.ptr)
+		if err != nil {
+			return nil, nil, err
+		}
+		cd.unmergedPtr, err =
+			unmergedChains.mostRecentFromOriginalOrSame(original)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		chargedTo, err := chargedToForTLF(
+			ctx, cr.config.KBPKI(), cr.config.KBPKI(), kmd.GetTlfHandle())
+		if err != nil {
+			return nil, nil, err
+		}
+		id, err := cr.config.cryptoPure().MakeTemporaryBlockID()
+		if err != nil {
+			return nil, nil, err
+		}
+		cd.ptr = BlockPointer{
+			ID:         id,
+			KeyGen:     kmd.LatestKeyGeneration(),
+			DataVer:    cr.config.DataVersion(),
+			DirectType: DirectBlock,
+			Context: kbfsblock.MakeFirstContext(
+				chargedTo, cr.config.DefaultBlockType()),
+		}
+		cd.isNew = true
+		cd.unmergedPtr = cd.ptr
+		cd.block = NewDirBlock().(*DirBlock)
+		lbc[cd.ptr] = cd.block
+		now := cr.config.Clock().Now().UnixNano()
+		mergedBlock.Children[name] = DirEntry{
+			BlockInfo: BlockInfo{BlockPointer: cd.ptr},
+			EntryInfo: EntryInfo{
+				Type:  Dir,
+				Mtime: now,
+				Ctime: now,
+			},
+		}
+		// Mark it as created in this branch, so the resolution
+		// treats its new block as a plain reference.  Its temporary
+		// pointer never reaches the server, so it must never be
+		// unreferenced either.
+		unmergedChains.createdOriginals[cd.ptr] = true
+		unmergedChains.doNotUnrefPointers[cd.ptr] = true
+	}
+	cd.copier = func(ctx context.Context, name string,
+		ptr BlockPointer) (BlockPointer, error) {
+		return cr.makeFileBlockDeepCopy(ctx, lState, unmergedChains,
+			cd.ptr, unmergedPath, name, ptr, newFileBlocks, dirtyBcache)
+	}
+	conflictDirs[key] = cd
+	cr.log.CDebugf(ctx, "Using conflict directory %s (%v, new=%t) in %v",
+		name, cd.ptr, cd.isNew, mergedPath.tailPointer())
+
+	if _, ok := mergedPaths[cd.unmergedPtr]; ok {
+		return cd, nil, nil
+	}
+	mergedPaths[cd.unmergedPtr] = mergedPath.ChildPath(name, cd.ptr)
+	return cd, []path{unmergedPath.ChildPath(name, cd.unmergedPtr)}, nil
+}
+
+// doActions executes the actions in `actionMap`, and returns any
+// new unmerged paths that need to be resolved because of them.
 func (cr *ConflictResolver) doActions(ctx context.Context,
 	lState *lockState, unmergedChains, mergedChains *crChains,
 	unmergedPaths []path, mergedPaths map[BlockPointer]path,
 	actionMap map[BlockPointer]crActionList, lbc localBcache,
-	newFileBlocks fileBlockMap, dirtyBcache DirtyBlockCache) error {
+	newFileBlocks fileBlockMap, dirtyBcache DirtyBlockCache) (
+	newUnmergedPaths []path, err error) {
 	// For each set of actions:
 	//   * Find the corresponding chains
 	//   * Make a reference to each slice of ops
@@ -2296,12 +2474,13 @@ func (cr *ConflictResolver) doActions(ctx context.Context,
 	// updated merged blocks.  A future phase will update the pointers
 	// in standard Merkle-tree-fashion.
 	doneActions := make(map[BlockPointer]bool)
+	conflictDirs := make(map[crConflictDirKey]*crConflictDir)
 	for _, unmergedPath := range unmergedPaths {
 		unmergedMostRecent := unmergedPath.tailPointer()
 		unmergedChain, ok :=
 			unmergedChains.byMostRecent[unmergedMostRecent]
 		if !ok {
-			return fmt.Errorf("Couldn't find unmerged chain for %v",
+			return nil, fmt.Errorf("Couldn't find unmerged chain for %v",
 				unmergedMostRecent)
 		}
 
@@ -2328,7 +2507,7 @@ func (cr *ConflictResolver) doActions(ctx context.Context,
 		unmergedBlock, err := cr.fetchDirBlockCopy(ctx, lState,
 			unmergedChains.mostRecentChainMDInfo, unmergedPath, lbc)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		if unmergedPath.tailPointer() == mergedPath.tailPointer() {
@@ -2355,7 +2534,7 @@ func (cr *ConflictResolver) doActions(ctx context.Context,
 			mergedBlock, err = cr.fetchDirBlockCopy(ctx, lState,
 				mergedChains.mostRecentChainMDInfo, mergedPath, lbc)
 			if err != nil {
-				return err
+				return nil, err
 			}
 		}
 
@@ -2378,13 +2557,60 @@ func (cr *ConflictResolver) doActions(ctx context.Context,
 					ptr, newFileBlocks, dirtyBcache)
 			}
 
+			// Keep the version of each content conflict chosen by
+			// the user, merge the content conflicts that can be
+			// merged, and find the subdirectories that the other
+			// conflicted copies go into.
+			for _, action := range actions {
+				rua, ok := action.(*renameUnmergedAction)
+				if !ok || !rua.contentConflict {
+					continue
+				}
+				var err error
+				choice := cr.manualChoice(mergedPath, rua.fromName)
+				if choice != ConflictChoiceBoth {
+					err = cr.chooseContentConflictVersion(ctx, lState,
+						mergedChains, mergedPath, unmergedBlock,
+						mergedBlock, rua, choice)
+				} else {
+					err = cr.mergeContentConflict(ctx, lState,
+						unmergedChains, mergedChains, mergedPath,
+						unmergedBlock, mergedBlock, rua, newFileBlocks)
+				}
+				if err != nil {
+					return nil, err
+				}
+				if rua.keepsOneVersion() {
+					continue
+				}
+				dirName, leaf := splitConflictName(rua.toName)
+				if dirName == "" {
+					continue
+				}
+				cd, paths, err := cr.getConflictDir(ctx, lState,
+					unmergedChains, mergedChains, unmergedPath, mergedPath,
+					mergedBlock, dirName, conflictDirs, mergedPaths, lbc,
+					newFileBlocks, dirtyBcache)
+				if err != nil {
+					return nil, err
+				}
+				if cd == nil {
+					cr.log.CDebugf(ctx, "%s is not a directory, so renaming "+
+						"%s in place", dirName, rua.fromName)
+					rua.toName = leaf
+					continue
+				}
+				rua.toDir = cd
+				newUnmergedPaths = append(newUnmergedPaths, paths...)
+			}
+
 			// Execute each action and save the modified ops back into
 			// each chain.
 			for _, action := range actions {
 				swap, newPtr, err := action.swapUnmergedBlock(unmergedChains,
 					mergedChains, unmergedBlock)
 				if err != nil {
-					return err
+					return nil, err
 				}
 				uBlock := unmergedBlock
 				if swap {
@@ -2401,7 +2627,7 @@ func (cr *ConflictResolver) doActions(ctx context.Context,
 							ctx, lState, mergedChains.mostRecentChainMDInfo,
 							newPtr, mergedPath.Branch, path{})
 						if err != nil {
-							return err
+							return nil, err
 						}
 						uBlock = dBlock
 					}
@@ -2410,7 +2636,7 @@ func (cr *ConflictResolver) doActions(ctx context.Context,
 				err = action.do(ctx, unmergedFetcher, mergedFetcher, uBlock,
 					mergedBlock)
 				if err != nil {
-					return err
+					return nil, err
 				}
 			}
 		}
@@ -2430,11 +2656,11 @@ func (cr *ConflictResolver) doActions(ctx context.Context,
 			err := action.updateOps(unmergedMostRecent, mergedMostRecent,
 				unmergedBlock, mergedBlock, unmergedChains, mergedChains)
 			if err != nil {
-				return err
+				return nil, err
 			}
 		}
 	}
-	return nil
+	return newUnmergedPaths, nil
 }
 
 type crRenameHelperKey struct {
@@ -2608,6 +2834,10 @@ func (cr *ConflictResolver) createResolvedMD(ctx context.Context,
 		return nil, err
 	}
 
+	inPaths := make(map[BlockPointer]bool, len(unmergedPaths))
+	for _, p := range unmergedPaths {
+		inPaths[p.tailPointer()] = true
+	}
 	var newPaths []path
 	for original, chain := range unmergedChains.byOriginal {
 		added := false
@@ -2633,7 +2863,7 @@ func (cr *ConflictResolver) createResolvedMD(ctx context.Context,
 						return nil, err
 					}
 					chain.ops[i] = &newCreateOp
-					if !added {
+					if !added && !inPaths[chain.mostRecent] {
 						newPaths = append(newPaths, path{
 							FolderBranch: cr.fbo.folderBranch,
 							path: []pathNode{{
@@ -3366,11 +3596,17 @@ func (cr *ConflictResolver) doResolve(ctx context.Context, ci conflictInput) {
 	dirtyBcache := simpleDirtyBlockCacheStandard()
 	// Simple dirty bcaches don't need to be shut down.
 
-	err = cr.doActions(ctx, lState, unmergedChains, mergedChains,
-		unmergedPaths, mergedPaths, actionMap, lbc, newFileBlocks, dirtyBcache)
+	newUnmergedPaths, err = cr.doActions(ctx, lState, unmergedChains,
+		mergedChains, unmergedPaths, mergedPaths, actionMap, lbc,
+		newFileBlocks, dirtyBcache)
 	if err != nil {
 		return
 	}
+	if len(newUnmergedPaths) > 0 {
+		unmergedPaths = append(unmergedPaths, newUnmergedPaths...)
+		sort.Sort(crSortedPaths(unmergedPaths))
+	}
+	conflicts := conflictedPaths(actionMap, mergedPaths)
 
 	err = cr.checkDone(ctx)
 	if err != nil {
@@ -3389,6 +3625,18 @@ func (cr *ConflictResolver) doResolve(ctx context.Context, ci conflictInput) {
 		return
 	}
 
+	if len(conflicts) > 0 {
+		handle := mostRecentMergedMD.GetTlfHandle()
+		cr.log.CDebugf(ctx, "Renamed %d conflicted entries", len(conflicts))
+		n, err := conflictNotification(handle, conflicts)
+		if err != nil {
+			cr.log.CDebugf(ctx, "Couldn't make conflict notification: %+v",
+				err)
+		} else {
+			cr.config.Reporter().Notify(ctx, n)
+		}
+	}
+
 	// TODO: If conflict resolution fails after some blocks were put,
 	// remember these and include them in the later resolution so they
 	// don't count against the quota forever.  (Though of course if we
@@ -1087,9 +1087,9 @@ func TestCRMergedChainsConflictSimple(t *testing.T) {
 	cre := WriterDeviceDateConflictRenamer{}
 	expectedActions := map[BlockPointer]crActionList{
 		mergedPathRoot.tailPointer(): {&renameUnmergedAction{
-			"file1",
-			cre.ConflictRenameHelper(now, "u2", "dev1", "file1"),
-			"", 0, false, zeroPtr, zeroPtr}},
+			fromName: "file1",
+			toName:   cre.ConflictRenameHelper(now, "u2", "dev1", "file1"),
+		}},
 	}
 
 	testCRCheckPathsAndActions(t, cr2, []path{unmergedPathRoot},
@@ -1206,9 +1206,9 @@ func TestCRMergedChainsConflictFileCollapse(t *testing.T) {
 	// Both unmerged actions should collapse into just one rename operation
 	expectedActions := map[BlockPointer]crActionList{
 		mergedPathRoot.tailPointer(): {&renameUnmergedAction{
-			"file",
-			cre.ConflictRenameHelper(now, "u2", "dev1", "file"),
-			"", 0, false, zeroPtr, zeroPtr}},
+			fromName: "file",
+			toName:   cre.ConflictRenameHelper(now, "u2", "dev1", "file"),
+		}},
 	}
 
 	testCRCheckPathsAndActions(t, cr2, []path{unmergedPathFile},
@@ -1288,7 +1288,7 @@ func TestCRDoActionsSimple(t *testing.T) {
 	lbc := make(localBcache)
 	newFileBlocks := make(fileBlockMap)
 	dirtyBcache := simpleDirtyBlockCacheStandard()
-	err = cr2.doActions(ctx, lState, unmergedChains, mergedChains,
+	_, err = cr2.doActions(ctx, lState, unmergedChains, mergedChains,
 		unmergedPaths, mergedPaths, actionMap, lbc, newFileBlocks, dirtyBcache)
 	if err != nil {
 		t.Fatalf("Couldn't do actions: %v", err)
@@ -1411,7 +1411,7 @@ func TestCRDoActionsWriteConflict(t *testing.T) {
 	lbc := make(localBcache)
 	newFileBlocks := make(fileBlockMap)
 	dirtyBcache := simpleDirtyBlockCacheStandard()
-	err = cr2.doActions(ctx, lState, unmergedChains, mergedChains,
+	_, err = cr2.doActions(ctx, lState, unmergedChains, mergedChains,
 		unmergedPaths, mergedPaths, actionMap, lbc, newFileBlocks, dirtyBcache)
 	if err != nil {
 		t.Fatalf("Couldn't do actions: %v", err)
@@ -488,6 +488,69 @@ func (rmea *rmMergedEntryAction) String() string {
 	return fmt.Sprintf("rmMergedEntry: %s", rmea.name)
 }
 
+// crConflictDir is a subdirectory of a merged directory, into which
+// conflicted copies of files from that directory are put.
+type crConflictDir struct {
+	name string
+	// ptr is the merged pointer of the directory, or a new temporary
+	// pointer if the resolution creates the directory.
+	ptr   BlockPointer
+	isNew bool
+	// unmergedPtr is the most recent pointer of the directory's
+	// unmerged chain, which holds the creates for the copies.
+	unmergedPtr BlockPointer
+	block       *DirBlock
+	// copier copies the blocks of files put into the directory.
+	copier fileBlockDeepCopier
+	// The ops creating a new directory in the unmerged parent chain,
+	// and in the merged parent chain for local notifications.
+	unmergedCreate, mergedCreate *createOp
+}
+
+// addCreateOps adds the ops that create the new directory `cd` to
+// the chains of its parent, or moves them to the front of the
+// chains if they're already there, so they precede the ops for any
+// copies put into the directory.
+func (cd *crConflictDir) addCreateOps(unmergedParent, mergedParent BlockPointer,
+	unmergedChains, mergedChains *crChains) error {
+	if cd.unmergedCreate == nil {
+		co, err := newCreateOp(cd.name, unmergedParent, Dir)
+		if err != nil {
+			return err
+		}
+		co.AddRefBlock(cd.ptr)
+		cd.unmergedCreate = co
+		co, err = newCreateOp(cd.name, mergedParent, Dir)
+		if err != nil {
+			return err
+		}
+		cd.mergedCreate = co
+	}
+
+	for _, c := range []struct {
+		chains *crChains
+		ptr    BlockPointer
+		co     *createOp
+	}{
+		{unmergedChains, unmergedParent, cd.unmergedCreate},
+		{mergedChains, mergedParent, cd.mergedCreate},
+	} {
+		if chain, ok := c.chains.byMostRecent[c.ptr]; ok {
+			for i, op := range chain.ops {
+				if op == c.co {
+					chain.ops = append(chain.ops[:i], chain.ops[i+1:]...)
+					break
+				}
+			}
+		}
+		err := prependOpsToChain(c.ptr, c.chains, c.co)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // renameUnmergedAction says that the unmerged copy of a file needs to
 // be renamed, and the file blocks should be copied.
 type renameUnmergedAction struct {
@@ -501,6 +564,35 @@ type renameUnmergedAction struct {
 	// chains need to be updated with new create/rename operations.
 	unmergedParentMostRecent BlockPointer
 	mergedParentMostRecent   BlockPointer
+
+	// Set if this conflict is between the contents of two versions
+	// of a file, which might be mergeable.
+	contentConflict bool
+	// Set if the unmerged copy goes into a subdirectory of the
+	// merged directory, named by the first component of toName.
+	toDir *crConflictDir
+	// Set if the two versions of the file were merged line by line
+	// into a new block, already registered as the file's new
+	// contents, of the given length.  Then the merged file keeps its
+	// name, and there is no unmerged copy.
+	merged    bool
+	mergedLen uint64
+	// Set if the user chose to keep only one of the two versions of
+	// the file.  To keep the unmerged version, `do` copies it over
+	// the merged file, and the blocks in `unrefs`, the children of
+	// the merged file, are unreferenced by the resolution.
+	choice ConflictChoice
+	unrefs []BlockPointer
+	// The sizes of the two versions of the file before the
+	// resolution, set by `do` when keeping a single version.
+	oldMergedLen, oldUnmergedLen uint64
+}
+
+// keepsOneVersion returns true if this action resolves a content
+// conflict by keeping a single version of the file under its
+// original name, rather than by renaming the unmerged copy.
+func (rua *renameUnmergedAction) keepsOneVersion() bool {
+	return rua.merged || rua.choice != ConflictChoiceBoth
 }
 
 func crActionCopyFile(ctx context.Context, copier fileBlockDeepCopier,
@@ -559,11 +651,22 @@ func (rua *renameUnmergedAction) swapUnmergedBlock(
 func (rua *renameUnmergedAction) do(ctx context.Context,
 	unmergedCopier fileBlockDeepCopier, mergedCopier fileBlockDeepCopier,
 	unmergedBlock *DirBlock, mergedBlock *DirBlock) error {
-	_, name, err := crActionCopyFile(ctx, unmergedCopier, rua.fromName,
-		rua.toName, rua.symPath, unmergedBlock, mergedBlock)
+	if rua.keepsOneVersion() {
+		return rua.doKeepOne(ctx, unmergedCopier, unmergedBlock, mergedBlock)
+	}
+	toName, toBlock, copier := rua.toName, mergedBlock, unmergedCopier
+	if rua.toDir != nil {
+		_, toName = splitConflictName(rua.toName)
+		toBlock, copier = rua.toDir.block, rua.toDir.copier
+	}
+	_, name, err := crActionCopyFile(ctx, copier, rua.fromName,
+		toName, rua.symPath, unmergedBlock, toBlock)
 	if err != nil {
 		return err
 	}
+	if rua.toDir != nil {
+		name = rua.toDir.name + "/" + name
+	}
 	rua.toName = name
 	return nil
 }
@@ -578,6 +681,11 @@ func (rua *renameUnmergedAction) updateOps(unmergedMostRecent BlockPointer,
 			unmergedMostRecent)
 	}
 
+	if rua.keepsOneVersion() {
+		return rua.updateOpsKeepOne(unmergedMostRecent, mergedMostRecent,
+			unmergedChain, unmergedBlock, unmergedChains, mergedChains)
+	}
+
 	if rua.symPath != "" && !unmergedChain.isFile() {
 		err := crActionConvertSymlink(unmergedMostRecent, mergedMostRecent,
 			unmergedChain, mergedChains, rua.fromName, rua.toName)
@@ -586,15 +694,26 @@ func (rua *renameUnmergedAction) updateOps(unmergedMostRecent BlockPointer,
 		}
 	}
 
+	toName, toBlock := rua.toName, mergedBlock
+	if rua.toDir != nil {
+		if !unmergedChain.isFile() {
+			// The ops for the copy are all fixed up while
+			// processing the file's own chain.
+			return nil
+		}
+		_, toName = splitConflictName(rua.toName)
+		toBlock = rua.toDir.block
+	}
+
 	// Rename all operations with the old name to the new name.
 	unmergedChain.ops =
-		fixupNamesInOps(rua.fromName, rua.toName, unmergedChain.ops,
+		fixupNamesInOps(rua.fromName, toName, unmergedChain.ops,
 			unmergedChains)
 
 	// The newly renamed entry:
-	newMergedEntry, ok := mergedBlock.Children[rua.toName]
+	newMergedEntry, ok := toBlock.Children[toName]
 	if !ok {
-		return NoSuchNameError{rua.toName}
+		return NoSuchNameError{toName}
 	}
 
 	if unmergedChain.isFile() {
@@ -614,6 +733,14 @@ func (rua *renameUnmergedAction) updateOps(unmergedMostRecent BlockPointer,
 				realOp.RefBlocks = nil
 			case *setAttrOp:
 				realOp.File = newMergedEntry.BlockPointer
+				if rua.toDir != nil {
+					var err error
+					realOp.Dir, err = makeBlockUpdate(
+						rua.toDir.unmergedPtr, rua.toDir.unmergedPtr)
+					if err != nil {
+						return err
+					}
+				}
 			}
 		}
 
@@ -650,8 +777,13 @@ func (rua *renameUnmergedAction) updateOps(unmergedMostRecent BlockPointer,
 		return NoSuchNameError{rua.fromName}
 	}
 
-	rop, err := newRenameOp(rua.fromName, mergedMostRecent, rua.toName,
-		mergedMostRecent, newMergedEntry.BlockPointer,
+	toDirMergedPtr, toDirUnmergedPtr := mergedMostRecent, unmergedMostRecent
+	if rua.toDir != nil {
+		toDirMergedPtr = rua.toDir.ptr
+		toDirUnmergedPtr = rua.toDir.unmergedPtr
+	}
+	rop, err := newRenameOp(rua.fromName, mergedMostRecent, toName,
+		toDirMergedPtr, newMergedEntry.BlockPointer,
 		newMergedEntry.Type)
 	if err != nil {
 		return err
@@ -672,14 +804,26 @@ func (rua *renameUnmergedAction) updateOps(unmergedMostRecent BlockPointer,
 	if err != nil {
 		return err
 	}
+	if rua.toDir != nil && rua.toDir.isNew {
+		err = rua.toDir.addCreateOps(
+			unmergedMostRecent, mergedMostRecent, unmergedChains,
+			mergedChains)
+		if err != nil {
+			return err
+		}
+	}
 
 	// Before merging the unmerged ops, create a file with the new
 	// name, unless the create already exists.
 	found := false
 	co = nil
-	for _, op := range unmergedChain.ops {
+	var toDirOps []op
+	if toDirChain, ok := unmergedChains.byMostRecent[toDirUnmergedPtr]; ok {
+		toDirOps = toDirChain.ops
+	}
+	for _, op := range toDirOps {
 		var ok bool
-		if co, ok = op.(*createOp); ok && co.NewName == rua.toName {
+		if co, ok = op.(*createOp); ok && co.NewName == toName {
 			found = true
 			if len(co.RefBlocks) > 0 {
 				co.RefBlocks[0] = newMergedEntry.BlockPointer
@@ -688,14 +832,14 @@ func (rua *renameUnmergedAction) updateOps(unmergedMostRecent BlockPointer,
 		}
 	}
 	if !found {
-		co, err = newCreateOp(rua.toName, unmergedMostRecent, mergedEntry.Type)
+		co, err = newCreateOp(toName, toDirUnmergedPtr, mergedEntry.Type)
 		if err != nil {
 			return err
 		}
 		if rua.symPath == "" {
 			co.AddRefBlock(newMergedEntry.BlockPointer)
 		}
-		err = prependOpsToChain(unmergedMostRecent, unmergedChains, co)
+		err = prependOpsToChain(toDirUnmergedPtr, unmergedChains, co)
 		if err != nil {
 			return err
 		}
@@ -713,7 +857,148 @@ func (rua *renameUnmergedAction) updateOps(unmergedMostRecent BlockPointer,
 	return nil
 }
 
+// doKeepOne updates the merged entry for a content conflict resolved
+// by keeping a single version of the file.  A merged version's
+// contents are already in place, keyed by the entry's name, and the
+// unmerged version is copied into place here if the user chose it.
+// Either way, they replace the merged file's blocks when the
+// resolution is synced, so the entry keeps the merged file's
+// pointer.  If the user chose the merged version, nothing changes.
+func (rua *renameUnmergedAction) doKeepOne(ctx context.Context,
+	unmergedCopier fileBlockDeepCopier, unmergedBlock *DirBlock,
+	mergedBlock *DirBlock) error {
+	unmergedEntry, ok := unmergedBlock.Children[rua.fromName]
+	if !ok {
+		return NoSuchNameError{rua.fromName}
+	}
+	mergedEntry, ok := mergedBlock.Children[rua.fromName]
+	if !ok {
+		return NoSuchNameError{rua.fromName}
+	}
+	rua.oldMergedLen, rua.oldUnmergedLen = mergedEntry.Size, unmergedEntry.Size
+	rua.toName = rua.fromName
+
+	if rua.merged {
+		mergedEntry.Size = rua.mergedLen
+		if unmergedEntry.Mtime > mergedEntry.Mtime {
+			mergedEntry.Mtime = unmergedEntry.Mtime
+		}
+		if unmergedEntry.Ctime > mergedEntry.Ctime {
+			mergedEntry.Ctime = unmergedEntry.Ctime
+		}
+		mergedBlock.Children[rua.fromName] = mergedEntry
+		return nil
+	}
+
+	if rua.choice == ConflictChoiceTheirs {
+		// The merged file stays just as it is.
+		rua.mergedLen = mergedEntry.Size
+		return nil
+	}
+
+	_, err := unmergedCopier(ctx, rua.fromName, unmergedEntry.BlockPointer)
+	if err != nil {
+		return err
+	}
+	unmergedEntry.BlockInfo = mergedEntry.BlockInfo
+	unmergedEntry.PrevRevisions = mergedEntry.PrevRevisions
+	mergedBlock.Children[rua.fromName] = unmergedEntry
+	rua.mergedLen = unmergedEntry.Size
+	return nil
+}
+
+// updateOpsKeepOne fixes up the ops of the file for a content
+// conflict resolved by keeping a single version of the file.  The
+// unmerged writes become a single write of the whole new file, for
+// remote notifications, or are dropped if the merged version is
+// kept, and the merged branch gets the same write for local
+// notifications.  Nothing changes in the parent directory.
+func (rua *renameUnmergedAction) updateOpsKeepOne(
+	unmergedMostRecent, mergedMostRecent BlockPointer,
+	unmergedChain *crChain, unmergedBlock *DirBlock,
+	unmergedChains *crChains, mergedChains *crChains) error {
+	if !unmergedChain.isFile() {
+		return nil
+	}
+	// Actions for every file in the directory see every file's
+	// chain, so skip the others.
+	unmergedEntry, ok := unmergedBlock.Children[rua.fromName]
+	if !ok || unmergedEntry.BlockPointer != unmergedMostRecent {
+		return nil
+	}
+
+	// The unmerged blocks of the file aren't used anymore.
+	unmergedChains.toUnrefPointers[unmergedMostRecent] = true
+	var so *syncOp
+	ops := make([]op, 0, len(unmergedChain.ops))
+	for _, uop := range unmergedChain.ops {
+		if realOp, ok := uop.(*syncOp); ok {
+			for _, ptr := range realOp.Refs() {
+				unmergedChains.toUnrefPointers[ptr] = true
+			}
+			if so != nil {
+				continue
+			}
+			so = realOp
+		}
+		ops = append(ops, uop)
+	}
+	if rua.choice == ConflictChoiceTheirs {
+		// Only the local device sees any change.
+		unmergedChain.ops = nil
+		return rua.prependLocalSyncOp(mergedMostRecent, mergedChains)
+	}
+	unmergedChain.ops = ops
+	if so == nil {
+		return fmt.Errorf("No sync op for content conflict on %s",
+			rua.fromName)
+	}
+
+	// Use the original pointer, which the resolution maps to the
+	// new pointer of the merged file.
+	var err error
+	so.File, err = makeBlockUpdate(unmergedChain.original,
+		unmergedChain.original)
+	if err != nil {
+		return err
+	}
+	so.RefBlocks = nil
+	// The only merged blocks that aren't used anymore, other than
+	// the top block, are the children of a replaced merged file.
+	// Any others unreferenced by the unmerged writes were already
+	// unreferenced by the merged branch, or are among these.
+	so.UnrefBlocks = append([]BlockPointer(nil), rua.unrefs...)
+	so.Writes = nil
+	so.addWrite(0, rua.mergedLen)
+	if rua.oldMergedLen > rua.mergedLen {
+		so.addTruncate(rua.mergedLen)
+	}
+	return rua.prependLocalSyncOp(mergedMostRecent, mergedChains)
+}
+
+// prependLocalSyncOp prepends a write of the whole kept file to the
+// merged chain of the file, so the local device sees its new
+// contents.
+func (rua *renameUnmergedAction) prependLocalSyncOp(
+	mergedMostRecent BlockPointer, mergedChains *crChains) error {
+	localSo, err := newSyncOp(mergedMostRecent)
+	if err != nil {
+		return err
+	}
+	localSo.addWrite(0, rua.mergedLen)
+	if rua.oldUnmergedLen > rua.mergedLen {
+		localSo.addTruncate(rua.mergedLen)
+	}
+	return prependOpsToChain(mergedMostRecent, mergedChains, localSo)
+}
+
 func (rua *renameUnmergedAction) String() string {
+	if rua.merged {
+		return fmt.Sprintf("renameUnmerged: merged %s", rua.fromName)
+	} else if rua.choice != ConflictChoiceBoth {
+		return fmt.Sprintf("renameUnmerged: kept %s version of %s",
+			rua.choice, rua.fromName)
+	}
 	return fmt.Sprintf("renameUnmerged: %s -> %s %s", rua.fromName, rua.toName,
 		rua.symPath)
 }
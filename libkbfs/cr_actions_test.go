@@ -15,7 +15,7 @@ func TestCRActionsCollapseNoChange(t *testing.T) {
 			DirEntry{}, nil},
 		&copyUnmergedEntryAction{"old2", "new2", "", false, false,
 			DirEntry{}, nil},
-		&renameUnmergedAction{"old3", "new3", "", 0, false, zeroPtr, zeroPtr},
+		&renameUnmergedAction{fromName: "old3", toName: "new3"},
 		&renameMergedAction{"old4", "new4", ""},
 		&copyUnmergedAttrAction{"old5", "new5", []attrChange{mtimeAttr}, false},
 	}
@@ -31,7 +31,7 @@ func TestCRActionsCollapseEntry(t *testing.T) {
 		&copyUnmergedAttrAction{"old", "new", []attrChange{mtimeAttr}, false},
 		&copyUnmergedEntryAction{"old", "new", "", false, false,
 			DirEntry{}, nil},
-		&renameUnmergedAction{"old", "new", "", 0, false, zeroPtr, zeroPtr},
+		&renameUnmergedAction{fromName: "old", toName: "new"},
 	}
 
 	expected := crActionList{
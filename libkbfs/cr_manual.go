@@ -0,0 +1,163 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"fmt"
+	stdpath "path"
+
+	"github.com/keybase/kbfs/kbfsmd"
+	"golang.org/x/net/context"
+)
+
+// ConflictChoice says which version of a conflicted entry to keep
+// when resolving conflicts manually.
+type ConflictChoice int
+
+const (
+	// ConflictChoiceBoth keeps both versions, with the local one
+	// renamed, just as automatic conflict resolution does.
+	ConflictChoiceBoth ConflictChoice = iota
+	// ConflictChoiceMine keeps the local (unmerged) version, and
+	// discards the other one.
+	ConflictChoiceMine
+	// ConflictChoiceTheirs keeps the version from the merged
+	// branch, and discards the local one.
+	ConflictChoiceTheirs
+)
+
+func (c ConflictChoice) String() string {
+	switch c {
+	case ConflictChoiceBoth:
+		return "both"
+	case ConflictChoiceMine:
+		return "mine"
+	case ConflictChoiceTheirs:
+		return "theirs"
+	default:
+		return fmt.Sprintf("ConflictChoice(%d)", int(c))
+	}
+}
+
+// ParseConflictChoice parses the string form of a ConflictChoice,
+// i.e. one of "mine", "theirs" or "both".
+func ParseConflictChoice(s string) (ConflictChoice, error) {
+	for _, c := range []ConflictChoice{
+		ConflictChoiceBoth, ConflictChoiceMine, ConflictChoiceTheirs} {
+		if s == c.String() {
+			return c, nil
+		}
+	}
+	return ConflictChoiceBoth, fmt.Errorf(
+		"Unknown conflict choice %q (must be mine, theirs or both)", s)
+}
+
+func (cr *ConflictResolver) isProcessing() bool {
+	cr.inputChanLock.RLock()
+	defer cr.inputChanLock.RUnlock()
+	return cr.inputChan != nil
+}
+
+// setAutoResolution pauses or restarts automatic conflict
+// resolution.  While it is paused, an unmerged branch (including one
+// made by the journal after a conflict) stays unmerged until
+// resolveWithChoices is called.
+func (cr *ConflictResolver) setAutoResolution(enabled bool) {
+	cr.manualLock.Lock()
+	defer cr.manualLock.Unlock()
+	if enabled {
+		cr.Restart(BackgroundContextWithCancellationDelayer())
+	} else {
+		cr.Pause()
+	}
+}
+
+// resolveWithChoices starts a new resolution of the unmerged branch,
+// whose head is at `unmerged`, that keeps the given versions of
+// conflicted files, and waits for it to finish.  Any resolution
+// already in progress is canceled.  This works even while automatic
+// resolution is paused, in which case it stays paused afterward.
+func (cr *ConflictResolver) resolveWithChoices(ctx context.Context,
+	unmerged kbfsmd.Revision, choices map[string]ConflictChoice) error {
+	cr.manualLock.Lock()
+	defer cr.manualLock.Unlock()
+
+	func() {
+		cr.inputLock.Lock()
+		defer cr.inputLock.Unlock()
+		cr.manualChoices = choices
+		if cr.currCancel != nil {
+			cr.currCancel()
+		}
+		// Don't ignore the new input if it has the same revisions
+		// as the canceled one.
+		cr.currInput = conflictInput{}
+	}()
+	defer cr.clearManualChoices()
+
+	if !cr.isProcessing() {
+		cr.startProcessing(BackgroundContextWithCancellationDelayer())
+		defer cr.stopProcessing()
+	}
+	cr.Resolve(ctx, unmerged, kbfsmd.RevisionUninitialized)
+	return cr.Wait(ctx)
+}
+
+func (cr *ConflictResolver) clearManualChoices() {
+	cr.inputLock.Lock()
+	defer cr.inputLock.Unlock()
+	cr.manualChoices = nil
+}
+
+// manualChoice returns the version to keep of the entry `name` in
+// the merged directory at `dir`.
+func (cr *ConflictResolver) manualChoice(dir path, name string) ConflictChoice {
+	cr.inputLock.Lock()
+	defer cr.inputLock.Unlock()
+	if len(cr.manualChoices) == 0 {
+		return ConflictChoiceBoth
+	}
+	names := make([]string, 0, len(dir.path))
+	for _, pn := range dir.path[1:] {
+		names = append(names, pn.Name)
+	}
+	return cr.manualChoices[stdpath.Join(append(names, name)...)]
+}
+
+// chooseContentConflictVersion sets up `rua`, a content conflict in
+// the merged directory at `mergedPath`, to keep only the version
+// given by `choice`.  To keep the unmerged version, the blocks of
+// the merged file are all replaced by a copy of it, so the
+// resolution unreferences the merged file's child blocks.  It leaves
+// `rua` alone if either version isn't a file.
+func (cr *ConflictResolver) chooseContentConflictVersion(
+	ctx context.Context, lState *lockState, mergedChains *crChains,
+	mergedPath path, unmergedBlock, mergedBlock *DirBlock,
+	rua *renameUnmergedAction, choice ConflictChoice) error {
+	unmergedEntry, ok := unmergedBlock.Children[rua.fromName]
+	if !ok || (unmergedEntry.Type != File && unmergedEntry.Type != Exec) {
+		return nil
+	}
+	mergedEntry, ok := mergedBlock.Children[rua.fromName]
+	if !ok || (mergedEntry.Type != File && mergedEntry.Type != Exec) {
+		return nil
+	}
+
+	if choice == ConflictChoiceMine {
+		infos, err := cr.fbo.blocks.GetIndirectFileBlockInfos(
+			ctx, lState, mergedChains.mostRecentChainMDInfo,
+			mergedPath.ChildPath(rua.fromName, mergedEntry.BlockPointer))
+		if err != nil {
+			return err
+		}
+		rua.unrefs = make([]BlockPointer, 0, len(infos))
+		for _, info := range infos {
+			rua.unrefs = append(rua.unrefs, info.BlockPointer)
+		}
+	}
+	rua.choice = choice
+	cr.log.CDebugf(ctx, "Keeping %s version of %s", choice, rua.fromName)
+	return nil
+}
@@ -0,0 +1,239 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"bytes"
+	stdpath "path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+	"golang.org/x/net/context"
+)
+
+const (
+	// crMergeMaxLines is the most distinct lines a pair of versions
+	// can have and still be diffed, since the diff library encodes
+	// each line as a single rune below the surrogate range.
+	crMergeMaxLines = 0xD800
+)
+
+// crMergeGlobsMatch returns true if `name` matches any of the given
+// glob patterns.
+func crMergeGlobsMatch(globs []string, name string) bool {
+	for _, g := range globs {
+		if ok, _ := stdpath.Match(g, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// splitLines splits `data` into lines, keeping the line endings.
+func splitLines(data []byte) []string {
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// matchLines returns, for each line of `base`, the index of the
+// matching line in `other` according to a minimal line diff, or -1
+// if that line was changed.  It returns false if the texts are too
+// big to be diffed.
+func matchLines(base, other []byte) ([]int, bool) {
+	dmp := diffmatchpatch.New()
+	dmp.DiffTimeout = 0
+	baseRunes, otherRunes, lines := dmp.DiffLinesToRunes(
+		string(base), string(other))
+	if len(lines) >= crMergeMaxLines {
+		return nil, false
+	}
+	matches := make([]int, len(baseRunes))
+	i, j := 0, 0
+	for _, d := range dmp.DiffMainRunes(baseRunes, otherRunes, false) {
+		n := utf8.RuneCountInString(d.Text)
+		switch d.Type {
+		case diffmatchpatch.DiffEqual:
+			for k := 0; k < n; k++ {
+				matches[i] = j
+				i++
+				j++
+			}
+		case diffmatchpatch.DiffDelete:
+			for k := 0; k < n; k++ {
+				matches[i] = -1
+				i++
+			}
+		case diffmatchpatch.DiffInsert:
+			j += n
+		}
+	}
+	return matches, true
+}
+
+func linesEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeLines performs a line-based three-way merge of `a` and `b`,
+// which were both derived from `base`.  It returns false if `a` and
+// `b` change overlapping regions of `base` in different ways, or
+// insert different lines at the same point.
+func mergeLines(base, a, b []byte) ([]byte, bool) {
+	baseLines, aLines, bLines := splitLines(base), splitLines(a), splitLines(b)
+	aMatches, ok := matchLines(base, a)
+	if !ok {
+		return nil, false
+	}
+	bMatches, ok := matchLines(base, b)
+	if !ok {
+		return nil, false
+	}
+
+	var buf bytes.Buffer
+	// mergeChunk merges the region of each text from the given
+	// indices up to (but not including) the given end indices.
+	mergeChunk := func(o, oEnd, i, iEnd, j, jEnd int) bool {
+		oChunk, aChunk, bChunk :=
+			baseLines[o:oEnd], aLines[i:iEnd], bLines[j:jEnd]
+		var res []string
+		switch {
+		case linesEqual(aChunk, bChunk):
+			res = aChunk
+		case linesEqual(aChunk, oChunk):
+			res = bChunk
+		case linesEqual(bChunk, oChunk):
+			res = aChunk
+		default:
+			return false
+		}
+		for _, l := range res {
+			buf.WriteString(l)
+		}
+		return true
+	}
+
+	// Walk the base, using each line left unchanged by both sides
+	// as a stable point between the chunks that need merging.
+	o, i, j := 0, 0, 0
+	for k := range baseLines {
+		if aMatches[k] < 0 || bMatches[k] < 0 {
+			continue
+		}
+		if !mergeChunk(o, k, i, aMatches[k], j, bMatches[k]) {
+			return nil, false
+		}
+		buf.WriteString(baseLines[k])
+		o, i, j = k+1, aMatches[k]+1, bMatches[k]+1
+	}
+	if !mergeChunk(o, len(baseLines), i, len(aLines), j, len(bLines)) {
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
+
+// readSingleBlockFile returns the contents of the file at `ptr`,
+// the child `name` of `dir`, or false if the file has more than one
+// block.
+func (cr *ConflictResolver) readSingleBlockFile(ctx context.Context,
+	lState *lockState, kmd KeyMetadata, dir path, name string,
+	ptr BlockPointer) ([]byte, bool, error) {
+	fblock, err := cr.fbo.blocks.GetFileBlockForReading(
+		ctx, lState, kmd, ptr, dir.Branch, dir.ChildPath(name, ptr))
+	if err != nil {
+		return nil, false, err
+	}
+	if fblock.IsInd {
+		return nil, false, nil
+	}
+	return fblock.Contents, true, nil
+}
+
+// mergeContentConflict tries to merge the two versions of the file
+// behind the content conflict `rua`, in the merged directory at
+// `mergedPath`, if the file's name matches the configured merge
+// globs.  It uses the version of the file before the branch as their
+// common ancestor.  If the merge succeeds and the result fits in a
+// single block, it registers that block as the new contents of the
+// merged file in `newFileBlocks`, and marks `rua` as merged so that
+// the resolution keeps just that file.  Otherwise it leaves `rua`
+// alone, to rename the unmerged copy as usual.
+func (cr *ConflictResolver) mergeContentConflict(ctx context.Context,
+	lState *lockState, unmergedChains, mergedChains *crChains,
+	mergedPath path, unmergedBlock, mergedBlock *DirBlock,
+	rua *renameUnmergedAction, newFileBlocks fileBlockMap) error {
+	if !crMergeGlobsMatch(cr.config.ConflictMergeGlobs(), rua.fromName) {
+		return nil
+	}
+	unmergedEntry, ok := unmergedBlock.Children[rua.fromName]
+	if !ok || (unmergedEntry.Type != File && unmergedEntry.Type != Exec) {
+		return nil
+	}
+	mergedEntry, ok := mergedBlock.Children[rua.fromName]
+	if !ok || (mergedEntry.Type != File && mergedEntry.Type != Exec) {
+		return nil
+	}
+	original, err := unmergedChains.originalFromMostRecentOrSame(
+		unmergedEntry.BlockPointer)
+	if err != nil {
+		return err
+	}
+	if unmergedChains.isCreated(original) {
+		return nil
+	}
+
+	kmd := mergedChains.mostRecentChainMDInfo
+	var contents [3][]byte
+	for i, ptr := range []BlockPointer{
+		original, mergedEntry.BlockPointer, unmergedEntry.BlockPointer} {
+		data, ok, err := cr.readSingleBlockFile(
+			ctx, lState, kmd, mergedPath, rua.fromName, ptr)
+		if err != nil {
+			// The base version may be long gone; just keep both
+			// versions.
+			cr.log.CDebugf(ctx, "Couldn't read %v to merge %s: %+v",
+				ptr, rua.fromName, err)
+			return nil
+		}
+		if !ok {
+			return nil
+		}
+		contents[i] = data
+	}
+
+	data, ok := mergeLines(contents[0], contents[1], contents[2])
+	if !ok {
+		cr.log.CDebugf(ctx, "Overlapping changes in %s", rua.fromName)
+		return nil
+	}
+	fblock := NewFileBlock().(*FileBlock)
+	n := cr.config.BlockSplitter().CopyUntilSplit(fblock, true, data, 0)
+	if n < int64(len(data)) {
+		cr.log.CDebugf(ctx, "Merged %s doesn't fit in one block",
+			rua.fromName)
+		return nil
+	}
+
+	mergedParent := mergedPath.tailPointer()
+	if _, ok := newFileBlocks[mergedParent]; !ok {
+		newFileBlocks[mergedParent] = make(map[string]*FileBlock)
+	}
+	newFileBlocks[mergedParent][rua.fromName] = fblock
+	rua.merged = true
+	rua.mergedLen = uint64(len(data))
+	cr.log.CDebugf(ctx, "Merged the two versions of %s", rua.fromName)
+	return nil
+}
@@ -0,0 +1,57 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeLines(t *testing.T) {
+	for _, tc := range []struct {
+		base, a, b string
+		expected   string
+		ok         bool
+	}{
+		// Non-overlapping edits.
+		{"1\n2\n3\n", "one\n2\n3\n", "1\n2\nthree\n", "one\n2\nthree\n", true},
+		// Identical edits.
+		{"1\n2\n3\n", "1\ntwo\n3\n", "1\ntwo\n3\n", "1\ntwo\n3\n", true},
+		// Only one side changed.
+		{"1\n2\n3\n", "1\n2\n3\n", "1\n3\n", "1\n3\n", true},
+		// One side prepended, the other appended.
+		{"1\n2\n", "0\n1\n2\n", "1\n2\n3\n", "0\n1\n2\n3\n", true},
+		// Both sides appended the same line.
+		{"1\n", "1\na\n", "1\na\n", "1\na\n", true},
+		// Both sides appended different lines.
+		{"1\n", "1\na\n", "1\nb\n", "", false},
+		// Both sides appended different lines to an empty file.
+		{"", "a\n", "b\n", "", false},
+		// Both sides inserted different lines at the same point.
+		{"1\n2\n", "1\na\n2\n", "1\nb\n2\n", "", false},
+		// A missing final newline.
+		{"1\n2\n3", "one\n2\n3", "1\n2\n3\n4", "one\n2\n3\n4", true},
+		// Overlapping edits.
+		{"1\n2\n3\n", "1\na\n3\n", "1\nb\n3\n", "", false},
+		// One side edits a line the other side removed.
+		{"1\n2\n3\n", "1\na\n3\n", "1\n3\n", "", false},
+	} {
+		merged, ok := mergeLines(
+			[]byte(tc.base), []byte(tc.a), []byte(tc.b))
+		require.Equal(t, tc.ok, ok, "%q %q %q", tc.base, tc.a, tc.b)
+		if ok {
+			require.Equal(t, tc.expected, string(merged))
+		}
+	}
+}
+
+func TestCRMergeGlobsMatch(t *testing.T) {
+	globs := []string{"*.txt", "Makefile"}
+	require.True(t, crMergeGlobsMatch(globs, "a.txt"))
+	require.True(t, crMergeGlobsMatch(globs, "Makefile"))
+	require.False(t, crMergeGlobsMatch(globs, "a.bin"))
+	require.False(t, crMergeGlobsMatch(nil, "a.txt"))
+}
@@ -642,6 +642,121 @@ type TLFUpdateHistory struct {
 	Updates []UpdateSummary
 }
 
+// DirChild is a named child of a directory, as returned by
+// KBFSOps.GetDirChildrenPaged.
+type DirChild struct {
+	Name string
+	EntryInfo
+}
+
+// DeletedEntry describes a file or directory deleted from a TLF in a
+// recent revision, that can still be undeleted.  It is suitable for
+// encoding directly as JSON.
+type DeletedEntry struct {
+	Path string // relative to the TLF root
+	Type EntryType
+	// Revision is the revision that deleted the entry; the entry
+	// was last live in the revision before it.
+	Revision kbfsmd.Revision
+	Writer   string
+	Time     time.Time // server-reported time
+	// Contents lists the entries within a deleted directory that
+	// were deleted in the revisions leading right up to Revision,
+	// as by a recursive remove, most recent first.  Undeleting the
+	// directory restores it from before the first of them.
+	Contents []DeletedEntry `json:",omitempty"`
+}
+
+// RevisionDiffType is the kind of change described by a RevisionDiff.
+type RevisionDiffType int
+
+const (
+	// RevisionDiffCreated means the entry didn't exist at the start
+	// of the range.
+	RevisionDiffCreated RevisionDiffType = iota
+	// RevisionDiffModified means the entry existed at both ends of
+	// the range, at the same path, but its contents or attributes
+	// changed.
+	RevisionDiffModified
+	// RevisionDiffRemoved means the entry doesn't exist at the end
+	// of the range.
+	RevisionDiffRemoved
+	// RevisionDiffRenamed means the entry moved from OldPath to Path.
+	RevisionDiffRenamed
+)
+
+// String implements the fmt.Stringer interface for RevisionDiffType.
+func (rdt RevisionDiffType) String() string {
+	switch rdt {
+	case RevisionDiffCreated:
+		return "created"
+	case RevisionDiffModified:
+		return "modified"
+	case RevisionDiffRemoved:
+		return "removed"
+	case RevisionDiffRenamed:
+		return "renamed"
+	}
+	return "<invalid RevisionDiffType>"
+}
+
+// RevisionDiff describes one path that changed between two revisions
+// of a TLF, as returned by KBFSOps.DiffRevisions.  It is suitable for
+// encoding directly as JSON.
+type RevisionDiff struct {
+	Type RevisionDiffType
+	// Path is relative to the TLF root.  For removed entries, it's
+	// the entry's last path.
+	Path string
+	// OldPath is only set for renamed entries.
+	OldPath   string `json:",omitempty"`
+	EntryType EntryType
+	// Size is the size of the entry at the end of the range, or 0
+	// for removed entries.
+	Size uint64
+}
+
+// DirQuotaUsage describes the encoded bytes of all the blocks in a
+// directory subtree, and is suitable for encoding directly as JSON.
+type DirQuotaUsage struct {
+	Path     string // relative to the directory being broken down
+	Bytes    uint64
+	NumFiles int
+	NumDirs  int
+}
+
+// QuotaUsageBreakdown describes what is using the quota charged for
+// a TLF, and is suitable for encoding directly as JSON.  The sizes
+// are computed from the encoded block sizes recorded in the TLF's
+// MD history and directory entries, so they don't include any
+// outstanding writes from the local device.
+type QuotaUsageBreakdown struct {
+	ID       string
+	Name     string
+	Revision kbfsmd.Revision
+	// LiveBytes is the "DiskUsage" for the TLF as of Revision.
+	LiveBytes uint64
+	// MDBytes is the size of the unembedded block changes in the
+	// TLF's MD history.
+	MDBytes uint64
+	// UnreclaimedBytes is the size of the blocks unreferenced after
+	// LastGCRevision, which are still charged until quota
+	// reclamation deletes them.
+	UnreclaimedBytes uint64
+	LastGCRevision   kbfsmd.Revision
+	// UnreclaimedBytesPartial is set if LastGCRevision was too far
+	// back in the MD history to walk all the way to it, in which
+	// case UnreclaimedBytes only covers the most recent revisions.
+	UnreclaimedBytesPartial bool
+	// Writers maps each writer to the bytes of the live blocks they
+	// last wrote within the broken-down directory.
+	Writers map[string]uint64
+	// Dirs contains the broken-down directory itself, followed by
+	// each of its subdirectories down to the requested depth, in
+	// decreasing order of size.
+	Dirs []DirQuotaUsage
+}
+
 // writerInfo is the keybase UID and device (represented by its
 // verifying key) that generated the operation at the given revision.
 type writerInfo struct {
@@ -690,6 +805,10 @@ type NodeMetadata struct {
 	LastWriterUnverified libkb.NormalizedUsername
 	BlockInfo            BlockInfo
 	PrefetchStatus       string
+	// PathFromRoot is the slash-separated path of this node
+	// relative to the root of its TLF; it is empty for the root
+	// itself.
+	PathFromRoot string
 }
 
 // FavoritesOp defines an operation related to favorites.
@@ -5,6 +5,8 @@
 package libkbfs
 
 import (
+	"sort"
+
 	"github.com/keybase/client/go/logger"
 	"github.com/keybase/client/go/protocol/keybase1"
 	"github.com/keybase/kbfs/kbfsblock"
@@ -103,6 +105,53 @@ func (dd *dirData) getChildren(ctx context.Context) (
 	return children, nil
 }
 
+// getChildrenPaged returns up to `maxEntries` children whose names
+// sort strictly after `after`, in byte-wise order of their names.
+// It only fetches the leaf blocks needed to fill the page.  If
+// `maxEntries` is not positive, it returns all of those children.
+func (dd *dirData) getChildrenPaged(
+	ctx context.Context, after string, maxEntries int) (
+	children []DirChild, err error) {
+	topBlock, err := dd.getTopBlock(ctx, blockRead)
+	if err != nil {
+		return nil, err
+	}
+
+	off := StringOffset(after)
+	for {
+		_, _, block, nextBlockOff, _, _, err := dd.tree.getBlockAtOffset(
+			ctx, topBlock, &off, blockRead)
+		if err != nil {
+			return nil, err
+		}
+
+		// Entries in each leaf block sort after the entries in the
+		// blocks before it, so only this block needs sorting.
+		var names []string
+		for name := range block.(*DirBlock).Children {
+			if name > after && !hiddenEntries[name] {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if maxEntries > 0 && len(children) >= maxEntries {
+				return children, nil
+			}
+			children = append(children, DirChild{
+				Name:      name,
+				EntryInfo: block.(*DirBlock).Children[name].EntryInfo,
+			})
+		}
+
+		if nextBlockOff == nil ||
+			(maxEntries > 0 && len(children) >= maxEntries) {
+			return children, nil
+		}
+		off = *nextBlockOff.(*StringOffset)
+	}
+}
+
 func (dd *dirData) getEntries(ctx context.Context) (
 	children map[string]DirEntry, err error) {
 	topBlock, err := dd.getTopBlock(ctx, blockRead)
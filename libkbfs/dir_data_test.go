@@ -136,6 +136,57 @@ func TestDirDataGetChildren(t *testing.T) {
 
 }
 
+func testDirDataCheckPage(
+	t *testing.T, ctx context.Context, dd *dirData, after string,
+	maxEntries int, expectedNames ...string) {
+	children, err := dd.getChildrenPaged(ctx, after, maxEntries)
+	require.NoError(t, err)
+	var names []string
+	for _, c := range children {
+		names = append(names, c.Name)
+	}
+	require.Equal(t, expectedNames, names)
+}
+
+func TestDirDataGetChildrenPaged(t *testing.T) {
+	dd, cleanBcache, _ := setupDirDataTest(t, 2, 2)
+	ctx := context.Background()
+	topBlock := NewDirBlock().(*DirBlock)
+	cleanBcache.Put(
+		dd.rootBlockPointer(), dd.tree.file.Tlf, topBlock, TransientEntry)
+
+	t.Log("No entries")
+	testDirDataCheckPage(t, ctx, dd, "", 2)
+
+	t.Log("Spread entries over several leaf blocks")
+	for _, name := range []string{"e", "a", "c", "g", "b", "f", "d"} {
+		addFakeDirDataEntry(t, ctx, dd, name, 1)
+	}
+	newTopBlock, err := dd.getTopBlock(ctx, blockRead)
+	require.NoError(t, err)
+	require.True(t, newTopBlock.IsInd)
+	testDirDataCheckPage(
+		t, ctx, dd, "", 0, "a", "b", "c", "d", "e", "f", "g")
+
+	t.Log("Page through them")
+	testDirDataCheckPage(t, ctx, dd, "", 3, "a", "b", "c")
+	testDirDataCheckPage(t, ctx, dd, "c", 3, "d", "e", "f")
+	testDirDataCheckPage(t, ctx, dd, "f", 3, "g")
+	testDirDataCheckPage(t, ctx, dd, "g", 3)
+
+	t.Log("Cursors don't need to name an existing entry")
+	testDirDataCheckPage(t, ctx, dd, "bb", 2, "c", "d")
+
+	t.Log("Changes after the cursor show up in later pages")
+	testDirDataCheckPage(t, ctx, dd, "", 2, "a", "b")
+	addFakeDirDataEntry(t, ctx, dd, "a1", 1)
+	addFakeDirDataEntry(t, ctx, dd, "c1", 1)
+	_, err = dd.removeEntry(ctx, "d")
+	require.NoError(t, err)
+	testDirDataCheckPage(t, ctx, dd, "b", 2, "c", "c1")
+	testDirDataCheckPage(t, ctx, dd, "c1", 0, "e", "f", "g")
+}
+
 func testDirDataCheckLookup(
 	t *testing.T, ctx context.Context, dd *dirData, name string, size uint64) {
 	de, err := dd.lookup(ctx, name)
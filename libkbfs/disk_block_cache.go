@@ -12,7 +12,6 @@ import (
 	"sort"
 	"strconv"
 	"sync"
-	"time"
 
 	"github.com/keybase/client/go/logger"
 	"github.com/keybase/client/go/protocol/keybase1"
@@ -20,6 +19,7 @@ import (
 	"github.com/keybase/kbfs/kbfsblock"
 	"github.com/keybase/kbfs/kbfscrypto"
 	"github.com/keybase/kbfs/kbfshash"
+	"github.com/keybase/kbfs/metricsutil"
 	"github.com/keybase/kbfs/tlf"
 	"github.com/pkg/errors"
 	metrics "github.com/rcrowley/go-metrics"
@@ -35,6 +35,7 @@ const (
 	defaultDiskBlockCacheMaxBytes uint64 = 10 * (1 << 30)
 	defaultBlockCacheTableSize    int    = 50 * opt.MiB
 	evictionConsiderationFactor   int    = 3
+	evictionScanLimitFactor       int    = 10
 	defaultNumBlocksToEvict       int    = 10
 	maxEvictionsPerPut            int    = 4
 	blockDbFilename               string = "diskCacheBlocks.leveldb"
@@ -68,6 +69,10 @@ type DiskBlockCacheLocal struct {
 	evictSizeMeter   *CountMeter
 	deleteCountMeter *CountMeter
 	deleteSizeMeter  *CountMeter
+	// Track the progress of the background scrubber.  The scrubber
+	// verifies entries under a read lock, so this has its own lock.
+	scrubLock   sync.Mutex
+	scrubStatus DiskBlockCacheScrubStatus
 	// Protect the disk caches from being shutdown while they're being
 	// accessed.
 	lock    sync.RWMutex
@@ -144,6 +149,19 @@ type DiskBlockCacheStatus struct {
 	SizeEvicted     MeterStatus
 	NumDeleted      MeterStatus
 	SizeDeleted     MeterStatus
+	Scrub           DiskBlockCacheScrubStatus
+	// TlfStatuses maps each TLF ID with blocks in the cache to the
+	// status of that TLF's blocks.
+	TlfStatuses map[string]DiskBlockCacheTlfStatus `json:",omitempty"`
+}
+
+// DiskBlockCacheTlfStatus represents the status of a single TLF's
+// blocks within the disk cache.
+type DiskBlockCacheTlfStatus struct {
+	NumBlocks  uint64
+	BlockBytes uint64
+	LimitBytes uint64 `json:",omitempty"`
+	Pinned     bool   `json:",omitempty"`
 }
 
 // newDiskBlockCacheStandardFromStorage creates a new *DiskBlockCacheStandard
@@ -362,8 +380,14 @@ func newDiskBlockCacheStandard(config diskBlockCacheConfig,
 			tlfStorage.Close()
 		}
 	}()
-	return newDiskBlockCacheStandardFromStorage(config, cacheType,
+	cache, err = newDiskBlockCacheStandardFromStorage(config, cacheType,
 		blockStorage, metadataStorage, tlfStorage)
+	if err != nil {
+		return nil, err
+	}
+	cache.registerMetrics()
+	go cache.scrubLoop()
+	return cache, nil
 }
 
 func newDiskBlockCacheStandardForTest(config diskBlockCacheConfig,
@@ -423,10 +447,21 @@ func (*DiskBlockCacheLocal) tlfKey(tlfID tlf.ID, blockKey []byte) []byte {
 }
 
 // updateMetadataLocked updates the LRU time of a block in the LRU cache to
-// the current time.
+// the current time, and refreshes its pinned state from the TLF's settings.
 func (cache *DiskBlockCacheLocal) updateMetadataLocked(ctx context.Context,
 	blockKey []byte, metadata DiskBlockCacheMetadata) error {
 	metadata.LRUTime.Time = cache.config.Clock().Now()
+	if cache.cacheType == workingSetCacheLimitTrackerType {
+		metadata.Pinned = cache.config.GetDiskCacheTlfSettings(
+			metadata.TlfID).Pinned
+	}
+	return cache.putMetadataLocked(ctx, blockKey, metadata)
+}
+
+// putMetadataLocked writes the metadata of a block to the metadata
+// database as-is.
+func (cache *DiskBlockCacheLocal) putMetadataLocked(ctx context.Context,
+	blockKey []byte, metadata DiskBlockCacheMetadata) error {
 	encodedMetadata, err := cache.config.Codec().Encode(&metadata)
 	if err != nil {
 		return err
@@ -459,17 +494,6 @@ func (cache *DiskBlockCacheLocal) getMetadataLocked(blockID kbfsblock.ID) (
 	return metadata, err
 }
 
-// getLRULocked retrieves the LRU time for a block in the cache, or returns
-// leveldb.ErrNotFound and a zero-valued time.Time otherwise.
-func (cache *DiskBlockCacheLocal) getLRULocked(blockID kbfsblock.ID) (
-	time.Time, error) {
-	metadata, err := cache.getMetadataLocked(blockID)
-	if err != nil {
-		return time.Time{}, err
-	}
-	return metadata.LRUTime.Time, nil
-}
-
 // decodeBlockCacheEntry decodes a disk block cache entry buffer into an
 // encoded block and server half.
 func (cache *DiskBlockCacheLocal) decodeBlockCacheEntry(buf []byte) ([]byte,
@@ -594,6 +618,53 @@ func (cache *DiskBlockCacheLocal) evictUntilBytesAvailable(
 	return false, nil
 }
 
+// evictFromTLFUntilUnderLimit evicts blocks of the given TLF until
+// `extraBytes` more bytes would fit within `limit`, making at most
+// `maxEvictions` eviction passes.  The TLF's own limit applies to
+// its pinned blocks too, so it only returns false if the TLF has run
+// out of blocks to evict.
+func (cache *DiskBlockCacheLocal) evictFromTLFUntilUnderLimit(
+	ctx context.Context, tlfID tlf.ID, limit, extraBytes uint64,
+	maxEvictions int) (underLimit bool, err error) {
+	for i := 0; i < maxEvictions; i++ {
+		select {
+		// Ensure we don't loop infinitely
+		case <-ctx.Done():
+			return false, ctx.Err()
+		default:
+		}
+		if cache.tlfSizes[tlfID]+extraBytes <= limit {
+			return true, nil
+		}
+		if cache.tlfCounts[tlfID] == 0 {
+			return false, nil
+		}
+		cache.log.CDebugf(ctx, "TLF %s is over its limit of %d bytes: %d",
+			tlfID, limit, cache.tlfSizes[tlfID])
+		numRemoved, sizeRemoved, err := cache.evictFromTLFLocked(
+			ctx, tlfID, defaultNumBlocksToEvict)
+		if err != nil {
+			return false, err
+		}
+		if numRemoved == 0 {
+			// The random pivot may have landed past every block
+			// of the TLF, so try again from the start of its range
+			// before giving up.
+			numRemoved, sizeRemoved, err = cache.evictFromTLFFromPivotLocked(
+				ctx, tlfID, defaultNumBlocksToEvict, kbfsblock.ID{})
+			if err != nil {
+				return false, err
+			}
+		}
+		cache.evictCountMeter.Mark(int64(numRemoved))
+		cache.evictSizeMeter.Mark(sizeRemoved)
+		if numRemoved == 0 {
+			return false, nil
+		}
+	}
+	return cache.tlfSizes[tlfID]+extraBytes <= limit, nil
+}
+
 // Put implements the DiskBlockCache interface for DiskBlockCacheStandard.
 func (cache *DiskBlockCacheLocal) Put(ctx context.Context, tlfID tlf.ID,
 	blockID kbfsblock.ID, buf []byte,
@@ -629,7 +700,8 @@ func (cache *DiskBlockCacheLocal) Put(ctx context.Context, tlfID tlf.ID,
 	}
 	if !hasKey {
 		if cache.cacheType == syncCacheLimitTrackerType {
-			if !cache.config.IsSyncedTlf(tlfID) {
+			if !cache.config.IsSyncedTlf(tlfID) &&
+				len(cache.config.GetTlfSyncPaths(tlfID)) == 0 {
 				// TODO: Make better error type
 				return errors.New("Attempted to add a block of an unsynced " +
 					"TLF to the sync disk cache.")
@@ -650,6 +722,17 @@ func (cache *DiskBlockCacheLocal) Put(ctx context.Context, tlfID tlf.ID,
 				return errors.New("Attempted to add a block of a synced " +
 					"TLF to the working set disk cache.")
 			}
+			limit := cache.config.GetDiskCacheTlfSettings(tlfID).LimitBytes
+			if limit > 0 {
+				underLimit, err := cache.evictFromTLFUntilUnderLimit(
+					ctx, tlfID, limit, uint64(encodedLen), maxEvictionsPerPut)
+				if err != nil {
+					return err
+				}
+				if !underLimit {
+					return cachePutCacheFullError{blockID}
+				}
+			}
 			hasEnoughSpace, err := cache.evictUntilBytesAvailable(ctx, encodedLen)
 			if err != nil {
 				return err
@@ -865,16 +948,28 @@ func (cache *DiskBlockCacheLocal) evictSomeBlocks(ctx context.Context,
 // get numBlocks * evictionConsiderationFactor block IDs.  We sort the
 // resulting blocks by value (LRU time) and pick the minimum numBlocks. We then
 // call cache.Delete() on that list of block IDs.
+//
+// This only runs to enforce the TLF's own byte limit, which applies
+// to its pinned blocks as well, so pinned blocks are candidates too.
 func (cache *DiskBlockCacheLocal) evictFromTLFLocked(ctx context.Context,
 	tlfID tlf.ID, numBlocks int) (numRemoved int, sizeRemoved int64, err error) {
-	tlfBytes := tlfID.Bytes()
 	numElements := numBlocks * evictionConsiderationFactor
 	blockID, err := cache.getRandomBlockID(numElements, cache.tlfCounts[tlfID])
 	if err != nil {
 		return 0, 0, err
 	}
+	return cache.evictFromTLFFromPivotLocked(ctx, tlfID, numBlocks, blockID)
+}
+
+// evictFromTLFFromPivotLocked is like evictFromTLFLocked, but starts
+// considering blocks at the given pivot.
+func (cache *DiskBlockCacheLocal) evictFromTLFFromPivotLocked(
+	ctx context.Context, tlfID tlf.ID, numBlocks int, pivot kbfsblock.ID) (
+	numRemoved int, sizeRemoved int64, err error) {
+	tlfBytes := tlfID.Bytes()
+	numElements := numBlocks * evictionConsiderationFactor
 	rng := &util.Range{
-		Start: append(tlfBytes, blockID.Bytes()...),
+		Start: append(tlfBytes, pivot.Bytes()...),
 		Limit: append(tlfBytes, cache.maxBlockID...),
 	}
 	iter := cache.tlfDb.NewIterator(rng, nil)
@@ -882,7 +977,7 @@ func (cache *DiskBlockCacheLocal) evictFromTLFLocked(ctx context.Context,
 
 	blockIDs := make(blockIDsByTime, 0, numElements)
 
-	for i := 0; i < numElements; i++ {
+	for len(blockIDs) < numElements {
 		if !iter.Next() {
 			break
 		}
@@ -894,13 +989,13 @@ func (cache *DiskBlockCacheLocal) evictFromTLFLocked(ctx context.Context,
 			continue
 		}
 		blockID, err := kbfsblock.IDFromBytes(blockIDBytes)
-		lru, err := cache.getLRULocked(blockID)
+		metadata, err := cache.getMetadataLocked(blockID)
 		if err != nil {
 			cache.log.CWarningf(ctx, "Error decoding LRU time for block %s",
 				blockID)
 			continue
 		}
-		blockIDs = append(blockIDs, lruEntry{blockID, lru})
+		blockIDs = append(blockIDs, lruEntry{blockID, metadata.LRUTime.Time})
 	}
 
 	return cache.evictSomeBlocks(ctx, numBlocks, blockIDs)
@@ -909,9 +1004,10 @@ func (cache *DiskBlockCacheLocal) evictFromTLFLocked(ctx context.Context,
 // evictLocked evicts a number of blocks from the cache.  We choose a pivot
 // variable b randomly. Then begin an iterator into cache.metaDb.Range(b,
 // MaxBlockID) and iterate from there to get numBlocks *
-// evictionConsiderationFactor block IDs.  We sort the resulting blocks by
-// value (LRU time) and pick the minimum numBlocks. We then call cache.Delete()
-// on that list of block IDs.
+// evictionConsiderationFactor block IDs, wrapping around to the start of
+// the keyspace if needed.  We sort the resulting blocks by value (LRU time)
+// and pick the minimum numBlocks. We then call cache.Delete() on that list
+// of block IDs.
 func (cache *DiskBlockCacheLocal) evictLocked(ctx context.Context,
 	numBlocks int) (numRemoved int, sizeRemoved int64, err error) {
 	defer func() {
@@ -925,23 +1021,52 @@ func (cache *DiskBlockCacheLocal) evictLocked(ctx context.Context,
 	if err != nil {
 		return 0, 0, err
 	}
-	rng := &util.Range{Start: blockID.Bytes(), Limit: cache.maxBlockID}
-	iter := cache.metaDb.NewIterator(rng, nil)
-	defer iter.Release()
+	pivot := blockID.Bytes()
+	rngs := []*util.Range{{Start: pivot, Limit: cache.maxBlockID}}
+	if len(pivot) > 0 {
+		// Pinned blocks may fill the range after the pivot, so wrap
+		// around to the blocks before it.
+		rngs = append(rngs, &util.Range{Start: nil, Limit: pivot})
+	}
 
 	blockIDs := make(blockIDsByTime, 0, numElements)
+	// Pinned blocks aren't candidates for eviction, so they don't
+	// count towards the number of elements considered.  They do count
+	// towards the scan limit though, so that a mostly-pinned cache
+	// isn't scanned in full while holding the lock.
+	numScanned := 0
+	maxScanned := numElements * evictionScanLimitFactor
+	for _, rng := range rngs {
+		if len(blockIDs) >= numElements || numScanned >= maxScanned {
+			break
+		}
+		blockIDs, numScanned = cache.getEvictionCandidatesLocked(
+			ctx, rng, blockIDs, numElements, numScanned, maxScanned)
+	}
+
+	return cache.evictSomeBlocks(ctx, numBlocks, blockIDs)
+}
 
-	for i := 0; i < numElements; i++ {
+// getEvictionCandidatesLocked appends the unpinned blocks in `rng` of
+// cache.metaDb to `blockIDs`, until it has `numElements` of them or
+// `maxScanned` entries have been scanned in total.
+func (cache *DiskBlockCacheLocal) getEvictionCandidatesLocked(
+	ctx context.Context, rng *util.Range, blockIDs blockIDsByTime,
+	numElements, numScanned, maxScanned int) (blockIDsByTime, int) {
+	iter := cache.metaDb.NewIterator(rng, nil)
+	defer iter.Release()
+	for len(blockIDs) < numElements && numScanned < maxScanned {
 		if !iter.Next() {
 			break
 		}
+		numScanned++
 		key := iter.Key()
 
+		blockID, err := kbfsblock.IDFromBytes(key)
 		if err != nil {
 			cache.log.CWarningf(ctx, "Error decoding block ID %x", key)
 			continue
 		}
-		blockID, err := kbfsblock.IDFromBytes(key)
 		metadata := DiskBlockCacheMetadata{}
 		err = cache.config.Codec().Decode(iter.Value(), &metadata)
 		if err != nil {
@@ -949,10 +1074,117 @@ func (cache *DiskBlockCacheLocal) evictLocked(ctx context.Context,
 				blockID)
 			continue
 		}
+		if metadata.Pinned {
+			continue
+		}
 		blockIDs = append(blockIDs, lruEntry{blockID, metadata.LRUTime.Time})
 	}
+	return blockIDs, numScanned
+}
 
-	return cache.evictSomeBlocks(ctx, numBlocks, blockIDs)
+// updateTlfSettings applies the current disk cache settings of the
+// given TLF to the blocks of that TLF that are already in the cache:
+// it refreshes their pinned state, and evicts blocks until the TLF
+// is within its byte limit.  It only has an effect on the working
+// set cache.
+func (cache *DiskBlockCacheLocal) updateTlfSettings(
+	ctx context.Context, tlfID tlf.ID) error {
+	if cache.cacheType != workingSetCacheLimitTrackerType {
+		return nil
+	}
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	err := cache.checkCacheLocked("updateTlfSettings")
+	if err != nil {
+		return err
+	}
+
+	settings := cache.config.GetDiskCacheTlfSettings(tlfID)
+	tlfBytes := tlfID.Bytes()
+	iter := cache.tlfDb.NewIterator(util.BytesPrefix(tlfBytes), nil)
+	defer iter.Release()
+	for iter.Next() {
+		blockKey := iter.Key()[len(tlfBytes):]
+		blockID, err := kbfsblock.IDFromBytes(blockKey)
+		if err != nil {
+			cache.log.CWarningf(ctx, "Error decoding block ID %x", blockKey)
+			continue
+		}
+		md, err := cache.getMetadataLocked(blockID)
+		if err != nil {
+			continue
+		}
+		if md.Pinned == settings.Pinned {
+			continue
+		}
+		md.Pinned = settings.Pinned
+		// Preserve the LRU time, since the block wasn't used.
+		err = cache.putMetadataLocked(ctx, blockID.Bytes(), md)
+		if err != nil {
+			return err
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	if settings.LimitBytes == 0 {
+		return nil
+	}
+	// Keep going until the TLF is under its limit, or no more blocks
+	// can be evicted.
+	underLimit, err := cache.evictFromTLFUntilUnderLimit(
+		ctx, tlfID, settings.LimitBytes, 0, cache.tlfCounts[tlfID])
+	if err != nil {
+		return err
+	}
+	if !underLimit {
+		cache.log.CDebugf(ctx, "Couldn't bring TLF %s under its limit of "+
+			"%d bytes: %d bytes remain", tlfID, settings.LimitBytes,
+			cache.tlfSizes[tlfID])
+	}
+	return nil
+}
+
+// registerMetrics adds this cache's meters and sizes to the metrics
+// registry, if there is one, labeled by the cache type.  Any metrics
+// from a previous cache of the same type are replaced.
+func (cache *DiskBlockCacheLocal) registerMetrics() {
+	registry := cache.config.MetricsRegistry()
+	if registry == nil {
+		return
+	}
+	var label string
+	switch cache.cacheType {
+	case syncCacheLimitTrackerType:
+		label = "sync"
+	case workingSetCacheLimitTrackerType:
+		label = "working_set"
+	default:
+		return
+	}
+	register := func(name string, m interface{}) {
+		metricsutil.ReplaceMetric(registry, metricsutil.NameWithLabels(
+			"DiskBlockCache."+name, "cache", label), m)
+	}
+	register("Hits", cache.hitMeter)
+	register("Misses", cache.missMeter)
+	register("Puts", cache.putMeter)
+	register("MetadataUpdates", cache.updateMeter)
+	register("NumEvicted", cache.evictCountMeter)
+	register("SizeEvicted", cache.evictSizeMeter)
+	register("NumDeleted", cache.deleteCountMeter)
+	register("SizeDeleted", cache.deleteSizeMeter)
+	register("NumBlocks", metrics.NewFunctionalGauge(func() int64 {
+		cache.lock.RLock()
+		defer cache.lock.RUnlock()
+		return int64(cache.numBlocks)
+	}))
+	register("Bytes", metrics.NewFunctionalGauge(func() int64 {
+		cache.lock.RLock()
+		defer cache.lock.RUnlock()
+		return int64(cache.currBytes)
+	}))
 }
 
 // Status implements the DiskBlockCache interface for DiskBlockCacheStandard.
@@ -979,6 +1211,22 @@ func (cache *DiskBlockCacheLocal) Status(
 	}
 	cache.lock.RLock()
 	defer cache.lock.RUnlock()
+	tlfStatuses := make(map[string]DiskBlockCacheTlfStatus)
+	for tlfID, count := range cache.tlfCounts {
+		if count == 0 {
+			continue
+		}
+		tlfStatus := DiskBlockCacheTlfStatus{
+			NumBlocks:  uint64(count),
+			BlockBytes: cache.tlfSizes[tlfID],
+		}
+		if cache.cacheType == workingSetCacheLimitTrackerType {
+			settings := cache.config.GetDiskCacheTlfSettings(tlfID)
+			tlfStatus.LimitBytes = settings.LimitBytes
+			tlfStatus.Pinned = settings.Pinned
+		}
+		tlfStatuses[tlfID.String()] = tlfStatus
+	}
 	// The disk cache status doesn't depend on the chargedTo ID, and
 	// we don't have easy access to the UID here, so pass in a dummy.
 	return map[string]DiskBlockCacheStatus{
@@ -995,6 +1243,8 @@ func (cache *DiskBlockCacheLocal) Status(
 			SizeEvicted:     rateMeterToStatus(cache.evictSizeMeter),
 			NumDeleted:      rateMeterToStatus(cache.deleteCountMeter),
 			SizeDeleted:     rateMeterToStatus(cache.deleteSizeMeter),
+			Scrub:           cache.getScrubStatus(),
+			TlfStatuses:     tlfStatuses,
 		},
 	}
 }
@@ -37,6 +37,21 @@ type DiskBlockCacheMetadata struct {
 	TriggeredPrefetch bool `codec:"HasPrefetched"`
 	// whether the block's triggered prefetches are complete
 	FinishedPrefetch bool
+	// whether the block is pinned, and must never be evicted to make
+	// room for other TLFs' blocks
+	Pinned bool `codec:",omitempty"`
+}
+
+// DiskCacheTlfSettings are the per-TLF settings for the working set
+// disk block cache.
+type DiskCacheTlfSettings struct {
+	// Pinned indicates that none of the TLF's blocks should be
+	// evicted from the cache to make room for other TLFs' blocks.
+	Pinned bool
+	// LimitBytes is the maximum number of bytes the TLF's blocks,
+	// pinned or not, may take up in the cache; 0 means there is no
+	// per-TLF limit.
+	LimitBytes uint64
 }
 
 // lruEntry is an entry for sorting LRU times
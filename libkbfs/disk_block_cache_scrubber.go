@@ -0,0 +1,453 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/keybase/kbfs/ioutil"
+	"github.com/keybase/kbfs/kbfsblock"
+	"github.com/keybase/kbfs/kbfscodec"
+	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"golang.org/x/net/context"
+)
+
+const (
+	// diskBlockCacheScrubBatchSize is the number of entries the
+	// scrubber verifies at a time, while holding the cache's read
+	// lock.
+	diskBlockCacheScrubBatchSize = 100
+	// diskBlockCacheScrubBatchInterval is how long the scrubber
+	// waits between batches, which limits how much disk bandwidth
+	// it uses.
+	diskBlockCacheScrubBatchInterval = 1 * time.Second
+	// diskBlockCacheScrubPassInterval is how long the scrubber
+	// waits after verifying the whole cache before starting over.
+	diskBlockCacheScrubPassInterval = 24 * time.Hour
+	// diskBlockCacheScrubCheckInterval is how often the scrubber
+	// checks whether its next batch is due, according to
+	// `config.Clock()`.
+	diskBlockCacheScrubCheckInterval = 100 * time.Millisecond
+)
+
+// CtxDiskCacheScrubTagKey is the type used for unique context tags
+// within the disk block cache scrubber.
+type CtxDiskCacheScrubTagKey int
+
+const (
+	// CtxDiskCacheScrubIDKey is the type of the tag for unique
+	// operation IDs within the disk block cache scrubber.
+	CtxDiskCacheScrubIDKey CtxDiskCacheScrubTagKey = iota
+)
+
+// CtxDiskCacheScrubOpID is the display name for the unique operation
+// disk block cache scrubber ID tag.
+const CtxDiskCacheScrubOpID = "DCSID"
+
+// DiskBlockCacheScrubStatus represents the progress of verifying
+// the entries of a disk block cache.
+type DiskBlockCacheScrubStatus struct {
+	// NumChecked is the number of entries verified so far.
+	NumChecked uint64
+	// NumCorrupt is the number of entries that failed verification.
+	NumCorrupt uint64
+	// NumPasses is the number of completed passes over the cache.
+	NumPasses uint64
+}
+
+// DiskBlockCacheCorruptEntry describes an entry of a disk block
+// cache that failed verification.
+type DiskBlockCacheCorruptEntry struct {
+	// Key is the raw key of the entry, which is normally the
+	// binary-encoded block ID.
+	Key []byte
+	Err error
+}
+
+// diskBlockCacheScrubPhase is the stage of a pass over the cache.
+type diskBlockCacheScrubPhase int
+
+const (
+	// diskBlockCacheScrubMetadata verifies each metadata entry,
+	// along with the block it describes.
+	diskBlockCacheScrubMetadata diskBlockCacheScrubPhase = iota
+	// diskBlockCacheScrubBlocks looks for blocks without any
+	// metadata, which the first phase can't see.
+	diskBlockCacheScrubBlocks
+)
+
+// diskBlockCacheBadEntry is an entry of the cache that failed
+// verification.
+type diskBlockCacheBadEntry struct {
+	key []byte
+	// md is nil if the entry's metadata is missing or can't be
+	// decoded, in which case the entry isn't accounted for in the
+	// cache's totals.
+	md  *DiskBlockCacheMetadata
+	err error
+}
+
+// verifyDiskBlockCacheEntry checks that the entry with the given key
+// has decodable metadata, and a decodable block whose contents match
+// its ID.  It returns the entry's metadata if it could be decoded.
+func verifyDiskBlockCacheEntry(codec kbfscodec.Codec,
+	blockDb, metaDb *levelDb, key []byte) (*DiskBlockCacheMetadata, error) {
+	blockID, err := kbfsblock.IDFromBytes(key)
+	if err != nil {
+		return nil, err
+	}
+	metadataBytes, err := metaDb.Get(key, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading metadata")
+	}
+	var md DiskBlockCacheMetadata
+	err = codec.Decode(metadataBytes, &md)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding metadata")
+	}
+	entryBytes, err := blockDb.Get(key, nil)
+	if err != nil {
+		return &md, errors.Wrap(err, "reading block")
+	}
+	var entry diskBlockCacheEntry
+	err = codec.Decode(entryBytes, &entry)
+	if err != nil {
+		return &md, errors.Wrap(err, "decoding block")
+	}
+	err = kbfsblock.VerifyID(entry.Buf, blockID)
+	if err != nil {
+		return &md, err
+	}
+	return &md, nil
+}
+
+// scrubDiskBlockCacheEntries verifies up to `maxEntries` entries of
+// the cache in the given phase, starting from the key `start`.  It
+// returns the entries that failed verification, and the key to
+// start the next batch from, which is nil once the phase is done.
+func scrubDiskBlockCacheEntries(codec kbfscodec.Codec,
+	blockDb, metaDb *levelDb, phase diskBlockCacheScrubPhase,
+	start []byte, maxEntries int) (numChecked int,
+	bad []diskBlockCacheBadEntry, next []byte, err error) {
+	db := metaDb
+	if phase == diskBlockCacheScrubBlocks {
+		db = blockDb
+	}
+	iter := db.NewIterator(&util.Range{Start: start}, nil)
+	defer iter.Release()
+	var key []byte
+	for numChecked < maxEntries && iter.Next() {
+		key = append([]byte(nil), iter.Key()...)
+		numChecked++
+		switch phase {
+		case diskBlockCacheScrubMetadata:
+			md, err := verifyDiskBlockCacheEntry(codec, blockDb, metaDb, key)
+			if err != nil {
+				bad = append(bad, diskBlockCacheBadEntry{key, md, err})
+			}
+		case diskBlockCacheScrubBlocks:
+			hasMetadata, err := metaDb.Has(key, nil)
+			if err != nil {
+				return 0, nil, nil, err
+			}
+			if !hasMetadata {
+				bad = append(bad, diskBlockCacheBadEntry{
+					key, nil, errors.New("block has no metadata")})
+			}
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return 0, nil, nil, err
+	}
+	if numChecked < maxEntries {
+		return numChecked, bad, nil, nil
+	}
+	// Continue from the smallest key after the last one checked.
+	return numChecked, bad, append(key, 0), nil
+}
+
+// removeBadEntriesLocked deletes the given entries from the cache.
+func (cache *DiskBlockCacheLocal) removeBadEntriesLocked(
+	ctx context.Context, bad []diskBlockCacheBadEntry) error {
+	blockIDs := make([]kbfsblock.ID, 0, len(bad))
+	for _, entry := range bad {
+		cache.log.CWarningf(ctx, "Removing corrupt disk cache entry %x: %+v",
+			entry.key, entry.err)
+		if entry.md != nil {
+			// The metadata is intact, so the entry is accounted for
+			// and can be deleted normally.
+			blockID, err := kbfsblock.IDFromBytes(entry.key)
+			if err != nil {
+				return err
+			}
+			blockIDs = append(blockIDs, blockID)
+			continue
+		}
+		// Without metadata the entry isn't accounted for, so just
+		// remove whatever is left of it.
+		err := cache.blockDb.Delete(entry.key, nil)
+		if err != nil {
+			return err
+		}
+		err = cache.metaDb.Delete(entry.key, nil)
+		if err != nil {
+			return err
+		}
+	}
+	_, _, err := cache.deleteLocked(ctx, blockIDs)
+	return err
+}
+
+// recheckBadEntriesLocked returns the entries of `bad` that still
+// fail verification.  The entries were verified without the
+// exclusive lock, so they may have been replaced or removed since.
+func (cache *DiskBlockCacheLocal) recheckBadEntriesLocked(
+	phase diskBlockCacheScrubPhase, bad []diskBlockCacheBadEntry) (
+	stillBad []diskBlockCacheBadEntry, err error) {
+	for _, entry := range bad {
+		hasMetadata, err := cache.metaDb.Has(entry.key, nil)
+		if err != nil {
+			return nil, err
+		}
+		switch phase {
+		case diskBlockCacheScrubMetadata:
+			if !hasMetadata {
+				// Already removed.
+				continue
+			}
+			md, err := verifyDiskBlockCacheEntry(cache.config.Codec(),
+				cache.blockDb, cache.metaDb, entry.key)
+			if err != nil {
+				stillBad = append(
+					stillBad, diskBlockCacheBadEntry{entry.key, md, err})
+			}
+		case diskBlockCacheScrubBlocks:
+			if !hasMetadata {
+				stillBad = append(stillBad, entry)
+			}
+		}
+	}
+	return stillBad, nil
+}
+
+// getScrubStatus returns the progress of the background scrubber.
+func (cache *DiskBlockCacheLocal) getScrubStatus() DiskBlockCacheScrubStatus {
+	cache.scrubLock.Lock()
+	defer cache.scrubLock.Unlock()
+	return cache.scrubStatus
+}
+
+// scrubBatch verifies the next batch of entries in the cache,
+// removes any that are corrupt, and returns where the next batch
+// should start.  `passDone` is true if this batch finished a full
+// pass over the cache.  Entries are read and verified under the
+// cache's read lock; the exclusive lock is only taken to remove
+// corrupt entries.
+func (cache *DiskBlockCacheLocal) scrubBatch(ctx context.Context,
+	phase diskBlockCacheScrubPhase, start []byte) (
+	nextPhase diskBlockCacheScrubPhase, nextStart []byte, passDone bool,
+	err error) {
+	numChecked, bad, next, err := func() (
+		int, []diskBlockCacheBadEntry, []byte, error) {
+		cache.lock.RLock()
+		defer cache.lock.RUnlock()
+		err := cache.checkCacheLocked("scrubBatch")
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		return scrubDiskBlockCacheEntries(
+			cache.config.Codec(), cache.blockDb, cache.metaDb, phase, start,
+			diskBlockCacheScrubBatchSize)
+	}()
+	if err != nil {
+		return phase, start, false, err
+	}
+
+	if len(bad) > 0 {
+		err = func() error {
+			cache.lock.Lock()
+			defer cache.lock.Unlock()
+			err := cache.checkCacheLocked("scrubBatch")
+			if err != nil {
+				return err
+			}
+			bad, err = cache.recheckBadEntriesLocked(phase, bad)
+			if err != nil {
+				return err
+			}
+			return cache.removeBadEntriesLocked(ctx, bad)
+		}()
+		if err != nil {
+			return phase, start, false, err
+		}
+	}
+
+	cache.scrubLock.Lock()
+	defer cache.scrubLock.Unlock()
+	cache.scrubStatus.NumChecked += uint64(numChecked)
+	cache.scrubStatus.NumCorrupt += uint64(len(bad))
+	switch {
+	case next != nil:
+		return phase, next, false, nil
+	case phase == diskBlockCacheScrubMetadata:
+		return diskBlockCacheScrubBlocks, nil, false, nil
+	default:
+		cache.scrubStatus.NumPasses++
+		cache.log.CDebugf(ctx, "Finished scrubbing the disk cache: %+v",
+			cache.scrubStatus)
+		return diskBlockCacheScrubMetadata, nil, true, nil
+	}
+}
+
+// scrubLoop periodically verifies every entry in the cache in the
+// background, a batch at a time, until the cache is shut down.
+func (cache *DiskBlockCacheLocal) scrubLoop() {
+	select {
+	case <-cache.startedCh:
+	case <-cache.startErrCh:
+		return
+	}
+	ctx := CtxWithRandomIDReplayable(context.Background(),
+		CtxDiskCacheScrubIDKey, CtxDiskCacheScrubOpID, cache.log)
+
+	phase := diskBlockCacheScrubMetadata
+	var start []byte
+	clock := cache.config.Clock()
+	nextBatch := clock.Now().Add(diskBlockCacheScrubBatchInterval)
+	// Check often, rather than sleeping until the next batch, so
+	// that the schedule follows `config.Clock()`.
+	ticker := time.NewTicker(diskBlockCacheScrubCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-cache.shutdownCh:
+			return
+		}
+		if clock.Now().Before(nextBatch) {
+			continue
+		}
+		var passDone bool
+		var err error
+		phase, start, passDone, err = cache.scrubBatch(ctx, phase, start)
+		switch errors.Cause(err).(type) {
+		case nil:
+		case DiskCacheClosedError:
+			return
+		default:
+			cache.log.CDebugf(ctx, "Error scrubbing the disk cache: %+v", err)
+		}
+		if passDone {
+			nextBatch = clock.Now().Add(diskBlockCacheScrubPassInterval)
+		} else {
+			nextBatch = clock.Now().Add(diskBlockCacheScrubBatchInterval)
+		}
+	}
+}
+
+// VerifyDiskBlockCache verifies every entry of the disk block cache
+// stored in `dirPath`, which is the cache's directory under the KBFS
+// storage root (e.g., "kbfs_block_cache").  The cache must not be in
+// use by a running KBFS instance.  If `fix` is true, the corrupt
+// entries are removed; otherwise the cache is opened read-only.
+func VerifyDiskBlockCache(ctx context.Context, codec kbfscodec.Codec,
+	dirPath string, fix bool) (status DiskBlockCacheScrubStatus,
+	corrupt []DiskBlockCacheCorruptEntry, err error) {
+	versionBytes, err := ioutil.ReadFile(
+		filepath.Join(dirPath, versionFilename))
+	if err != nil {
+		return DiskBlockCacheScrubStatus{}, nil, err
+	}
+	version, err := strconv.ParseUint(string(versionBytes), 10,
+		strconv.IntSize)
+	if err != nil {
+		return DiskBlockCacheScrubStatus{}, nil, errors.WithStack(err)
+	}
+	versionPath := versionPathFromVersion(dirPath, version)
+
+	options := *leveldbOptions
+	options.ReadOnly = !fix
+	openDb := func(name string) (*levelDb, error) {
+		stor, err := storage.OpenFile(filepath.Join(versionPath, name), !fix)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return openLevelDBWithOptions(stor, &options)
+	}
+	blockDb, err := openDb(blockDbFilename)
+	if err != nil {
+		return DiskBlockCacheScrubStatus{}, nil, err
+	}
+	defer blockDb.Close()
+	metaDb, err := openDb(metaDbFilename)
+	if err != nil {
+		return DiskBlockCacheScrubStatus{}, nil, err
+	}
+	defer metaDb.Close()
+	tlfDb, err := openDb(tlfDbFilename)
+	if err != nil {
+		return DiskBlockCacheScrubStatus{}, nil, err
+	}
+	defer tlfDb.Close()
+
+	var bad []diskBlockCacheBadEntry
+	for _, phase := range []diskBlockCacheScrubPhase{
+		diskBlockCacheScrubMetadata, diskBlockCacheScrubBlocks} {
+		var start []byte
+		for {
+			select {
+			case <-ctx.Done():
+				return DiskBlockCacheScrubStatus{}, nil, ctx.Err()
+			default:
+			}
+			numChecked, phaseBad, next, err := scrubDiskBlockCacheEntries(
+				codec, blockDb, metaDb, phase, start,
+				diskBlockCacheScrubBatchSize)
+			if err != nil {
+				return DiskBlockCacheScrubStatus{}, nil, err
+			}
+			status.NumChecked += uint64(numChecked)
+			bad = append(bad, phaseBad...)
+			if next == nil {
+				break
+			}
+			start = next
+		}
+	}
+	status.NumCorrupt = uint64(len(bad))
+	status.NumPasses = 1
+
+	corrupt = make([]DiskBlockCacheCorruptEntry, 0, len(bad))
+	blockBatch := new(leveldb.Batch)
+	metadataBatch := new(leveldb.Batch)
+	tlfBatch := new(leveldb.Batch)
+	for _, entry := range bad {
+		corrupt = append(corrupt, DiskBlockCacheCorruptEntry{
+			entry.key, entry.err})
+		blockBatch.Delete(entry.key)
+		metadataBatch.Delete(entry.key)
+		if entry.md != nil {
+			tlfBatch.Delete(append(entry.md.TlfID.Bytes(), entry.key...))
+		}
+	}
+	if !fix || len(bad) == 0 {
+		return status, corrupt, nil
+	}
+	if err := metaDb.Write(metadataBatch, nil); err != nil {
+		return DiskBlockCacheScrubStatus{}, nil, err
+	}
+	if err := tlfDb.Write(tlfBatch, nil); err != nil {
+		return DiskBlockCacheScrubStatus{}, nil, err
+	}
+	if err := blockDb.Write(blockBatch, nil); err != nil {
+		return DiskBlockCacheScrubStatus{}, nil, err
+	}
+	return status, corrupt, nil
+}
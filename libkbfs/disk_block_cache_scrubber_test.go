@@ -0,0 +1,244 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/keybase/kbfs/ioutil"
+	"github.com/keybase/kbfs/kbfsblock"
+	"github.com/keybase/kbfs/kbfscodec"
+	"github.com/keybase/kbfs/kbfscrypto"
+	"github.com/keybase/kbfs/tlf"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+	"golang.org/x/net/context"
+)
+
+// makeVerifiableBlockForDiskCache returns a block buffer along with
+// the ID that matches its contents.
+func makeVerifiableBlockForDiskCache(
+	t *testing.T, config diskBlockCacheConfig) (
+	kbfsblock.ID, []byte, kbfscrypto.BlockCryptKeyServerHalf) {
+	_, _, buf, serverHalf := setupBlockForDiskCache(t, config)
+	id, err := kbfsblock.MakePermanentID(buf)
+	require.NoError(t, err)
+	return id, buf, serverHalf
+}
+
+func TestDiskBlockCacheScrub(t *testing.T) {
+	t.Parallel()
+	t.Log("Test that the scrubber removes corrupt disk cache entries.")
+	cache, config := initDiskBlockCacheTest(t)
+	standardCache := cache.workingSetCache
+	defer shutdownDiskBlockCacheTest(cache)
+
+	ctx := context.Background()
+	tlf1 := tlf.FakeID(0, tlf.Private)
+	numBlocks := 2*diskBlockCacheScrubBatchSize + 10
+	var ids []kbfsblock.ID
+	for i := 0; i < numBlocks; i++ {
+		id, buf, serverHalf := makeVerifiableBlockForDiskCache(t, config)
+		err := standardCache.Put(ctx, tlf1, id, buf, serverHalf)
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+
+	t.Log("Replace one block with contents that don't match its ID.")
+	badID := ids[0]
+	_, _, otherBuf, otherServerHalf := setupBlockForDiskCache(t, config)
+	entry, err := standardCache.encodeBlockCacheEntry(
+		otherBuf, otherServerHalf)
+	require.NoError(t, err)
+	err = standardCache.blockDb.Put(badID.Bytes(), entry, nil)
+	require.NoError(t, err)
+
+	t.Log("Add a block without any metadata.")
+	orphanID, orphanBuf, orphanServerHalf :=
+		makeVerifiableBlockForDiskCache(t, config)
+	entry, err = standardCache.encodeBlockCacheEntry(
+		orphanBuf, orphanServerHalf)
+	require.NoError(t, err)
+	err = standardCache.blockDb.Put(orphanID.Bytes(), entry, nil)
+	require.NoError(t, err)
+
+	t.Log("Scrub the whole cache.")
+	phase := diskBlockCacheScrubMetadata
+	var start []byte
+	for passDone := false; !passDone; {
+		phase, start, passDone, err = standardCache.scrubBatch(
+			ctx, phase, start)
+		require.NoError(t, err)
+	}
+
+	status := standardCache.Status(ctx)[workingSetCacheName].Scrub
+	require.Equal(t, DiskBlockCacheScrubStatus{
+		// The metadata phase checks every block with metadata, and
+		// removes the bad one before the block phase checks the rest
+		// along with the orphan.
+		NumChecked: uint64(2 * numBlocks),
+		NumCorrupt: 2,
+		NumPasses:  1,
+	}, status)
+	require.Equal(t, numBlocks-1, standardCache.numBlocks)
+	_, _, _, err = standardCache.Get(ctx, tlf1, badID)
+	require.IsType(t, NoSuchBlockError{}, err)
+	hasOrphan, err := standardCache.blockDb.Has(orphanID.Bytes(), nil)
+	require.NoError(t, err)
+	require.False(t, hasOrphan)
+	for _, id := range ids[1:] {
+		_, _, _, err = standardCache.Get(ctx, tlf1, id)
+		require.NoError(t, err)
+	}
+}
+
+func TestDiskBlockCacheScrubRecheck(t *testing.T) {
+	t.Parallel()
+	t.Log("Test that entries fixed after verification aren't removed.")
+	cache, config := initDiskBlockCacheTest(t)
+	standardCache := cache.workingSetCache
+	defer shutdownDiskBlockCacheTest(cache)
+
+	ctx := context.Background()
+	tlf1 := tlf.FakeID(0, tlf.Private)
+	id, buf, serverHalf := makeVerifiableBlockForDiskCache(t, config)
+	err := standardCache.Put(ctx, tlf1, id, buf, serverHalf)
+	require.NoError(t, err)
+	removedID, _, _ := makeVerifiableBlockForDiskCache(t, config)
+
+	standardCache.lock.Lock()
+	defer standardCache.lock.Unlock()
+	bad, err := standardCache.recheckBadEntriesLocked(
+		diskBlockCacheScrubMetadata, []diskBlockCacheBadEntry{
+			{id.Bytes(), nil, errors.New("fake")},
+			{removedID.Bytes(), nil, errors.New("fake")},
+		})
+	require.NoError(t, err)
+	require.Len(t, bad, 0)
+	bad, err = standardCache.recheckBadEntriesLocked(
+		diskBlockCacheScrubBlocks, []diskBlockCacheBadEntry{
+			{id.Bytes(), nil, errors.New("fake")},
+			{removedID.Bytes(), nil, errors.New("fake")},
+		})
+	require.NoError(t, err)
+	require.Len(t, bad, 1)
+	require.Equal(t, removedID.Bytes(), bad[0].key)
+}
+
+func TestDiskBlockCacheScrubLoopFollowsClock(t *testing.T) {
+	t.Parallel()
+	t.Log("Test that the scrub loop schedules batches by the config clock.")
+	cache, config := initDiskBlockCacheTest(t)
+	standardCache := cache.workingSetCache
+	defer shutdownDiskBlockCacheTest(cache)
+
+	ctx := context.Background()
+	tlf1 := tlf.FakeID(0, tlf.Private)
+	id, buf, serverHalf := makeVerifiableBlockForDiskCache(t, config)
+	err := standardCache.Put(ctx, tlf1, id, buf, serverHalf)
+	require.NoError(t, err)
+
+	go standardCache.scrubLoop()
+	time.Sleep(3 * diskBlockCacheScrubCheckInterval)
+	require.Equal(t, DiskBlockCacheScrubStatus{},
+		standardCache.getScrubStatus())
+
+	t.Log("Once the clock reaches the next batch, the whole (small) " +
+		"cache gets scrubbed.")
+	config.TestClock().Add(diskBlockCacheScrubBatchInterval)
+	for i := 0; standardCache.getScrubStatus().NumChecked == 0; i++ {
+		require.True(t, i < 100, "The scrubber didn't run")
+		time.Sleep(diskBlockCacheScrubCheckInterval)
+	}
+	config.TestClock().Add(diskBlockCacheScrubBatchInterval)
+	for i := 0; standardCache.getScrubStatus().NumPasses == 0; i++ {
+		require.True(t, i < 100, "The scrubber didn't finish a pass")
+		time.Sleep(diskBlockCacheScrubCheckInterval)
+	}
+	require.Equal(t, DiskBlockCacheScrubStatus{
+		NumChecked: 2,
+		NumPasses:  1,
+	}, standardCache.getScrubStatus())
+}
+
+func TestVerifyDiskBlockCache(t *testing.T) {
+	t.Parallel()
+	t.Log("Test verifying and fixing an offline disk cache directory.")
+	tempdir, err := ioutil.TempDir(os.TempDir(), "disk_block_cache_verify")
+	require.NoError(t, err)
+	defer func() {
+		err := ioutil.RemoveAll(tempdir)
+		require.NoError(t, err)
+	}()
+
+	config := newTestDiskBlockCacheConfig(t)
+	codec := kbfscodec.NewMsgpack()
+	versionPath, err := getVersionedPathForDiskCache(
+		config.MakeLogger(""), tempdir)
+	require.NoError(t, err)
+	openDb := func(name string) *levelDb {
+		stor, err := storage.OpenFile(filepath.Join(versionPath, name), false)
+		require.NoError(t, err)
+		db, err := openLevelDB(stor)
+		require.NoError(t, err)
+		return db
+	}
+
+	t.Log("Write one good block and one corrupt block.")
+	tlf1 := tlf.FakeID(0, tlf.Private)
+	blockDb := openDb(blockDbFilename)
+	metaDb := openDb(metaDbFilename)
+	tlfDb := openDb(tlfDbFilename)
+	goodID, goodBuf, goodServerHalf := makeVerifiableBlockForDiskCache(
+		t, config)
+	badID, _, badServerHalf := makeVerifiableBlockForDiskCache(t, config)
+	for _, e := range []struct {
+		id  kbfsblock.ID
+		buf []byte
+		sh  kbfscrypto.BlockCryptKeyServerHalf
+	}{
+		{goodID, goodBuf, goodServerHalf},
+		{badID, []byte{1, 2, 3}, badServerHalf},
+	} {
+		entry, err := codec.Encode(&diskBlockCacheEntry{e.buf, e.sh})
+		require.NoError(t, err)
+		err = blockDb.Put(e.id.Bytes(), entry, nil)
+		require.NoError(t, err)
+		md, err := codec.Encode(&DiskBlockCacheMetadata{
+			TlfID: tlf1, BlockSize: uint32(len(entry))})
+		require.NoError(t, err)
+		err = metaDb.Put(e.id.Bytes(), md, nil)
+		require.NoError(t, err)
+		err = tlfDb.Put(append(tlf1.Bytes(), e.id.Bytes()...), nil, nil)
+		require.NoError(t, err)
+	}
+	blockDb.Close()
+	metaDb.Close()
+	tlfDb.Close()
+
+	ctx := context.Background()
+	t.Log("Verify without fixing.")
+	status, corrupt, err := VerifyDiskBlockCache(ctx, codec, tempdir, false)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), status.NumCorrupt)
+	require.Len(t, corrupt, 1)
+	require.Equal(t, badID.Bytes(), corrupt[0].Key)
+
+	t.Log("Fix the cache, and make sure it's clean afterwards.")
+	_, corrupt, err = VerifyDiskBlockCache(ctx, codec, tempdir, true)
+	require.NoError(t, err)
+	require.Len(t, corrupt, 1)
+	status, corrupt, err = VerifyDiskBlockCache(ctx, codec, tempdir, false)
+	require.NoError(t, err)
+	require.Equal(t, DiskBlockCacheScrubStatus{
+		NumChecked: 2,
+		NumPasses:  1,
+	}, status)
+	require.Len(t, corrupt, 0)
+}
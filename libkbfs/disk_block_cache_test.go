@@ -13,6 +13,7 @@ import (
 	"github.com/keybase/kbfs/kbfsblock"
 	"github.com/keybase/kbfs/kbfscrypto"
 	"github.com/keybase/kbfs/tlf"
+	metrics "github.com/rcrowley/go-metrics"
 	"github.com/stretchr/testify/require"
 	"github.com/syndtr/goleveldb/leveldb/errors"
 	"github.com/syndtr/goleveldb/leveldb/util"
@@ -29,6 +30,7 @@ type testDiskBlockCacheConfig struct {
 	*testClockGetter
 	limiter DiskLimiter
 	syncedTlfGetterSetter
+	diskCacheTlfSettingsGetterSetter
 	initModeGetter
 }
 
@@ -39,6 +41,7 @@ func newTestDiskBlockCacheConfig(t *testing.T) *testDiskBlockCacheConfig {
 		newTestClockGetter(),
 		nil,
 		newTestSyncedTlfGetterSetter(),
+		newTestDiskCacheTlfSettingsGetterSetter(),
 		testInitModeGetter{InitDefault},
 	}
 }
@@ -47,6 +50,10 @@ func (c testDiskBlockCacheConfig) DiskLimiter() DiskLimiter {
 	return c.limiter
 }
 
+func (c testDiskBlockCacheConfig) MetricsRegistry() metrics.Registry {
+	return nil
+}
+
 func newDiskBlockCacheForTest(config *testDiskBlockCacheConfig,
 	maxBytes int64) (*diskBlockCacheWrapped, error) {
 	maxFiles := int64(10000)
@@ -403,6 +410,177 @@ func TestDiskBlockCacheEvictOverall(t *testing.T) {
 		"Average overall LRU delta from an eviction: %.2f", averageDifference)
 }
 
+func TestDiskBlockCacheTlfSettings(t *testing.T) {
+	t.Parallel()
+	t.Log("Test that eviction honors pinned TLFs and per-TLF limits.")
+	cache, config := initDiskBlockCacheTest(t)
+	standardCache := cache.workingSetCache
+	defer shutdownDiskBlockCacheTest(cache)
+
+	ctx := context.Background()
+	clock := config.TestClock()
+	pinnedTlf := tlf.FakeID(1, tlf.Private)
+	limitedTlf := tlf.FakeID(2, tlf.Private)
+	otherTlf := tlf.FakeID(3, tlf.Private)
+	numBlocksPerTlf := 20
+
+	t.Log("Seed the cache with blocks from three TLFs.")
+	for _, tlfID := range []tlf.ID{pinnedTlf, limitedTlf, otherTlf} {
+		for i := 0; i < numBlocksPerTlf; i++ {
+			blockPtr, _, blockEncoded, serverHalf := setupBlockForDiskCache(
+				t, config)
+			err := standardCache.Put(
+				ctx, tlfID, blockPtr.ID, blockEncoded, serverHalf)
+			require.NoError(t, err)
+			clock.Add(time.Second)
+		}
+	}
+
+	t.Log("Pin the first TLF, and verify that its existing blocks are " +
+		"marked as pinned.")
+	err := config.SetDiskCacheTlfSettings(
+		ctx, pinnedTlf, DiskCacheTlfSettings{Pinned: true})
+	require.NoError(t, err)
+	err = cache.updateTlfSettings(ctx, pinnedTlf)
+	require.NoError(t, err)
+	func() {
+		tlfBytes := pinnedTlf.Bytes()
+		iter := standardCache.tlfDb.NewIterator(
+			util.BytesPrefix(tlfBytes), nil)
+		defer iter.Release()
+		for iter.Next() {
+			blockID, err := kbfsblock.IDFromBytes(iter.Key()[len(tlfBytes):])
+			require.NoError(t, err)
+			md, err := standardCache.GetMetadata(ctx, blockID)
+			require.NoError(t, err)
+			require.True(t, md.Pinned)
+		}
+	}()
+
+	t.Log("Limit the second TLF to half of its current size, and verify " +
+		"that it gets evicted down to that limit.")
+	limit := standardCache.tlfSizes[limitedTlf] / 2
+	err = config.SetDiskCacheTlfSettings(
+		ctx, limitedTlf, DiskCacheTlfSettings{LimitBytes: limit})
+	require.NoError(t, err)
+	err = cache.updateTlfSettings(ctx, limitedTlf)
+	require.NoError(t, err)
+	require.True(t, standardCache.tlfSizes[limitedTlf] <= limit)
+	require.Equal(t, numBlocksPerTlf, standardCache.tlfCounts[pinnedTlf])
+	require.Equal(t, numBlocksPerTlf, standardCache.tlfCounts[otherTlf])
+
+	t.Log("Put more blocks into the limited TLF; it must stay under its " +
+		"limit without touching the other TLFs.")
+	for i := 0; i < numBlocksPerTlf; i++ {
+		blockPtr, _, blockEncoded, serverHalf := setupBlockForDiskCache(
+			t, config)
+		err := standardCache.Put(
+			ctx, limitedTlf, blockPtr.ID, blockEncoded, serverHalf)
+		require.NoError(t, err)
+		clock.Add(time.Second)
+		require.True(t, standardCache.tlfSizes[limitedTlf] <= limit)
+	}
+	require.Equal(t, numBlocksPerTlf, standardCache.tlfCounts[otherTlf])
+
+	t.Log("Verify the per-TLF status.")
+	status := cache.Status(ctx)[workingSetCacheName]
+	require.Equal(t, DiskBlockCacheTlfStatus{
+		NumBlocks:  uint64(numBlocksPerTlf),
+		BlockBytes: standardCache.tlfSizes[pinnedTlf],
+		Pinned:     true,
+	}, status.TlfStatuses[pinnedTlf.String()])
+	require.Equal(t, limit,
+		status.TlfStatuses[limitedTlf.String()].LimitBytes)
+
+	t.Log("Evict as much as possible, and verify that only the pinned " +
+		"blocks remain.")
+	for i := 0; i < 100 && standardCache.numBlocks > numBlocksPerTlf; i++ {
+		_, _, err := standardCache.evictLocked(ctx, 10)
+		require.NoError(t, err)
+	}
+	require.Equal(t, numBlocksPerTlf, standardCache.numBlocks)
+	require.Equal(t, numBlocksPerTlf, standardCache.tlfCounts[pinnedTlf])
+
+	t.Log("Unpin the TLF, and verify that its blocks can be evicted.")
+	err = config.SetDiskCacheTlfSettings(
+		ctx, pinnedTlf, DiskCacheTlfSettings{})
+	require.NoError(t, err)
+	err = cache.updateTlfSettings(ctx, pinnedTlf)
+	require.NoError(t, err)
+	numRemoved, _, err := standardCache.evictLocked(ctx, 10)
+	require.NoError(t, err)
+	require.Equal(t, 10, numRemoved)
+
+	t.Log("Pin the limited TLF; its pinned blocks still can't push it " +
+		"over its limit, and Puts keep succeeding.")
+	err = config.SetDiskCacheTlfSettings(ctx, limitedTlf,
+		DiskCacheTlfSettings{Pinned: true, LimitBytes: limit})
+	require.NoError(t, err)
+	err = cache.updateTlfSettings(ctx, limitedTlf)
+	require.NoError(t, err)
+	for i := 0; i < numBlocksPerTlf; i++ {
+		blockPtr, _, blockEncoded, serverHalf := setupBlockForDiskCache(
+			t, config)
+		err := standardCache.Put(
+			ctx, limitedTlf, blockPtr.ID, blockEncoded, serverHalf)
+		require.NoError(t, err)
+		clock.Add(time.Second)
+		require.True(t, standardCache.tlfSizes[limitedTlf] <= limit)
+	}
+
+	t.Log("Halving the limit of the pinned TLF evicts its blocks.")
+	err = config.SetDiskCacheTlfSettings(ctx, limitedTlf,
+		DiskCacheTlfSettings{Pinned: true, LimitBytes: limit / 2})
+	require.NoError(t, err)
+	err = cache.updateTlfSettings(ctx, limitedTlf)
+	require.NoError(t, err)
+	require.True(t, standardCache.tlfSizes[limitedTlf] <= limit/2)
+}
+
+func TestDiskBlockCacheEvictWrapsAroundPinnedBlocks(t *testing.T) {
+	t.Parallel()
+	t.Log("Test that eviction finds unpinned blocks before its random pivot.")
+	cache, config := initDiskBlockCacheTest(t)
+	standardCache := cache.workingSetCache
+	defer shutdownDiskBlockCacheTest(cache)
+
+	ctx := context.Background()
+	clock := config.TestClock()
+	pinnedTlf := tlf.FakeID(1, tlf.Private)
+	otherTlf := tlf.FakeID(2, tlf.Private)
+
+	t.Log("Fill most of the cache with pinned blocks.")
+	err := config.SetDiskCacheTlfSettings(
+		ctx, pinnedTlf, DiskCacheTlfSettings{Pinned: true})
+	require.NoError(t, err)
+	numPinned := 60
+	for i := 0; i < numPinned; i++ {
+		blockPtr, _, blockEncoded, serverHalf := setupBlockForDiskCache(
+			t, config)
+		err := standardCache.Put(
+			ctx, pinnedTlf, blockPtr.ID, blockEncoded, serverHalf)
+		require.NoError(t, err)
+		clock.Add(time.Second)
+	}
+
+	t.Log("Wherever the pivot lands, every unpinned block is considered.")
+	numUnpinned := 3
+	for round := 0; round < 10; round++ {
+		for i := 0; i < numUnpinned; i++ {
+			blockPtr, _, blockEncoded, serverHalf := setupBlockForDiskCache(
+				t, config)
+			err := standardCache.Put(
+				ctx, otherTlf, blockPtr.ID, blockEncoded, serverHalf)
+			require.NoError(t, err)
+			clock.Add(time.Second)
+		}
+		numRemoved, _, err := standardCache.evictLocked(ctx, 10)
+		require.NoError(t, err)
+		require.Equal(t, numUnpinned, numRemoved)
+		require.Equal(t, numPinned, standardCache.numBlocks)
+	}
+}
+
 func TestDiskBlockCacheStaticLimit(t *testing.T) {
 	t.Parallel()
 	t.Log("Test that disk cache eviction works when we hit the static limit.")
@@ -29,7 +29,9 @@ type diskBlockCacheConfig interface {
 	logMaker
 	clockGetter
 	diskLimiterGetter
+	metricsRegistryGetter
 	syncedTlfGetterSetter
+	diskCacheTlfSettingsGetterSetter
 	initModeGetter
 }
 
@@ -166,6 +168,22 @@ func (cache *diskBlockCacheWrapped) Put(ctx context.Context, tlfID tlf.ID,
 		go workingSetCache.Delete(ctx, []kbfsblock.ID{blockID})
 		return cache.syncCache.Put(ctx, tlfID, blockID, buf, serverHalf)
 	}
+	if len(cache.config.GetTlfSyncPaths(tlfID)) > 0 && cache.syncCache != nil {
+		// Only part of this TLF is synced, so leave the block in the
+		// sync cache if it's already there.  Otherwise it goes into
+		// the working set until the prefetcher decides it belongs to
+		// a synced subtree.
+		_, err := cache.syncCache.GetMetadata(ctx, blockID)
+		switch err {
+		case nil:
+			return cache.syncCache.Put(ctx, tlfID, blockID, buf, serverHalf)
+		case errors.ErrNotFound:
+			return cache.workingSetCache.Put(
+				ctx, tlfID, blockID, buf, serverHalf)
+		default:
+			return err
+		}
+	}
 	// TODO: Allow more intelligent transitioning from the sync cache to
 	// the working set cache.
 	if cache.syncCache != nil {
@@ -175,6 +193,41 @@ func (cache *diskBlockCacheWrapped) Put(ctx context.Context, tlfID tlf.ID,
 	return cache.workingSetCache.Put(ctx, tlfID, blockID, buf, serverHalf)
 }
 
+// moveBlockToSyncCache moves the given block, which belongs to a
+// partially-synced TLF, from the working set cache into the sync
+// cache, keeping its prefetch status.  It returns true if the block
+// was moved, and false if it wasn't in the working set cache.
+func (cache *diskBlockCacheWrapped) moveBlockToSyncCache(ctx context.Context,
+	tlfID tlf.ID, blockID kbfsblock.ID) (moved bool, err error) {
+	// This is a write operation but we are only reading the pointers to the
+	// caches. So we use a read lock.
+	cache.mtx.RLock()
+	defer cache.mtx.RUnlock()
+	if cache.syncCache == nil {
+		return false, nil
+	}
+	buf, serverHalf, prefetchStatus, err :=
+		cache.workingSetCache.Get(ctx, tlfID, blockID)
+	if _, isNoSuchBlockError := err.(NoSuchBlockError); isNoSuchBlockError {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	err = cache.syncCache.Put(ctx, tlfID, blockID, buf, serverHalf)
+	if err != nil {
+		return false, err
+	}
+	err = cache.syncCache.UpdateMetadata(ctx, blockID, prefetchStatus)
+	if err != nil {
+		return false, err
+	}
+	_, _, err = cache.workingSetCache.Delete(ctx, []kbfsblock.ID{blockID})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // Delete implements the DiskBlockCache interface for diskBlockCacheWrapped.
 func (cache *diskBlockCacheWrapped) Delete(ctx context.Context,
 	blockIDs []kbfsblock.ID) (numRemoved int, sizeRemoved int64, err error) {
@@ -210,6 +263,15 @@ func (cache *diskBlockCacheWrapped) UpdateMetadata(ctx context.Context,
 	return cache.workingSetCache.UpdateMetadata(ctx, blockID, prefetchStatus)
 }
 
+// updateTlfSettings applies the current disk cache settings of the
+// given TLF to its blocks in the working set cache.
+func (cache *diskBlockCacheWrapped) updateTlfSettings(
+	ctx context.Context, tlfID tlf.ID) error {
+	cache.mtx.RLock()
+	defer cache.mtx.RUnlock()
+	return cache.workingSetCache.updateTlfSettings(ctx, tlfID)
+}
+
 // Status implements the DiskBlockCache interface for diskBlockCacheWrapped.
 func (cache *diskBlockCacheWrapped) Status(
 	ctx context.Context) map[string]DiskBlockCacheStatus {
@@ -982,6 +982,31 @@ func (e ExclOnUnmergedError) Error() string {
 	return "an operation with O_EXCL set is called but fbo is on an unmerged local version"
 }
 
+// LockLeaseExpiredError indicates that a lock taken through the
+// LockManager was lost before it was unlocked, because its lease
+// couldn't be renewed in time.  Another device may have held the lock
+// in the meantime.
+type LockLeaseExpiredError struct {
+	LockID keybase1.LockID
+}
+
+// Error implements the error interface for LockLeaseExpiredError.
+func (e LockLeaseExpiredError) Error() string {
+	return fmt.Sprintf("The lease on lock %d expired before it was unlocked",
+		e.LockID)
+}
+
+// LockBusyError indicates that a lock couldn't be taken through the
+// LockManager without waiting, because another owner holds it.
+type LockBusyError struct {
+	LockID keybase1.LockID
+}
+
+// Error implements the error interface for LockBusyError.
+func (e LockBusyError) Error() string {
+	return fmt.Sprintf("Lock %d is held by another owner", e.LockID)
+}
+
 // OverQuotaWarning indicates that the user is over their quota, and
 // is being slowed down by the server.
 type OverQuotaWarning struct {
@@ -1204,3 +1229,38 @@ func (e RevGarbageCollectedError) Error() string {
 	return fmt.Sprintf("Requested revision %d has already been garbage "+
 		"collected (last GC'd rev=%d)", e.rev, e.lastGCRev)
 }
+
+// InvalidSyncPathError indicates that a path given for partial
+// offline sync is not a valid path relative to a TLF root.
+type InvalidSyncPathError struct {
+	path string
+}
+
+// Error implements the Error interface for InvalidSyncPathError.
+func (e InvalidSyncPathError) Error() string {
+	return fmt.Sprintf("Invalid sync path %q", e.path)
+}
+
+// NoDataAfterOffsetError indicates that a seek for data or a hole
+// started at or past the end of a file, or that only holes follow
+// the given offset when looking for data.
+type NoDataAfterOffsetError struct {
+	off uint64
+}
+
+// Error implements the Error interface for NoDataAfterOffsetError.
+func (e NoDataAfterOffsetError) Error() string {
+	return fmt.Sprintf("No data after offset %d", e.off)
+}
+
+// NoUnmergedBranchError indicates that conflicts were to be
+// resolved for a folder that has no unmerged changes on this device.
+type NoUnmergedBranchError struct {
+	tlfID tlf.ID
+}
+
+// Error implements the Error interface for NoUnmergedBranchError.
+func (e NoUnmergedBranchError) Error() string {
+	return fmt.Sprintf(
+		"Folder %s has no unmerged changes to resolve", e.tlfID)
+}
@@ -803,6 +803,217 @@ func (fd *fileData) truncateShrink(ctx context.Context, size uint64,
 	return newDe, dirtyPtrs, unrefs, newlyDirtiedChildBytes, nil
 }
 
+// punchHole deallocates the data in the half-inclusive range
+// `[startOff, endOff)` of the file, without changing its size.
+// Leaf blocks that lie entirely within the range are removed from
+// their parents, whether or not they are dirty, so that the range
+// reads back as zeros without fetching any blocks.  Other covered
+// blocks stay in the tree: the covered tail of a block that isn't
+// the last one in the file is cut off, and any other covered bytes
+// are zeroed in place. Return params:
+// * newDe: a new directory entry with the EncodedSize cleared if
+//   anything changed.
+// * dirtyPtrs: a slice of the BlockPointers that have been dirtied
+//   while punching the hole.
+// * droppedPtrs: a slice of the BlockPointers of dirty blocks that
+//   were removed from the file, which the caller must delete from
+//   the dirty block cache.
+// * unrefs: a slice of BlockInfos that must be unreferenced as part of an
+//   eventual sync of this change.  May be non-nil even if err != nil.
+// * newlyDirtiedChildBytes is the total amount of block data dirtied,
+//   which may be negative if blocks were shrunk.  As above, it may be
+//   non-zero even if err != nil.
+func (fd *fileData) punchHole(ctx context.Context, startOff, endOff Int64Offset,
+	topBlock *FileBlock, oldDe DirEntry) (
+	newDe DirEntry, dirtyPtrs, droppedPtrs []BlockPointer,
+	unrefs []BlockInfo, newlyDirtiedChildBytes int64, err error) {
+	newDe = oldDe
+	if endOff > Int64Offset(oldDe.Size) {
+		endOff = Int64Offset(oldDe.Size)
+	}
+	if startOff < 0 || endOff <= startOff {
+		return newDe, nil, nil, nil, 0, nil
+	}
+
+	fd.tree.log.CDebugf(ctx, "Punching a hole at [%d, %d) in file %v",
+		startOff, endOff, fd.rootBlockPointer())
+
+	dirtyMap := make(map[BlockPointer]bool)
+	off := startOff
+	for off < endOff {
+		ptr, parentBlocks, block, nextBlockOff, blockOff, wasDirty, err :=
+			fd.getFileBlockAtOffset(ctx, topBlock, off, blockWrite)
+		if err != nil {
+			return newDe, nil, nil, unrefs, newlyDirtiedChildBytes, err
+		}
+
+		blockEnd := blockOff + Int64Offset(len(block.Contents))
+		if off >= blockEnd {
+			// We're already in a hole, so skip to the next block.
+			if nextBlockOff < 0 {
+				break
+			}
+			off = nextBlockOff
+			continue
+		}
+
+		holeEnd := endOff
+		if holeEnd > blockEnd {
+			holeEnd = blockEnd
+		}
+
+		// Only a block that's followed by another one can be cut
+		// short, since the last block must extend to the end of
+		// the file.
+		oldLen := len(block.Contents)
+		remove := false
+		if holeEnd == blockEnd && nextBlockOff >= 0 {
+			for _, pb := range parentBlocks {
+				pb.pblock.(*FileBlock).IPtrs[pb.childIndex].Holes = true
+			}
+			lowest := parentBlocks[len(parentBlocks)-1]
+			if off == blockOff && lowest.childIndex > 0 {
+				// The first pointer of an indirect block must stay
+				// at the start of its range, but everything else
+				// can go.
+				remove = true
+				lowest.pblock.(*FileBlock).IPtrs[lowest.childIndex-1].Holes =
+					true
+			} else {
+				block.Contents = append(
+					[]byte(nil), block.Contents[:off-blockOff]...)
+			}
+		} else {
+			zeroes := block.Contents[off-blockOff : holeEnd-blockOff]
+			for i := range zeroes {
+				zeroes[i] = 0
+			}
+		}
+
+		newDirtyPtrs, newUnrefs, err := fd.tree.markParentsDirty(parentBlocks)
+		unrefs = append(unrefs, newUnrefs...)
+		if err != nil {
+			return newDe, nil, nil, unrefs, newlyDirtiedChildBytes, err
+		}
+		for _, p := range newDirtyPtrs {
+			dirtyMap[p] = true
+		}
+
+		if remove {
+			// `markParentsDirty` has already unreferenced the
+			// removed block, so just drop it from its parent.  If
+			// it was dirty, its bytes won't be synced anymore.
+			if wasDirty {
+				newlyDirtiedChildBytes -= int64(oldLen)
+				droppedPtrs = append(droppedPtrs, ptr)
+			}
+			lowestIndex := len(parentBlocks) - 1
+			lowest := parentBlocks[lowestIndex]
+			pblock := lowest.pblock.(*FileBlock)
+			pblock.IPtrs = append(
+				pblock.IPtrs[:lowest.childIndex:lowest.childIndex],
+				pblock.IPtrs[lowest.childIndex+1:]...)
+			parentPtr := fd.rootBlockPointer()
+			if lowestIndex > 0 {
+				parentPtr = parentBlocks[lowestIndex-1].childBlockPtr()
+			}
+			if err = fd.tree.cacher(parentPtr, pblock); err != nil {
+				return newDe, nil, nil, unrefs, newlyDirtiedChildBytes, err
+			}
+			dirtyMap[parentPtr] = true
+		} else {
+			newlyDirtiedChildBytes += int64(len(block.Contents))
+			if wasDirty {
+				newlyDirtiedChildBytes -= int64(oldLen)
+			}
+
+			// Keep the old block ID while it's dirty.
+			if err = fd.tree.cacher(ptr, block); err != nil {
+				return newDe, nil, nil, unrefs, newlyDirtiedChildBytes, err
+			}
+			dirtyMap[ptr] = true
+		}
+
+		off = holeEnd
+	}
+
+	// Always make the top block dirty, so we will sync its indirect
+	// blocks, and so that any later write is deferred while this
+	// change is being sync'd.
+	if err = fd.tree.cacher(fd.rootBlockPointer(), topBlock); err != nil {
+		return newDe, nil, nil, unrefs, newlyDirtiedChildBytes, err
+	}
+	dirtyMap[fd.rootBlockPointer()] = true
+
+	newDe.EncodedSize = 0
+
+	dirtyPtrs = make([]BlockPointer, 0, len(dirtyMap))
+	for p := range dirtyMap {
+		dirtyPtrs = append(dirtyPtrs, p)
+	}
+
+	return newDe, dirtyPtrs, droppedPtrs, unrefs, newlyDirtiedChildBytes, nil
+}
+
+// nextDataOffset returns the first offset at or after `off` that is
+// backed by block data, along with the end of the data in that
+// block.  If there is no more data, it returns -1 for both.
+func (fd *fileData) nextDataOffset(ctx context.Context, topBlock *FileBlock,
+	off Int64Offset) (dataOff, dataEnd Int64Offset, err error) {
+	for {
+		_, _, block, nextBlockOff, blockOff, _, err :=
+			fd.getFileBlockAtOffset(ctx, topBlock, off, blockRead)
+		if err != nil {
+			return 0, 0, err
+		}
+		blockEnd := blockOff + Int64Offset(len(block.Contents))
+		if off < blockEnd {
+			return off, blockEnd, nil
+		}
+		if nextBlockOff < 0 {
+			return -1, -1, nil
+		}
+		off = nextBlockOff
+	}
+}
+
+// seekData returns the first offset at or after `off` that isn't in
+// a hole, or -1 if only holes follow `off`.  It doesn't take the
+// file size into account.
+func (fd *fileData) seekData(ctx context.Context, off Int64Offset) (
+	Int64Offset, error) {
+	topBlock, _, err := fd.getter(ctx, fd.tree.kmd, fd.rootBlockPointer(),
+		fd.tree.file, blockRead)
+	if err != nil {
+		return 0, err
+	}
+	dataOff, _, err := fd.nextDataOffset(ctx, topBlock, off)
+	return dataOff, err
+}
+
+// seekHole returns the first offset at or after `off` that is in a
+// hole.  Since the file data may end before the end of the file, the
+// caller must cap the result at the file size.
+func (fd *fileData) seekHole(ctx context.Context, off Int64Offset) (
+	Int64Offset, error) {
+	topBlock, _, err := fd.getter(ctx, fd.tree.kmd, fd.rootBlockPointer(),
+		fd.tree.file, blockRead)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		dataOff, dataEnd, err := fd.nextDataOffset(ctx, topBlock, off)
+		if err != nil {
+			return 0, err
+		}
+		if dataOff != off {
+			return off, nil
+		}
+		// The next block might start right where this one ends.
+		off = dataEnd
+	}
+}
+
 func (fd *fileData) getNextDirtyFileBlockAtOffset(ctx context.Context,
 	topBlock *FileBlock, off Int64Offset, rtype blockReqType,
 	dirtyBcache DirtyBlockCache) (
@@ -869,3 +869,96 @@ func TestFileDataWriteExtendExistingFileWithGap(t *testing.T) {
 		})
 	}
 }
+
+func TestFileDataPunchHole(t *testing.T) {
+	fd, cleanBcache, dirtyBcache, _ := setupFileDataTest(t, 2, 2)
+	data := make([]byte, 10)
+	for i := range data {
+		data[i] = byte(i + 1)
+	}
+	topBlock, _ := testFileDataLevelExistingBlocks(
+		t, fd, 2, 2, data, nil, cleanBcache)
+	de := DirEntry{
+		EntryInfo: EntryInfo{
+			Size: uint64(len(data)),
+		},
+	}
+
+	// This cuts the tail off the block at 2, empties the block at 4
+	// (since it's the first child of its parent), and removes the
+	// block at 6.
+	ctx := context.Background()
+	newDe, dirtyPtrs, droppedPtrs, _, newlyDirtiedChildBytes, err :=
+		fd.punchHole(ctx, 3, 8, topBlock, de)
+	require.NoError(t, err)
+	require.Len(t, droppedPtrs, 0)
+	require.Equal(t, de.Size, newDe.Size)
+	require.Equal(t, int64(1), newlyDirtiedChildBytes)
+	for _, ptr := range dirtyPtrs {
+		require.True(
+			t, dirtyBcache.IsDirty(fd.tree.file.Tlf, ptr, MasterBranch))
+	}
+
+	_, _, block, nextBlockOff, startOff, _, err := fd.getFileBlockAtOffset(
+		ctx, topBlock, 6, blockRead)
+	require.NoError(t, err)
+	require.Equal(t, Int64Offset(4), startOff)
+	require.Len(t, block.Contents, 0)
+	require.Equal(t, Int64Offset(8), nextBlockOff)
+
+	expectedData := append([]byte(nil), data...)
+	for i := 3; i < 8; i++ {
+		expectedData[i] = 0
+	}
+	gotData := make([]byte, len(data))
+	nRead, err := fd.read(ctx, gotData, 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), nRead)
+	require.Equal(t, expectedData, gotData)
+
+	type seekTest struct {
+		off      Int64Offset
+		hole     bool
+		expected Int64Offset
+	}
+	seekTests := []seekTest{
+		{0, false, 0},
+		{3, false, 8},
+		{5, false, 8},
+		{9, false, 9},
+		{0, true, 3},
+		{4, true, 4},
+		{8, true, 10},
+	}
+	for _, test := range seekTests {
+		var off Int64Offset
+		if test.hole {
+			off, err = fd.seekHole(ctx, test.off)
+		} else {
+			off, err = fd.seekData(ctx, test.off)
+		}
+		require.NoError(t, err)
+		require.Equal(t, test.expected, off,
+			"off=%d hole=%t", test.off, test.hole)
+	}
+
+	// Punching out the rest of the now-dirty block at 2 drops it
+	// completely, rather than zeroing it.
+	_, _, droppedPtrs, _, newlyDirtiedChildBytes, err =
+		fd.punchHole(ctx, 2, 4, topBlock, newDe)
+	require.NoError(t, err)
+	require.Len(t, droppedPtrs, 1)
+	require.Equal(t, int64(-1), newlyDirtiedChildBytes)
+	off, err := fd.seekData(ctx, 0)
+	require.NoError(t, err)
+	require.Equal(t, Int64Offset(0), off)
+	off, err = fd.seekData(ctx, 2)
+	require.NoError(t, err)
+	require.Equal(t, Int64Offset(8), off)
+
+	expectedData[2] = 0
+	nRead, err = fd.read(ctx, gotData, 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), nRead)
+	require.Equal(t, expectedData, gotData)
+}
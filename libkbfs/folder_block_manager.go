@@ -36,6 +36,9 @@ const (
 	numPointersPerGCThresholdDefault = 100
 	// The most revisions to consider for each QR run.
 	numMaxRevisionsPerQR = 100
+	// The most revisions to walk back through when summing up the
+	// unreclaimed bytes of a TLF.
+	numMaxRevisionsPerUnreclaimedDefault = 1000
 
 	// The delay to wait for before trying a failed block deletion
 	// again. Used by enqueueBlocksToDeleteAfterShortDelay().
@@ -73,7 +76,8 @@ type folderBlockManager struct {
 	shutdownChan    chan struct{}
 	id              tlf.ID
 
-	numPointersPerGCThreshold int
+	numPointersPerGCThreshold     int
+	numMaxRevisionsPerUnreclaimed int
 
 	// A queue of MD updates for this folder that need to have their
 	// unref's blocks archived
@@ -117,6 +121,8 @@ type folderBlockManager struct {
 	lastQROldEnoughRev  kbfsmd.Revision
 	wasLastQRComplete   bool
 	lastReclamationTime time.Time
+	lastQRNumBlocks     int
+	lastQRErr           error
 }
 
 func newFolderBlockManager(
@@ -130,7 +136,8 @@ func newFolderBlockManager(
 		log:             log,
 		shutdownChan:    make(chan struct{}),
 		id:              fb.Tlf,
-		numPointersPerGCThreshold: numPointersPerGCThresholdDefault,
+		numPointersPerGCThreshold:     numPointersPerGCThresholdDefault,
+		numMaxRevisionsPerUnreclaimed: numMaxRevisionsPerUnreclaimedDefault,
 		archiveChan:               make(chan ReadOnlyRootMetadata, 500),
 		archivePauseChan:          make(chan (<-chan struct{})),
 		blocksToDeleteChan:        make(chan blocksToDelete, 25),
@@ -736,10 +743,16 @@ func (fbm *folderBlockManager) deleteBlocksInBackground() {
 	}
 }
 
+// qrPolicy returns the quota reclamation policy currently in effect
+// for this folder.
+func (fbm *folderBlockManager) qrPolicy() quotaReclamationPolicy {
+	return effectiveQuotaReclamationPolicy(fbm.config, fbm.id)
+}
+
 func (fbm *folderBlockManager) isOldEnough(rmd ImmutableRootMetadata) bool {
 	// Trust the server's timestamp on this MD.
 	mtime := rmd.localTimestamp
-	unrefAge := fbm.config.Mode().QuotaReclamationMinUnrefAge()
+	unrefAge := fbm.qrPolicy().MinUnrefAge
 	return mtime.Add(unrefAge).Before(fbm.config.Clock().Now())
 }
 
@@ -782,8 +795,7 @@ func (fbm *folderBlockManager) getMostRecentOldEnoughAndGCRevisions(
 			if mostRecentOldEnoughRev == kbfsmd.RevisionUninitialized &&
 				fbm.isOldEnough(rmd) {
 				fbm.log.CDebugf(ctx, "Revision %d is older than the unref "+
-					"age %s", rmd.Revision(),
-					fbm.config.Mode().QuotaReclamationMinUnrefAge())
+					"age %s", rmd.Revision(), fbm.qrPolicy().MinUnrefAge)
 				mostRecentOldEnoughRev = rmd.Revision()
 			}
 
@@ -955,6 +967,83 @@ outer:
 	return ptrs, latestRev, complete, nil
 }
 
+// getUnreclaimedBytes returns the total size of the blocks that were
+// unreferenced after the last gc op, up to and including `head`.
+// These blocks still count against the quota until they are
+// reclaimed.  It also returns the latest revision scrubbed by the
+// last gc op.  At most `fbm.numMaxRevisionsPerUnreclaimed` revisions
+// are examined; if the last gc op is further back than that,
+// `complete` is false and `bytes` only covers the revisions examined.
+func (fbm *folderBlockManager) getUnreclaimedBytes(
+	ctx context.Context, head ReadOnlyRootMetadata) (
+	bytes uint64, lastGCRev kbfsmd.Revision, complete bool, err error) {
+	lastGCRev = kbfsmd.RevisionUninitialized
+	if head.data.LastGCRevision >= kbfsmd.RevisionInitial {
+		lastGCRev = head.data.LastGCRevision
+	}
+
+	// Walk backward from the head, until we reach the last
+	// revision covered by the previous gc op.
+	currHead := head.Revision()
+	numExamined := 0
+	complete = true
+outer:
+	for {
+		startRev := currHead - maxMDsAtATime + 1 // (kbfsmd.Revision is signed)
+		if startRev < kbfsmd.RevisionInitial {
+			startRev = kbfsmd.RevisionInitial
+		}
+
+		rmds, err := getMDRange(ctx, fbm.config, fbm.id, kbfsmd.NullBranchID,
+			startRev, currHead, kbfsmd.Merged, nil)
+		if err != nil {
+			return 0, kbfsmd.RevisionUninitialized, false, err
+		}
+
+		numNew := len(rmds)
+		for i := len(rmds) - 1; i >= 0; i-- {
+			rmd := rmds[i]
+			if lastGCRev != kbfsmd.RevisionUninitialized &&
+				rmd.Revision() <= lastGCRev {
+				break outer
+			}
+			if numExamined >= fbm.numMaxRevisionsPerUnreclaimed {
+				complete = false
+				break outer
+			}
+			numExamined++
+			bytes += rmd.UnrefBytes()
+
+			if lastGCRev != kbfsmd.RevisionUninitialized {
+				continue
+			}
+			if rmd.data.LastGCRevision >= kbfsmd.RevisionInitial {
+				lastGCRev = rmd.data.LastGCRevision
+				continue
+			}
+			for j := len(rmd.data.Changes.Ops) - 1; j >= 0; j-- {
+				if GCOp, ok := rmd.data.Changes.Ops[j].(*GCOp); ok {
+					lastGCRev = GCOp.LatestRev
+					break
+				}
+			}
+		}
+
+		if numNew > 0 {
+			currHead = rmds[0].Revision() - 1
+		}
+
+		if numNew < maxMDsAtATime || currHead < kbfsmd.RevisionInitial {
+			break
+		}
+	}
+
+	fbm.log.CDebugf(ctx, "Found %d unreclaimed bytes since the last gc "+
+		"revision %d (complete=%t, examined %d revisions)",
+		bytes, lastGCRev, complete, numExamined)
+	return bytes, lastGCRev, complete, nil
+}
+
 func (fbm *folderBlockManager) finalizeReclamation(ctx context.Context,
 	ptrs []BlockPointer, zeroRefCounts []kbfsblock.ID,
 	latestRev kbfsmd.Revision) error {
@@ -1001,7 +1090,7 @@ func (fbm *folderBlockManager) isQRNecessary(
 	// written by this device.  We want to avoid fighting with other
 	// active writers whenever possible.
 	if !selfWroteHead {
-		minHeadAge := fbm.config.Mode().QuotaReclamationMinHeadAge()
+		minHeadAge := fbm.qrPolicy().MinHeadAge
 		if minHeadAge <= 0 {
 			return false
 		}
@@ -1037,7 +1126,7 @@ func (fbm *folderBlockManager) doReclamation(timer *time.Timer) (err error) {
 	ctx, cancel := context.WithCancel(fbm.ctxWithFBMID(context.Background()))
 	fbm.setReclamationCancel(cancel)
 	defer fbm.cancelReclamation()
-	nextPeriod := fbm.config.Mode().QuotaReclamationPeriod()
+	nextPeriod := fbm.qrPolicy().Period
 	defer timer.Reset(nextPeriod)
 	defer fbm.reclamationGroup.Done()
 
@@ -1083,15 +1172,18 @@ func (fbm *folderBlockManager) doReclamation(timer *time.Timer) (err error) {
 	}
 	var mostRecentOldEnoughRev kbfsmd.Revision
 	var complete bool
+	var numBlocks int
 	var reclamationTime time.Time
 	defer func() {
 		fbm.lastQRLock.Lock()
 		defer fbm.lastQRLock.Unlock()
+		fbm.lastQRErr = err
 		// Remember the QR we just performed.
 		if err == nil && head != (ImmutableRootMetadata{}) {
 			fbm.lastQRHeadRev = head.Revision()
 			fbm.lastQROldEnoughRev = mostRecentOldEnoughRev
 			fbm.wasLastQRComplete = complete
+			fbm.lastQRNumBlocks = numBlocks
 		}
 		if !reclamationTime.IsZero() {
 			fbm.lastReclamationTime = reclamationTime
@@ -1158,6 +1250,7 @@ func (fbm *folderBlockManager) doReclamation(timer *time.Timer) (err error) {
 	if err != nil {
 		return err
 	}
+	numBlocks = len(ptrs)
 	if len(ptrs) == 0 && !shortened {
 		complete = true
 
@@ -1186,9 +1279,9 @@ func isPermanentQRError(err error) bool {
 
 func (fbm *folderBlockManager) reclaimQuotaInBackground() {
 	autoQR := true
-	timer := time.NewTimer(fbm.config.Mode().QuotaReclamationPeriod())
+	timer := time.NewTimer(fbm.qrPolicy().Period)
 
-	if fbm.config.Mode().QuotaReclamationPeriod().Seconds() != 0 {
+	if fbm.qrPolicy().Period.Seconds() != 0 {
 		// Run QR once immediately at the start of the period.
 		fbm.reclamationGroup.Add(1)
 		err := fbm.doReclamation(timer)
@@ -1202,8 +1295,7 @@ func (fbm *folderBlockManager) reclaimQuotaInBackground() {
 	timerChan := timer.C
 	for {
 		// Don't let the timer fire if auto-reclamation is turned off.
-		if !autoQR ||
-			fbm.config.Mode().QuotaReclamationPeriod().Seconds() == 0 {
+		if !autoQR || fbm.qrPolicy().Period.Seconds() == 0 {
 			timer.Stop()
 			// Use a channel that will never fire instead.
 			timerChan = make(chan time.Time)
@@ -1254,4 +1346,112 @@ func (fbm *folderBlockManager) clearLastQRData() {
 	fbm.lastQROldEnoughRev = kbfsmd.RevisionUninitialized
 	fbm.wasLastQRComplete = false
 	fbm.lastReclamationTime = time.Time{}
+	fbm.lastQRNumBlocks = 0
+	fbm.lastQRErr = nil
+}
+
+// getQRStatus returns the quota reclamation policy in effect for
+// this folder, along with the results of the last reclamation.
+func (fbm *folderBlockManager) getQRStatus() QuotaReclamationStatus {
+	policy := fbm.config.GetQuotaReclamationTlfPolicy(fbm.id)
+	effective := policy.withDefaults(fbm.config.Mode())
+
+	fbm.lastQRLock.Lock()
+	defer fbm.lastQRLock.Unlock()
+	status := QuotaReclamationStatus{
+		IsCustomPolicy:          policy != QuotaReclamationTlfPolicy{},
+		MinUnrefAge:             effective.MinUnrefAge.String(),
+		MinHeadAge:              effective.MinHeadAge.String(),
+		Period:                  effective.Period.String(),
+		LastQRTime:              fbm.lastReclamationTime,
+		LastQRHeadRevision:      fbm.lastQRHeadRev,
+		LastQROldEnoughRevision: fbm.lastQROldEnoughRev,
+		LastQRComplete:          fbm.wasLastQRComplete,
+		LastQRNumBlocks:         fbm.lastQRNumBlocks,
+	}
+	if fbm.lastQRErr != nil {
+		status.LastQRError = fbm.lastQRErr.Error()
+	}
+	return status
+}
+
+// getUnrefBytesInRange returns the total size of the blocks
+// unreferenced after earliestRev, up to and including latestRev.
+func (fbm *folderBlockManager) getUnrefBytesInRange(
+	ctx context.Context, latestRev, earliestRev kbfsmd.Revision) (
+	bytes uint64, err error) {
+	for start := earliestRev + 1; start <= latestRev; start += maxMDsAtATime {
+		end := start + maxMDsAtATime - 1
+		if end > latestRev {
+			end = latestRev
+		}
+		rmds, err := getMDRange(ctx, fbm.config, fbm.id, kbfsmd.NullBranchID,
+			start, end, kbfsmd.Merged, nil)
+		if err != nil {
+			return 0, err
+		}
+		for _, rmd := range rmds {
+			bytes += rmd.UnrefBytes()
+		}
+	}
+	return bytes, nil
+}
+
+// dryRunReclamation figures out what the next quota reclamation would
+// delete, using the current policy, without deleting anything or
+// taking the truncate lock.
+func (fbm *folderBlockManager) dryRunReclamation(ctx context.Context) (
+	dryRun QuotaReclamationDryRun, err error) {
+	dryRun = QuotaReclamationDryRun{
+		Status:         fbm.getQRStatus(),
+		HeadRevision:   kbfsmd.RevisionUninitialized,
+		LastGCRevision: kbfsmd.RevisionUninitialized,
+		LatestRevision: kbfsmd.RevisionUninitialized,
+		Complete:       true,
+	}
+
+	head, err := fbm.helper.getMostRecentFullyMergedMD(ctx)
+	if err != nil {
+		return QuotaReclamationDryRun{}, err
+	}
+	if head == (ImmutableRootMetadata{}) {
+		return dryRun, nil
+	}
+	err = isReadableOrError(ctx, fbm.config.KBPKI(), head.ReadOnly())
+	if err != nil {
+		return QuotaReclamationDryRun{}, err
+	}
+	dryRun.HeadRevision = head.Revision()
+
+	mostRecentOldEnoughRev, lastGCRev, err :=
+		fbm.getMostRecentOldEnoughAndGCRevisions(ctx, head.ReadOnly())
+	if err != nil {
+		return QuotaReclamationDryRun{}, err
+	}
+	dryRun.LastGCRevision = lastGCRev
+	if mostRecentOldEnoughRev == kbfsmd.RevisionUninitialized ||
+		mostRecentOldEnoughRev <= lastGCRev {
+		return dryRun, nil
+	}
+
+	// Mirror the limits of a real reclamation.
+	if mostRecentOldEnoughRev-lastGCRev > numMaxRevisionsPerQR {
+		mostRecentOldEnoughRev = lastGCRev + numMaxRevisionsPerQR
+		dryRun.Complete = false
+	}
+
+	ptrs, latestRev, complete, err :=
+		fbm.getUnreferencedBlocks(ctx, mostRecentOldEnoughRev, lastGCRev)
+	if err != nil {
+		return QuotaReclamationDryRun{}, err
+	}
+	dryRun.LatestRevision = latestRev
+	dryRun.NumBlocks = len(ptrs)
+	dryRun.Complete = dryRun.Complete && complete
+
+	dryRun.Bytes, err = fbm.getUnrefBytesInRange(ctx, latestRev, lastGCRev)
+	if err != nil {
+		return QuotaReclamationDryRun{}, err
+	}
+	return dryRun, nil
 }
@@ -12,7 +12,9 @@ import (
 
 	"github.com/keybase/client/go/libkb"
 	"github.com/keybase/kbfs/kbfsblock"
+	"github.com/keybase/kbfs/kbfsmd"
 	"github.com/keybase/kbfs/tlf"
+	"github.com/stretchr/testify/require"
 	"golang.org/x/net/context"
 )
 
@@ -133,6 +135,113 @@ func TestQuotaReclamationSimple(t *testing.T) {
 	testQuotaReclamation(t, ctx, config, userName)
 }
 
+// Test that a per-TLF policy overrides the global unref age, and that
+// a dry run reports what a real reclamation then deletes.
+func TestQuotaReclamationTlfPolicyAndDryRun(t *testing.T) {
+	var userName libkb.NormalizedUsername = "test_user"
+	config, _, ctx, cancel := kbfsOpsInitNoMocks(t, userName)
+	defer kbfsTestShutdownNoMocks(t, config, ctx, cancel)
+	clock, now := newTestClockAndTimeNow()
+	config.SetClock(clock)
+
+	rootNode := GetRootNodeOrBust(
+		ctx, t, config, userName.String(), tlf.Private)
+	fb := rootNode.GetFolderBranch()
+	kbfsOps := config.KBFSOps()
+	_, _, err := kbfsOps.CreateDir(ctx, rootNode, "a")
+	require.NoError(t, err)
+	err = kbfsOps.SyncAll(ctx, fb)
+	require.NoError(t, err)
+	err = kbfsOps.RemoveDir(ctx, rootNode, "a")
+	require.NoError(t, err)
+	err = kbfsOps.SyncAll(ctx, fb)
+	require.NoError(t, err)
+
+	t.Log("Keep four times as much history as the default.")
+	defaultAge := config.Mode().QuotaReclamationMinUnrefAge()
+	minUnrefAge := 4 * defaultAge
+	err = config.SetQuotaReclamationTlfPolicy(
+		fb.Tlf, QuotaReclamationTlfPolicy{MinUnrefAge: &minUnrefAge})
+	require.NoError(t, err)
+	status, _, err := kbfsOps.FolderStatus(ctx, fb)
+	require.NoError(t, err)
+	require.NotNil(t, status.QuotaReclamation)
+	require.True(t, status.QuotaReclamation.IsCustomPolicy)
+	require.Equal(t, (4 * defaultAge).String(),
+		status.QuotaReclamation.MinUnrefAge)
+
+	t.Log("An update that's old enough by default isn't old enough " +
+		"for the policy.")
+	clock.Set(now.Add(2 * defaultAge))
+	_, _, err = kbfsOps.CreateDir(ctx, rootNode, "b")
+	require.NoError(t, err)
+	err = kbfsOps.SyncAll(ctx, fb)
+	require.NoError(t, err)
+	dryRun, err := kbfsOps.GetQuotaReclamationDryRun(ctx, fb)
+	require.NoError(t, err)
+	require.Equal(t, kbfsmd.RevisionUninitialized, dryRun.LatestRevision)
+	require.Equal(t, 0, dryRun.NumBlocks)
+
+	bserverLocal, ok := config.BlockServer().(blockServerLocal)
+	require.True(t, ok)
+	preQR1Blocks, err := bserverLocal.getAllRefsForTest(ctx, fb.Tlf)
+	require.NoError(t, err)
+	ops := kbfsOps.(*KBFSOpsStandard).getOpsByNode(ctx, rootNode)
+	ops.fbm.forceQuotaReclamation()
+	err = ops.fbm.waitForQuotaReclamations(ctx)
+	require.NoError(t, err)
+	postQR1Blocks, err := bserverLocal.getAllRefsForTest(ctx, fb.Tlf)
+	require.NoError(t, err)
+	require.Equal(t, preQR1Blocks, postQR1Blocks)
+
+	t.Log("Once the policy's age has passed, the dry run reports the " +
+		"blocks without deleting them.")
+	clock.Set(now.Add(5 * defaultAge))
+	_, _, err = kbfsOps.CreateDir(ctx, rootNode, "c")
+	require.NoError(t, err)
+	err = kbfsOps.SyncAll(ctx, fb)
+	require.NoError(t, err)
+	preQR2Blocks, err := bserverLocal.getAllRefsForTest(ctx, fb.Tlf)
+	require.NoError(t, err)
+	dryRun, err = kbfsOps.GetQuotaReclamationDryRun(ctx, fb)
+	require.NoError(t, err)
+	require.True(t, dryRun.LatestRevision > kbfsmd.RevisionInitial)
+	require.NotZero(t, dryRun.NumBlocks)
+	require.NotZero(t, dryRun.Bytes)
+	require.True(t, dryRun.Complete)
+	postDryRunBlocks, err := bserverLocal.getAllRefsForTest(ctx, fb.Tlf)
+	require.NoError(t, err)
+	require.Equal(t, preQR2Blocks, postDryRunBlocks)
+
+	t.Log("A real reclamation deletes what the dry run reported.")
+	ops.fbm.forceQuotaReclamation()
+	err = ops.fbm.waitForQuotaReclamations(ctx)
+	require.NoError(t, err)
+	postQR2Blocks, err := bserverLocal.getAllRefsForTest(ctx, fb.Tlf)
+	require.NoError(t, err)
+	require.True(t,
+		totalBlockRefs(postQR2Blocks) < totalBlockRefs(preQR2Blocks))
+	status, _, err = kbfsOps.FolderStatus(ctx, fb)
+	require.NoError(t, err)
+	require.Equal(t, dryRun.NumBlocks,
+		status.QuotaReclamation.LastQRNumBlocks)
+	require.True(t, status.QuotaReclamation.LastQRComplete)
+	require.Equal(t, "", status.QuotaReclamation.LastQRError)
+
+	t.Log("A zero period overrides the default instead of falling " +
+		"back to it.")
+	var zero time.Duration
+	err = config.SetQuotaReclamationTlfPolicy(
+		fb.Tlf, QuotaReclamationTlfPolicy{Period: &zero})
+	require.NoError(t, err)
+	status, _, err = kbfsOps.FolderStatus(ctx, fb)
+	require.NoError(t, err)
+	require.True(t, status.QuotaReclamation.IsCustomPolicy)
+	require.Equal(t, zero.String(), status.QuotaReclamation.Period)
+	require.Equal(t, defaultAge.String(),
+		status.QuotaReclamation.MinUnrefAge)
+}
+
 // Just like the simple case, except tests that it unembeds large sets
 // of pointers correctly.
 func TestQuotaReclamationUnembedded(t *testing.T) {
@@ -1328,6 +1328,18 @@ func (fbo *folderBlockOps) GetChildren(
 	return dd.getChildren(ctx)
 }
 
+// GetChildrenPaged returns a page of the (possibly dirty) children
+// of the given directory, sorted by name, that come after the name
+// `after`.
+func (fbo *folderBlockOps) GetChildrenPaged(
+	ctx context.Context, lState *lockState, kmd KeyMetadata,
+	dir path, after string, maxEntries int) ([]DirChild, error) {
+	fbo.blockLock.RLock(lState)
+	defer fbo.blockLock.RUnlock(lState)
+	dd := fbo.newDirData(lState, dir, keybase1.UserOrTeamID(""), kmd)
+	return dd.getChildrenPaged(ctx, after, maxEntries)
+}
+
 // GetEntries returns a map of DirEntries for the (possibly dirty)
 // children entries of the given directory.
 func (fbo *folderBlockOps) GetEntries(
@@ -2232,6 +2244,205 @@ func (fbo *folderBlockOps) Truncate(
 	return nil
 }
 
+// Returns the set of blocks dirtied while punching this hole that
+// might need to be cleaned up if the change is deferred.
+func (fbo *folderBlockOps) punchHoleLocked(
+	ctx context.Context, lState *lockState, kmd KeyMetadataWithRootDirEntry,
+	file path, off, length uint64) (
+	*WriteRange, []BlockPointer, int64, error) {
+	if jServer, err := GetJournalServer(fbo.config); err == nil {
+		jServer.dirtyOpStart(fbo.id())
+		defer jServer.dirtyOpEnd(fbo.id())
+	}
+
+	fblock, err := fbo.writeGetFileLocked(ctx, lState, kmd, file)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	chargedTo, err := fbo.getChargedToLocked(ctx, lState, kmd)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	fd := fbo.newFileData(lState, file, chargedTo, kmd)
+
+	de, err := fbo.getEntryLocked(ctx, lState, kmd, file, true)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if off >= de.Size || length == 0 {
+		// Nothing to deallocate.
+		return nil, nil, 0, nil
+	}
+	end := de.Size
+	if length < de.Size-off {
+		end = off + length
+	}
+
+	si, err := fbo.getOrCreateSyncInfoLocked(lState, de)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	newDe, dirtyPtrs, droppedPtrs, unrefs, newlyDirtiedChildBytes, err :=
+		fd.punchHole(ctx, Int64Offset(off), Int64Offset(end), fblock, de)
+	// Record the unrefs before checking the error so we remember the
+	// state of newly dirtied blocks.
+	si.unrefs = append(si.unrefs, unrefs...)
+	if err != nil {
+		return nil, nil, newlyDirtiedChildBytes, err
+	}
+
+	// Update dirtied bytes and unrefs regardless of error.
+	df := fbo.getOrCreateDirtyFileLocked(lState, file)
+	df.updateNotYetSyncingBytes(newlyDirtiedChildBytes)
+
+	if fbo.doDeferWrite {
+		// The dropped blocks might still be part of the ongoing
+		// sync, so only delete them once it's done.
+		dirtyPtrs = append(dirtyPtrs, droppedPtrs...)
+	} else {
+		dirtyBcache := fbo.config.DirtyBlockCache()
+		for _, ptr := range droppedPtrs {
+			fbo.log.CDebugf(ctx, "Deleting dropped dirty ptr %v", ptr)
+			df.setBlockNotDirty(ptr)
+			err = dirtyBcache.Delete(fbo.id(), ptr, fbo.branch())
+			if err != nil {
+				return nil, nil, newlyDirtiedChildBytes, err
+			}
+		}
+	}
+
+	latestWrite := si.op.addWrite(off, end-off)
+	now := fbo.nowUnixNano()
+	newDe.Mtime = now
+	newDe.Ctime = now
+	err = fbo.updateEntryLocked(ctx, lState, kmd, file, newDe, true)
+	if err != nil {
+		return nil, nil, newlyDirtiedChildBytes, err
+	}
+
+	return &latestWrite, dirtyPtrs, newlyDirtiedChildBytes, nil
+}
+
+// PunchHole deallocates the given range of the given file, without
+// changing its size.  May block if there is too much unflushed data;
+// in that case, it will be unblocked by a future sync.
+func (fbo *folderBlockOps) PunchHole(
+	ctx context.Context, lState *lockState, kmd KeyMetadataWithRootDirEntry,
+	file Node, off, length uint64) error {
+	// At most the blocks at either edge of the range will be
+	// dirtied, but we don't know their sizes yet, so assume the
+	// whole range will be dirty like in `Truncate`.
+	c, err := fbo.config.DirtyBlockCache().RequestPermissionToDirty(ctx,
+		fbo.id(), int64(length))
+	if err != nil {
+		return err
+	}
+	defer fbo.config.DirtyBlockCache().UpdateUnsyncedBytes(fbo.id(),
+		-int64(length), false)
+	err = fbo.maybeWaitOnDeferredWrites(ctx, lState, file, c)
+	if err != nil {
+		return err
+	}
+
+	fbo.blockLock.Lock(lState)
+	defer fbo.blockLock.Unlock(lState)
+
+	filePath, err := fbo.pathFromNodeForBlockWriteLocked(lState, file)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		fbo.doDeferWrite = false
+	}()
+
+	latestWrite, dirtyPtrs, newlyDirtiedChildBytes, err := fbo.punchHoleLocked(
+		ctx, lState, kmd, filePath, off, length)
+	if err != nil {
+		return err
+	}
+
+	if latestWrite != nil {
+		fbo.observers.localChange(ctx, file, *latestWrite)
+	}
+
+	if fbo.doDeferWrite {
+		// There's an ongoing sync, and this change altered dirty
+		// blocks that are in the process of syncing.  So, we have to
+		// redo it once the sync is complete, using the new file
+		// path.
+		fbo.log.CDebugf(ctx, "Deferring a hole punch to file %v",
+			filePath.tailPointer())
+		ds := fbo.deferred[filePath.tailRef()]
+		ds.dirtyDeletes = append(ds.dirtyDeletes, dirtyPtrs...)
+		ds.writes = append(ds.writes,
+			func(ctx context.Context, lState *lockState,
+				kmd KeyMetadataWithRootDirEntry, f path) error {
+				// We are about to re-dirty these bytes, so mark that
+				// they will no longer be synced via the old file.
+				df := fbo.getOrCreateDirtyFileLocked(lState, filePath)
+				df.updateNotYetSyncingBytes(-newlyDirtiedChildBytes)
+
+				// Punch the hole again.  We know this won't be
+				// deferred, so no need to check the new ptrs.
+				_, _, _, err := fbo.punchHoleLocked(
+					ctx, lState, kmd, f, off, length)
+				return err
+			})
+		ds.waitBytes += newlyDirtiedChildBytes
+		fbo.deferred[filePath.tailRef()] = ds
+	}
+
+	return nil
+}
+
+// SeekDataOrHole returns the first offset at or after `off` in the
+// given file that is backed by data (if `hole` is false) or that is
+// in a hole (if `hole` is true).  The end of the file counts as a
+// hole.  It returns a NoDataAfterOffsetError if `off` is at or past
+// the end of the file, or if `hole` is false and only holes follow
+// `off`.
+func (fbo *folderBlockOps) SeekDataOrHole(
+	ctx context.Context, lState *lockState, kmd KeyMetadataWithRootDirEntry,
+	file Node, off uint64, hole bool) (uint64, error) {
+	fbo.blockLock.RLock(lState)
+	defer fbo.blockLock.RUnlock(lState)
+
+	filePath := fbo.nodeCache.PathFromNode(file)
+	de, err := fbo.getEntryLocked(ctx, lState, kmd, filePath, true)
+	if err != nil {
+		return 0, err
+	}
+	if off >= de.Size {
+		return 0, NoDataAfterOffsetError{off}
+	}
+
+	var id keybase1.UserOrTeamID // Data reads don't depend on the id.
+	fd := fbo.newFileData(lState, filePath, id, kmd)
+	if hole {
+		holeOff, err := fd.seekHole(ctx, Int64Offset(off))
+		if err != nil {
+			return 0, err
+		}
+		if uint64(holeOff) > de.Size {
+			return de.Size, nil
+		}
+		return uint64(holeOff), nil
+	}
+
+	dataOff, err := fd.seekData(ctx, Int64Offset(off))
+	if err != nil {
+		return 0, err
+	}
+	if dataOff < 0 || uint64(dataOff) >= de.Size {
+		return 0, NoDataAfterOffsetError{off}
+	}
+	return uint64(dataOff), nil
+}
+
 // IsDirty returns whether the given file is dirty; if false is
 // returned, then the file doesn't need to be synced.
 func (fbo *folderBlockOps) IsDirty(lState *lockState, file path) bool {
@@ -7,6 +7,7 @@ package libkbfs
 import (
 	"fmt"
 	"os"
+	stdpath "path"
 	"reflect"
 	"sort"
 	"strings"
@@ -96,6 +97,9 @@ const (
 	// If there are more than this many new revisions, fast forward
 	// rather than downloading them all.
 	fastForwardRevThresh = 50
+	// The maximum number of recent revisions scanned for deleted
+	// entries that can be undeleted.
+	maxDeletedEntriesRevisions = 1000
 )
 
 type fboMutexLevel mutexLevel
@@ -363,6 +367,20 @@ type folderBranchOps struct {
 
 	convLock sync.Mutex
 	convID   chat1.ConversationID
+
+	partialSyncLock sync.Mutex
+	// The head MD and the sync paths used by the most recent partial
+	// sync, and a function to cancel that sync.
+	partialSyncMdID   kbfsmd.ID
+	partialSyncPaths  []string
+	cancelPartialSync context.CancelFunc
+	partialSyncs      kbfssync.RepeatedWaitGroup
+
+	deletedEntriesLock sync.Mutex
+	// The entries deleted in recent merged revisions, most recent
+	// first, as of head revision `deletedEntriesRev`.
+	deletedEntriesRev kbfsmd.Revision
+	deletedEntries    []DeletedEntry
 }
 
 var _ KBFSOps = (*folderBranchOps)(nil)
@@ -500,6 +518,15 @@ func (fbo *folderBranchOps) Shutdown(ctx context.Context) error {
 
 	close(fbo.shutdownChan)
 	fbo.merkleFetches.Wait(ctx)
+	func() {
+		fbo.partialSyncLock.Lock()
+		defer fbo.partialSyncLock.Unlock()
+		if fbo.cancelPartialSync != nil {
+			fbo.cancelPartialSync()
+			fbo.cancelPartialSync = nil
+		}
+	}()
+	fbo.partialSyncs.Wait(ctx)
 	fbo.cr.Shutdown()
 	fbo.fbm.shutdown()
 	fbo.rekeyFSM.Shutdown()
@@ -878,6 +905,7 @@ func (fbo *folderBranchOps) setHeadLocked(
 		fbo.headStatus = headTrusted
 	}
 	fbo.status.setRootMetadata(md)
+	fbo.kickOffPartialSyncIfNeeded(ctx, md)
 	if isFirstHead {
 		// Start registering for updates right away, using this MD
 		// as a starting point. Only standard FBOs get updates.
@@ -1869,9 +1897,165 @@ func (fbo *folderBranchOps) getRootNode(ctx context.Context) (
 		return nil, EntryInfo{}, nil, err
 	}
 
+	// The sync paths might have changed since the head was set.
+	fbo.kickOffPartialSyncIfNeeded(ctx, md)
+
 	return node, md.Data().Dir.EntryInfo, handle, nil
 }
 
+// partialSyncRoot is the root of a subtree that matches one of the
+// sync paths of a partially-synced TLF.
+type partialSyncRoot struct {
+	p         path
+	entryType EntryType
+}
+
+// kickOffPartialSyncIfNeeded starts syncing, in the background, the
+// subtrees of `md` that match the TLF's sync paths, unless a sync
+// for the same MD and paths has already been started.
+func (fbo *folderBranchOps) kickOffPartialSyncIfNeeded(
+	ctx context.Context, md ImmutableRootMetadata) {
+	if !md.IsReadable() || fbo.config.Mode().PrefetchWorkers() == 0 {
+		return
+	}
+	syncPaths := fbo.config.GetTlfSyncPaths(fbo.id())
+
+	fbo.partialSyncLock.Lock()
+	defer fbo.partialSyncLock.Unlock()
+	if md.mdID == fbo.partialSyncMdID &&
+		reflect.DeepEqual(syncPaths, fbo.partialSyncPaths) {
+		return
+	}
+	if fbo.cancelPartialSync != nil {
+		fbo.cancelPartialSync()
+		fbo.cancelPartialSync = nil
+	}
+	fbo.partialSyncMdID = md.mdID
+	fbo.partialSyncPaths = syncPaths
+	if len(syncPaths) == 0 {
+		fbo.status.setPartialSyncRoots(nil)
+		return
+	}
+
+	fbo.log.CDebugf(ctx, "Starting a partial sync of revision %d for "+
+		"paths %v", md.Revision(), syncPaths)
+	// Use a fresh context, since the sync outlives the caller.
+	syncCtx, cancel := context.WithCancel(
+		fbo.ctxWithFBOID(context.Background()))
+	fbo.cancelPartialSync = cancel
+	fbo.partialSyncs.Add(1)
+	go func() {
+		defer fbo.partialSyncs.Done()
+		defer cancel()
+		fbo.doPartialSync(syncCtx, md, syncPaths)
+	}()
+}
+
+// doPartialSync finds all the subtrees of `md` that match
+// `syncPaths`, and asks the prefetcher to sync each one of them into
+// the sync cache.
+func (fbo *folderBranchOps) doPartialSync(
+	ctx context.Context, md ImmutableRootMetadata, syncPaths []string) {
+	lState := makeFBOLockState()
+	rootPath := path{
+		FolderBranch: fbo.folderBranch,
+		path: []pathNode{{
+			md.data.Dir.BlockPointer,
+			string(md.GetTlfHandle().GetCanonicalName()),
+		}},
+	}
+
+	var roots []partialSyncRoot
+	seen := make(map[BlockPointer]bool)
+	for _, p := range syncPaths {
+		pathRoots, err := fbo.findPartialSyncRoots(
+			ctx, lState, md, rootPath, strings.Split(p, "/"))
+		if err != nil {
+			fbo.log.CDebugf(ctx, "Couldn't find the subtrees to sync "+
+				"for path %s: %+v", p, err)
+			continue
+		}
+		for _, r := range pathRoots {
+			if seen[r.p.tailPointer()] {
+				continue
+			}
+			seen[r.p.tailPointer()] = true
+			roots = append(roots, r)
+		}
+	}
+
+	fbo.partialSyncLock.Lock()
+	defer fbo.partialSyncLock.Unlock()
+	if ctx.Err() != nil {
+		// A newer sync has already replaced this one.
+		return
+	}
+	fbo.status.setPartialSyncRoots(roots)
+	for _, r := range roots {
+		var block Block = &FileBlock{}
+		if r.entryType == Dir {
+			block = &DirBlock{}
+		}
+		fbo.config.BlockOps().Prefetcher().ProcessBlockForSync(
+			ctx, r.p.tailPointer(), block, md)
+	}
+}
+
+// findPartialSyncRoots returns the subtrees under `dir` that match
+// the given path components, each of which may be a glob pattern.
+// It also moves the block of `dir` itself into the sync cache, so
+// that the path leading to the synced subtrees can be looked up
+// while offline.  (Indirect directory blocks along the path are only
+// cached in the working set.)
+func (fbo *folderBranchOps) findPartialSyncRoots(
+	ctx context.Context, lState *lockState, md ImmutableRootMetadata,
+	dir path, components []string) (roots []partialSyncRoot, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	entries, err := fbo.blocks.GetEntries(ctx, lState, md, dir)
+	if err != nil {
+		return nil, err
+	}
+	if dbc, ok := fbo.config.DiskBlockCache().(*diskBlockCacheWrapped); ok {
+		_, err := dbc.moveBlockToSyncCache(
+			ctx, fbo.id(), dir.tailPointer().ID)
+		if err != nil {
+			fbo.log.CDebugf(ctx, "Couldn't move the block for %s to the "+
+				"sync cache: %+v", dir, err)
+		}
+	}
+
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		// The pattern was validated when the sync paths were set.
+		if matched, _ := stdpath.Match(components[0], name); matched {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		de := entries[name]
+		childPath := dir.ChildPath(name, de.BlockPointer)
+		if len(components) == 1 {
+			if de.Type != Sym {
+				roots = append(roots, partialSyncRoot{childPath, de.Type})
+			}
+			continue
+		}
+		if de.Type != Dir {
+			continue
+		}
+		childRoots, err := fbo.findPartialSyncRoots(
+			ctx, lState, md, childPath, components[1:])
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, childRoots...)
+	}
+	return roots, nil
+}
+
 type makeNewBlock func() Block
 
 // pathFromNodeHelper() shouldn't be called except by the helper
@@ -1962,6 +2146,80 @@ func (fbo *folderBranchOps) GetDirChildren(ctx context.Context, dir Node) (
 	return retChildren, nil
 }
 
+func (fbo *folderBranchOps) getDirChildrenPaged(
+	ctx context.Context, dir Node, after string, maxEntries int) (
+	children []DirChild, err error) {
+	lState := makeFBOLockState()
+
+	dirPath, err := fbo.pathFromNodeForRead(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if fbo.nodeCache.IsUnlinked(dir) {
+		fbo.log.CDebugf(ctx, "Returning an empty children set for "+
+			"unlinked directory %v", dirPath.tailPointer())
+		return nil, nil
+	}
+
+	md, err := fbo.getMDForReadNeedIdentify(ctx, lState)
+	if err != nil {
+		return nil, err
+	}
+
+	return fbo.blocks.GetChildrenPaged(
+		ctx, lState, md.ReadOnly(), dirPath, after, maxEntries)
+}
+
+func (fbo *folderBranchOps) GetDirChildrenPaged(
+	ctx context.Context, dir Node, after string, maxEntries int) (
+	children []DirChild, err error) {
+	fbo.log.CDebugf(ctx, "GetDirChildrenPaged %s after=%q max=%d",
+		getNodeIDStr(dir), after, maxEntries)
+	defer func() {
+		fbo.deferLog.CDebugf(ctx, "GetDirChildrenPaged %s done, "+
+			"%d entries: %+v", getNodeIDStr(dir), len(children), err)
+	}()
+
+	err = fbo.checkNode(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var retChildren []DirChild
+	err = runUnlessCanceled(ctx, func() error {
+		retChildren, err = fbo.getDirChildrenPaged(
+			ctx, dir, after, maxEntries)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the first page can tell whether the whole directory
+	// looks empty.
+	if after == "" && dir.ShouldRetryOnDirRead(ctx) {
+		err2 := fbo.SyncFromServer(ctx, fbo.folderBranch, nil)
+		if err2 != nil {
+			fbo.log.CDebugf(ctx, "Error syncing before retry: %+v", err2)
+			return nil, nil
+		}
+
+		fbo.log.CDebugf(ctx,
+			"Retrying GetDirChildrenPaged of an empty directory")
+		err = runUnlessCanceled(ctx, func() error {
+			retChildren, err = fbo.getDirChildrenPaged(
+				ctx, dir, after, maxEntries)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return retChildren, nil
+}
+
 func (fbo *folderBranchOps) processMissedLookup(
 	ctx context.Context, dir Node, name string, missErr error) (
 	node Node, ei EntryInfo, err error) {
@@ -2148,6 +2406,16 @@ func (fbo *folderBranchOps) GetNodeMetadata(ctx context.Context, node Node) (
 	}
 	res.BlockInfo = de.BlockInfo
 
+	nodePath, err := fbo.pathFromNodeForRead(node)
+	if err != nil {
+		return res, err
+	}
+	names := make([]string, 0, len(nodePath.path))
+	for _, pn := range nodePath.path[1:] {
+		names = append(names, pn.Name)
+	}
+	res.PathFromRoot = strings.Join(names, "/")
+
 	id := de.TeamWriter.AsUserOrTeam()
 	if id.IsNil() {
 		id = de.Writer
@@ -3998,6 +4266,82 @@ func (fbo *folderBranchOps) Truncate(
 	})
 }
 
+func (fbo *folderBranchOps) PunchHole(
+	ctx context.Context, file Node, off, length uint64) (err error) {
+	fbo.log.CDebugf(ctx, "PunchHole %s %d %d", getNodeIDStr(file),
+		off, length)
+	defer func() {
+		fbo.deferLog.CDebugf(ctx, "PunchHole %s %d %d done: %+v",
+			getNodeIDStr(file), off, length, err)
+	}()
+
+	err = fbo.checkNodeForWrite(ctx, file)
+	if err != nil {
+		return err
+	}
+
+	return runUnlessCanceled(ctx, func() error {
+		lState := makeFBOLockState()
+
+		// Get the MD for reading.  We won't modify it; we'll track the
+		// unref changes on the side, and put them into the MD during the
+		// sync.
+		md, err := fbo.getMDForRead(ctx, lState, mdReadNeedIdentify)
+		if err != nil {
+			return err
+		}
+
+		err = fbo.blocks.PunchHole(
+			ctx, lState, md.ReadOnly(), file, off, length)
+		if err != nil {
+			return err
+		}
+
+		fbo.status.addDirtyNode(file)
+		fbo.signalWrite()
+		return nil
+	})
+}
+
+func (fbo *folderBranchOps) SeekDataOrHole(
+	ctx context.Context, file Node, off uint64, hole bool) (
+	newOff uint64, err error) {
+	fbo.log.CDebugf(ctx, "SeekDataOrHole %s %d (hole=%t)",
+		getNodeIDStr(file), off, hole)
+	defer func() {
+		fbo.deferLog.CDebugf(ctx, "SeekDataOrHole %s %d (hole=%t) "+
+			"(newOff=%d) done: %+v", getNodeIDStr(file), off, hole,
+			newOff, err)
+	}()
+
+	err = fbo.checkNode(file)
+	if err != nil {
+		return 0, err
+	}
+
+	// Don't let the goroutine below write directly to the return
+	// variable, since if the context is canceled the goroutine might
+	// outlast this function call.
+	var seekOff uint64
+	err = runUnlessCanceled(ctx, func() error {
+		lState := makeFBOLockState()
+
+		// verify we have permission to read
+		md, err := fbo.getMDForReadNeedIdentify(ctx, lState)
+		if err != nil {
+			return err
+		}
+
+		seekOff, err = fbo.blocks.SeekDataOrHole(
+			ctx, lState, md.ReadOnly(), file, off, hole)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return seekOff, nil
+}
+
 func (fbo *folderBranchOps) setExLocked(
 	ctx context.Context, lState *lockState, file Node, ex bool) (err error) {
 	fbo.mdWriterLock.AssertLocked(lState)
@@ -4711,7 +5055,110 @@ func (fbo *folderBranchOps) FolderStatus(
 			WrongOpsError{fbo.folderBranch, folderBranch}
 	}
 
-	return fbo.status.getStatus(ctx, &fbo.blocks)
+	fbs, updateChan, err = fbo.status.getStatus(ctx, &fbo.blocks)
+	if err != nil {
+		return FolderBranchStatus{}, nil, err
+	}
+	qrStatus := fbo.fbm.getQRStatus()
+	fbs.QuotaReclamation = &qrStatus
+	return fbs, updateChan, nil
+}
+
+// GetQuotaReclamationDryRun implements the KBFSOps interface for
+// folderBranchOps.
+func (fbo *folderBranchOps) GetQuotaReclamationDryRun(
+	ctx context.Context, folderBranch FolderBranch) (
+	dryRun QuotaReclamationDryRun, err error) {
+	fbo.log.CDebugf(ctx, "GetQuotaReclamationDryRun")
+	defer func() {
+		fbo.deferLog.CDebugf(ctx, "GetQuotaReclamationDryRun done: %+v", err)
+	}()
+
+	if folderBranch != fbo.folderBranch {
+		return QuotaReclamationDryRun{},
+			WrongOpsError{fbo.folderBranch, folderBranch}
+	}
+	return fbo.fbm.dryRunReclamation(ctx)
+}
+
+// checkCREnabled returns an error if conflict resolution never runs
+// for this folder.
+func (fbo *folderBranchOps) checkCREnabled() error {
+	if fbo.bType != standard || !fbo.config.Mode().ConflictResolutionEnabled() {
+		return errors.Errorf(
+			"Conflict resolution is disabled for %s", fbo.folderBranch)
+	}
+	return nil
+}
+
+// SetAutoConflictResolution implements the KBFSOps interface for
+// folderBranchOps.
+func (fbo *folderBranchOps) SetAutoConflictResolution(
+	ctx context.Context, folderBranch FolderBranch, enabled bool) (
+	err error) {
+	fbo.log.CDebugf(ctx, "SetAutoConflictResolution %t", enabled)
+	defer func() {
+		fbo.deferLog.CDebugf(ctx, "SetAutoConflictResolution done: %+v", err)
+	}()
+
+	if folderBranch != fbo.folderBranch {
+		return WrongOpsError{fbo.folderBranch, folderBranch}
+	}
+	err = fbo.checkCREnabled()
+	if err != nil {
+		return err
+	}
+
+	fbo.cr.setAutoResolution(enabled)
+	if !enabled {
+		return nil
+	}
+
+	// Start a resolution for anything that was held back.
+	lState := makeFBOLockState()
+	if fbo.isUnmerged(lState) {
+		fbo.cr.Resolve(ctx, fbo.getCurrMDRevision(lState),
+			kbfsmd.RevisionUninitialized)
+	}
+	return nil
+}
+
+// ResolveConflicts implements the KBFSOps interface for
+// folderBranchOps.
+func (fbo *folderBranchOps) ResolveConflicts(
+	ctx context.Context, folderBranch FolderBranch,
+	choices map[string]ConflictChoice) (err error) {
+	fbo.log.CDebugf(ctx, "ResolveConflicts %v", choices)
+	defer func() {
+		fbo.deferLog.CDebugf(ctx, "ResolveConflicts done: %+v", err)
+	}()
+
+	if folderBranch != fbo.folderBranch {
+		return WrongOpsError{fbo.folderBranch, folderBranch}
+	}
+	err = fbo.checkCREnabled()
+	if err != nil {
+		return err
+	}
+
+	lState := makeFBOLockState()
+	_, err = fbo.getMDForReadNeedIdentify(ctx, lState)
+	if err != nil {
+		return err
+	}
+	if !fbo.isUnmerged(lState) {
+		return NoUnmergedBranchError{fbo.id()}
+	}
+
+	err = fbo.cr.resolveWithChoices(
+		ctx, fbo.getCurrMDRevision(lState), choices)
+	if err != nil {
+		return err
+	}
+	if fbo.isUnmerged(lState) {
+		return UnmergedError{}
+	}
+	return nil
 }
 
 func (fbo *folderBranchOps) Status(
@@ -5215,8 +5662,12 @@ func (fbo *folderBranchOps) applyMDUpdatesLocked(ctx context.Context,
 		if rmd.IsWriterMetadataCopiedSet() {
 			continue
 		}
+		// Only merged revisions from the server carry change info;
+		// local, unmerged and CR notifications don't.
+		changeCtx := ctxWithChangeInfo(ctx, rmd.ReadOnly())
 		for _, op := range rmd.data.Changes.Ops {
-			err := fbo.notifyOneOpLocked(ctx, lState, op, rmd.ReadOnly(), true)
+			err := fbo.notifyOneOpLocked(
+				changeCtx, lState, op, rmd.ReadOnly(), true)
 			if err != nil {
 				return err
 			}
@@ -5922,7 +6373,9 @@ func (fbo *folderBranchOps) doFastForwardLocked(ctx context.Context,
 
 	// Invalidate all the affected nodes.
 	if len(changes) > 0 {
-		fbo.observers.batchChanges(ctx, changes, affectedNodeIDs)
+		fbo.observers.batchChanges(
+			ctxWithChangeInfo(ctx, currHead.ReadOnly()), changes,
+			affectedNodeIDs)
 	}
 
 	return nil
@@ -6881,6 +7334,930 @@ func (fbo *folderBranchOps) GetUpdateHistory(ctx context.Context,
 	return history, nil
 }
 
+// quotaUsageWriter returns the user (or team) that should be charged
+// for the blocks of the given entry.
+func quotaUsageWriter(de DirEntry) keybase1.UserOrTeamID {
+	if id := de.TeamWriter.AsUserOrTeam(); !id.IsNil() {
+		return id
+	}
+	return de.GetWriter()
+}
+
+// getDirQuotaUsage adds up the encoded sizes of all the blocks in the
+// subtree rooted at `dir`, whose entry is `de`, charging each file
+// and directory to its writer in `writers`.  It also returns the
+// usage of each subdirectory down to `maxDepth`.
+func (fbo *folderBranchOps) getDirQuotaUsage(
+	ctx context.Context, lState *lockState, kmd KeyMetadata, dir path,
+	de DirEntry, relPath string, depth, maxDepth int,
+	writers map[keybase1.UserOrTeamID]uint64) (
+	usage DirQuotaUsage, subdirs []DirQuotaUsage, err error) {
+	usage.Path = relPath
+	usage.Bytes = uint64(de.EncodedSize)
+	infos, err := fbo.blocks.GetIndirectDirBlockInfos(ctx, lState, kmd, dir)
+	if err != nil {
+		return DirQuotaUsage{}, nil, err
+	}
+	for _, info := range infos {
+		usage.Bytes += uint64(info.EncodedSize)
+	}
+	writers[quotaUsageWriter(de)] += usage.Bytes
+
+	children, err := fbo.blocks.GetEntries(ctx, lState, kmd, dir)
+	if err != nil {
+		return DirQuotaUsage{}, nil, err
+	}
+	for name, childDE := range children {
+		p := dir.ChildPath(name, childDE.BlockPointer)
+		switch childDE.Type {
+		case Sym:
+			// Symlinks are stored in their parent's block.
+			continue
+		case Dir:
+			childUsage, childSubdirs, err := fbo.getDirQuotaUsage(
+				ctx, lState, kmd, p, childDE, stdpath.Join(relPath, name),
+				depth+1, maxDepth, writers)
+			if err != nil {
+				return DirQuotaUsage{}, nil, err
+			}
+			usage.Bytes += childUsage.Bytes
+			usage.NumFiles += childUsage.NumFiles
+			usage.NumDirs += childUsage.NumDirs + 1
+			if depth < maxDepth {
+				subdirs = append(subdirs, childUsage)
+			}
+			subdirs = append(subdirs, childSubdirs...)
+		default:
+			bytes := uint64(childDE.EncodedSize)
+			infos, err := fbo.blocks.GetIndirectFileBlockInfos(
+				ctx, lState, kmd, p)
+			if err != nil {
+				return DirQuotaUsage{}, nil, err
+			}
+			for _, info := range infos {
+				bytes += uint64(info.EncodedSize)
+			}
+			writers[quotaUsageWriter(childDE)] += bytes
+			usage.Bytes += bytes
+			usage.NumFiles++
+		}
+	}
+	return usage, subdirs, nil
+}
+
+// GetQuotaUsageBreakdown implements the KBFSOps interface for
+// folderBranchOps.
+func (fbo *folderBranchOps) GetQuotaUsageBreakdown(
+	ctx context.Context, dir Node, maxDepth int) (
+	breakdown QuotaUsageBreakdown, err error) {
+	fbo.log.CDebugf(ctx, "GetQuotaUsageBreakdown %s %d",
+		getNodeIDStr(dir), maxDepth)
+	defer func() {
+		fbo.deferLog.CDebugf(ctx, "GetQuotaUsageBreakdown %s done: %+v",
+			getNodeIDStr(dir), err)
+	}()
+
+	err = fbo.checkNode(dir)
+	if err != nil {
+		return QuotaUsageBreakdown{}, err
+	}
+
+	lState := makeFBOLockState()
+	dirPath, err := fbo.pathFromNodeForRead(dir)
+	if err != nil {
+		return QuotaUsageBreakdown{}, err
+	}
+	md, err := fbo.getMDForReadNeedIdentify(ctx, lState)
+	if err != nil {
+		return QuotaUsageBreakdown{}, err
+	}
+	if md == (ImmutableRootMetadata{}) {
+		return QuotaUsageBreakdown{}, nil
+	}
+
+	breakdown.ID = md.TlfID().String()
+	breakdown.Name = md.GetTlfHandle().GetCanonicalPath()
+	breakdown.Revision = md.Revision()
+	breakdown.LiveBytes = md.DiskUsage()
+	breakdown.MDBytes = md.MDDiskUsage()
+	var unreclaimedComplete bool
+	breakdown.UnreclaimedBytes, breakdown.LastGCRevision,
+		unreclaimedComplete, err = fbo.fbm.getUnreclaimedBytes(
+		ctx, md.ReadOnly())
+	if err != nil {
+		return QuotaUsageBreakdown{}, err
+	}
+	breakdown.UnreclaimedBytesPartial = !unreclaimedComplete
+
+	de, err := fbo.blocks.GetEntryEvenIfDeleted(
+		ctx, lState, md.ReadOnly(), dirPath)
+	if err != nil {
+		return QuotaUsageBreakdown{}, err
+	}
+	if de.Type != Dir {
+		return QuotaUsageBreakdown{}, NotDirError{dirPath}
+	}
+
+	writers := make(map[keybase1.UserOrTeamID]uint64)
+	usage, subdirs, err := fbo.getDirQuotaUsage(
+		ctx, lState, md.ReadOnly(), dirPath, de, "", 0, maxDepth, writers)
+	if err != nil {
+		return QuotaUsageBreakdown{}, err
+	}
+	sort.Slice(subdirs, func(i, j int) bool {
+		if subdirs[i].Bytes != subdirs[j].Bytes {
+			return subdirs[i].Bytes > subdirs[j].Bytes
+		}
+		return subdirs[i].Path < subdirs[j].Path
+	})
+	breakdown.Dirs = append([]DirQuotaUsage{usage}, subdirs...)
+
+	breakdown.Writers = make(map[string]uint64, len(writers))
+	for id, bytes := range writers {
+		name, err := fbo.config.KBPKI().GetNormalizedUsername(ctx, id)
+		if err != nil {
+			fbo.log.CDebugf(ctx, "Couldn't resolve writer %s: %+v", id, err)
+			breakdown.Writers[id.String()] += bytes
+			continue
+		}
+		breakdown.Writers[string(name)] += bytes
+	}
+	return breakdown, nil
+}
+
+// restoreState tracks the blocks made while copying an entry from a
+// past revision, for RestoreFromRevision.
+type restoreState struct {
+	// oldKmd is the MD of the revision being restored from, and
+	// kmd is the current head, used to ready new blocks.
+	oldKmd    KeyMetadata
+	kmd       KeyMetadata
+	chargedTo keybase1.UserOrTeamID
+	// bps holds the new blocks that need to be put, and increfs
+	// holds the new references made to existing blocks.  infos
+	// holds the BlockInfos for both.
+	bps     *blockPutState
+	increfs []BlockPointer
+	infos   []BlockInfo
+}
+
+// restoreReadyBlock readies `block` as a brand new block, without
+// deduping it against any known blocks.
+func (fbo *folderBranchOps) restoreReadyBlock(
+	ctx context.Context, rs *restoreState, block Block) (BlockInfo, error) {
+	directType := DirectBlock
+	if block.IsIndirect() {
+		directType = IndirectBlock
+	}
+	id, _, readyBlockData, err := fbo.config.BlockOps().Ready(
+		ctx, rs.kmd, block)
+	if err != nil {
+		return BlockInfo{}, err
+	}
+	info := BlockInfo{
+		BlockPointer: BlockPointer{
+			ID:         id,
+			KeyGen:     rs.kmd.LatestKeyGeneration(),
+			DataVer:    block.DataVersion(),
+			DirectType: directType,
+			Context: kbfsblock.MakeFirstContext(
+				rs.chargedTo, fbo.config.DefaultBlockType()),
+		},
+		EncodedSize: uint32(readyBlockData.GetEncodedSize()),
+	}
+	rs.bps.addNewBlock(info.BlockPointer, block, readyBlockData, nil)
+	rs.infos = append(rs.infos, info)
+	return info, nil
+}
+
+// restoreLeafFileBlock makes a new reference to the given leaf file
+// block.  If the block has already been archived, and so can't be
+// referenced again, it makes a new copy of the block instead.
+func (fbo *folderBranchOps) restoreLeafFileBlock(
+	ctx context.Context, lState *lockState, rs *restoreState, p path,
+	info BlockInfo) (BlockInfo, error) {
+	newPtr := info.BlockPointer
+	var err error
+	newPtr.RefNonce, err = fbo.config.cryptoPure().MakeBlockRefNonce()
+	if err != nil {
+		return BlockInfo{}, err
+	}
+	newPtr.SetWriter(rs.chargedTo)
+	err = fbo.config.BlockServer().AddBlockReference(
+		ctx, fbo.id(), newPtr.ID, newPtr.Context)
+	switch errors.Cause(err).(type) {
+	case nil:
+		newInfo := BlockInfo{newPtr, info.EncodedSize}
+		rs.increfs = append(rs.increfs, newPtr)
+		rs.infos = append(rs.infos, newInfo)
+		return newInfo, nil
+	case kbfsblock.ServerErrorBlockArchived:
+		fbo.log.CDebugf(ctx, "Block %v is archived; copying it", info)
+	default:
+		return BlockInfo{}, err
+	}
+
+	fblock, err := fbo.blocks.GetFileBlockForReading(
+		ctx, lState, rs.oldKmd, info.BlockPointer, fbo.branch(), p)
+	if err != nil {
+		return BlockInfo{}, err
+	}
+	return fbo.restoreReadyBlock(ctx, rs, fblock.DeepCopy())
+}
+
+// restoreFileBlock copies the file block tree rooted at `info`.
+func (fbo *folderBranchOps) restoreFileBlock(
+	ctx context.Context, lState *lockState, rs *restoreState, p path,
+	info BlockInfo) (BlockInfo, error) {
+	if info.DirectType == DirectBlock {
+		return fbo.restoreLeafFileBlock(ctx, lState, rs, p, info)
+	}
+	fblock, err := fbo.blocks.GetFileBlockForReading(
+		ctx, lState, rs.oldKmd, info.BlockPointer, fbo.branch(), p)
+	if err != nil {
+		return BlockInfo{}, err
+	}
+	if !fblock.IsInd {
+		return fbo.restoreLeafFileBlock(ctx, lState, rs, p, info)
+	}
+
+	newBlock := fblock.DeepCopy()
+	for i, iptr := range newBlock.IPtrs {
+		newInfo, err := fbo.restoreFileBlock(ctx, lState, rs, p, iptr.BlockInfo)
+		if err != nil {
+			return BlockInfo{}, err
+		}
+		newBlock.IPtrs[i].BlockInfo = newInfo
+	}
+	return fbo.restoreReadyBlock(ctx, rs, newBlock)
+}
+
+// restoreDirBlock copies the directory block tree rooted at `ptr`,
+// along with all of the entries in it.
+func (fbo *folderBranchOps) restoreDirBlock(
+	ctx context.Context, lState *lockState, rs *restoreState, p path,
+	ptr BlockPointer) (BlockInfo, error) {
+	dblock, err := fbo.blocks.GetDirBlockForReading(
+		ctx, lState, rs.oldKmd, ptr, fbo.branch(), p)
+	if err != nil {
+		return BlockInfo{}, err
+	}
+
+	newBlock := dblock.DeepCopy()
+	if newBlock.IsInd {
+		for i, iptr := range newBlock.IPtrs {
+			newInfo, err := fbo.restoreDirBlock(
+				ctx, lState, rs, p, iptr.BlockPointer)
+			if err != nil {
+				return BlockInfo{}, err
+			}
+			newBlock.IPtrs[i].BlockInfo = newInfo
+		}
+	} else {
+		for name, de := range newBlock.Children {
+			newDe, err := fbo.restoreEntry(
+				ctx, lState, rs, p.ChildPath(name, de.BlockPointer), de)
+			if err != nil {
+				return BlockInfo{}, err
+			}
+			newBlock.Children[name] = newDe
+		}
+	}
+	return fbo.restoreReadyBlock(ctx, rs, newBlock)
+}
+
+// restoreEntry copies the entry at `p` from a past revision, along
+// with everything under it, and returns the copied entry.
+func (fbo *folderBranchOps) restoreEntry(
+	ctx context.Context, lState *lockState, rs *restoreState, p path,
+	de DirEntry) (DirEntry, error) {
+	var err error
+	switch de.Type {
+	case Sym:
+		// Symlinks are stored in their parent's block.
+		return de, nil
+	case Dir:
+		de.BlockInfo, err = fbo.restoreDirBlock(
+			ctx, lState, rs, p, de.BlockPointer)
+	default:
+		de.BlockInfo, err = fbo.restoreFileBlock(
+			ctx, lState, rs, p, de.BlockInfo)
+	}
+	if err != nil {
+		return DirEntry{}, err
+	}
+	return de, nil
+}
+
+// getSubtreeBlockInfos returns the BlockInfos of all the blocks
+// making up the entry at `p`, including everything under it.
+func (fbo *folderBranchOps) getSubtreeBlockInfos(
+	ctx context.Context, lState *lockState, kmd KeyMetadata, p path,
+	de DirEntry) ([]BlockInfo, error) {
+	if de.Type == Sym {
+		return nil, nil
+	}
+
+	infos := []BlockInfo{de.BlockInfo}
+	if de.Type != Dir {
+		fileInfos, err := fbo.blocks.GetIndirectFileBlockInfos(
+			ctx, lState, kmd, p)
+		if err != nil {
+			return nil, err
+		}
+		return append(infos, fileInfos...), nil
+	}
+
+	dirInfos, err := fbo.blocks.GetIndirectDirBlockInfos(ctx, lState, kmd, p)
+	if err != nil {
+		return nil, err
+	}
+	infos = append(infos, dirInfos...)
+	children, err := fbo.blocks.GetEntries(ctx, lState, kmd, p)
+	if err != nil {
+		return nil, err
+	}
+	for name, childDe := range children {
+		childInfos, err := fbo.getSubtreeBlockInfos(
+			ctx, lState, kmd, p.ChildPath(name, childDe.BlockPointer), childDe)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, childInfos...)
+	}
+	return infos, nil
+}
+
+// restoreFromRevisionLocked copies entry `name` of `dir`, as it was
+// at revision `rev`, back into `dir`.  If `replace` is true, the
+// entry must currently exist and is replaced by the copy; otherwise
+// it must not currently exist.
+func (fbo *folderBranchOps) restoreFromRevisionLocked(
+	ctx context.Context, lState *lockState, dir Node, name string,
+	rev kbfsmd.Revision, replace bool) (err error) {
+	fbo.mdWriterLock.AssertLocked(lState)
+
+	if fbo.nodeCache.IsUnlinked(dir) {
+		p := fbo.nodeCache.PathFromNode(dir).String()
+		return errors.WithStack(UnsupportedOpInUnlinkedDirError{p})
+	}
+
+	// Flush any outstanding changes first, so that the old entry is
+	// read without any dirty blocks in the way, and the restore is
+	// its own MD update.
+	err = fbo.syncAllLocked(ctx, lState, NoExcl)
+	if err != nil {
+		return err
+	}
+
+	md, err := fbo.getMDForWriteLockedForFilename(ctx, lState, "")
+	if err != nil {
+		return err
+	}
+	if rev < kbfsmd.RevisionInitial || rev > md.Revision() {
+		return errors.Errorf("Can't restore from revision %d; the head "+
+			"revision is %d", rev, md.Revision())
+	}
+	if rev <= md.data.LastGCRevision {
+		// Some of the blocks may have already been reclaimed.
+		return RevGarbageCollectedError{rev, md.data.LastGCRevision}
+	}
+
+	dirPath, err := fbo.pathFromNodeForMDWriteLocked(lState, dir)
+	if err != nil {
+		return err
+	}
+	nodePath := dirPath.ChildPathNoPtr(name)
+	currDe, err := fbo.blocks.GetEntry(ctx, lState, md.ReadOnly(), nodePath)
+	switch errors.Cause(err).(type) {
+	case nil:
+		if !replace {
+			return NameExistsError{name}
+		}
+	case NoSuchNameError:
+		if replace {
+			return err
+		}
+	default:
+		return err
+	}
+
+	// Find the entry at the same path as of `rev`.
+	oldMD, err := getSingleMD(ctx, fbo.config, fbo.id(), kbfsmd.NullBranchID,
+		rev, kbfsmd.Merged, nil)
+	if err != nil {
+		return err
+	}
+	oldPath := path{
+		FolderBranch: fbo.folderBranch,
+		path: []pathNode{{
+			oldMD.data.Dir.BlockPointer, nodePath.path[0].Name}},
+	}
+	var oldDe DirEntry
+	for _, pn := range nodePath.path[1:] {
+		oldDe, err = fbo.blocks.GetEntry(
+			ctx, lState, oldMD, oldPath.ChildPathNoPtr(pn.Name))
+		if err != nil {
+			return err
+		}
+		oldPath = oldPath.ChildPath(pn.Name, oldDe.BlockPointer)
+	}
+	fbo.log.CDebugf(ctx, "Restoring %s from revision %d (%v -> %v)",
+		nodePath, rev, currDe.BlockPointer, oldDe.BlockPointer)
+
+	chargedTo, err := chargedToForTLF(
+		ctx, fbo.config.KBPKI(), fbo.config.KBPKI(), md.GetTlfHandle())
+	if err != nil {
+		return err
+	}
+	rs := &restoreState{
+		oldKmd:    oldMD,
+		kmd:       md,
+		chargedTo: chargedTo,
+		bps:       newBlockPutState(1),
+	}
+	syncStarted := false
+	defer func() {
+		if err == nil || syncStarted {
+			// If the sync failed, the MD may have still made it to
+			// the server, so it's not safe to clean up the blocks.
+			return
+		}
+		for _, ptr := range rs.increfs {
+			rs.bps.addNewBlock(ptr, nil, ReadyBlockData{}, nil)
+		}
+		fbo.fbm.cleanUpBlockState(md.ReadOnly(), rs.bps, blockDeleteAlways)
+	}()
+
+	// Copy the old entry, reusing references to its leaf blocks
+	// where possible.  The top directory of a restored subtree is
+	// made dirty like a new directory, so the sync can pick it up;
+	// everything else is put right away.
+	newDe := oldDe
+	var children map[string]DirEntry
+	if oldDe.Type == Dir {
+		oldChildren, err := fbo.blocks.GetEntries(ctx, lState, oldMD, oldPath)
+		if err != nil {
+			return err
+		}
+		children = make(map[string]DirEntry, len(oldChildren))
+		for childName, childDe := range oldChildren {
+			children[childName], err = fbo.restoreEntry(ctx, lState, rs,
+				oldPath.ChildPath(childName, childDe.BlockPointer), childDe)
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		newDe, err = fbo.restoreEntry(ctx, lState, rs, oldPath, oldDe)
+		if err != nil {
+			return err
+		}
+	}
+
+	blocksToRemove, err := doBlockPuts(ctx, fbo.config.BlockServer(),
+		fbo.config.BlockCache(), fbo.config.Reporter(), fbo.log,
+		fbo.deferLog, md.TlfID(), md.GetTlfHandle().GetCanonicalName(),
+		*rs.bps)
+	if err != nil {
+		return err
+	}
+	if len(blocksToRemove) > 0 {
+		return errors.Errorf("Unexpected deduped blocks while restoring: %v",
+			blocksToRemove)
+	}
+
+	// Now replace any current entry with the copy, as an rm followed
+	// by a create in the same batch.
+	var undoFns []dirCacheUndoFn
+	numDirOps := len(fbo.dirOps)
+	addedDirty := false
+	defer func() {
+		if err == nil || syncStarted {
+			// A failed sync leaves the batched ops in place to be
+			// retried by the next sync, as for any other dir op.
+			return
+		}
+		for i := len(undoFns) - 1; i >= 0; i-- {
+			undoFns[i](lState)
+		}
+		fbo.dirOps = fbo.dirOps[:numDirOps]
+		if addedDirty {
+			fbo.status.rmDirtyNode(dir)
+		}
+	}()
+
+	parentPtr := dirPath.tailPointer()
+	var ops []op
+	if replace {
+		ro, err := newRmOp(name, parentPtr, currDe.Type)
+		if err != nil {
+			return err
+		}
+		ro.setFinalPath(dirPath)
+		ro.AddSelfUpdate(parentPtr)
+		unrefs, err := fbo.getSubtreeBlockInfos(ctx, lState, md,
+			dirPath.ChildPath(name, currDe.BlockPointer), currDe)
+		if err != nil {
+			return err
+		}
+		fbo.prepper.cacheBlockInfos(unrefs)
+		for _, info := range unrefs {
+			ro.AddUnrefBlock(info.BlockPointer)
+		}
+		undoFn, err := fbo.blocks.RemoveDirEntryInCache(
+			ctx, lState, md.ReadOnly(), dirPath, name, currDe)
+		if err != nil {
+			return err
+		}
+		undoFns = append(undoFns, undoFn)
+		fbo.dirOps = append(fbo.dirOps, cachedDirOp{ro, []Node{dir}})
+		ops = append(ops, ro)
+	}
+
+	co, err := newCreateOp(name, parentPtr, newDe.Type)
+	if err != nil {
+		return err
+	}
+	co.setFinalPath(dirPath)
+	co.AddSelfUpdate(parentPtr)
+	fbo.prepper.cacheBlockInfos(rs.infos)
+	for _, info := range rs.infos {
+		co.AddRefBlock(info.BlockPointer)
+	}
+	newDe.Ctime = fbo.nowUnixNano()
+	if fbo.id().Type() == tlf.SingleTeam {
+		session, err := fbo.config.KBPKI().GetCurrentSession(ctx)
+		if err != nil {
+			return err
+		}
+		newDe.TeamWriter = session.UID
+	}
+	if newDe.Type == Dir {
+		newID, err := fbo.config.cryptoPure().MakeTemporaryBlockID()
+		if err != nil {
+			return err
+		}
+		newDe.BlockInfo = BlockInfo{
+			BlockPointer: BlockPointer{
+				ID:         newID,
+				KeyGen:     md.LatestKeyGeneration(),
+				DataVer:    fbo.config.DataVersion(),
+				DirectType: DirectBlock,
+				Context: kbfsblock.MakeFirstContext(
+					chargedTo, fbo.config.DefaultBlockType()),
+			},
+		}
+		co.AddRefBlock(newDe.BlockPointer)
+		err = fbo.config.DirtyBlockCache().Put(
+			fbo.id(), newDe.BlockPointer, fbo.branch(),
+			&DirBlock{Children: make(map[string]DirEntry)})
+		if err != nil {
+			return err
+		}
+		tempPtr := newDe.BlockPointer
+		undoFns = append(undoFns, func(_ *lockState) {
+			// Delete should never fail.
+			_ = fbo.config.DirtyBlockCache().Delete(
+				fbo.id(), tempPtr, fbo.branch())
+		})
+	}
+	undoFn, err := fbo.blocks.AddDirEntryInCache(
+		ctx, lState, md.ReadOnly(), dirPath, name, newDe)
+	if err != nil {
+		return err
+	}
+	undoFns = append(undoFns, undoFn)
+	newNode, err := fbo.nodeCache.GetOrCreate(newDe.BlockPointer, name, dir)
+	if err != nil {
+		return err
+	}
+	newPath := dirPath.ChildPath(name, newDe.BlockPointer)
+	for childName, childDe := range children {
+		undoFn, err = fbo.blocks.AddDirEntryInCache(
+			ctx, lState, md.ReadOnly(), newPath, childName, childDe)
+		if err != nil {
+			return err
+		}
+		undoFns = append(undoFns, undoFn)
+	}
+	fbo.dirOps = append(fbo.dirOps, cachedDirOp{co, []Node{dir, newNode}})
+	addedDirty = fbo.status.addDirtyNode(dir)
+
+	for _, dirOp := range append(ops, co) {
+		err = fbo.notifyOneOp(ctx, lState, dirOp, md.ReadOnly(), false)
+		if err != nil {
+			return err
+		}
+	}
+
+	syncStarted = true
+	return fbo.syncAllLocked(ctx, lState, NoExcl)
+}
+
+// RestoreFromRevision implements the KBFSOps interface for
+// folderBranchOps.
+func (fbo *folderBranchOps) RestoreFromRevision(
+	ctx context.Context, node Node, rev kbfsmd.Revision) (err error) {
+	fbo.log.CDebugf(ctx, "RestoreFromRevision %s %d", getNodeIDStr(node), rev)
+	defer func() {
+		fbo.deferLog.CDebugf(ctx, "RestoreFromRevision %s %d done: %+v",
+			getNodeIDStr(node), rev, err)
+	}()
+
+	err = fbo.checkNodeForWrite(ctx, node)
+	if err != nil {
+		return err
+	}
+
+	return fbo.doMDWriteWithRetryUnlessCanceled(ctx,
+		func(lState *lockState) error {
+			if fbo.nodeCache.IsUnlinked(node) {
+				p := fbo.nodeCache.PathFromNode(node).String()
+				return errors.WithStack(UnsupportedOpInUnlinkedDirError{p})
+			}
+			nodePath, err := fbo.pathFromNodeForMDWriteLocked(lState, node)
+			if err != nil {
+				return err
+			}
+			if !nodePath.hasValidParent() {
+				return errors.New(
+					"Can't restore the root directory of a folder")
+			}
+			dir := fbo.nodeCache.Get(nodePath.parentPath().tailRef())
+			if dir == nil {
+				return errors.Errorf("No node for the parent of %s", nodePath)
+			}
+			return fbo.restoreFromRevisionLocked(
+				ctx, lState, dir, nodePath.tailName(), rev, true)
+		})
+}
+
+// findDeletedEntries returns the entries deleted by the given
+// revision, for which the parent directory still existed after the
+// revision.
+func (fbo *folderBranchOps) findDeletedEntries(
+	ctx context.Context, rmd ImmutableRootMetadata, writer string) (
+	entries []DeletedEntry, err error) {
+	var rmOps []*rmOp
+	ptrs := make([]BlockPointer, 0, len(rmd.data.Changes.Ops))
+	newPtrs := map[BlockPointer]bool{rmd.data.Dir.BlockPointer: true}
+	for _, op := range rmd.data.Changes.Ops {
+		for _, update := range op.allUpdates() {
+			newPtrs[update.Ref] = true
+		}
+		if ro, ok := op.(*rmOp); ok && ro.Dir.Ref.IsInitialized() {
+			rmOps = append(rmOps, ro)
+			ptrs = append(ptrs, ro.Dir.Ref)
+		}
+	}
+	if len(rmOps) == 0 {
+		return nil, nil
+	}
+
+	// Search the tree as of this revision, using a throwaway node
+	// cache, since the paths may not exist anymore.
+	paths, err := fbo.blocks.SearchForPaths(ctx,
+		newNodeCacheStandard(fbo.folderBranch), ptrs, newPtrs,
+		rmd.ReadOnly(), rmd.data.Dir.BlockPointer)
+	if err != nil {
+		return nil, err
+	}
+
+	// We want the server's view of the time.
+	revTime := rmd.localTimestamp
+	if offset, ok := fbo.config.MDServer().OffsetFromServerTime(); ok {
+		revTime = revTime.Add(-offset)
+	}
+	for i := len(rmOps) - 1; i >= 0; i-- {
+		ro := rmOps[i]
+		p := paths[ro.Dir.Ref]
+		if !p.isValid() {
+			// The parent was deleted in the same revision, so the
+			// entry will be restored along with it.
+			fbo.log.CDebugf(ctx, "Ignoring deleted entry %s with no "+
+				"parent in revision %d", ro.OldName, rmd.Revision())
+			continue
+		}
+		names := make([]string, 0, len(p.path))
+		for _, pn := range p.path[1:] {
+			names = append(names, pn.Name)
+		}
+		entries = append(entries, DeletedEntry{
+			Path:     strings.Join(append(names, ro.OldName), "/"),
+			Type:     ro.RemovedType,
+			Revision: rmd.Revision(),
+			Writer:   writer,
+			Time:     revTime,
+		})
+	}
+	return entries, nil
+}
+
+// GetDeletedEntries implements the KBFSOps interface for
+// folderBranchOps.
+func (fbo *folderBranchOps) GetDeletedEntries(
+	ctx context.Context, folderBranch FolderBranch) (
+	entries []DeletedEntry, err error) {
+	fbo.log.CDebugf(ctx, "GetDeletedEntries")
+	defer func() {
+		fbo.deferLog.CDebugf(ctx, "GetDeletedEntries done: %+v", err)
+	}()
+
+	if folderBranch != fbo.folderBranch {
+		return nil, WrongOpsError{fbo.folderBranch, folderBranch}
+	}
+
+	lState := makeFBOLockState()
+	head, err := fbo.getMDForReadNeedIdentify(ctx, lState)
+	if err != nil {
+		return nil, err
+	}
+	if head == (ImmutableRootMetadata{}) {
+		return nil, nil
+	}
+
+	// Deletions at or before the last gc'd revision can't be undone,
+	// since their blocks may have been reclaimed already.
+	earliestRev := head.Revision() - maxDeletedEntriesRevisions + 1
+	if earliestRev <= head.data.LastGCRevision {
+		earliestRev = head.data.LastGCRevision + 1
+	}
+	if earliestRev < kbfsmd.RevisionInitial {
+		earliestRev = kbfsmd.RevisionInitial
+	}
+
+	// Deleted entries for a given merged revision never change, so
+	// only the revisions since the last call need to be scanned.
+	fbo.deletedEntriesLock.Lock()
+	defer fbo.deletedEntriesLock.Unlock()
+	cachedRev := fbo.deletedEntriesRev
+	if cachedRev > head.Revision() || cachedRev < earliestRev-1 {
+		cachedRev = kbfsmd.RevisionUninitialized
+	}
+	start := earliestRev
+	if cachedRev != kbfsmd.RevisionUninitialized {
+		start = cachedRev + 1
+	}
+	entries, err = fbo.findDeletedEntriesInRange(ctx, start, head.Revision())
+	if err != nil {
+		return nil, err
+	}
+	if cachedRev != kbfsmd.RevisionUninitialized {
+		for _, e := range fbo.deletedEntries {
+			if e.Revision < earliestRev {
+				break
+			}
+			entries = append(entries, e)
+		}
+	}
+	if head.MergedStatus() == kbfsmd.Merged {
+		fbo.deletedEntriesRev = head.Revision()
+		fbo.deletedEntries = entries
+	}
+	// Return a copy, so callers can't modify the cache.
+	return groupDeletedContents(entries), nil
+}
+
+// groupDeletedContents returns a copy of `entries` (most recent
+// first) in which the entries deleted from a directory in the run of
+// revisions right before the directory itself was deleted are moved
+// into the directory's Contents.  A recursive remove deletes a
+// directory's contents first, often over several revisions, so the
+// directory alone is empty as of the revision before its deletion.
+func groupDeletedContents(entries []DeletedEntry) []DeletedEntry {
+	grouped := make(map[int]bool)
+	result := make([]DeletedEntry, 0, len(entries))
+	for i, e := range entries {
+		if grouped[i] {
+			continue
+		}
+		if e.Type == Dir {
+			prefix := e.Path + "/"
+			// The run ends at the first revision without any
+			// deletions from the directory.
+			runRev := e.Revision
+			for j := i + 1; j < len(entries); j++ {
+				child := entries[j]
+				if child.Revision < runRev-1 {
+					break
+				}
+				if grouped[j] || !strings.HasPrefix(child.Path, prefix) {
+					continue
+				}
+				grouped[j] = true
+				e.Contents = append(e.Contents, child)
+				runRev = child.Revision
+			}
+		}
+		result = append(result, e)
+	}
+	return result
+}
+
+// findDeletedEntriesInRange returns the entries deleted by the merged
+// revisions between `earliestRev` and `latestRev`, inclusive, most
+// recent first.
+func (fbo *folderBranchOps) findDeletedEntriesInRange(
+	ctx context.Context, earliestRev, latestRev kbfsmd.Revision) (
+	entries []DeletedEntry, err error) {
+	writerNames := make(map[keybase1.UID]string)
+	for end := latestRev; end >= earliestRev; end -= maxMDsAtATime {
+		start := end - maxMDsAtATime + 1
+		if start < earliestRev {
+			start = earliestRev
+		}
+		rmds, err := getMDRange(ctx, fbo.config, fbo.id(),
+			kbfsmd.NullBranchID, start, end, kbfsmd.Merged, nil)
+		if err != nil {
+			return nil, err
+		}
+		for i := len(rmds) - 1; i >= 0; i-- {
+			rmd := rmds[i]
+			writer, ok := writerNames[rmd.LastModifyingWriter()]
+			if !ok {
+				name, err := fbo.config.KBPKI().GetNormalizedUsername(
+					ctx, rmd.LastModifyingWriter().AsUserOrTeam())
+				if err != nil {
+					return nil, err
+				}
+				writer = string(name)
+				writerNames[rmd.LastModifyingWriter()] = writer
+			}
+			revEntries, err := fbo.findDeletedEntries(ctx, rmd, writer)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, revEntries...)
+		}
+	}
+	return entries, nil
+}
+
+// UndeleteEntry implements the KBFSOps interface for folderBranchOps.
+func (fbo *folderBranchOps) UndeleteEntry(
+	ctx context.Context, folderBranch FolderBranch, p string,
+	rev kbfsmd.Revision) (err error) {
+	fbo.log.CDebugf(ctx, "UndeleteEntry %s %d", p, rev)
+	defer func() {
+		fbo.deferLog.CDebugf(ctx, "UndeleteEntry %s %d done: %+v",
+			p, rev, err)
+	}()
+
+	if folderBranch != fbo.folderBranch {
+		return WrongOpsError{fbo.folderBranch, folderBranch}
+	}
+	if rev <= kbfsmd.RevisionInitial {
+		return errors.Errorf("Revision %d didn't delete anything", rev)
+	}
+
+	// The parent directory must still exist.
+	dir, _, _, err := fbo.getRootNode(ctx)
+	if err != nil {
+		return err
+	}
+	names := strings.Split(strings.Trim(p, "/"), "/")
+	for _, name := range names[:len(names)-1] {
+		dir, _, err = fbo.Lookup(ctx, dir, name)
+		if err != nil {
+			return err
+		}
+		if dir == nil {
+			return errors.Errorf("%s is not a directory", name)
+		}
+	}
+	name := names[len(names)-1]
+	if name == "" {
+		return errors.New("Can't undelete the root directory of a folder")
+	}
+
+	err = fbo.checkNodeForWrite(ctx, dir)
+	if err != nil {
+		return err
+	}
+
+	// Restore the entry from the last revision where it was live,
+	// or, if its contents were deleted first, from the last revision
+	// where they were all still there.
+	restoreRev := rev - 1
+	entries, err := fbo.GetDeletedEntries(ctx, folderBranch)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.Path == strings.Trim(p, "/") && e.Revision == rev &&
+			len(e.Contents) > 0 {
+			restoreRev = e.Contents[len(e.Contents)-1].Revision - 1
+			break
+		}
+	}
+	return fbo.doMDWriteWithRetryUnlessCanceled(ctx,
+		func(lState *lockState) error {
+			return fbo.restoreFromRevisionLocked(
+				ctx, lState, dir, name, restoreRev, false)
+		})
+}
+
 // GetEditHistory implements the KBFSOps interface for folderBranchOps
 func (fbo *folderBranchOps) GetEditHistory(
 	ctx context.Context, _ FolderBranch) (
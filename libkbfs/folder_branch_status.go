@@ -7,6 +7,7 @@ package libkbfs
 import (
 	"fmt"
 	"reflect"
+	"sort"
 	"sync"
 
 	"github.com/keybase/client/go/libkb"
@@ -39,6 +40,12 @@ type FolderBranchStatus struct {
 	GitArchiveBytes     int64
 	GitLimitBytes       int64
 
+	// SyncPaths are the paths configured for offline sync, if only
+	// part of the folder is synced.  SyncPathStatuses show the
+	// progress of syncing each subtree that matches them.
+	SyncPaths        []string               `json:",omitempty"`
+	SyncPathStatuses []FolderSyncPathStatus `json:",omitempty"`
+
 	// DirtyPaths are files that have been written, but not flushed.
 	// They do not represent unstaged changes in your local instance.
 	DirtyPaths []string
@@ -50,9 +57,20 @@ type FolderBranchStatus struct {
 
 	Journal *TLFJournalStatus `json:",omitempty"`
 
+	// QuotaReclamation describes the quota reclamation policy in
+	// effect, and how the last reclamation went.
+	QuotaReclamation *QuotaReclamationStatus `json:",omitempty"`
+
 	PermanentErr string `json:",omitempty"`
 }
 
+// FolderSyncPathStatus describes how far along the offline sync of
+// one subtree of a partially-synced folder is.
+type FolderSyncPathStatus struct {
+	Path           string
+	PrefetchStatus string
+}
+
 // KBFSStatus represents the content of the top-level status file. It is
 // suitable for encoding directly as JSON.
 // TODO: implement magical status update like FolderBranchStatus
@@ -87,6 +105,7 @@ type folderBranchStatusKeeper struct {
 	unmerged   []*crChainSummary
 	merged     []*crChainSummary
 	quotaUsage *EventuallyConsistentQuotaUsage
+	syncRoots  []partialSyncRoot
 
 	updateChan  chan StatusUpdate
 	updateMutex sync.Mutex
@@ -176,6 +195,19 @@ func (fbsk *folderBranchStatusKeeper) rmDirtyNode(n Node) bool {
 	return fbsk.rmNode(fbsk.dirtyNodes, n)
 }
 
+// setPartialSyncRoots sets the subtrees that are currently being
+// synced for a partially-synced folder-branch.
+func (fbsk *folderBranchStatusKeeper) setPartialSyncRoots(
+	roots []partialSyncRoot) {
+	fbsk.dataMutex.Lock()
+	defer fbsk.dataMutex.Unlock()
+	if len(roots) == 0 && len(fbsk.syncRoots) == 0 {
+		return
+	}
+	fbsk.syncRoots = roots
+	fbsk.signalChangeLocked()
+}
+
 // dataMutex should be taken by the caller
 func (fbsk *folderBranchStatusKeeper) convertNodesToPathsLocked(
 	m map[NodeID]Node) []string {
@@ -219,6 +251,15 @@ func (fbsk *folderBranchStatusKeeper) getStatusWithoutJournaling(
 			fbsk.md.Data().Dir.BlockPointer)
 		fbs.PrefetchStatus = prefetchStatus.String()
 		fbs.RootBlockID = fbsk.md.Data().Dir.BlockPointer.ID.String()
+		fbs.SyncPaths = fbsk.config.GetTlfSyncPaths(fbsk.md.TlfID())
+		for _, r := range fbsk.syncRoots {
+			fbs.SyncPathStatuses = append(fbs.SyncPathStatuses,
+				FolderSyncPathStatus{
+					Path: r.p.CanonicalPathString(),
+					PrefetchStatus: fbsk.config.PrefetchStatus(
+						ctx, fbsk.md.TlfID(), r.p.tailPointer()).String(),
+				})
+		}
 
 		if fbsk.quotaUsage == nil {
 			loggerSuffix := fmt.Sprintf("status-%s", fbsk.md.TlfID())
@@ -310,3 +351,25 @@ func (fbsk *folderBranchStatusKeeper) getStatus(ctx context.Context,
 	}
 	return fbs, ch, nil
 }
+
+// GetPartialSyncPathsInProgress returns the canonical paths of the
+// subtrees of all partially-synced TLFs that haven't finished syncing
+// for offline use yet.
+func GetPartialSyncPathsInProgress(
+	ctx context.Context, config Config) ([]string, error) {
+	var paths []string
+	for _, tlfID := range config.GetPartiallySyncedTlfs() {
+		status, _, err := config.KBFSOps().FolderStatus(
+			ctx, FolderBranch{Tlf: tlfID, Branch: MasterBranch})
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range status.SyncPathStatuses {
+			if s.PrefetchStatus != FinishedPrefetch.String() {
+				paths = append(paths, s.Path)
+			}
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	stdpath "path"
 	"path/filepath"
 	"strings"
 	"time"
@@ -48,14 +49,18 @@ type InitParams struct {
 
 	// If non-empty, the host:port of the block server. If empty,
 	// a default value is used depending on the run mode. Can also
-	// be "memory" for an in-memory test server or
-	// "dir:/path/to/dir" for an on-disk test server.
+	// be "memory" for an in-memory test server,
+	// "dir:/path/to/dir" for an on-disk test server, or
+	// "unix:/path/to/socket" for a test server shared with other
+	// processes (see LocalSharedServer).
 	BServerAddr string
 
 	// If non-empty the host:port of the metadata server. If
 	// empty, a default value is used depending on the run mode.
-	// Can also be "memory" for an in-memory test server or
-	// "dir:/path/to/dir" for an on-disk test server.
+	// Can also be "memory" for an in-memory test server,
+	// "dir:/path/to/dir" for an on-disk test server, or
+	// "unix:/path/to/socket" for a test server shared with other
+	// processes (see LocalSharedServer).
 	MDServerAddr string
 
 	// If non-zero, specifies the capacity (in bytes) of the block cache. If
@@ -99,6 +104,40 @@ type InitParams struct {
 	// DiskCacheMode specifies which mode to start the disk cache.
 	DiskCacheMode DiskCacheMode
 
+	// If non-empty, where to export spans tracing KBFS operations:
+	// either "file:/path/to/spans.json" to append them to a file as
+	// JSON lines, or "otlp:host:port" to send them to an
+	// OpenTelemetry collector using OTLP/HTTP.
+	TraceExporter string
+
+	// If non-empty, the host:port on which to serve metrics in the
+	// Prometheus text format, at the /metrics path.
+	MetricsAddr string
+
+	// If non-empty, a text/template over ConflictRenameData used to
+	// name conflicted entries instead of the default
+	// "<name>.conflicted (<user>'s <device> copy <date>)<ext>".
+	ConflictRenameTemplate string
+
+	// If non-empty, a comma-separated list of glob patterns, such as
+	// "*.txt,*.log".  Conflicting writes to text files with matching
+	// names are merged line by line when they don't overlap and the
+	// result fits in a single block, instead of leaving a conflicted
+	// copy.
+	ConflictMergeGlobs string
+
+	// EnableCacheWarmup, if true, saves a manifest of the most
+	// recently fetched blocks under StorageRoot on shutdown, and
+	// re-requests them at low priority on startup and after the
+	// caches are reset.  The manifest isn't encrypted, and reveals
+	// which TLFs were used recently, so this is off by default.
+	EnableCacheWarmup bool
+
+	// EnableSearchIndex, if true, keeps an encrypted full-text index
+	// of the text files in synced TLFs under StorageRoot, so their
+	// contents can be searched.
+	EnableSearchIndex bool
+
 	// StorageRoot, if non-empty, points to a local directory to put its local
 	// databases for things like the journal or disk cache.
 	StorageRoot string
@@ -206,10 +245,12 @@ func AddFlagsWithDefaults(
 		"Print debug messages")
 
 	flags.StringVar(&params.BServerAddr, "bserver", defaultParams.BServerAddr,
-		"host:port of the block server, 'memory', or 'dir:/path/to/dir'")
+		"host:port of the block server, 'memory', 'dir:/path/to/dir', "+
+			"or 'unix:/path/to/socket'")
 	flags.StringVar(&params.MDServerAddr, "mdserver",
 		defaultParams.MDServerAddr,
-		"host:port of the metadata server, 'memory', or 'dir:/path/to/dir'")
+		"host:port of the metadata server, 'memory', 'dir:/path/to/dir', "+
+			"or 'unix:/path/to/socket'")
 	flags.StringVar(&params.LocalUser, "localuser", defaultParams.LocalUser,
 		"fake local user")
 	flags.StringVar(&params.LocalFavoriteStorage, "local-fav-storage",
@@ -248,6 +289,29 @@ func AddFlagsWithDefaults(
 			"cache operations to it.")
 	flags.BoolVar(&params.EnableJournal, "enable-journal",
 		defaultParams.EnableJournal, "Enables write journaling for TLFs.")
+	flags.StringVar(&params.TraceExporter, "trace-exporter",
+		defaultParams.TraceExporter, "Where to export spans tracing KBFS "+
+			"operations: 'file:/path/to/spans.json' or 'otlp:host:port'")
+	flags.StringVar(&params.MetricsAddr, "metrics-addr",
+		defaultParams.MetricsAddr, "host:port on which to serve metrics "+
+			"in the Prometheus text format, e.g. localhost:9181")
+	flags.StringVar(&params.ConflictRenameTemplate, "conflict-rename-template",
+		defaultParams.ConflictRenameTemplate, "Template for the names of "+
+			"conflicted entries, using {{.Base}}, {{.Ext}}, {{.User}}, "+
+			"{{.Device}}, {{.Date}} and {{.Revision}}")
+	flags.StringVar(&params.ConflictMergeGlobs, "conflict-merge-globs",
+		defaultParams.ConflictMergeGlobs, "Comma-separated glob patterns "+
+			"of text files whose non-overlapping conflicting writes are "+
+			"merged line by line, e.g. '*.txt,*.log'")
+	flags.BoolVar(&params.EnableCacheWarmup, "enable-cache-warmup",
+		defaultParams.EnableCacheWarmup, "Re-requests the most recently "+
+			"used blocks on startup, to warm up the block caches.  This "+
+			"saves an unencrypted list of recently used folders and "+
+			"blocks under the storage root.")
+	flags.BoolVar(&params.EnableSearchIndex, "enable-search-index",
+		defaultParams.EnableSearchIndex, "Keeps an encrypted full-text "+
+			"index of the text files in synced folders, so their contents "+
+			"can be searched.")
 
 	// No real need to enable setting
 	// params.TLFJournalBackgroundWorkStatus via a flag.
@@ -293,8 +357,8 @@ func GetRemoteUsageString() string {
 // run in a local testing environment.
 func GetLocalUsageString() string {
 	return `    [-debug]
-    [-bserver=(memory | dir:/path/to/dir | host:port)]
-    [-mdserver=(memory | dir:/path/to/dir | host:port)]
+    [-bserver=(memory | dir:/path/to/dir | unix:/path/to/socket | host:port)]
+    [-mdserver=(memory | dir:/path/to/dir | unix:/path/to/socket | host:port)]
     [-localuser=<user>]
     [-local-fav-storage=(memory | dir:/path/to/dir)]
     [-log-to-file] [-log-file=path/to/file] [-clean-bcache-cap=0]`
@@ -327,6 +391,19 @@ func parseRootDir(addr string) (string, bool) {
 	return serverRootDir, true
 }
 
+const unixAddrPrefix = "unix:"
+
+func parseSocketPath(addr string) (string, bool) {
+	if !strings.HasPrefix(addr, unixAddrPrefix) {
+		return "", false
+	}
+	socketPath := addr[len(unixAddrPrefix):]
+	if len(socketPath) == 0 {
+		return "", false
+	}
+	return socketPath, true
+}
+
 func makeMDServer(config Config, mdserverAddr string,
 	rpcLogFactory rpc.LogFactory, log logger.Logger) (
 	MDServer, error) {
@@ -347,6 +424,12 @@ func makeMDServer(config Config, mdserverAddr string,
 		return NewMDServerDir(mdServerLocalConfigAdapter{config}, mdPath)
 	}
 
+	if socketPath, ok := parseSocketPath(mdserverAddr); ok {
+		log.Debug("Using shared local mdserver at %s", socketPath)
+		// local MD server shared with other processes
+		return NewMDServerSocket(config, socketPath, rpcLogFactory), nil
+	}
+
 	remote, err := rpc.ParsePrioritizedRoundRobinRemote(mdserverAddr)
 	if err != nil {
 		return nil, err
@@ -409,6 +492,12 @@ func makeBlockServer(config Config, bserverAddr string,
 			bserverLog, blockPath), nil
 	}
 
+	if socketPath, ok := parseSocketPath(bserverAddr); ok {
+		log.Debug("Using shared local bserver at %s", socketPath)
+		// local block server shared with other processes
+		return NewBlockServerSocket(config, socketPath, rpcLogFactory), nil
+	}
+
 	remote, err := rpc.ParsePrioritizedRoundRobinRemote(bserverAddr)
 	if err != nil {
 		return nil, err
@@ -587,6 +676,16 @@ func doInit(
 			return lg
 		}, params.StorageRoot, params.DiskCacheMode, kbCtx)
 
+	if params.TraceExporter != "" {
+		spanExporter, err := makeSpanExporter(
+			params.TraceExporter, config.MakeLogger("SPAN"))
+		if err != nil {
+			return nil, err
+		}
+		log.CDebugf(ctx, "Exporting spans to %s", params.TraceExporter)
+		config.SetSpanExporter(spanExporter)
+	}
+
 	if params.CleanBlockCacheCapacity > 0 {
 		log.CDebugf(
 			ctx, "overriding default clean block cache capacity from %d to %d",
@@ -657,6 +756,25 @@ func doInit(
 
 	config.SetReporter(NewReporterKBPKI(config, 10, 1000))
 
+	if params.ConflictRenameTemplate != "" {
+		renamer, err := NewTemplateConflictRenamer(
+			config, params.ConflictRenameTemplate)
+		if err != nil {
+			return nil, err
+		}
+		config.SetConflictRenamer(renamer)
+	}
+
+	if params.ConflictMergeGlobs != "" {
+		globs := strings.Split(params.ConflictMergeGlobs, ",")
+		for _, g := range globs {
+			if _, err := stdpath.Match(g, ""); err != nil {
+				return nil, fmt.Errorf("Bad conflict merge glob %q: %v", g, err)
+			}
+		}
+		config.SetConflictMergeGlobs(globs)
+	}
+
 	// Initialize Crypto client (needed for MD and Block servers).
 	crypto, err := keybaseServiceCn.NewCrypto(config, params, kbCtx, kbfsLog)
 	if err != nil {
@@ -749,6 +867,27 @@ func doInit(
 		params.BGFlushDirOpBatchSize)
 	config.SetBGFlushDirOpBatchSize(params.BGFlushDirOpBatchSize)
 
+	if params.MetricsAddr != "" {
+		err = config.enableMetricsServer(ctx, params.MetricsAddr)
+		if err != nil {
+			log.CWarningf(ctx, "Could not serve metrics at %s: %+v",
+				params.MetricsAddr, err)
+		} else {
+			log.CDebugf(ctx, "Serving metrics at http://%s/metrics",
+				params.MetricsAddr)
+		}
+	}
+
+	// Only a full KBFS process should warm up the shared caches.
+	if params.EnableCacheWarmup && config.Mode().KBFSServiceEnabled() {
+		err = config.enableCacheWarmup(params.StorageRoot)
+		if err != nil {
+			log.CWarningf(ctx, "Could not enable cache warm-up: %+v", err)
+		} else {
+			log.CDebugf(ctx, "Cache warm-up enabled")
+		}
+	}
+
 	return config, nil
 }
 
@@ -10,6 +10,7 @@ import (
 	"github.com/keybase/client/go/logger"
 	"github.com/keybase/kbfs/kbfscodec"
 	"github.com/keybase/kbfs/tlf"
+	"golang.org/x/net/context"
 )
 
 type testCodecGetter struct {
@@ -55,14 +56,16 @@ func (cg *testClockGetter) TestClock() *TestClock {
 }
 
 type testSyncedTlfGetterSetter struct {
-	syncedTlfs map[tlf.ID]bool
+	syncedTlfs     map[tlf.ID]bool
+	syncedTlfPaths map[tlf.ID][]string
 }
 
 var _ syncedTlfGetterSetter = (*testSyncedTlfGetterSetter)(nil)
 
 func newTestSyncedTlfGetterSetter() *testSyncedTlfGetterSetter {
 	return &testSyncedTlfGetterSetter{
-		syncedTlfs: make(map[tlf.ID]bool),
+		syncedTlfs:     make(map[tlf.ID]bool),
+		syncedTlfPaths: make(map[tlf.ID][]string),
 	}
 }
 
@@ -73,6 +76,55 @@ func (t *testSyncedTlfGetterSetter) IsSyncedTlf(tlfID tlf.ID) bool {
 func (t *testSyncedTlfGetterSetter) SetTlfSyncState(tlfID tlf.ID,
 	isSynced bool) error {
 	t.syncedTlfs[tlfID] = isSynced
+	delete(t.syncedTlfPaths, tlfID)
+	return nil
+}
+
+func (t *testSyncedTlfGetterSetter) GetTlfSyncPaths(tlfID tlf.ID) []string {
+	return t.syncedTlfPaths[tlfID]
+}
+
+func (t *testSyncedTlfGetterSetter) SetTlfSyncPaths(tlfID tlf.ID,
+	paths []string) error {
+	t.syncedTlfs[tlfID] = false
+	if len(paths) > 0 {
+		t.syncedTlfPaths[tlfID] = paths
+	} else {
+		delete(t.syncedTlfPaths, tlfID)
+	}
+	return nil
+}
+
+func (t *testSyncedTlfGetterSetter) GetPartiallySyncedTlfs() []tlf.ID {
+	tlfIDs := make([]tlf.ID, 0, len(t.syncedTlfPaths))
+	for tlfID := range t.syncedTlfPaths {
+		tlfIDs = append(tlfIDs, tlfID)
+	}
+	return tlfIDs
+}
+
+type testDiskCacheTlfSettingsGetterSetter struct {
+	settings map[tlf.ID]DiskCacheTlfSettings
+}
+
+var _ diskCacheTlfSettingsGetterSetter = (*testDiskCacheTlfSettingsGetterSetter)(nil)
+
+func newTestDiskCacheTlfSettingsGetterSetter() *testDiskCacheTlfSettingsGetterSetter {
+	return &testDiskCacheTlfSettingsGetterSetter{
+		settings: make(map[tlf.ID]DiskCacheTlfSettings),
+	}
+}
+
+func (t *testDiskCacheTlfSettingsGetterSetter) GetDiskCacheTlfSettings(
+	tlfID tlf.ID) DiskCacheTlfSettings {
+	return t.settings[tlfID]
+}
+
+// SetDiskCacheTlfSettings only records the settings; callers must
+// apply them to the cache themselves.
+func (t *testDiskCacheTlfSettingsGetterSetter) SetDiskCacheTlfSettings(
+	_ context.Context, tlfID tlf.ID, settings DiskCacheTlfSettings) error {
+	t.settings[tlfID] = settings
 	return nil
 }
 
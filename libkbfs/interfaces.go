@@ -82,9 +82,63 @@ type diskLimiterGetter interface {
 	DiskLimiter() DiskLimiter
 }
 
+type metricsRegistryGetter interface {
+	// MetricsRegistry may be nil, which should be interpreted as
+	// not using metrics at all.
+	MetricsRegistry() metrics.Registry
+}
+
 type syncedTlfGetterSetter interface {
 	IsSyncedTlf(tlfID tlf.ID) bool
 	SetTlfSyncState(tlfID tlf.ID, isSynced bool) error
+	// GetTlfSyncPaths returns the paths within the given TLF that
+	// are synced for offline use, if only part of the TLF is
+	// synced.  Each path is relative to the TLF root, and each of
+	// its components may be a glob pattern as understood by
+	// `path.Match`.
+	GetTlfSyncPaths(tlfID tlf.ID) []string
+	// SetTlfSyncPaths marks only the given paths within the TLF
+	// as synced for offline use.  An empty list of paths disables
+	// syncing for the TLF.
+	SetTlfSyncPaths(tlfID tlf.ID, paths []string) error
+	// GetPartiallySyncedTlfs returns the IDs of all the TLFs that
+	// have sync paths set.
+	GetPartiallySyncedTlfs() []tlf.ID
+}
+
+type quotaReclamationTlfPolicyGetterSetter interface {
+	// GetQuotaReclamationTlfPolicy returns the quota reclamation
+	// policy set on this device for the given TLF, which may have
+	// nil fields where the global defaults apply.
+	GetQuotaReclamationTlfPolicy(tlfID tlf.ID) QuotaReclamationTlfPolicy
+	// SetQuotaReclamationTlfPolicy persists the given quota
+	// reclamation policy for the TLF on this device.  A policy with
+	// all nil fields restores the global defaults.
+	SetQuotaReclamationTlfPolicy(
+		tlfID tlf.ID, policy QuotaReclamationTlfPolicy) error
+}
+
+type conflictRenameTemplateGetterSetter interface {
+	// GetConflictRenameTemplate returns the TemplateConflictRenamer
+	// template set for the given TLF, or "" if conflicts in the TLF
+	// use the global ConflictRenamer.
+	GetConflictRenameTemplate(tlfID tlf.ID) string
+	// SetConflictRenameTemplate validates and persists the given
+	// conflict rename template for the TLF.  An empty template
+	// restores the global ConflictRenamer.
+	SetConflictRenameTemplate(tlfID tlf.ID, text string) error
+}
+
+type diskCacheTlfSettingsGetterSetter interface {
+	// GetDiskCacheTlfSettings returns the settings that govern how
+	// the blocks of the given TLF are kept in the working set disk
+	// block cache.
+	GetDiskCacheTlfSettings(tlfID tlf.ID) DiskCacheTlfSettings
+	// SetDiskCacheTlfSettings persists the given settings for the
+	// TLF, and applies them to the blocks of the TLF that are
+	// already in the working set disk block cache.
+	SetDiskCacheTlfSettings(ctx context.Context, tlfID tlf.ID,
+		settings DiskCacheTlfSettings) error
 }
 
 type blockRetrieverGetter interface {
@@ -310,6 +364,24 @@ type KBFSOps interface {
 	// permission for the top-level folder.  This is a remote-access
 	// operation.
 	GetDirChildren(ctx context.Context, dir Node) (map[string]EntryInfo, error)
+	// GetDirChildrenPaged returns up to `maxEntries` children of the
+	// directory, if the logged-in user has read permission for the
+	// top-level folder.  The children are sorted in byte-wise order
+	// of their names, and only those with names strictly after
+	// `after` are returned; pass "" to start at the beginning, and
+	// the name of the last child of a page to get the next page.  A
+	// page with fewer than `maxEntries` children is the last one.
+	// If `maxEntries` is not positive, all remaining children are
+	// returned.  Each page reflects the state of the directory when
+	// it's fetched: no name is returned twice while paging through
+	// a directory, children added or removed after the cursor show
+	// up (or not) in later pages, and children added before the
+	// cursor are missed.  Unlike GetDirChildren, this only fetches
+	// the directory blocks needed for each page.  This is a
+	// remote-access operation.
+	GetDirChildrenPaged(
+		ctx context.Context, dir Node, after string, maxEntries int) (
+		[]DirChild, error)
 	// Lookup returns the Node and entry info associated with a
 	// given name in a directory, if the logged-in user has read
 	// permissions to the top-level folder.  The returned Node is nil
@@ -390,6 +462,23 @@ type KBFSOps interface {
 	// on whether or not the necessary blocks have been locally
 	// cached.  This is a remote-access operation.
 	Truncate(ctx context.Context, file Node, size uint64) error
+	// PunchHole deallocates the data in the range [off, off+length)
+	// of the file at the given node, if the logged-in user has write
+	// permission to the top-level folder.  The file keeps its size,
+	// and the range reads back as zeros.  As with Truncate, punching
+	// a hole in an unlinked file may or may not succeed as a no-op.
+	// This is a remote-access operation.
+	PunchHole(ctx context.Context, file Node, off, length uint64) error
+	// SeekDataOrHole returns the first offset at or after `off` in
+	// the file at the given node that holds data (if `hole` is
+	// false) or that is in a hole (if `hole` is true), like the
+	// SEEK_DATA and SEEK_HOLE whence values of lseek(2).  The end of
+	// the file counts as a hole.  It returns a NoDataAfterOffsetError
+	// if `off` is at or past the end of the file, or if only holes
+	// follow it when looking for data.  This is a remote-access
+	// operation.
+	SeekDataOrHole(ctx context.Context, file Node, off uint64, hole bool) (
+		uint64, error)
 	// SetEx turns on or off the executable bit on the file
 	// represented by a given node, if the logged-in user has write
 	// permissions to the top-level folder.  This is a remote-sync
@@ -451,6 +540,71 @@ type KBFSOps interface {
 
 	// GetNodeMetadata gets metadata associated with a Node.
 	GetNodeMetadata(ctx context.Context, node Node) (NodeMetadata, error)
+	// GetQuotaUsageBreakdown returns a "du"-style breakdown of the
+	// bytes used by the given directory and its subdirectories down
+	// to `maxDepth` levels below it, along with how much of the TLF's
+	// quota usage comes from unreclaimed blocks.  Like
+	// GetUpdateHistory, this is an expensive operation that walks
+	// the whole subtree, and should only be used occasionally.
+	GetQuotaUsageBreakdown(ctx context.Context, dir Node, maxDepth int) (
+		QuotaUsageBreakdown, error)
+	// RestoreFromRevision replaces the file or directory `node`
+	// with a copy of whatever was at the same path as of revision
+	// `rev`, including everything under it for a directory, in a
+	// single MD update.  The copy makes new references to the old
+	// blocks where possible, rather than re-uploading them.  `node`
+	// is unlinked afterward.
+	RestoreFromRevision(ctx context.Context, node Node,
+		rev kbfsmd.Revision) error
+	// GetDeletedEntries returns the entries deleted from the given
+	// folder in recent revisions that can still be undeleted, most
+	// recent first.  Deletions at or before the last revision
+	// scrubbed by quota reclamation are not included.  Entries
+	// deleted from a directory right before the directory itself
+	// are listed in its Contents instead.
+	GetDeletedEntries(ctx context.Context, folderBranch FolderBranch) (
+		[]DeletedEntry, error)
+	// UndeleteEntry restores the entry at path `p` (relative to the
+	// folder root), which was deleted by revision `rev`, from the
+	// last revision in which it was live.  A directory with deleted
+	// Contents is restored from before the first of them, along
+	// with them.  Its parent directory must currently exist, and
+	// nothing may currently exist at `p`.
+	UndeleteEntry(ctx context.Context, folderBranch FolderBranch,
+		p string, rev kbfsmd.Revision) error
+	// DiffRevisions returns every path that was created, modified,
+	// removed or renamed in the given folder between revisions
+	// `from` and `to` (so, by revisions from+1 through `to`), sorted
+	// by path.  It's computed from the ops in the MD history, but
+	// falls back to comparing the directory trees of the two
+	// revisions if that history can't be read anymore, in which case
+	// renames are only detected for entries whose contents didn't
+	// also change.
+	DiffRevisions(ctx context.Context, folderBranch FolderBranch,
+		from, to kbfsmd.Revision) ([]RevisionDiff, error)
+	// GetQuotaReclamationDryRun reports what the next quota
+	// reclamation of the given folder would delete under its
+	// current policy, without deleting anything.
+	GetQuotaReclamationDryRun(ctx context.Context,
+		folderBranch FolderBranch) (QuotaReclamationDryRun, error)
+	// SetAutoConflictResolution pauses or restarts automatic
+	// conflict resolution for the given folder, until the process
+	// exits.  While it is paused, unmerged changes (including a
+	// branch made by the journal after a conflict) stay unmerged,
+	// so they can be inspected and resolved with ResolveConflicts.
+	SetAutoConflictResolution(ctx context.Context,
+		folderBranch FolderBranch, enabled bool) error
+	// ResolveConflicts resolves the conflicts between this device's
+	// unmerged changes to the given folder and the merged branch,
+	// canceling any resolution already in progress.  For each file
+	// with conflicting contents whose path (relative to the folder
+	// root) is in `choices`, the resolution keeps only the chosen
+	// version; other conflicted entries keep both versions, as
+	// usual.  It returns a NoUnmergedBranchError if there are no
+	// unmerged changes, and an UnmergedError if the folder is still
+	// unmerged afterward.
+	ResolveConflicts(ctx context.Context, folderBranch FolderBranch,
+		choices map[string]ConflictChoice) error
 
 	// Shutdown is called to clean up any resources associated with
 	// this KBFSOps instance.
@@ -1420,6 +1574,12 @@ type Prefetcher interface {
 	ProcessBlockForPrefetch(ctx context.Context, ptr BlockPointer, block Block,
 		kmd KeyMetadata, priority int, lifetime BlockCacheLifetime,
 		prefetchStatus PrefetchStatus)
+	// ProcessBlockForSync triggers a deep sync of the subtree rooted
+	// at the given pointer, which moves every block in the subtree
+	// into the sync cache, even if its TLF isn't fully synced.
+	// `block` is only used to determine the type of the root block.
+	ProcessBlockForSync(ctx context.Context, ptr BlockPointer, block Block,
+		kmd KeyMetadata)
 	// CancelPrefetch notifies the prefetcher that a prefetch should be
 	// canceled.
 	CancelPrefetch(kbfsblock.ID)
@@ -1918,6 +2078,23 @@ type Tracer interface {
 	MaybeFinishTrace(ctx context.Context, err error)
 }
 
+// SpanExporter receives finished spans, and sends them somewhere
+// they can be viewed.
+type SpanExporter interface {
+	// ExportSpan is called once for each finished span.  It must
+	// not block on I/O.
+	ExportSpan(span SpanData)
+	// Shutdown flushes any spans not yet exported, and stops the
+	// exporter.
+	Shutdown(ctx context.Context) error
+}
+
+type spanExporterGetter interface {
+	// SpanExporter returns the exporter for finished spans, or nil
+	// if span tracing is turned off.
+	SpanExporter() SpanExporter
+}
+
 // InitMode encapsulates mode differences.
 type InitMode interface {
 	// Type returns the InitModeType of this mode.
@@ -2016,8 +2193,12 @@ type Config interface {
 	clockGetter
 	diskLimiterGetter
 	syncedTlfGetterSetter
+	diskCacheTlfSettingsGetterSetter
+	quotaReclamationTlfPolicyGetterSetter
+	conflictRenameTemplateGetterSetter
 	initModeGetter
 	Tracer
+	spanExporterGetter
 	KBFSOps() KBFSOps
 	SetKBFSOps(KBFSOps)
 	KBPKI() KBPKI
@@ -2058,8 +2239,15 @@ type Config interface {
 	SetClock(Clock)
 	ConflictRenamer() ConflictRenamer
 	SetConflictRenamer(ConflictRenamer)
+	// ConflictMergeGlobs returns the glob patterns matching the
+	// names of text files whose conflicting writes should be merged
+	// line by line when possible, rather than renamed.
+	ConflictMergeGlobs() []string
+	SetConflictMergeGlobs(globs []string)
 	UserHistory() *kbfsedits.UserHistory
 	SetUserHistory(*kbfsedits.UserHistory)
+	LockManager() LockManager
+	SetLockManager(LockManager)
 	MetadataVersion() kbfsmd.MetadataVer
 	SetMetadataVersion(kbfsmd.MetadataVer)
 	DefaultBlockType() keybase1.BlockType
@@ -2120,6 +2308,10 @@ type Config interface {
 	// SetTraceOptions set the options for tracing (via x/net/trace).
 	SetTraceOptions(enabled bool)
 
+	// SetSpanExporter sets the exporter for spans started by KBFS
+	// operations.  If nil, spans are turned off.
+	SetSpanExporter(SpanExporter)
+
 	// TLFValidDuration is the time TLFs are valid before identification needs to be redone.
 	TLFValidDuration() time.Duration
 	// SetTLFValidDuration sets TLFValidDuration.
@@ -2156,6 +2348,11 @@ type Config interface {
 	// to TLFs that are first accessed after `AddRootNodeWrapper` is
 	// called.
 	AddRootNodeWrapper(func(Node) Node)
+	// AddTlfSyncStateHandler adds a function that is called, with
+	// the TLF ID and whether the whole TLF is now synced, each time
+	// the sync config of a TLF is successfully changed by
+	// `SetTlfSyncState` or `SetTlfSyncPaths`.
+	AddTlfSyncStateHandler(func(tlfID tlf.ID, isSynced bool))
 }
 
 // NodeCache holds Nodes, and allows libkbfs to update them when
@@ -2262,6 +2459,38 @@ type crAction interface {
 	String() string
 }
 
+// LockManager hands out advisory locks on paths within a TLF, which
+// exclude both other local owners and other devices.  Each lock is
+// backed by a server-side lock ID, which is kept alive while held.
+type LockManager interface {
+	// Lock blocks until `owner` holds the lock `lockID` in the
+	// given folder branch, or until `ctx` is done.  Before it
+	// returns, all local writes are flushed and the folder is
+	// synced from the server, so the caller sees all the writes
+	// made by the previous holder.  Taking a lock that `owner`
+	// already holds is a no-op.
+	Lock(ctx context.Context, fb FolderBranch, lockID keybase1.LockID,
+		owner uint64, priority keybase1.MDPriority) error
+	// TryLock is like Lock, but returns a LockBusyError instead of
+	// waiting for another local owner, or for another device to
+	// release the server lock for more than `timeout`.  The timeout
+	// doesn't include flushing local writes first.
+	TryLock(ctx context.Context, fb FolderBranch, lockID keybase1.LockID,
+		owner uint64, priority keybase1.MDPriority,
+		timeout time.Duration) error
+	// Unlock flushes all local writes to the server, and then
+	// releases the lock held by `owner`.  It returns a
+	// LockLeaseExpiredError if `owner` lost the lock before
+	// unlocking it.
+	Unlock(ctx context.Context, fb FolderBranch, lockID keybase1.LockID,
+		owner uint64, priority keybase1.MDPriority) error
+	// QueryLock returns the local owner of the given lock, if any.
+	QueryLock(fb FolderBranch, lockID keybase1.LockID) (
+		owner uint64, held bool)
+	// Shutdown stops renewing all held locks.
+	Shutdown()
+}
+
 // RekeyQueue is a managed queue of folders needing some rekey action taken
 // upon them by the current client.
 type RekeyQueue interface {
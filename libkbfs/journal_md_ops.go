@@ -408,6 +408,10 @@ func (j journalMDOps) Put(ctx context.Context, rmd *RootMetadata,
 	defer func() {
 		j.jServer.deferLog.LazyTrace(ctx, "jMDOps: Put %s %d done (err=%v)", rmd.TlfID(), rmd.Revision(), err)
 	}()
+	ctx, span := startSpan(ctx, nil, "JournalMDOps.Put")
+	defer func() { span.Finish(err) }()
+	span.SetAttribute("tlf", rmd.TlfID())
+	span.SetAttribute("revision", rmd.Revision())
 
 	if tlfJournal, ok := j.jServer.getTLFJournal(
 		rmd.TlfID(), rmd.GetTlfHandle()); ok {
@@ -17,8 +17,10 @@ import (
 	"github.com/keybase/kbfs/kbfsblock"
 	"github.com/keybase/kbfs/kbfscrypto"
 	"github.com/keybase/kbfs/kbfsmd"
+	"github.com/keybase/kbfs/metricsutil"
 	"github.com/keybase/kbfs/tlf"
 	"github.com/pkg/errors"
+	metrics "github.com/rcrowley/go-metrics"
 	"golang.org/x/net/context"
 	"golang.org/x/sync/errgroup"
 )
@@ -928,6 +930,52 @@ func (j *JournalServer) Status(
 	}, tlfIDs
 }
 
+// byteCountsForType returns the total stored bytes, stored files and
+// unflushed bytes for all the journals of TLFs of the given type.
+func (j *JournalServer) byteCountsForType(t tlf.Type) (
+	totalStoredBytes, totalStoredFiles, totalUnflushedBytes int64) {
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	for tlfID, tlfJournal := range j.tlfJournals {
+		if tlfID.Type() != t {
+			continue
+		}
+		// Ignore errors from disabled journals, whose counts
+		// are all zero.
+		storedBytes, storedFiles, unflushedBytes, _ :=
+			tlfJournal.getByteCounts()
+		totalStoredBytes += storedBytes
+		totalStoredFiles += storedFiles
+		totalUnflushedBytes += unflushedBytes
+	}
+	return totalStoredBytes, totalStoredFiles, totalUnflushedBytes
+}
+
+// registerMetrics adds gauges for the journal byte and file counts,
+// labeled by TLF type, to the given metrics registry.
+func (j *JournalServer) registerMetrics(registry metrics.Registry) {
+	for _, t := range []tlf.Type{tlf.Private, tlf.Public, tlf.SingleTeam} {
+		t := t
+		register := func(name string, f func() int64) {
+			metricsutil.ReplaceMetric(registry, metricsutil.NameWithLabels(
+				"Journal."+name, "tlf_type", t.String()),
+				metrics.NewFunctionalGauge(f))
+		}
+		register("StoredBytes", func() int64 {
+			storedBytes, _, _ := j.byteCountsForType(t)
+			return storedBytes
+		})
+		register("StoredFiles", func() int64 {
+			_, storedFiles, _ := j.byteCountsForType(t)
+			return storedFiles
+		})
+		register("UnflushedBytes", func() int64 {
+			_, _, unflushedBytes := j.byteCountsForType(t)
+			return unflushedBytes
+		})
+	}
+}
+
 // JournalStatus returns a TLFServerStatus object for the given TLF
 // suitable for diagnostics.
 func (j *JournalServer) JournalStatus(tlfID tlf.ID) (
@@ -5,15 +5,19 @@
 package libkbfs
 
 import (
+	"bytes"
+	"encoding/json"
 	"os"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/keybase/client/go/libkb"
+	"github.com/keybase/client/go/protocol/keybase1"
 	"github.com/keybase/kbfs/ioutil"
 	"github.com/keybase/kbfs/kbfsmd"
 	"github.com/keybase/kbfs/tlf"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/net/context"
@@ -770,6 +774,461 @@ func TestBasicCRFileConflict(t *testing.T) {
 	require.Equal(t, children1, children2)
 }
 
+type conflictNotifyReporter struct {
+	*ReporterSimple
+	notifications chan *keybase1.FSNotification
+}
+
+func (r conflictNotifyReporter) Notify(
+	_ context.Context, n *keybase1.FSNotification) {
+	if _, ok := n.Params[notifyParamConflicts]; ok {
+		r.notifications <- n
+	}
+}
+
+// Tests that a per-TLF template renamer names the conflicted copy,
+// and that the resolver reports the conflicted paths.
+func TestCRTemplateConflictRenamerAndNotification(t *testing.T) {
+	var userName1, userName2 libkb.NormalizedUsername = "u1", "u2"
+	config1, _, ctx, cancel := kbfsOpsConcurInit(t, userName1, userName2)
+	defer kbfsConcurTestShutdown(t, config1, ctx, cancel)
+
+	config2 := ConfigAsUser(config1, userName2)
+	defer CheckConfigAndShutdown(ctx, t, config2)
+	reporter := conflictNotifyReporter{
+		NewReporterSimple(config2.Clock(), 10),
+		make(chan *keybase1.FSNotification, 1),
+	}
+	config2.SetReporter(reporter)
+
+	name := userName1.String() + "," + userName2.String()
+	rootNode1 := GetRootNodeOrBust(ctx, t, config1, name, tlf.Private)
+	kbfsOps1 := config1.KBFSOps()
+	fileB1, _, err := kbfsOps1.CreateFile(ctx, rootNode1, "b.txt", false, NoExcl)
+	require.NoError(t, err)
+	err = kbfsOps1.SyncAll(ctx, rootNode1.GetFolderBranch())
+	require.NoError(t, err)
+
+	rootNode2 := GetRootNodeOrBust(ctx, t, config2, name, tlf.Private)
+	kbfsOps2 := config2.KBFSOps()
+	fileB2, _, err := kbfsOps2.Lookup(ctx, rootNode2, "b.txt")
+	require.NoError(t, err)
+
+	err = config2.SetConflictRenameTemplate(rootNode2.GetFolderBranch().Tlf,
+		"{{.Base}}.{{.User}}.{{.Device}}{{.Ext}}")
+	require.NoError(t, err)
+
+	c, err := DisableUpdatesForTesting(config2, rootNode2.GetFolderBranch())
+	require.NoError(t, err)
+	err = DisableCRForTesting(config2, rootNode2.GetFolderBranch())
+	require.NoError(t, err)
+
+	err = kbfsOps1.Write(ctx, fileB1, []byte{1, 2, 3}, 0)
+	require.NoError(t, err)
+	err = kbfsOps1.SyncAll(ctx, fileB1.GetFolderBranch())
+	require.NoError(t, err)
+
+	err = kbfsOps2.Write(ctx, fileB2, []byte{3, 2, 1}, 0)
+	require.NoError(t, err)
+	err = kbfsOps2.SyncAll(ctx, fileB2.GetFolderBranch())
+	require.NoError(t, err)
+
+	c <- struct{}{}
+	err = RestartCRForTesting(
+		BackgroundContextWithCancellationDelayer(), config2,
+		rootNode2.GetFolderBranch())
+	require.NoError(t, err)
+	err = kbfsOps2.SyncFromServer(ctx, rootNode2.GetFolderBranch(), nil)
+	require.NoError(t, err)
+
+	children, err := kbfsOps2.GetDirChildren(ctx, rootNode2)
+	require.NoError(t, err)
+	require.Len(t, children, 2)
+	require.Contains(t, children, "b.u2.dev1.txt")
+
+	n := <-reporter.notifications
+	require.Equal(t, keybase1.FSNotificationType_FILE_RENAMED,
+		n.NotificationType)
+	var conflicts []crConflictedPath
+	err = json.Unmarshal([]byte(n.Params[notifyParamConflicts]), &conflicts)
+	require.NoError(t, err)
+	require.Equal(t, []crConflictedPath{{
+		Original: "/keybase/private/" + name + "/b.txt",
+		Renamed:  "/keybase/private/" + name + "/b.u2.dev1.txt",
+	}}, conflicts)
+}
+
+// Tests that non-overlapping conflicting writes to a file matching
+// the merge globs are merged by the resolution itself, in a single
+// revision, and that both devices see the merged contents.
+func TestCRMergeContentConflict(t *testing.T) {
+	var userName1, userName2 libkb.NormalizedUsername = "u1", "u2"
+	config1, _, ctx, cancel := kbfsOpsConcurInit(t, userName1, userName2)
+	defer kbfsConcurTestShutdown(t, config1, ctx, cancel)
+
+	config2 := ConfigAsUser(config1, userName2)
+	defer CheckConfigAndShutdown(ctx, t, config2)
+	config2.SetConflictMergeGlobs([]string{"*.txt"})
+
+	name := userName1.String() + "," + userName2.String()
+	rootNode1 := GetRootNodeOrBust(ctx, t, config1, name, tlf.Private)
+	kbfsOps1 := config1.KBFSOps()
+	file1, _, err := kbfsOps1.CreateFile(ctx, rootNode1, "a.txt", false, NoExcl)
+	require.NoError(t, err)
+	err = kbfsOps1.Write(ctx, file1, []byte("one\ntwo\nthree\n"), 0)
+	require.NoError(t, err)
+	fb := rootNode1.GetFolderBranch()
+	err = kbfsOps1.SyncAll(ctx, fb)
+	require.NoError(t, err)
+
+	rootNode2 := GetRootNodeOrBust(ctx, t, config2, name, tlf.Private)
+	kbfsOps2 := config2.KBFSOps()
+	file2, _, err := kbfsOps2.Lookup(ctx, rootNode2, "a.txt")
+	require.NoError(t, err)
+
+	c, err := DisableUpdatesForTesting(config2, fb)
+	require.NoError(t, err)
+	err = DisableCRForTesting(config2, fb)
+	require.NoError(t, err)
+
+	err = kbfsOps1.Write(ctx, file1, []byte("ONE\n"), 0)
+	require.NoError(t, err)
+	err = kbfsOps1.SyncAll(ctx, fb)
+	require.NoError(t, err)
+	lState := makeFBOLockState()
+	mergedRev := getOps(config1, fb.Tlf).getCurrMDRevision(lState)
+
+	err = kbfsOps2.Write(ctx, file2, []byte("THREE\nfour\n"), 8)
+	require.NoError(t, err)
+	err = kbfsOps2.SyncAll(ctx, fb)
+	require.NoError(t, err)
+
+	c <- struct{}{}
+	err = RestartCRForTesting(
+		BackgroundContextWithCancellationDelayer(), config2, fb)
+	require.NoError(t, err)
+	err = kbfsOps2.SyncFromServer(ctx, fb, nil)
+	require.NoError(t, err)
+	err = kbfsOps1.SyncFromServer(ctx, fb, nil)
+	require.NoError(t, err)
+
+	require.Equal(t, mergedRev+1,
+		getOps(config2, fb.Tlf).getCurrMDRevision(lState))
+	require.Equal(t, mergedRev+1,
+		getOps(config1, fb.Tlf).getCurrMDRevision(lState))
+	expected := []byte("ONE\ntwo\nTHREE\nfour\n")
+	for _, check := range []struct {
+		config   Config
+		rootNode Node
+		file     Node
+	}{
+		{config1, rootNode1, file1},
+		{config2, rootNode2, file2},
+	} {
+		kbfsOps := check.config.KBFSOps()
+		children, err := kbfsOps.GetDirChildren(ctx, check.rootNode)
+		require.NoError(t, err)
+		require.Len(t, children, 1)
+		require.Equal(t, uint64(len(expected)), children["a.txt"].Size)
+		buf := make([]byte, 2*len(expected))
+		n, err := kbfsOps.Read(ctx, check.file, buf, 0)
+		require.NoError(t, err)
+		require.Equal(t, expected, buf[:n])
+	}
+}
+
+// Tests that a template renamer can put conflicted copies into a
+// subdirectory, which the resolution creates the first time, and
+// reuses afterward.
+func TestCRTemplateConflictRenamerSubdirectory(t *testing.T) {
+	var userName1, userName2 libkb.NormalizedUsername = "u1", "u2"
+	config1, _, ctx, cancel := kbfsOpsConcurInit(t, userName1, userName2)
+	defer kbfsConcurTestShutdown(t, config1, ctx, cancel)
+
+	config2 := ConfigAsUser(config1, userName2)
+	defer CheckConfigAndShutdown(ctx, t, config2)
+
+	name := userName1.String() + "," + userName2.String()
+	rootNode1 := GetRootNodeOrBust(ctx, t, config1, name, tlf.Private)
+	kbfsOps1 := config1.KBFSOps()
+	fileA1, _, err := kbfsOps1.CreateFile(ctx, rootNode1, "a.txt", false, NoExcl)
+	require.NoError(t, err)
+	fileB1, _, err := kbfsOps1.CreateFile(ctx, rootNode1, "b.txt", false, NoExcl)
+	require.NoError(t, err)
+	err = kbfsOps1.SyncAll(ctx, rootNode1.GetFolderBranch())
+	require.NoError(t, err)
+
+	rootNode2 := GetRootNodeOrBust(ctx, t, config2, name, tlf.Private)
+	kbfsOps2 := config2.KBFSOps()
+	fileA2, _, err := kbfsOps2.Lookup(ctx, rootNode2, "a.txt")
+	require.NoError(t, err)
+	fileB2, _, err := kbfsOps2.Lookup(ctx, rootNode2, "b.txt")
+	require.NoError(t, err)
+
+	fb := rootNode2.GetFolderBranch()
+	err = config2.SetConflictRenameTemplate(
+		fb.Tlf, ".conflicts/{{.Base}}.{{.User}}{{.Ext}}")
+	require.NoError(t, err)
+
+	ops2 := getOps(config2, fb.Tlf)
+	lState := makeFBOLockState()
+	conflict := func(files1, files2 []Node) {
+		c, err := DisableUpdatesForTesting(config2, fb)
+		require.NoError(t, err)
+		err = DisableCRForTesting(config2, fb)
+		require.NoError(t, err)
+
+		for _, f := range files1 {
+			err = kbfsOps1.Write(ctx, f, []byte{1, 2, 3}, 0)
+			require.NoError(t, err)
+		}
+		err = kbfsOps1.SyncAll(ctx, fb)
+		require.NoError(t, err)
+		for _, f := range files2 {
+			err = kbfsOps2.Write(ctx, f, []byte{3, 2, 1}, 0)
+			require.NoError(t, err)
+		}
+		err = kbfsOps2.SyncAll(ctx, fb)
+		require.NoError(t, err)
+
+		c <- struct{}{}
+		err = RestartCRForTesting(
+			BackgroundContextWithCancellationDelayer(), config2, fb)
+		require.NoError(t, err)
+		err = kbfsOps2.SyncFromServer(ctx, fb, nil)
+		require.NoError(t, err)
+		err = kbfsOps1.SyncFromServer(ctx, fb, nil)
+		require.NoError(t, err)
+	}
+
+	checkConflicts := func(config Config, rootNode Node, names ...string) {
+		kbfsOps := config.KBFSOps()
+		children, err := kbfsOps.GetDirChildren(ctx, rootNode)
+		require.NoError(t, err)
+		require.Len(t, children, 3)
+		require.Equal(t, Dir, children[".conflicts"].Type)
+		dir, _, err := kbfsOps.Lookup(ctx, rootNode, ".conflicts")
+		require.NoError(t, err)
+		children, err = kbfsOps.GetDirChildren(ctx, dir)
+		require.NoError(t, err)
+		require.Len(t, children, len(names))
+		for _, name := range names {
+			n, _, err := kbfsOps.Lookup(ctx, dir, name)
+			require.NoError(t, err)
+			buf := make([]byte, 3)
+			_, err = kbfsOps.Read(ctx, n, buf, 0)
+			require.NoError(t, err)
+			require.Equal(t, []byte{3, 2, 1}, buf)
+		}
+	}
+
+	t.Log("The first resolution creates the subdirectory")
+	conflict([]Node{fileA1, fileB1}, []Node{fileA2, fileB2})
+	mergedRev := ops2.getCurrMDRevision(lState)
+	require.Equal(t, ops2.getLatestMergedRevision(lState), mergedRev)
+	checkConflicts(config2, rootNode2, "a.u2.txt", "b.u2.txt")
+	checkConflicts(config1, rootNode1, "a.u2.txt", "b.u2.txt")
+	buf := make([]byte, 3)
+	_, err = kbfsOps2.Read(ctx, fileA2, buf, 0)
+	require.NoError(t, err)
+	require.Equal(t, []byte{1, 2, 3}, buf)
+
+	t.Log("The next one reuses it")
+	conflict([]Node{fileA1}, []Node{fileA2})
+	require.Equal(t, mergedRev+2, ops2.getCurrMDRevision(lState))
+	checkConflicts(
+		config2, rootNode2, "a.u2.txt", "a.u2 (1).txt", "b.u2.txt")
+	checkConflicts(
+		config1, rootNode1, "a.u2.txt", "a.u2 (1).txt", "b.u2.txt")
+}
+
+// Tests that a device can manually choose which version of each
+// conflicted file to keep when resolving its unmerged branch, while
+// automatic resolution is paused.
+func TestCRResolveConflictsWithChoices(t *testing.T) {
+	var userName1, userName2 libkb.NormalizedUsername = "u1", "u2"
+	config1, _, ctx, cancel := kbfsOpsConcurInit(t, userName1, userName2)
+	defer kbfsConcurTestShutdown(t, config1, ctx, cancel)
+
+	config2 := ConfigAsUser(config1, userName2)
+	defer CheckConfigAndShutdown(ctx, t, config2)
+
+	// Make user 1's blocks small, so the merged versions of the
+	// files have child blocks that the resolution must unreference
+	// when replacing them.
+	config1.SetBlockSplitter(&BlockSplitterSimple{5, 2, 100 * 1024, 0})
+
+	name := userName1.String() + "," + userName2.String()
+	rootNode1 := GetRootNodeOrBust(ctx, t, config1, name, tlf.Private)
+	kbfsOps1 := config1.KBFSOps()
+	names := []string{"mine", "theirs", "both"}
+	files1 := make(map[string]Node)
+	for _, n := range names {
+		file1, _, err := kbfsOps1.CreateFile(
+			ctx, rootNode1, n, false, NoExcl)
+		require.NoError(t, err)
+		files1[n] = file1
+	}
+	fb := rootNode1.GetFolderBranch()
+	err := kbfsOps1.SyncAll(ctx, fb)
+	require.NoError(t, err)
+
+	rootNode2 := GetRootNodeOrBust(ctx, t, config2, name, tlf.Private)
+	kbfsOps2 := config2.KBFSOps()
+
+	t.Log("Nothing to resolve while merged.")
+	err = kbfsOps2.ResolveConflicts(ctx, fb, nil)
+	require.IsType(t, NoUnmergedBranchError{}, errors.Cause(err))
+
+	_, err = DisableUpdatesForTesting(config2, fb)
+	require.NoError(t, err)
+	err = kbfsOps2.SetAutoConflictResolution(ctx, fb, false)
+	require.NoError(t, err)
+
+	data1 := bytes.Repeat([]byte{1}, 20)
+	for _, n := range names {
+		err = kbfsOps1.Write(ctx, files1[n], data1, 0)
+		require.NoError(t, err)
+	}
+	err = kbfsOps1.SyncAll(ctx, fb)
+	require.NoError(t, err)
+	lState := makeFBOLockState()
+	mergedRev := getOps(config1, fb.Tlf).getCurrMDRevision(lState)
+
+	data2 := bytes.Repeat([]byte{2}, 12)
+	for _, n := range names {
+		file2, _, err := kbfsOps2.Lookup(ctx, rootNode2, n)
+		require.NoError(t, err)
+		err = kbfsOps2.Write(ctx, file2, data2, 0)
+		require.NoError(t, err)
+	}
+	err = kbfsOps2.SyncAll(ctx, fb)
+	require.NoError(t, err)
+
+	t.Log("With automatic resolution paused, user 2 stays unmerged.")
+	ops2 := getOps(config2, fb.Tlf)
+	err = ops2.cr.Wait(ctx)
+	require.NoError(t, err)
+	require.True(t, ops2.isUnmerged(lState))
+
+	t.Log("Resolve in the same process, with some choices.")
+	choices := map[string]ConflictChoice{
+		"mine":   ConflictChoiceMine,
+		"theirs": ConflictChoiceTheirs,
+	}
+	err = kbfsOps2.ResolveConflicts(ctx, fb, choices)
+	require.NoError(t, err)
+	require.False(t, ops2.isUnmerged(lState))
+
+	// The choices were made by the resolution itself.
+	require.Equal(t, mergedRev+1, ops2.getCurrMDRevision(lState))
+
+	// Automatic resolution is still paused.
+	require.False(t, ops2.cr.isProcessing())
+	err = kbfsOps2.SetAutoConflictResolution(ctx, fb, true)
+	require.NoError(t, err)
+	require.True(t, ops2.cr.isProcessing())
+
+	checkContents := func(config Config) {
+		rootNode := GetRootNodeOrBust(ctx, t, config, name, tlf.Private)
+		children, err := config.KBFSOps().GetDirChildren(ctx, rootNode)
+		require.NoError(t, err)
+		require.Len(t, children, 4)
+		for n, expected := range map[string][]byte{
+			"mine": data2, "theirs": data1, "both": data1} {
+			require.Equal(t, uint64(len(expected)), children[n].Size, n)
+			file, _, err := config.KBFSOps().Lookup(ctx, rootNode, n)
+			require.NoError(t, err)
+			data := make([]byte, 2*len(expected))
+			nRead, err := config.KBFSOps().Read(ctx, file, data, 0)
+			require.NoError(t, err)
+			require.Equal(t, expected, data[:nRead], n)
+		}
+	}
+	checkContents(config2)
+	err = kbfsOps1.SyncFromServer(ctx, fb, nil)
+	require.NoError(t, err)
+	checkContents(config1)
+}
+
+// Tests that manual resolution works on the branch that the journal
+// makes when its flush hits a conflict.
+func TestCRResolveConflictsOnJournalBranch(t *testing.T) {
+	var userName1, userName2 libkb.NormalizedUsername = "u1", "u2"
+	config1, _, ctx, cancel := kbfsOpsConcurInit(t, userName1, userName2)
+	defer kbfsConcurTestShutdown(t, config1, ctx, cancel)
+
+	config2 := ConfigAsUser(config1, userName2)
+	defer CheckConfigAndShutdown(ctx, t, config2)
+	tempdir, err := ioutil.TempDir(os.TempDir(), "journal_for_manual_cr")
+	require.NoError(t, err)
+	defer func() {
+		err := ioutil.RemoveAll(tempdir)
+		assert.NoError(t, err)
+	}()
+	err = config2.EnableDiskLimiter(tempdir)
+	require.NoError(t, err)
+	err = config2.EnableJournaling(
+		ctx, tempdir, TLFJournalBackgroundWorkEnabled)
+	require.NoError(t, err)
+	jServer, err := GetJournalServer(config2)
+	require.NoError(t, err)
+	jServer.EnableAuto(ctx)
+
+	name := userName1.String() + "," + userName2.String()
+	rootNode1 := GetRootNodeOrBust(ctx, t, config1, name, tlf.Private)
+	kbfsOps1 := config1.KBFSOps()
+	file1, _, err := kbfsOps1.CreateFile(ctx, rootNode1, "a", false, NoExcl)
+	require.NoError(t, err)
+	fb := rootNode1.GetFolderBranch()
+	err = kbfsOps1.SyncAll(ctx, fb)
+	require.NoError(t, err)
+
+	rootNode2 := GetRootNodeOrBust(ctx, t, config2, name, tlf.Private)
+	kbfsOps2 := config2.KBFSOps()
+	_, err = DisableUpdatesForTesting(config2, fb)
+	require.NoError(t, err)
+	err = kbfsOps2.SetAutoConflictResolution(ctx, fb, false)
+	require.NoError(t, err)
+
+	err = kbfsOps1.Write(ctx, file1, []byte{1}, 0)
+	require.NoError(t, err)
+	err = kbfsOps1.SyncAll(ctx, fb)
+	require.NoError(t, err)
+
+	t.Log("User 2's journal flush hits a conflict and makes a branch.")
+	file2, _, err := kbfsOps2.Lookup(ctx, rootNode2, "a")
+	require.NoError(t, err)
+	err = kbfsOps2.Write(ctx, file2, []byte{2}, 0)
+	require.NoError(t, err)
+	err = kbfsOps2.SyncAll(ctx, fb)
+	require.NoError(t, err)
+	err = jServer.Wait(ctx, fb.Tlf)
+	require.NoError(t, err)
+	ops2 := getOps(config2, fb.Tlf)
+	err = ops2.branchChanges.Wait(ctx)
+	require.NoError(t, err)
+	lState := makeFBOLockState()
+	require.True(t, ops2.isUnmerged(lState))
+
+	t.Log("Keep user 2's version, and flush the resolution.")
+	err = kbfsOps2.ResolveConflicts(ctx, fb,
+		map[string]ConflictChoice{"a": ConflictChoiceMine})
+	require.NoError(t, err)
+	err = jServer.Wait(ctx, fb.Tlf)
+	require.NoError(t, err)
+
+	err = kbfsOps1.SyncFromServer(ctx, fb, nil)
+	require.NoError(t, err)
+	children, err := kbfsOps1.GetDirChildren(ctx, rootNode1)
+	require.NoError(t, err)
+	require.Len(t, children, 1)
+	data := make([]byte, 2)
+	nRead, err := kbfsOps1.Read(ctx, file1, data, 0)
+	require.NoError(t, err)
+	require.Equal(t, []byte{2}, data[:nRead])
+}
+
 // Tests that two users can create the same file simultaneously, and
 // the unmerged user can write to it, and they will be merged into a
 // single file.
@@ -762,19 +762,39 @@ func (fs *KBFSOpsStandard) GetRootNode(
 
 // GetDirChildren implements the KBFSOps interface for KBFSOpsStandard
 func (fs *KBFSOpsStandard) GetDirChildren(ctx context.Context, dir Node) (
-	map[string]EntryInfo, error) {
+	children map[string]EntryInfo, err error) {
 	timeTrackerDone := fs.longOperationDebugDumper.Begin(ctx)
 	defer timeTrackerDone()
+	ctx, span := startSpan(ctx, fs.config, "KBFSOps.GetDirChildren")
+	defer func() { span.Finish(err) }()
 
 	ops := fs.getOpsByNode(ctx, dir)
 	return ops.GetDirChildren(ctx, dir)
 }
 
+// GetDirChildrenPaged implements the KBFSOps interface for
+// KBFSOpsStandard.
+func (fs *KBFSOpsStandard) GetDirChildrenPaged(
+	ctx context.Context, dir Node, after string, maxEntries int) (
+	children []DirChild, err error) {
+	timeTrackerDone := fs.longOperationDebugDumper.Begin(ctx)
+	defer timeTrackerDone()
+	ctx, span := startSpan(ctx, fs.config, "KBFSOps.GetDirChildrenPaged")
+	defer func() { span.Finish(err) }()
+	span.SetAttribute("max", maxEntries)
+
+	ops := fs.getOpsByNode(ctx, dir)
+	return ops.GetDirChildrenPaged(ctx, dir, after, maxEntries)
+}
+
 // Lookup implements the KBFSOps interface for KBFSOpsStandard
 func (fs *KBFSOpsStandard) Lookup(ctx context.Context, dir Node, name string) (
-	Node, EntryInfo, error) {
+	node Node, ei EntryInfo, err error) {
 	timeTrackerDone := fs.longOperationDebugDumper.Begin(ctx)
 	defer timeTrackerDone()
+	ctx, span := startSpan(ctx, fs.config, "KBFSOps.Lookup")
+	defer func() { span.Finish(err) }()
+	span.SetAttribute("name", name)
 
 	ops := fs.getOpsByNode(ctx, dir)
 	return ops.Lookup(ctx, dir, name)
@@ -782,9 +802,11 @@ func (fs *KBFSOpsStandard) Lookup(ctx context.Context, dir Node, name string) (
 
 // Stat implements the KBFSOps interface for KBFSOpsStandard
 func (fs *KBFSOpsStandard) Stat(ctx context.Context, node Node) (
-	EntryInfo, error) {
+	ei EntryInfo, err error) {
 	timeTrackerDone := fs.longOperationDebugDumper.Begin(ctx)
 	defer timeTrackerDone()
+	ctx, span := startSpan(ctx, fs.config, "KBFSOps.Stat")
+	defer func() { span.Finish(err) }()
 
 	ops := fs.getOpsByNode(ctx, node)
 	return ops.Stat(ctx, node)
@@ -792,9 +814,13 @@ func (fs *KBFSOpsStandard) Stat(ctx context.Context, node Node) (
 
 // CreateDir implements the KBFSOps interface for KBFSOpsStandard
 func (fs *KBFSOpsStandard) CreateDir(
-	ctx context.Context, dir Node, name string) (Node, EntryInfo, error) {
+	ctx context.Context, dir Node, name string) (
+	node Node, ei EntryInfo, err error) {
 	timeTrackerDone := fs.longOperationDebugDumper.Begin(ctx)
 	defer timeTrackerDone()
+	ctx, span := startSpan(ctx, fs.config, "KBFSOps.CreateDir")
+	defer func() { span.Finish(err) }()
+	span.SetAttribute("name", name)
 
 	ops := fs.getOpsByNode(ctx, dir)
 	return ops.CreateDir(ctx, dir, name)
@@ -803,9 +829,12 @@ func (fs *KBFSOpsStandard) CreateDir(
 // CreateFile implements the KBFSOps interface for KBFSOpsStandard
 func (fs *KBFSOpsStandard) CreateFile(
 	ctx context.Context, dir Node, name string, isExec bool, excl Excl) (
-	Node, EntryInfo, error) {
+	node Node, ei EntryInfo, err error) {
 	timeTrackerDone := fs.longOperationDebugDumper.Begin(ctx)
 	defer timeTrackerDone()
+	ctx, span := startSpan(ctx, fs.config, "KBFSOps.CreateFile")
+	defer func() { span.Finish(err) }()
+	span.SetAttribute("name", name)
 
 	ops := fs.getOpsByNode(ctx, dir)
 	return ops.CreateFile(ctx, dir, name, isExec, excl)
@@ -824,9 +853,12 @@ func (fs *KBFSOpsStandard) CreateLink(
 
 // RemoveDir implements the KBFSOps interface for KBFSOpsStandard
 func (fs *KBFSOpsStandard) RemoveDir(
-	ctx context.Context, dir Node, name string) error {
+	ctx context.Context, dir Node, name string) (err error) {
 	timeTrackerDone := fs.longOperationDebugDumper.Begin(ctx)
 	defer timeTrackerDone()
+	ctx, span := startSpan(ctx, fs.config, "KBFSOps.RemoveDir")
+	defer func() { span.Finish(err) }()
+	span.SetAttribute("name", name)
 
 	ops := fs.getOpsByNode(ctx, dir)
 	return ops.RemoveDir(ctx, dir, name)
@@ -834,9 +866,12 @@ func (fs *KBFSOpsStandard) RemoveDir(
 
 // RemoveEntry implements the KBFSOps interface for KBFSOpsStandard
 func (fs *KBFSOpsStandard) RemoveEntry(
-	ctx context.Context, dir Node, name string) error {
+	ctx context.Context, dir Node, name string) (err error) {
 	timeTrackerDone := fs.longOperationDebugDumper.Begin(ctx)
 	defer timeTrackerDone()
+	ctx, span := startSpan(ctx, fs.config, "KBFSOps.RemoveEntry")
+	defer func() { span.Finish(err) }()
+	span.SetAttribute("name", name)
 
 	ops := fs.getOpsByNode(ctx, dir)
 	return ops.RemoveEntry(ctx, dir, name)
@@ -845,9 +880,13 @@ func (fs *KBFSOpsStandard) RemoveEntry(
 // Rename implements the KBFSOps interface for KBFSOpsStandard
 func (fs *KBFSOpsStandard) Rename(
 	ctx context.Context, oldParent Node, oldName string, newParent Node,
-	newName string) error {
+	newName string) (err error) {
 	timeTrackerDone := fs.longOperationDebugDumper.Begin(ctx)
 	defer timeTrackerDone()
+	ctx, span := startSpan(ctx, fs.config, "KBFSOps.Rename")
+	defer func() { span.Finish(err) }()
+	span.SetAttribute("old_name", oldName)
+	span.SetAttribute("new_name", newName)
 
 	oldFB := oldParent.GetFolderBranch()
 	newFB := newParent.GetFolderBranch()
@@ -867,6 +906,10 @@ func (fs *KBFSOpsStandard) Read(
 	numRead int64, err error) {
 	timeTrackerDone := fs.longOperationDebugDumper.Begin(ctx)
 	defer timeTrackerDone()
+	ctx, span := startSpan(ctx, fs.config, "KBFSOps.Read")
+	defer func() { span.Finish(err) }()
+	span.SetAttribute("off", off)
+	span.SetAttribute("len", len(dest))
 
 	ops := fs.getOpsByNode(ctx, file)
 	return ops.Read(ctx, file, dest, off)
@@ -874,9 +917,13 @@ func (fs *KBFSOpsStandard) Read(
 
 // Write implements the KBFSOps interface for KBFSOpsStandard
 func (fs *KBFSOpsStandard) Write(
-	ctx context.Context, file Node, data []byte, off int64) error {
+	ctx context.Context, file Node, data []byte, off int64) (err error) {
 	timeTrackerDone := fs.longOperationDebugDumper.Begin(ctx)
 	defer timeTrackerDone()
+	ctx, span := startSpan(ctx, fs.config, "KBFSOps.Write")
+	defer func() { span.Finish(err) }()
+	span.SetAttribute("off", off)
+	span.SetAttribute("len", len(data))
 
 	ops := fs.getOpsByNode(ctx, file)
 	return ops.Write(ctx, file, data, off)
@@ -884,14 +931,46 @@ func (fs *KBFSOpsStandard) Write(
 
 // Truncate implements the KBFSOps interface for KBFSOpsStandard
 func (fs *KBFSOpsStandard) Truncate(
-	ctx context.Context, file Node, size uint64) error {
+	ctx context.Context, file Node, size uint64) (err error) {
 	timeTrackerDone := fs.longOperationDebugDumper.Begin(ctx)
 	defer timeTrackerDone()
+	ctx, span := startSpan(ctx, fs.config, "KBFSOps.Truncate")
+	defer func() { span.Finish(err) }()
+	span.SetAttribute("size", size)
 
 	ops := fs.getOpsByNode(ctx, file)
 	return ops.Truncate(ctx, file, size)
 }
 
+// PunchHole implements the KBFSOps interface for KBFSOpsStandard
+func (fs *KBFSOpsStandard) PunchHole(
+	ctx context.Context, file Node, off, length uint64) (err error) {
+	timeTrackerDone := fs.longOperationDebugDumper.Begin(ctx)
+	defer timeTrackerDone()
+	ctx, span := startSpan(ctx, fs.config, "KBFSOps.PunchHole")
+	defer func() { span.Finish(err) }()
+	span.SetAttribute("off", off)
+	span.SetAttribute("len", length)
+
+	ops := fs.getOpsByNode(ctx, file)
+	return ops.PunchHole(ctx, file, off, length)
+}
+
+// SeekDataOrHole implements the KBFSOps interface for KBFSOpsStandard
+func (fs *KBFSOpsStandard) SeekDataOrHole(
+	ctx context.Context, file Node, off uint64, hole bool) (
+	newOff uint64, err error) {
+	timeTrackerDone := fs.longOperationDebugDumper.Begin(ctx)
+	defer timeTrackerDone()
+	ctx, span := startSpan(ctx, fs.config, "KBFSOps.SeekDataOrHole")
+	defer func() { span.Finish(err) }()
+	span.SetAttribute("off", off)
+	span.SetAttribute("hole", hole)
+
+	ops := fs.getOpsByNode(ctx, file)
+	return ops.SeekDataOrHole(ctx, file, off, hole)
+}
+
 // SetEx implements the KBFSOps interface for KBFSOpsStandard
 func (fs *KBFSOpsStandard) SetEx(
 	ctx context.Context, file Node, ex bool) error {
@@ -914,9 +993,11 @@ func (fs *KBFSOpsStandard) SetMtime(
 
 // SyncAll implements the KBFSOps interface for KBFSOpsStandard
 func (fs *KBFSOpsStandard) SyncAll(
-	ctx context.Context, folderBranch FolderBranch) error {
+	ctx context.Context, folderBranch FolderBranch) (err error) {
 	timeTrackerDone := fs.longOperationDebugDumper.Begin(ctx)
 	defer timeTrackerDone()
+	ctx, span := startSpan(ctx, fs.config, "KBFSOps.SyncAll")
+	defer func() { span.Finish(err) }()
 
 	ops := fs.getOps(ctx, folderBranch, FavoritesOpAdd)
 	return ops.SyncAll(ctx, folderBranch)
@@ -933,6 +1014,98 @@ func (fs *KBFSOpsStandard) FolderStatus(
 	return ops.FolderStatus(ctx, folderBranch)
 }
 
+// RestoreFromRevision implements the KBFSOps interface for
+// KBFSOpsStandard.
+func (fs *KBFSOpsStandard) RestoreFromRevision(
+	ctx context.Context, node Node, rev kbfsmd.Revision) (err error) {
+	timeTrackerDone := fs.longOperationDebugDumper.Begin(ctx)
+	defer timeTrackerDone()
+	ctx, span := startSpan(ctx, fs.config, "KBFSOps.RestoreFromRevision")
+	defer func() { span.Finish(err) }()
+	span.SetAttribute("revision", rev)
+
+	ops := fs.getOpsByNode(ctx, node)
+	return ops.RestoreFromRevision(ctx, node, rev)
+}
+
+// GetDeletedEntries implements the KBFSOps interface for
+// KBFSOpsStandard.
+func (fs *KBFSOpsStandard) GetDeletedEntries(
+	ctx context.Context, folderBranch FolderBranch) (
+	[]DeletedEntry, error) {
+	timeTrackerDone := fs.longOperationDebugDumper.Begin(ctx)
+	defer timeTrackerDone()
+
+	ops := fs.getOps(ctx, folderBranch, FavoritesOpNoChange)
+	return ops.GetDeletedEntries(ctx, folderBranch)
+}
+
+// DiffRevisions implements the KBFSOps interface for KBFSOpsStandard.
+func (fs *KBFSOpsStandard) DiffRevisions(
+	ctx context.Context, folderBranch FolderBranch,
+	from, to kbfsmd.Revision) (diffs []RevisionDiff, err error) {
+	timeTrackerDone := fs.longOperationDebugDumper.Begin(ctx)
+	defer timeTrackerDone()
+	ctx, span := startSpan(ctx, fs.config, "KBFSOps.DiffRevisions")
+	defer func() { span.Finish(err) }()
+	span.SetAttribute("from", from)
+	span.SetAttribute("to", to)
+
+	ops := fs.getOps(ctx, folderBranch, FavoritesOpNoChange)
+	return ops.DiffRevisions(ctx, folderBranch, from, to)
+}
+
+// UndeleteEntry implements the KBFSOps interface for KBFSOpsStandard.
+func (fs *KBFSOpsStandard) UndeleteEntry(
+	ctx context.Context, folderBranch FolderBranch, p string,
+	rev kbfsmd.Revision) (err error) {
+	timeTrackerDone := fs.longOperationDebugDumper.Begin(ctx)
+	defer timeTrackerDone()
+	ctx, span := startSpan(ctx, fs.config, "KBFSOps.UndeleteEntry")
+	defer func() { span.Finish(err) }()
+	span.SetAttribute("revision", rev)
+
+	ops := fs.getOps(ctx, folderBranch, FavoritesOpNoChange)
+	return ops.UndeleteEntry(ctx, folderBranch, p, rev)
+}
+
+// GetQuotaReclamationDryRun implements the KBFSOps interface for
+// KBFSOpsStandard.
+func (fs *KBFSOpsStandard) GetQuotaReclamationDryRun(
+	ctx context.Context, folderBranch FolderBranch) (
+	QuotaReclamationDryRun, error) {
+	timeTrackerDone := fs.longOperationDebugDumper.Begin(ctx)
+	defer timeTrackerDone()
+
+	ops := fs.getOps(ctx, folderBranch, FavoritesOpNoChange)
+	return ops.GetQuotaReclamationDryRun(ctx, folderBranch)
+}
+
+// SetAutoConflictResolution implements the KBFSOps interface for
+// KBFSOpsStandard.
+func (fs *KBFSOpsStandard) SetAutoConflictResolution(
+	ctx context.Context, folderBranch FolderBranch, enabled bool) error {
+	timeTrackerDone := fs.longOperationDebugDumper.Begin(ctx)
+	defer timeTrackerDone()
+
+	ops := fs.getOps(ctx, folderBranch, FavoritesOpNoChange)
+	return ops.SetAutoConflictResolution(ctx, folderBranch, enabled)
+}
+
+// ResolveConflicts implements the KBFSOps interface for
+// KBFSOpsStandard.
+func (fs *KBFSOpsStandard) ResolveConflicts(
+	ctx context.Context, folderBranch FolderBranch,
+	choices map[string]ConflictChoice) (err error) {
+	timeTrackerDone := fs.longOperationDebugDumper.Begin(ctx)
+	defer timeTrackerDone()
+	ctx, span := startSpan(ctx, fs.config, "KBFSOps.ResolveConflicts")
+	defer func() { span.Finish(err) }()
+
+	ops := fs.getOps(ctx, folderBranch, FavoritesOpNoChange)
+	return ops.ResolveConflicts(ctx, folderBranch, choices)
+}
+
 // Status implements the KBFSOps interface for KBFSOpsStandard
 func (fs *KBFSOpsStandard) Status(ctx context.Context) (
 	KBFSStatus, <-chan StatusUpdate, error) {
@@ -1057,6 +1230,18 @@ func (fs *KBFSOpsStandard) GetNodeMetadata(ctx context.Context, node Node) (
 	return ops.GetNodeMetadata(ctx, node)
 }
 
+// GetQuotaUsageBreakdown implements the KBFSOps interface for
+// KBFSOpsStandard
+func (fs *KBFSOpsStandard) GetQuotaUsageBreakdown(
+	ctx context.Context, dir Node, maxDepth int) (
+	QuotaUsageBreakdown, error) {
+	timeTrackerDone := fs.longOperationDebugDumper.Begin(ctx)
+	defer timeTrackerDone()
+
+	ops := fs.getOpsByNode(ctx, dir)
+	return ops.GetQuotaUsageBreakdown(ctx, dir, maxDepth)
+}
+
 func (fs *KBFSOpsStandard) findTeamByID(
 	ctx context.Context, tid keybase1.TeamID) *folderBranchOps {
 	fs.opsLock.Lock()
@@ -3234,6 +3234,183 @@ func TestKBFSOpsMultiBlockSyncWithArchivedBlock(t *testing.T) {
 	}
 }
 
+func TestKBFSOpsPunchHole(t *testing.T) {
+	config, _, ctx, cancel := kbfsOpsInitNoMocks(t, "test_user")
+	defer kbfsTestShutdownNoMocks(t, config, ctx, cancel)
+
+	// Make the blocks small, with multiple levels of indirection.
+	blockSize := int64(5)
+	bsplit := &BlockSplitterSimple{blockSize, 2, 100 * 1024, 0}
+	config.SetBlockSplitter(bsplit)
+
+	rootNode := GetRootNodeOrBust(ctx, t, config, "test_user", tlf.Private)
+	kbfsOps := config.KBFSOps()
+	fileNode, _, err := kbfsOps.CreateFile(ctx, rootNode, "a", false, NoExcl)
+	require.NoError(t, err)
+
+	data := make([]byte, 40)
+	for i := range data {
+		data[i] = byte(i + 1)
+	}
+	err = kbfsOps.Write(ctx, fileNode, data, 0)
+	require.NoError(t, err)
+	err = kbfsOps.SyncAll(ctx, fileNode.GetFolderBranch())
+	require.NoError(t, err)
+	status, _, err := kbfsOps.FolderStatus(ctx, rootNode.GetFolderBranch())
+	require.NoError(t, err)
+	oldUsage := status.DiskUsage
+
+	err = kbfsOps.PunchHole(ctx, fileNode, 7, 25)
+	require.NoError(t, err)
+	for i := 7; i < 32; i++ {
+		data[i] = 0
+	}
+	err = kbfsOps.SyncAll(ctx, fileNode.GetFolderBranch())
+	require.NoError(t, err)
+	status, _, err = kbfsOps.FolderStatus(ctx, rootNode.GetFolderBranch())
+	require.NoError(t, err)
+	require.True(t, status.DiskUsage < oldUsage,
+		"Disk usage %d not smaller than %d", status.DiskUsage, oldUsage)
+
+	ei, err := kbfsOps.Stat(ctx, fileNode)
+	require.NoError(t, err)
+	require.Equal(t, uint64(len(data)), ei.Size)
+
+	// Read using a different "device", to make sure the holes
+	// were synced.
+	config2 := ConfigAsUser(config, "test_user")
+	defer CheckConfigAndShutdown(ctx, t, config2)
+	rootNode2 := GetRootNodeOrBust(ctx, t, config2, "test_user", tlf.Private)
+	kbfsOps2 := config2.KBFSOps()
+	fileNode2, _, err := kbfsOps2.Lookup(ctx, rootNode2, "a")
+	require.NoError(t, err)
+	gotData := make([]byte, len(data))
+	n, err := kbfsOps2.Read(ctx, fileNode2, gotData, 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), n)
+	require.Equal(t, data, gotData)
+
+	off, err := kbfsOps2.SeekDataOrHole(ctx, fileNode2, 0, true)
+	require.NoError(t, err)
+	require.Equal(t, uint64(7), off)
+	// The block at 30 was only partly covered, so it was zeroed in
+	// place and still counts as data.
+	off, err = kbfsOps2.SeekDataOrHole(ctx, fileNode2, 7, false)
+	require.NoError(t, err)
+	require.Equal(t, uint64(30), off)
+	off, err = kbfsOps2.SeekDataOrHole(ctx, fileNode2, 30, true)
+	require.NoError(t, err)
+	require.Equal(t, uint64(len(data)), off)
+	_, err = kbfsOps2.SeekDataOrHole(
+		ctx, fileNode2, uint64(len(data)), false)
+	require.IsType(t, NoDataAfterOffsetError{}, errors.Cause(err))
+}
+
+func TestKBFSOpsPunchHoleDirty(t *testing.T) {
+	config, _, ctx, cancel := kbfsOpsInitNoMocks(t, "test_user")
+	defer kbfsTestShutdownNoMocks(t, config, ctx, cancel)
+
+	blockSize := int64(5)
+	bsplit := &BlockSplitterSimple{blockSize, 2, 100 * 1024, 0}
+	config.SetBlockSplitter(bsplit)
+
+	rootNode := GetRootNodeOrBust(ctx, t, config, "test_user", tlf.Private)
+	kbfsOps := config.KBFSOps()
+	fileNode, _, err := kbfsOps.CreateFile(ctx, rootNode, "a", false, NoExcl)
+	require.NoError(t, err)
+
+	// Punch a hole through data that hasn't been synced yet.
+	data := make([]byte, 40)
+	for i := range data {
+		data[i] = byte(i + 1)
+	}
+	err = kbfsOps.Write(ctx, fileNode, data, 0)
+	require.NoError(t, err)
+	err = kbfsOps.PunchHole(ctx, fileNode, 5, 25)
+	require.NoError(t, err)
+	for i := 5; i < 30; i++ {
+		data[i] = 0
+	}
+
+	// The fully-covered dirty blocks were dropped, rather than
+	// zeroed, so only the data at the edges gets synced.
+	off, err := kbfsOps.SeekDataOrHole(ctx, fileNode, 5, false)
+	require.NoError(t, err)
+	require.Equal(t, uint64(30), off)
+
+	err = kbfsOps.SyncAll(ctx, fileNode.GetFolderBranch())
+	require.NoError(t, err)
+	require.False(t, config.DirtyBlockCache().IsAnyDirty(
+		rootNode.GetFolderBranch().Tlf))
+
+	config2 := ConfigAsUser(config, "test_user")
+	defer CheckConfigAndShutdown(ctx, t, config2)
+	rootNode2 := GetRootNodeOrBust(ctx, t, config2, "test_user", tlf.Private)
+	kbfsOps2 := config2.KBFSOps()
+	fileNode2, _, err := kbfsOps2.Lookup(ctx, rootNode2, "a")
+	require.NoError(t, err)
+	gotData := make([]byte, len(data))
+	n, err := kbfsOps2.Read(ctx, fileNode2, gotData, 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), n)
+	require.Equal(t, data, gotData)
+	off, err = kbfsOps2.SeekDataOrHole(ctx, fileNode2, 5, false)
+	require.NoError(t, err)
+	require.Equal(t, uint64(30), off)
+}
+
+func TestKBFSOpsGetDirChildrenPaged(t *testing.T) {
+	config, _, ctx, cancel := kbfsOpsInitNoMocks(t, "test_user")
+	defer kbfsTestShutdownNoMocks(t, config, ctx, cancel)
+
+	rootNode := GetRootNodeOrBust(ctx, t, config, "test_user", tlf.Private)
+	kbfsOps := config.KBFSOps()
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("f%d", i)
+		_, _, err := kbfsOps.CreateFile(ctx, rootNode, name, false, NoExcl)
+		require.NoError(t, err)
+	}
+	err := kbfsOps.SyncAll(ctx, rootNode.GetFolderBranch())
+	require.NoError(t, err)
+
+	// Page through from a different device.
+	config2 := ConfigAsUser(config, "test_user")
+	defer CheckConfigAndShutdown(ctx, t, config2)
+	rootNode2 := GetRootNodeOrBust(ctx, t, config2, "test_user", tlf.Private)
+	kbfsOps2 := config2.KBFSOps()
+	var got []string
+	after := ""
+	for {
+		children, err := kbfsOps2.GetDirChildrenPaged(
+			ctx, rootNode2, after, 3)
+		require.NoError(t, err)
+		for _, c := range children {
+			got = append(got, c.Name)
+			require.Equal(t, File, c.Type)
+		}
+		if len(children) < 3 {
+			break
+		}
+		after = children[len(children)-1].Name
+
+		if after == "f2" {
+			// Changes after the cursor are picked up by later
+			// pages, but those before it are not.
+			_, _, err = kbfsOps2.CreateFile(
+				ctx, rootNode2, "f0a", false, NoExcl)
+			require.NoError(t, err)
+			_, _, err = kbfsOps2.CreateFile(
+				ctx, rootNode2, "f5a", false, NoExcl)
+			require.NoError(t, err)
+			err = kbfsOps2.RemoveEntry(ctx, rootNode2, "f7")
+			require.NoError(t, err)
+		}
+	}
+	require.Equal(t, []string{
+		"f0", "f1", "f2", "f3", "f4", "f5", "f5a", "f6", "f8", "f9",
+	}, got)
+}
+
 type corruptBlockServer struct {
 	BlockServer
 }
@@ -3818,3 +3995,583 @@ func TestKBFSOpsArchiveBranchType(t *testing.T) {
 	require.Equal(t, archiveFB, rootNodeArchived.GetFolderBranch())
 	require.True(t, rootNodeArchived.Readonly(ctx))
 }
+
+func TestKBFSOpsGetQuotaUsageBreakdown(t *testing.T) {
+	var u1 libkb.NormalizedUsername = "u1"
+	config, _, ctx, cancel := kbfsOpsConcurInit(t, u1)
+	defer kbfsConcurTestShutdown(t, config, ctx, cancel)
+	clock, now := newTestClockAndTimeNow()
+	config.SetClock(clock)
+
+	t.Log("Make a tree: a/f, b/c/g.")
+	rootNode := GetRootNodeOrBust(ctx, t, config, u1.String(), tlf.Private)
+	kbfsOps := config.KBFSOps()
+	aNode, _, err := kbfsOps.CreateDir(ctx, rootNode, "a")
+	require.NoError(t, err)
+	fNode, _, err := kbfsOps.CreateFile(ctx, aNode, "f", false, NoExcl)
+	require.NoError(t, err)
+	err = kbfsOps.Write(ctx, fNode, []byte{1, 2, 3, 4, 5}, 0)
+	require.NoError(t, err)
+	bNode, _, err := kbfsOps.CreateDir(ctx, rootNode, "b")
+	require.NoError(t, err)
+	cNode, _, err := kbfsOps.CreateDir(ctx, bNode, "c")
+	require.NoError(t, err)
+	_, _, err = kbfsOps.CreateFile(ctx, cNode, "g", false, NoExcl)
+	require.NoError(t, err)
+	err = kbfsOps.SyncAll(ctx, rootNode.GetFolderBranch())
+	require.NoError(t, err)
+
+	breakdown, err := kbfsOps.GetQuotaUsageBreakdown(ctx, rootNode, 1)
+	require.NoError(t, err)
+	require.Equal(t, "/keybase/private/u1", breakdown.Name)
+	require.Len(t, breakdown.Dirs, 3)
+	root := breakdown.Dirs[0]
+	require.Equal(t, "", root.Path)
+	require.Equal(t, 2, root.NumFiles)
+	require.Equal(t, 3, root.NumDirs)
+	require.Equal(t, breakdown.LiveBytes, root.Bytes)
+	require.Equal(t, map[string]uint64{"u1": root.Bytes}, breakdown.Writers)
+	var subdirBytes uint64
+	for _, d := range breakdown.Dirs[1:] {
+		require.Contains(t, []string{"a", "b"}, d.Path)
+		subdirBytes += d.Bytes
+	}
+	require.True(t, subdirBytes < root.Bytes)
+	require.True(t, breakdown.Dirs[1].Bytes >= breakdown.Dirs[2].Bytes)
+
+	t.Log("A subdirectory breakdown only covers that subtree.")
+	bBreakdown, err := kbfsOps.GetQuotaUsageBreakdown(ctx, bNode, 5)
+	require.NoError(t, err)
+	require.Len(t, bBreakdown.Dirs, 2)
+	require.Equal(t, "c", bBreakdown.Dirs[1].Path)
+	require.Equal(t, 1, bBreakdown.Dirs[0].NumFiles)
+	require.Equal(t, 1, bBreakdown.Dirs[0].NumDirs)
+
+	t.Log("Removing a file leaves its bytes unreclaimed.")
+	unreclaimedBefore := breakdown.UnreclaimedBytes
+	err = kbfsOps.RemoveEntry(ctx, aNode, "f")
+	require.NoError(t, err)
+	err = kbfsOps.SyncAll(ctx, rootNode.GetFolderBranch())
+	require.NoError(t, err)
+	breakdown, err = kbfsOps.GetQuotaUsageBreakdown(ctx, rootNode, 0)
+	require.NoError(t, err)
+	require.Len(t, breakdown.Dirs, 1)
+	require.Equal(t, 1, breakdown.Dirs[0].NumFiles)
+	require.True(t, breakdown.UnreclaimedBytes > unreclaimedBefore)
+	require.False(t, breakdown.UnreclaimedBytesPartial)
+
+	t.Log("Capping the MD walk reports partial unreclaimed bytes.")
+	ops := kbfsOps.(*KBFSOpsStandard).getOpsByNode(ctx, rootNode)
+	ops.fbm.numMaxRevisionsPerUnreclaimed = 1
+	partial, err := kbfsOps.GetQuotaUsageBreakdown(ctx, rootNode, 0)
+	require.NoError(t, err)
+	require.True(t, partial.UnreclaimedBytesPartial)
+	require.True(t, partial.UnreclaimedBytes > 0)
+	require.True(t, partial.UnreclaimedBytes < breakdown.UnreclaimedBytes)
+	ops.fbm.numMaxRevisionsPerUnreclaimed =
+		numMaxRevisionsPerUnreclaimedDefault
+
+	t.Log("Quota reclamation clears the unreclaimed bytes.")
+	clock.Set(now.Add(2 * config.Mode().QuotaReclamationMinUnrefAge()))
+	ops.fbm.forceQuotaReclamation()
+	err = ops.fbm.waitForQuotaReclamations(ctx)
+	require.NoError(t, err)
+	err = kbfsOps.SyncFromServer(ctx, rootNode.GetFolderBranch(), nil)
+	require.NoError(t, err)
+	breakdown, err = kbfsOps.GetQuotaUsageBreakdown(ctx, rootNode, 0)
+	require.NoError(t, err)
+	require.True(t, breakdown.LastGCRevision > kbfsmd.RevisionUninitialized)
+	require.Equal(t, uint64(0), breakdown.UnreclaimedBytes)
+}
+
+func TestKBFSOpsRestoreFromRevision(t *testing.T) {
+	var u1 libkb.NormalizedUsername = "u1"
+	config, _, ctx, cancel := kbfsOpsConcurInit(t, u1)
+	defer kbfsConcurTestShutdown(t, config, ctx, cancel)
+	// Use a small block size, so some files have indirect blocks.
+	bsplitter, err := NewBlockSplitterSimple(20, 8*1024, config.Codec())
+	require.NoError(t, err)
+	config.SetBlockSplitter(bsplitter)
+
+	readFile := func(dir Node, name string) []byte {
+		n, ei, err := config.KBFSOps().Lookup(ctx, dir, name)
+		require.NoError(t, err)
+		buf := make([]byte, ei.Size)
+		nr, err := config.KBFSOps().Read(ctx, n, buf, 0)
+		require.NoError(t, err)
+		return buf[:nr]
+	}
+	headRev := func(fb FolderBranch) kbfsmd.Revision {
+		status, _, err := config.KBFSOps().FolderStatus(ctx, fb)
+		require.NoError(t, err)
+		return status.Revision
+	}
+
+	t.Log("Make a tree: a/f, a/big, a/sub/h.")
+	rootNode := GetRootNodeOrBust(ctx, t, config, u1.String(), tlf.Private)
+	fb := rootNode.GetFolderBranch()
+	kbfsOps := config.KBFSOps()
+	aNode, _, err := kbfsOps.CreateDir(ctx, rootNode, "a")
+	require.NoError(t, err)
+	fNode, _, err := kbfsOps.CreateFile(ctx, aNode, "f", false, NoExcl)
+	require.NoError(t, err)
+	err = kbfsOps.Write(ctx, fNode, []byte("old f"), 0)
+	require.NoError(t, err)
+	bigData := make([]byte, 200)
+	for i := range bigData {
+		bigData[i] = byte(i)
+	}
+	bigNode, _, err := kbfsOps.CreateFile(ctx, aNode, "big", false, NoExcl)
+	require.NoError(t, err)
+	err = kbfsOps.Write(ctx, bigNode, bigData, 0)
+	require.NoError(t, err)
+	subNode, _, err := kbfsOps.CreateDir(ctx, aNode, "sub")
+	require.NoError(t, err)
+	hNode, _, err := kbfsOps.CreateFile(ctx, subNode, "h", false, NoExcl)
+	require.NoError(t, err)
+	err = kbfsOps.Write(ctx, hNode, []byte("old h"), 0)
+	require.NoError(t, err)
+	err = kbfsOps.SyncAll(ctx, fb)
+	require.NoError(t, err)
+	oldRev := headRev(fb)
+
+	t.Log("Change f, remove sub/h and add a new file.")
+	err = kbfsOps.Truncate(ctx, fNode, 0)
+	require.NoError(t, err)
+	err = kbfsOps.Write(ctx, fNode, []byte("new f"), 0)
+	require.NoError(t, err)
+	err = kbfsOps.RemoveEntry(ctx, subNode, "h")
+	require.NoError(t, err)
+	_, _, err = kbfsOps.CreateFile(ctx, aNode, "new", false, NoExcl)
+	require.NoError(t, err)
+	err = kbfsOps.SyncAll(ctx, fb)
+	require.NoError(t, err)
+	// Make sure the unreferenced blocks are archived, so they have
+	// to be copied instead of referenced again.
+	err = kbfsOps.SyncFromServer(ctx, fb, nil)
+	require.NoError(t, err)
+
+	t.Log("Restore a single file in one revision.")
+	rev := headRev(fb)
+	err = kbfsOps.RestoreFromRevision(ctx, fNode, oldRev)
+	require.NoError(t, err)
+	require.Equal(t, rev+1, headRev(fb))
+	require.Equal(t, []byte("old f"), readFile(aNode, "f"))
+	_, _, err = kbfsOps.Lookup(ctx, aNode, "new")
+	require.NoError(t, err)
+
+	t.Log("Restore the whole directory in one revision.")
+	rev = headRev(fb)
+	err = kbfsOps.RestoreFromRevision(ctx, aNode, oldRev)
+	require.NoError(t, err)
+	require.Equal(t, rev+1, headRev(fb))
+	aNode, _, err = kbfsOps.Lookup(ctx, rootNode, "a")
+	require.NoError(t, err)
+	require.Equal(t, []byte("old f"), readFile(aNode, "f"))
+	require.Equal(t, bigData, readFile(aNode, "big"))
+	subNode, _, err = kbfsOps.Lookup(ctx, aNode, "sub")
+	require.NoError(t, err)
+	require.Equal(t, []byte("old h"), readFile(subNode, "h"))
+	_, _, err = kbfsOps.Lookup(ctx, aNode, "new")
+	require.IsType(t, NoSuchNameError{}, errors.Cause(err))
+
+	t.Log("The restored tree is readable from a fresh device.")
+	config2 := ConfigAsUser(config, u1)
+	defer CheckConfigAndShutdown(ctx, t, config2)
+	rootNode2 := GetRootNodeOrBust(ctx, t, config2, u1.String(), tlf.Private)
+	aNode2, _, err := config2.KBFSOps().Lookup(ctx, rootNode2, "a")
+	require.NoError(t, err)
+	bigNode2, _, err := config2.KBFSOps().Lookup(ctx, aNode2, "big")
+	require.NoError(t, err)
+	buf := make([]byte, len(bigData))
+	_, err = config2.KBFSOps().Read(ctx, bigNode2, buf, 0)
+	require.NoError(t, err)
+	require.Equal(t, bigData, buf)
+
+	t.Log("The root directory can't be restored.")
+	err = kbfsOps.RestoreFromRevision(ctx, rootNode, oldRev)
+	require.Error(t, err)
+
+	t.Log("Revisions that have been garbage-collected can't be " +
+		"restored from.")
+	clock, now := newTestClockAndTimeNow()
+	config.SetClock(clock)
+	clock.Set(now.Add(2 * config.Mode().QuotaReclamationMinUnrefAge()))
+	_, _, err = kbfsOps.CreateDir(ctx, rootNode, "e")
+	require.NoError(t, err)
+	err = kbfsOps.SyncAll(ctx, fb)
+	require.NoError(t, err)
+	ops := kbfsOps.(*KBFSOpsStandard).getOpsByNode(ctx, rootNode)
+	ops.fbm.forceQuotaReclamation()
+	err = ops.fbm.waitForQuotaReclamations(ctx)
+	require.NoError(t, err)
+	err = kbfsOps.SyncFromServer(ctx, fb, nil)
+	require.NoError(t, err)
+	err = kbfsOps.RestoreFromRevision(ctx, aNode, oldRev)
+	require.IsType(t, RevGarbageCollectedError{}, errors.Cause(err))
+}
+
+func TestKBFSOpsUndeleteEntry(t *testing.T) {
+	var u1 libkb.NormalizedUsername = "u1"
+	config, _, ctx, cancel := kbfsOpsInitNoMocks(t, u1)
+	defer kbfsTestShutdownNoMocks(t, config, ctx, cancel)
+	clock, now := newTestClockAndTimeNow()
+	config.SetClock(clock)
+
+	readFile := func(dir Node, name string) []byte {
+		n, ei, err := config.KBFSOps().Lookup(ctx, dir, name)
+		require.NoError(t, err)
+		buf := make([]byte, ei.Size)
+		nr, err := config.KBFSOps().Read(ctx, n, buf, 0)
+		require.NoError(t, err)
+		return buf[:nr]
+	}
+
+	t.Log("Make a tree: a/f, d/g.")
+	rootNode := GetRootNodeOrBust(ctx, t, config, u1.String(), tlf.Private)
+	fb := rootNode.GetFolderBranch()
+	kbfsOps := config.KBFSOps()
+	aNode, _, err := kbfsOps.CreateDir(ctx, rootNode, "a")
+	require.NoError(t, err)
+	fNode, _, err := kbfsOps.CreateFile(ctx, aNode, "f", false, NoExcl)
+	require.NoError(t, err)
+	err = kbfsOps.Write(ctx, fNode, []byte("f data"), 0)
+	require.NoError(t, err)
+	dNode, _, err := kbfsOps.CreateDir(ctx, rootNode, "d")
+	require.NoError(t, err)
+	gNode, _, err := kbfsOps.CreateFile(ctx, dNode, "g", false, NoExcl)
+	require.NoError(t, err)
+	err = kbfsOps.Write(ctx, gNode, []byte("g data"), 0)
+	require.NoError(t, err)
+	err = kbfsOps.SyncAll(ctx, fb)
+	require.NoError(t, err)
+
+	t.Log("Delete a/f, and then all of d in one revision.")
+	err = kbfsOps.RemoveEntry(ctx, aNode, "f")
+	require.NoError(t, err)
+	err = kbfsOps.SyncAll(ctx, fb)
+	require.NoError(t, err)
+	err = kbfsOps.RemoveEntry(ctx, dNode, "g")
+	require.NoError(t, err)
+	err = kbfsOps.RemoveDir(ctx, rootNode, "d")
+	require.NoError(t, err)
+	err = kbfsOps.SyncAll(ctx, fb)
+	require.NoError(t, err)
+	err = kbfsOps.SyncFromServer(ctx, fb, nil)
+	require.NoError(t, err)
+
+	t.Log("Only the top-level deletions are listed, most recent first.")
+	entries, err := kbfsOps.GetDeletedEntries(ctx, fb)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, "d", entries[0].Path)
+	require.Equal(t, Dir, entries[0].Type)
+	require.Equal(t, "a/f", entries[1].Path)
+	require.Equal(t, File, entries[1].Type)
+	require.Equal(t, entries[0].Revision-1, entries[1].Revision)
+	require.Equal(t, u1.String(), entries[1].Writer)
+
+	t.Log("The entries are cached as of the head revision.")
+	ops := kbfsOps.(*KBFSOpsStandard).getOpsByNode(ctx, rootNode)
+	status, _, err := kbfsOps.FolderStatus(ctx, fb)
+	require.NoError(t, err)
+	require.Equal(t, status.Revision, ops.deletedEntriesRev)
+	cached, err := kbfsOps.GetDeletedEntries(ctx, fb)
+	require.NoError(t, err)
+	require.Equal(t, entries, cached)
+
+	t.Log("Undelete both entries.")
+	err = kbfsOps.UndeleteEntry(ctx, fb, entries[0].Path, entries[0].Revision)
+	require.NoError(t, err)
+	dNode, _, err = kbfsOps.Lookup(ctx, rootNode, "d")
+	require.NoError(t, err)
+	require.Equal(t, []byte("g data"), readFile(dNode, "g"))
+	err = kbfsOps.UndeleteEntry(ctx, fb, entries[1].Path, entries[1].Revision)
+	require.NoError(t, err)
+	require.Equal(t, []byte("f data"), readFile(aNode, "f"))
+
+	t.Log("An entry that exists again can't be undeleted.")
+	err = kbfsOps.UndeleteEntry(ctx, fb, entries[1].Path, entries[1].Revision)
+	require.IsType(t, NameExistsError{}, errors.Cause(err))
+
+	t.Log("Deletions that have been reclaimed can't be undeleted.")
+	err = kbfsOps.RemoveEntry(ctx, aNode, "f")
+	require.NoError(t, err)
+	err = kbfsOps.SyncAll(ctx, fb)
+	require.NoError(t, err)
+	entries, err = kbfsOps.GetDeletedEntries(ctx, fb)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	clock.Set(now.Add(2 * config.Mode().QuotaReclamationMinUnrefAge()))
+	_, _, err = kbfsOps.CreateDir(ctx, rootNode, "e")
+	require.NoError(t, err)
+	err = kbfsOps.SyncAll(ctx, fb)
+	require.NoError(t, err)
+	ops.fbm.forceQuotaReclamation()
+	err = ops.fbm.waitForQuotaReclamations(ctx)
+	require.NoError(t, err)
+	err = kbfsOps.SyncFromServer(ctx, fb, nil)
+	require.NoError(t, err)
+	reclaimed := entries[0]
+	entries, err = kbfsOps.GetDeletedEntries(ctx, fb)
+	require.NoError(t, err)
+	require.Len(t, entries, 0)
+	err = kbfsOps.UndeleteEntry(ctx, fb, reclaimed.Path, reclaimed.Revision)
+	require.IsType(t, RevGarbageCollectedError{}, errors.Cause(err))
+}
+
+func TestKBFSOpsUndeleteRecursiveRemove(t *testing.T) {
+	var u1 libkb.NormalizedUsername = "u1"
+	config, _, ctx, cancel := kbfsOpsInitNoMocks(t, u1)
+	defer kbfsTestShutdownNoMocks(t, config, ctx, cancel)
+
+	t.Log("Make a tree: r/s/h, r/i, and an unrelated file j.")
+	rootNode := GetRootNodeOrBust(ctx, t, config, u1.String(), tlf.Private)
+	fb := rootNode.GetFolderBranch()
+	kbfsOps := config.KBFSOps()
+	rNode, _, err := kbfsOps.CreateDir(ctx, rootNode, "r")
+	require.NoError(t, err)
+	sNode, _, err := kbfsOps.CreateDir(ctx, rNode, "s")
+	require.NoError(t, err)
+	hNode, _, err := kbfsOps.CreateFile(ctx, sNode, "h", false, NoExcl)
+	require.NoError(t, err)
+	err = kbfsOps.Write(ctx, hNode, []byte("h data"), 0)
+	require.NoError(t, err)
+	_, _, err = kbfsOps.CreateFile(ctx, rNode, "i", false, NoExcl)
+	require.NoError(t, err)
+	_, _, err = kbfsOps.CreateFile(ctx, rootNode, "j", false, NoExcl)
+	require.NoError(t, err)
+	err = kbfsOps.SyncAll(ctx, fb)
+	require.NoError(t, err)
+
+	t.Log("Delete j, then remove r bottom-up, one revision at a time.")
+	remove := func(dir Node, name string, isDir bool) {
+		if isDir {
+			err = kbfsOps.RemoveDir(ctx, dir, name)
+		} else {
+			err = kbfsOps.RemoveEntry(ctx, dir, name)
+		}
+		require.NoError(t, err)
+		err = kbfsOps.SyncAll(ctx, fb)
+		require.NoError(t, err)
+	}
+	remove(rootNode, "j", false)
+	remove(sNode, "h", false)
+	remove(rNode, "s", true)
+	remove(rNode, "i", false)
+	remove(rootNode, "r", true)
+
+	t.Log("The contents of r are grouped under it, but j isn't.")
+	entries, err := kbfsOps.GetDeletedEntries(ctx, fb)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, "r", entries[0].Path)
+	require.Equal(t, "j", entries[1].Path)
+	require.Len(t, entries[0].Contents, 3)
+	var contents []string
+	for _, e := range entries[0].Contents {
+		contents = append(contents, e.Path)
+	}
+	require.Equal(t, []string{"r/i", "r/s", "r/s/h"}, contents)
+
+	t.Log("Undeleting r restores everything under it.")
+	err = kbfsOps.UndeleteEntry(ctx, fb, entries[0].Path, entries[0].Revision)
+	require.NoError(t, err)
+	rNode, _, err = kbfsOps.Lookup(ctx, rootNode, "r")
+	require.NoError(t, err)
+	_, _, err = kbfsOps.Lookup(ctx, rNode, "i")
+	require.NoError(t, err)
+	sNode, _, err = kbfsOps.Lookup(ctx, rNode, "s")
+	require.NoError(t, err)
+	hNode, ei, err := kbfsOps.Lookup(ctx, sNode, "h")
+	require.NoError(t, err)
+	buf := make([]byte, ei.Size)
+	_, err = kbfsOps.Read(ctx, hNode, buf, 0)
+	require.NoError(t, err)
+	require.Equal(t, []byte("h data"), buf)
+	_, _, err = kbfsOps.Lookup(ctx, rootNode, "j")
+	require.IsType(t, NoSuchNameError{}, errors.Cause(err))
+}
+
+func TestKBFSOpsDiffRevisions(t *testing.T) {
+	var u1 libkb.NormalizedUsername = "u1"
+	config, _, ctx, cancel := kbfsOpsInitNoMocks(t, u1)
+	defer kbfsTestShutdownNoMocks(t, config, ctx, cancel)
+	clock, now := newTestClockAndTimeNow()
+	config.SetClock(clock)
+
+	t.Log("Make a tree: a, b, d/x.")
+	rootNode := GetRootNodeOrBust(ctx, t, config, u1.String(), tlf.Private)
+	fb := rootNode.GetFolderBranch()
+	kbfsOps := config.KBFSOps()
+	aNode, _, err := kbfsOps.CreateFile(ctx, rootNode, "a", false, NoExcl)
+	require.NoError(t, err)
+	err = kbfsOps.Write(ctx, aNode, []byte("a data"), 0)
+	require.NoError(t, err)
+	_, _, err = kbfsOps.CreateFile(ctx, rootNode, "b", false, NoExcl)
+	require.NoError(t, err)
+	dNode, _, err := kbfsOps.CreateDir(ctx, rootNode, "d")
+	require.NoError(t, err)
+	_, _, err = kbfsOps.CreateFile(ctx, dNode, "x", false, NoExcl)
+	require.NoError(t, err)
+	err = kbfsOps.SyncAll(ctx, fb)
+	require.NoError(t, err)
+	status, _, err := kbfsOps.FolderStatus(ctx, fb)
+	require.NoError(t, err)
+	from := status.Revision
+
+	t.Log("Over a few revisions: modify a, remove b, rename d to e, " +
+		"create c.")
+	err = kbfsOps.Write(ctx, aNode, []byte("more a data"), 6)
+	require.NoError(t, err)
+	err = kbfsOps.SyncAll(ctx, fb)
+	require.NoError(t, err)
+	err = kbfsOps.RemoveEntry(ctx, rootNode, "b")
+	require.NoError(t, err)
+	err = kbfsOps.Rename(ctx, rootNode, "d", rootNode, "e")
+	require.NoError(t, err)
+	err = kbfsOps.SyncAll(ctx, fb)
+	require.NoError(t, err)
+	cNode, _, err := kbfsOps.CreateFile(ctx, rootNode, "c", false, NoExcl)
+	require.NoError(t, err)
+	err = kbfsOps.Write(ctx, cNode, []byte("c"), 0)
+	require.NoError(t, err)
+	err = kbfsOps.SyncAll(ctx, fb)
+	require.NoError(t, err)
+	status, _, err = kbfsOps.FolderStatus(ctx, fb)
+	require.NoError(t, err)
+	to := status.Revision
+
+	expected := []RevisionDiff{
+		{Type: RevisionDiffModified, Path: "a", EntryType: File, Size: 17},
+		{Type: RevisionDiffRemoved, Path: "b", EntryType: File},
+		{Type: RevisionDiffCreated, Path: "c", EntryType: File, Size: 1},
+		{Type: RevisionDiffRenamed, Path: "e", OldPath: "d",
+			EntryType: Dir},
+	}
+	diffs, err := kbfsOps.DiffRevisions(ctx, fb, from, to)
+	require.NoError(t, err)
+	// Directory sizes depend on the encoding, so don't check them.
+	for i := range diffs {
+		if diffs[i].EntryType == Dir {
+			diffs[i].Size = 0
+		}
+	}
+	require.Equal(t, expected, diffs)
+
+	t.Log("Comparing the trees gives the same result.")
+	fromMD, err := getSingleMD(ctx, config, fb.Tlf, kbfsmd.NullBranchID,
+		from, kbfsmd.Merged, nil)
+	require.NoError(t, err)
+	toMD, err := getSingleMD(ctx, config, fb.Tlf, kbfsmd.NullBranchID,
+		to, kbfsmd.Merged, nil)
+	require.NoError(t, err)
+	diffs, err = getOps(config, fb.Tlf).diffRevisionsFromTrees(
+		ctx, fromMD, toMD)
+	require.NoError(t, err)
+	for i := range diffs {
+		if diffs[i].EntryType == Dir {
+			diffs[i].Size = 0
+		}
+	}
+	require.Equal(t, expected, diffs)
+
+	_, err = kbfsOps.DiffRevisions(ctx, fb, to, from)
+	require.Error(t, err)
+	_, err = kbfsOps.DiffRevisions(ctx, fb, from, to+1)
+	require.Error(t, err)
+
+	t.Log("Revisions that have been reclaimed can't be diffed.")
+	clock.Set(now.Add(2 * config.Mode().QuotaReclamationMinUnrefAge()))
+	_, _, err = kbfsOps.CreateDir(ctx, rootNode, "f")
+	require.NoError(t, err)
+	err = kbfsOps.SyncAll(ctx, fb)
+	require.NoError(t, err)
+	ops := getOps(config, fb.Tlf)
+	ops.fbm.forceQuotaReclamation()
+	err = ops.fbm.waitForQuotaReclamations(ctx)
+	require.NoError(t, err)
+	err = kbfsOps.SyncFromServer(ctx, fb, nil)
+	require.NoError(t, err)
+	status, _, err = kbfsOps.FolderStatus(ctx, fb)
+	require.NoError(t, err)
+	_, err = kbfsOps.DiffRevisions(ctx, fb, from, status.Revision)
+	require.IsType(t, RevGarbageCollectedError{}, errors.Cause(err))
+}
+
+// Test that DiffRevisions falls back to comparing the trees when the
+// unembedded changes of a revision inside the range are gone.
+func TestKBFSOpsDiffRevisionsUnembeddedChanges(t *testing.T) {
+	var u1 libkb.NormalizedUsername = "u1"
+	config, _, ctx, cancel := kbfsOpsInitNoMocks(t, u1)
+	// The state checker would trip over the deleted block changes.
+	defer kbfsTestShutdownNoMocksNoCheck(t, config, ctx, cancel)
+
+	rootNode := GetRootNodeOrBust(ctx, t, config, u1.String(), tlf.Private)
+	fb := rootNode.GetFolderBranch()
+	kbfsOps := config.KBFSOps()
+	_, _, err := kbfsOps.CreateFile(ctx, rootNode, "a", false, NoExcl)
+	require.NoError(t, err)
+	bNode, _, err := kbfsOps.CreateFile(ctx, rootNode, "b", false, NoExcl)
+	require.NoError(t, err)
+	err = kbfsOps.SyncAll(ctx, fb)
+	require.NoError(t, err)
+	status, _, err := kbfsOps.FolderStatus(ctx, fb)
+	require.NoError(t, err)
+	from := status.Revision
+
+	t.Log("Rename a to c and write to b, with unembedded changes.")
+	bss := config.bsplit.(*BlockSplitterSimple)
+	oldEmbedMaxSize := bss.blockChangeEmbedMaxSize
+	bss.blockChangeEmbedMaxSize = 32
+	err = kbfsOps.Rename(ctx, rootNode, "a", rootNode, "c")
+	require.NoError(t, err)
+	err = kbfsOps.Write(ctx, bNode, []byte("b data"), 0)
+	require.NoError(t, err)
+	err = kbfsOps.SyncAll(ctx, fb)
+	require.NoError(t, err)
+	status, _, err = kbfsOps.FolderStatus(ctx, fb)
+	require.NoError(t, err)
+	unembeddedRev := status.Revision
+
+	t.Log("Create d, with embedded changes.")
+	bss.blockChangeEmbedMaxSize = oldEmbedMaxSize
+	_, _, err = kbfsOps.CreateFile(ctx, rootNode, "d", false, NoExcl)
+	require.NoError(t, err)
+	err = kbfsOps.SyncAll(ctx, fb)
+	require.NoError(t, err)
+	status, _, err = kbfsOps.FolderStatus(ctx, fb)
+	require.NoError(t, err)
+	to := status.Revision
+
+	t.Log("Delete the unembedded changes in the middle of the range, " +
+		"and drop the cached copies.")
+	md, err := getSingleMD(ctx, config, fb.Tlf, kbfsmd.NullBranchID,
+		unembeddedRev, kbfsmd.Merged, nil)
+	require.NoError(t, err)
+	ptr := md.data.cachedChanges.Info.BlockPointer
+	require.NotEqual(t, zeroPtr, ptr)
+	_, err = config.BlockServer().RemoveBlockReferences(
+		ctx, fb.Tlf, map[kbfsblock.ID][]kbfsblock.Context{
+			ptr.ID: {ptr.Context},
+		})
+	require.NoError(t, err)
+	config.ResetCaches()
+
+	diffs, err := kbfsOps.DiffRevisions(ctx, fb, from, to)
+	require.NoError(t, err)
+	require.Equal(t, []RevisionDiff{
+		{Type: RevisionDiffModified, Path: "b", EntryType: File, Size: 6},
+		{Type: RevisionDiffRenamed, Path: "c", OldPath: "a",
+			EntryType: File},
+		{Type: RevisionDiffCreated, Path: "d", EntryType: File},
+	}, diffs)
+}
+
+func TestIsReclaimedHistoryError(t *testing.T) {
+	require.True(t, isReclaimedHistoryError(
+		errors.WithStack(kbfsblock.ServerErrorBlockDeleted{})))
+	require.True(t, isReclaimedHistoryError(unembeddedChangesError{1}))
+	require.False(t, isReclaimedHistoryError(context.Canceled))
+	require.False(t, isReclaimedHistoryError(errors.New("network down")))
+}
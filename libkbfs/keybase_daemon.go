@@ -40,22 +40,46 @@ func (k keybaseDaemon) NewKeybaseService(config Config, params InitParams, ctx C
 			config, ctx, log, params.Debug, additionalProtocols), nil
 	}
 
-	users := []libkb.NormalizedUsername{
-		"strib", "max", "chris", "akalin", "jzila", "alness",
-		"jinyang", "songgao", "taru", "zanderz",
-	}
 	userIndex := -1
-	for i := range users {
-		if localUser == users[i] {
+	for i := range localModeUsers {
+		if localUser == localModeUsers[i] {
 			userIndex = i
 			break
 		}
 	}
 	if userIndex < 0 {
-		return nil, fmt.Errorf("user %s not in list %v", localUser, users)
+		return nil, fmt.Errorf(
+			"user %s not in list %v", localUser, localModeUsers)
+	}
+
+	localUsers, teams := makeLocalModeUsersAndTeams()
+	localUID := localUsers[userIndex].UID
+	codec := config.Codec()
+
+	if params.LocalFavoriteStorage == memoryAddr {
+		return NewKeybaseDaemonMemory(localUID, localUsers, teams, codec), nil
 	}
 
-	localUsers := MakeLocalUsers(users)
+	if serverRootDir, ok := parseRootDir(params.LocalFavoriteStorage); ok {
+		favPath := filepath.Join(serverRootDir, "kbfs_favs")
+		return NewKeybaseDaemonDisk(localUID, localUsers, teams, favPath, codec)
+	}
+
+	return nil, errors.New("Can't user localuser without LocalFavoriteStorage being 'memory' or 'dir:/path/to/dir'")
+}
+
+// localModeUsers are the users that can be passed to -localuser.
+var localModeUsers = []libkb.NormalizedUsername{
+	"strib", "max", "chris", "akalin", "jzila", "alness",
+	"jinyang", "songgao", "taru", "zanderz",
+}
+
+// makeLocalModeUsersAndTeams returns the fake users and teams used
+// when running with -localuser, in the same order as localModeUsers.
+// Everything is derived deterministically from the names, so that
+// separate processes agree on all the keys and team memberships.
+func makeLocalModeUsersAndTeams() ([]LocalUser, []TeamInfo) {
+	localUsers := MakeLocalUsers(localModeUsers)
 
 	// TODO: Auto-generate these, too?
 	localUsers[0].Asserts = []string{"github:strib"}
@@ -69,9 +93,6 @@ func (k keybaseDaemon) NewKeybaseService(config Config, params InitParams, ctx C
 	// No asserts for 8.
 	localUsers[9].Asserts = []string{"github:zanderz"}
 
-	localUID := localUsers[userIndex].UID
-	codec := config.Codec()
-
 	teams := MakeLocalTeams([]libkb.NormalizedUsername{"kbfs", "core", "dokan"})
 	for i := range teams {
 		teams[i].Writers = make(map[keybase1.UID]bool)
@@ -103,16 +124,7 @@ func (k keybaseDaemon) NewKeybaseService(config Config, params InitParams, ctx C
 		}
 	}
 
-	if params.LocalFavoriteStorage == memoryAddr {
-		return NewKeybaseDaemonMemory(localUID, localUsers, teams, codec), nil
-	}
-
-	if serverRootDir, ok := parseRootDir(params.LocalFavoriteStorage); ok {
-		favPath := filepath.Join(serverRootDir, "kbfs_favs")
-		return NewKeybaseDaemonDisk(localUID, localUsers, teams, favPath, codec)
-	}
-
-	return nil, errors.New("Can't user localuser without LocalFavoriteStorage being 'memory' or 'dir:/path/to/dir'")
+	return localUsers, teams
 }
 
 func (k keybaseDaemon) NewCrypto(config Config, params InitParams, ctx Context, log logger.Logger) (Crypto, error) {
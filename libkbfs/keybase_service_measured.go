@@ -31,12 +31,12 @@ type KeybaseServiceMeasured struct {
 	getCurrentMerkleRootTimer        metrics.Timer
 	verifyMerkleRootTimer            metrics.Timer
 	currentSessionTimer              metrics.Timer
-	favoriteAddTimer                 metrics.Timer
-	favoriteDeleteTimer              metrics.Timer
+	favoriteAddTimer                 tlfTypeTimers
+	favoriteDeleteTimer              tlfTypeTimers
 	favoriteListTimer                metrics.Timer
-	notifyTimer                      metrics.Timer
+	notifyTimer                      tlfTypeTimers
 	notifyPathUpdatedTimer           metrics.Timer
-	putGitMetadataTimer              metrics.Timer
+	putGitMetadataTimer              tlfTypeTimers
 }
 
 var _ KeybaseService = KeybaseServiceMeasured{}
@@ -57,12 +57,12 @@ func NewKeybaseServiceMeasured(delegate KeybaseService, r metrics.Registry) Keyb
 	getCurrentMerkleRootTimer := metrics.GetOrRegisterTimer("KeybaseService.GetCurrentMerkleRoot", r)
 	verifyMerkleRootTimer := metrics.GetOrRegisterTimer("KeybaseService.VerifyMerkleRoot", r)
 	currentSessionTimer := metrics.GetOrRegisterTimer("KeybaseService.CurrentSession", r)
-	favoriteAddTimer := metrics.GetOrRegisterTimer("KeybaseService.FavoriteAdd", r)
-	favoriteDeleteTimer := metrics.GetOrRegisterTimer("KeybaseService.FavoriteDelete", r)
+	favoriteAddTimer := newTLFTypeTimers("KeybaseService.FavoriteAdd", r)
+	favoriteDeleteTimer := newTLFTypeTimers("KeybaseService.FavoriteDelete", r)
 	favoriteListTimer := metrics.GetOrRegisterTimer("KeybaseService.FavoriteList", r)
-	notifyTimer := metrics.GetOrRegisterTimer("KeybaseService.Notify", r)
+	notifyTimer := newTLFTypeTimers("KeybaseService.Notify", r)
 	notifyPathUpdatedTimer := metrics.GetOrRegisterTimer("KeybaseService.NotifyPathUpdated", r)
-	putGitMetadataTimer := metrics.GetOrRegisterTimer(
+	putGitMetadataTimer := newTLFTypeTimers(
 		"KeybaseService.PutGitMetadata", r)
 	return KeybaseServiceMeasured{
 		delegate:                         delegate,
@@ -203,7 +203,7 @@ func (k KeybaseServiceMeasured) CurrentSession(ctx context.Context, sessionID in
 // FavoriteAdd implements the KeybaseService interface for
 // KeybaseServiceMeasured.
 func (k KeybaseServiceMeasured) FavoriteAdd(ctx context.Context, folder keybase1.Folder) (err error) {
-	k.favoriteAddTimer.Time(func() {
+	k.favoriteAddTimer.Time(tlf.TypeFromFolderType(folder.FolderType), func() {
 		err = k.delegate.FavoriteAdd(ctx, folder)
 	})
 	return err
@@ -212,7 +212,7 @@ func (k KeybaseServiceMeasured) FavoriteAdd(ctx context.Context, folder keybase1
 // FavoriteDelete implements the KeybaseService interface for
 // KeybaseServiceMeasured.
 func (k KeybaseServiceMeasured) FavoriteDelete(ctx context.Context, folder keybase1.Folder) (err error) {
-	k.favoriteDeleteTimer.Time(func() {
+	k.favoriteDeleteTimer.Time(tlf.TypeFromFolderType(folder.FolderType), func() {
 		err = k.delegate.FavoriteDelete(ctx, folder)
 	})
 	return err
@@ -230,7 +230,11 @@ func (k KeybaseServiceMeasured) FavoriteList(ctx context.Context, sessionID int)
 
 // Notify implements the KeybaseService interface for KeybaseServiceMeasured.
 func (k KeybaseServiceMeasured) Notify(ctx context.Context, notification *keybase1.FSNotification) (err error) {
-	k.notifyTimer.Time(func() {
+	tlfType := tlf.Unknown
+	if notification != nil {
+		tlfType = tlf.TypeFromFolderType(notification.FolderType)
+	}
+	k.notifyTimer.Time(tlfType, func() {
 		err = k.delegate.Notify(ctx, notification)
 	})
 	return err
@@ -250,7 +254,11 @@ func (k KeybaseServiceMeasured) NotifyPathUpdated(
 // KeybaseServiceMeasured.
 func (k KeybaseServiceMeasured) NotifySyncStatus(ctx context.Context,
 	status *keybase1.FSPathSyncStatus) (err error) {
-	k.notifyTimer.Time(func() {
+	tlfType := tlf.Unknown
+	if status != nil {
+		tlfType = tlf.TypeFromFolderType(status.FolderType)
+	}
+	k.notifyTimer.Time(tlfType, func() {
 		err = k.delegate.NotifySyncStatus(ctx, status)
 	})
 	return err
@@ -273,7 +281,7 @@ func (k KeybaseServiceMeasured) EstablishMountDir(ctx context.Context) (string,
 func (k KeybaseServiceMeasured) PutGitMetadata(
 	ctx context.Context, folder keybase1.Folder, repoID keybase1.RepoID,
 	metadata keybase1.GitLocalMetadata) (err error) {
-	k.putGitMetadataTimer.Time(func() {
+	k.putGitMetadataTimer.Time(tlf.TypeFromFolderType(folder.FolderType), func() {
 		err = k.delegate.PutGitMetadata(ctx, folder, repoID, metadata)
 	})
 	return err
@@ -0,0 +1,403 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"sync"
+	"time"
+
+	"github.com/keybase/client/go/logger"
+	"github.com/keybase/client/go/protocol/keybase1"
+	"github.com/keybase/kbfs/kbfsmd"
+	"github.com/keybase/kbfs/tlf"
+	"golang.org/x/net/context"
+)
+
+// CtxLeaseLockTagKey is the type used for unique context tags within
+// LeaseLockManager.
+type CtxLeaseLockTagKey int
+
+const (
+	// CtxLeaseLockIDKey is the type of the tag for unique operation
+	// IDs within LeaseLockManager.
+	CtxLeaseLockIDKey CtxLeaseLockTagKey = iota
+)
+
+// CtxLeaseLockOpID is the display name for the unique operation
+// lease lock ID tag.
+const CtxLeaseLockOpID = "LLID"
+
+const (
+	// lockLeaseDuration is how long a lock is held without being
+	// renewed.  It matches how long the server keeps a lock.
+	lockLeaseDuration = mdLockTimeout
+	// lockLeaseRenewInterval is how often held locks are renewed.
+	lockLeaseRenewInterval = lockLeaseDuration / 2
+	// lockLeaseCheckInterval is how often the renewal goroutine
+	// checks the configured clock to see if a renewal is due.
+	lockLeaseCheckInterval = time.Second
+)
+
+type leaseLockKey struct {
+	tlfID  tlf.ID
+	lockID keybase1.LockID
+}
+
+type leaseLock struct {
+	owner uint64
+
+	// expires is protected by LeaseLockManager.lock.
+	expires time.Time
+	// released is closed once the lock is unlocked or its lease is
+	// lost, so local waiters can try again.
+	released chan struct{}
+	// stop is closed to stop the renewal goroutine, which closes
+	// renewDone when it exits.
+	stop      chan struct{}
+	stopOnce  sync.Once
+	renewDone chan struct{}
+}
+
+func (l *leaseLock) stopRenewing() {
+	l.stopOnce.Do(func() { close(l.stop) })
+}
+
+// LeaseLockManager implements the LockManager interface, by holding
+// server-side locks and renewing them in the background until they
+// are unlocked.
+type LeaseLockManager struct {
+	config Config
+	log    logger.Logger
+
+	lock   sync.Mutex
+	leases map[leaseLockKey]*leaseLock
+}
+
+var _ LockManager = (*LeaseLockManager)(nil)
+
+// NewLeaseLockManager constructs a new LeaseLockManager.
+func NewLeaseLockManager(config Config) *LeaseLockManager {
+	return &LeaseLockManager{
+		config: config,
+		log:    config.MakeLogger("LLM"),
+		leases: make(map[leaseLockKey]*leaseLock),
+	}
+}
+
+func (m *LeaseLockManager) ctxWithLeaseLockID(
+	ctx context.Context) context.Context {
+	return CtxWithRandomIDReplayable(
+		ctx, CtxLeaseLockIDKey, CtxLeaseLockOpID, m.log)
+}
+
+// reserve waits until no other local owner holds the given lock, and
+// then reserves it for `owner`.  It returns nil if `owner` already
+// holds the lock.  If `wait` is false, it returns a LockBusyError
+// instead of waiting.
+func (m *LeaseLockManager) reserve(ctx context.Context, key leaseLockKey,
+	owner uint64, wait bool) (*leaseLock, error) {
+	for {
+		m.lock.Lock()
+		l, ok := m.leases[key]
+		if !ok {
+			l = &leaseLock{
+				owner:     owner,
+				released:  make(chan struct{}),
+				stop:      make(chan struct{}),
+				renewDone: make(chan struct{}),
+			}
+			m.leases[key] = l
+			m.lock.Unlock()
+			return l, nil
+		} else if l.owner == owner {
+			m.lock.Unlock()
+			return nil, nil
+		}
+		released := l.released
+		m.lock.Unlock()
+		if !wait {
+			return nil, LockBusyError{key.lockID}
+		}
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// endLease removes `l`, if it is still the current lease for `key`,
+// and lets any local waiters try again.
+func (m *LeaseLockManager) endLease(key leaseLockKey, l *leaseLock) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.leases[key] != l {
+		return
+	}
+	delete(m.leases, key)
+	close(l.released)
+}
+
+// Lock implements the LockManager interface for LeaseLockManager.
+func (m *LeaseLockManager) Lock(ctx context.Context, fb FolderBranch,
+	lockID keybase1.LockID, owner uint64,
+	priority keybase1.MDPriority) error {
+	return m.takeLock(ctx, fb, lockID, owner, priority, 0)
+}
+
+// TryLock implements the LockManager interface for LeaseLockManager.
+func (m *LeaseLockManager) TryLock(ctx context.Context, fb FolderBranch,
+	lockID keybase1.LockID, owner uint64, priority keybase1.MDPriority,
+	timeout time.Duration) error {
+	return m.takeLock(ctx, fb, lockID, owner, priority, timeout)
+}
+
+// takeLock takes the given lock for `owner`.  If `tryTimeout` is
+// non-zero, it doesn't wait for other local owners, and gives up on
+// the server lock after `tryTimeout`, returning a LockBusyError in
+// either case.
+func (m *LeaseLockManager) takeLock(ctx context.Context, fb FolderBranch,
+	lockID keybase1.LockID, owner uint64, priority keybase1.MDPriority,
+	tryTimeout time.Duration) (err error) {
+	key := leaseLockKey{fb.Tlf, lockID}
+	l, err := m.reserve(ctx, key, owner, tryTimeout == 0)
+	if err != nil {
+		return err
+	}
+	if l == nil {
+		// Already held by this owner.
+		return nil
+	}
+	defer func() {
+		if err != nil {
+			close(l.renewDone)
+			m.endLease(key, l)
+		}
+	}()
+
+	m.log.CDebugf(ctx, "Taking lock %d in %s for owner %d",
+		lockID, fb.Tlf, owner)
+
+	// First, sync all and ask journal to flush all existing writes.
+	err = m.config.KBFSOps().SyncAll(ctx, fb)
+	if err != nil {
+		return err
+	}
+	if jServer, err := GetJournalServer(m.config); err == nil {
+		err = jServer.FinishSingleOp(ctx, fb.Tlf, nil, priority)
+		if err != nil {
+			return err
+		}
+	}
+
+	if tryTimeout != 0 {
+		// Only bound the server lock attempt, and not the flush
+		// above, since the server keeps retrying while another
+		// device holds the lock.
+		err = m.tryServerLock(ctx, fb.Tlf, lockID, tryTimeout)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Now, sync up with the server, while making sure a lock is held
+	// by us. If lock taking fails, RPC layer retries automatically.
+	err = m.config.KBFSOps().SyncFromServer(ctx, fb, &lockID)
+	if err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	l.expires = m.config.Clock().Now().Add(lockLeaseDuration)
+	m.lock.Unlock()
+	go m.renewLoop(fb.Tlf, key, l)
+	return nil
+}
+
+// tryServerLock takes the server lock, returning a LockBusyError if
+// it can't within `timeout`.
+func (m *LeaseLockManager) tryServerLock(ctx context.Context,
+	tlfID tlf.ID, lockID keybase1.LockID, timeout time.Duration) error {
+	tryCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := m.config.MDServer().Lock(tryCtx, tlfID, lockID)
+	if err == nil || tryCtx.Err() != context.DeadlineExceeded ||
+		ctx.Err() != nil {
+		return err
+	}
+	// The server may have granted the lock just as the attempt was
+	// canceled, so make sure this session doesn't keep it.
+	if err := m.config.MDServer().ReleaseLock(ctx, tlfID, lockID); err != nil {
+		m.log.CDebugf(ctx, "Couldn't release lock %d in %s: %+v",
+			lockID, tlfID, err)
+	}
+	return LockBusyError{lockID}
+}
+
+// renew extends the lease of `l`, returning false if it has already
+// expired, or if the server lock couldn't be taken again.
+func (m *LeaseLockManager) renew(
+	ctx context.Context, tlfID tlf.ID, lockID keybase1.LockID,
+	l *leaseLock) bool {
+	m.lock.Lock()
+	expired := !m.config.Clock().Now().Before(l.expires)
+	m.lock.Unlock()
+	if expired {
+		m.log.CDebugf(ctx, "Lease on lock %d in %s expired", lockID, tlfID)
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, lockLeaseRenewInterval)
+	defer cancel()
+	err := m.config.MDServer().Lock(ctx, tlfID, lockID)
+	if err != nil {
+		m.log.CDebugf(ctx, "Couldn't renew lock %d in %s: %+v",
+			lockID, tlfID, err)
+		return false
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	l.expires = m.config.Clock().Now().Add(lockLeaseDuration)
+	return true
+}
+
+// renewDue returns true if the lease of `l` should be renewed,
+// according to the configured clock.
+func (m *LeaseLockManager) renewDue(l *leaseLock) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	renewAt := l.expires.Add(lockLeaseRenewInterval - lockLeaseDuration)
+	return !m.config.Clock().Now().Before(renewAt)
+}
+
+func (m *LeaseLockManager) renewLoop(
+	tlfID tlf.ID, key leaseLockKey, l *leaseLock) {
+	defer close(l.renewDone)
+	ctx := m.ctxWithLeaseLockID(context.Background())
+	// Check often, rather than sleeping for the whole renew
+	// interval, so that the lease follows `config.Clock()`.
+	ticker := time.NewTicker(lockLeaseCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if !m.renewDue(l) {
+				continue
+			}
+			if !m.renew(ctx, tlfID, key.lockID, l) {
+				// Let the owner find out on unlock that it lost the
+				// lock in the meantime.
+				m.endLease(key, l)
+				return
+			}
+		case <-l.stop:
+			return
+		}
+	}
+}
+
+// Unlock implements the LockManager interface for LeaseLockManager.
+func (m *LeaseLockManager) Unlock(ctx context.Context, fb FolderBranch,
+	lockID keybase1.LockID, owner uint64,
+	priority keybase1.MDPriority) (err error) {
+	key := leaseLockKey{fb.Tlf, lockID}
+	m.lock.Lock()
+	l, ok := m.leases[key]
+	if !ok || l.owner != owner {
+		m.lock.Unlock()
+		return LockLeaseExpiredError{lockID}
+	}
+	m.lock.Unlock()
+
+	// Stop renewing before releasing the server lock, so a renewal
+	// doesn't take it again.
+	l.stopRenewing()
+	<-l.renewDone
+	defer m.endLease(key, l)
+
+	m.lock.Lock()
+	expired := !m.config.Clock().Now().Before(l.expires)
+	m.lock.Unlock()
+
+	m.log.CDebugf(ctx, "Releasing lock %d in %s for owner %d",
+		lockID, fb.Tlf, owner)
+	err = m.release(ctx, fb, lockID, priority)
+	if err != nil {
+		return err
+	}
+	if expired {
+		return LockLeaseExpiredError{lockID}
+	}
+	return nil
+}
+
+func (m *LeaseLockManager) release(ctx context.Context, fb FolderBranch,
+	lockID keybase1.LockID, priority keybase1.MDPriority) error {
+	err := m.config.KBFSOps().SyncAll(ctx, fb)
+	if err != nil {
+		return err
+	}
+	jServer, err := GetJournalServer(m.config)
+	if err != nil {
+		// Without a journal, all writes have already made it to
+		// the server.
+		return m.config.MDServer().ReleaseLock(ctx, fb.Tlf, lockID)
+	}
+	jStatus, _ := jServer.JournalStatus(fb.Tlf)
+	if jStatus.RevisionStart == kbfsmd.RevisionUninitialized {
+		// Journal MDs are all flushed and we haven't made any more writes.
+		// Calling FinishSingleOp won't make it to the server, so we make a
+		// naked request to server just to release the lock.
+		return m.config.MDServer().ReleaseLock(ctx, fb.Tlf, lockID)
+	}
+
+	if m.config.Mode().Type() == InitSingleOp {
+		return jServer.FinishSingleOp(ctx, fb.Tlf, &keybase1.LockContext{
+			RequireLockID:       lockID,
+			ReleaseAfterSuccess: true,
+		}, priority)
+	}
+
+	err = jServer.WaitForCompleteFlush(ctx, fb.Tlf)
+	if err != nil {
+		return err
+	}
+
+	// Need to explicitly release the lock from the server. If
+	// single-op mode isn't enabled, then the journal will be flushing
+	// on its own without waiting for the call to `FinishSingleOp`.
+	// That means the journal can already be completely flushed by the
+	// time `FinishSingleOp` is called, and it will be a no-op. It
+	// won't have made any call to the server to release the lock, so
+	// we have to do it explicitly here.
+	return m.config.MDServer().ReleaseLock(ctx, fb.Tlf, lockID)
+}
+
+// QueryLock implements the LockManager interface for LeaseLockManager.
+func (m *LeaseLockManager) QueryLock(
+	fb FolderBranch, lockID keybase1.LockID) (owner uint64, held bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	l, ok := m.leases[leaseLockKey{fb.Tlf, lockID}]
+	if !ok {
+		return 0, false
+	}
+	return l.owner, true
+}
+
+// Shutdown implements the LockManager interface for LeaseLockManager.
+func (m *LeaseLockManager) Shutdown() {
+	m.lock.Lock()
+	leases := m.leases
+	m.leases = make(map[leaseLockKey]*leaseLock)
+	m.lock.Unlock()
+
+	for _, l := range leases {
+		l.stopRenewing()
+		close(l.released)
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/keybase/client/go/libkb"
+	"github.com/keybase/client/go/protocol/keybase1"
+	"github.com/keybase/kbfs/tlf"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func leaseLockTestInit(t *testing.T) (
+	config1, config2 *ConfigLocal, rootNode1, rootNode2 Node,
+	ctx context.Context, shutdown func()) {
+	var userName1, userName2 libkb.NormalizedUsername = "u1", "u2"
+	config1, _, ctx, cancel := kbfsOpsConcurInit(t, userName1, userName2)
+	config2 = ConfigAsUser(config1, userName2)
+	shutdown = func() {
+		CheckConfigAndShutdown(ctx, t, config2)
+		kbfsConcurTestShutdown(t, config1, ctx, cancel)
+	}
+
+	name := userName1.String() + "," + userName2.String()
+	rootNode1 = GetRootNodeOrBust(ctx, t, config1, name, tlf.Private)
+	rootNode2 = GetRootNodeOrBust(ctx, t, config2, name, tlf.Private)
+	return config1, config2, rootNode1, rootNode2, ctx, shutdown
+}
+
+func TestLeaseLockManagerExcludesOtherDevices(t *testing.T) {
+	config1, config2, rootNode1, rootNode2, ctx, shutdown :=
+		leaseLockTestInit(t)
+	defer shutdown()
+	fb := rootNode1.GetFolderBranch()
+
+	lockID := keybase1.LockIDFromBytes([]byte("/keybase/private/a"))
+	err := config1.LockManager().Lock(
+		ctx, fb, lockID, 1, keybase1.MDPriorityNormal)
+	require.NoError(t, err)
+
+	// Write a file while holding the lock.
+	_, _, err = config1.KBFSOps().CreateFile(
+		ctx, rootNode1, "a", false, NoExcl)
+	require.NoError(t, err)
+
+	// The other device can't take the lock while it's held.
+	timeoutCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	err = config2.LockManager().Lock(
+		timeoutCtx, fb, lockID, 1, keybase1.MDPriorityNormal)
+	require.Equal(t, context.DeadlineExceeded, err)
+	_, held := config2.LockManager().QueryLock(fb, lockID)
+	require.False(t, held)
+
+	err = config1.LockManager().Unlock(
+		ctx, fb, lockID, 1, keybase1.MDPriorityNormal)
+	require.NoError(t, err)
+
+	// Once it's unlocked, the other device gets the lock, and sees
+	// the write made under it.
+	err = config2.LockManager().Lock(
+		ctx, fb, lockID, 1, keybase1.MDPriorityNormal)
+	require.NoError(t, err)
+	_, _, err = config2.KBFSOps().Lookup(ctx, rootNode2, "a")
+	require.NoError(t, err)
+	err = config2.LockManager().Unlock(
+		ctx, fb, lockID, 1, keybase1.MDPriorityNormal)
+	require.NoError(t, err)
+}
+
+func TestLeaseLockManagerExcludesLocalOwners(t *testing.T) {
+	config1, _, rootNode1, _, ctx, shutdown := leaseLockTestInit(t)
+	defer shutdown()
+	fb := rootNode1.GetFolderBranch()
+
+	lm := config1.LockManager()
+	lockID := keybase1.LockIDFromBytes([]byte("/keybase/private/a"))
+	err := lm.Lock(ctx, fb, lockID, 1, keybase1.MDPriorityNormal)
+	require.NoError(t, err)
+	// Taking it again is a no-op.
+	err = lm.Lock(ctx, fb, lockID, 1, keybase1.MDPriorityNormal)
+	require.NoError(t, err)
+	owner, held := lm.QueryLock(fb, lockID)
+	require.True(t, held)
+	require.Equal(t, uint64(1), owner)
+
+	// Another owner on the same device has to wait.
+	locked := make(chan error, 1)
+	go func() {
+		locked <- lm.Lock(ctx, fb, lockID, 2, keybase1.MDPriorityNormal)
+	}()
+	select {
+	case err := <-locked:
+		t.Fatalf("Second owner got the lock while it was held: %+v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// And can't unlock it.
+	err = lm.Unlock(ctx, fb, lockID, 2, keybase1.MDPriorityNormal)
+	require.IsType(t, LockLeaseExpiredError{}, err)
+
+	err = lm.Unlock(ctx, fb, lockID, 1, keybase1.MDPriorityNormal)
+	require.NoError(t, err)
+	select {
+	case err := <-locked:
+		require.NoError(t, err)
+	case <-ctx.Done():
+		t.Fatal(ctx.Err())
+	}
+	owner, held = lm.QueryLock(fb, lockID)
+	require.True(t, held)
+	require.Equal(t, uint64(2), owner)
+	err = lm.Unlock(ctx, fb, lockID, 2, keybase1.MDPriorityNormal)
+	require.NoError(t, err)
+	_, held = lm.QueryLock(fb, lockID)
+	require.False(t, held)
+}
+
+func TestLeaseLockManagerTryLock(t *testing.T) {
+	config1, config2, rootNode1, _, ctx, shutdown := leaseLockTestInit(t)
+	defer shutdown()
+	fb := rootNode1.GetFolderBranch()
+
+	lockID := keybase1.LockIDFromBytes([]byte("/keybase/private/a"))
+	lm := config1.LockManager()
+	err := lm.TryLock(
+		ctx, fb, lockID, 1, keybase1.MDPriorityNormal, time.Second)
+	require.NoError(t, err)
+
+	// Another local owner doesn't wait.
+	err = lm.TryLock(
+		ctx, fb, lockID, 2, keybase1.MDPriorityNormal, time.Second)
+	require.Equal(t, LockBusyError{lockID}, err)
+
+	// Neither does another device, past the timeout.
+	err = config2.LockManager().TryLock(
+		ctx, fb, lockID, 1, keybase1.MDPriorityNormal,
+		100*time.Millisecond)
+	require.Equal(t, LockBusyError{lockID}, err)
+	_, held := config2.LockManager().QueryLock(fb, lockID)
+	require.False(t, held)
+
+	err = lm.Unlock(ctx, fb, lockID, 1, keybase1.MDPriorityNormal)
+	require.NoError(t, err)
+	err = config2.LockManager().TryLock(
+		ctx, fb, lockID, 1, keybase1.MDPriorityNormal, time.Second)
+	require.NoError(t, err)
+	err = config2.LockManager().Unlock(
+		ctx, fb, lockID, 1, keybase1.MDPriorityNormal)
+	require.NoError(t, err)
+}
+
+func TestLeaseLockManagerRenewAndExpire(t *testing.T) {
+	config1, config2, rootNode1, _, ctx, shutdown := leaseLockTestInit(t)
+	defer shutdown()
+	fb := rootNode1.GetFolderBranch()
+
+	clock := newTestClockNow()
+	config1.SetClock(clock)
+	config2.SetClock(clock)
+
+	lm := config1.LockManager().(*LeaseLockManager)
+	lockID := keybase1.LockIDFromBytes([]byte("/keybase/private/a"))
+	err := lm.Lock(ctx, fb, lockID, 1, keybase1.MDPriorityNormal)
+	require.NoError(t, err)
+
+	// Renewing before the lease runs out keeps the lock for longer
+	// than the original lease.
+	key := leaseLockKey{fb.Tlf, lockID}
+	lm.lock.Lock()
+	l := lm.leases[key]
+	lm.lock.Unlock()
+	clock.Add(lockLeaseRenewInterval)
+	require.True(t, lm.renew(ctx, fb.Tlf, lockID, l))
+	clock.Add(lockLeaseRenewInterval + time.Second)
+	err = lm.Unlock(ctx, fb, lockID, 1, keybase1.MDPriorityNormal)
+	require.NoError(t, err)
+
+	// Without renewal, the lease runs out and another device can
+	// take the lock.
+	err = lm.Lock(ctx, fb, lockID, 1, keybase1.MDPriorityNormal)
+	require.NoError(t, err)
+	clock.Add(lockLeaseDuration + time.Second)
+	err = config2.LockManager().Lock(
+		ctx, fb, lockID, 1, keybase1.MDPriorityNormal)
+	require.NoError(t, err)
+	err = lm.Unlock(ctx, fb, lockID, 1, keybase1.MDPriorityNormal)
+	require.IsType(t, LockLeaseExpiredError{}, err)
+	err = config2.LockManager().Unlock(
+		ctx, fb, lockID, 1, keybase1.MDPriorityNormal)
+	require.NoError(t, err)
+}
+
+func TestLeaseLockManagerRenewsByClock(t *testing.T) {
+	config1, _, rootNode1, _, ctx, shutdown := leaseLockTestInit(t)
+	defer shutdown()
+	fb := rootNode1.GetFolderBranch()
+
+	clock := newTestClockNow()
+	config1.SetClock(clock)
+
+	lm := config1.LockManager().(*LeaseLockManager)
+	lockID := keybase1.LockIDFromBytes([]byte("/keybase/private/a"))
+	err := lm.Lock(ctx, fb, lockID, 1, keybase1.MDPriorityNormal)
+	require.NoError(t, err)
+
+	key := leaseLockKey{fb.Tlf, lockID}
+	getExpires := func() time.Time {
+		lm.lock.Lock()
+		defer lm.lock.Unlock()
+		return lm.leases[key].expires
+	}
+	expires := getExpires()
+
+	// Once the configured clock reaches the renew interval, the
+	// background goroutine renews the lease.
+	clock.Add(lockLeaseRenewInterval)
+	deadline := time.Now().Add(10 * lockLeaseCheckInterval)
+	for !getExpires().After(expires) {
+		require.True(t, time.Now().Before(deadline),
+			"Lease wasn't renewed in the background")
+		time.Sleep(lockLeaseCheckInterval / 10)
+	}
+
+	err = lm.Unlock(ctx, fb, lockID, 1, keybase1.MDPriorityNormal)
+	require.NoError(t, err)
+}
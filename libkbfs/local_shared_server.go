@@ -0,0 +1,923 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"io"
+	"net"
+	"path/filepath"
+	"sync"
+
+	"github.com/keybase/client/go/libkb"
+	"github.com/keybase/client/go/logger"
+	"github.com/keybase/client/go/protocol/keybase1"
+	"github.com/keybase/go-framed-msgpack-rpc/rpc"
+	"github.com/keybase/kbfs/kbfsblock"
+	"github.com/keybase/kbfs/kbfscodec"
+	"github.com/keybase/kbfs/kbfscrypto"
+	"github.com/keybase/kbfs/kbfsmd"
+	kbgitkbfs "github.com/keybase/kbfs/protocol/kbgitkbfs1"
+	"github.com/keybase/kbfs/tlf"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// LocalSharedServer serves one set of local MD, key and block
+// servers over a socket, so that several KBFS processes (e.g., two
+// kbfsfuse instances running with different -localuser values) can
+// share the same backing store.  Each connection gets its own copy
+// of the local MD and key servers, the same way ConfigAsUser shares
+// them between configs within a single process.
+//
+// The server trusts whatever session the client claims to have, so
+// it must only ever be used for testing.
+type LocalSharedServer struct {
+	config        Config
+	log           logger.Logger
+	rpcLogFactory rpc.LogFactory
+	mdServer      mdServerLocal
+	keyServer     *KeyServerLocal
+	bServer       blockServerLocal
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+	// wg tracks the listen loop and all connection handlers.
+	wg sync.WaitGroup
+}
+
+func newLocalSharedServer(
+	config Config, rpcLogFactory rpc.LogFactory, mdServer mdServerLocal,
+	keyServer *KeyServerLocal, bServer blockServerLocal) *LocalSharedServer {
+	return &LocalSharedServer{
+		config:        config,
+		log:           config.MakeLogger("LSS"),
+		rpcLogFactory: rpcLogFactory,
+		mdServer:      mdServer,
+		keyServer:     keyServer,
+		bServer:       bServer,
+		stopCh:        make(chan struct{}),
+	}
+}
+
+// makeLocalSharedServerConfig makes a config that knows about all the
+// -localuser users and teams, for use by the shared server when
+// checking signatures and team memberships.
+func makeLocalSharedServerConfig(
+	kbCtx Context, loggerFn func(module string) logger.Logger) *ConfigLocal {
+	config := NewConfigLocal(NewInitModeFromType(InitDefault), loggerFn, "",
+		DiskCacheModeOff, kbCtx)
+	localUsers, teams := makeLocalModeUsersAndTeams()
+	// The server doesn't act as any particular user, so just pick
+	// the first one for the daemon and crypto.
+	config.SetKeybaseService(NewKeybaseDaemonMemory(
+		localUsers[0].UID, localUsers, teams, config.Codec()))
+	config.SetKBPKI(NewKBPKIClient(config, config.MakeLogger("")))
+	signingKey := MakeLocalUserSigningKeyOrBust(localModeUsers[0])
+	cryptPrivateKey := MakeLocalUserCryptPrivateKeyOrBust(localModeUsers[0])
+	config.SetCrypto(
+		NewCryptoLocal(config.Codec(), signingKey, cryptPrivateKey))
+	return config
+}
+
+// NewLocalSharedServer makes a new LocalSharedServer.  If
+// serverRootDir is empty, all data is kept in memory; otherwise it is
+// stored in the same layout used by `-mdserver=dir:` and
+// `-bserver=dir:`, so an existing on-disk test store can be shared.
+func NewLocalSharedServer(
+	kbCtx Context, serverRootDir string,
+	loggerFn func(module string) logger.Logger) (*LocalSharedServer, error) {
+	config := makeLocalSharedServerConfig(kbCtx, loggerFn)
+	mdConfig := mdServerLocalConfigAdapter{config}
+
+	var mdServer mdServerLocal
+	var keyServer *KeyServerLocal
+	var bServer blockServerLocal
+	var err error
+	if serverRootDir == "" {
+		mdServer, err = NewMDServerMemory(mdConfig)
+		if err != nil {
+			return nil, err
+		}
+		keyServer, err = NewKeyServerMemory(config)
+		if err != nil {
+			return nil, err
+		}
+		bServer = NewBlockServerMemory(config.MakeLogger("BSM"))
+	} else {
+		mdServer, err = NewMDServerDir(
+			mdConfig, filepath.Join(serverRootDir, "kbfs_md"))
+		if err != nil {
+			return nil, err
+		}
+		keyServer, err = NewKeyServerDir(
+			config, filepath.Join(serverRootDir, "kbfs_key"))
+		if err != nil {
+			return nil, err
+		}
+		bServer = NewBlockServerDir(config.Codec(),
+			config.MakeLogger("BSD"),
+			filepath.Join(serverRootDir, "kbfs_block"))
+	}
+
+	return newLocalSharedServer(
+		config, kbCtx.NewRPCLogFactory(), mdServer, keyServer, bServer), nil
+}
+
+// Serve starts accepting connections on the given listener, in the
+// background.
+func (s *LocalSharedServer) Serve(l net.Listener) {
+	s.wg.Add(1)
+	go s.listenLoop(l)
+}
+
+func (s *LocalSharedServer) listenLoop(l net.Listener) {
+	defer s.wg.Done()
+	go func() {
+		<-s.stopCh
+		l.Close()
+	}()
+	defer l.Close()
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			if libkb.IsSocketClosedError(err) {
+				err = nil
+			}
+			s.log.Debug("listenLoop() done, error: %+v", err)
+			return
+		}
+		s.wg.Add(1)
+		go s.handle(c)
+	}
+}
+
+// handle serves a single client connection until it goes away.
+func (s *LocalSharedServer) handle(c net.Conn) {
+	defer s.wg.Done()
+	xp := rpc.NewTransport(c, s.rpcLogFactory, libkb.WrapError)
+	server := rpc.NewServer(xp, libkb.WrapError)
+
+	handler := newLocalSharedServerHandler(s)
+	defer handler.shutdown()
+	err := server.Register(kbgitkbfs.LocalServerProtocol(handler))
+	if err != nil {
+		s.log.Warning("Register error: %+v", err)
+		c.Close()
+		return
+	}
+
+	serverCh := server.Run()
+	go func() {
+		select {
+		case <-s.stopCh:
+		case <-serverCh:
+		}
+		// Close is idempotent, so always close when we're done.
+		c.Close()
+	}()
+	<-serverCh
+
+	// err is always non-nil.
+	err = server.Err()
+	if err != io.EOF {
+		s.log.Debug("Connection from %s ended: %+v", c.RemoteAddr(), err)
+	}
+}
+
+// Shutdown stops accepting connections, closes all existing ones,
+// and shuts down the underlying servers.
+func (s *LocalSharedServer) Shutdown() {
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+		s.wg.Wait()
+		s.mdServer.Shutdown()
+		s.keyServer.Shutdown()
+		s.bServer.Shutdown(context.Background())
+	})
+}
+
+// localSharedServerKBPKI reports a fixed current session, and
+// otherwise delegates to the server's own KBPKI.
+type localSharedServerKBPKI struct {
+	KBPKI
+	session SessionInfo
+}
+
+// GetCurrentSession implements the KBPKI interface for
+// localSharedServerKBPKI.
+func (k localSharedServerKBPKI) GetCurrentSession(ctx context.Context) (
+	SessionInfo, error) {
+	return k.session, nil
+}
+
+// localSharedServerSessionConfig is the server config as seen by a
+// single connected client.
+type localSharedServerSessionConfig struct {
+	Config
+	kbpki localSharedServerKBPKI
+}
+
+// KBPKI implements the Config interface for
+// localSharedServerSessionConfig.
+func (c localSharedServerSessionConfig) KBPKI() KBPKI {
+	return c.kbpki
+}
+
+// CurrentSessionGetter implements the Config interface for
+// localSharedServerSessionConfig.
+func (c localSharedServerSessionConfig) CurrentSessionGetter() CurrentSessionGetter {
+	return c.kbpki
+}
+
+type localSharedServerUpdateWait struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// localSharedServerHandler serves the LocalServer protocol for a
+// single client connection.
+type localSharedServerHandler struct {
+	server *LocalSharedServer
+
+	lock        sync.Mutex
+	mdServer    mdServerLocal
+	keyServer   *KeyServerLocal
+	updateWaits map[tlf.ID]localSharedServerUpdateWait
+}
+
+var _ kbgitkbfs.LocalServerInterface = (*localSharedServerHandler)(nil)
+
+func newLocalSharedServerHandler(
+	server *LocalSharedServer) *localSharedServerHandler {
+	return &localSharedServerHandler{
+		server:      server,
+		updateWaits: make(map[tlf.ID]localSharedServerUpdateWait),
+	}
+}
+
+func (h *localSharedServerHandler) shutdown() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for _, w := range h.updateWaits {
+		w.cancel()
+	}
+}
+
+func (h *localSharedServerHandler) codec() kbfscodec.Codec {
+	return h.server.config.Codec()
+}
+
+func (h *localSharedServerHandler) getServers() (
+	mdServerLocal, *KeyServerLocal, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.mdServer == nil {
+		return nil, nil, errors.New("Hello must be called first")
+	}
+	return h.mdServer, h.keyServer, nil
+}
+
+func (h *localSharedServerHandler) getMDServer() (mdServerLocal, error) {
+	mdServer, _, err := h.getServers()
+	return mdServer, err
+}
+
+// Hello implements the LocalServerInterface interface for
+// localSharedServerHandler.
+func (h *localSharedServerHandler) Hello(
+	ctx context.Context, session []byte) error {
+	var si SessionInfo
+	err := h.codec().Decode(session, &si)
+	if err != nil {
+		return err
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.mdServer != nil {
+		return errors.New("Hello already called on this connection")
+	}
+	h.server.log.CDebugf(ctx, "New connection for user %s (%s)",
+		si.Name, si.VerifyingKey.KID())
+	config := localSharedServerSessionConfig{
+		Config: h.server.config,
+		kbpki: localSharedServerKBPKI{
+			KBPKI:   h.server.config.KBPKI(),
+			session: si,
+		},
+	}
+	h.mdServer = h.server.mdServer.copy(mdServerLocalConfigAdapter{config})
+	h.keyServer = h.server.keyServer.copy(config)
+	return nil
+}
+
+func (h *localSharedServerHandler) encodeMD(rmds *RootMetadataSigned) (
+	*kbgitkbfs.LocalServerMDBlock, error) {
+	if rmds == nil {
+		return nil, nil
+	}
+	buf, err := kbfsmd.EncodeRootMetadataSigned(
+		h.codec(), &rmds.RootMetadataSigned)
+	if err != nil {
+		return nil, err
+	}
+	return &kbgitkbfs.LocalServerMDBlock{
+		Version:   int(rmds.Version()),
+		Block:     buf,
+		Timestamp: keybase1.ToTime(rmds.untrustedServerTimestamp),
+	}, nil
+}
+
+func localSharedMergeStatus(unmerged bool) kbfsmd.MergeStatus {
+	if unmerged {
+		return kbfsmd.Unmerged
+	}
+	return kbfsmd.Merged
+}
+
+// GetMDForHandle implements the LocalServerInterface interface for
+// localSharedServerHandler.
+func (h *localSharedServerHandler) GetMDForHandle(
+	ctx context.Context, arg kbgitkbfs.GetMDForHandleArg) (
+	res kbgitkbfs.GetMDForHandleRes, err error) {
+	mdServer, err := h.getMDServer()
+	if err != nil {
+		return res, err
+	}
+	var handle tlf.Handle
+	err = h.codec().Decode(arg.Handle, &handle)
+	if err != nil {
+		return res, err
+	}
+	id, rmds, err := mdServer.GetForHandle(
+		ctx, handle, localSharedMergeStatus(arg.Unmerged), arg.LockBeforeGet)
+	if err != nil {
+		return res, err
+	}
+	res.TlfID = id.Bytes()
+	res.Md, err = h.encodeMD(rmds)
+	return res, err
+}
+
+// GetMDForTLF implements the LocalServerInterface interface for
+// localSharedServerHandler.
+func (h *localSharedServerHandler) GetMDForTLF(
+	ctx context.Context, arg kbgitkbfs.GetMDForTLFArg) (
+	*kbgitkbfs.LocalServerMDBlock, error) {
+	mdServer, err := h.getMDServer()
+	if err != nil {
+		return nil, err
+	}
+	var id tlf.ID
+	err = id.UnmarshalBinary(arg.TlfID)
+	if err != nil {
+		return nil, err
+	}
+	var bid kbfsmd.BranchID
+	err = bid.UnmarshalBinary(arg.BranchID)
+	if err != nil {
+		return nil, err
+	}
+	rmds, err := mdServer.GetForTLF(ctx, id, bid,
+		localSharedMergeStatus(arg.Unmerged), arg.LockBeforeGet)
+	if err != nil {
+		return nil, err
+	}
+	return h.encodeMD(rmds)
+}
+
+// GetMDForTLFByTime implements the LocalServerInterface interface for
+// localSharedServerHandler.
+func (h *localSharedServerHandler) GetMDForTLFByTime(
+	ctx context.Context, arg kbgitkbfs.GetMDForTLFByTimeArg) (
+	*kbgitkbfs.LocalServerMDBlock, error) {
+	mdServer, err := h.getMDServer()
+	if err != nil {
+		return nil, err
+	}
+	var id tlf.ID
+	err = id.UnmarshalBinary(arg.TlfID)
+	if err != nil {
+		return nil, err
+	}
+	rmds, err := mdServer.GetForTLFByTime(
+		ctx, id, keybase1.FromTime(arg.ServerTime))
+	if err != nil {
+		return nil, err
+	}
+	return h.encodeMD(rmds)
+}
+
+// GetMDRange implements the LocalServerInterface interface for
+// localSharedServerHandler.
+func (h *localSharedServerHandler) GetMDRange(
+	ctx context.Context, arg kbgitkbfs.GetMDRangeArg) (
+	[]kbgitkbfs.LocalServerMDBlock, error) {
+	mdServer, err := h.getMDServer()
+	if err != nil {
+		return nil, err
+	}
+	var id tlf.ID
+	err = id.UnmarshalBinary(arg.TlfID)
+	if err != nil {
+		return nil, err
+	}
+	var bid kbfsmd.BranchID
+	err = bid.UnmarshalBinary(arg.BranchID)
+	if err != nil {
+		return nil, err
+	}
+	rmdses, err := mdServer.GetRange(ctx, id, bid,
+		localSharedMergeStatus(arg.Unmerged), kbfsmd.Revision(arg.Start),
+		kbfsmd.Revision(arg.Stop), arg.LockBeforeGet)
+	if err != nil {
+		return nil, err
+	}
+	blocks := make([]kbgitkbfs.LocalServerMDBlock, 0, len(rmdses))
+	for _, rmds := range rmdses {
+		block, err := h.encodeMD(rmds)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, *block)
+	}
+	return blocks, nil
+}
+
+// PutMD implements the LocalServerInterface interface for
+// localSharedServerHandler.
+func (h *localSharedServerHandler) PutMD(
+	ctx context.Context, arg kbgitkbfs.PutMDArg) error {
+	mdServer, err := h.getMDServer()
+	if err != nil {
+		return err
+	}
+	rmds, err := DecodeRootMetadataSigned(
+		h.codec(), tlf.NullID, kbfsmd.MetadataVer(arg.Md.Version),
+		kbfsmd.ImplicitTeamsVer, arg.Md.Block,
+		keybase1.FromTime(arg.Md.Timestamp))
+	if err != nil {
+		return err
+	}
+
+	var extra kbfsmd.ExtraMetadata
+	if len(arg.WriterKeyBundle) > 0 || len(arg.ReaderKeyBundle) > 0 {
+		var wkb kbfsmd.TLFWriterKeyBundleV3
+		err = h.codec().Decode(arg.WriterKeyBundle, &wkb)
+		if err != nil {
+			return err
+		}
+		var rkb kbfsmd.TLFReaderKeyBundleV3
+		err = h.codec().Decode(arg.ReaderKeyBundle, &rkb)
+		if err != nil {
+			return err
+		}
+		extra = kbfsmd.NewExtraMetadataV3(
+			wkb, rkb, arg.WriterKeyBundleNew, arg.ReaderKeyBundleNew)
+	}
+
+	return mdServer.Put(ctx, rmds, extra, arg.LockContext, arg.Priority)
+}
+
+// Lock implements the LocalServerInterface interface for
+// localSharedServerHandler.
+func (h *localSharedServerHandler) Lock(
+	ctx context.Context, arg kbgitkbfs.LockArg) error {
+	mdServer, err := h.getMDServer()
+	if err != nil {
+		return err
+	}
+	var id tlf.ID
+	err = id.UnmarshalBinary(arg.TlfID)
+	if err != nil {
+		return err
+	}
+	return mdServer.Lock(ctx, id, arg.LockID)
+}
+
+// ReleaseLock implements the LocalServerInterface interface for
+// localSharedServerHandler.
+func (h *localSharedServerHandler) ReleaseLock(
+	ctx context.Context, arg kbgitkbfs.ReleaseLockArg) error {
+	mdServer, err := h.getMDServer()
+	if err != nil {
+		return err
+	}
+	var id tlf.ID
+	err = id.UnmarshalBinary(arg.TlfID)
+	if err != nil {
+		return err
+	}
+	return mdServer.ReleaseLock(ctx, id, arg.LockID)
+}
+
+// StartImplicitTeamMigration implements the LocalServerInterface
+// interface for localSharedServerHandler.
+func (h *localSharedServerHandler) StartImplicitTeamMigration(
+	ctx context.Context, tlfID []byte) error {
+	mdServer, err := h.getMDServer()
+	if err != nil {
+		return err
+	}
+	var id tlf.ID
+	err = id.UnmarshalBinary(tlfID)
+	if err != nil {
+		return err
+	}
+	return mdServer.StartImplicitTeamMigration(ctx, id)
+}
+
+// PruneBranch implements the LocalServerInterface interface for
+// localSharedServerHandler.
+func (h *localSharedServerHandler) PruneBranch(
+	ctx context.Context, arg kbgitkbfs.PruneBranchArg) error {
+	mdServer, err := h.getMDServer()
+	if err != nil {
+		return err
+	}
+	var id tlf.ID
+	err = id.UnmarshalBinary(arg.TlfID)
+	if err != nil {
+		return err
+	}
+	var bid kbfsmd.BranchID
+	err = bid.UnmarshalBinary(arg.BranchID)
+	if err != nil {
+		return err
+	}
+	return mdServer.PruneBranch(ctx, id, bid)
+}
+
+// WaitForMDUpdate implements the LocalServerInterface interface for
+// localSharedServerHandler.
+func (h *localSharedServerHandler) WaitForMDUpdate(
+	ctx context.Context, arg kbgitkbfs.WaitForMDUpdateArg) error {
+	mdServer, err := h.getMDServer()
+	if err != nil {
+		return err
+	}
+	var id tlf.ID
+	err = id.UnmarshalBinary(arg.TlfID)
+	if err != nil {
+		return err
+	}
+
+	// The local MD servers panic on a double registration, so make
+	// sure any previous wait for this TLF on this connection (e.g.,
+	// one whose client-side context was canceled, but whose
+	// cancellation hasn't been processed yet) is completely done
+	// before registering again.
+	h.lock.Lock()
+	for {
+		w, ok := h.updateWaits[id]
+		if !ok {
+			break
+		}
+		w.cancel()
+		h.lock.Unlock()
+		<-w.done
+		h.lock.Lock()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	w := localSharedServerUpdateWait{cancel, make(chan struct{})}
+	h.updateWaits[id] = w
+	h.lock.Unlock()
+	defer func() {
+		h.lock.Lock()
+		defer h.lock.Unlock()
+		delete(h.updateWaits, id)
+		close(w.done)
+	}()
+
+	c, err := mdServer.RegisterForUpdate(
+		ctx, id, kbfsmd.Revision(arg.CurrHead))
+	if err != nil {
+		return err
+	}
+	select {
+	case err := <-c:
+		return err
+	case <-ctx.Done():
+		mdServer.CancelRegistration(ctx, id)
+		return ctx.Err()
+	}
+}
+
+// TruncateLock implements the LocalServerInterface interface for
+// localSharedServerHandler.
+func (h *localSharedServerHandler) TruncateLock(
+	ctx context.Context, tlfID []byte) (bool, error) {
+	mdServer, err := h.getMDServer()
+	if err != nil {
+		return false, err
+	}
+	var id tlf.ID
+	err = id.UnmarshalBinary(tlfID)
+	if err != nil {
+		return false, err
+	}
+	return mdServer.TruncateLock(ctx, id)
+}
+
+// TruncateUnlock implements the LocalServerInterface interface for
+// localSharedServerHandler.
+func (h *localSharedServerHandler) TruncateUnlock(
+	ctx context.Context, tlfID []byte) (bool, error) {
+	mdServer, err := h.getMDServer()
+	if err != nil {
+		return false, err
+	}
+	var id tlf.ID
+	err = id.UnmarshalBinary(tlfID)
+	if err != nil {
+		return false, err
+	}
+	return mdServer.TruncateUnlock(ctx, id)
+}
+
+// GetLatestHandleForTLF implements the LocalServerInterface interface
+// for localSharedServerHandler.
+func (h *localSharedServerHandler) GetLatestHandleForTLF(
+	ctx context.Context, tlfID []byte) ([]byte, error) {
+	mdServer, err := h.getMDServer()
+	if err != nil {
+		return nil, err
+	}
+	var id tlf.ID
+	err = id.UnmarshalBinary(tlfID)
+	if err != nil {
+		return nil, err
+	}
+	handle, err := mdServer.GetLatestHandleForTLF(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return h.codec().Encode(handle)
+}
+
+// GetKeyBundles implements the LocalServerInterface interface for
+// localSharedServerHandler.
+func (h *localSharedServerHandler) GetKeyBundles(
+	ctx context.Context, arg kbgitkbfs.GetKeyBundlesArg) (
+	res kbgitkbfs.GetKeyBundlesRes, err error) {
+	mdServer, err := h.getMDServer()
+	if err != nil {
+		return res, err
+	}
+	var id tlf.ID
+	err = id.UnmarshalBinary(arg.TlfID)
+	if err != nil {
+		return res, err
+	}
+	var wkbID kbfsmd.TLFWriterKeyBundleID
+	if len(arg.WriterKeyBundleID) > 0 {
+		wkbID, err = kbfsmd.TLFWriterKeyBundleIDFromBytes(
+			arg.WriterKeyBundleID)
+		if err != nil {
+			return res, err
+		}
+	}
+	var rkbID kbfsmd.TLFReaderKeyBundleID
+	if len(arg.ReaderKeyBundleID) > 0 {
+		rkbID, err = kbfsmd.TLFReaderKeyBundleIDFromBytes(
+			arg.ReaderKeyBundleID)
+		if err != nil {
+			return res, err
+		}
+	}
+	wkb, rkb, err := mdServer.GetKeyBundles(ctx, id, wkbID, rkbID)
+	if err != nil {
+		return res, err
+	}
+	if wkb != nil {
+		res.WriterKeyBundle, err = h.codec().Encode(wkb)
+		if err != nil {
+			return res, err
+		}
+	}
+	if rkb != nil {
+		res.ReaderKeyBundle, err = h.codec().Encode(rkb)
+		if err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// GetMerkleRootLatest implements the LocalServerInterface interface
+// for localSharedServerHandler.
+func (h *localSharedServerHandler) GetMerkleRootLatest(
+	ctx context.Context, treeID keybase1.MerkleTreeID) ([]byte, error) {
+	mdServer, err := h.getMDServer()
+	if err != nil {
+		return nil, err
+	}
+	root, err := mdServer.GetMerkleRootLatest(ctx, treeID)
+	if err != nil {
+		return nil, err
+	}
+	if root == nil {
+		return nil, nil
+	}
+	return h.codec().Encode(root)
+}
+
+// GetTLFCryptKeyServerHalf implements the LocalServerInterface
+// interface for localSharedServerHandler.
+func (h *localSharedServerHandler) GetTLFCryptKeyServerHalf(
+	ctx context.Context, arg kbgitkbfs.GetTLFCryptKeyServerHalfArg) (
+	[]byte, error) {
+	_, keyServer, err := h.getServers()
+	if err != nil {
+		return nil, err
+	}
+	var serverHalfID kbfscrypto.TLFCryptKeyServerHalfID
+	err = h.codec().Decode(arg.ServerHalfID, &serverHalfID)
+	if err != nil {
+		return nil, err
+	}
+	var key kbfscrypto.CryptPublicKey
+	err = h.codec().Decode(arg.CryptPublicKey, &key)
+	if err != nil {
+		return nil, err
+	}
+	serverHalf, err := keyServer.GetTLFCryptKeyServerHalf(
+		ctx, serverHalfID, key)
+	if err != nil {
+		return nil, err
+	}
+	return h.codec().Encode(serverHalf)
+}
+
+// PutTLFCryptKeyServerHalves implements the LocalServerInterface
+// interface for localSharedServerHandler.
+func (h *localSharedServerHandler) PutTLFCryptKeyServerHalves(
+	ctx context.Context, serverHalves []byte) error {
+	_, keyServer, err := h.getServers()
+	if err != nil {
+		return err
+	}
+	var halves kbfsmd.UserDeviceKeyServerHalves
+	err = h.codec().Decode(serverHalves, &halves)
+	if err != nil {
+		return err
+	}
+	return keyServer.PutTLFCryptKeyServerHalves(ctx, halves)
+}
+
+// DeleteTLFCryptKeyServerHalf implements the LocalServerInterface
+// interface for localSharedServerHandler.
+func (h *localSharedServerHandler) DeleteTLFCryptKeyServerHalf(
+	ctx context.Context, arg kbgitkbfs.DeleteTLFCryptKeyServerHalfArg) error {
+	_, keyServer, err := h.getServers()
+	if err != nil {
+		return err
+	}
+	var key kbfscrypto.CryptPublicKey
+	err = h.codec().Decode(arg.CryptPublicKey, &key)
+	if err != nil {
+		return err
+	}
+	var serverHalfID kbfscrypto.TLFCryptKeyServerHalfID
+	err = h.codec().Decode(arg.ServerHalfID, &serverHalfID)
+	if err != nil {
+		return err
+	}
+	return keyServer.DeleteTLFCryptKeyServerHalf(
+		ctx, arg.Uid, key, serverHalfID)
+}
+
+func (h *localSharedServerHandler) decodeBlockArgs(
+	tlfIDBytes, blockIDBytes, contextBytes []byte) (
+	tlfID tlf.ID, id kbfsblock.ID, context kbfsblock.Context, err error) {
+	err = tlfID.UnmarshalBinary(tlfIDBytes)
+	if err != nil {
+		return tlf.ID{}, kbfsblock.ID{}, kbfsblock.Context{}, err
+	}
+	err = id.UnmarshalBinary(blockIDBytes)
+	if err != nil {
+		return tlf.ID{}, kbfsblock.ID{}, kbfsblock.Context{}, err
+	}
+	err = h.codec().Decode(contextBytes, &context)
+	if err != nil {
+		return tlf.ID{}, kbfsblock.ID{}, kbfsblock.Context{}, err
+	}
+	return tlfID, id, context, nil
+}
+
+// GetBlockFromServer implements the LocalServerInterface interface
+// for localSharedServerHandler.
+func (h *localSharedServerHandler) GetBlockFromServer(
+	ctx context.Context, arg kbgitkbfs.GetBlockFromServerArg) (
+	res kbgitkbfs.GetBlockFromServerRes, err error) {
+	tlfID, id, context, err := h.decodeBlockArgs(
+		arg.TlfID, arg.BlockID, arg.BlockContext)
+	if err != nil {
+		return res, err
+	}
+	buf, serverHalf, err := h.server.bServer.Get(ctx, tlfID, id, context)
+	if err != nil {
+		return res, err
+	}
+	res.Buf = buf
+	res.ServerHalf = serverHalf.Bytes()
+	return res, nil
+}
+
+// PutBlockToServer implements the LocalServerInterface interface for
+// localSharedServerHandler.
+func (h *localSharedServerHandler) PutBlockToServer(
+	ctx context.Context, arg kbgitkbfs.PutBlockToServerArg) error {
+	tlfID, id, context, err := h.decodeBlockArgs(
+		arg.TlfID, arg.BlockID, arg.BlockContext)
+	if err != nil {
+		return err
+	}
+	var serverHalf kbfscrypto.BlockCryptKeyServerHalf
+	err = serverHalf.UnmarshalBinary(arg.ServerHalf)
+	if err != nil {
+		return err
+	}
+	if arg.Again {
+		return h.server.bServer.PutAgain(
+			ctx, tlfID, id, context, arg.Buf, serverHalf)
+	}
+	return h.server.bServer.Put(ctx, tlfID, id, context, arg.Buf, serverHalf)
+}
+
+// AddBlockReference implements the LocalServerInterface interface
+// for localSharedServerHandler.
+func (h *localSharedServerHandler) AddBlockReference(
+	ctx context.Context, arg kbgitkbfs.AddBlockReferenceArg) error {
+	tlfID, id, context, err := h.decodeBlockArgs(
+		arg.TlfID, arg.BlockID, arg.BlockContext)
+	if err != nil {
+		return err
+	}
+	return h.server.bServer.AddBlockReference(ctx, tlfID, id, context)
+}
+
+// RemoveBlockReferences implements the LocalServerInterface interface
+// for localSharedServerHandler.
+func (h *localSharedServerHandler) RemoveBlockReferences(
+	ctx context.Context, arg kbgitkbfs.RemoveBlockReferencesArg) (
+	[]byte, error) {
+	var tlfID tlf.ID
+	err := tlfID.UnmarshalBinary(arg.TlfID)
+	if err != nil {
+		return nil, err
+	}
+	var contexts kbfsblock.ContextMap
+	err = h.codec().Decode(arg.Contexts, &contexts)
+	if err != nil {
+		return nil, err
+	}
+	liveCounts, err := h.server.bServer.RemoveBlockReferences(
+		ctx, tlfID, contexts)
+	if err != nil {
+		return nil, err
+	}
+	return h.codec().Encode(liveCounts)
+}
+
+// ArchiveBlockReferences implements the LocalServerInterface
+// interface for localSharedServerHandler.
+func (h *localSharedServerHandler) ArchiveBlockReferences(
+	ctx context.Context, arg kbgitkbfs.ArchiveBlockReferencesArg) error {
+	var tlfID tlf.ID
+	err := tlfID.UnmarshalBinary(arg.TlfID)
+	if err != nil {
+		return err
+	}
+	var contexts kbfsblock.ContextMap
+	err = h.codec().Decode(arg.Contexts, &contexts)
+	if err != nil {
+		return err
+	}
+	return h.server.bServer.ArchiveBlockReferences(ctx, tlfID, contexts)
+}
+
+// GetUserQuotaInfo implements the LocalServerInterface interface for
+// localSharedServerHandler.
+func (h *localSharedServerHandler) GetUserQuotaInfo(
+	ctx context.Context) ([]byte, error) {
+	info, err := h.server.bServer.GetUserQuotaInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.codec().Encode(info)
+}
+
+// GetTeamQuotaInfo implements the LocalServerInterface interface for
+// localSharedServerHandler.
+func (h *localSharedServerHandler) GetTeamQuotaInfo(
+	ctx context.Context, tid keybase1.TeamID) ([]byte, error) {
+	info, err := h.server.bServer.GetTeamQuotaInfo(ctx, tid)
+	if err != nil {
+		return nil, err
+	}
+	return h.codec().Encode(info)
+}
@@ -0,0 +1,240 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"net"
+	"sync"
+
+	"github.com/keybase/backoff"
+	"github.com/keybase/client/go/libkb"
+	"github.com/keybase/client/go/logger"
+	"github.com/keybase/client/go/protocol/keybase1"
+	"github.com/keybase/go-framed-msgpack-rpc/rpc"
+	"github.com/keybase/kbfs/kbfsblock"
+	"github.com/keybase/kbfs/kbfsmd"
+	kbgitkbfs "github.com/keybase/kbfs/protocol/kbgitkbfs1"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// localSharedServerErrorUnwrapper unwraps errors from a
+// LocalSharedServer, which can come from either the MD or the block
+// server.
+type localSharedServerErrorUnwrapper struct{}
+
+var _ rpc.ErrorUnwrapper = localSharedServerErrorUnwrapper{}
+
+// MakeArg implements rpc.ErrorUnwrapper.
+func (eu localSharedServerErrorUnwrapper) MakeArg() interface{} {
+	return &keybase1.Status{}
+}
+
+// UnwrapError implements rpc.ErrorUnwrapper.
+func (eu localSharedServerErrorUnwrapper) UnwrapError(arg interface{}) (
+	appError error, dispatchError error) {
+	s, ok := arg.(*keybase1.Status)
+	if !ok {
+		return nil, errors.New("Error converting arg to keybase1.Status object in localSharedServerErrorUnwrapper.UnwrapError")
+	}
+
+	if s != nil && s.Code >= kbfsblock.StatusCodeServerError &&
+		s.Code < kbfsmd.StatusCodeServerError {
+		return kbfsblock.ServerErrorUnwrapper{}.UnwrapError(arg)
+	}
+	return kbfsmd.ServerErrorUnwrapper{}.UnwrapError(arg)
+}
+
+// localSharedServerTransport is an rpc.ConnectionTransport that dials
+// a LocalSharedServer over a Unix domain socket.
+type localSharedServerTransport struct {
+	socketPath      string
+	rpcLogFactory   rpc.LogFactory
+	conn            net.Conn
+	transport       rpc.Transporter
+	stagedTransport rpc.Transporter
+}
+
+var _ rpc.ConnectionTransport = (*localSharedServerTransport)(nil)
+
+// Dial implements the rpc.ConnectionTransport interface for
+// localSharedServerTransport.
+func (t *localSharedServerTransport) Dial(ctx context.Context) (
+	rpc.Transporter, error) {
+	if t.conn != nil {
+		t.conn.Close()
+	}
+	var err error
+	t.conn, err = net.Dial("unix", t.socketPath)
+	if err != nil {
+		return nil, err
+	}
+	if t.stagedTransport != nil {
+		t.stagedTransport.Close()
+	}
+	t.stagedTransport = rpc.NewTransport(
+		t.conn, t.rpcLogFactory, libkb.WrapError)
+	return t.stagedTransport, nil
+}
+
+// IsConnected implements the rpc.ConnectionTransport interface for
+// localSharedServerTransport.
+func (t *localSharedServerTransport) IsConnected() bool {
+	return t.transport != nil && t.transport.IsConnected()
+}
+
+// Finalize implements the rpc.ConnectionTransport interface for
+// localSharedServerTransport.
+func (t *localSharedServerTransport) Finalize() {
+	if t.transport != nil {
+		t.transport.Close()
+	}
+	t.transport = t.stagedTransport
+	t.stagedTransport = nil
+}
+
+// Close implements the rpc.ConnectionTransport interface for
+// localSharedServerTransport.
+func (t *localSharedServerTransport) Close() {
+	if t.conn != nil {
+		t.conn.Close()
+	}
+	if t.transport != nil {
+		t.transport.Close()
+	}
+	t.transport = nil
+	if t.stagedTransport != nil {
+		t.stagedTransport.Close()
+	}
+	t.stagedTransport = nil
+}
+
+// newLocalSharedServerConnection starts connecting to the
+// LocalSharedServer listening on the given socket.
+func newLocalSharedServerConnection(
+	config logMaker, socketPath string, handler rpc.ConnectionHandler,
+	rpcLogFactory rpc.LogFactory) *rpc.Connection {
+	transport := &localSharedServerTransport{
+		socketPath:    socketPath,
+		rpcLogFactory: rpcLogFactory,
+	}
+	constBackoff := backoff.NewConstantBackOff(RPCReconnectInterval)
+	opts := rpc.ConnectionOpts{
+		WrapErrorFunc:    libkb.WrapError,
+		TagsFunc:         libkb.LogTagsFromContext,
+		ReconnectBackoff: func() backoff.BackOff { return constBackoff },
+	}
+	return rpc.NewConnectionWithTransport(
+		handler, transport, localSharedServerErrorUnwrapper{},
+		logger.LogOutputWithDepthAdder{Logger: config.MakeLogger("")}, opts)
+}
+
+// localSharedServerClient is an rpc.GenericClient for a connection
+// to a LocalSharedServer.  Once it's shut down, it cancels any calls
+// still in flight and waits for them to return before shutting down
+// the connection, since otherwise they would just reconnect.
+type localSharedServerClient struct {
+	conn *rpc.Connection
+
+	lock       sync.RWMutex
+	shutdown   bool
+	shutdownCh chan struct{}
+	calls      sync.WaitGroup
+}
+
+var _ rpc.GenericClient = (*localSharedServerClient)(nil)
+
+func newLocalSharedServerClient(conn *rpc.Connection) *localSharedServerClient {
+	return &localSharedServerClient{
+		conn:       conn,
+		shutdownCh: make(chan struct{}),
+	}
+}
+
+// startCall registers a new call, and returns a context that is
+// canceled on shutdown.
+func (c *localSharedServerClient) startCall(ctx context.Context) (
+	context.Context, context.CancelFunc, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if c.shutdown {
+		return nil, nil, ShutdownHappenedError{}
+	}
+	c.calls.Add(1)
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-c.shutdownCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		cancel()
+		c.calls.Done()
+	}, nil
+}
+
+// Call implements the rpc.GenericClient interface for
+// localSharedServerClient.
+func (c *localSharedServerClient) Call(ctx context.Context, method string,
+	arg interface{}, res interface{}) error {
+	ctx, done, err := c.startCall(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+	return c.conn.GetClient().Call(ctx, method, arg, res)
+}
+
+// Notify implements the rpc.GenericClient interface for
+// localSharedServerClient.
+func (c *localSharedServerClient) Notify(
+	ctx context.Context, method string, arg interface{}) error {
+	ctx, done, err := c.startCall(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+	return c.conn.GetClient().Notify(ctx, method, arg)
+}
+
+// IsConnected returns whether the underlying connection is
+// connected.
+func (c *localSharedServerClient) IsConnected() bool {
+	return c.conn.IsConnected()
+}
+
+// Shutdown cancels all outstanding calls, and then shuts down the
+// connection.
+func (c *localSharedServerClient) Shutdown() {
+	c.lock.Lock()
+	if c.shutdown {
+		c.lock.Unlock()
+		return
+	}
+	c.shutdown = true
+	close(c.shutdownCh)
+	c.lock.Unlock()
+
+	c.calls.Wait()
+	c.conn.Shutdown()
+}
+
+// localSharedServerHello tells the server on the other end of
+// `client` who the current user is.
+func localSharedServerHello(
+	ctx context.Context, config Config, client rpc.GenericClient) error {
+	session, err := config.KBPKI().GetCurrentSession(ctx)
+	if err != nil {
+		return err
+	}
+	buf, err := config.Codec().Encode(session)
+	if err != nil {
+		return err
+	}
+	c := kbgitkbfs.LocalServerClient{Cli: client}
+	return c.Hello(ctx, buf)
+}
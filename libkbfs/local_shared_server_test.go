@@ -0,0 +1,126 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/keybase/client/go/logger"
+	"github.com/keybase/go-framed-msgpack-rpc/rpc"
+	"github.com/keybase/kbfs/env"
+	"github.com/keybase/kbfs/ioutil"
+	"github.com/keybase/kbfs/tlf"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+// newLocalSharedServerRPCLogFactory makes an RPC log factory that
+// doesn't log anything, since both ends of the socket can keep
+// logging briefly after the test is done.
+func newLocalSharedServerRPCLogFactory() rpc.LogFactory {
+	return rpc.NewSimpleLogFactory(logger.NewNull(), nil)
+}
+
+func startLocalSharedServerForTest(
+	t *testing.T, socketPath string) *LocalSharedServer {
+	log := logger.NewTestLogger(t)
+	loggerFn := func(module string) logger.Logger { return log }
+	config := makeLocalSharedServerConfig(&env.KBFSContext{}, loggerFn)
+	mdServer, err := NewMDServerMemory(mdServerLocalConfigAdapter{config})
+	require.NoError(t, err)
+	keyServer, err := NewKeyServerMemory(config)
+	require.NoError(t, err)
+	s := newLocalSharedServer(config, newLocalSharedServerRPCLogFactory(),
+		mdServer, keyServer, NewBlockServerMemory(log))
+
+	l, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	s.Serve(l)
+	return s
+}
+
+// makeLocalSharedServerClientConfigForTest makes a config for the
+// given -localuser index that talks to the shared server at
+// socketPath instead of its own local servers.
+func makeLocalSharedServerClientConfigForTest(
+	t *testing.T, userIndex int, socketPath string) *ConfigLocal {
+	config := MakeTestConfigOrBustLoggedIn(t, userIndex, localModeUsers...)
+	config.MDServer().Shutdown()
+	config.KeyServer().Shutdown()
+	config.BlockServer().Shutdown(context.Background())
+
+	mdServer := NewMDServerSocket(
+		config, socketPath, newLocalSharedServerRPCLogFactory())
+	config.SetMDServer(mdServer)
+	config.SetKeyServer(mdServer)
+	config.SetBlockServer(NewBlockServerSocket(
+		config, socketPath, newLocalSharedServerRPCLogFactory()))
+	return config
+}
+
+// Test that two separate configs can share data via a
+// LocalSharedServer, as two separate processes would.
+func TestLocalSharedServerTwoUsers(t *testing.T) {
+	tempdir, err := ioutil.TempDir(os.TempDir(), "local_shared_server")
+	require.NoError(t, err)
+	defer func() {
+		err := ioutil.RemoveAll(tempdir)
+		require.NoError(t, err)
+	}()
+	socketPath := filepath.Join(tempdir, "kbfs.sock")
+
+	s := startLocalSharedServerForTest(t, socketPath)
+	defer s.Shutdown()
+
+	ctx := BackgroundContextWithCancellationDelayer()
+	defer CleanupCancellationDelayer(ctx)
+	config1 := makeLocalSharedServerClientConfigForTest(t, 0, socketPath)
+	defer CheckConfigAndShutdown(ctx, t, config1)
+	config2 := makeLocalSharedServerClientConfigForTest(t, 1, socketPath)
+	defer CheckConfigAndShutdown(ctx, t, config2)
+
+	name := "max,strib"
+
+	t.Log("User 1 writes a file")
+	rootNode1 := GetRootNodeOrBust(ctx, t, config1, name, tlf.Private)
+	kbfsOps1 := config1.KBFSOps()
+	fileNode1, _, err := kbfsOps1.CreateFile(
+		ctx, rootNode1, "a", false, NoExcl)
+	require.NoError(t, err)
+	data := []byte{1, 2, 3, 4}
+	err = kbfsOps1.Write(ctx, fileNode1, data, 0)
+	require.NoError(t, err)
+	err = kbfsOps1.SyncAll(ctx, rootNode1.GetFolderBranch())
+	require.NoError(t, err)
+
+	t.Log("User 2 reads it back")
+	rootNode2 := GetRootNodeOrBust(ctx, t, config2, name, tlf.Private)
+	kbfsOps2 := config2.KBFSOps()
+	fileNode2, _, err := kbfsOps2.Lookup(ctx, rootNode2, "a")
+	require.NoError(t, err)
+	buf := make([]byte, len(data))
+	n, err := kbfsOps2.Read(ctx, fileNode2, buf, 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), n)
+	require.Equal(t, data, buf)
+
+	t.Log("User 2 writes more, and user 1 sees it")
+	data2 := []byte{5, 6}
+	err = kbfsOps2.Write(ctx, fileNode2, data2, int64(len(data)))
+	require.NoError(t, err)
+	err = kbfsOps2.SyncAll(ctx, rootNode2.GetFolderBranch())
+	require.NoError(t, err)
+
+	err = kbfsOps1.SyncFromServer(ctx, rootNode1.GetFolderBranch(), nil)
+	require.NoError(t, err)
+	buf = make([]byte, len(data)+len(data2))
+	n, err = kbfsOps1.Read(ctx, fileNode1, buf, 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(buf)), n)
+	require.Equal(t, append(data, data2...), buf)
+}
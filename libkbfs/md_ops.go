@@ -1146,7 +1146,12 @@ func (md *MDOpsStandard) GetUnmergedRange(ctx context.Context, id tlf.ID,
 
 func (md *MDOpsStandard) put(ctx context.Context, rmd *RootMetadata,
 	verifyingKey kbfscrypto.VerifyingKey, lockContext *keybase1.LockContext,
-	priority keybase1.MDPriority) (ImmutableRootMetadata, error) {
+	priority keybase1.MDPriority) (irmd ImmutableRootMetadata, err error) {
+	ctx, span := startSpan(ctx, nil, "MDOps.Put")
+	defer func() { span.Finish(err) }()
+	span.SetAttribute("tlf", rmd.TlfID())
+	span.SetAttribute("revision", rmd.Revision())
+
 	session, err := md.config.KBPKI().GetCurrentSession(ctx)
 	if err != nil {
 		return ImmutableRootMetadata{}, err
@@ -1184,7 +1189,7 @@ func (md *MDOpsStandard) put(ctx context.Context, rmd *RootMetadata,
 		return ImmutableRootMetadata{}, err
 	}
 
-	irmd := MakeImmutableRootMetadata(
+	irmd = MakeImmutableRootMetadata(
 		rmd, verifyingKey, mdID, md.config.Clock().Now(), true)
 	// Revisions created locally should always override anything else
 	// in the cache.
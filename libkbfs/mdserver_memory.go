@@ -734,8 +734,10 @@ func (md *MDServerMemory) lockLocked(ctx context.Context,
 		}
 		return nil
 	} else if val.holder == md {
-		// The lock is already held by this instance; just return
-		// without refreshing timestamp.
+		// The lock is already held by this instance; just extend it,
+		// so that holders can keep it by periodically re-locking.
+		val.etime = md.config.Clock().Now().Add(mdLockTimeout)
+		md.lockIDs[lockKey] = val
 		return nil
 	}
 	// Someone else holds the lock; the caller needs to release
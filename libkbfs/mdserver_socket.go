@@ -0,0 +1,579 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"sync"
+	"time"
+
+	"github.com/keybase/client/go/protocol/keybase1"
+	"github.com/keybase/go-framed-msgpack-rpc/rpc"
+	"github.com/keybase/kbfs/kbfscrypto"
+	"github.com/keybase/kbfs/kbfsmd"
+	kbgitkbfs "github.com/keybase/kbfs/protocol/kbgitkbfs1"
+	"github.com/keybase/kbfs/tlf"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// MDServerSocket is an MDServer (and KeyServer) that talks to a
+// LocalSharedServer over a Unix domain socket.  It's meant only for
+// testing multiple KBFS processes against the same local data.
+type MDServerSocket struct {
+	config     Config
+	log        traceLogger
+	deferLog   traceLogger
+	socketPath string
+
+	conn   *localSharedServerClient
+	client kbgitkbfs.LocalServerClient
+
+	observerMu sync.Mutex // protects observers
+	observers  map[tlf.ID]context.CancelFunc
+}
+
+// Test that MDServerSocket fully implements the MDServer interface.
+var _ MDServer = (*MDServerSocket)(nil)
+
+// Test that MDServerSocket fully implements the KeyServer interface.
+var _ KeyServer = (*MDServerSocket)(nil)
+
+// Test that MDServerSocket fully implements the ConnectionHandler interface.
+var _ rpc.ConnectionHandler = (*MDServerSocket)(nil)
+
+// NewMDServerSocket returns a new instance of MDServerSocket, which
+// connects to the LocalSharedServer listening on `socketPath`.
+func NewMDServerSocket(config Config, socketPath string,
+	rpcLogFactory rpc.LogFactory) *MDServerSocket {
+	log := config.MakeLogger("")
+	md := &MDServerSocket{
+		config:     config,
+		log:        traceLogger{log},
+		deferLog:   traceLogger{log.CloneWithAddedDepth(1)},
+		socketPath: socketPath,
+		observers:  make(map[tlf.ID]context.CancelFunc),
+	}
+	md.conn = newLocalSharedServerClient(newLocalSharedServerConnection(
+		config, socketPath, md, rpcLogFactory))
+	md.client = kbgitkbfs.LocalServerClient{Cli: md.conn}
+	return md
+}
+
+// RemoteAddress returns the socket path of the server this client is
+// talking to.
+func (md *MDServerSocket) RemoteAddress() string {
+	return md.socketPath
+}
+
+// HandlerName implements the ConnectionHandler interface.
+func (*MDServerSocket) HandlerName() string {
+	return "MDServerSocket"
+}
+
+// OnConnect implements the ConnectionHandler interface.
+func (md *MDServerSocket) OnConnect(ctx context.Context,
+	conn *rpc.Connection, client rpc.GenericClient,
+	server *rpc.Server) error {
+	md.log.CDebugf(ctx, "OnConnect called with a new connection")
+	return localSharedServerHello(ctx, md.config, client)
+}
+
+// OnConnectError implements the ConnectionHandler interface.
+func (md *MDServerSocket) OnConnectError(err error, wait time.Duration) {
+	md.log.CWarningf(context.TODO(),
+		"MDServerSocket: connection error: %q; retrying in %s", err, wait)
+}
+
+// OnDoCommandError implements the ConnectionHandler interface.
+func (md *MDServerSocket) OnDoCommandError(err error, wait time.Duration) {
+	md.log.CWarningf(context.TODO(),
+		"MDServerSocket: DoCommand error: %q; retrying in %s", err, wait)
+}
+
+// OnDisconnected implements the ConnectionHandler interface.
+func (md *MDServerSocket) OnDisconnected(ctx context.Context,
+	status rpc.DisconnectStatus) {
+	if status == rpc.StartingNonFirstConnection {
+		md.log.CWarningf(ctx, "MDServerSocket is disconnected")
+	}
+}
+
+// ShouldRetry implements the ConnectionHandler interface.
+func (md *MDServerSocket) ShouldRetry(name string, err error) bool {
+	return false
+}
+
+// ShouldRetryOnConnect implements the ConnectionHandler interface.
+func (md *MDServerSocket) ShouldRetryOnConnect(err error) bool {
+	// The server may just not have been started yet.
+	return true
+}
+
+// RefreshAuthToken implements the MDServer interface for MDServerSocket.
+func (md *MDServerSocket) RefreshAuthToken(ctx context.Context) {}
+
+func (md *MDServerSocket) decodeMD(id tlf.ID,
+	block *kbgitkbfs.LocalServerMDBlock) (*RootMetadataSigned, error) {
+	if block == nil {
+		return nil, nil
+	}
+	return DecodeRootMetadataSigned(
+		md.config.Codec(), id, kbfsmd.MetadataVer(block.Version),
+		md.config.MetadataVersion(), block.Block,
+		keybase1.FromTime(block.Timestamp))
+}
+
+// GetForHandle implements the MDServer interface for MDServerSocket.
+func (md *MDServerSocket) GetForHandle(ctx context.Context,
+	handle tlf.Handle, mStatus kbfsmd.MergeStatus,
+	lockBeforeGet *keybase1.LockID) (
+	tlfID tlf.ID, rmds *RootMetadataSigned, err error) {
+	md.log.LazyTrace(ctx, "MDServer: GetForHandle %+v %s", handle, mStatus)
+	defer func() {
+		md.deferLog.LazyTrace(ctx, "MDServer: GetForHandle %+v %s done (err=%v)", handle, mStatus, err)
+	}()
+
+	encodedHandle, err := md.config.Codec().Encode(handle)
+	if err != nil {
+		return tlf.ID{}, nil, err
+	}
+	res, err := md.client.GetMDForHandle(ctx, kbgitkbfs.GetMDForHandleArg{
+		Handle:        encodedHandle,
+		Unmerged:      mStatus == kbfsmd.Unmerged,
+		LockBeforeGet: lockBeforeGet,
+	})
+	if err != nil {
+		return tlf.ID{}, nil, err
+	}
+	err = tlfID.UnmarshalBinary(res.TlfID)
+	if err != nil {
+		return tlf.ID{}, nil, err
+	}
+	rmds, err = md.decodeMD(tlfID, res.Md)
+	if err != nil {
+		return tlf.ID{}, nil, err
+	}
+	return tlfID, rmds, nil
+}
+
+// GetForTLF implements the MDServer interface for MDServerSocket.
+func (md *MDServerSocket) GetForTLF(ctx context.Context, id tlf.ID,
+	bid kbfsmd.BranchID, mStatus kbfsmd.MergeStatus,
+	lockBeforeGet *keybase1.LockID) (rmds *RootMetadataSigned, err error) {
+	md.log.LazyTrace(ctx, "MDServer: GetForTLF %s %s %s", id, bid, mStatus)
+	defer func() {
+		md.deferLog.LazyTrace(ctx, "MDServer: GetForTLF %s %s %s done (err=%v)", id, bid, mStatus, err)
+	}()
+
+	block, err := md.client.GetMDForTLF(ctx, kbgitkbfs.GetMDForTLFArg{
+		TlfID:         id.Bytes(),
+		BranchID:      bid.Bytes(),
+		Unmerged:      mStatus == kbfsmd.Unmerged,
+		LockBeforeGet: lockBeforeGet,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return md.decodeMD(id, block)
+}
+
+// GetForTLFByTime implements the MDServer interface for MDServerSocket.
+func (md *MDServerSocket) GetForTLFByTime(
+	ctx context.Context, id tlf.ID, serverTime time.Time) (
+	rmds *RootMetadataSigned, err error) {
+	md.log.LazyTrace(ctx, "MDServer: GetForTLFByTime %s %s", id, serverTime)
+	defer func() {
+		md.deferLog.LazyTrace(ctx, "MDServer: GetForTLFByTime %s %s done (err=%v)", id, serverTime, err)
+	}()
+
+	block, err := md.client.GetMDForTLFByTime(
+		ctx, kbgitkbfs.GetMDForTLFByTimeArg{
+			TlfID:      id.Bytes(),
+			ServerTime: keybase1.ToTime(serverTime),
+		})
+	if err != nil {
+		return nil, err
+	}
+	return md.decodeMD(id, block)
+}
+
+// GetRange implements the MDServer interface for MDServerSocket.
+func (md *MDServerSocket) GetRange(ctx context.Context, id tlf.ID,
+	bid kbfsmd.BranchID, mStatus kbfsmd.MergeStatus,
+	start, stop kbfsmd.Revision, lockBeforeGet *keybase1.LockID) (
+	rmdses []*RootMetadataSigned, err error) {
+	md.log.LazyTrace(ctx, "MDServer: GetRange %s %s %s %d-%d", id, bid, mStatus, start, stop)
+	defer func() {
+		md.deferLog.LazyTrace(ctx, "MDServer: GetRange %s %s %s %d-%d done (err=%v)", id, bid, mStatus, start, stop, err)
+	}()
+
+	blocks, err := md.client.GetMDRange(ctx, kbgitkbfs.GetMDRangeArg{
+		TlfID:         id.Bytes(),
+		BranchID:      bid.Bytes(),
+		Unmerged:      mStatus == kbfsmd.Unmerged,
+		Start:         int64(start),
+		Stop:          int64(stop),
+		LockBeforeGet: lockBeforeGet,
+	})
+	if err != nil {
+		return nil, err
+	}
+	rmdses = make([]*RootMetadataSigned, 0, len(blocks))
+	for i := range blocks {
+		rmds, err := md.decodeMD(id, &blocks[i])
+		if err != nil {
+			return nil, err
+		}
+		rmdses = append(rmdses, rmds)
+	}
+	return rmdses, nil
+}
+
+// Put implements the MDServer interface for MDServerSocket.
+func (md *MDServerSocket) Put(ctx context.Context, rmds *RootMetadataSigned,
+	extra kbfsmd.ExtraMetadata, lockContext *keybase1.LockContext,
+	priority keybase1.MDPriority) (err error) {
+	md.log.LazyTrace(ctx, "MDServer: Put %s %d", rmds.MD.TlfID(), rmds.MD.RevisionNumber())
+	defer func() {
+		md.deferLog.LazyTrace(ctx, "MDServer: Put %s %d done (err=%v)", rmds.MD.TlfID(), rmds.MD.RevisionNumber(), err)
+	}()
+
+	rmdsBytes, err := kbfsmd.EncodeRootMetadataSigned(
+		md.config.Codec(), &rmds.RootMetadataSigned)
+	if err != nil {
+		return err
+	}
+	arg := kbgitkbfs.PutMDArg{
+		Md: kbgitkbfs.LocalServerMDBlock{
+			Version: int(rmds.Version()),
+			Block:   rmdsBytes,
+		},
+		LockContext: lockContext,
+		Priority:    priority,
+	}
+
+	if extra != nil {
+		// Unlike the real mdserver, the local ones need the full
+		// key bundles (not just the new ones) to validate the put.
+		extraV3, ok := extra.(*kbfsmd.ExtraMetadataV3)
+		if !ok {
+			return errors.Errorf("Extra of unexpected type %T", extra)
+		}
+		arg.WriterKeyBundle, err = md.config.Codec().Encode(
+			extraV3.GetWriterKeyBundle())
+		if err != nil {
+			return err
+		}
+		arg.ReaderKeyBundle, err = md.config.Codec().Encode(
+			extraV3.GetReaderKeyBundle())
+		if err != nil {
+			return err
+		}
+		arg.WriterKeyBundleNew = extraV3.IsWriterKeyBundleNew()
+		arg.ReaderKeyBundleNew = extraV3.IsReaderKeyBundleNew()
+	}
+
+	return md.client.PutMD(ctx, arg)
+}
+
+// Lock implements the MDServer interface for MDServerSocket.
+func (md *MDServerSocket) Lock(ctx context.Context,
+	tlfID tlf.ID, lockID keybase1.LockID) error {
+	md.log.LazyTrace(ctx, "MDServer: Lock %s %s", tlfID, lockID)
+	return md.client.Lock(ctx, kbgitkbfs.LockArg{
+		TlfID:  tlfID.Bytes(),
+		LockID: lockID,
+	})
+}
+
+// ReleaseLock implements the MDServer interface for MDServerSocket.
+func (md *MDServerSocket) ReleaseLock(ctx context.Context,
+	tlfID tlf.ID, lockID keybase1.LockID) error {
+	md.log.LazyTrace(ctx, "MDServer: ReleaseLock %s %s", tlfID, lockID)
+	return md.client.ReleaseLock(ctx, kbgitkbfs.ReleaseLockArg{
+		TlfID:  tlfID.Bytes(),
+		LockID: lockID,
+	})
+}
+
+// StartImplicitTeamMigration implements the MDServer interface for
+// MDServerSocket.
+func (md *MDServerSocket) StartImplicitTeamMigration(
+	ctx context.Context, id tlf.ID) (err error) {
+	md.log.LazyTrace(ctx, "MDServer: StartImplicitTeamMigration %s", id)
+	return md.client.StartImplicitTeamMigration(ctx, id.Bytes())
+}
+
+// PruneBranch implements the MDServer interface for MDServerSocket.
+func (md *MDServerSocket) PruneBranch(
+	ctx context.Context, id tlf.ID, bid kbfsmd.BranchID) error {
+	md.log.LazyTrace(ctx, "MDServer: PruneBranch %s %s", id, bid)
+	return md.client.PruneBranch(ctx, kbgitkbfs.PruneBranchArg{
+		TlfID:    id.Bytes(),
+		BranchID: bid.Bytes(),
+	})
+}
+
+// RegisterForUpdate implements the MDServer interface for MDServerSocket.
+func (md *MDServerSocket) RegisterForUpdate(ctx context.Context, id tlf.ID,
+	currHead kbfsmd.Revision) (<-chan error, error) {
+	md.log.LazyTrace(ctx, "MDServer: RegisterForUpdate %s %d", id, currHead)
+
+	// The server holds on to the call until there's an update, so
+	// run it in the background and hand the result over on the
+	// returned channel.
+	waitCtx, cancel := context.WithCancel(context.Background())
+	md.observerMu.Lock()
+	if oldCancel, ok := md.observers[id]; ok {
+		oldCancel()
+	}
+	md.observers[id] = cancel
+	md.observerMu.Unlock()
+
+	c := make(chan error, 1)
+	go func() {
+		err := md.client.WaitForMDUpdate(
+			waitCtx, kbgitkbfs.WaitForMDUpdateArg{
+				TlfID:    id.Bytes(),
+				CurrHead: int64(currHead),
+			})
+		md.observerMu.Lock()
+		// Only clear the entry if it hasn't been replaced by a newer
+		// registration already.
+		if waitCtx.Err() == nil {
+			delete(md.observers, id)
+		}
+		md.observerMu.Unlock()
+		cancel()
+		c <- err
+		close(c)
+	}()
+	return c, nil
+}
+
+// CancelRegistration implements the MDServer interface for MDServerSocket.
+func (md *MDServerSocket) CancelRegistration(ctx context.Context, id tlf.ID) {
+	md.observerMu.Lock()
+	defer md.observerMu.Unlock()
+	if cancel, ok := md.observers[id]; ok {
+		cancel()
+		delete(md.observers, id)
+	}
+}
+
+// CheckForRekeys implements the MDServer interface for MDServerSocket.
+func (md *MDServerSocket) CheckForRekeys(ctx context.Context) <-chan error {
+	// Like the local servers, there's nothing to do.
+	c := make(chan error, 1)
+	c <- nil
+	return c
+}
+
+// TruncateLock implements the MDServer interface for MDServerSocket.
+func (md *MDServerSocket) TruncateLock(ctx context.Context, id tlf.ID) (
+	bool, error) {
+	md.log.LazyTrace(ctx, "MDServer: TruncateLock %s", id)
+	return md.client.TruncateLock(ctx, id.Bytes())
+}
+
+// TruncateUnlock implements the MDServer interface for MDServerSocket.
+func (md *MDServerSocket) TruncateUnlock(ctx context.Context, id tlf.ID) (
+	bool, error) {
+	md.log.LazyTrace(ctx, "MDServer: TruncateUnlock %s", id)
+	return md.client.TruncateUnlock(ctx, id.Bytes())
+}
+
+// DisableRekeyUpdatesForTesting implements the MDServer interface for
+// MDServerSocket.
+func (md *MDServerSocket) DisableRekeyUpdatesForTesting() {}
+
+// Shutdown implements the MDServer interface for MDServerSocket.
+func (md *MDServerSocket) Shutdown() {
+	md.observerMu.Lock()
+	for id, cancel := range md.observers {
+		cancel()
+		delete(md.observers, id)
+	}
+	md.observerMu.Unlock()
+	md.conn.Shutdown()
+}
+
+// IsConnected implements the MDServer interface for MDServerSocket.
+func (md *MDServerSocket) IsConnected() bool {
+	return md.conn.IsConnected()
+}
+
+// GetLatestHandleForTLF implements the MDServer interface for
+// MDServerSocket.
+func (md *MDServerSocket) GetLatestHandleForTLF(ctx context.Context,
+	id tlf.ID) (handle tlf.Handle, err error) {
+	md.log.LazyTrace(ctx, "MDServer: GetLatestHandle %s", id)
+	buf, err := md.client.GetLatestHandleForTLF(ctx, id.Bytes())
+	if err != nil {
+		return tlf.Handle{}, err
+	}
+	err = md.config.Codec().Decode(buf, &handle)
+	if err != nil {
+		return tlf.Handle{}, err
+	}
+	return handle, nil
+}
+
+// OffsetFromServerTime implements the MDServer interface for
+// MDServerSocket.
+func (md *MDServerSocket) OffsetFromServerTime() (time.Duration, bool) {
+	// The server runs on the same machine.
+	return 0, true
+}
+
+// GetKeyBundles implements the MDServer interface for MDServerSocket.
+func (md *MDServerSocket) GetKeyBundles(ctx context.Context,
+	tlfID tlf.ID, wkbID kbfsmd.TLFWriterKeyBundleID,
+	rkbID kbfsmd.TLFReaderKeyBundleID) (
+	wkb *kbfsmd.TLFWriterKeyBundleV3, rkb *kbfsmd.TLFReaderKeyBundleV3,
+	err error) {
+	md.log.LazyTrace(ctx, "KeyServer: GetKeyBundles %s %s %s", tlfID, wkbID, rkbID)
+	defer func() {
+		md.deferLog.LazyTrace(ctx, "KeyServer: GetKeyBundles %s %s %s done (err=%v)", tlfID, wkbID, rkbID, err)
+	}()
+
+	arg := kbgitkbfs.GetKeyBundlesArg{TlfID: tlfID.Bytes()}
+	if wkbID != (kbfsmd.TLFWriterKeyBundleID{}) {
+		arg.WriterKeyBundleID = wkbID.Bytes()
+	}
+	if rkbID != (kbfsmd.TLFReaderKeyBundleID{}) {
+		arg.ReaderKeyBundleID = rkbID.Bytes()
+	}
+	res, err := md.client.GetKeyBundles(ctx, arg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(res.WriterKeyBundle) > 0 {
+		wkb = new(kbfsmd.TLFWriterKeyBundleV3)
+		err = md.config.Codec().Decode(res.WriterKeyBundle, wkb)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(res.ReaderKeyBundle) > 0 {
+		rkb = new(kbfsmd.TLFReaderKeyBundleV3)
+		err = md.config.Codec().Decode(res.ReaderKeyBundle, rkb)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return wkb, rkb, nil
+}
+
+// CheckReachability implements the MDServer interface for MDServerSocket.
+func (md *MDServerSocket) CheckReachability(ctx context.Context) {}
+
+// FastForwardBackoff implements the MDServer interface for MDServerSocket.
+func (md *MDServerSocket) FastForwardBackoff() {}
+
+// FindNextMD implements the MDServer interface for MDServerSocket.
+func (md *MDServerSocket) FindNextMD(
+	ctx context.Context, tlfID tlf.ID, rootSeqno keybase1.Seqno) (
+	nextKbfsRoot *kbfsmd.MerkleRoot, nextMerkleNodes [][]byte,
+	nextRootSeqno keybase1.Seqno, err error) {
+	// The local servers don't keep a merkle tree either.
+	return nil, nil, 0, nil
+}
+
+// GetMerkleRootLatest implements the MDServer interface for MDServerSocket.
+func (md *MDServerSocket) GetMerkleRootLatest(
+	ctx context.Context, treeID keybase1.MerkleTreeID) (
+	root *kbfsmd.MerkleRoot, err error) {
+	buf, err := md.client.GetMerkleRootLatest(ctx, treeID)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) == 0 {
+		return nil, nil
+	}
+	root = new(kbfsmd.MerkleRoot)
+	err = md.config.Codec().Decode(buf, root)
+	if err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// GetTLFCryptKeyServerHalf implements the KeyServer interface for
+// MDServerSocket.
+func (md *MDServerSocket) GetTLFCryptKeyServerHalf(ctx context.Context,
+	serverHalfID kbfscrypto.TLFCryptKeyServerHalfID,
+	cryptKey kbfscrypto.CryptPublicKey) (
+	serverHalf kbfscrypto.TLFCryptKeyServerHalf, err error) {
+	md.log.LazyTrace(ctx, "KeyServer: GetTLFCryptKeyServerHalf %s", serverHalfID)
+	defer func() {
+		md.deferLog.LazyTrace(ctx, "KeyServer: GetTLFCryptKeyServerHalf %s done (err=%v)", serverHalfID, err)
+	}()
+
+	idBytes, err := md.config.Codec().Encode(serverHalfID)
+	if err != nil {
+		return kbfscrypto.TLFCryptKeyServerHalf{}, err
+	}
+	keyBytes, err := md.config.Codec().Encode(cryptKey)
+	if err != nil {
+		return kbfscrypto.TLFCryptKeyServerHalf{}, err
+	}
+	buf, err := md.client.GetTLFCryptKeyServerHalf(
+		ctx, kbgitkbfs.GetTLFCryptKeyServerHalfArg{
+			ServerHalfID:   idBytes,
+			CryptPublicKey: keyBytes,
+		})
+	if err != nil {
+		return kbfscrypto.TLFCryptKeyServerHalf{}, err
+	}
+	err = md.config.Codec().Decode(buf, &serverHalf)
+	if err != nil {
+		return kbfscrypto.TLFCryptKeyServerHalf{}, err
+	}
+	return serverHalf, nil
+}
+
+// PutTLFCryptKeyServerHalves implements the KeyServer interface for
+// MDServerSocket.
+func (md *MDServerSocket) PutTLFCryptKeyServerHalves(ctx context.Context,
+	keyServerHalves kbfsmd.UserDeviceKeyServerHalves) (err error) {
+	md.log.LazyTrace(ctx, "KeyServer: PutTLFCryptKeyServerHalves %v", keyServerHalves)
+	defer func() {
+		md.deferLog.LazyTrace(ctx, "KeyServer: PutTLFCryptKeyServerHalves %v done (err=%v)", keyServerHalves, err)
+	}()
+
+	buf, err := md.config.Codec().Encode(keyServerHalves)
+	if err != nil {
+		return err
+	}
+	return md.client.PutTLFCryptKeyServerHalves(ctx, buf)
+}
+
+// DeleteTLFCryptKeyServerHalf implements the KeyServer interface for
+// MDServerSocket.
+func (md *MDServerSocket) DeleteTLFCryptKeyServerHalf(ctx context.Context,
+	uid keybase1.UID, key kbfscrypto.CryptPublicKey,
+	serverHalfID kbfscrypto.TLFCryptKeyServerHalfID) (err error) {
+	md.log.LazyTrace(ctx, "KeyServer: DeleteTLFCryptKeyServerHalf %s %s", uid, serverHalfID)
+	defer func() {
+		md.deferLog.LazyTrace(ctx, "KeyServer: DeleteTLFCryptKeyServerHalf %s %s done (err=%v)", uid, serverHalfID, err)
+	}()
+
+	keyBytes, err := md.config.Codec().Encode(key)
+	if err != nil {
+		return err
+	}
+	idBytes, err := md.config.Codec().Encode(serverHalfID)
+	if err != nil {
+		return err
+	}
+	return md.client.DeleteTLFCryptKeyServerHalf(
+		ctx, kbgitkbfs.DeleteTLFCryptKeyServerHalfArg{
+			Uid:            uid,
+			CryptPublicKey: keyBytes,
+			ServerHalfID:   idBytes,
+		})
+}
@@ -594,6 +594,183 @@ func (mr *MocksyncedTlfGetterSetterMockRecorder) SetTlfSyncState(tlfID, isSynced
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetTlfSyncState", reflect.TypeOf((*MocksyncedTlfGetterSetter)(nil).SetTlfSyncState), tlfID, isSynced)
 }
 
+// GetTlfSyncPaths mocks base method
+func (m *MocksyncedTlfGetterSetter) GetTlfSyncPaths(tlfID tlf.ID) []string {
+	ret := m.ctrl.Call(m, "GetTlfSyncPaths", tlfID)
+	ret0, _ := ret[0].([]string)
+	return ret0
+}
+
+// GetTlfSyncPaths indicates an expected call of GetTlfSyncPaths
+func (mr *MocksyncedTlfGetterSetterMockRecorder) GetTlfSyncPaths(tlfID interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTlfSyncPaths", reflect.TypeOf((*MocksyncedTlfGetterSetter)(nil).GetTlfSyncPaths), tlfID)
+}
+
+// SetTlfSyncPaths mocks base method
+func (m *MocksyncedTlfGetterSetter) SetTlfSyncPaths(tlfID tlf.ID, paths []string) error {
+	ret := m.ctrl.Call(m, "SetTlfSyncPaths", tlfID, paths)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetTlfSyncPaths indicates an expected call of SetTlfSyncPaths
+func (mr *MocksyncedTlfGetterSetterMockRecorder) SetTlfSyncPaths(tlfID, paths interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetTlfSyncPaths", reflect.TypeOf((*MocksyncedTlfGetterSetter)(nil).SetTlfSyncPaths), tlfID, paths)
+}
+
+// GetPartiallySyncedTlfs mocks base method
+func (m *MocksyncedTlfGetterSetter) GetPartiallySyncedTlfs() []tlf.ID {
+	ret := m.ctrl.Call(m, "GetPartiallySyncedTlfs")
+	ret0, _ := ret[0].([]tlf.ID)
+	return ret0
+}
+
+// GetPartiallySyncedTlfs indicates an expected call of GetPartiallySyncedTlfs
+func (mr *MocksyncedTlfGetterSetterMockRecorder) GetPartiallySyncedTlfs() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPartiallySyncedTlfs", reflect.TypeOf((*MocksyncedTlfGetterSetter)(nil).GetPartiallySyncedTlfs))
+}
+
+// MockdiskCacheTlfSettingsGetterSetter is a mock of diskCacheTlfSettingsGetterSetter interface
+type MockdiskCacheTlfSettingsGetterSetter struct {
+	ctrl     *gomock.Controller
+	recorder *MockdiskCacheTlfSettingsGetterSetterMockRecorder
+}
+
+// MockdiskCacheTlfSettingsGetterSetterMockRecorder is the mock recorder for MockdiskCacheTlfSettingsGetterSetter
+type MockdiskCacheTlfSettingsGetterSetterMockRecorder struct {
+	mock *MockdiskCacheTlfSettingsGetterSetter
+}
+
+// NewMockdiskCacheTlfSettingsGetterSetter creates a new mock instance
+func NewMockdiskCacheTlfSettingsGetterSetter(ctrl *gomock.Controller) *MockdiskCacheTlfSettingsGetterSetter {
+	mock := &MockdiskCacheTlfSettingsGetterSetter{ctrl: ctrl}
+	mock.recorder = &MockdiskCacheTlfSettingsGetterSetterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockdiskCacheTlfSettingsGetterSetter) EXPECT() *MockdiskCacheTlfSettingsGetterSetterMockRecorder {
+	return m.recorder
+}
+
+// GetDiskCacheTlfSettings mocks base method
+func (m *MockdiskCacheTlfSettingsGetterSetter) GetDiskCacheTlfSettings(tlfID tlf.ID) DiskCacheTlfSettings {
+	ret := m.ctrl.Call(m, "GetDiskCacheTlfSettings", tlfID)
+	ret0, _ := ret[0].(DiskCacheTlfSettings)
+	return ret0
+}
+
+// GetDiskCacheTlfSettings indicates an expected call of GetDiskCacheTlfSettings
+func (mr *MockdiskCacheTlfSettingsGetterSetterMockRecorder) GetDiskCacheTlfSettings(tlfID interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDiskCacheTlfSettings", reflect.TypeOf((*MockdiskCacheTlfSettingsGetterSetter)(nil).GetDiskCacheTlfSettings), tlfID)
+}
+
+// SetDiskCacheTlfSettings mocks base method
+func (m *MockdiskCacheTlfSettingsGetterSetter) SetDiskCacheTlfSettings(ctx context.Context, tlfID tlf.ID, settings DiskCacheTlfSettings) error {
+	ret := m.ctrl.Call(m, "SetDiskCacheTlfSettings", ctx, tlfID, settings)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetDiskCacheTlfSettings indicates an expected call of SetDiskCacheTlfSettings
+func (mr *MockdiskCacheTlfSettingsGetterSetterMockRecorder) SetDiskCacheTlfSettings(ctx, tlfID, settings interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetDiskCacheTlfSettings", reflect.TypeOf((*MockdiskCacheTlfSettingsGetterSetter)(nil).SetDiskCacheTlfSettings), ctx, tlfID, settings)
+}
+
+// MockquotaReclamationTlfPolicyGetterSetter is a mock of quotaReclamationTlfPolicyGetterSetter interface
+type MockquotaReclamationTlfPolicyGetterSetter struct {
+	ctrl     *gomock.Controller
+	recorder *MockquotaReclamationTlfPolicyGetterSetterMockRecorder
+}
+
+// MockquotaReclamationTlfPolicyGetterSetterMockRecorder is the mock recorder for MockquotaReclamationTlfPolicyGetterSetter
+type MockquotaReclamationTlfPolicyGetterSetterMockRecorder struct {
+	mock *MockquotaReclamationTlfPolicyGetterSetter
+}
+
+// NewMockquotaReclamationTlfPolicyGetterSetter creates a new mock instance
+func NewMockquotaReclamationTlfPolicyGetterSetter(ctrl *gomock.Controller) *MockquotaReclamationTlfPolicyGetterSetter {
+	mock := &MockquotaReclamationTlfPolicyGetterSetter{ctrl: ctrl}
+	mock.recorder = &MockquotaReclamationTlfPolicyGetterSetterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockquotaReclamationTlfPolicyGetterSetter) EXPECT() *MockquotaReclamationTlfPolicyGetterSetterMockRecorder {
+	return m.recorder
+}
+
+// GetQuotaReclamationTlfPolicy mocks base method
+func (m *MockquotaReclamationTlfPolicyGetterSetter) GetQuotaReclamationTlfPolicy(tlfID tlf.ID) QuotaReclamationTlfPolicy {
+	ret := m.ctrl.Call(m, "GetQuotaReclamationTlfPolicy", tlfID)
+	ret0, _ := ret[0].(QuotaReclamationTlfPolicy)
+	return ret0
+}
+
+// GetQuotaReclamationTlfPolicy indicates an expected call of GetQuotaReclamationTlfPolicy
+func (mr *MockquotaReclamationTlfPolicyGetterSetterMockRecorder) GetQuotaReclamationTlfPolicy(tlfID interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetQuotaReclamationTlfPolicy", reflect.TypeOf((*MockquotaReclamationTlfPolicyGetterSetter)(nil).GetQuotaReclamationTlfPolicy), tlfID)
+}
+
+// SetQuotaReclamationTlfPolicy mocks base method
+func (m *MockquotaReclamationTlfPolicyGetterSetter) SetQuotaReclamationTlfPolicy(tlfID tlf.ID, policy QuotaReclamationTlfPolicy) error {
+	ret := m.ctrl.Call(m, "SetQuotaReclamationTlfPolicy", tlfID, policy)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetQuotaReclamationTlfPolicy indicates an expected call of SetQuotaReclamationTlfPolicy
+func (mr *MockquotaReclamationTlfPolicyGetterSetterMockRecorder) SetQuotaReclamationTlfPolicy(tlfID, policy interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetQuotaReclamationTlfPolicy", reflect.TypeOf((*MockquotaReclamationTlfPolicyGetterSetter)(nil).SetQuotaReclamationTlfPolicy), tlfID, policy)
+}
+
+// MockconflictRenameTemplateGetterSetter is a mock of conflictRenameTemplateGetterSetter interface
+type MockconflictRenameTemplateGetterSetter struct {
+	ctrl     *gomock.Controller
+	recorder *MockconflictRenameTemplateGetterSetterMockRecorder
+}
+
+// MockconflictRenameTemplateGetterSetterMockRecorder is the mock recorder for MockconflictRenameTemplateGetterSetter
+type MockconflictRenameTemplateGetterSetterMockRecorder struct {
+	mock *MockconflictRenameTemplateGetterSetter
+}
+
+// NewMockconflictRenameTemplateGetterSetter creates a new mock instance
+func NewMockconflictRenameTemplateGetterSetter(ctrl *gomock.Controller) *MockconflictRenameTemplateGetterSetter {
+	mock := &MockconflictRenameTemplateGetterSetter{ctrl: ctrl}
+	mock.recorder = &MockconflictRenameTemplateGetterSetterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockconflictRenameTemplateGetterSetter) EXPECT() *MockconflictRenameTemplateGetterSetterMockRecorder {
+	return m.recorder
+}
+
+// GetConflictRenameTemplate mocks base method
+func (m *MockconflictRenameTemplateGetterSetter) GetConflictRenameTemplate(tlfID tlf.ID) string {
+	ret := m.ctrl.Call(m, "GetConflictRenameTemplate", tlfID)
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// GetConflictRenameTemplate indicates an expected call of GetConflictRenameTemplate
+func (mr *MockconflictRenameTemplateGetterSetterMockRecorder) GetConflictRenameTemplate(tlfID interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetConflictRenameTemplate", reflect.TypeOf((*MockconflictRenameTemplateGetterSetter)(nil).GetConflictRenameTemplate), tlfID)
+}
+
+// SetConflictRenameTemplate mocks base method
+func (m *MockconflictRenameTemplateGetterSetter) SetConflictRenameTemplate(tlfID tlf.ID, text string) error {
+	ret := m.ctrl.Call(m, "SetConflictRenameTemplate", tlfID, text)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetConflictRenameTemplate indicates an expected call of SetConflictRenameTemplate
+func (mr *MockconflictRenameTemplateGetterSetterMockRecorder) SetConflictRenameTemplate(tlfID, text interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetConflictRenameTemplate", reflect.TypeOf((*MockconflictRenameTemplateGetterSetter)(nil).SetConflictRenameTemplate), tlfID, text)
+}
+
 // MockblockRetrieverGetter is a mock of blockRetrieverGetter interface
 type MockblockRetrieverGetter struct {
 	ctrl     *gomock.Controller
@@ -1348,6 +1525,19 @@ func (mr *MockKBFSOpsMockRecorder) GetDirChildren(ctx, dir interface{}) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDirChildren", reflect.TypeOf((*MockKBFSOps)(nil).GetDirChildren), ctx, dir)
 }
 
+// GetDirChildrenPaged mocks base method
+func (m *MockKBFSOps) GetDirChildrenPaged(ctx context.Context, dir Node, after string, maxEntries int) ([]DirChild, error) {
+	ret := m.ctrl.Call(m, "GetDirChildrenPaged", ctx, dir, after, maxEntries)
+	ret0, _ := ret[0].([]DirChild)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDirChildrenPaged indicates an expected call of GetDirChildrenPaged
+func (mr *MockKBFSOpsMockRecorder) GetDirChildrenPaged(ctx, dir, after, maxEntries interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDirChildrenPaged", reflect.TypeOf((*MockKBFSOps)(nil).GetDirChildrenPaged), ctx, dir, after, maxEntries)
+}
+
 // Lookup mocks base method
 func (m *MockKBFSOps) Lookup(ctx context.Context, dir Node, name string) (Node, EntryInfo, error) {
 	ret := m.ctrl.Call(m, "Lookup", ctx, dir, name)
@@ -1489,6 +1679,43 @@ func (mr *MockKBFSOpsMockRecorder) Truncate(ctx, file, size interface{}) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Truncate", reflect.TypeOf((*MockKBFSOps)(nil).Truncate), ctx, file, size)
 }
 
+// PunchHole mocks base method
+func (m *MockKBFSOps) PunchHole(ctx context.Context, file Node, off, length uint64) error {
+	ret := m.ctrl.Call(m, "PunchHole", ctx, file, off, length)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PunchHole indicates an expected call of PunchHole
+func (mr *MockKBFSOpsMockRecorder) PunchHole(ctx, file, off, length interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PunchHole", reflect.TypeOf((*MockKBFSOps)(nil).PunchHole), ctx, file, off, length)
+}
+
+// SeekDataOrHole mocks base method
+func (m *MockKBFSOps) SeekDataOrHole(ctx context.Context, file Node, off uint64, hole bool) (uint64, error) {
+	ret := m.ctrl.Call(m, "SeekDataOrHole", ctx, file, off, hole)
+	ret0, _ := ret[0].(uint64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SeekDataOrHole indicates an expected call of SeekDataOrHole
+func (mr *MockKBFSOpsMockRecorder) SeekDataOrHole(ctx, file, off, hole interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SeekDataOrHole", reflect.TypeOf((*MockKBFSOps)(nil).SeekDataOrHole), ctx, file, off, hole)
+}
+
+// SetAutoConflictResolution mocks base method
+func (m *MockKBFSOps) SetAutoConflictResolution(ctx context.Context, folderBranch FolderBranch, enabled bool) error {
+	ret := m.ctrl.Call(m, "SetAutoConflictResolution", ctx, folderBranch, enabled)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetAutoConflictResolution indicates an expected call of SetAutoConflictResolution
+func (mr *MockKBFSOpsMockRecorder) SetAutoConflictResolution(ctx, folderBranch, enabled interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetAutoConflictResolution", reflect.TypeOf((*MockKBFSOps)(nil).SetAutoConflictResolution), ctx, folderBranch, enabled)
+}
+
 // SetEx mocks base method
 func (m *MockKBFSOps) SetEx(ctx context.Context, file Node, ex bool) error {
 	ret := m.ctrl.Call(m, "SetEx", ctx, file, ex)
@@ -1626,6 +1853,94 @@ func (mr *MockKBFSOpsMockRecorder) GetNodeMetadata(ctx, node interface{}) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetNodeMetadata", reflect.TypeOf((*MockKBFSOps)(nil).GetNodeMetadata), ctx, node)
 }
 
+// GetQuotaUsageBreakdown mocks base method
+func (m *MockKBFSOps) GetQuotaUsageBreakdown(ctx context.Context, dir Node, maxDepth int) (QuotaUsageBreakdown, error) {
+	ret := m.ctrl.Call(m, "GetQuotaUsageBreakdown", ctx, dir, maxDepth)
+	ret0, _ := ret[0].(QuotaUsageBreakdown)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetQuotaUsageBreakdown indicates an expected call of GetQuotaUsageBreakdown
+func (mr *MockKBFSOpsMockRecorder) GetQuotaUsageBreakdown(ctx, dir, maxDepth interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetQuotaUsageBreakdown", reflect.TypeOf((*MockKBFSOps)(nil).GetQuotaUsageBreakdown), ctx, dir, maxDepth)
+}
+
+// GetQuotaReclamationDryRun mocks base method
+func (m *MockKBFSOps) GetQuotaReclamationDryRun(ctx context.Context, folderBranch FolderBranch) (QuotaReclamationDryRun, error) {
+	ret := m.ctrl.Call(m, "GetQuotaReclamationDryRun", ctx, folderBranch)
+	ret0, _ := ret[0].(QuotaReclamationDryRun)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetQuotaReclamationDryRun indicates an expected call of GetQuotaReclamationDryRun
+func (mr *MockKBFSOpsMockRecorder) GetQuotaReclamationDryRun(ctx, folderBranch interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetQuotaReclamationDryRun", reflect.TypeOf((*MockKBFSOps)(nil).GetQuotaReclamationDryRun), ctx, folderBranch)
+}
+
+// ResolveConflicts mocks base method
+func (m *MockKBFSOps) ResolveConflicts(ctx context.Context, folderBranch FolderBranch, choices map[string]ConflictChoice) error {
+	ret := m.ctrl.Call(m, "ResolveConflicts", ctx, folderBranch, choices)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ResolveConflicts indicates an expected call of ResolveConflicts
+func (mr *MockKBFSOpsMockRecorder) ResolveConflicts(ctx, folderBranch, choices interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResolveConflicts", reflect.TypeOf((*MockKBFSOps)(nil).ResolveConflicts), ctx, folderBranch, choices)
+}
+
+// RestoreFromRevision mocks base method
+func (m *MockKBFSOps) RestoreFromRevision(ctx context.Context, node Node, rev kbfsmd.Revision) error {
+	ret := m.ctrl.Call(m, "RestoreFromRevision", ctx, node, rev)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RestoreFromRevision indicates an expected call of RestoreFromRevision
+func (mr *MockKBFSOpsMockRecorder) RestoreFromRevision(ctx, node, rev interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreFromRevision", reflect.TypeOf((*MockKBFSOps)(nil).RestoreFromRevision), ctx, node, rev)
+}
+
+// GetDeletedEntries mocks base method
+func (m *MockKBFSOps) GetDeletedEntries(ctx context.Context, folderBranch FolderBranch) ([]DeletedEntry, error) {
+	ret := m.ctrl.Call(m, "GetDeletedEntries", ctx, folderBranch)
+	ret0, _ := ret[0].([]DeletedEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDeletedEntries indicates an expected call of GetDeletedEntries
+func (mr *MockKBFSOpsMockRecorder) GetDeletedEntries(ctx, folderBranch interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDeletedEntries", reflect.TypeOf((*MockKBFSOps)(nil).GetDeletedEntries), ctx, folderBranch)
+}
+
+// DiffRevisions mocks base method
+func (m *MockKBFSOps) DiffRevisions(ctx context.Context, folderBranch FolderBranch, from, to kbfsmd.Revision) ([]RevisionDiff, error) {
+	ret := m.ctrl.Call(m, "DiffRevisions", ctx, folderBranch, from, to)
+	ret0, _ := ret[0].([]RevisionDiff)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DiffRevisions indicates an expected call of DiffRevisions
+func (mr *MockKBFSOpsMockRecorder) DiffRevisions(ctx, folderBranch, from, to interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DiffRevisions", reflect.TypeOf((*MockKBFSOps)(nil).DiffRevisions), ctx, folderBranch, from, to)
+}
+
+// UndeleteEntry mocks base method
+func (m *MockKBFSOps) UndeleteEntry(ctx context.Context, folderBranch FolderBranch, p string, rev kbfsmd.Revision) error {
+	ret := m.ctrl.Call(m, "UndeleteEntry", ctx, folderBranch, p, rev)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UndeleteEntry indicates an expected call of UndeleteEntry
+func (mr *MockKBFSOpsMockRecorder) UndeleteEntry(ctx, folderBranch, p, rev interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UndeleteEntry", reflect.TypeOf((*MockKBFSOps)(nil).UndeleteEntry), ctx, folderBranch, p, rev)
+}
+
 // Shutdown mocks base method
 func (m *MockKBFSOps) Shutdown(ctx context.Context) error {
 	ret := m.ctrl.Call(m, "Shutdown", ctx)
@@ -4872,6 +5187,16 @@ func (mr *MockPrefetcherMockRecorder) ProcessBlockForPrefetch(ctx, ptr, block, k
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ProcessBlockForPrefetch", reflect.TypeOf((*MockPrefetcher)(nil).ProcessBlockForPrefetch), ctx, ptr, block, kmd, priority, lifetime, prefetchStatus)
 }
 
+// ProcessBlockForSync mocks base method
+func (m *MockPrefetcher) ProcessBlockForSync(ctx context.Context, ptr BlockPointer, block Block, kmd KeyMetadata) {
+	m.ctrl.Call(m, "ProcessBlockForSync", ctx, ptr, block, kmd)
+}
+
+// ProcessBlockForSync indicates an expected call of ProcessBlockForSync
+func (mr *MockPrefetcherMockRecorder) ProcessBlockForSync(ctx, ptr, block, kmd interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ProcessBlockForSync", reflect.TypeOf((*MockPrefetcher)(nil).ProcessBlockForSync), ctx, ptr, block, kmd)
+}
+
 // CancelPrefetch mocks base method
 func (m *MockPrefetcher) CancelPrefetch(arg0 kbfsblock.ID) {
 	m.ctrl.Call(m, "CancelPrefetch", arg0)
@@ -7066,6 +7391,114 @@ func (mr *MockConfigMockRecorder) SetTlfSyncState(tlfID, isSynced interface{}) *
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetTlfSyncState", reflect.TypeOf((*MockConfig)(nil).SetTlfSyncState), tlfID, isSynced)
 }
 
+// GetTlfSyncPaths mocks base method
+func (m *MockConfig) GetTlfSyncPaths(tlfID tlf.ID) []string {
+	ret := m.ctrl.Call(m, "GetTlfSyncPaths", tlfID)
+	ret0, _ := ret[0].([]string)
+	return ret0
+}
+
+// GetTlfSyncPaths indicates an expected call of GetTlfSyncPaths
+func (mr *MockConfigMockRecorder) GetTlfSyncPaths(tlfID interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTlfSyncPaths", reflect.TypeOf((*MockConfig)(nil).GetTlfSyncPaths), tlfID)
+}
+
+// SetTlfSyncPaths mocks base method
+func (m *MockConfig) SetTlfSyncPaths(tlfID tlf.ID, paths []string) error {
+	ret := m.ctrl.Call(m, "SetTlfSyncPaths", tlfID, paths)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetTlfSyncPaths indicates an expected call of SetTlfSyncPaths
+func (mr *MockConfigMockRecorder) SetTlfSyncPaths(tlfID, paths interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetTlfSyncPaths", reflect.TypeOf((*MockConfig)(nil).SetTlfSyncPaths), tlfID, paths)
+}
+
+// GetPartiallySyncedTlfs mocks base method
+func (m *MockConfig) GetPartiallySyncedTlfs() []tlf.ID {
+	ret := m.ctrl.Call(m, "GetPartiallySyncedTlfs")
+	ret0, _ := ret[0].([]tlf.ID)
+	return ret0
+}
+
+// GetPartiallySyncedTlfs indicates an expected call of GetPartiallySyncedTlfs
+func (mr *MockConfigMockRecorder) GetPartiallySyncedTlfs() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPartiallySyncedTlfs", reflect.TypeOf((*MockConfig)(nil).GetPartiallySyncedTlfs))
+}
+
+// GetDiskCacheTlfSettings mocks base method
+func (m *MockConfig) GetDiskCacheTlfSettings(tlfID tlf.ID) DiskCacheTlfSettings {
+	ret := m.ctrl.Call(m, "GetDiskCacheTlfSettings", tlfID)
+	ret0, _ := ret[0].(DiskCacheTlfSettings)
+	return ret0
+}
+
+// GetDiskCacheTlfSettings indicates an expected call of GetDiskCacheTlfSettings
+func (mr *MockConfigMockRecorder) GetDiskCacheTlfSettings(tlfID interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDiskCacheTlfSettings", reflect.TypeOf((*MockConfig)(nil).GetDiskCacheTlfSettings), tlfID)
+}
+
+// SetDiskCacheTlfSettings mocks base method
+func (m *MockConfig) SetDiskCacheTlfSettings(ctx context.Context, tlfID tlf.ID, settings DiskCacheTlfSettings) error {
+	ret := m.ctrl.Call(m, "SetDiskCacheTlfSettings", ctx, tlfID, settings)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetDiskCacheTlfSettings indicates an expected call of SetDiskCacheTlfSettings
+func (mr *MockConfigMockRecorder) SetDiskCacheTlfSettings(ctx, tlfID, settings interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetDiskCacheTlfSettings", reflect.TypeOf((*MockConfig)(nil).SetDiskCacheTlfSettings), ctx, tlfID, settings)
+}
+
+// GetQuotaReclamationTlfPolicy mocks base method
+func (m *MockConfig) GetQuotaReclamationTlfPolicy(tlfID tlf.ID) QuotaReclamationTlfPolicy {
+	ret := m.ctrl.Call(m, "GetQuotaReclamationTlfPolicy", tlfID)
+	ret0, _ := ret[0].(QuotaReclamationTlfPolicy)
+	return ret0
+}
+
+// GetQuotaReclamationTlfPolicy indicates an expected call of GetQuotaReclamationTlfPolicy
+func (mr *MockConfigMockRecorder) GetQuotaReclamationTlfPolicy(tlfID interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetQuotaReclamationTlfPolicy", reflect.TypeOf((*MockConfig)(nil).GetQuotaReclamationTlfPolicy), tlfID)
+}
+
+// SetQuotaReclamationTlfPolicy mocks base method
+func (m *MockConfig) SetQuotaReclamationTlfPolicy(tlfID tlf.ID, policy QuotaReclamationTlfPolicy) error {
+	ret := m.ctrl.Call(m, "SetQuotaReclamationTlfPolicy", tlfID, policy)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetQuotaReclamationTlfPolicy indicates an expected call of SetQuotaReclamationTlfPolicy
+func (mr *MockConfigMockRecorder) SetQuotaReclamationTlfPolicy(tlfID, policy interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetQuotaReclamationTlfPolicy", reflect.TypeOf((*MockConfig)(nil).SetQuotaReclamationTlfPolicy), tlfID, policy)
+}
+
+// GetConflictRenameTemplate mocks base method
+func (m *MockConfig) GetConflictRenameTemplate(tlfID tlf.ID) string {
+	ret := m.ctrl.Call(m, "GetConflictRenameTemplate", tlfID)
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// GetConflictRenameTemplate indicates an expected call of GetConflictRenameTemplate
+func (mr *MockConfigMockRecorder) GetConflictRenameTemplate(tlfID interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetConflictRenameTemplate", reflect.TypeOf((*MockConfig)(nil).GetConflictRenameTemplate), tlfID)
+}
+
+// SetConflictRenameTemplate mocks base method
+func (m *MockConfig) SetConflictRenameTemplate(tlfID tlf.ID, text string) error {
+	ret := m.ctrl.Call(m, "SetConflictRenameTemplate", tlfID, text)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetConflictRenameTemplate indicates an expected call of SetConflictRenameTemplate
+func (mr *MockConfigMockRecorder) SetConflictRenameTemplate(tlfID, text interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetConflictRenameTemplate", reflect.TypeOf((*MockConfig)(nil).SetConflictRenameTemplate), tlfID, text)
+}
+
 // Mode mocks base method
 func (m *MockConfig) Mode() InitMode {
 	ret := m.ctrl.Call(m, "Mode")
@@ -7112,6 +7545,18 @@ func (mr *MockConfigMockRecorder) MaybeFinishTrace(ctx, err interface{}) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MaybeFinishTrace", reflect.TypeOf((*MockConfig)(nil).MaybeFinishTrace), ctx, err)
 }
 
+// SpanExporter mocks base method
+func (m *MockConfig) SpanExporter() SpanExporter {
+	ret := m.ctrl.Call(m, "SpanExporter")
+	ret0, _ := ret[0].(SpanExporter)
+	return ret0
+}
+
+// SpanExporter indicates an expected call of SpanExporter
+func (mr *MockConfigMockRecorder) SpanExporter() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SpanExporter", reflect.TypeOf((*MockConfig)(nil).SpanExporter))
+}
+
 // KBFSOps mocks base method
 func (m *MockConfig) KBFSOps() KBFSOps {
 	ret := m.ctrl.Call(m, "KBFSOps")
@@ -7546,6 +7991,28 @@ func (mr *MockConfigMockRecorder) SetConflictRenamer(arg0 interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetConflictRenamer", reflect.TypeOf((*MockConfig)(nil).SetConflictRenamer), arg0)
 }
 
+// ConflictMergeGlobs mocks base method
+func (m *MockConfig) ConflictMergeGlobs() []string {
+	ret := m.ctrl.Call(m, "ConflictMergeGlobs")
+	ret0, _ := ret[0].([]string)
+	return ret0
+}
+
+// ConflictMergeGlobs indicates an expected call of ConflictMergeGlobs
+func (mr *MockConfigMockRecorder) ConflictMergeGlobs() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConflictMergeGlobs", reflect.TypeOf((*MockConfig)(nil).ConflictMergeGlobs))
+}
+
+// SetConflictMergeGlobs mocks base method
+func (m *MockConfig) SetConflictMergeGlobs(globs []string) {
+	m.ctrl.Call(m, "SetConflictMergeGlobs", globs)
+}
+
+// SetConflictMergeGlobs indicates an expected call of SetConflictMergeGlobs
+func (mr *MockConfigMockRecorder) SetConflictMergeGlobs(globs interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetConflictMergeGlobs", reflect.TypeOf((*MockConfig)(nil).SetConflictMergeGlobs), globs)
+}
+
 // UserHistory mocks base method
 func (m *MockConfig) UserHistory() *kbfsedits.UserHistory {
 	ret := m.ctrl.Call(m, "UserHistory")
@@ -7568,6 +8035,28 @@ func (mr *MockConfigMockRecorder) SetUserHistory(arg0 interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUserHistory", reflect.TypeOf((*MockConfig)(nil).SetUserHistory), arg0)
 }
 
+// LockManager mocks base method
+func (m *MockConfig) LockManager() LockManager {
+	ret := m.ctrl.Call(m, "LockManager")
+	ret0, _ := ret[0].(LockManager)
+	return ret0
+}
+
+// LockManager indicates an expected call of LockManager
+func (mr *MockConfigMockRecorder) LockManager() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LockManager", reflect.TypeOf((*MockConfig)(nil).LockManager))
+}
+
+// SetLockManager mocks base method
+func (m *MockConfig) SetLockManager(arg0 LockManager) {
+	m.ctrl.Call(m, "SetLockManager", arg0)
+}
+
+// SetLockManager indicates an expected call of SetLockManager
+func (mr *MockConfigMockRecorder) SetLockManager(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetLockManager", reflect.TypeOf((*MockConfig)(nil).SetLockManager), arg0)
+}
+
 // MetadataVersion mocks base method
 func (m *MockConfig) MetadataVersion() kbfsmd.MetadataVer {
 	ret := m.ctrl.Call(m, "MetadataVersion")
@@ -7802,6 +8291,16 @@ func (mr *MockConfigMockRecorder) SetTraceOptions(enabled interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetTraceOptions", reflect.TypeOf((*MockConfig)(nil).SetTraceOptions), enabled)
 }
 
+// SetSpanExporter mocks base method
+func (m *MockConfig) SetSpanExporter(arg0 SpanExporter) {
+	m.ctrl.Call(m, "SetSpanExporter", arg0)
+}
+
+// SetSpanExporter indicates an expected call of SetSpanExporter
+func (mr *MockConfigMockRecorder) SetSpanExporter(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetSpanExporter", reflect.TypeOf((*MockConfig)(nil).SetSpanExporter), arg0)
+}
+
 // TLFValidDuration mocks base method
 func (m *MockConfig) TLFValidDuration() time.Duration {
 	ret := m.ctrl.Call(m, "TLFValidDuration")
@@ -7926,6 +8425,16 @@ func (mr *MockConfigMockRecorder) AddRootNodeWrapper(arg0 interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddRootNodeWrapper", reflect.TypeOf((*MockConfig)(nil).AddRootNodeWrapper), arg0)
 }
 
+// AddTlfSyncStateHandler mocks base method
+func (m *MockConfig) AddTlfSyncStateHandler(arg0 func(tlf.ID, bool)) {
+	m.ctrl.Call(m, "AddTlfSyncStateHandler", arg0)
+}
+
+// AddTlfSyncStateHandler indicates an expected call of AddTlfSyncStateHandler
+func (mr *MockConfigMockRecorder) AddTlfSyncStateHandler(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddTlfSyncStateHandler", reflect.TypeOf((*MockConfig)(nil).AddTlfSyncStateHandler), arg0)
+}
+
 // MockNodeCache is a mock of NodeCache interface
 type MockNodeCache struct {
 	ctrl     *gomock.Controller
@@ -8152,6 +8661,88 @@ func (mr *MockcrActionMockRecorder) String() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "String", reflect.TypeOf((*MockcrAction)(nil).String))
 }
 
+// MockLockManager is a mock of LockManager interface
+type MockLockManager struct {
+	ctrl     *gomock.Controller
+	recorder *MockLockManagerMockRecorder
+}
+
+// MockLockManagerMockRecorder is the mock recorder for MockLockManager
+type MockLockManagerMockRecorder struct {
+	mock *MockLockManager
+}
+
+// NewMockLockManager creates a new mock instance
+func NewMockLockManager(ctrl *gomock.Controller) *MockLockManager {
+	mock := &MockLockManager{ctrl: ctrl}
+	mock.recorder = &MockLockManagerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockLockManager) EXPECT() *MockLockManagerMockRecorder {
+	return m.recorder
+}
+
+// Lock mocks base method
+func (m *MockLockManager) Lock(ctx context.Context, fb FolderBranch, lockID keybase1.LockID, owner uint64, priority keybase1.MDPriority) error {
+	ret := m.ctrl.Call(m, "Lock", ctx, fb, lockID, owner, priority)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Lock indicates an expected call of Lock
+func (mr *MockLockManagerMockRecorder) Lock(ctx, fb, lockID, owner, priority interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Lock", reflect.TypeOf((*MockLockManager)(nil).Lock), ctx, fb, lockID, owner, priority)
+}
+
+// TryLock mocks base method
+func (m *MockLockManager) TryLock(ctx context.Context, fb FolderBranch, lockID keybase1.LockID, owner uint64, priority keybase1.MDPriority, timeout time.Duration) error {
+	ret := m.ctrl.Call(m, "TryLock", ctx, fb, lockID, owner, priority, timeout)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TryLock indicates an expected call of TryLock
+func (mr *MockLockManagerMockRecorder) TryLock(ctx, fb, lockID, owner, priority, timeout interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TryLock", reflect.TypeOf((*MockLockManager)(nil).TryLock), ctx, fb, lockID, owner, priority, timeout)
+}
+
+// Unlock mocks base method
+func (m *MockLockManager) Unlock(ctx context.Context, fb FolderBranch, lockID keybase1.LockID, owner uint64, priority keybase1.MDPriority) error {
+	ret := m.ctrl.Call(m, "Unlock", ctx, fb, lockID, owner, priority)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Unlock indicates an expected call of Unlock
+func (mr *MockLockManagerMockRecorder) Unlock(ctx, fb, lockID, owner, priority interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unlock", reflect.TypeOf((*MockLockManager)(nil).Unlock), ctx, fb, lockID, owner, priority)
+}
+
+// QueryLock mocks base method
+func (m *MockLockManager) QueryLock(fb FolderBranch, lockID keybase1.LockID) (uint64, bool) {
+	ret := m.ctrl.Call(m, "QueryLock", fb, lockID)
+	ret0, _ := ret[0].(uint64)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+// QueryLock indicates an expected call of QueryLock
+func (mr *MockLockManagerMockRecorder) QueryLock(fb, lockID interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueryLock", reflect.TypeOf((*MockLockManager)(nil).QueryLock), fb, lockID)
+}
+
+// Shutdown mocks base method
+func (m *MockLockManager) Shutdown() {
+	m.ctrl.Call(m, "Shutdown")
+}
+
+// Shutdown indicates an expected call of Shutdown
+func (mr *MockLockManagerMockRecorder) Shutdown() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Shutdown", reflect.TypeOf((*MockLockManager)(nil).Shutdown))
+}
+
 // MockRekeyQueue is a mock of RekeyQueue interface
 type MockRekeyQueue struct {
 	ctrl     *gomock.Controller
@@ -427,8 +427,8 @@ func (co *createOp) checkConflict(
 				// Rename the merged entry only if the unmerged one is
 				// a directory (or to-be-sympath'd directory) and the
 				// merged one is not.
-				toName, err := renamer.ConflictRename(
-					ctx, mergedOp, co.NewName)
+				toName, err := conflictRenameInPlace(
+					ctx, renamer, mergedOp, co.NewName)
 				if err != nil {
 					return nil, err
 				}
@@ -439,8 +439,8 @@ func (co *createOp) checkConflict(
 				}, nil
 			}
 			// Otherwise rename the unmerged entry (guaranteed to be a file).
-			toName, err := renamer.ConflictRename(
-				ctx, co, co.NewName)
+			toName, err := conflictRenameInPlace(
+				ctx, renamer, co, co.NewName)
 			if err != nil {
 				return nil, err
 			}
@@ -460,8 +460,8 @@ func (co *createOp) checkConflict(
 		if sameName && realMergedOp.Type == Dir && co.Type == Dir &&
 			(realMergedOp.renamed || co.renamed) {
 			// Always rename the unmerged one
-			toName, err := renamer.ConflictRename(
-				ctx, co, co.NewName)
+			toName, err := conflictRenameInPlace(
+				ctx, renamer, co, co.NewName)
 			if err != nil {
 				return nil, err
 			}
@@ -953,11 +953,12 @@ func (so *syncOp) checkConflict(
 		}
 
 		return &renameUnmergedAction{
-			fromName: so.getFinalPath().tailName(),
-			toName:   toName,
+			fromName:                 so.getFinalPath().tailName(),
+			toName:                   toName,
 			unmergedParentMostRecent: so.getFinalPath().parentPath().tailPointer(),
 			mergedParentMostRecent: mergedOp.getFinalPath().parentPath().
 				tailPointer(),
+			contentConflict: true,
 		}, nil
 	case *setAttrOp:
 		// Someone on the merged path explicitly set an attribute, so
@@ -1241,7 +1242,8 @@ func (sao *setAttrOp) checkConflict(
 			// A set attr for the same attribute on the same file is a
 			// conflict.
 			fromName := sao.getFinalPath().tailName()
-			toName, err := renamer.ConflictRename(ctx, sao, fromName)
+			toName, err := conflictRenameInPlace(
+				ctx, renamer, sao, fromName)
 			if err != nil {
 				return nil, err
 			}
@@ -42,6 +42,10 @@ type prefetchRequest struct {
 	lifetime       BlockCacheLifetime
 	prefetchStatus PrefetchStatus
 	isDeepSync     bool
+	// parentSpan, if non-nil, is the span of the operation that led
+	// to this prefetch, so the prefetch's fetches can be traced as
+	// its children.
+	parentSpan *Span
 }
 
 type ctxPrefetcherTagKey int
@@ -132,6 +136,7 @@ func (p *blockPrefetcher) newPrefetch(count int, triggered bool,
 	ctx, cancel := context.WithTimeout(p.ctx, prefetchTimeout)
 	ctx = CtxWithRandomIDReplayable(
 		ctx, ctxPrefetchIDKey, ctxPrefetchID, p.log)
+	ctx = contextWithSpan(ctx, req.parentSpan)
 	return &prefetch{
 		subtreeBlockCount: count,
 		subtreeTriggered:  triggered,
@@ -254,16 +259,35 @@ top:
 	p.almostDoneCh <- struct{}{}
 }
 
-// calculatePriority returns either a base priority for an unsynced TLF or a
-// high priority for a synced TLF.
+// calculatePriority returns either a base priority for a regular
+// prefetch or a high priority for a deep sync.
 func (p *blockPrefetcher) calculatePriority(basePriority int,
-	tlfID tlf.ID) int {
-	if p.config.IsSyncedTlf(tlfID) {
+	isDeepSync bool) int {
+	if isDeepSync {
 		return defaultOnDemandRequestPriority - 1
 	}
 	return basePriority
 }
 
+// isPartialSync returns true if the given request is a deep sync of a
+// subtree of a TLF that isn't synced as a whole.
+func (p *blockPrefetcher) isPartialSync(req *prefetchRequest) bool {
+	return req.isDeepSync && !p.config.IsSyncedTlf(req.kmd.TlfID())
+}
+
+// moveToSyncCache moves the block for the given partial sync request
+// from the disk working set cache into the disk sync cache, and
+// returns true if it did so.  This is a no-op for blocks that are
+// already in the sync cache.
+func (p *blockPrefetcher) moveToSyncCache(
+	ctx context.Context, req *prefetchRequest) (bool, error) {
+	dbc, ok := p.config.DiskBlockCache().(*diskBlockCacheWrapped)
+	if !ok {
+		return false, nil
+	}
+	return dbc.moveBlockToSyncCache(ctx, req.kmd.TlfID(), req.ptr.ID)
+}
+
 // request maps the parent->child block relationship in the prefetcher, and it
 // triggers child prefetches that aren't already in progress.
 func (p *blockPrefetcher) request(ctx context.Context, priority int,
@@ -277,7 +301,7 @@ func (p *blockPrefetcher) request(ctx context.Context, priority int,
 		// If the block isn't in the tree, we add it with a block count of 1 (a
 		// later TriggerPrefetch will come in and decrement it).
 		req := &prefetchRequest{ptr, block, kmd, priority, lifetime,
-			NoPrefetch, isDeepSync}
+			NoPrefetch, isDeepSync, spanFromContext(ctx)}
 		pre = p.newPrefetch(1, false, req)
 		p.prefetches[ptr.ID] = pre
 		ch := p.retriever.Request(pre.ctx, priority, kmd, ptr, block, lifetime)
@@ -311,7 +335,7 @@ func (p *blockPrefetcher) prefetchIndirectFileBlock(ctx context.Context,
 	isTail bool) {
 	// Prefetch indirect block pointers.
 	startingPriority :=
-		p.calculatePriority(fileIndirectBlockPrefetchPriority, kmd.TlfID())
+		p.calculatePriority(fileIndirectBlockPrefetchPriority, isDeepSync)
 	for i, ptr := range b.IPtrs {
 		numBlocks += p.request(ctx, startingPriority-i, kmd,
 			ptr.BlockPointer, b.NewEmpty(), lifetime,
@@ -326,7 +350,7 @@ func (p *blockPrefetcher) prefetchIndirectDirBlock(ctx context.Context,
 	isTail bool) {
 	// Prefetch indirect block pointers.
 	startingPriority :=
-		p.calculatePriority(fileIndirectBlockPrefetchPriority, kmd.TlfID())
+		p.calculatePriority(fileIndirectBlockPrefetchPriority, isDeepSync)
 	for i, ptr := range b.IPtrs {
 		numBlocks += p.request(ctx, startingPriority-i, kmd,
 			ptr.BlockPointer, b.NewEmpty(), lifetime,
@@ -343,7 +367,7 @@ func (p *blockPrefetcher) prefetchDirectDirBlock(ctx context.Context,
 	dirEntries := dirEntriesBySizeAsc{dirEntryMapToDirEntries(b.Children)}
 	sort.Sort(dirEntries)
 	startingPriority :=
-		p.calculatePriority(dirEntryPrefetchPriority, kmd.TlfID())
+		p.calculatePriority(dirEntryPrefetchPriority, isDeepSync)
 	totalChildEntries := 0
 	for i, entry := range dirEntries.dirEntries {
 		// Prioritize small files
@@ -393,6 +417,16 @@ func (p *blockPrefetcher) handlePrefetch(pre *prefetch, isPrefetchNew,
 			"prefetch: %+v", req.ptr.ID, err)
 		return 0, false, err
 	}
+	if p.isPartialSync(req) {
+		// Now that the block is definitely in the disk cache, make
+		// sure it's in the sync cache, since this subtree is synced.
+		_, err = p.moveToSyncCache(pre.ctx, req)
+		if err != nil {
+			p.log.CDebugf(pre.ctx, "failed to move block %s to the sync "+
+				"cache: %+v", req.ptr.ID, err)
+			return 0, false, err
+		}
+	}
 	switch b := b.(type) {
 	case *FileBlock:
 		if b.IsInd {
@@ -499,6 +533,38 @@ func (p *blockPrefetcher) run(testSyncCh <-chan struct{}) {
 			ctx := context.TODO()
 			if isPrefetchWaiting {
 				ctx = pre.ctx
+				if pre.req.isDeepSync && !req.isDeepSync {
+					// A parent of this block was deep-synced, even
+					// though the TLF as a whole might not be, so this
+					// block needs to be deep-synced as well.
+					req.isDeepSync = true
+				}
+			}
+			if req.prefetchStatus == FinishedPrefetch && p.isPartialSync(req) {
+				// A block that finished prefetching into the working
+				// set now needs its whole subtree moved into the sync
+				// cache, so walk it again.
+				moved, err := p.moveToSyncCache(ctx, req)
+				if err != nil {
+					p.log.CWarningf(ctx, "error moving block %s to the "+
+						"sync cache: %+v", req.ptr.ID, err)
+					if isPrefetchWaiting {
+						p.applyToParentsRecursive(p.cancelPrefetch,
+							req.ptr.ID, pre)
+					}
+					continue
+				}
+				if moved {
+					// Record that the subtree isn't done yet, in case
+					// this walk gets interrupted.
+					req.prefetchStatus = TriggeredPrefetch
+					err = p.config.DiskBlockCache().UpdateMetadata(
+						ctx, req.ptr.ID, TriggeredPrefetch)
+					if err != nil {
+						p.log.CDebugf(ctx, "error updating the metadata "+
+							"for block %s: %+v", req.ptr.ID, err)
+					}
+				}
 			}
 			if req.prefetchStatus == FinishedPrefetch {
 				// First we handle finished prefetches.
@@ -693,7 +759,7 @@ func (p *blockPrefetcher) ProcessBlockForPrefetch(ctx context.Context,
 	lifetime BlockCacheLifetime, prefetchStatus PrefetchStatus) {
 	isDeepSync := p.config.IsSyncedTlf(kmd.TlfID())
 	req := &prefetchRequest{ptr, block.NewEmpty(), kmd, priority, lifetime,
-		prefetchStatus, isDeepSync}
+		prefetchStatus, isDeepSync, spanFromContext(ctx)}
 	if prefetchStatus == FinishedPrefetch {
 		// Finished prefetches can always be short circuited.
 		// If we're here, then FinishedPrefetch is already cached.
@@ -726,6 +792,17 @@ func (p *blockPrefetcher) ProcessBlockForPrefetch(ctx context.Context,
 	p.triggerPrefetch(req)
 }
 
+// ProcessBlockForSync implements the Prefetcher interface for
+// blockPrefetcher.
+func (p *blockPrefetcher) ProcessBlockForSync(ctx context.Context,
+	ptr BlockPointer, block Block, kmd KeyMetadata) {
+	p.log.CDebugf(ctx, "triggering a deep sync for block %s", ptr.ID)
+	req := &prefetchRequest{ptr, block.NewEmpty(), kmd,
+		defaultOnDemandRequestPriority - 1, TransientEntry, NoPrefetch, true,
+		spanFromContext(ctx)}
+	p.triggerPrefetch(req)
+}
+
 func (p *blockPrefetcher) CancelPrefetch(blockID kbfsblock.ID) {
 	select {
 	case p.prefetchCancelCh.In() <- blockID:
@@ -1081,6 +1081,91 @@ func TestSyncBlockCacheWithPrefetcher(t *testing.T) {
 	waitForPrefetchOrBust(t, q.Prefetcher().Shutdown())
 }
 
+func TestPrefetcherPartialSyncWithDiskCache(t *testing.T) {
+	t.Log("Test that syncing a subtree of an unsynced TLF moves just " +
+		"that subtree into the sync cache.")
+	cache, dbcConfig := initDiskBlockCacheTest(t)
+	q, bg, config := initPrefetcherTestWithDiskCache(t, cache)
+	defer shutdownPrefetcherTest(q)
+	ctx := context.Background()
+	kmd := makeKMD()
+	prefetchSyncCh := make(chan struct{})
+	q.TogglePrefetcher(true, prefetchSyncCh)
+	notifySyncCh(t, prefetchSyncCh)
+
+	syncCache := cache.syncCache
+	workingCache := cache.workingSetCache
+
+	t.Log("Initialize a folder tree with structure: " +
+		"root -> {b, a -> {ab, aa}}")
+	rootPtr := makeRandomBlockPointer(t)
+	root := &DirBlock{Children: map[string]DirEntry{
+		"a": makeRandomDirEntry(t, Dir, 10, "a"),
+		"b": makeRandomDirEntry(t, File, 20, "b"),
+	}}
+	aPtr := root.Children["a"].BlockPointer
+	a := &DirBlock{Children: map[string]DirEntry{
+		"aa": makeRandomDirEntry(t, File, 30, "aa"),
+		"ab": makeRandomDirEntry(t, File, 40, "ab"),
+	}}
+	bPtr := root.Children["b"].BlockPointer
+	b := makeFakeFileBlock(t, true)
+	aaPtr := a.Children["aa"].BlockPointer
+	aa := makeFakeFileBlock(t, true)
+	abPtr := a.Children["ab"].BlockPointer
+	ab := makeFakeFileBlock(t, true)
+
+	t.Log("Sync only the subtree rooted at \"a\".")
+	syncPaths := []string{"a"}
+	err := config.SetTlfSyncPaths(kmd.TlfID(), syncPaths)
+	require.NoError(t, err)
+	err = dbcConfig.SetTlfSyncPaths(kmd.TlfID(), syncPaths)
+	require.NoError(t, err)
+
+	t.Log("Put all the blocks in the working set cache.")
+	blocks := map[BlockPointer]Block{
+		rootPtr: root, aPtr: a, bPtr: b, aaPtr: aa, abPtr: ab}
+	for ptr, block := range blocks {
+		enc, serverHalf := setupRealBlockForDiskCache(t, ptr, block, dbcConfig)
+		_, _ = bg.setBlockToReturn(ptr, block)
+		err := cache.Put(ctx, kmd.TlfID(), ptr.ID, enc, serverHalf)
+		require.NoError(t, err)
+	}
+	require.Equal(t, 5, workingCache.numBlocks)
+	require.Equal(t, 0, syncCache.numBlocks)
+
+	t.Log("Trigger the sync of \"a\".")
+	q.Prefetcher().ProcessBlockForSync(ctx, aPtr, &DirBlock{}, kmd)
+	// Release after prefetching a
+	notifySyncCh(t, prefetchSyncCh)
+	// Release after prefetching aa
+	notifySyncCh(t, prefetchSyncCh)
+	// Release after prefetching ab
+	notifySyncCh(t, prefetchSyncCh)
+	waitForPrefetchOrBust(t, q.Prefetcher().Shutdown())
+
+	t.Log("Only the blocks of \"a\" should have moved to the sync cache.")
+	for _, ptr := range []BlockPointer{aPtr, aaPtr, abPtr} {
+		_, _, prefetchStatus, err := syncCache.Get(ctx, kmd.TlfID(), ptr.ID)
+		require.NoError(t, err)
+		require.Equal(t, FinishedPrefetch, prefetchStatus)
+		_, _, _, err = workingCache.Get(ctx, kmd.TlfID(), ptr.ID)
+		require.IsType(t, NoSuchBlockError{}, err)
+	}
+	for _, ptr := range []BlockPointer{rootPtr, bPtr} {
+		_, _, _, err := workingCache.Get(ctx, kmd.TlfID(), ptr.ID)
+		require.NoError(t, err)
+		_, _, _, err = syncCache.Get(ctx, kmd.TlfID(), ptr.ID)
+		require.IsType(t, NoSuchBlockError{}, err)
+	}
+	testPrefetcherCheckGet(t, config.BlockCache(), aPtr, a,
+		FinishedPrefetch, TransientEntry)
+	testPrefetcherCheckGet(t, config.BlockCache(), aaPtr, aa,
+		FinishedPrefetch, TransientEntry)
+	testPrefetcherCheckGet(t, config.BlockCache(), abPtr, ab,
+		FinishedPrefetch, TransientEntry)
+}
+
 func TestPrefetcherBasicUnsyncedPrefetch(t *testing.T) {
 	t.Log("Test basic unsynced prefetching with only 2 blocks.")
 	q, bg, config := initPrefetcherTest(t)
@@ -0,0 +1,113 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"time"
+
+	"github.com/keybase/kbfs/kbfsmd"
+	"github.com/keybase/kbfs/tlf"
+)
+
+// QuotaReclamationTlfPolicy is the quota reclamation policy for a
+// single TLF.  Any nil field falls back to the corresponding global
+// default from the InitMode; a pointer to zero explicitly sets that
+// field to zero.
+//
+// Policies are stored in the local config directory, so they only
+// apply to quota reclamation run by this device; other devices
+// writing to the same TLF keep their own policies.
+type QuotaReclamationTlfPolicy struct {
+	// MinUnrefAge is how much history is kept: blocks unreferenced
+	// more recently than this are never reclaimed.
+	MinUnrefAge *time.Duration `codec:",omitempty"`
+	// MinHeadAge is how old the head must be before reclaiming, if
+	// it was written by another device.  Zero means a head written
+	// by another device is never reclaimed.
+	MinHeadAge *time.Duration `codec:",omitempty"`
+	// Period is how often quota reclamation runs for the TLF.  Zero
+	// turns off automatic reclamation.
+	Period *time.Duration `codec:",omitempty"`
+}
+
+// quotaReclamationPolicy is a QuotaReclamationTlfPolicy with the
+// global defaults filled in.
+type quotaReclamationPolicy struct {
+	MinUnrefAge time.Duration
+	MinHeadAge  time.Duration
+	Period      time.Duration
+}
+
+// withDefaults returns the values of this policy, with each nil field
+// replaced by the global default from `mode`.
+func (p QuotaReclamationTlfPolicy) withDefaults(
+	mode InitMode) quotaReclamationPolicy {
+	effective := quotaReclamationPolicy{
+		MinUnrefAge: mode.QuotaReclamationMinUnrefAge(),
+		MinHeadAge:  mode.QuotaReclamationMinHeadAge(),
+		Period:      mode.QuotaReclamationPeriod(),
+	}
+	if p.MinUnrefAge != nil {
+		effective.MinUnrefAge = *p.MinUnrefAge
+	}
+	if p.MinHeadAge != nil {
+		effective.MinHeadAge = *p.MinHeadAge
+	}
+	if p.Period != nil {
+		effective.Period = *p.Period
+	}
+	return effective
+}
+
+// effectiveQuotaReclamationPolicy returns the quota reclamation
+// policy that applies to the given TLF.
+func effectiveQuotaReclamationPolicy(
+	config Config, tlfID tlf.ID) quotaReclamationPolicy {
+	return config.GetQuotaReclamationTlfPolicy(tlfID).withDefaults(
+		config.Mode())
+}
+
+// QuotaReclamationStatus describes the quota reclamation policy in
+// effect for a folder, and the result of its last quota reclamation.
+// It is suitable for encoding directly as JSON.
+type QuotaReclamationStatus struct {
+	// IsCustomPolicy is true if the folder has its own policy, as
+	// opposed to only using the global defaults.
+	IsCustomPolicy bool
+	MinUnrefAge    string
+	MinHeadAge     string
+	Period         string
+
+	LastQRTime time.Time `json:",omitempty"`
+	// LastQRHeadRevision is the head revision as of the last quota
+	// reclamation, and LastQROldEnoughRevision is the most recent
+	// revision whose unreferenced blocks were old enough to reclaim.
+	LastQRHeadRevision      kbfsmd.Revision
+	LastQROldEnoughRevision kbfsmd.Revision
+	LastQRComplete          bool
+	LastQRNumBlocks         int
+	LastQRError             string `json:",omitempty"`
+}
+
+// QuotaReclamationDryRun describes what the next quota reclamation
+// of a folder would delete, without deleting anything.  It is
+// suitable for encoding directly as JSON.
+type QuotaReclamationDryRun struct {
+	Status QuotaReclamationStatus
+	// HeadRevision is the most recent fully-merged revision.
+	HeadRevision kbfsmd.Revision
+	// LastGCRevision is the latest revision already reclaimed.
+	LastGCRevision kbfsmd.Revision
+	// The blocks unreferenced by the revisions after
+	// LastGCRevision, up to and including LatestRevision, would be
+	// reclaimed.  LatestRevision is RevisionUninitialized if
+	// nothing would be reclaimed.
+	LatestRevision kbfsmd.Revision
+	NumBlocks      int
+	Bytes          uint64
+	// Complete is false if the reclamation would be split up, and
+	// some old-enough revisions would be left for later runs.
+	Complete bool
+}
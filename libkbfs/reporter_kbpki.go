@@ -5,6 +5,7 @@
 package libkbfs
 
 import (
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
@@ -35,6 +36,9 @@ const (
 	errorParamFolderLimit         = "folderLimit"
 	errorParamApplicationExecPath = "applicationExecPath"
 
+	// notification param keys
+	notifyParamConflicts = "conflicts"
+
 	// error operation modes
 	errorModeRead  = "read"
 	errorModeWrite = "write"
@@ -409,6 +413,27 @@ func connectionNotification(status keybase1.FSStatusCode) *keybase1.FSNotificati
 	}
 }
 
+// conflictNotification creates an FSNotification listing the
+// entries of a TLF that were renamed during a conflict resolution,
+// as a JSON list under the "conflicts" param.
+func conflictNotification(handle *TlfHandle,
+	conflicts []crConflictedPath) (*keybase1.FSNotification, error) {
+	conflictsJSON, err := json.Marshal(conflicts)
+	if err != nil {
+		return nil, err
+	}
+	return &keybase1.FSNotification{
+		FolderType:       handle.Type().FolderType(),
+		Filename:         string(handle.GetCanonicalPath()),
+		StatusCode:       keybase1.FSStatusCode_FINISH,
+		NotificationType: keybase1.FSNotificationType_FILE_RENAMED,
+		Params: map[string]string{
+			errorParamTlf:        string(handle.GetCanonicalName()),
+			notifyParamConflicts: string(conflictsJSON),
+		},
+	}, nil
+}
+
 // baseNotification creates a basic FSNotification without a
 // NotificationType from a path.
 func baseNotification(file path, finish bool) *keybase1.FSNotification {
@@ -0,0 +1,441 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/keybase/kbfs/kbfsblock"
+	"github.com/keybase/kbfs/kbfsmd"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// pathFromRoot returns the slash-separated names of `p`, relative to
+// the TLF root.
+func pathFromRoot(p path) string {
+	names := make([]string, 0, len(p.path))
+	for _, pn := range p.path[1:] {
+		names = append(names, pn.Name)
+	}
+	return strings.Join(names, "/")
+}
+
+func childPathFromRoot(parent path, name string) string {
+	if !parent.hasValidParent() {
+		return name
+	}
+	return pathFromRoot(parent) + "/" + name
+}
+
+// revisionDiffBuilder collects the changes found for a revision
+// range, merging multiple changes for the same path.
+type revisionDiffBuilder struct {
+	diffs map[string]RevisionDiff
+	// parents and names record where to look up the final size and
+	// type of each non-removed diff.
+	parents map[string]path
+	names   map[string]string
+}
+
+func newRevisionDiffBuilder() *revisionDiffBuilder {
+	return &revisionDiffBuilder{
+		diffs:   make(map[string]RevisionDiff),
+		parents: make(map[string]path),
+		names:   make(map[string]string),
+	}
+}
+
+func (rdb *revisionDiffBuilder) add(
+	d RevisionDiff, parent path, name string) {
+	if existing, ok := rdb.diffs[d.Path]; ok {
+		switch {
+		case existing.Type == RevisionDiffRemoved &&
+			d.Type == RevisionDiffCreated,
+			existing.Type == RevisionDiffCreated &&
+				d.Type == RevisionDiffRemoved:
+			// The entry was replaced by another one with the same
+			// name.
+			d.Type = RevisionDiffModified
+		case d.Type == RevisionDiffModified:
+			// Any more specific change wins.
+			return
+		}
+	}
+	rdb.diffs[d.Path] = d
+	if d.Type != RevisionDiffRemoved && parent.isValid() {
+		rdb.parents[d.Path] = parent
+		rdb.names[d.Path] = name
+	}
+}
+
+// fillSizes looks up the size and type of each non-removed diff in
+// the tree as of `kmd`.
+func (rdb *revisionDiffBuilder) fillSizes(ctx context.Context,
+	fbo *folderBranchOps, kmd KeyMetadata) error {
+	lState := makeFBOLockState()
+	entriesByDir := make(map[BlockPointer]map[string]DirEntry)
+	for p, parent := range rdb.parents {
+		entries, ok := entriesByDir[parent.tailPointer()]
+		if !ok {
+			var err error
+			entries, err = fbo.blocks.GetEntries(ctx, lState, kmd, parent)
+			if err != nil {
+				return err
+			}
+			entriesByDir[parent.tailPointer()] = entries
+		}
+		de, ok := entries[rdb.names[p]]
+		if !ok {
+			continue
+		}
+		d := rdb.diffs[p]
+		d.Size = de.Size
+		d.EntryType = de.Type
+		rdb.diffs[p] = d
+	}
+	return nil
+}
+
+func (rdb *revisionDiffBuilder) sorted() []RevisionDiff {
+	res := make([]RevisionDiff, 0, len(rdb.diffs))
+	for _, d := range rdb.diffs {
+		res = append(res, d)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Path < res[j].Path })
+	return res
+}
+
+// maxRevisionDiffOpsRevisions is the largest number of revisions
+// whose MDs are all loaded to diff them from their ops.  Longer
+// ranges are diffed by comparing the trees at each end instead, so
+// the memory used doesn't grow with the length of the history.
+const maxRevisionDiffOpsRevisions = 1000
+
+// unembeddedChangesError indicates that the block changes of a
+// revision were left unembedded, so its ops aren't available.
+type unembeddedChangesError struct {
+	rev kbfsmd.Revision
+}
+
+func (e unembeddedChangesError) Error() string {
+	return fmt.Sprintf("Block changes of revision %d are unembedded", e.rev)
+}
+
+// isReclaimedHistoryError returns true if `err` means that the ops of
+// a revision can't be read because its unembedded block changes are
+// gone or were never re-embedded.
+func isReclaimedHistoryError(err error) bool {
+	switch errors.Cause(err).(type) {
+	case kbfsblock.ServerErrorBlockArchived,
+		kbfsblock.ServerErrorBlockDeleted,
+		kbfsblock.ServerErrorBlockNonExistent,
+		unembeddedChangesError:
+		return true
+	default:
+		return false
+	}
+}
+
+// diffRevisionsFromOps computes the changes made by the given range
+// of merged MDs from their ops, using CR chains to collapse
+// multiple operations on the same node.
+func (fbo *folderBranchOps) diffRevisionsFromOps(
+	ctx context.Context, rmds []ImmutableRootMetadata) (
+	[]RevisionDiff, error) {
+	for _, rmd := range rmds {
+		if rmd.data.Changes.Info.BlockPointer != zeroPtr {
+			return nil, unembeddedChangesError{rmd.Revision()}
+		}
+	}
+	chains, err := newCRChainsForIRMDs(
+		ctx, fbo.config.Codec(), rmds, &fbo.blocks, false)
+	if err != nil {
+		return nil, err
+	}
+	// Use a throwaway node cache, since the paths may not exist
+	// anymore in the current view of the TLF.  This also fills in
+	// the final paths of all the ops.
+	_, err = chains.getPaths(ctx, &fbo.blocks, fbo.log,
+		newNodeCacheStandard(fbo.folderBranch), true)
+	if err != nil {
+		return nil, err
+	}
+
+	chainPath := func(chain *crChain) path {
+		if chain == nil || len(chain.ops) == 0 {
+			return path{}
+		}
+		return chain.ops[len(chain.ops)-1].getFinalPath()
+	}
+
+	// Figure out the old path of every renamed node, keyed by the
+	// original pointer of its new parent and its new name.
+	type dirAndName struct {
+		dir  BlockPointer
+		name string
+	}
+	renameSources := make(map[dirAndName]bool)
+	renameOldPaths := make(map[dirAndName]string)
+	for _, ri := range chains.renamedOriginals {
+		oldParent := chainPath(chains.byOriginal[ri.originalOldParent])
+		if !oldParent.isValid() {
+			continue
+		}
+		renameSources[dirAndName{ri.originalOldParent, ri.oldName}] = true
+		renameOldPaths[dirAndName{ri.originalNewParent, ri.newName}] =
+			childPathFromRoot(oldParent, ri.oldName)
+	}
+
+	rdb := newRevisionDiffBuilder()
+	for _, chain := range chains.byOriginal {
+		p := chainPath(chain)
+		if !p.isValid() {
+			if len(chain.ops) > 0 {
+				fbo.log.CDebugf(ctx, "Ignoring chain with no path: %v",
+					chain.mostRecent)
+			}
+			continue
+		}
+		for _, op := range chain.ops {
+			switch realOp := op.(type) {
+			case *createOp:
+				d := RevisionDiff{
+					Type:      RevisionDiffCreated,
+					Path:      childPathFromRoot(p, realOp.NewName),
+					EntryType: realOp.Type,
+				}
+				if realOp.renamed {
+					oldPath, ok := renameOldPaths[dirAndName{
+						chain.original, realOp.NewName}]
+					if ok && oldPath != d.Path {
+						d.Type = RevisionDiffRenamed
+						d.OldPath = oldPath
+					}
+				}
+				rdb.add(d, p, realOp.NewName)
+			case *rmOp:
+				if renameSources[dirAndName{chain.original, realOp.OldName}] {
+					continue
+				}
+				rdb.add(RevisionDiff{
+					Type:      RevisionDiffRemoved,
+					Path:      childPathFromRoot(p, realOp.OldName),
+					EntryType: realOp.RemovedType,
+				}, path{}, "")
+			case *syncOp, *setAttrOp:
+				if !p.hasValidParent() {
+					continue
+				}
+				rdb.add(RevisionDiff{
+					Type: RevisionDiffModified,
+					Path: pathFromRoot(p),
+				}, *p.parentPath(), p.tailName())
+			}
+		}
+	}
+
+	err = rdb.fillSizes(ctx, fbo, rmds[len(rmds)-1].ReadOnly())
+	if err != nil {
+		return nil, err
+	}
+	return rdb.sorted(), nil
+}
+
+// getAllEntries fills in `entries` with every entry under `dir`,
+// keyed by its path relative to the TLF root.
+func (fbo *folderBranchOps) getAllEntries(
+	ctx context.Context, lState *lockState, kmd KeyMetadata, dir path,
+	entries map[string]DirEntry) error {
+	children, err := fbo.blocks.GetEntries(ctx, lState, kmd, dir)
+	if err != nil {
+		return err
+	}
+	for name, de := range children {
+		entries[childPathFromRoot(dir, name)] = de
+		if de.Type == Dir {
+			err := fbo.getAllEntries(ctx, lState, kmd,
+				dir.ChildPath(name, de.BlockPointer), entries)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// diffRevisionsFromTrees computes the changes between two revisions
+// by comparing their whole directory trees.  Renames are detected by
+// matching up the block pointers of removed and created entries.
+func (fbo *folderBranchOps) diffRevisionsFromTrees(
+	ctx context.Context, fromMD, toMD ImmutableRootMetadata) (
+	[]RevisionDiff, error) {
+	lState := makeFBOLockState()
+	getEntries := func(rmd ImmutableRootMetadata) (
+		map[string]DirEntry, error) {
+		entries := make(map[string]DirEntry)
+		root := path{fbo.folderBranch, []pathNode{{
+			rmd.data.Dir.BlockPointer,
+			string(rmd.GetTlfHandle().GetCanonicalName())}}}
+		err := fbo.getAllEntries(ctx, lState, rmd.ReadOnly(), root, entries)
+		if err != nil {
+			return nil, err
+		}
+		return entries, nil
+	}
+	fromEntries, err := getEntries(fromMD)
+	if err != nil {
+		return nil, err
+	}
+	toEntries, err := getEntries(toMD)
+	if err != nil {
+		return nil, err
+	}
+
+	removedByPtr := make(map[BlockPointer]string)
+	var res []RevisionDiff
+	for p, fromDE := range fromEntries {
+		toDE, ok := toEntries[p]
+		switch {
+		case !ok:
+			removedByPtr[fromDE.BlockPointer] = p
+		case fromDE.Type != toDE.Type ||
+			(toDE.Type != Dir && (fromDE.BlockPointer != toDE.BlockPointer ||
+				fromDE.Mtime != toDE.Mtime)):
+			res = append(res, RevisionDiff{
+				Type:      RevisionDiffModified,
+				Path:      p,
+				EntryType: toDE.Type,
+				Size:      toDE.Size,
+			})
+		}
+	}
+
+	// Process created entries from the top down, so that renamed
+	// directories are seen before their children.
+	var created []string
+	for p := range toEntries {
+		if _, ok := fromEntries[p]; !ok {
+			created = append(created, p)
+		}
+	}
+	sort.Strings(created)
+	renamedDirs := make(map[string]string)
+	for _, p := range created {
+		toDE := toEntries[p]
+		d := RevisionDiff{
+			Type:      RevisionDiffCreated,
+			Path:      p,
+			EntryType: toDE.Type,
+			Size:      toDE.Size,
+		}
+		oldPath, ok := removedByPtr[toDE.BlockPointer]
+		if ok && toDE.BlockPointer.IsInitialized() {
+			delete(removedByPtr, toDE.BlockPointer)
+			i := strings.LastIndex(p, "/")
+			j := strings.LastIndex(oldPath, "/")
+			if i >= 0 && j >= 0 && p[i:] == oldPath[j:] &&
+				renamedDirs[p[:i]] == oldPath[:j] {
+				// This just moved along with its parent directory.
+				if toDE.Type == Dir {
+					renamedDirs[p] = oldPath
+				}
+				continue
+			}
+			d.Type = RevisionDiffRenamed
+			d.OldPath = oldPath
+			if toDE.Type == Dir {
+				renamedDirs[p] = oldPath
+			}
+		}
+		res = append(res, d)
+	}
+	for _, p := range removedByPtr {
+		res = append(res, RevisionDiff{
+			Type:      RevisionDiffRemoved,
+			Path:      p,
+			EntryType: fromEntries[p].Type,
+		})
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Path < res[j].Path })
+	return res, nil
+}
+
+// DiffRevisions implements the KBFSOps interface for folderBranchOps.
+func (fbo *folderBranchOps) DiffRevisions(
+	ctx context.Context, folderBranch FolderBranch,
+	from, to kbfsmd.Revision) (diffs []RevisionDiff, err error) {
+	fbo.log.CDebugf(ctx, "DiffRevisions %d %d", from, to)
+	defer func() {
+		fbo.deferLog.CDebugf(ctx, "DiffRevisions %d %d done: %+v",
+			from, to, err)
+	}()
+
+	if folderBranch != fbo.folderBranch {
+		return nil, WrongOpsError{fbo.folderBranch, folderBranch}
+	}
+
+	lState := makeFBOLockState()
+	head, err := fbo.getMDForReadNeedIdentify(ctx, lState)
+	if err != nil {
+		return nil, err
+	}
+	if from < kbfsmd.RevisionInitial || to <= from ||
+		head == (ImmutableRootMetadata{}) || to > head.Revision() {
+		return nil, errors.Errorf(
+			"Invalid revision range %d to %d", from, to)
+	}
+	// The blocks of the `from` tree may already be gone, so there's
+	// nothing to compare against.
+	if from <= head.data.LastGCRevision {
+		return nil, RevGarbageCollectedError{from, head.data.LastGCRevision}
+	}
+
+	err = runUnlessCanceled(ctx, func() error {
+		if to-from <= maxRevisionDiffOpsRevisions {
+			rmds, err := getMergedMDUpdatesWithEnd(
+				ctx, fbo.config, fbo.id(), from+1, to, nil)
+			if err == nil {
+				diffs, err = fbo.diffRevisionsFromOps(ctx, rmds)
+				if err == nil {
+					return nil
+				}
+			}
+			if !isReclaimedHistoryError(err) {
+				return err
+			}
+
+			// The history has been partly reclaimed (e.g., the
+			// unembedded changes of an old revision were
+			// garbage-collected), so fall back to comparing the
+			// trees.
+			fbo.log.CDebugf(ctx, "Couldn't diff revisions from "+
+				"their ops, comparing trees instead: %+v", err)
+		} else {
+			fbo.log.CDebugf(ctx, "Too many revisions to diff from "+
+				"their ops, comparing trees instead")
+		}
+
+		fromMD, err := getSingleMD(ctx, fbo.config, fbo.id(),
+			kbfsmd.NullBranchID, from, kbfsmd.Merged, nil)
+		if err != nil {
+			return err
+		}
+		toMD, err := getSingleMD(ctx, fbo.config, fbo.id(),
+			kbfsmd.NullBranchID, to, kbfsmd.Merged, nil)
+		if err != nil {
+			return err
+		}
+		diffs, err = fbo.diffRevisionsFromTrees(ctx, fromMD, toMD)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return diffs, nil
+}
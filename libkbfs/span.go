@@ -0,0 +1,230 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/keybase/go-framed-msgpack-rpc/rpc"
+	"golang.org/x/net/context"
+)
+
+// TraceID uniquely identifies a trace, i.e. a tree of spans.
+type TraceID [16]byte
+
+// String implements the fmt.Stringer interface for TraceID.
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanID uniquely identifies a span within a trace.
+type SpanID [8]byte
+
+// String implements the fmt.Stringer interface for SpanID.
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid returns whether this ID is non-zero.
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+// Span represents a single timed operation within a trace, like a
+// KBFSOps call or a block fetch.  A span may have a parent span,
+// possibly started on a different goroutine.  All methods on a nil
+// *Span are no-ops, so callers don't need to check whether tracing
+// is enabled.
+type Span struct {
+	exporter SpanExporter
+
+	TraceID  TraceID
+	ID       SpanID
+	ParentID SpanID
+	Name     string
+	Start    time.Time
+
+	lock       sync.Mutex
+	end        time.Time
+	attributes map[string]string
+}
+
+// SpanData is an immutable snapshot of a finished span, as passed to
+// a SpanExporter.
+type SpanData struct {
+	TraceID    TraceID
+	ID         SpanID
+	ParentID   SpanID
+	Name       string
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]string
+	// Err is empty if the span's operation succeeded.
+	Err string
+}
+
+type spanCtxKeyType int
+
+const (
+	// spanCtxKey is the context key for the current span.
+	spanCtxKey spanCtxKeyType = iota
+)
+
+// SpanRPCTagName is the name of the RPC tag that carries the current
+// span's trace context to the other end of an RPC, in the W3C
+// traceparent format.  A span started from the context of an
+// incoming RPC with this tag becomes part of the caller's trace.
+const SpanRPCTagName = "traceparent"
+
+// traceParent formats this span's trace context for SpanRPCTagName.
+func (s *Span) traceParent() string {
+	return "00-" + s.TraceID.String() + "-" + s.ID.String() + "-01"
+}
+
+// remoteParentFromContext returns the trace context passed in by the
+// caller of the RPC that ctx belongs to, if any.
+func remoteParentFromContext(ctx context.Context) (
+	traceID TraceID, parentID SpanID, ok bool) {
+	tags, ok := rpc.RpcTagsFromContext(ctx)
+	if !ok {
+		return TraceID{}, SpanID{}, false
+	}
+	tp, ok := tags[SpanRPCTagName].(string)
+	if !ok {
+		return TraceID{}, SpanID{}, false
+	}
+	parts := strings.Split(tp, "-")
+	if len(parts) != 4 ||
+		hex.DecodedLen(len(parts[1])) != len(traceID) ||
+		hex.DecodedLen(len(parts[2])) != len(parentID) {
+		return TraceID{}, SpanID{}, false
+	}
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil {
+		return TraceID{}, SpanID{}, false
+	}
+	if _, err := hex.Decode(parentID[:], []byte(parts[2])); err != nil {
+		return TraceID{}, SpanID{}, false
+	}
+	return traceID, parentID, traceID != TraceID{} && parentID.IsValid()
+}
+
+// spanFromContext returns the span attached to the given context, if
+// any.
+func spanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanCtxKey).(*Span)
+	return span
+}
+
+// contextWithSpan returns a new context with the given span attached,
+// so that spans started with the new context become its children.
+// If span is nil, it returns ctx unchanged.
+func contextWithSpan(ctx context.Context, span *Span) context.Context {
+	if span == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanCtxKey, span)
+}
+
+func newSpanID() (id SpanID) {
+	// If this fails, we just use a zero ID; tracing is best-effort.
+	_, _ = rand.Read(id[:])
+	return id
+}
+
+func newTraceID() (id TraceID) {
+	_, _ = rand.Read(id[:])
+	return id
+}
+
+// startSpan starts a new span with the given name.  If ctx already
+// has a span, the new span is its child.  Otherwise, if `getter` has
+// a span exporter, the new span continues the trace of the RPC that
+// ctx belongs to, or starts a new trace.  If there is no parent span
+// and no exporter, startSpan returns ctx unchanged and a nil span,
+// without allocating anything.  RPCs made with the returned context
+// carry the new span's trace context.  The caller must call Finish
+// on the returned span.
+func startSpan(ctx context.Context, getter spanExporterGetter,
+	name string) (context.Context, *Span) {
+	parent := spanFromContext(ctx)
+	var exporter SpanExporter
+	if parent != nil {
+		exporter = parent.exporter
+	} else if getter != nil {
+		exporter = getter.SpanExporter()
+	}
+	if exporter == nil {
+		return ctx, nil
+	}
+
+	span := &Span{
+		exporter: exporter,
+		ID:       newSpanID(),
+		Name:     name,
+		Start:    time.Now(),
+	}
+	if parent != nil {
+		span.TraceID = parent.TraceID
+		span.ParentID = parent.ID
+	} else if traceID, parentID, ok := remoteParentFromContext(ctx); ok {
+		span.TraceID = traceID
+		span.ParentID = parentID
+	} else {
+		span.TraceID = newTraceID()
+	}
+	ctx = rpc.AddRpcTagsToContext(
+		ctx, rpc.CtxRpcTags{SpanRPCTagName: span.traceParent()})
+	return contextWithSpan(ctx, span), span
+}
+
+// SetAttribute records a key/value pair describing this span's
+// operation.  It has no effect once the span is finished.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.end.IsZero() {
+		return
+	}
+	if s.attributes == nil {
+		s.attributes = make(map[string]string)
+	}
+	s.attributes[key] = fmt.Sprint(value)
+}
+
+// Finish ends this span with the given result, and exports it.  Only
+// the first call has any effect.
+func (s *Span) Finish(err error) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	if !s.end.IsZero() {
+		s.lock.Unlock()
+		return
+	}
+	s.end = time.Now()
+	data := SpanData{
+		TraceID:    s.TraceID,
+		ID:         s.ID,
+		ParentID:   s.ParentID,
+		Name:       s.Name,
+		Start:      s.Start,
+		End:        s.end,
+		Attributes: s.attributes,
+	}
+	if err != nil {
+		data.Err = err.Error()
+	}
+	s.lock.Unlock()
+	s.exporter.ExportSpan(data)
+}
@@ -0,0 +1,388 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/keybase/client/go/logger"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+const (
+	// spanExporterFilePrefix is the prefix of a -trace-exporter
+	// value that names a file to write spans to.
+	spanExporterFilePrefix = "file:"
+	// spanExporterOTLPPrefix is the prefix of a -trace-exporter
+	// value that names the host:port of an OTLP/HTTP collector.
+	spanExporterOTLPPrefix = "otlp:"
+	// otlpTracesPath is the standard path for OTLP/HTTP traces.
+	otlpTracesPath = "/v1/traces"
+	// otlpServiceName is reported as the service.name resource
+	// attribute for all exported spans.
+	otlpServiceName = "kbfs"
+	// spanExporterBatchSize is the number of pending spans that
+	// triggers an export, even before the flush period is up.
+	spanExporterBatchSize = 512
+	// spanExporterMaxPending bounds the number of spans buffered
+	// while an export is in flight; any more are dropped.
+	spanExporterMaxPending = 16 * spanExporterBatchSize
+	// spanExporterFlushPeriod is how often pending spans are
+	// exported.
+	spanExporterFlushPeriod = 5 * time.Second
+)
+
+// makeSpanExporter makes a SpanExporter from the given
+// -trace-exporter flag value, which is either
+// "file:/path/to/spans.json" or "otlp:host:port".
+func makeSpanExporter(
+	exporterSpec string, log logger.Logger) (SpanExporter, error) {
+	switch {
+	case strings.HasPrefix(exporterSpec, spanExporterFilePrefix):
+		return NewFileSpanExporter(
+			strings.TrimPrefix(exporterSpec, spanExporterFilePrefix), log)
+	case strings.HasPrefix(exporterSpec, spanExporterOTLPPrefix):
+		return NewOTLPSpanExporter(
+			strings.TrimPrefix(exporterSpec, spanExporterOTLPPrefix), log), nil
+	default:
+		return nil, errors.Errorf(
+			"Unknown trace exporter %q; must start with %q or %q",
+			exporterSpec, spanExporterFilePrefix, spanExporterOTLPPrefix)
+	}
+}
+
+// batchingSpanExporter collects finished spans, and periodically
+// hands them off in batches to a write function on a background
+// goroutine, so that ExportSpan never blocks on I/O.
+type batchingSpanExporter struct {
+	log   logger.Logger
+	write func(ctx context.Context, spans []SpanData) error
+
+	lock    sync.Mutex
+	pending []SpanData
+	dropped int
+
+	flushCh    chan chan error
+	kickCh     chan struct{}
+	shutdownCh chan struct{}
+	doneCh     chan struct{}
+}
+
+func newBatchingSpanExporter(log logger.Logger,
+	write func(ctx context.Context, spans []SpanData) error) (
+	e *batchingSpanExporter) {
+	e = &batchingSpanExporter{
+		log:        log,
+		write:      write,
+		flushCh:    make(chan chan error),
+		kickCh:     make(chan struct{}, 1),
+		shutdownCh: make(chan struct{}),
+		doneCh:     make(chan struct{}),
+	}
+	go e.loop()
+	return e
+}
+
+// ExportSpan implements the SpanExporter interface for
+// batchingSpanExporter.
+func (e *batchingSpanExporter) ExportSpan(span SpanData) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if len(e.pending) >= spanExporterMaxPending {
+		e.dropped++
+		return
+	}
+	e.pending = append(e.pending, span)
+	if len(e.pending) >= spanExporterBatchSize {
+		select {
+		case e.kickCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (e *batchingSpanExporter) writePending(ctx context.Context) error {
+	e.lock.Lock()
+	spans, dropped := e.pending, e.dropped
+	e.pending, e.dropped = nil, 0
+	e.lock.Unlock()
+	if dropped > 0 {
+		e.log.CDebugf(ctx, "Dropped %d spans while exporting", dropped)
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+	return e.write(ctx, spans)
+}
+
+func (e *batchingSpanExporter) loop() {
+	defer close(e.doneCh)
+	ctx := context.Background()
+	ticker := time.NewTicker(spanExporterFlushPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-e.kickCh:
+		case errCh := <-e.flushCh:
+			errCh <- e.writePending(ctx)
+			continue
+		case <-e.shutdownCh:
+			return
+		}
+		err := e.writePending(ctx)
+		if err != nil {
+			e.log.CDebugf(ctx, "Couldn't export spans: %+v", err)
+		}
+	}
+}
+
+// Shutdown implements the SpanExporter interface for
+// batchingSpanExporter.
+func (e *batchingSpanExporter) Shutdown(ctx context.Context) error {
+	errCh := make(chan error, 1)
+	select {
+	case e.flushCh <- errCh:
+	case <-e.doneCh:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	var err error
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	close(e.shutdownCh)
+	<-e.doneCh
+	return err
+}
+
+// fileSpan is the JSON representation of a span written by
+// FileSpanExporter.
+type fileSpan struct {
+	TraceID    string            `json:"trace_id"`
+	SpanID     string            `json:"span_id"`
+	ParentID   string            `json:"parent_id,omitempty"`
+	Name       string            `json:"name"`
+	Start      time.Time         `json:"start"`
+	DurationMs float64           `json:"duration_ms"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Err        string            `json:"error,omitempty"`
+}
+
+// FileSpanExporter writes finished spans to a file, as one JSON
+// object per line.
+type FileSpanExporter struct {
+	*batchingSpanExporter
+	f *os.File
+}
+
+var _ SpanExporter = (*FileSpanExporter)(nil)
+
+// NewFileSpanExporter makes a new FileSpanExporter that appends to
+// the file at the given path, creating it if necessary.
+func NewFileSpanExporter(
+	path string, log logger.Logger) (*FileSpanExporter, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	fe := &FileSpanExporter{f: f}
+	fe.batchingSpanExporter = newBatchingSpanExporter(log, fe.writeSpans)
+	return fe, nil
+}
+
+func (fe *FileSpanExporter) writeSpans(
+	_ context.Context, spans []SpanData) error {
+	w := bufio.NewWriter(fe.f)
+	enc := json.NewEncoder(w)
+	for _, s := range spans {
+		fs := fileSpan{
+			TraceID:    s.TraceID.String(),
+			SpanID:     s.ID.String(),
+			Name:       s.Name,
+			Start:      s.Start,
+			DurationMs: float64(s.End.Sub(s.Start)) / float64(time.Millisecond),
+			Attributes: s.Attributes,
+			Err:        s.Err,
+		}
+		if s.ParentID.IsValid() {
+			fs.ParentID = s.ParentID.String()
+		}
+		err := enc.Encode(fs)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return errors.WithStack(w.Flush())
+}
+
+// Shutdown implements the SpanExporter interface for
+// FileSpanExporter.
+func (fe *FileSpanExporter) Shutdown(ctx context.Context) error {
+	err := fe.batchingSpanExporter.Shutdown(ctx)
+	closeErr := fe.f.Close()
+	if err != nil {
+		return err
+	}
+	return errors.WithStack(closeErr)
+}
+
+// The types below are a minimal subset of the OTLP/JSON encoding of
+// trace data; see
+// https://github.com/open-telemetry/opentelemetry-proto.
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpStatus struct {
+	// Code is 1 for OK and 2 for an error.
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpTracesRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+func makeOTLPTracesRequest(spans []SpanData) otlpTracesRequest {
+	otlpSpans := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		otlp := otlpSpan{
+			TraceID: s.TraceID.String(),
+			SpanID:  s.ID.String(),
+			Name:    s.Name,
+			// 1 is SPAN_KIND_INTERNAL.
+			Kind: 1,
+			StartTimeUnixNano: strconv.FormatInt(
+				s.Start.UnixNano(), 10),
+			EndTimeUnixNano: strconv.FormatInt(s.End.UnixNano(), 10),
+			Status:          otlpStatus{Code: 1},
+		}
+		if s.ParentID.IsValid() {
+			otlp.ParentSpanID = s.ParentID.String()
+		}
+		keys := make([]string, 0, len(s.Attributes))
+		for k := range s.Attributes {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			otlp.Attributes = append(otlp.Attributes, otlpKeyValue{
+				k, otlpAnyValue{s.Attributes[k]}})
+		}
+		if s.Err != "" {
+			otlp.Status = otlpStatus{Code: 2, Message: s.Err}
+		}
+		otlpSpans = append(otlpSpans, otlp)
+	}
+	return otlpTracesRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: []otlpKeyValue{
+					{"service.name", otlpAnyValue{otlpServiceName}},
+				},
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: "github.com/keybase/kbfs/libkbfs"},
+				Spans: otlpSpans,
+			}},
+		}},
+	}
+}
+
+// OTLPSpanExporter sends finished spans to an OpenTelemetry
+// collector, using the OTLP/HTTP protocol with JSON encoding.
+type OTLPSpanExporter struct {
+	*batchingSpanExporter
+	url    string
+	client *http.Client
+}
+
+var _ SpanExporter = (*OTLPSpanExporter)(nil)
+
+// NewOTLPSpanExporter makes a new OTLPSpanExporter that sends spans
+// to the collector listening at the given host:port, like
+// "localhost:4318".
+func NewOTLPSpanExporter(
+	hostPort string, log logger.Logger) *OTLPSpanExporter {
+	oe := &OTLPSpanExporter{
+		url:    "http://" + hostPort + otlpTracesPath,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+	oe.batchingSpanExporter = newBatchingSpanExporter(log, oe.sendSpans)
+	return oe
+}
+
+func (oe *OTLPSpanExporter) sendSpans(
+	ctx context.Context, spans []SpanData) error {
+	buf, err := json.Marshal(makeOTLPTracesRequest(spans))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req, err := http.NewRequest("POST", oe.url, bytes.NewReader(buf))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := oe.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("Collector at %s returned status %s",
+			oe.url, resp.Status)
+	}
+	return nil
+}
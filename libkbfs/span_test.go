@@ -0,0 +1,275 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/keybase/client/go/logger"
+	"github.com/keybase/go-framed-msgpack-rpc/rpc"
+	"github.com/keybase/kbfs/ioutil"
+	"github.com/keybase/kbfs/tlf"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+type testSpanExporter struct {
+	lock  sync.Mutex
+	spans []SpanData
+}
+
+var _ SpanExporter = (*testSpanExporter)(nil)
+
+func (e *testSpanExporter) ExportSpan(span SpanData) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+func (e *testSpanExporter) Shutdown(_ context.Context) error {
+	return nil
+}
+
+func (e *testSpanExporter) getSpans() []SpanData {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return append([]SpanData(nil), e.spans...)
+}
+
+type testSpanExporterGetter struct {
+	exporter SpanExporter
+}
+
+func (g testSpanExporterGetter) SpanExporter() SpanExporter {
+	return g.exporter
+}
+
+// findSpan returns the first span with the given name that is a
+// descendant of `root`, or of nothing if root is nil.
+func findSpan(spans []SpanData, root *SpanData, name string) *SpanData {
+	byID := make(map[SpanID]SpanData, len(spans))
+	for _, s := range spans {
+		byID[s.ID] = s
+	}
+	for _, s := range spans {
+		if s.Name != name {
+			continue
+		}
+		if root == nil {
+			s := s
+			return &s
+		}
+		for p, ok := s, true; ok; p, ok = byID[p.ParentID] {
+			if p.ParentID == root.ID {
+				s := s
+				return &s
+			}
+		}
+	}
+	return nil
+}
+
+func TestSpanParentChild(t *testing.T) {
+	ctx := context.Background()
+
+	t.Log("Without a parent or an exporter, there are no spans.")
+	ctx2, span := startSpan(ctx, nil, "a")
+	require.Nil(t, span)
+	require.Equal(t, ctx, ctx2)
+	_, span = startSpan(ctx, testSpanExporterGetter{}, "a")
+	require.Nil(t, span)
+	// Nil spans are no-ops.
+	span.SetAttribute("k", "v")
+	span.Finish(nil)
+
+	e := &testSpanExporter{}
+	ctx, root := startSpan(ctx, testSpanExporterGetter{e}, "root")
+	require.NotNil(t, root)
+	require.False(t, root.ParentID.IsValid())
+	_, child := startSpan(ctx, nil, "child")
+	require.NotNil(t, child)
+	require.Equal(t, root.TraceID, child.TraceID)
+	require.Equal(t, root.ID, child.ParentID)
+
+	child.SetAttribute("n", 1)
+	childErr := errors.New("child failed")
+	child.Finish(childErr)
+	child.Finish(nil)
+	child.SetAttribute("n", 2)
+	root.Finish(nil)
+
+	spans := e.getSpans()
+	require.Len(t, spans, 2)
+	require.Equal(t, "child", spans[0].Name)
+	require.Equal(t, childErr.Error(), spans[0].Err)
+	require.Equal(t, map[string]string{"n": "1"}, spans[0].Attributes)
+	require.Equal(t, "root", spans[1].Name)
+	require.Equal(t, "", spans[1].Err)
+}
+
+func TestSpanRPCPropagation(t *testing.T) {
+	e := &testSpanExporter{}
+	getter := testSpanExporterGetter{e}
+	ctx, root := startSpan(context.Background(), getter, "root")
+	require.NotNil(t, root)
+
+	t.Log("Outgoing RPCs carry the current span's trace context.")
+	_, child := startSpan(ctx, nil, "child")
+	require.NotNil(t, child)
+	tags, ok := rpc.RpcTagsFromContext(ctx)
+	require.True(t, ok)
+	require.Equal(t, root.traceParent(), tags[SpanRPCTagName])
+
+	t.Log("A span started by an incoming RPC joins the caller's trace.")
+	remoteCtx := rpc.AddRpcTagsToContext(context.Background(), tags)
+	_, remote := startSpan(remoteCtx, getter, "remote")
+	require.NotNil(t, remote)
+	require.Equal(t, root.TraceID, remote.TraceID)
+	require.Equal(t, root.ID, remote.ParentID)
+
+	t.Log("A malformed trace context starts a new trace.")
+	badCtx := rpc.AddRpcTagsToContext(context.Background(),
+		rpc.CtxRpcTags{SpanRPCTagName: "00-zz-yy-01"})
+	_, fresh := startSpan(badCtx, getter, "fresh")
+	require.NotNil(t, fresh)
+	require.NotEqual(t, root.TraceID, fresh.TraceID)
+	require.False(t, fresh.ParentID.IsValid())
+
+	t.Log("Without an exporter, the trace context is ignored.")
+	_, none := startSpan(remoteCtx, testSpanExporterGetter{}, "none")
+	require.Nil(t, none)
+}
+
+func TestKBFSOpsSpans(t *testing.T) {
+	config, _, ctx, cancel := kbfsOpsInitNoMocks(t, "test_user")
+	defer kbfsTestShutdownNoMocks(t, config, ctx, cancel)
+	e := &testSpanExporter{}
+	config.SetSpanExporter(e)
+
+	t.Log("Write and sync a file.")
+	rootNode := GetRootNodeOrBust(ctx, t, config, "test_user", tlf.Private)
+	kbfsOps := config.KBFSOps()
+	fileNode, _, err := kbfsOps.CreateFile(ctx, rootNode, "a", false, NoExcl)
+	require.NoError(t, err)
+	err = kbfsOps.Write(ctx, fileNode, []byte{1, 2, 3}, 0)
+	require.NoError(t, err)
+	err = kbfsOps.SyncAll(ctx, rootNode.GetFolderBranch())
+	require.NoError(t, err)
+
+	spans := e.getSpans()
+	syncSpan := findSpan(spans, nil, "KBFSOps.SyncAll")
+	require.NotNil(t, syncSpan)
+	require.False(t, syncSpan.ParentID.IsValid())
+	require.NotNil(t, findSpan(spans, syncSpan, "MDOps.Put"))
+
+	t.Log("Read the file from a fresh config, so the block is fetched.")
+	config2 := ConfigAsUser(config, "test_user")
+	defer CheckConfigAndShutdown(ctx, t, config2)
+	// Don't let the prefetcher fetch the file block before the read.
+	<-config2.BlockOps().TogglePrefetcher(false)
+	e2 := &testSpanExporter{}
+	config2.SetSpanExporter(e2)
+	rootNode2 := GetRootNodeOrBust(ctx, t, config2, "test_user", tlf.Private)
+	fileNode2, _, err := config2.KBFSOps().Lookup(ctx, rootNode2, "a")
+	require.NoError(t, err)
+	buf := make([]byte, 3)
+	_, err = config2.KBFSOps().Read(ctx, fileNode2, buf, 0)
+	require.NoError(t, err)
+
+	spans = e2.getSpans()
+	readSpan := findSpan(spans, nil, "KBFSOps.Read")
+	require.NotNil(t, readSpan)
+	getSpan := findSpan(spans, readSpan, "BlockOps.Get")
+	require.NotNil(t, getSpan)
+	require.NotNil(t, findSpan(spans, getSpan, "BlockRetrievalQueue.Request"))
+	fetchSpan := findSpan(spans, getSpan, "BlockRetrievalWorker.Fetch")
+	require.NotNil(t, fetchSpan)
+	require.Equal(t, readSpan.TraceID, fetchSpan.TraceID)
+}
+
+func TestFileSpanExporter(t *testing.T) {
+	tempdir, err := ioutil.TempDir(os.TempDir(), "span_exporter")
+	require.NoError(t, err)
+	defer func() {
+		err := ioutil.RemoveAll(tempdir)
+		require.NoError(t, err)
+	}()
+
+	path := filepath.Join(tempdir, "spans.json")
+	log := logger.NewTestLogger(t)
+	e, err := makeSpanExporter("file:"+path, log)
+	require.NoError(t, err)
+	ctx, root := startSpan(
+		context.Background(), testSpanExporterGetter{e}, "root")
+	_, child := startSpan(ctx, nil, "child")
+	child.SetAttribute("k", "v")
+	child.Finish(errors.New("oops"))
+	root.Finish(nil)
+	err = e.Shutdown(context.Background())
+	require.NoError(t, err)
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	var spans []fileSpan
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var s fileSpan
+		err := json.Unmarshal(scanner.Bytes(), &s)
+		require.NoError(t, err)
+		spans = append(spans, s)
+	}
+	require.NoError(t, scanner.Err())
+	require.Len(t, spans, 2)
+	require.Equal(t, "child", spans[0].Name)
+	require.Equal(t, root.ID.String(), spans[0].ParentID)
+	require.Equal(t, "oops", spans[0].Err)
+	require.Equal(t, map[string]string{"k": "v"}, spans[0].Attributes)
+	require.Equal(t, "root", spans[1].Name)
+	require.Equal(t, "", spans[1].ParentID)
+}
+
+func TestOTLPSpanExporter(t *testing.T) {
+	reqCh := make(chan otlpTracesRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, otlpTracesPath, r.URL.Path)
+			var req otlpTracesRequest
+			err := json.NewDecoder(r.Body).Decode(&req)
+			require.NoError(t, err)
+			reqCh <- req
+		}))
+	defer server.Close()
+
+	log := logger.NewTestLogger(t)
+	e, err := makeSpanExporter(
+		"otlp:"+server.Listener.Addr().String(), log)
+	require.NoError(t, err)
+	_, span := startSpan(
+		context.Background(), testSpanExporterGetter{e}, "root")
+	span.Finish(errors.New("oops"))
+	err = e.Shutdown(context.Background())
+	require.NoError(t, err)
+
+	req := <-reqCh
+	require.Len(t, req.ResourceSpans, 1)
+	require.Len(t, req.ResourceSpans[0].ScopeSpans, 1)
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	require.Len(t, spans, 1)
+	require.Equal(t, "root", spans[0].Name)
+	require.Equal(t, span.TraceID.String(), spans[0].TraceID)
+	require.Equal(t, otlpStatus{Code: 2, Message: "oops"}, spans[0].Status)
+
+	_, err = makeSpanExporter("bogus", log)
+	require.Error(t, err)
+}
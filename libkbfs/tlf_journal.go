@@ -47,6 +47,7 @@ type tlfJournalConfig interface {
 	diskLimitTimeout() time.Duration
 	teamMembershipChecker() kbfsmd.TeamMembershipChecker
 	BGFlushDirOpBatchSize() int
+	spanExporterGetter
 }
 
 // tlfJournalConfigWrapper is an adapter for Config objects to the
@@ -819,8 +820,17 @@ func (j *tlfJournal) flush(ctx context.Context) (err error) {
 	j.flushLock.Lock()
 	defer j.flushLock.Unlock()
 
+	// Flushes run in the background, so each one starts a new trace.
+	ctx, span := startSpan(ctx, j.config, "TLFJournal.Flush")
+	span.SetAttribute("tlf", j.tlfID)
+
 	flushedBlockEntries := 0
 	flushedMDEntries := 0
+	defer func() {
+		span.SetAttribute("block_entries", flushedBlockEntries)
+		span.SetAttribute("md_entries", flushedMDEntries)
+		span.Finish(err)
+	}()
 	defer func() {
 		if err != nil {
 			j.deferLog.CDebugf(ctx,
@@ -1085,6 +1095,12 @@ func (j *tlfJournal) flushBlockEntries(
 	ctx context.Context, end journalOrdinal) (
 	numFlushed int, maxMDRevToFlush kbfsmd.Revision,
 	converted bool, err error) {
+	ctx, span := startSpan(ctx, nil, "TLFJournal.FlushBlockEntries")
+	defer func() {
+		span.SetAttribute("num_flushed", numFlushed)
+		span.Finish(err)
+	}()
+
 	entries, bytesToFlush, maxMDRevToFlush, err := j.getNextBlockEntriesToFlush(
 		ctx, end)
 	if err != nil {
@@ -1471,6 +1487,9 @@ func (j *tlfJournal) flushOneMDOp(ctx context.Context,
 		return false, nil
 	}
 
+	ctx, span := startSpan(ctx, nil, "TLFJournal.FlushOneMDOp")
+	defer func() { span.Finish(err) }()
+
 	j.log.CDebugf(ctx, "Flushing one MD to server")
 	defer func() {
 		if err != nil {
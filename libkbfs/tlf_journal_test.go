@@ -160,6 +160,10 @@ func (c testTLFJournalConfig) BGFlushDirOpBatchSize() int {
 	return 1
 }
 
+func (c testTLFJournalConfig) SpanExporter() SpanExporter {
+	return nil
+}
+
 func (c testTLFJournalConfig) makeBlock(data []byte) (
 	kbfsblock.ID, kbfsblock.Context, kbfscrypto.BlockCryptKeyServerHalf) {
 	id, err := kbfsblock.MakePermanentID(data)
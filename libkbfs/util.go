@@ -82,6 +82,40 @@ const (
 	CtxBackgroundSyncKey CtxBackgroundSyncKeyType = iota
 )
 
+// CtxChangeInfoKeyType is the type for a context change info key.
+type CtxChangeInfoKeyType int
+
+const (
+	// CtxChangeInfoKey is set in the context for any change
+	// notifications triggered by a merged MD revision fetched from
+	// the server, to a ChangeInfo describing that revision.
+	CtxChangeInfoKey CtxChangeInfoKeyType = iota
+)
+
+// ChangeInfo describes the MD revision that caused a batch of change
+// notifications.
+type ChangeInfo struct {
+	Revision kbfsmd.Revision
+	Writer   keybase1.UID
+}
+
+func ctxWithChangeInfo(
+	ctx context.Context, md ReadOnlyRootMetadata) context.Context {
+	return context.WithValue(ctx, CtxChangeInfoKey, ChangeInfo{
+		Revision: md.Revision(),
+		Writer:   md.LastModifyingWriter(),
+	})
+}
+
+// ChangeInfoFromContext returns the ChangeInfo set in the context of
+// a change notification, if any.  Notifications of changes made on
+// this device, including unmerged revisions and conflict resolution,
+// don't have one.
+func ChangeInfoFromContext(ctx context.Context) (ChangeInfo, bool) {
+	ci, ok := ctx.Value(CtxChangeInfoKey).(ChangeInfo)
+	return ci, ok
+}
+
 // Warninger is an interface that only waprs the Warning method.
 type Warninger interface {
 	Warning(format string, args ...interface{})
@@ -0,0 +1,276 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package metricsutil
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// PrometheusContentType is the content type of the Prometheus text
+// exposition format written by WritePrometheusMetrics.
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// prometheusNamePrefix is prepended to every exported metric name.
+const prometheusNamePrefix = "kbfs_"
+
+// prometheusTimerBuckets are the upper bounds, in seconds, of the
+// histogram buckets exported for each timer.
+var prometheusTimerBuckets = []float64{
+	.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60,
+}
+
+// prometheusSummaryQuantiles are the quantiles exported for each
+// (non-timer) histogram.
+var prometheusSummaryQuantiles = []float64{0.5, 0.75, 0.95, 0.99, 0.999}
+
+// prometheusBucketGridSize is the number of evenly-spaced quantiles
+// used to estimate how many timer samples fall into each bucket.
+const prometheusBucketGridSize = 200
+
+// prometheusLabelEscaper escapes label values as required by the
+// Prometheus text exposition format.
+var prometheusLabelEscaper = strings.NewReplacer(
+	`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+// NameWithLabels returns a registry name for a metric called `name`
+// with the given label key/value pairs, e.g.
+// `Journal.UnflushedBytes{tlf_type="private"}`.  Metrics registered
+// under such a name are exported to Prometheus as a single metric
+// family with labels.  It panics if `kvs` has an odd length.
+func NameWithLabels(name string, kvs ...string) string {
+	if len(kvs)%2 != 0 {
+		panic(fmt.Sprintf("Odd number of label strings for %s", name))
+	}
+	if len(kvs) == 0 {
+		return name
+	}
+	labels := make([]string, 0, len(kvs)/2)
+	for i := 0; i < len(kvs); i += 2 {
+		labels = append(labels, fmt.Sprintf("%s=\"%s\"",
+			prometheusName(kvs[i]),
+			prometheusLabelEscaper.Replace(kvs[i+1])))
+	}
+	sort.Strings(labels)
+	return name + "{" + strings.Join(labels, ",") + "}"
+}
+
+// ReplaceMetric registers `m` under `name` in the given registry,
+// replacing any metric already registered under that name.  This is
+// useful for metrics owned by objects that may be re-created, like
+// caches.
+func ReplaceMetric(r metrics.Registry, name string, m interface{}) {
+	r.Unregister(name)
+	// Ignore any error from a concurrent registration under the
+	// same name.
+	_ = r.Register(name, m)
+}
+
+// splitLabels splits a registry name made by NameWithLabels into its
+// base name and its labels (without the braces).
+func splitLabels(name string) (base, labels string) {
+	i := strings.IndexByte(name, '{')
+	if i < 0 || !strings.HasSuffix(name, "}") {
+		return name, ""
+	}
+	return name[:i], name[i+1 : len(name)-1]
+}
+
+// prometheusName converts a go-metrics name like
+// "BlockServer.AddBlockReference" into a valid Prometheus name like
+// "block_server_add_block_reference".
+func prometheusName(name string) string {
+	runes := []rune(name)
+	var b bytes.Buffer
+	for i, r := range runes {
+		switch {
+		case unicode.IsUpper(r):
+			// Start a new word at a lower-to-upper transition, or
+			// at the last capital of an acronym ("TLFReader").
+			if i > 0 && b.Len() > 0 &&
+				!strings.HasSuffix(b.String(), "_") &&
+				(!unicode.IsUpper(runes[i-1]) ||
+					(i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				b.WriteByte('_')
+			}
+			b.WriteRune(unicode.ToLower(r))
+		case r < unicode.MaxASCII &&
+			(unicode.IsLetter(r) || unicode.IsDigit(r)):
+			if b.Len() == 0 && unicode.IsDigit(r) {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+		default:
+			if b.Len() > 0 && !strings.HasSuffix(b.String(), "_") {
+				b.WriteByte('_')
+			}
+		}
+	}
+	return strings.TrimSuffix(b.String(), "_")
+}
+
+func formatPrometheusFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// joinLabels combines a metric's own labels with an extra label
+// (like a bucket bound), either of which may be empty.
+func joinLabels(labels, extra string) string {
+	switch {
+	case labels == "" && extra == "":
+		return ""
+	case labels == "":
+		return "{" + extra + "}"
+	case extra == "":
+		return "{" + labels + "}"
+	}
+	return "{" + labels + "," + extra + "}"
+}
+
+type prometheusFamily struct {
+	name    string
+	typ     string
+	metrics []namedMetric
+}
+
+// WritePrometheusMetrics writes the metrics in the given registry to
+// the given io.Writer in the Prometheus text exposition format.
+// Counters, gauges and health checks become gauges, meters become
+// counters, histograms become summaries, and timers become
+// histograms in seconds.
+//
+// Timers only keep a sample of their values, so the timer bucket
+// counts and sums are estimated by scaling the sample up to the
+// timer's total count.
+func WritePrometheusMetrics(r metrics.Registry, w io.Writer) {
+	families := make(map[string]*prometheusFamily)
+	r.Each(func(name string, i interface{}) {
+		base, _ := splitLabels(name)
+		famName := prometheusNamePrefix + prometheusName(base)
+		var typ string
+		switch i.(type) {
+		case metrics.Counter, metrics.Gauge, metrics.GaugeFloat64:
+			typ = "gauge"
+		case metrics.Healthcheck:
+			famName += "_healthy"
+			typ = "gauge"
+		case metrics.Histogram:
+			typ = "summary"
+		case metrics.Meter:
+			famName += "_total"
+			typ = "counter"
+		case metrics.Timer:
+			famName += "_seconds"
+			typ = "histogram"
+		default:
+			return
+		}
+		fam, ok := families[famName]
+		if !ok {
+			fam = &prometheusFamily{name: famName, typ: typ}
+			families[famName] = fam
+		} else if fam.typ != typ {
+			// Prometheus requires each family to have one type.
+			return
+		}
+		fam.metrics = append(fam.metrics, namedMetric{name, i})
+	})
+
+	famNames := make([]string, 0, len(families))
+	for famName := range families {
+		famNames = append(famNames, famName)
+	}
+	sort.Strings(famNames)
+	for _, famName := range famNames {
+		fam := families[famName]
+		sort.Sort(namedMetricSlice(fam.metrics))
+		fmt.Fprintf(w, "# TYPE %s %s\n", fam.name, fam.typ)
+		for _, nm := range fam.metrics {
+			_, labels := splitLabels(nm.name)
+			writePrometheusMetric(w, fam.name, labels, nm.m)
+		}
+	}
+}
+
+func writePrometheusMetric(
+	w io.Writer, name, labels string, i interface{}) {
+	sample := func(suffix, extra string, v float64) {
+		fmt.Fprintf(w, "%s%s%s %s\n", name, suffix,
+			joinLabels(labels, extra), formatPrometheusFloat(v))
+	}
+	switch metric := i.(type) {
+	case metrics.Counter:
+		sample("", "", float64(metric.Count()))
+	case metrics.Gauge:
+		sample("", "", float64(metric.Value()))
+	case metrics.GaugeFloat64:
+		sample("", "", metric.Value())
+	case metrics.Healthcheck:
+		metric.Check()
+		healthy := 1.0
+		if metric.Error() != nil {
+			healthy = 0
+		}
+		sample("", "", healthy)
+	case metrics.Histogram:
+		h := metric.Snapshot()
+		ps := h.Percentiles(prometheusSummaryQuantiles)
+		for j, q := range prometheusSummaryQuantiles {
+			sample("", "quantile=\""+formatPrometheusFloat(q)+"\"", ps[j])
+		}
+		sample("_sum", "", float64(h.Sum()))
+		sample("_count", "", float64(h.Count()))
+	case metrics.Meter:
+		sample("", "", float64(metric.Snapshot().Count()))
+	case metrics.Timer:
+		t := metric.Snapshot()
+		count := t.Count()
+		grid := make([]float64, prometheusBucketGridSize)
+		for j := range grid {
+			grid[j] = (float64(j) + 0.5) / prometheusBucketGridSize
+		}
+		ps := t.Percentiles(grid)
+		k := 0
+		for _, le := range prometheusTimerBuckets {
+			for k < len(ps) && ps[k]/float64(time.Second) <= le {
+				k++
+			}
+			bucketCount := math.Floor(
+				float64(count)*float64(k)/float64(len(ps)) + 0.5)
+			sample("_bucket", "le=\""+formatPrometheusFloat(le)+"\"",
+				bucketCount)
+		}
+		sample("_bucket", "le=\"+Inf\"", float64(count))
+		sample("_sum", "", t.Mean()*float64(count)/float64(time.Second))
+		sample("_count", "", float64(count))
+	}
+}
+
+// PrometheusHandler returns an http.Handler that serves the metrics
+// in the given registry in the Prometheus text exposition format.
+func PrometheusHandler(r metrics.Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", PrometheusContentType)
+		WritePrometheusMetrics(r, w)
+	})
+}
@@ -0,0 +1,79 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package metricsutil
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrometheusName(t *testing.T) {
+	for name, expected := range map[string]string{
+		"BlockServer.Get":            "block_server_get",
+		"KeyCache.TLFReaderHitCount": "key_cache_tlf_reader_hit_count",
+		"KeybaseService.Resolve":     "keybase_service_resolve",
+		"DiskBlockCache.Hits":        "disk_block_cache_hits",
+		"a-b c":                      "a_b_c",
+		"2fast":                      "_2fast",
+	} {
+		require.Equal(t, expected, prometheusName(name), name)
+	}
+}
+
+func TestNameWithLabels(t *testing.T) {
+	require.Equal(t, "Foo", NameWithLabels("Foo"))
+	require.Equal(t, `Foo{a="x\"y",b="1"}`,
+		NameWithLabels("Foo", "b", "1", "a", `x"y`))
+	base, labels := splitLabels(NameWithLabels("Foo", "tlf_type", "private"))
+	require.Equal(t, "Foo", base)
+	require.Equal(t, `tlf_type="private"`, labels)
+}
+
+func TestWritePrometheusMetrics(t *testing.T) {
+	r := metrics.NewRegistry()
+	timer := metrics.NewTimer()
+	for i := 0; i < 10; i++ {
+		timer.Update(2 * time.Millisecond)
+	}
+	for i := 0; i < 10; i++ {
+		timer.Update(2 * time.Second)
+	}
+	err := r.Register("BlockServer.Get", timer)
+	require.NoError(t, err)
+	meter := metrics.NewMeter()
+	meter.Mark(3)
+	err = r.Register(NameWithLabels("DiskBlockCache.Hits", "cache", "sync"),
+		meter)
+	require.NoError(t, err)
+	ReplaceMetric(r, NameWithLabels("Journal.StoredBytes", "tlf_type",
+		"private"), metrics.NewFunctionalGauge(func() int64 { return 5 }))
+	ReplaceMetric(r, NameWithLabels("Journal.StoredBytes", "tlf_type",
+		"private"), metrics.NewFunctionalGauge(func() int64 { return 7 }))
+
+	var b bytes.Buffer
+	WritePrometheusMetrics(r, &b)
+	out := b.String()
+	for _, line := range []string{
+		"# TYPE kbfs_block_server_get_seconds histogram",
+		`kbfs_block_server_get_seconds_bucket{le="0.001"} 0`,
+		`kbfs_block_server_get_seconds_bucket{le="0.005"} 10`,
+		`kbfs_block_server_get_seconds_bucket{le="1"} 10`,
+		`kbfs_block_server_get_seconds_bucket{le="2.5"} 20`,
+		`kbfs_block_server_get_seconds_bucket{le="+Inf"} 20`,
+		"kbfs_block_server_get_seconds_count 20",
+		"# TYPE kbfs_disk_block_cache_hits_total counter",
+		`kbfs_disk_block_cache_hits_total{cache="sync"} 3`,
+		"# TYPE kbfs_journal_stored_bytes gauge",
+		`kbfs_journal_stored_bytes{tlf_type="private"} 7`,
+	} {
+		require.Contains(t, out, line+"\n")
+	}
+	require.Equal(t, 1, strings.Count(out, "kbfs_journal_stored_bytes{"))
+}
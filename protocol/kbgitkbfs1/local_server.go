@@ -0,0 +1,819 @@
+// Auto-generated by avdl-compiler v1.3.9 (https://github.com/keybase/node-avdl-compiler)
+//   Input file: kbgitkbfs-avdl/local_server.avdl
+
+package kbgitkbfs1
+
+import (
+	keybase1 "github.com/keybase/client/go/protocol/keybase1"
+	"github.com/keybase/go-framed-msgpack-rpc/rpc"
+	context "golang.org/x/net/context"
+)
+
+// LocalServerMDBlock is a serialized, signed MD object.
+type LocalServerMDBlock struct {
+	Version   int           `codec:"version" json:"version"`
+	Block     []byte        `codec:"block" json:"block"`
+	Timestamp keybase1.Time `codec:"timestamp" json:"timestamp"`
+}
+
+// GetMDForHandleRes is the response from GetMDForHandle.
+type GetMDForHandleRes struct {
+	TlfID []byte              `codec:"tlfID" json:"tlfID"`
+	Md    *LocalServerMDBlock `codec:"md" json:"md"`
+}
+
+// GetKeyBundlesRes is the response from GetKeyBundles.
+type GetKeyBundlesRes struct {
+	WriterKeyBundle []byte `codec:"writerKeyBundle" json:"writerKeyBundle"`
+	ReaderKeyBundle []byte `codec:"readerKeyBundle" json:"readerKeyBundle"`
+}
+
+// GetBlockFromServerRes is the response from GetBlockFromServer.
+type GetBlockFromServerRes struct {
+	Buf        []byte `codec:"buf" json:"buf"`
+	ServerHalf []byte `codec:"serverHalf" json:"serverHalf"`
+}
+
+type HelloArg struct {
+	Session []byte `codec:"session" json:"session"`
+}
+
+type GetMDForHandleArg struct {
+	Handle        []byte           `codec:"handle" json:"handle"`
+	Unmerged      bool             `codec:"unmerged" json:"unmerged"`
+	LockBeforeGet *keybase1.LockID `codec:"lockBeforeGet" json:"lockBeforeGet"`
+}
+
+type GetMDForTLFArg struct {
+	TlfID         []byte           `codec:"tlfID" json:"tlfID"`
+	BranchID      []byte           `codec:"branchID" json:"branchID"`
+	Unmerged      bool             `codec:"unmerged" json:"unmerged"`
+	LockBeforeGet *keybase1.LockID `codec:"lockBeforeGet" json:"lockBeforeGet"`
+}
+
+type GetMDForTLFByTimeArg struct {
+	TlfID      []byte        `codec:"tlfID" json:"tlfID"`
+	ServerTime keybase1.Time `codec:"serverTime" json:"serverTime"`
+}
+
+type GetMDRangeArg struct {
+	TlfID         []byte           `codec:"tlfID" json:"tlfID"`
+	BranchID      []byte           `codec:"branchID" json:"branchID"`
+	Unmerged      bool             `codec:"unmerged" json:"unmerged"`
+	Start         int64            `codec:"start" json:"start"`
+	Stop          int64            `codec:"stop" json:"stop"`
+	LockBeforeGet *keybase1.LockID `codec:"lockBeforeGet" json:"lockBeforeGet"`
+}
+
+type PutMDArg struct {
+	Md                 LocalServerMDBlock    `codec:"md" json:"md"`
+	WriterKeyBundle    []byte                `codec:"writerKeyBundle" json:"writerKeyBundle"`
+	ReaderKeyBundle    []byte                `codec:"readerKeyBundle" json:"readerKeyBundle"`
+	WriterKeyBundleNew bool                  `codec:"writerKeyBundleNew" json:"writerKeyBundleNew"`
+	ReaderKeyBundleNew bool                  `codec:"readerKeyBundleNew" json:"readerKeyBundleNew"`
+	LockContext        *keybase1.LockContext `codec:"lockContext" json:"lockContext"`
+	Priority           keybase1.MDPriority   `codec:"priority" json:"priority"`
+}
+
+type LockArg struct {
+	TlfID  []byte          `codec:"tlfID" json:"tlfID"`
+	LockID keybase1.LockID `codec:"lockID" json:"lockID"`
+}
+
+type ReleaseLockArg struct {
+	TlfID  []byte          `codec:"tlfID" json:"tlfID"`
+	LockID keybase1.LockID `codec:"lockID" json:"lockID"`
+}
+
+type StartImplicitTeamMigrationArg struct {
+	TlfID []byte `codec:"tlfID" json:"tlfID"`
+}
+
+type PruneBranchArg struct {
+	TlfID    []byte `codec:"tlfID" json:"tlfID"`
+	BranchID []byte `codec:"branchID" json:"branchID"`
+}
+
+type WaitForMDUpdateArg struct {
+	TlfID    []byte `codec:"tlfID" json:"tlfID"`
+	CurrHead int64  `codec:"currHead" json:"currHead"`
+}
+
+type TruncateLockArg struct {
+	TlfID []byte `codec:"tlfID" json:"tlfID"`
+}
+
+type TruncateUnlockArg struct {
+	TlfID []byte `codec:"tlfID" json:"tlfID"`
+}
+
+type GetLatestHandleForTLFArg struct {
+	TlfID []byte `codec:"tlfID" json:"tlfID"`
+}
+
+type GetKeyBundlesArg struct {
+	TlfID             []byte `codec:"tlfID" json:"tlfID"`
+	WriterKeyBundleID []byte `codec:"writerKeyBundleID" json:"writerKeyBundleID"`
+	ReaderKeyBundleID []byte `codec:"readerKeyBundleID" json:"readerKeyBundleID"`
+}
+
+type GetMerkleRootLatestArg struct {
+	TreeID keybase1.MerkleTreeID `codec:"treeID" json:"treeID"`
+}
+
+type GetTLFCryptKeyServerHalfArg struct {
+	ServerHalfID   []byte `codec:"serverHalfID" json:"serverHalfID"`
+	CryptPublicKey []byte `codec:"cryptPublicKey" json:"cryptPublicKey"`
+}
+
+type PutTLFCryptKeyServerHalvesArg struct {
+	ServerHalves []byte `codec:"serverHalves" json:"serverHalves"`
+}
+
+type DeleteTLFCryptKeyServerHalfArg struct {
+	Uid            keybase1.UID `codec:"uid" json:"uid"`
+	CryptPublicKey []byte       `codec:"cryptPublicKey" json:"cryptPublicKey"`
+	ServerHalfID   []byte       `codec:"serverHalfID" json:"serverHalfID"`
+}
+
+type GetBlockFromServerArg struct {
+	TlfID        []byte `codec:"tlfID" json:"tlfID"`
+	BlockID      []byte `codec:"blockID" json:"blockID"`
+	BlockContext []byte `codec:"blockContext" json:"blockContext"`
+}
+
+type PutBlockToServerArg struct {
+	TlfID        []byte `codec:"tlfID" json:"tlfID"`
+	BlockID      []byte `codec:"blockID" json:"blockID"`
+	BlockContext []byte `codec:"blockContext" json:"blockContext"`
+	Buf          []byte `codec:"buf" json:"buf"`
+	ServerHalf   []byte `codec:"serverHalf" json:"serverHalf"`
+	Again        bool   `codec:"again" json:"again"`
+}
+
+type AddBlockReferenceArg struct {
+	TlfID        []byte `codec:"tlfID" json:"tlfID"`
+	BlockID      []byte `codec:"blockID" json:"blockID"`
+	BlockContext []byte `codec:"blockContext" json:"blockContext"`
+}
+
+type RemoveBlockReferencesArg struct {
+	TlfID    []byte `codec:"tlfID" json:"tlfID"`
+	Contexts []byte `codec:"contexts" json:"contexts"`
+}
+
+type ArchiveBlockReferencesArg struct {
+	TlfID    []byte `codec:"tlfID" json:"tlfID"`
+	Contexts []byte `codec:"contexts" json:"contexts"`
+}
+
+type GetUserQuotaInfoArg struct {
+}
+
+type GetTeamQuotaInfoArg struct {
+	Tid keybase1.TeamID `codec:"tid" json:"tid"`
+}
+
+// LocalServerInterface specifies how to access the MD, key and block servers of a local shared server process.
+type LocalServerInterface interface {
+	// Hello identifies the user and device on the other end of this connection.
+	Hello(context.Context, []byte) error
+	// GetMDForHandle gets the current MD for a TLF handle.
+	GetMDForHandle(context.Context, GetMDForHandleArg) (GetMDForHandleRes, error)
+	// GetMDForTLF gets the current MD for a TLF ID.
+	GetMDForTLF(context.Context, GetMDForTLFArg) (*LocalServerMDBlock, error)
+	// GetMDForTLFByTime gets the earliest merged MD written at or after the given time.
+	GetMDForTLFByTime(context.Context, GetMDForTLFByTimeArg) (*LocalServerMDBlock, error)
+	// GetMDRange gets a range of MD revisions for a TLF.
+	GetMDRange(context.Context, GetMDRangeArg) ([]LocalServerMDBlock, error)
+	// PutMD puts a new MD revision.
+	PutMD(context.Context, PutMDArg) error
+	// Lock takes the given lock for a TLF.
+	Lock(context.Context, LockArg) error
+	// ReleaseLock releases the given lock for a TLF.
+	ReleaseLock(context.Context, ReleaseLockArg) error
+	// StartImplicitTeamMigration starts the implicit team migration for a TLF.
+	StartImplicitTeamMigration(context.Context, []byte) error
+	// PruneBranch prunes an unmerged branch of a TLF.
+	PruneBranch(context.Context, PruneBranchArg) error
+	// WaitForMDUpdate blocks until a merged MD update newer than currHead is written by another connection.
+	WaitForMDUpdate(context.Context, WaitForMDUpdateArg) error
+	// TruncateLock takes the history truncation lock for a TLF.
+	TruncateLock(context.Context, []byte) (bool, error)
+	// TruncateUnlock releases the history truncation lock for a TLF.
+	TruncateUnlock(context.Context, []byte) (bool, error)
+	// GetLatestHandleForTLF gets the latest serialized handle for a TLF.
+	GetLatestHandleForTLF(context.Context, []byte) ([]byte, error)
+	// GetKeyBundles gets serialized key bundles for a TLF.
+	GetKeyBundles(context.Context, GetKeyBundlesArg) (GetKeyBundlesRes, error)
+	// GetMerkleRootLatest gets the latest serialized KBFS merkle root.
+	GetMerkleRootLatest(context.Context, keybase1.MerkleTreeID) ([]byte, error)
+	// GetTLFCryptKeyServerHalf gets a serialized TLF key server half.
+	GetTLFCryptKeyServerHalf(context.Context, GetTLFCryptKeyServerHalfArg) ([]byte, error)
+	// PutTLFCryptKeyServerHalves puts serialized TLF key server halves.
+	PutTLFCryptKeyServerHalves(context.Context, []byte) error
+	// DeleteTLFCryptKeyServerHalf deletes a TLF key server half.
+	DeleteTLFCryptKeyServerHalf(context.Context, DeleteTLFCryptKeyServerHalfArg) error
+	// GetBlockFromServer gets an encrypted block.
+	GetBlockFromServer(context.Context, GetBlockFromServerArg) (GetBlockFromServerRes, error)
+	// PutBlockToServer puts an encrypted block.
+	PutBlockToServer(context.Context, PutBlockToServerArg) error
+	// AddBlockReference adds a reference to an existing block.
+	AddBlockReference(context.Context, AddBlockReferenceArg) error
+	// RemoveBlockReferences removes block references, and returns the serialized live counts.
+	RemoveBlockReferences(context.Context, RemoveBlockReferencesArg) ([]byte, error)
+	// ArchiveBlockReferences archives block references.
+	ArchiveBlockReferences(context.Context, ArchiveBlockReferencesArg) error
+	// GetUserQuotaInfo gets the serialized quota info for the current user.
+	GetUserQuotaInfo(context.Context) ([]byte, error)
+	// GetTeamQuotaInfo gets the serialized quota info for a team.
+	GetTeamQuotaInfo(context.Context, keybase1.TeamID) ([]byte, error)
+}
+
+func LocalServerProtocol(i LocalServerInterface) rpc.Protocol {
+	return rpc.Protocol{
+		Name: "kbgitkbfs.1.LocalServer",
+		Methods: map[string]rpc.ServeHandlerDescription{
+			"Hello": {
+				MakeArg: func() interface{} {
+					ret := make([]HelloArg, 1)
+					return &ret
+				},
+				Handler: func(ctx context.Context, args interface{}) (ret interface{}, err error) {
+					typedArgs, ok := args.(*[]HelloArg)
+					if !ok {
+						err = rpc.NewTypeError((*[]HelloArg)(nil), args)
+						return
+					}
+					err = i.Hello(ctx, (*typedArgs)[0].Session)
+					return
+				},
+				MethodType: rpc.MethodCall,
+			},
+			"GetMDForHandle": {
+				MakeArg: func() interface{} {
+					ret := make([]GetMDForHandleArg, 1)
+					return &ret
+				},
+				Handler: func(ctx context.Context, args interface{}) (ret interface{}, err error) {
+					typedArgs, ok := args.(*[]GetMDForHandleArg)
+					if !ok {
+						err = rpc.NewTypeError((*[]GetMDForHandleArg)(nil), args)
+						return
+					}
+					ret, err = i.GetMDForHandle(ctx, (*typedArgs)[0])
+					return
+				},
+				MethodType: rpc.MethodCall,
+			},
+			"GetMDForTLF": {
+				MakeArg: func() interface{} {
+					ret := make([]GetMDForTLFArg, 1)
+					return &ret
+				},
+				Handler: func(ctx context.Context, args interface{}) (ret interface{}, err error) {
+					typedArgs, ok := args.(*[]GetMDForTLFArg)
+					if !ok {
+						err = rpc.NewTypeError((*[]GetMDForTLFArg)(nil), args)
+						return
+					}
+					ret, err = i.GetMDForTLF(ctx, (*typedArgs)[0])
+					return
+				},
+				MethodType: rpc.MethodCall,
+			},
+			"GetMDForTLFByTime": {
+				MakeArg: func() interface{} {
+					ret := make([]GetMDForTLFByTimeArg, 1)
+					return &ret
+				},
+				Handler: func(ctx context.Context, args interface{}) (ret interface{}, err error) {
+					typedArgs, ok := args.(*[]GetMDForTLFByTimeArg)
+					if !ok {
+						err = rpc.NewTypeError((*[]GetMDForTLFByTimeArg)(nil), args)
+						return
+					}
+					ret, err = i.GetMDForTLFByTime(ctx, (*typedArgs)[0])
+					return
+				},
+				MethodType: rpc.MethodCall,
+			},
+			"GetMDRange": {
+				MakeArg: func() interface{} {
+					ret := make([]GetMDRangeArg, 1)
+					return &ret
+				},
+				Handler: func(ctx context.Context, args interface{}) (ret interface{}, err error) {
+					typedArgs, ok := args.(*[]GetMDRangeArg)
+					if !ok {
+						err = rpc.NewTypeError((*[]GetMDRangeArg)(nil), args)
+						return
+					}
+					ret, err = i.GetMDRange(ctx, (*typedArgs)[0])
+					return
+				},
+				MethodType: rpc.MethodCall,
+			},
+			"PutMD": {
+				MakeArg: func() interface{} {
+					ret := make([]PutMDArg, 1)
+					return &ret
+				},
+				Handler: func(ctx context.Context, args interface{}) (ret interface{}, err error) {
+					typedArgs, ok := args.(*[]PutMDArg)
+					if !ok {
+						err = rpc.NewTypeError((*[]PutMDArg)(nil), args)
+						return
+					}
+					err = i.PutMD(ctx, (*typedArgs)[0])
+					return
+				},
+				MethodType: rpc.MethodCall,
+			},
+			"Lock": {
+				MakeArg: func() interface{} {
+					ret := make([]LockArg, 1)
+					return &ret
+				},
+				Handler: func(ctx context.Context, args interface{}) (ret interface{}, err error) {
+					typedArgs, ok := args.(*[]LockArg)
+					if !ok {
+						err = rpc.NewTypeError((*[]LockArg)(nil), args)
+						return
+					}
+					err = i.Lock(ctx, (*typedArgs)[0])
+					return
+				},
+				MethodType: rpc.MethodCall,
+			},
+			"ReleaseLock": {
+				MakeArg: func() interface{} {
+					ret := make([]ReleaseLockArg, 1)
+					return &ret
+				},
+				Handler: func(ctx context.Context, args interface{}) (ret interface{}, err error) {
+					typedArgs, ok := args.(*[]ReleaseLockArg)
+					if !ok {
+						err = rpc.NewTypeError((*[]ReleaseLockArg)(nil), args)
+						return
+					}
+					err = i.ReleaseLock(ctx, (*typedArgs)[0])
+					return
+				},
+				MethodType: rpc.MethodCall,
+			},
+			"StartImplicitTeamMigration": {
+				MakeArg: func() interface{} {
+					ret := make([]StartImplicitTeamMigrationArg, 1)
+					return &ret
+				},
+				Handler: func(ctx context.Context, args interface{}) (ret interface{}, err error) {
+					typedArgs, ok := args.(*[]StartImplicitTeamMigrationArg)
+					if !ok {
+						err = rpc.NewTypeError((*[]StartImplicitTeamMigrationArg)(nil), args)
+						return
+					}
+					err = i.StartImplicitTeamMigration(ctx, (*typedArgs)[0].TlfID)
+					return
+				},
+				MethodType: rpc.MethodCall,
+			},
+			"PruneBranch": {
+				MakeArg: func() interface{} {
+					ret := make([]PruneBranchArg, 1)
+					return &ret
+				},
+				Handler: func(ctx context.Context, args interface{}) (ret interface{}, err error) {
+					typedArgs, ok := args.(*[]PruneBranchArg)
+					if !ok {
+						err = rpc.NewTypeError((*[]PruneBranchArg)(nil), args)
+						return
+					}
+					err = i.PruneBranch(ctx, (*typedArgs)[0])
+					return
+				},
+				MethodType: rpc.MethodCall,
+			},
+			"WaitForMDUpdate": {
+				MakeArg: func() interface{} {
+					ret := make([]WaitForMDUpdateArg, 1)
+					return &ret
+				},
+				Handler: func(ctx context.Context, args interface{}) (ret interface{}, err error) {
+					typedArgs, ok := args.(*[]WaitForMDUpdateArg)
+					if !ok {
+						err = rpc.NewTypeError((*[]WaitForMDUpdateArg)(nil), args)
+						return
+					}
+					err = i.WaitForMDUpdate(ctx, (*typedArgs)[0])
+					return
+				},
+				MethodType: rpc.MethodCall,
+			},
+			"TruncateLock": {
+				MakeArg: func() interface{} {
+					ret := make([]TruncateLockArg, 1)
+					return &ret
+				},
+				Handler: func(ctx context.Context, args interface{}) (ret interface{}, err error) {
+					typedArgs, ok := args.(*[]TruncateLockArg)
+					if !ok {
+						err = rpc.NewTypeError((*[]TruncateLockArg)(nil), args)
+						return
+					}
+					ret, err = i.TruncateLock(ctx, (*typedArgs)[0].TlfID)
+					return
+				},
+				MethodType: rpc.MethodCall,
+			},
+			"TruncateUnlock": {
+				MakeArg: func() interface{} {
+					ret := make([]TruncateUnlockArg, 1)
+					return &ret
+				},
+				Handler: func(ctx context.Context, args interface{}) (ret interface{}, err error) {
+					typedArgs, ok := args.(*[]TruncateUnlockArg)
+					if !ok {
+						err = rpc.NewTypeError((*[]TruncateUnlockArg)(nil), args)
+						return
+					}
+					ret, err = i.TruncateUnlock(ctx, (*typedArgs)[0].TlfID)
+					return
+				},
+				MethodType: rpc.MethodCall,
+			},
+			"GetLatestHandleForTLF": {
+				MakeArg: func() interface{} {
+					ret := make([]GetLatestHandleForTLFArg, 1)
+					return &ret
+				},
+				Handler: func(ctx context.Context, args interface{}) (ret interface{}, err error) {
+					typedArgs, ok := args.(*[]GetLatestHandleForTLFArg)
+					if !ok {
+						err = rpc.NewTypeError((*[]GetLatestHandleForTLFArg)(nil), args)
+						return
+					}
+					ret, err = i.GetLatestHandleForTLF(ctx, (*typedArgs)[0].TlfID)
+					return
+				},
+				MethodType: rpc.MethodCall,
+			},
+			"GetKeyBundles": {
+				MakeArg: func() interface{} {
+					ret := make([]GetKeyBundlesArg, 1)
+					return &ret
+				},
+				Handler: func(ctx context.Context, args interface{}) (ret interface{}, err error) {
+					typedArgs, ok := args.(*[]GetKeyBundlesArg)
+					if !ok {
+						err = rpc.NewTypeError((*[]GetKeyBundlesArg)(nil), args)
+						return
+					}
+					ret, err = i.GetKeyBundles(ctx, (*typedArgs)[0])
+					return
+				},
+				MethodType: rpc.MethodCall,
+			},
+			"GetMerkleRootLatest": {
+				MakeArg: func() interface{} {
+					ret := make([]GetMerkleRootLatestArg, 1)
+					return &ret
+				},
+				Handler: func(ctx context.Context, args interface{}) (ret interface{}, err error) {
+					typedArgs, ok := args.(*[]GetMerkleRootLatestArg)
+					if !ok {
+						err = rpc.NewTypeError((*[]GetMerkleRootLatestArg)(nil), args)
+						return
+					}
+					ret, err = i.GetMerkleRootLatest(ctx, (*typedArgs)[0].TreeID)
+					return
+				},
+				MethodType: rpc.MethodCall,
+			},
+			"GetTLFCryptKeyServerHalf": {
+				MakeArg: func() interface{} {
+					ret := make([]GetTLFCryptKeyServerHalfArg, 1)
+					return &ret
+				},
+				Handler: func(ctx context.Context, args interface{}) (ret interface{}, err error) {
+					typedArgs, ok := args.(*[]GetTLFCryptKeyServerHalfArg)
+					if !ok {
+						err = rpc.NewTypeError((*[]GetTLFCryptKeyServerHalfArg)(nil), args)
+						return
+					}
+					ret, err = i.GetTLFCryptKeyServerHalf(ctx, (*typedArgs)[0])
+					return
+				},
+				MethodType: rpc.MethodCall,
+			},
+			"PutTLFCryptKeyServerHalves": {
+				MakeArg: func() interface{} {
+					ret := make([]PutTLFCryptKeyServerHalvesArg, 1)
+					return &ret
+				},
+				Handler: func(ctx context.Context, args interface{}) (ret interface{}, err error) {
+					typedArgs, ok := args.(*[]PutTLFCryptKeyServerHalvesArg)
+					if !ok {
+						err = rpc.NewTypeError((*[]PutTLFCryptKeyServerHalvesArg)(nil), args)
+						return
+					}
+					err = i.PutTLFCryptKeyServerHalves(ctx, (*typedArgs)[0].ServerHalves)
+					return
+				},
+				MethodType: rpc.MethodCall,
+			},
+			"DeleteTLFCryptKeyServerHalf": {
+				MakeArg: func() interface{} {
+					ret := make([]DeleteTLFCryptKeyServerHalfArg, 1)
+					return &ret
+				},
+				Handler: func(ctx context.Context, args interface{}) (ret interface{}, err error) {
+					typedArgs, ok := args.(*[]DeleteTLFCryptKeyServerHalfArg)
+					if !ok {
+						err = rpc.NewTypeError((*[]DeleteTLFCryptKeyServerHalfArg)(nil), args)
+						return
+					}
+					err = i.DeleteTLFCryptKeyServerHalf(ctx, (*typedArgs)[0])
+					return
+				},
+				MethodType: rpc.MethodCall,
+			},
+			"GetBlockFromServer": {
+				MakeArg: func() interface{} {
+					ret := make([]GetBlockFromServerArg, 1)
+					return &ret
+				},
+				Handler: func(ctx context.Context, args interface{}) (ret interface{}, err error) {
+					typedArgs, ok := args.(*[]GetBlockFromServerArg)
+					if !ok {
+						err = rpc.NewTypeError((*[]GetBlockFromServerArg)(nil), args)
+						return
+					}
+					ret, err = i.GetBlockFromServer(ctx, (*typedArgs)[0])
+					return
+				},
+				MethodType: rpc.MethodCall,
+			},
+			"PutBlockToServer": {
+				MakeArg: func() interface{} {
+					ret := make([]PutBlockToServerArg, 1)
+					return &ret
+				},
+				Handler: func(ctx context.Context, args interface{}) (ret interface{}, err error) {
+					typedArgs, ok := args.(*[]PutBlockToServerArg)
+					if !ok {
+						err = rpc.NewTypeError((*[]PutBlockToServerArg)(nil), args)
+						return
+					}
+					err = i.PutBlockToServer(ctx, (*typedArgs)[0])
+					return
+				},
+				MethodType: rpc.MethodCall,
+			},
+			"AddBlockReference": {
+				MakeArg: func() interface{} {
+					ret := make([]AddBlockReferenceArg, 1)
+					return &ret
+				},
+				Handler: func(ctx context.Context, args interface{}) (ret interface{}, err error) {
+					typedArgs, ok := args.(*[]AddBlockReferenceArg)
+					if !ok {
+						err = rpc.NewTypeError((*[]AddBlockReferenceArg)(nil), args)
+						return
+					}
+					err = i.AddBlockReference(ctx, (*typedArgs)[0])
+					return
+				},
+				MethodType: rpc.MethodCall,
+			},
+			"RemoveBlockReferences": {
+				MakeArg: func() interface{} {
+					ret := make([]RemoveBlockReferencesArg, 1)
+					return &ret
+				},
+				Handler: func(ctx context.Context, args interface{}) (ret interface{}, err error) {
+					typedArgs, ok := args.(*[]RemoveBlockReferencesArg)
+					if !ok {
+						err = rpc.NewTypeError((*[]RemoveBlockReferencesArg)(nil), args)
+						return
+					}
+					ret, err = i.RemoveBlockReferences(ctx, (*typedArgs)[0])
+					return
+				},
+				MethodType: rpc.MethodCall,
+			},
+			"ArchiveBlockReferences": {
+				MakeArg: func() interface{} {
+					ret := make([]ArchiveBlockReferencesArg, 1)
+					return &ret
+				},
+				Handler: func(ctx context.Context, args interface{}) (ret interface{}, err error) {
+					typedArgs, ok := args.(*[]ArchiveBlockReferencesArg)
+					if !ok {
+						err = rpc.NewTypeError((*[]ArchiveBlockReferencesArg)(nil), args)
+						return
+					}
+					err = i.ArchiveBlockReferences(ctx, (*typedArgs)[0])
+					return
+				},
+				MethodType: rpc.MethodCall,
+			},
+			"GetUserQuotaInfo": {
+				MakeArg: func() interface{} {
+					ret := make([]GetUserQuotaInfoArg, 1)
+					return &ret
+				},
+				Handler: func(ctx context.Context, args interface{}) (ret interface{}, err error) {
+					ret, err = i.GetUserQuotaInfo(ctx)
+					return
+				},
+				MethodType: rpc.MethodCall,
+			},
+			"GetTeamQuotaInfo": {
+				MakeArg: func() interface{} {
+					ret := make([]GetTeamQuotaInfoArg, 1)
+					return &ret
+				},
+				Handler: func(ctx context.Context, args interface{}) (ret interface{}, err error) {
+					typedArgs, ok := args.(*[]GetTeamQuotaInfoArg)
+					if !ok {
+						err = rpc.NewTypeError((*[]GetTeamQuotaInfoArg)(nil), args)
+						return
+					}
+					ret, err = i.GetTeamQuotaInfo(ctx, (*typedArgs)[0].Tid)
+					return
+				},
+				MethodType: rpc.MethodCall,
+			},
+		},
+	}
+}
+
+type LocalServerClient struct {
+	Cli rpc.GenericClient
+}
+
+// Hello identifies the user and device on the other end of this connection.
+func (c LocalServerClient) Hello(ctx context.Context, session []byte) (err error) {
+	__arg := HelloArg{Session: session}
+	err = c.Cli.Call(ctx, "kbgitkbfs.1.LocalServer.Hello", []interface{}{__arg}, nil)
+	return
+}
+
+// GetMDForHandle gets the current MD for a TLF handle.
+func (c LocalServerClient) GetMDForHandle(ctx context.Context, __arg GetMDForHandleArg) (res GetMDForHandleRes, err error) {
+	err = c.Cli.Call(ctx, "kbgitkbfs.1.LocalServer.GetMDForHandle", []interface{}{__arg}, &res)
+	return
+}
+
+// GetMDForTLF gets the current MD for a TLF ID.
+func (c LocalServerClient) GetMDForTLF(ctx context.Context, __arg GetMDForTLFArg) (res *LocalServerMDBlock, err error) {
+	err = c.Cli.Call(ctx, "kbgitkbfs.1.LocalServer.GetMDForTLF", []interface{}{__arg}, &res)
+	return
+}
+
+// GetMDForTLFByTime gets the earliest merged MD written at or after the given time.
+func (c LocalServerClient) GetMDForTLFByTime(ctx context.Context, __arg GetMDForTLFByTimeArg) (res *LocalServerMDBlock, err error) {
+	err = c.Cli.Call(ctx, "kbgitkbfs.1.LocalServer.GetMDForTLFByTime", []interface{}{__arg}, &res)
+	return
+}
+
+// GetMDRange gets a range of MD revisions for a TLF.
+func (c LocalServerClient) GetMDRange(ctx context.Context, __arg GetMDRangeArg) (res []LocalServerMDBlock, err error) {
+	err = c.Cli.Call(ctx, "kbgitkbfs.1.LocalServer.GetMDRange", []interface{}{__arg}, &res)
+	return
+}
+
+// PutMD puts a new MD revision.
+func (c LocalServerClient) PutMD(ctx context.Context, __arg PutMDArg) (err error) {
+	err = c.Cli.Call(ctx, "kbgitkbfs.1.LocalServer.PutMD", []interface{}{__arg}, nil)
+	return
+}
+
+// Lock takes the given lock for a TLF.
+func (c LocalServerClient) Lock(ctx context.Context, __arg LockArg) (err error) {
+	err = c.Cli.Call(ctx, "kbgitkbfs.1.LocalServer.Lock", []interface{}{__arg}, nil)
+	return
+}
+
+// ReleaseLock releases the given lock for a TLF.
+func (c LocalServerClient) ReleaseLock(ctx context.Context, __arg ReleaseLockArg) (err error) {
+	err = c.Cli.Call(ctx, "kbgitkbfs.1.LocalServer.ReleaseLock", []interface{}{__arg}, nil)
+	return
+}
+
+// StartImplicitTeamMigration starts the implicit team migration for a TLF.
+func (c LocalServerClient) StartImplicitTeamMigration(ctx context.Context, tlfID []byte) (err error) {
+	__arg := StartImplicitTeamMigrationArg{TlfID: tlfID}
+	err = c.Cli.Call(ctx, "kbgitkbfs.1.LocalServer.StartImplicitTeamMigration", []interface{}{__arg}, nil)
+	return
+}
+
+// PruneBranch prunes an unmerged branch of a TLF.
+func (c LocalServerClient) PruneBranch(ctx context.Context, __arg PruneBranchArg) (err error) {
+	err = c.Cli.Call(ctx, "kbgitkbfs.1.LocalServer.PruneBranch", []interface{}{__arg}, nil)
+	return
+}
+
+// WaitForMDUpdate blocks until a merged MD update newer than currHead is written by another connection.
+func (c LocalServerClient) WaitForMDUpdate(ctx context.Context, __arg WaitForMDUpdateArg) (err error) {
+	err = c.Cli.Call(ctx, "kbgitkbfs.1.LocalServer.WaitForMDUpdate", []interface{}{__arg}, nil)
+	return
+}
+
+// TruncateLock takes the history truncation lock for a TLF.
+func (c LocalServerClient) TruncateLock(ctx context.Context, tlfID []byte) (res bool, err error) {
+	__arg := TruncateLockArg{TlfID: tlfID}
+	err = c.Cli.Call(ctx, "kbgitkbfs.1.LocalServer.TruncateLock", []interface{}{__arg}, &res)
+	return
+}
+
+// TruncateUnlock releases the history truncation lock for a TLF.
+func (c LocalServerClient) TruncateUnlock(ctx context.Context, tlfID []byte) (res bool, err error) {
+	__arg := TruncateUnlockArg{TlfID: tlfID}
+	err = c.Cli.Call(ctx, "kbgitkbfs.1.LocalServer.TruncateUnlock", []interface{}{__arg}, &res)
+	return
+}
+
+// GetLatestHandleForTLF gets the latest serialized handle for a TLF.
+func (c LocalServerClient) GetLatestHandleForTLF(ctx context.Context, tlfID []byte) (res []byte, err error) {
+	__arg := GetLatestHandleForTLFArg{TlfID: tlfID}
+	err = c.Cli.Call(ctx, "kbgitkbfs.1.LocalServer.GetLatestHandleForTLF", []interface{}{__arg}, &res)
+	return
+}
+
+// GetKeyBundles gets serialized key bundles for a TLF.
+func (c LocalServerClient) GetKeyBundles(ctx context.Context, __arg GetKeyBundlesArg) (res GetKeyBundlesRes, err error) {
+	err = c.Cli.Call(ctx, "kbgitkbfs.1.LocalServer.GetKeyBundles", []interface{}{__arg}, &res)
+	return
+}
+
+// GetMerkleRootLatest gets the latest serialized KBFS merkle root.
+func (c LocalServerClient) GetMerkleRootLatest(ctx context.Context, treeID keybase1.MerkleTreeID) (res []byte, err error) {
+	__arg := GetMerkleRootLatestArg{TreeID: treeID}
+	err = c.Cli.Call(ctx, "kbgitkbfs.1.LocalServer.GetMerkleRootLatest", []interface{}{__arg}, &res)
+	return
+}
+
+// GetTLFCryptKeyServerHalf gets a serialized TLF key server half.
+func (c LocalServerClient) GetTLFCryptKeyServerHalf(ctx context.Context, __arg GetTLFCryptKeyServerHalfArg) (res []byte, err error) {
+	err = c.Cli.Call(ctx, "kbgitkbfs.1.LocalServer.GetTLFCryptKeyServerHalf", []interface{}{__arg}, &res)
+	return
+}
+
+// PutTLFCryptKeyServerHalves puts serialized TLF key server halves.
+func (c LocalServerClient) PutTLFCryptKeyServerHalves(ctx context.Context, serverHalves []byte) (err error) {
+	__arg := PutTLFCryptKeyServerHalvesArg{ServerHalves: serverHalves}
+	err = c.Cli.Call(ctx, "kbgitkbfs.1.LocalServer.PutTLFCryptKeyServerHalves", []interface{}{__arg}, nil)
+	return
+}
+
+// DeleteTLFCryptKeyServerHalf deletes a TLF key server half.
+func (c LocalServerClient) DeleteTLFCryptKeyServerHalf(ctx context.Context, __arg DeleteTLFCryptKeyServerHalfArg) (err error) {
+	err = c.Cli.Call(ctx, "kbgitkbfs.1.LocalServer.DeleteTLFCryptKeyServerHalf", []interface{}{__arg}, nil)
+	return
+}
+
+// GetBlockFromServer gets an encrypted block.
+func (c LocalServerClient) GetBlockFromServer(ctx context.Context, __arg GetBlockFromServerArg) (res GetBlockFromServerRes, err error) {
+	err = c.Cli.Call(ctx, "kbgitkbfs.1.LocalServer.GetBlockFromServer", []interface{}{__arg}, &res)
+	return
+}
+
+// PutBlockToServer puts an encrypted block.
+func (c LocalServerClient) PutBlockToServer(ctx context.Context, __arg PutBlockToServerArg) (err error) {
+	err = c.Cli.Call(ctx, "kbgitkbfs.1.LocalServer.PutBlockToServer", []interface{}{__arg}, nil)
+	return
+}
+
+// AddBlockReference adds a reference to an existing block.
+func (c LocalServerClient) AddBlockReference(ctx context.Context, __arg AddBlockReferenceArg) (err error) {
+	err = c.Cli.Call(ctx, "kbgitkbfs.1.LocalServer.AddBlockReference", []interface{}{__arg}, nil)
+	return
+}
+
+// RemoveBlockReferences removes block references, and returns the serialized live counts.
+func (c LocalServerClient) RemoveBlockReferences(ctx context.Context, __arg RemoveBlockReferencesArg) (res []byte, err error) {
+	err = c.Cli.Call(ctx, "kbgitkbfs.1.LocalServer.RemoveBlockReferences", []interface{}{__arg}, &res)
+	return
+}
+
+// ArchiveBlockReferences archives block references.
+func (c LocalServerClient) ArchiveBlockReferences(ctx context.Context, __arg ArchiveBlockReferencesArg) (err error) {
+	err = c.Cli.Call(ctx, "kbgitkbfs.1.LocalServer.ArchiveBlockReferences", []interface{}{__arg}, nil)
+	return
+}
+
+// GetUserQuotaInfo gets the serialized quota info for the current user.
+func (c LocalServerClient) GetUserQuotaInfo(ctx context.Context) (res []byte, err error) {
+	__arg := GetUserQuotaInfoArg{}
+	err = c.Cli.Call(ctx, "kbgitkbfs.1.LocalServer.GetUserQuotaInfo", []interface{}{__arg}, &res)
+	return
+}
+
+// GetTeamQuotaInfo gets the serialized quota info for a team.
+func (c LocalServerClient) GetTeamQuotaInfo(ctx context.Context, tid keybase1.TeamID) (res []byte, err error) {
+	__arg := GetTeamQuotaInfoArg{Tid: tid}
+	err = c.Cli.Call(ctx, "kbgitkbfs.1.LocalServer.GetTeamQuotaInfo", []interface{}{__arg}, &res)
+	return
+}
@@ -0,0 +1,267 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package search
+
+import (
+	"bytes"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/keybase/kbfs/ioutil"
+	"github.com/keybase/kbfs/kbfscodec"
+	"github.com/keybase/kbfs/kbfscrypto"
+	"github.com/keybase/kbfs/kbfsmd"
+	"github.com/pkg/errors"
+)
+
+const (
+	// minTermLen and maxTermLen bound the length, in runes, of the
+	// terms that get indexed.  Shorter ones are too common to be
+	// useful, and longer ones are usually encoded data.
+	minTermLen = 2
+	maxTermLen = 64
+
+	// textSniffLen is how much of a file is checked for NUL bytes
+	// when deciding whether it's text.
+	textSniffLen = 8000
+
+	currentIndexFileVersion = 1
+)
+
+// tokenize splits `s` into lower-cased words, returning each
+// indexable one once, in sorted order.
+func tokenize(s string) []string {
+	seen := make(map[string]bool)
+	words := strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, w := range words {
+		n := utf8.RuneCountInString(w)
+		if n < minTermLen || n > maxTermLen {
+			continue
+		}
+		seen[strings.ToLower(w)] = true
+	}
+	terms := make([]string, 0, len(seen))
+	for term := range seen {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+	return terms
+}
+
+// isText returns whether `buf` looks like the contents of a text
+// file: valid UTF-8 with no NUL bytes near the start.
+func isText(buf []byte) bool {
+	sniff := buf
+	if len(sniff) > textSniffLen {
+		sniff = sniff[:textSniffLen]
+	}
+	return bytes.IndexByte(sniff, 0) < 0 && utf8.Valid(buf)
+}
+
+// indexData is the encoded form of a TLF's index.
+type indexData struct {
+	// Revision is the TLF revision that the index reflects.
+	Revision kbfsmd.Revision
+	// Docs maps the path of each indexed file, relative to the TLF
+	// root, to its sorted terms.
+	Docs map[string][]string
+}
+
+// tlfIndex is an inverted index over the text files of a single TLF.
+// It isn't safe for concurrent use.
+type tlfIndex struct {
+	data indexData
+	// postings maps each term to the set of paths containing it.
+	postings map[string]map[string]bool
+}
+
+func newTlfIndex() *tlfIndex {
+	return &tlfIndex{
+		data:     indexData{Docs: make(map[string][]string)},
+		postings: make(map[string]map[string]bool),
+	}
+}
+
+func (ti *tlfIndex) addPostings(p string, terms []string) {
+	for _, term := range terms {
+		paths := ti.postings[term]
+		if paths == nil {
+			paths = make(map[string]bool)
+			ti.postings[term] = paths
+		}
+		paths[p] = true
+	}
+}
+
+// setDoc replaces the terms indexed for the file at `p`.
+func (ti *tlfIndex) setDoc(p string, terms []string) {
+	ti.removeDoc(p)
+	if len(terms) == 0 {
+		return
+	}
+	ti.data.Docs[p] = terms
+	ti.addPostings(p, terms)
+}
+
+func (ti *tlfIndex) removeDoc(p string) {
+	for _, term := range ti.data.Docs[p] {
+		paths := ti.postings[term]
+		delete(paths, p)
+		if len(paths) == 0 {
+			delete(ti.postings, term)
+		}
+	}
+	delete(ti.data.Docs, p)
+}
+
+// removeUnder drops the file at `p`, and every file under it if it's
+// a directory.  An empty `p` drops everything.
+func (ti *tlfIndex) removeUnder(p string) {
+	if p == "" {
+		rev := ti.data.Revision
+		*ti = *newTlfIndex()
+		ti.data.Revision = rev
+		return
+	}
+	for docPath := range ti.data.Docs {
+		if docPath == p || strings.HasPrefix(docPath, p+"/") {
+			ti.removeDoc(docPath)
+		}
+	}
+}
+
+// query returns the sorted paths, at or under `prefix`, of the files
+// that contain all of `terms`.  If `maxResults` is positive, at most
+// that many are returned.
+func (ti *tlfIndex) query(
+	terms []string, prefix string, maxResults int) []string {
+	if len(terms) == 0 {
+		return nil
+	}
+	// Start from the rarest term, to check as few paths as possible.
+	sorted := make([]string, len(terms))
+	copy(sorted, terms)
+	sort.Slice(sorted, func(i, j int) bool {
+		return len(ti.postings[sorted[i]]) < len(ti.postings[sorted[j]])
+	})
+	var results []string
+	for p := range ti.postings[sorted[0]] {
+		if prefix != "" && p != prefix && !strings.HasPrefix(p, prefix+"/") {
+			continue
+		}
+		matches := true
+		for _, term := range sorted[1:] {
+			if !ti.postings[term][p] {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			results = append(results, p)
+		}
+	}
+	sort.Strings(results)
+	if maxResults > 0 && len(results) > maxResults {
+		results = results[:maxResults]
+	}
+	return results
+}
+
+// indexFile is what's stored on disk for each TLF's index.
+type indexFile struct {
+	Version int
+	// KeyGen is the key generation of the TLF crypt key that the
+	// index is encrypted with.
+	KeyGen kbfsmd.KeyGen
+	Index  kbfscrypto.EncryptedSearchIndex
+}
+
+// errStaleIndex is returned when a saved index can't be used, and
+// must be rebuilt.
+var errStaleIndex = errors.New("search index is stale")
+
+// loadIndex reads and decrypts the index at `indexPath`.  It returns
+// an error satisfying `ioutil.IsNotExist` if there is no index, and
+// errStaleIndex if the index was made with a key generation other
+// than `keyGen`.
+func loadIndex(codec kbfscodec.Codec, indexPath string,
+	keyGen kbfsmd.KeyGen, key kbfscrypto.TLFCryptKey) (*tlfIndex, error) {
+	buf, err := ioutil.ReadFile(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	var f indexFile
+	err = codec.Decode(buf, &f)
+	if err != nil {
+		return nil, err
+	}
+	if f.Version != currentIndexFileVersion || f.KeyGen != keyGen {
+		return nil, errors.WithStack(errStaleIndex)
+	}
+	encoded, err := kbfscrypto.DecryptSearchIndex(f.Index, key)
+	if err != nil {
+		return nil, err
+	}
+	ti := newTlfIndex()
+	err = codec.Decode(encoded, &ti.data)
+	if err != nil {
+		return nil, err
+	}
+	if ti.data.Docs == nil {
+		ti.data.Docs = make(map[string][]string)
+	}
+	for p, terms := range ti.data.Docs {
+		ti.addPostings(p, terms)
+	}
+	return ti, nil
+}
+
+// save encrypts the index and writes it to `indexPath`.
+func (ti *tlfIndex) save(codec kbfscodec.Codec, indexPath string,
+	keyGen kbfsmd.KeyGen, key kbfscrypto.TLFCryptKey) error {
+	encoded, err := codec.Encode(ti.data)
+	if err != nil {
+		return err
+	}
+	encrypted, err := kbfscrypto.EncryptSearchIndex(encoded, key)
+	if err != nil {
+		return err
+	}
+	buf, err := codec.Encode(indexFile{
+		Version: currentIndexFileVersion,
+		KeyGen:  keyGen,
+		Index:   encrypted,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Write to a temp file and rename it into place, so a crash
+	// never leaves a partial index behind.
+	err = ioutil.MkdirAll(filepath.Dir(indexPath), 0700)
+	if err != nil {
+		return err
+	}
+	tmpPath := indexPath + ".tmp"
+	err = ioutil.WriteFile(tmpPath, buf, 0600)
+	if err != nil {
+		return err
+	}
+	return ioutil.Rename(tmpPath, indexPath)
+}
+
+// removeIndex deletes the index at `indexPath`, if there is one.
+func removeIndex(indexPath string) error {
+	err := ioutil.Remove(indexPath)
+	if err != nil && !ioutil.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
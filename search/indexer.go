@@ -0,0 +1,757 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package search
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+
+	"github.com/keybase/client/go/logger"
+	"github.com/keybase/client/go/protocol/keybase1"
+	"github.com/keybase/kbfs/ioutil"
+	"github.com/keybase/kbfs/kbfscrypto"
+	"github.com/keybase/kbfs/kbfsmd"
+	"github.com/keybase/kbfs/libfs"
+	"github.com/keybase/kbfs/libkbfs"
+	"github.com/keybase/kbfs/tlf"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+const (
+	// IndexFolderName is the name of the directory, under the
+	// storage root, where search indexes are kept.
+	IndexFolderName = "kbfs_search_index"
+
+	// DefaultMaxFileSize is the default size, in bytes, of the
+	// biggest file whose contents get indexed.
+	DefaultMaxFileSize = 1 << 20
+
+	ctxOpID = "SEARCH"
+)
+
+type ctxTagKey int
+
+const (
+	ctxIDKey ctxTagKey = iota
+)
+
+// NotSyncedError is returned when searching a TLF that isn't synced
+// for offline use, and so isn't indexed.
+type NotSyncedError struct {
+	Tlf string
+}
+
+// Error implements the error interface for NotSyncedError.
+func (e NotSyncedError) Error() string {
+	return e.Tlf + " is not synced, so it can't be searched"
+}
+
+// NoIndexError is returned when there's no usable saved index for a
+// TLF.
+type NoIndexError struct {
+	Tlf string
+}
+
+// Error implements the error interface for NoIndexError.
+func (e NoIndexError) Error() string {
+	return "no up-to-date search index for " + e.Tlf
+}
+
+// getLatestKey returns the latest key generation of the TLF, and its
+// crypt key.
+func getLatestKey(ctx context.Context, config libkbfs.Config,
+	h *libkbfs.TlfHandle) (kbfsmd.KeyGen, kbfscrypto.TLFCryptKey, error) {
+	keys, _, err := config.KBFSOps().GetTLFCryptKeys(ctx, h)
+	if err != nil {
+		return 0, kbfscrypto.TLFCryptKey{}, err
+	}
+	if len(keys) == 0 {
+		// Public TLFs have no key generations.
+		return kbfsmd.PublicKeyGen, kbfscrypto.PublicTLFCryptKey, nil
+	}
+	return kbfsmd.FirstValidKeyGen + kbfsmd.KeyGen(len(keys)-1),
+		keys[len(keys)-1], nil
+}
+
+// Indexer keeps encrypted full-text indexes of the text files in TLFs
+// that are synced for offline use, so their contents can be searched
+// without reading every file.
+//
+// A TLF's index is built the first time the TLF is searched, and
+// saved under the indexer's directory, encrypted with a key derived
+// from the TLF's latest crypt key.  From then on it's kept up to
+// date from the TLF's change notifications, and a saved index is
+// brought up to date by diffing revisions when it's next loaded.  An
+// index is deleted when its TLF is no longer synced, and rebuilt
+// when the TLF is rekeyed.
+type Indexer struct {
+	config      libkbfs.Config
+	log         logger.Logger
+	dir         string
+	maxFileSize int64
+
+	shutdownCh   chan struct{}
+	shutdownOnce sync.Once
+
+	lock sync.Mutex
+	tlfs map[tlf.ID]*tlfIndexerFuture
+}
+
+// tlfIndexerFuture is a tlfIndexer that may still be loading or
+// building its index.
+type tlfIndexerFuture struct {
+	done chan struct{}
+	// ti and err are set before `done` is closed.
+	ti  *tlfIndexer
+	err error
+	// dropped is set, under Indexer.lock, when the TLF is dropped
+	// before its index is ready.
+	dropped bool
+}
+
+// NewIndexer makes a new Indexer, which keeps its indexes under
+// `dir`, or only in memory if `dir` is empty.  Files bigger than
+// `maxFileSize` bytes aren't indexed.  Saved indexes of TLFs that
+// are no longer synced are deleted right away, and the index of a
+// TLF is deleted as soon as syncing is disabled for it.
+func NewIndexer(config libkbfs.Config, dir string, maxFileSize int64) (
+	*Indexer, error) {
+	idx := &Indexer{
+		config:      config,
+		log:         config.MakeLogger(ctxOpID),
+		dir:         dir,
+		maxFileSize: maxFileSize,
+		shutdownCh:  make(chan struct{}),
+		tlfs:        make(map[tlf.ID]*tlfIndexerFuture),
+	}
+	err := idx.removeUnsyncedIndexes()
+	if err != nil {
+		return nil, err
+	}
+	config.AddTlfSyncStateHandler(idx.onTlfSyncStateChange)
+	return idx, nil
+}
+
+func (idx *Indexer) indexPath(id tlf.ID) string {
+	if idx.dir == "" {
+		return ""
+	}
+	return filepath.Join(idx.dir, id.String())
+}
+
+func (idx *Indexer) removeUnsyncedIndexes() error {
+	if idx.dir == "" {
+		return nil
+	}
+	fis, err := ioutil.ReadDir(idx.dir)
+	switch {
+	case ioutil.IsNotExist(err):
+		return nil
+	case err != nil:
+		return err
+	}
+	for _, fi := range fis {
+		id, err := tlf.ParseID(fi.Name())
+		if err == nil && idx.config.IsSyncedTlf(id) {
+			continue
+		}
+		idx.log.Debug("Removing search index %s", fi.Name())
+		err = ioutil.RemoveAll(filepath.Join(idx.dir, fi.Name()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// onTlfSyncStateChange drops the index of a TLF that is no longer
+// synced, whether or not it was opened by this Indexer.
+func (idx *Indexer) onTlfSyncStateChange(id tlf.ID, isSynced bool) {
+	if isSynced {
+		return
+	}
+	select {
+	case <-idx.shutdownCh:
+		return
+	default:
+	}
+	// Closing an open index waits for its pending updates, so don't
+	// hold up the caller.
+	go idx.drop(id)
+}
+
+// drop stops indexing the given TLF, and deletes its index.
+func (idx *Indexer) drop(id tlf.ID) {
+	idx.lock.Lock()
+	f := idx.tlfs[id]
+	delete(idx.tlfs, id)
+	var ti *tlfIndexer
+	if f != nil {
+		f.dropped = true
+		select {
+		case <-f.done:
+			ti = f.ti
+		default:
+			// The opener closes the index, and deletes it again,
+			// once it's ready.
+		}
+	}
+	idx.lock.Unlock()
+
+	if ti != nil {
+		ti.close()
+	}
+	idx.removeIndexFile(id)
+}
+
+func (idx *Indexer) removeIndexFile(id tlf.ID) {
+	p := idx.indexPath(id)
+	if p == "" {
+		return
+	}
+	idx.log.Debug("Removing search index for %s", id)
+	err := removeIndex(p)
+	if err != nil {
+		idx.log.Debug("Couldn't remove search index for %s: %+v", id, err)
+	}
+}
+
+// getOrOpen returns the indexer of the given TLF, loading or building
+// its index if needed.  Only the first caller for a TLF does that,
+// without holding `idx.lock`, and any others wait for it.
+func (idx *Indexer) getOrOpen(
+	ctx context.Context, h *libkbfs.TlfHandle, id tlf.ID) (
+	*tlfIndexer, error) {
+	idx.lock.Lock()
+	select {
+	case <-idx.shutdownCh:
+		idx.lock.Unlock()
+		return nil, errors.New("search indexer is shut down")
+	default:
+	}
+	f, ok := idx.tlfs[id]
+	if ok {
+		idx.lock.Unlock()
+		select {
+		case <-f.done:
+			return f.ti, f.err
+		case <-ctx.Done():
+			return nil, errors.WithStack(ctx.Err())
+		}
+	}
+	f = &tlfIndexerFuture{done: make(chan struct{})}
+	idx.tlfs[id] = f
+	idx.lock.Unlock()
+
+	ti, err := newTlfIndexer(ctx, idx, h, id)
+
+	idx.lock.Lock()
+	stillOpen := idx.tlfs[id] == f
+	switch {
+	case err != nil:
+		if stillOpen {
+			// Let the next search try again.
+			delete(idx.tlfs, id)
+		}
+	case !stillOpen:
+		err = errors.Errorf(
+			"stopped indexing %s while opening its index", id)
+	default:
+		f.ti = ti
+	}
+	f.err = err
+	dropped := f.dropped
+	close(f.done)
+	idx.lock.Unlock()
+
+	if err != nil {
+		if ti != nil {
+			ti.close()
+			if dropped {
+				// It may have been saved after it was deleted.
+				idx.removeIndexFile(id)
+			}
+		}
+		return nil, err
+	}
+	return ti, nil
+}
+
+// Search returns the paths, relative to the TLF root, of the text
+// files at or under `prefix` in the given TLF that contain every
+// word of `query`, in sorted order.  Words are matched whole and
+// without regard to case.  If `maxResults` is positive, at most that
+// many paths are returned.  The TLF is indexed first if needed, so
+// the first search of a big TLF can take a while.
+func (idx *Indexer) Search(ctx context.Context, h *libkbfs.TlfHandle,
+	prefix string, query string, maxResults int) ([]string, error) {
+	terms := tokenize(query)
+	if len(terms) == 0 {
+		return nil, errors.Errorf("no searchable words in %q", query)
+	}
+
+	id, err := idx.config.KBFSOps().GetTLFID(ctx, h)
+	if err != nil {
+		return nil, err
+	}
+	if !idx.config.IsSyncedTlf(id) {
+		idx.drop(id)
+		return nil, NotSyncedError{h.GetCanonicalPath()}
+	}
+
+	ti, err := idx.getOrOpen(ctx, h, id)
+	if err != nil {
+		return nil, err
+	}
+	return ti.search(ctx, terms, cleanPrefix(prefix), maxResults)
+}
+
+// Shutdown stops all indexing.
+func (idx *Indexer) Shutdown() {
+	idx.shutdownOnce.Do(func() {
+		close(idx.shutdownCh)
+	})
+	idx.lock.Lock()
+	tlfs := idx.tlfs
+	idx.tlfs = make(map[tlf.ID]*tlfIndexerFuture)
+	var tis []*tlfIndexer
+	for _, f := range tlfs {
+		select {
+		case <-f.done:
+			if f.ti != nil {
+				tis = append(tis, f.ti)
+			}
+		default:
+			// The opener closes the index once it's ready.
+		}
+	}
+	idx.lock.Unlock()
+	for _, ti := range tis {
+		ti.close()
+	}
+}
+
+func cleanPrefix(p string) string {
+	p = path.Clean("/" + p)
+	if p == "/" {
+		return ""
+	}
+	return p[1:]
+}
+
+// SearchSavedIndex searches the index saved under `dir` for the given
+// TLF, without updating it, for processes that can't keep it up to
+// date themselves.  It returns the revision the index reflects along
+// with the matching paths, a NotSyncedError if the TLF isn't synced
+// anymore, or a NoIndexError if there's no index or the TLF has been
+// rekeyed since it was saved.
+func SearchSavedIndex(ctx context.Context, config libkbfs.Config,
+	dir string, h *libkbfs.TlfHandle, prefix string, query string,
+	maxResults int) ([]string, kbfsmd.Revision, error) {
+	terms := tokenize(query)
+	if len(terms) == 0 {
+		return nil, kbfsmd.RevisionUninitialized,
+			errors.Errorf("no searchable words in %q", query)
+	}
+	id, err := config.KBFSOps().GetTLFID(ctx, h)
+	if err != nil {
+		return nil, kbfsmd.RevisionUninitialized, err
+	}
+	if !config.IsSyncedTlf(id) {
+		return nil, kbfsmd.RevisionUninitialized,
+			NotSyncedError{h.GetCanonicalPath()}
+	}
+	keyGen, key, err := getLatestKey(ctx, config, h)
+	if err != nil {
+		return nil, kbfsmd.RevisionUninitialized, err
+	}
+	index, err := loadIndex(
+		config.Codec(), filepath.Join(dir, id.String()), keyGen, key)
+	switch {
+	case ioutil.IsNotExist(err) || errors.Cause(err) == errStaleIndex:
+		return nil, kbfsmd.RevisionUninitialized,
+			NoIndexError{h.GetCanonicalPath()}
+	case err != nil:
+		return nil, kbfsmd.RevisionUninitialized, err
+	}
+	return index.query(terms, cleanPrefix(prefix), maxResults),
+		index.data.Revision, nil
+}
+
+// tlfIndexer keeps the index of a single TLF up to date.
+type tlfIndexer struct {
+	idx       *Indexer
+	id        tlf.ID
+	h         *libkbfs.TlfHandle
+	fs        *libfs.FS
+	watcher   *libfs.Watcher
+	ctx       context.Context
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+	done      chan struct{}
+
+	lock   sync.Mutex
+	index  *tlfIndex
+	keyGen kbfsmd.KeyGen
+	key    kbfscrypto.TLFCryptKey
+	// needsCatchUp is set when a change couldn't be applied to the
+	// index, whose revision then stays put until a catch-up from
+	// it succeeds.
+	needsCatchUp bool
+}
+
+// newTlfIndexer starts watching the given TLF, and loads or builds
+// its index.
+func newTlfIndexer(ctx context.Context, idx *Indexer,
+	h *libkbfs.TlfHandle, id tlf.ID) (ti *tlfIndexer, err error) {
+	// The indexer outlives the request that opened it.
+	tiCtx, cancel := context.WithCancel(libkbfs.CtxWithRandomIDReplayable(
+		context.Background(), ctxIDKey, ctxOpID, idx.log))
+	defer func() {
+		if err != nil {
+			cancel()
+		}
+	}()
+	fs, err := libfs.NewFS(
+		tiCtx, idx.config, h, libkbfs.MasterBranch, "", "",
+		keybase1.MDPriorityNormal)
+	if err != nil {
+		return nil, err
+	}
+	// Start watching before reading anything, so no change is
+	// missed.  Changes seen twice are harmless, since updating a
+	// path just re-reads it.
+	w, err := fs.Watch("", true)
+	if err != nil {
+		return nil, err
+	}
+	ti = &tlfIndexer{
+		idx:     idx,
+		id:      id,
+		h:       h,
+		fs:      fs,
+		watcher: w,
+		ctx:     tiCtx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	err = ti.loadOrBuild(ctx)
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+	go ti.processEvents()
+	return ti, nil
+}
+
+func (ti *tlfIndexer) headRevision(ctx context.Context) (
+	kbfsmd.Revision, error) {
+	status, _, err := ti.idx.config.KBFSOps().FolderStatus(
+		ctx, ti.fs.RootNode().GetFolderBranch())
+	if err != nil {
+		return kbfsmd.RevisionUninitialized, err
+	}
+	return status.Revision, nil
+}
+
+// loadOrBuild loads the saved index and brings it up to date, or
+// builds a new one if there's no usable saved index.
+func (ti *tlfIndexer) loadOrBuild(ctx context.Context) error {
+	ti.lock.Lock()
+	defer ti.lock.Unlock()
+	keyGen, key, err := getLatestKey(ctx, ti.idx.config, ti.h)
+	if err != nil {
+		return err
+	}
+	ti.keyGen, ti.key = keyGen, key
+
+	if p := ti.idx.indexPath(ti.id); p != "" {
+		index, err := loadIndex(ti.idx.config.Codec(), p, keyGen, key)
+		switch {
+		case err == nil:
+			ti.index = index
+			err = ti.catchUpLocked(ctx)
+			if err == nil {
+				return ti.saveLocked()
+			}
+			ti.idx.log.CDebugf(ctx, "Couldn't bring the index for %s up "+
+				"to date; rebuilding: %+v", ti.id, err)
+		case ioutil.IsNotExist(err):
+		default:
+			ti.idx.log.CDebugf(ctx, "Couldn't load the index for %s; "+
+				"rebuilding: %+v", ti.id, err)
+		}
+	}
+	return ti.rebuildLocked(ctx)
+}
+
+func (ti *tlfIndexer) rebuildLocked(ctx context.Context) error {
+	ti.idx.log.CDebugf(ctx, "Building the search index for %s", ti.id)
+	rev, err := ti.headRevision(ctx)
+	if err != nil {
+		return err
+	}
+	ti.index = newTlfIndex()
+	err = ti.updatePathLocked(ctx, "")
+	if err != nil {
+		return err
+	}
+	ti.index.data.Revision = rev
+	ti.needsCatchUp = false
+	return ti.saveLocked()
+}
+
+// catchUpLocked applies the changes made since the index was saved.
+func (ti *tlfIndexer) catchUpLocked(ctx context.Context) error {
+	head, err := ti.headRevision(ctx)
+	if err != nil {
+		return err
+	}
+	from := ti.index.data.Revision
+	if head <= from {
+		return nil
+	}
+	diffs, err := ti.idx.config.KBFSOps().DiffRevisions(
+		ctx, ti.fs.RootNode().GetFolderBranch(), from, head)
+	if err != nil {
+		return err
+	}
+	for _, d := range diffs {
+		err = ti.updatePathLocked(ctx, d.Path)
+		if err != nil {
+			return err
+		}
+		if d.OldPath != "" {
+			err = ti.updatePathLocked(ctx, d.OldPath)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	ti.index.data.Revision = head
+	ti.needsCatchUp = false
+	return nil
+}
+
+// retryCatchUpLocked catches up the index if some change couldn't be
+// applied to it earlier.
+func (ti *tlfIndexer) retryCatchUpLocked(ctx context.Context) {
+	if !ti.needsCatchUp {
+		return
+	}
+	err := ti.catchUpLocked(ctx)
+	if err != nil {
+		ti.idx.log.CDebugf(ctx, "Couldn't bring the index for %s up to "+
+			"date: %+v", ti.id, err)
+		return
+	}
+	err = ti.saveLocked()
+	if err != nil {
+		ti.idx.log.CDebugf(ctx, "Couldn't save the index for %s: %+v",
+			ti.id, err)
+	}
+}
+
+func (ti *tlfIndexer) saveLocked() error {
+	p := ti.idx.indexPath(ti.id)
+	if p == "" {
+		return nil
+	}
+	return ti.index.save(ti.idx.config.Codec(), p, ti.keyGen, ti.key)
+}
+
+func (ti *tlfIndexer) readTerms(p string, fi os.FileInfo) ([]string, error) {
+	if fi.Size() > ti.idx.maxFileSize {
+		return nil, nil
+	}
+	f, err := ti.fs.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	buf, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	if !isText(buf) {
+		return nil, nil
+	}
+	return tokenize(string(buf)), nil
+}
+
+// updatePathLocked makes the index reflect the current state of the
+// entry at `p`, and everything under it if it's a directory.  An
+// empty `p` means the whole TLF.
+func (ti *tlfIndexer) updatePathLocked(ctx context.Context, p string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	var fi os.FileInfo
+	var err error
+	if p != "" {
+		fi, err = ti.fs.Lstat(p)
+		if ioutil.IsNotExist(err) {
+			ti.index.removeUnder(p)
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case p == "" || fi.IsDir():
+		ti.index.removeUnder(p)
+		fis, err := ti.fs.ReadDir(p)
+		if err != nil {
+			return err
+		}
+		for _, child := range fis {
+			err = ti.updatePathLocked(ctx, path.Join(p, child.Name()))
+			if err != nil {
+				return err
+			}
+		}
+	case fi.Mode().IsRegular():
+		terms, err := ti.readTerms(p, fi)
+		if err != nil {
+			return err
+		}
+		ti.index.setDoc(p, terms)
+	default:
+		// Symlinks aren't followed.
+		ti.index.removeUnder(p)
+	}
+	return nil
+}
+
+// checkKeyGenLocked rebuilds the index if the TLF has been rekeyed
+// since the index was saved.
+func (ti *tlfIndexer) checkKeyGenLocked(ctx context.Context) error {
+	keyGen, key, err := getLatestKey(ctx, ti.idx.config, ti.h)
+	if err != nil {
+		return err
+	}
+	if keyGen == ti.keyGen {
+		return nil
+	}
+	ti.idx.log.CDebugf(ctx, "%s was rekeyed from key generation %d to "+
+		"%d; rebuilding the search index", ti.id, ti.keyGen, keyGen)
+	ti.keyGen, ti.key = keyGen, key
+	return ti.rebuildLocked(ctx)
+}
+
+func (ti *tlfIndexer) search(ctx context.Context, terms []string,
+	prefix string, maxResults int) ([]string, error) {
+	ti.lock.Lock()
+	defer ti.lock.Unlock()
+	err := ti.checkKeyGenLocked(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ti.retryCatchUpLocked(ctx)
+	return ti.index.query(terms, prefix, maxResults), nil
+}
+
+// processEvents applies changes to the TLF to the index as they're
+// reported, until the watcher is closed.
+func (ti *tlfIndexer) processEvents() {
+	defer close(ti.done)
+	events := ti.watcher.Events()
+	for e := range events {
+		// Apply everything that's already been reported together,
+		// so a burst of changes only saves the index once.
+		batch := []libfs.WatchEvent{e}
+	drain:
+		for {
+			select {
+			case e, ok := <-events:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, e)
+			default:
+				break drain
+			}
+		}
+		ti.processBatch(batch)
+	}
+}
+
+func (ti *tlfIndexer) processBatch(batch []libfs.WatchEvent) {
+	if !ti.idx.config.IsSyncedTlf(ti.id) {
+		go ti.idx.drop(ti.id)
+		return
+	}
+
+	ti.lock.Lock()
+	defer ti.lock.Unlock()
+	ctx := ti.ctx
+	err := ti.checkKeyGenLocked(ctx)
+	if err != nil {
+		ti.idx.log.CDebugf(ctx, "Couldn't check the key generation of %s: "+
+			"%+v", ti.id, err)
+		return
+	}
+	ti.retryCatchUpLocked(ctx)
+	ti.applyBatchLocked(ctx, batch)
+	err = ti.saveLocked()
+	if err != nil {
+		ti.idx.log.CDebugf(ctx, "Couldn't save the index for %s: %+v",
+			ti.id, err)
+	}
+}
+
+// applyBatchLocked updates the index for the given changes.
+func (ti *tlfIndexer) applyBatchLocked(
+	ctx context.Context, batch []libfs.WatchEvent) {
+	updated := make(map[string]bool)
+	update := func(p string) {
+		if updated[p] {
+			return
+		}
+		updated[p] = true
+		err := ti.updatePathLocked(ctx, p)
+		if err != nil {
+			ti.idx.log.CDebugf(ctx, "Couldn't index %s in %s: %+v",
+				p, ti.id, err)
+			ti.needsCatchUp = true
+		}
+	}
+	rev := ti.index.data.Revision
+	for _, e := range batch {
+		update(e.Path)
+		if e.OldPath != "" {
+			update(e.OldPath)
+		}
+		if e.Revision > rev {
+			rev = e.Revision
+		}
+	}
+	// Keep the old revision if anything failed, so that the next
+	// catch-up (in this process or after a restart) retries it.
+	if !ti.needsCatchUp {
+		ti.index.data.Revision = rev
+	}
+}
+
+func (ti *tlfIndexer) close() {
+	ti.closeOnce.Do(func() {
+		// The watcher runs under ti.ctx, so it must be closed, and
+		// drained, before ti.ctx is canceled.
+		err := ti.watcher.Close()
+		if err != nil {
+			ti.idx.log.CDebugf(ti.ctx, "Couldn't close the watcher for %s: "+
+				"%+v", ti.id, err)
+		}
+		<-ti.done
+		ti.cancel()
+	})
+}
@@ -0,0 +1,273 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package search
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/keybase/client/go/protocol/keybase1"
+	"github.com/keybase/kbfs/kbfscrypto"
+	"github.com/keybase/kbfs/kbfsmd"
+	"github.com/keybase/kbfs/libfs"
+	"github.com/keybase/kbfs/libkbfs"
+	"github.com/keybase/kbfs/tlf"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+// syncedConfig lets tests choose which TLFs count as synced, without
+// setting up a sync block cache.
+type syncedConfig struct {
+	*libkbfs.ConfigLocal
+
+	lock     sync.Mutex
+	synced   map[tlf.ID]bool
+	handlers []func(tlf.ID, bool)
+}
+
+func (c *syncedConfig) IsSyncedTlf(id tlf.ID) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.synced[id]
+}
+
+func (c *syncedConfig) AddTlfSyncStateHandler(f func(tlf.ID, bool)) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.handlers = append(c.handlers, f)
+}
+
+func (c *syncedConfig) setSynced(id tlf.ID, synced bool) {
+	c.lock.Lock()
+	c.synced[id] = synced
+	handlers := c.handlers
+	c.lock.Unlock()
+	for _, f := range handlers {
+		f(id, synced)
+	}
+}
+
+// waitForNoIndex waits until the saved index at `p` is deleted, since
+// that happens in the background.
+func waitForNoIndex(t *testing.T, p string) {
+	var err error
+	for i := 0; i < 100; i++ {
+		_, err = os.Stat(p)
+		if os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("Index %s wasn't deleted: %+v", p, err)
+}
+
+func TestTokenize(t *testing.T) {
+	require.Equal(t, []string{"42", "hello", "wörld"},
+		tokenize("Hello, WÖRLD! a hello-42"))
+	require.Empty(t, tokenize("a b c"))
+	require.True(t, isText([]byte("plain text\n")))
+	require.False(t, isText([]byte("bin\x00ary")))
+	require.False(t, isText([]byte{0xff, 0xfe}))
+}
+
+func TestIndexQueryAndPersistence(t *testing.T) {
+	ti := newTlfIndex()
+	ti.setDoc("a.txt", tokenize("hello world"))
+	ti.setDoc("dir/b.txt", tokenize("hello there"))
+	ti.setDoc("dirt.txt", tokenize("hello dirt"))
+	ti.data.Revision = 5
+
+	require.Equal(t, []string{"a.txt", "dir/b.txt", "dirt.txt"},
+		ti.query([]string{"hello"}, "", 0))
+	require.Equal(t, []string{"a.txt"},
+		ti.query([]string{"hello", "world"}, "", 0))
+	require.Equal(t, []string{"dir/b.txt"},
+		ti.query([]string{"hello"}, "dir", 0))
+	require.Equal(t, []string{"a.txt"}, ti.query([]string{"hello"}, "", 1))
+
+	ti.removeUnder("dir")
+	require.Equal(t, []string{"a.txt", "dirt.txt"},
+		ti.query([]string{"hello"}, "", 0))
+
+	tempdir, err := ioutil.TempDir(os.TempDir(), "search_index")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempdir)
+	config := libkbfs.MakeTestConfigOrBust(t, "user1")
+	defer libkbfs.CheckConfigAndShutdown(context.Background(), t, config)
+	codec := config.Codec()
+	indexPath := filepath.Join(tempdir, "index")
+	key := kbfscrypto.MakeTLFCryptKey([32]byte{1})
+	require.NoError(t, ti.save(codec, indexPath, kbfsmd.FirstValidKeyGen, key))
+
+	t.Log("The saved index is encrypted")
+	buf, err := ioutil.ReadFile(indexPath)
+	require.NoError(t, err)
+	require.NotContains(t, string(buf), "hello")
+
+	loaded, err := loadIndex(codec, indexPath, kbfsmd.FirstValidKeyGen, key)
+	require.NoError(t, err)
+	require.Equal(t, kbfsmd.Revision(5), loaded.data.Revision)
+	require.Equal(t, []string{"a.txt"},
+		loaded.query([]string{"world"}, "", 0))
+
+	t.Log("An index from an older key generation is stale")
+	_, err = loadIndex(codec, indexPath, kbfsmd.FirstValidKeyGen+1, key)
+	require.Equal(t, errStaleIndex, errors.Cause(err))
+
+	require.NoError(t, removeIndex(indexPath))
+	require.NoError(t, removeIndex(indexPath))
+	_, err = loadIndex(codec, indexPath, kbfsmd.FirstValidKeyGen, key)
+	require.True(t, os.IsNotExist(errors.Cause(err)))
+}
+
+func writeAndSync(
+	ctx context.Context, t *testing.T, fs *libfs.FS, p, data string) {
+	f, err := fs.Create(p)
+	require.NoError(t, err)
+	_, err = f.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	require.NoError(t, fs.SyncAll())
+}
+
+// waitForResults searches until the results match `expected`, since
+// the index is updated in the background.
+func waitForResults(ctx context.Context, t *testing.T, idx *Indexer,
+	h *libkbfs.TlfHandle, query string, expected []string) {
+	var results []string
+	for i := 0; i < 100; i++ {
+		var err error
+		results, err = idx.Search(ctx, h, "", query, 0)
+		require.NoError(t, err)
+		if len(results) == len(expected) &&
+			(len(expected) == 0 || results[0] == expected[0]) {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	require.Equal(t, expected, results)
+}
+
+func TestIndexer(t *testing.T) {
+	ctx := libkbfs.BackgroundContextWithCancellationDelayer()
+	defer libkbfs.CleanupCancellationDelayer(ctx)
+	config := libkbfs.MakeTestConfigOrBust(t, "user1")
+	defer libkbfs.CheckConfigAndShutdown(ctx, t, config)
+	sc := &syncedConfig{ConfigLocal: config, synced: make(map[tlf.ID]bool)}
+
+	h, err := libkbfs.ParseTlfHandle(
+		ctx, config.KBPKI(), config.MDOps(), "user1", tlf.Private)
+	require.NoError(t, err)
+	fs, err := libfs.NewFS(
+		ctx, config, h, libkbfs.MasterBranch, "", "",
+		keybase1.MDPriorityNormal)
+	require.NoError(t, err)
+	require.NoError(t, fs.MkdirAll("dir", 0700))
+	writeAndSync(ctx, t, fs, "a.txt", "Hello world")
+	writeAndSync(ctx, t, fs, "dir/b.txt", "hello there")
+	writeAndSync(ctx, t, fs, "bin", "hello\x00")
+	writeAndSync(ctx, t, fs, "big.txt", "hello hello hello hello hello")
+	id := fs.RootNode().GetFolderBranch().Tlf
+
+	tempdir, err := ioutil.TempDir(os.TempDir(), "search_indexer")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempdir)
+	idx, err := NewIndexer(sc, tempdir, 20)
+	require.NoError(t, err)
+	defer idx.Shutdown()
+
+	t.Log("Unsynced TLFs can't be searched")
+	_, err = idx.Search(ctx, h, "", "hello", 0)
+	require.IsType(t, NotSyncedError{}, err)
+
+	t.Log("Only small text files are indexed")
+	sc.setSynced(id, true)
+	results, err := idx.Search(ctx, h, "", "hello", 0)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a.txt", "dir/b.txt"}, results)
+	results, err = idx.Search(ctx, h, "dir", "HELLO", 0)
+	require.NoError(t, err)
+	require.Equal(t, []string{"dir/b.txt"}, results)
+
+	t.Log("Changes are indexed as they happen")
+	writeAndSync(ctx, t, fs, "c.txt", "goodbye world")
+	waitForResults(ctx, t, idx, h, "world", []string{"a.txt", "c.txt"})
+	require.NoError(t, fs.Remove("a.txt"))
+	require.NoError(t, fs.SyncAll())
+	waitForResults(ctx, t, idx, h, "world", []string{"c.txt"})
+	require.NoError(t, fs.Rename("dir", "dir2"))
+	require.NoError(t, fs.SyncAll())
+	waitForResults(ctx, t, idx, h, "there", []string{"dir2/b.txt"})
+
+	t.Log("The saved index can be searched offline")
+	idx.Shutdown()
+	results, rev, err := SearchSavedIndex(
+		ctx, sc, tempdir, h, "", "world", 0)
+	require.NoError(t, err)
+	require.Equal(t, []string{"c.txt"}, results)
+	require.True(t, rev > kbfsmd.RevisionInitial)
+
+	t.Log("A reloaded index catches up on missed changes")
+	writeAndSync(ctx, t, fs, "d.txt", "missed world")
+	idx, err = NewIndexer(sc, tempdir, 20)
+	require.NoError(t, err)
+	defer idx.Shutdown()
+	results, err = idx.Search(ctx, h, "", "world", 0)
+	require.NoError(t, err)
+	require.Equal(t, []string{"c.txt", "d.txt"}, results)
+
+	t.Log("A failed update keeps the index at its old revision")
+	ti, err := idx.getOrOpen(ctx, h, id)
+	require.NoError(t, err)
+	ti.lock.Lock()
+	rev = ti.index.data.Revision
+	ti.lock.Unlock()
+	writeAndSync(ctx, t, fs, "e.txt", "late world")
+	ti.lock.Lock()
+	// Undo the change in case it was already applied.
+	ti.index.data.Revision = rev
+	ti.index.removeUnder("e.txt")
+	canceledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	ti.applyBatchLocked(canceledCtx, []libfs.WatchEvent{
+		{Path: "e.txt", Revision: rev + 1}})
+	require.True(t, ti.needsCatchUp)
+	require.Equal(t, rev, ti.index.data.Revision)
+	ti.retryCatchUpLocked(ctx)
+	require.False(t, ti.needsCatchUp)
+	require.True(t, ti.index.data.Revision > rev)
+	ti.lock.Unlock()
+	results, err = idx.Search(ctx, h, "", "late", 0)
+	require.NoError(t, err)
+	require.Equal(t, []string{"e.txt"}, results)
+
+	t.Log("Unsyncing the TLF deletes its index")
+	indexPath := filepath.Join(tempdir, id.String())
+	sc.setSynced(id, false)
+	waitForNoIndex(t, indexPath)
+	_, err = idx.Search(ctx, h, "", "world", 0)
+	require.IsType(t, NotSyncedError{}, err)
+	_, _, err = SearchSavedIndex(ctx, sc, tempdir, h, "", "world", 0)
+	require.IsType(t, NotSyncedError{}, err)
+
+	t.Log("Unsyncing also deletes indexes that aren't open")
+	sc.setSynced(id, true)
+	_, err = idx.Search(ctx, h, "", "world", 0)
+	require.NoError(t, err)
+	idx.Shutdown()
+	_, err = os.Stat(indexPath)
+	require.NoError(t, err)
+	idx, err = NewIndexer(sc, tempdir, 20)
+	require.NoError(t, err)
+	defer idx.Shutdown()
+	sc.setSynced(id, false)
+	waitForNoIndex(t, indexPath)
+}
@@ -10,6 +10,7 @@ import (
 	"io"
 	"os"
 	stdpath "path"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
@@ -24,8 +25,8 @@ import (
 	"github.com/keybase/kbfs/libfs"
 	"github.com/keybase/kbfs/libhttpserver"
 	"github.com/keybase/kbfs/libkbfs"
+	"github.com/keybase/kbfs/search"
 	"github.com/keybase/kbfs/tlf"
-	"golang.org/x/sync/errgroup"
 	billy "gopkg.in/src-d/go-billy.v4"
 	"gopkg.in/src-d/go-billy.v4/osfs"
 )
@@ -77,6 +78,12 @@ func defaultNewFS(ctx context.Context, config libkbfs.Config,
 }
 
 // SimpleFS is the simple filesystem rpc layer implementation.
+//
+// Its methods that aren't part of keybase1.SimpleFSInterface
+// (SimpleFSSearch, SimpleFSDiffRevisions, SimpleFSSearchContents and
+// SimpleFSRestoreFromRevision) have no protocol definitions, so they
+// can only be called from Go, on a *SimpleFS; exposing them over RPC
+// is out of scope here.
 type SimpleFS struct {
 	// log for logging - constant, does not need locking.
 	log logger.Logger
@@ -103,6 +110,10 @@ type SimpleFS struct {
 	subscribeCurrFB   libkbfs.FolderBranch
 
 	localHTTPServer *libhttpserver.Server
+
+	// indexer, if non-nil, is used to search the contents of synced
+	// TLFs.
+	indexer *search.Indexer
 }
 
 type inprogress struct {
@@ -147,6 +158,15 @@ func NewSimpleFS(g *libkb.GlobalContext, config libkbfs.Config) keybase1.SimpleF
 	return newSimpleFS(g, config)
 }
 
+// NewSimpleFSWithIndexer creates a new SimpleFS instance that uses
+// `indexer` to search the contents of synced TLFs.
+func NewSimpleFSWithIndexer(g *libkb.GlobalContext, config libkbfs.Config,
+	indexer *search.Indexer) keybase1.SimpleFSInterface {
+	k := newSimpleFS(g, config)
+	k.indexer = indexer
+	return k
+}
+
 func (k *SimpleFS) makeContext(ctx context.Context) context.Context {
 	return libkbfs.CtxWithRandomIDReplayable(ctx, ctxIDKey, ctxOpID, k.log)
 }
@@ -372,6 +392,25 @@ func (k *SimpleFS) setResult(opid keybase1.OpID, val interface{}) {
 	k.lock.Unlock()
 }
 
+// appendListResult adds `entries` to the list result of the given
+// op, which must have been started with `setResult`.  The result may
+// have been consumed by SimpleFSReadList in the meantime, in which
+// case it starts over with `entries`.  If the op has been closed, it
+// returns errNoSuchHandle, and the caller should stop listing.
+func (k *SimpleFS) appendListResult(
+	opid keybase1.OpID, entries []keybase1.Dirent) error {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	h, ok := k.handles[opid]
+	if !ok {
+		return errNoSuchHandle
+	}
+	lr, _ := h.async.(keybase1.SimpleFSListResult)
+	lr.Entries = append(lr.Entries, entries...)
+	h.async = lr
+	return nil
+}
+
 func (k *SimpleFS) startOp(ctx context.Context, opid keybase1.OpID,
 	opType keybase1.AsyncOps, desc keybase1.OpDescription) (
 	context.Context, error) {
@@ -568,6 +607,12 @@ func (k *SimpleFS) refreshSubscription(
 // Retrieve results with readList()
 // Cannot be a single file to get flags/status,
 // must be a directory.
+// Directory entries are sorted by name and are made available in
+// pages while the listing is still in progress, so a readList()
+// before the op is done returns a partial listing: only the entries
+// listed since the previous readList(), or an error if there are none
+// yet.  Callers that want the whole listing at once should wait for
+// the op first.
 func (k *SimpleFS) SimpleFSList(ctx context.Context, arg keybase1.SimpleFSListArg) error {
 	return k.startAsync(ctx, arg.OpID, keybase1.AsyncOps_LIST,
 		keybase1.NewOpDescriptionWithList(
@@ -622,32 +667,94 @@ func (k *SimpleFS) SimpleFSList(ctx context.Context, arg keybase1.SimpleFSListAr
 				if err != nil {
 					return err
 				}
-				var fis []os.FileInfo
-				if finalElemFI.IsDir() {
-					fis, err = fs.ReadDir(finalElem)
-				} else {
-					fis = append(fis, finalElemFI)
-				}
-				for _, fi := range fis {
-					if finalElemFI.IsDir() &&
-						isFiltered(arg.Filter, fi.Name()) {
-						continue
-					}
-
+				if !finalElemFI.IsDir() {
 					var d keybase1.Dirent
-					err := setStat(&d, fi)
+					err := setStat(&d, finalElemFI)
 					if err != nil {
 						return err
 					}
-					res = append(res, d)
+					k.updateReadProgress(arg.OpID, 0, 1)
+					k.setResult(arg.OpID, keybase1.SimpleFSListResult{
+						Entries: []keybase1.Dirent{d},
+					})
+					return nil
 				}
-				k.updateReadProgress(arg.OpID, 0, int64(len(fis)))
+
+				// Stream the listing one page at a time, so that
+				// callers of SimpleFSReadList can start consuming
+				// the entries of a big directory before the whole
+				// thing has been read.
+				return k.listPaged(
+					ctx, arg.OpID, fs, finalElem, arg.Filter)
 			}
 			k.setResult(arg.OpID, keybase1.SimpleFSListResult{Entries: res})
 			return nil
 		})
 }
 
+// listPageSize is the number of directory entries fetched and
+// published at a time by SimpleFSList.
+const listPageSize = 1000
+
+// pagedDirReader is implemented by filesystems that can list a
+// directory in name-ordered pages, like *libfs.FS.
+type pagedDirReader interface {
+	ReadDirPaged(p string, after string, maxEntries int) (
+		[]os.FileInfo, error)
+}
+
+// listPaged lists the directory `p` within `fs`, appending each page
+// of entries to the result of the given op as soon as it's read.
+// Filesystems that can't page are listed in one go.
+func (k *SimpleFS) listPaged(
+	ctx context.Context, opid keybase1.OpID, fs billy.Filesystem,
+	p string, filter keybase1.ListFilter) error {
+	// Make sure even an empty directory has a result.
+	k.setResult(opid, keybase1.SimpleFSListResult{})
+	pr, ok := fs.(pagedDirReader)
+	after := ""
+	for {
+		var fis []os.FileInfo
+		var err error
+		if ok {
+			fis, err = pr.ReadDirPaged(p, after, listPageSize)
+		} else {
+			fis, err = fs.ReadDir(p)
+		}
+		if err != nil {
+			return err
+		}
+
+		res := make([]keybase1.Dirent, 0, len(fis))
+		for _, fi := range fis {
+			if isFiltered(filter, fi.Name()) {
+				continue
+			}
+
+			var d keybase1.Dirent
+			err := setStat(&d, fi)
+			if err != nil {
+				return err
+			}
+			res = append(res, d)
+		}
+		k.updateReadProgress(opid, 0, int64(len(fis)))
+		if err := k.appendListResult(opid, res); err != nil {
+			return err
+		}
+
+		if !ok || len(fis) < listPageSize {
+			return nil
+		}
+		after = fis[len(fis)-1].Name()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+	}
+}
+
 // listRecursiveToDepthAsync returns a function that recursively lists folders,
 // up to a given depth. A depth of -1 is treated as unlimited. The function
 // also updates progress for the passed-in opID as it progresses, and then sets
@@ -774,8 +881,233 @@ func (k *SimpleFS) SimpleFSListRecursive(ctx context.Context, arg keybase1.Simpl
 	)
 }
 
+// SimpleFSSearchArg describes a SimpleFSSearch.  All the given
+// criteria must match for an entry to be returned.
+type SimpleFSSearchArg struct {
+	OpID keybase1.OpID
+	// Path is the directory to search under.
+	Path   keybase1.Path
+	Filter keybase1.ListFilter
+	// NameGlob, if non-empty, is a `path.Match` pattern that an
+	// entry's name must match.
+	NameGlob string
+	// PathRegexp, if non-empty, is a regular expression that must
+	// match somewhere in an entry's path relative to `Path`.
+	PathRegexp string
+	// MinSize and MaxSize bound the size of matching files, in
+	// bytes; a MaxSize of 0 means there's no upper bound.  If either
+	// is set, directories never match.
+	MinSize int64
+	MaxSize int64
+	// ModifiedAfter and ModifiedBefore bound the modification time of
+	// matching entries; a zero time means there's no bound.
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+	// Types, if non-empty, lists the entry types that match.
+	Types []keybase1.DirentType
+	// MaxResults caps the number of entries returned; 0 means
+	// there's no cap.
+	MaxResults int
+}
+
+// searchMatcher checks entries against the criteria of a
+// SimpleFSSearchArg.
+type searchMatcher struct {
+	arg    SimpleFSSearchArg
+	pathRE *regexp.Regexp
+}
+
+func newSearchMatcher(arg SimpleFSSearchArg) (*searchMatcher, error) {
+	sm := &searchMatcher{arg: arg}
+	if arg.NameGlob != "" {
+		if _, err := stdpath.Match(arg.NameGlob, ""); err != nil {
+			return nil, simpleFSError{
+				fmt.Sprintf("Bad name glob %q: %v", arg.NameGlob, err)}
+		}
+	}
+	if arg.PathRegexp != "" {
+		re, err := regexp.Compile(arg.PathRegexp)
+		if err != nil {
+			return nil, simpleFSError{
+				fmt.Sprintf("Bad path regexp %q: %v", arg.PathRegexp, err)}
+		}
+		sm.pathRE = re
+	}
+	if arg.MaxSize > 0 && arg.MinSize > arg.MaxSize {
+		return nil, simpleFSError{fmt.Sprintf(
+			"Min size %d is bigger than max size %d",
+			arg.MinSize, arg.MaxSize)}
+	}
+	if arg.MaxResults < 0 {
+		return nil, simpleFSError{"Max results can't be negative"}
+	}
+	return sm, nil
+}
+
+// matches returns whether the entry `de`, with path `p` relative to
+// the search root, should be returned.
+func (sm *searchMatcher) matches(p string, de keybase1.Dirent) bool {
+	arg := sm.arg
+	if arg.NameGlob != "" {
+		// The pattern was already checked, so there's no error.
+		if ok, _ := stdpath.Match(arg.NameGlob, stdpath.Base(p)); !ok {
+			return false
+		}
+	}
+	if sm.pathRE != nil && !sm.pathRE.MatchString(p) {
+		return false
+	}
+	if arg.MinSize > 0 || arg.MaxSize > 0 {
+		if de.DirentType == keybase1.DirentType_DIR {
+			return false
+		}
+		size := int64(de.Size)
+		if size < arg.MinSize || (arg.MaxSize > 0 && size > arg.MaxSize) {
+			return false
+		}
+	}
+	mtime := keybase1.FromTime(de.Time)
+	if !arg.ModifiedAfter.IsZero() && mtime.Before(arg.ModifiedAfter) {
+		return false
+	}
+	if !arg.ModifiedBefore.IsZero() && !mtime.Before(arg.ModifiedBefore) {
+		return false
+	}
+	if len(arg.Types) > 0 {
+		found := false
+		for _, t := range arg.Types {
+			if t == de.DirentType {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// search walks everything under `arg.Path`, appending each directory's
+// matching entries to the result of the op as soon as they're found.
+func (k *SimpleFS) search(
+	ctx context.Context, arg SimpleFSSearchArg, sm *searchMatcher) error {
+	fs, finalElem, err := k.getFS(ctx, arg.Path)
+	switch err.(type) {
+	case nil:
+	case libfs.TlfDoesNotExist:
+		// TLF doesn't exist yet; just return an empty result.
+		k.setResult(arg.OpID, keybase1.SimpleFSListResult{})
+		return nil
+	default:
+		return err
+	}
+
+	// Make sure even a search with no matches has a result.
+	k.setResult(arg.OpID, keybase1.SimpleFSListResult{})
+	// We don't know the totals ahead of time, so just start with a 0
+	// total.
+	k.setProgressTotals(arg.OpID, 0, 0)
+	fi, err := fs.Stat(finalElem)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		var de keybase1.Dirent
+		err := setStat(&de, fi)
+		if err != nil {
+			return err
+		}
+		k.updateReadProgress(arg.OpID, 0, 1)
+		if sm.matches(de.Name, de) {
+			return k.appendListResult(arg.OpID, []keybase1.Dirent{de})
+		}
+		return nil
+	}
+
+	// A stack of directories to search, relative to `finalElem`.
+	// Symlinks aren't followed, so there are no loops.
+	dirs := []string{""}
+	numResults := 0
+	for len(dirs) > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		dir := dirs[len(dirs)-1]
+		dirs = dirs[:len(dirs)-1]
+		fis, err := fs.ReadDir(stdpath.Join(finalElem, dir))
+		if err != nil {
+			return err
+		}
+		var res []keybase1.Dirent
+		for _, fi := range fis {
+			if isFiltered(arg.Filter, fi.Name()) {
+				continue
+			}
+			p := stdpath.Join(dir, fi.Name())
+			if fi.IsDir() {
+				dirs = append(dirs, p)
+			}
+
+			var de keybase1.Dirent
+			err := setStat(&de, fi)
+			if err != nil {
+				return err
+			}
+			if !sm.matches(p, de) {
+				continue
+			}
+			de.Name = p
+			res = append(res, de)
+			numResults++
+			if arg.MaxResults > 0 && numResults >= arg.MaxResults {
+				k.log.CDebugf(ctx, "Search hit the cap of %d results",
+					arg.MaxResults)
+				dirs = nil
+				break
+			}
+		}
+		k.updateReadProgress(arg.OpID, 0, int64(len(fis)))
+		if err := k.appendListResult(arg.OpID, res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SimpleFSSearch - Begin a recursive search under `arg.Path` for
+// entries matching the name, size, modification time and type
+// criteria in `arg`.  Like SimpleFSListRecursive, matches are read
+// with SimpleFSReadList (named by their path relative to
+// `arg.Path`), progress is reported by SimpleFSCheck, and the search
+// can be stopped with SimpleFSCancel.  Matches are published as each
+// directory is searched, so partial results are available before the
+// search completes.  The protocol has no search op type, so the op
+// is described as a LIST_RECURSIVE.
+func (k *SimpleFS) SimpleFSSearch(
+	ctx context.Context, arg SimpleFSSearchArg) error {
+	sm, err := newSearchMatcher(arg)
+	if err != nil {
+		return err
+	}
+	return k.startAsync(ctx, arg.OpID, keybase1.AsyncOps_LIST_RECURSIVE,
+		keybase1.NewOpDescriptionWithListRecursive(
+			keybase1.ListArgs{
+				OpID: arg.OpID, Path: arg.Path, Filter: arg.Filter,
+			}),
+		func(ctx context.Context) error {
+			return k.search(ctx, arg, sm)
+		})
+}
+
 // SimpleFSReadList - Get list of Paths in progress. Can indicate status of pending
 // to get more entries.
+// For listings and searches that are still in progress, this returns
+// only the entries found since the previous call, and an error if
+// there are none yet; see SimpleFSList.
 func (k *SimpleFS) SimpleFSReadList(_ context.Context, opid keybase1.OpID) (keybase1.SimpleFSListResult, error) {
 	k.lock.Lock()
 	res, _ := k.handles[opid]
@@ -1392,28 +1724,6 @@ func (k *SimpleFS) SimpleFSStat(ctx context.Context, path keybase1.Path) (de key
 	return de, err
 }
 
-func (k *SimpleFS) getRevisionsFromPath(
-	ctx context.Context, path keybase1.Path) (
-	os.FileInfo, libkbfs.PrevRevisions, error) {
-	fs, finalElem, err := k.getFS(ctx, path)
-	if err != nil {
-		k.log.CDebugf(ctx, "Trouble getting fs for path %s: %+v", path, err)
-		return nil, nil, err
-	}
-	// Use LStat so we don't follow symlinks.
-	k.log.CDebugf(ctx, "About to lstat %s", finalElem)
-	fi, err := fs.Lstat(finalElem)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	fipr, ok := fi.Sys().(libfs.PrevRevisionsGetter)
-	if !ok {
-		return nil, nil, simpleFSError{"Cannot get revisions for non-KBFS path"}
-	}
-	return fi, fipr.PrevRevisions(), nil
-}
-
 func (k *SimpleFS) doGetRevisions(
 	ctx context.Context, opID keybase1.OpID, path keybase1.Path,
 	spanType keybase1.RevisionSpanType) (
@@ -1424,179 +1734,42 @@ func (k *SimpleFS) doGetRevisions(
 	// Both span types return up to 5 revisions.
 	k.setProgressTotals(opID, 0, 5)
 
-	fi, prs, err := k.getRevisionsFromPath(ctx, path)
-	if err != nil {
-		return nil, err
-	}
-	if len(prs) == 0 {
-		return nil, simpleFSError{"No previous revisions"}
-	}
-
-	var currRev keybase1.DirentWithRevision
-	err = setStat(&currRev.Entry, fi)
-	if err != nil {
-		return nil, err
-	}
-	currRev.Revision = keybase1.KBFSRevision(prs[0].Revision)
-	k.log.CDebugf(ctx, "Found current revision: %d", prs[0].Revision)
-	k.updateReadProgress(opID, 0, 1)
-
-	var revPaths []keybase1.Path
-
-	// The next four depend on the span type.
 	pathStr := path.String()
-	switch spanType {
-	case keybase1.RevisionSpanType_DEFAULT:
-		// Use `prs` for the rest of the paths.
-		for i := 1; i < len(prs); i++ {
-			p := keybase1.NewPathWithKbfsArchived(keybase1.KBFSArchivedPath{
-				Path: pathStr,
-				ArchivedParam: keybase1.NewKBFSArchivedParamWithRevision(
-					keybase1.KBFSRevision(prs[i].Revision)),
-			})
-			revPaths = append(revPaths, p)
-		}
-	case keybase1.RevisionSpanType_LAST_FIVE:
-		expectedCount := uint8(2)
-		nextSlot := 1
-		lastRevision := prs[0].Revision
-
-		// Step back through the previous revisions.  If the next one
-		// in the list happens to be the next in line (because the
-		// count is one more than the current count), use it.
-		// Otherwise, we have to fetch the stats from the MD revision
-		// before the last one we processed, and use the
-		// PreviousRevisions list from that version of the file.
-		for len(revPaths) < 4 && nextSlot < len(prs) {
-			var rev kbfsmd.Revision
-			if prs[nextSlot].Count == expectedCount {
-				rev = prs[nextSlot].Revision
-			} else if lastRevision > kbfsmd.RevisionInitial {
-				k.log.CDebugf(ctx, "Inspecting revision %d to find previous",
-					lastRevision-1)
-				pathToPrev := keybase1.NewPathWithKbfsArchived(
-					keybase1.KBFSArchivedPath{
-						Path: pathStr,
-						ArchivedParam: keybase1.NewKBFSArchivedParamWithRevision(
-							keybase1.KBFSRevision(lastRevision - 1)),
-					})
-				_, prevPRs, err := k.getRevisionsFromPath(ctx, pathToPrev)
-				if _, isGC := err.(libkbfs.RevGarbageCollectedError); isGC {
-					k.log.CDebugf(ctx, "Hit a GC'd revision: %d",
-						lastRevision-1)
-					break
-				} else if err != nil {
-					return nil, err
-				}
-				if len(prevPRs) == 0 {
-					// This should never happen, because there is some
-					// next slot in the `prs` list, but it doesn't
-					// match the expected count, which means there
-					// must be _some_ revision in between the last
-					// revision and the one in the next slot, that we
-					// should uncover by looking up `lastRevision-1`.
-					return nil, simpleFSError{fmt.Sprintf(
-						"Revision %s unexpectedly lists no previous revisions",
-						lastRevision-1)}
-				}
-				rev = prevPRs[0].Revision
-				prs = prevPRs
-				nextSlot = 0      // will be incremented below
-				expectedCount = 1 // will be incremented below
-			} else {
-				break
-			}
-
-			p := keybase1.NewPathWithKbfsArchived(keybase1.KBFSArchivedPath{
+	getFileInfo := func(ctx context.Context, rev kbfsmd.Revision) (
+		os.FileInfo, error) {
+		p := path
+		if rev != kbfsmd.RevisionUninitialized {
+			p = keybase1.NewPathWithKbfsArchived(keybase1.KBFSArchivedPath{
 				Path: pathStr,
 				ArchivedParam: keybase1.NewKBFSArchivedParamWithRevision(
 					keybase1.KBFSRevision(rev)),
 			})
-			revPaths = append(revPaths, p)
-			lastRevision = rev
-			nextSlot++
-			expectedCount++
-		}
-	default:
-		return nil, simpleFSError{
-			fmt.Sprintf("Unknown span type: %s", spanType)}
-	}
-
-	if len(revPaths) < 4 {
-		// See if the final revision has a predecessor that's
-		// still live, to fill out the list of 5.  An older
-		// revision could have slid off the previous revisions
-		// list because that revision was garbage-collected, but
-		// that doesn't guarantee that the older revision of the
-		// file was garabge-collected too (since it was created,
-		// not deleted, as of that garbage-collected revision).
-		p := keybase1.NewPathWithKbfsArchived(keybase1.KBFSArchivedPath{
-			Path: pathStr,
-			ArchivedParam: keybase1.NewKBFSArchivedParamWithRevision(
-				keybase1.KBFSRevision(prs[len(prs)-1].Revision - 1)),
-		})
-		revPaths = append(revPaths, p)
-	}
-
-	// Now that we have all the paths we need, stat them one-by-one.
-	revs = make([]keybase1.DirentWithRevision, len(revPaths)+1)
-	revs[0] = currRev
-
-	if len(revs) < 5 {
-		// Discount the revisions that don't exist from the progress.
-		k.updateReadProgress(opID, 0, int64(5-len(revs)))
-	}
-
-	// Fetch all the past revisions in parallel to populate the
-	// directory entry.
-	eg, groupCtx := errgroup.WithContext(ctx)
-	doStat := func(slot int) error {
-		p := revPaths[slot]
-		fs, finalElem, err := k.getFS(groupCtx, p)
-		if _, isGC := err.(libkbfs.RevGarbageCollectedError); isGC {
-			k.log.CDebugf(ctx, "Hit a GC'd revision: %d",
-				p.KbfsArchived().ArchivedParam.Revision())
-			return nil
-		} else if err != nil {
-			return err
-		}
-		// Use LStat so we don't follow symlinks.
-		fi, err := fs.Lstat(finalElem)
-		if os.IsNotExist(err) {
-			k.log.CDebugf(ctx, "Ran out of revisions as of %d",
-				p.KbfsArchived().ArchivedParam.Revision())
-			return nil
 		}
+		fs, finalElem, err := k.getFS(ctx, p)
 		if err != nil {
-			return err
-		}
-		var rev keybase1.DirentWithRevision
-		err = setStat(&rev.Entry, fi)
-		if err != nil {
-			return err
+			k.log.CDebugf(ctx, "Trouble getting fs for path %s: %+v", p, err)
+			return nil, err
 		}
-		rev.Revision = p.KbfsArchived().ArchivedParam.Revision()
-		revs[slot+1] = rev
-		k.updateReadProgress(opID, 0, 1)
-		return nil
-	}
-	for i := range revPaths {
-		i := i
-		eg.Go(func() error { return doStat(i) })
+		// Use LStat so we don't follow symlinks.
+		return fs.Lstat(finalElem)
 	}
-	err = eg.Wait()
+
+	fileRevs, err := libfs.GetFileRevisions(
+		ctx, k.log, getFileInfo, spanType, func(numDone int64) {
+			k.updateReadProgress(opID, 0, numDone)
+		})
 	if err != nil {
 		return nil, err
 	}
 
-	// Remove any GC'd revisions.
-	for i, r := range revs {
-		if kbfsmd.Revision(r.Revision) == kbfsmd.RevisionUninitialized {
-			revs = revs[:i]
-			break
+	revs = make([]keybase1.DirentWithRevision, len(fileRevs))
+	for i, fr := range fileRevs {
+		err = setStat(&revs[i].Entry, fr.FileInfo)
+		if err != nil {
+			return nil, err
 		}
+		revs[i].Revision = keybase1.KBFSRevision(fr.Revision)
 	}
-
 	return revs, nil
 }
 
@@ -1778,28 +1951,41 @@ func (k *SimpleFS) SimpleFSDumpDebuggingInfo(ctx context.Context) error {
 	return nil
 }
 
-// SimpleFSSyncStatus - Get sync status.
+// SimpleFSSyncStatus - Get sync status.  Besides the paths with
+// unflushed journal writes, the syncing paths include any subtrees of
+// partially-synced TLFs that haven't been fully downloaded for
+// offline use yet.
 func (k *SimpleFS) SimpleFSSyncStatus(ctx context.Context, filter keybase1.ListFilter) (keybase1.FSSyncStatus, error) {
 	ctx = k.makeContext(ctx)
+	var status libkbfs.JournalServerStatus
 	jServer, jErr := libkbfs.GetJournalServer(k.config)
 	if jErr != nil {
-		k.log.CDebugf(ctx, "Journal not enabled; sending empty response")
-		return keybase1.FSSyncStatus{}, nil
+		k.log.CDebugf(ctx, "Journal not enabled; not sending unflushed paths")
+	} else {
+		var tlfIDs []tlf.ID
+		status, tlfIDs = jServer.Status(ctx)
+		err := libkbfs.FillInJournalStatusUnflushedPaths(
+			ctx, k.config, &status, tlfIDs)
+		if err != nil {
+			k.log.CDebugf(ctx, "Error setting unflushed paths: %+v; "+
+				"sending empty response", err)
+			return keybase1.FSSyncStatus{}, nil
+		}
 	}
-	status, tlfIDs := jServer.Status(ctx)
-	err := libkbfs.FillInJournalStatusUnflushedPaths(
-		ctx, k.config, &status, tlfIDs)
+
+	allPaths := status.UnflushedPaths
+	offlinePaths, err := libkbfs.GetPartialSyncPathsInProgress(ctx, k.config)
 	if err != nil {
-		k.log.CDebugf(ctx, "Error setting unflushed paths: %+v; "+
-			"sending empty response", err)
-		return keybase1.FSSyncStatus{}, nil
+		k.log.CDebugf(ctx, "Error getting offline sync paths: %+v", err)
+	} else {
+		allPaths = append(allPaths, offlinePaths...)
 	}
 
 	var syncingPaths []string
 	if filter == keybase1.ListFilter_NO_FILTER {
-		syncingPaths = status.UnflushedPaths
+		syncingPaths = allPaths
 	} else {
-		for _, p := range status.UnflushedPaths {
+		for _, p := range allPaths {
 			if isFiltered(filter, p) {
 				continue
 			}
@@ -1901,3 +2087,105 @@ func (k *SimpleFS) SimpleFSGetUserQuotaUsage(ctx context.Context) (
 	res.GitLimitBytes = status.GitLimitBytes
 	return res, nil
 }
+
+// SimpleFSGetQuotaUsageBreakdown returns a "du"-style breakdown of
+// the quota used by the given KBFS directory, by writer and by
+// subdirectory down to `maxDepth` levels below it, along with the
+// bytes of its TLF that haven't been reclaimed yet.
+func (k *SimpleFS) SimpleFSGetQuotaUsageBreakdown(
+	ctx context.Context, path keybase1.Path, maxDepth int) (
+	res libkbfs.QuotaUsageBreakdown, err error) {
+	ctx = k.makeContext(ctx)
+	fs, finalElem, err := k.getFS(ctx, path)
+	if err != nil {
+		return libkbfs.QuotaUsageBreakdown{}, err
+	}
+	kbfsFS, ok := fs.(*libfs.FS)
+	if !ok {
+		return libkbfs.QuotaUsageBreakdown{}, simpleFSError{
+			"Cannot get quota usage for non-KBFS path"}
+	}
+	if finalElem != "" {
+		kbfsFS, err = kbfsFS.ChrootAsLibFS(finalElem)
+		if err != nil {
+			return libkbfs.QuotaUsageBreakdown{}, err
+		}
+	}
+	return k.config.KBFSOps().GetQuotaUsageBreakdown(
+		ctx, kbfsFS.RootNode(), maxDepth)
+}
+
+// SimpleFSRestoreFromRevision restores the KBFS file or directory at
+// `path` as it was at revision `rev` of its TLF, in a single MD
+// update.
+func (k *SimpleFS) SimpleFSRestoreFromRevision(
+	ctx context.Context, path keybase1.Path, rev kbfsmd.Revision) (
+	err error) {
+	ctx, err = k.startSyncOp(ctx, "RestoreFromRevision", path)
+	if err != nil {
+		return err
+	}
+	defer func() { k.doneSyncOp(ctx, err) }()
+
+	fs, finalElem, err := k.getFS(ctx, path)
+	if err != nil {
+		return err
+	}
+	kbfsFS, ok := fs.(*libfs.FS)
+	if !ok {
+		return simpleFSError{"Cannot restore a non-KBFS path"}
+	}
+	return kbfsFS.RestoreFromRevision(finalElem, rev)
+}
+
+// SimpleFSDiffRevisions returns the paths created, modified, removed
+// and renamed in the TLF containing `path` between revisions `from`
+// and `to`.
+func (k *SimpleFS) SimpleFSDiffRevisions(
+	ctx context.Context, path keybase1.Path, from, to kbfsmd.Revision) (
+	diffs []libkbfs.RevisionDiff, err error) {
+	ctx, err = k.startSyncOp(ctx, "DiffRevisions", path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { k.doneSyncOp(ctx, err) }()
+
+	fb, _, err := k.getFolderBranchFromPath(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if fb == (libkbfs.FolderBranch{}) {
+		return nil, simpleFSError{"Cannot diff a TLF that doesn't exist"}
+	}
+	return k.config.KBFSOps().DiffRevisions(ctx, fb, from, to)
+}
+
+// SimpleFSSearchContents returns the paths, relative to the TLF root,
+// of the text files at or under `path` that contain every word of
+// `query`.  The TLF must be synced for offline use, and content
+// search must be enabled.  If `maxResults` is positive, at most that
+// many paths are returned.
+func (k *SimpleFS) SimpleFSSearchContents(
+	ctx context.Context, path keybase1.Path, query string,
+	maxResults int) (paths []string, err error) {
+	ctx, err = k.startSyncOp(ctx, "SearchContents", path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { k.doneSyncOp(ctx, err) }()
+
+	if k.indexer == nil {
+		return nil, simpleFSError{"Content search is not enabled"}
+	}
+	t, tlfName, restOfPath, finalElem, err := remoteTlfAndPath(path)
+	if err != nil {
+		return nil, err
+	}
+	tlfHandle, err := libkbfs.GetHandleFromFolderNameAndType(
+		ctx, k.config.KBPKI(), k.config.MDOps(), tlfName, t)
+	if err != nil {
+		return nil, err
+	}
+	return k.indexer.Search(ctx, tlfHandle,
+		stdpath.Join(restOfPath, finalElem), query, maxResults)
+}
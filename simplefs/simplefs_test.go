@@ -343,6 +343,42 @@ func TestList(t *testing.T) {
 	checkArchived(pathArchivedRelTimeString, 1)
 }
 
+func TestListAppendAfterClose(t *testing.T) {
+	ctx := context.Background()
+	config := libkbfs.MakeTestConfigOrBust(t, "jdoe")
+	sfs := newSimpleFS(libkb.NewGlobalContext().Init(), config)
+	defer closeSimpleFS(ctx, t, sfs)
+
+	opid, err := sfs.SimpleFSMakeOpid(ctx)
+	require.NoError(t, err)
+	sfs.setResult(opid, keybase1.SimpleFSListResult{})
+	err = sfs.appendListResult(opid, []keybase1.Dirent{{Name: "a"}})
+	require.NoError(t, err)
+
+	// Pages read after the first ReadList start a new result.
+	listResult, err := sfs.SimpleFSReadList(ctx, opid)
+	require.NoError(t, err)
+	require.Len(t, listResult.Entries, 1)
+	_, err = sfs.SimpleFSReadList(ctx, opid)
+	require.Error(t, err)
+	err = sfs.appendListResult(opid, []keybase1.Dirent{{Name: "b"}})
+	require.NoError(t, err)
+	listResult, err = sfs.SimpleFSReadList(ctx, opid)
+	require.NoError(t, err)
+	require.Len(t, listResult.Entries, 1)
+	require.Equal(t, "b", listResult.Entries[0].Name)
+
+	// Once the op is closed, later pages are refused rather than
+	// recreating its handle.
+	err = sfs.SimpleFSClose(ctx, opid)
+	require.NoError(t, err)
+	err = sfs.appendListResult(opid, []keybase1.Dirent{{Name: "c"}})
+	require.Equal(t, errNoSuchHandle, err)
+	_, err = sfs.SimpleFSReadList(ctx, opid)
+	require.Error(t, err)
+	require.Len(t, sfs.handles, 0)
+}
+
 func TestListRecursive(t *testing.T) {
 	ctx := context.Background()
 	sfs := newSimpleFS(libkb.NewGlobalContext().Init(), libkbfs.MakeTestConfigOrBust(t, "jdoe"))
@@ -422,6 +458,84 @@ func TestListRecursive(t *testing.T) {
 	}
 }
 
+func TestSearch(t *testing.T) {
+	ctx := context.Background()
+	sfs := newSimpleFS(libkb.NewGlobalContext().Init(), libkbfs.MakeTestConfigOrBust(t, "jdoe"))
+	defer closeSimpleFS(ctx, t, sfs)
+
+	pathJDoe := keybase1.NewPathWithKbfs(`/private/jdoe`)
+	writeRemoteDir(ctx, t, sfs, pathAppend(pathJDoe, `a`))
+	patha := keybase1.NewPathWithKbfs(`/private/jdoe/a`)
+	writeRemoteDir(ctx, t, sfs, pathAppend(patha, `aa`))
+	pathaa := keybase1.NewPathWithKbfs(`/private/jdoe/a/aa`)
+	writeRemoteFile(ctx, t, sfs, pathAppend(pathaa, `test1.txt`), []byte(`foo`))
+	writeRemoteFile(ctx, t, sfs, pathAppend(patha, `test2.txt`), []byte(`foobar`))
+	writeRemoteFile(ctx, t, sfs, pathAppend(patha, `test3.md`), []byte(`foo`))
+	writeRemoteFile(ctx, t, sfs, pathAppend(patha, `.test4.txt`), []byte(`foo`))
+
+	search := func(arg SimpleFSSearchArg) []string {
+		opid, err := sfs.SimpleFSMakeOpid(ctx)
+		require.NoError(t, err)
+		arg.OpID = opid
+		arg.Path = pathJDoe
+		arg.Filter = keybase1.ListFilter_FILTER_ALL_HIDDEN
+		err = sfs.SimpleFSSearch(ctx, arg)
+		require.NoError(t, err)
+		checkPendingOp(ctx, t, sfs, opid, keybase1.AsyncOps_LIST_RECURSIVE, pathJDoe, keybase1.Path{}, true)
+		err = sfs.SimpleFSWait(ctx, opid)
+		require.NoError(t, err)
+		listResult, err := sfs.SimpleFSReadList(ctx, opid)
+		require.NoError(t, err)
+		names := make([]string, 0, len(listResult.Entries))
+		for _, e := range listResult.Entries {
+			names = append(names, e.Name)
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	t.Log("Search by name glob")
+	require.Equal(t, []string{"a/aa/test1.txt", "a/test2.txt"},
+		search(SimpleFSSearchArg{NameGlob: "*.txt"}))
+
+	t.Log("Search by path regexp")
+	require.Equal(t, []string{"a/aa", "a/aa/test1.txt"},
+		search(SimpleFSSearchArg{PathRegexp: "/aa"}))
+
+	t.Log("Search by size")
+	require.Equal(t, []string{"a/test2.txt"},
+		search(SimpleFSSearchArg{MinSize: 4, MaxSize: 10}))
+
+	t.Log("Search by type")
+	require.Equal(t, []string{"a", "a/aa"},
+		search(SimpleFSSearchArg{
+			Types: []keybase1.DirentType{keybase1.DirentType_DIR},
+		}))
+
+	t.Log("Search by modification time")
+	require.Len(t, search(SimpleFSSearchArg{
+		ModifiedBefore: time.Now().Add(-time.Hour),
+	}), 0)
+	require.Len(t, search(SimpleFSSearchArg{
+		ModifiedAfter: time.Now().Add(-time.Hour),
+	}), 5)
+
+	t.Log("Results are capped")
+	require.Len(t, search(SimpleFSSearchArg{MaxResults: 2}), 2)
+
+	t.Log("Bad patterns are rejected up front")
+	opid, err := sfs.SimpleFSMakeOpid(ctx)
+	require.NoError(t, err)
+	err = sfs.SimpleFSSearch(ctx, SimpleFSSearchArg{
+		OpID: opid, Path: pathJDoe, PathRegexp: "(",
+	})
+	require.Error(t, err)
+	err = sfs.SimpleFSSearch(ctx, SimpleFSSearchArg{
+		OpID: opid, Path: pathJDoe, NameGlob: "[",
+	})
+	require.Error(t, err)
+}
+
 func TestCopyToLocal(t *testing.T) {
 	ctx := context.Background()
 	sfs := newSimpleFS(libkb.NewGlobalContext().Init(), libkbfs.MakeTestConfigOrBust(t, "jdoe"))
@@ -875,6 +989,99 @@ func TestTlfEditHistory(t *testing.T) {
 	require.Len(t, history.History[0].Edits, 2)
 }
 
+func TestGetQuotaUsageBreakdown(t *testing.T) {
+	ctx := context.Background()
+	sfs := newSimpleFS(
+		libkb.NewGlobalContext().Init(),
+		libkbfs.MakeTestConfigOrBust(t, "jdoe"))
+	defer closeSimpleFS(ctx, t, sfs)
+
+	path := keybase1.NewPathWithKbfs(`/private/jdoe`)
+	writeRemoteFile(
+		ctx, t, sfs, pathAppend(path, `test1.txt`), []byte(`foo`))
+	dir := pathAppend(path, `a`)
+	writeRemoteDir(ctx, t, sfs, dir)
+	writeRemoteFile(ctx, t, sfs, pathAppend(dir, `test2.txt`), []byte(`foo`))
+	syncFS(ctx, t, sfs, "/private/jdoe")
+
+	breakdown, err := sfs.SimpleFSGetQuotaUsageBreakdown(ctx, path, 1)
+	require.NoError(t, err)
+	require.Equal(t, "/keybase/private/jdoe", breakdown.Name)
+	require.Len(t, breakdown.Dirs, 2)
+	require.Equal(t, 2, breakdown.Dirs[0].NumFiles)
+	require.Equal(t, "a", breakdown.Dirs[1].Path)
+	require.Contains(t, breakdown.Writers, "jdoe")
+
+	breakdown, err = sfs.SimpleFSGetQuotaUsageBreakdown(ctx, dir, 1)
+	require.NoError(t, err)
+	require.Len(t, breakdown.Dirs, 1)
+	require.Equal(t, 1, breakdown.Dirs[0].NumFiles)
+}
+
+func TestRestoreFromRevision(t *testing.T) {
+	ctx := context.Background()
+	sfs := newSimpleFS(
+		libkb.NewGlobalContext().Init(),
+		libkbfs.MakeTestConfigOrBust(t, "jdoe"))
+	defer closeSimpleFS(ctx, t, sfs)
+
+	path := keybase1.NewPathWithKbfs(`/private/jdoe`)
+	dir := pathAppend(path, `a`)
+	writeRemoteDir(ctx, t, sfs, dir)
+	filePath := pathAppend(dir, `test1.txt`)
+	writeRemoteFile(ctx, t, sfs, filePath, []byte(`foo`))
+	syncFS(ctx, t, sfs, "/private/jdoe")
+
+	fb, _, err := sfs.getFolderBranchFromPath(ctx, path)
+	require.NoError(t, err)
+	status, _, err := sfs.config.KBFSOps().FolderStatus(ctx, fb)
+	require.NoError(t, err)
+	rev := status.Revision
+
+	writeRemoteFile(ctx, t, sfs, filePath, []byte(`foo2`))
+	syncFS(ctx, t, sfs, "/private/jdoe")
+	require.Equal(t, "foo2", string(readRemoteFile(ctx, t, sfs, filePath)))
+
+	err = sfs.SimpleFSRestoreFromRevision(ctx, filePath, rev)
+	require.NoError(t, err)
+	require.Equal(t, "foo", string(readRemoteFile(ctx, t, sfs, filePath)))
+
+	err = sfs.SimpleFSRestoreFromRevision(ctx, path, rev)
+	require.Error(t, err)
+}
+
+func TestDiffRevisions(t *testing.T) {
+	ctx := context.Background()
+	sfs := newSimpleFS(
+		libkb.NewGlobalContext().Init(),
+		libkbfs.MakeTestConfigOrBust(t, "jdoe"))
+	defer closeSimpleFS(ctx, t, sfs)
+
+	path := keybase1.NewPathWithKbfs(`/private/jdoe`)
+	writeRemoteFile(ctx, t, sfs, pathAppend(path, `test1.txt`), []byte(`foo`))
+	syncFS(ctx, t, sfs, "/private/jdoe")
+
+	fb, _, err := sfs.getFolderBranchFromPath(ctx, path)
+	require.NoError(t, err)
+	status, _, err := sfs.config.KBFSOps().FolderStatus(ctx, fb)
+	require.NoError(t, err)
+	from := status.Revision
+
+	writeRemoteFile(ctx, t, sfs, pathAppend(path, `test2.txt`), []byte(`foo2`))
+	syncFS(ctx, t, sfs, "/private/jdoe")
+	status, _, err = sfs.config.KBFSOps().FolderStatus(ctx, fb)
+	require.NoError(t, err)
+
+	diffs, err := sfs.SimpleFSDiffRevisions(ctx, path, from, status.Revision)
+	require.NoError(t, err)
+	require.Equal(t, []libkbfs.RevisionDiff{{
+		Type:      libkbfs.RevisionDiffCreated,
+		Path:      "test2.txt",
+		EntryType: libkbfs.File,
+		Size:      4,
+	}}, diffs)
+}
+
 type subscriptionReporter struct {
 	libkbfs.Reporter
 	lastPath string
@@ -0,0 +1,171 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+// These tests check that conflicting writes to mergeable files are
+// merged line by line.
+
+package test
+
+import (
+	"testing"
+)
+
+// bob and alice both edit different lines of the same text file.
+func TestCrMergeNonOverlappingWrites(t *testing.T) {
+	test(t, crMergeGlobs("*.txt"),
+		users("alice", "bob"),
+		as(alice,
+			mkfile("a/b.txt", "one\ntwo\nthree\n"),
+		),
+		as(bob,
+			disableUpdates(),
+		),
+		as(alice,
+			write("a/b.txt", "ONE\ntwo\nthree\n"),
+		),
+		as(bob, noSync(),
+			write("a/b.txt", "one\ntwo\nTHREE\n"),
+			reenableUpdates(),
+			lsdir("a/", m{"b.txt$": "FILE"}),
+			read("a/b.txt", "ONE\ntwo\nTHREE\n"),
+		),
+		as(alice,
+			lsdir("a/", m{"b.txt$": "FILE"}),
+			read("a/b.txt", "ONE\ntwo\nTHREE\n"),
+		),
+	)
+}
+
+// alice prepends a line to a text file, while bob appends one.
+func TestCrMergePrependAndAppend(t *testing.T) {
+	test(t, crMergeGlobs("*.log"),
+		users("alice", "bob"),
+		as(alice,
+			mkfile("a/b.log", "start\n"),
+		),
+		as(bob,
+			disableUpdates(),
+		),
+		as(alice,
+			write("a/b.log", "alice\nstart\n"),
+		),
+		as(bob, noSync(),
+			write("a/b.log", "start\nbob\n"),
+			reenableUpdates(),
+			lsdir("a/", m{"b.log$": "FILE"}),
+			read("a/b.log", "alice\nstart\nbob\n"),
+		),
+		as(alice,
+			read("a/b.log", "alice\nstart\nbob\n"),
+		),
+	)
+}
+
+// bob and alice both append different lines to the same text file,
+// so it is left as a conflict.
+func TestCrMergeConflictingAppends(t *testing.T) {
+	test(t, crMergeGlobs("*.log"),
+		users("alice", "bob"),
+		as(alice,
+			mkfile("a/b.log", "start\n"),
+		),
+		as(bob,
+			disableUpdates(),
+		),
+		as(alice,
+			write("a/b.log", "start\nalice\n"),
+		),
+		as(bob, noSync(),
+			write("a/b.log", "start\nbob\n"),
+			reenableUpdates(),
+			lsdir("a/", m{"b.log$": "FILE", crnameEsc("b.log", bob): "FILE"}),
+			read("a/b.log", "start\nalice\n"),
+			read(crname("a/b.log", bob), "start\nbob\n"),
+		),
+		as(alice,
+			read("a/b.log", "start\nalice\n"),
+			read(crname("a/b.log", bob), "start\nbob\n"),
+		),
+	)
+}
+
+// bob shrinks a text file, while alice edits a line that bob keeps.
+func TestCrMergeShrink(t *testing.T) {
+	test(t, crMergeGlobs("*.txt"),
+		users("alice", "bob"),
+		as(alice,
+			mkfile("a/b.txt", "one\ntwo\nthree\nfour\n"),
+		),
+		as(bob,
+			disableUpdates(),
+		),
+		as(alice,
+			write("a/b.txt", "ONE\ntwo\nthree\nfour\n"),
+		),
+		as(bob, noSync(),
+			write("a/b.txt", "one\ntwo\n"),
+			truncate("a/b.txt", 8),
+			reenableUpdates(),
+			lsdir("a/", m{"b.txt$": "FILE"}),
+			read("a/b.txt", "ONE\ntwo\n"),
+		),
+		as(alice,
+			lsdir("a/", m{"b.txt$": "FILE"}),
+			read("a/b.txt", "ONE\ntwo\n"),
+		),
+	)
+}
+
+// bob and alice both edit the same line of a text file, so it is
+// left as a conflict.
+func TestCrMergeOverlappingWrites(t *testing.T) {
+	test(t, crMergeGlobs("*.txt"),
+		users("alice", "bob"),
+		as(alice,
+			mkfile("a/b.txt", "one\ntwo\nthree\n"),
+		),
+		as(bob,
+			disableUpdates(),
+		),
+		as(alice,
+			write("a/b.txt", "one\nalice\nthree\n"),
+		),
+		as(bob, noSync(),
+			write("a/b.txt", "one\nbob\nthree\n"),
+			reenableUpdates(),
+			lsdir("a/", m{"b.txt$": "FILE", crnameEsc("b.txt", bob): "FILE"}),
+			read("a/b.txt", "one\nalice\nthree\n"),
+			read(crname("a/b.txt", bob), "one\nbob\nthree\n"),
+		),
+		as(alice,
+			lsdir("a/", m{"b.txt$": "FILE", crnameEsc("b.txt", bob): "FILE"}),
+			read("a/b.txt", "one\nalice\nthree\n"),
+			read(crname("a/b.txt", bob), "one\nbob\nthree\n"),
+		),
+	)
+}
+
+// bob and alice both edit different lines of a file that doesn't
+// match the merge globs, so it is left as a conflict.
+func TestCrMergeUnmatchedName(t *testing.T) {
+	test(t, crMergeGlobs("*.txt"),
+		users("alice", "bob"),
+		as(alice,
+			mkfile("a/b.bin", "one\ntwo\nthree\n"),
+		),
+		as(bob,
+			disableUpdates(),
+		),
+		as(alice,
+			write("a/b.bin", "ONE\ntwo\nthree\n"),
+		),
+		as(bob, noSync(),
+			write("a/b.bin", "one\ntwo\nTHREE\n"),
+			reenableUpdates(),
+			lsdir("a/", m{"b.bin$": "FILE", crnameEsc("b.bin", bob): "FILE"}),
+			read("a/b.bin", "ONE\ntwo\nthree\n"),
+			read(crname("a/b.bin", bob), "one\ntwo\nTHREE\n"),
+		),
+	)
+}
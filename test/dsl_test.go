@@ -57,6 +57,7 @@ type opt struct {
 	clock                    *libkbfs.TestClock
 	isParallel               bool
 	journal                  bool
+	crMergeGlobs             []string
 }
 
 // run{Test,Benchmark}OverMetadataVers are copied from
@@ -178,6 +179,11 @@ func (o *opt) runInitOnce() {
 		o.users = o.engine.InitTest(o.ver, o.blockSize,
 			o.blockChangeSize, o.batchSize, o.bwKBps, o.timeout, o.usernames,
 			o.teams, o.implicitTeams, o.clock, o.journal)
+		if len(o.crMergeGlobs) > 0 {
+			for _, u := range o.users {
+				o.engine.SetConflictMergeGlobs(u, o.crMergeGlobs)
+			}
+		}
 		o.stallers = o.makeStallers()
 	})
 }
@@ -237,6 +243,12 @@ func journal() optionOp {
 	}
 }
 
+func crMergeGlobs(globs ...string) optionOp {
+	return func(o *opt) {
+		o.crMergeGlobs = globs
+	}
+}
+
 func skip(implementation, reason string) optionOp {
 	return func(o *opt) {
 		if o.engine.Name() == implementation {
@@ -704,6 +716,45 @@ func setmtime(filepath string, mtime time.Time) fileOp {
 	}, Defaults, fmt.Sprintf("setmtime(%s, %s)", filepath, mtime)}
 }
 
+// lockFile takes the advisory lock on the given file, waiting for
+// other devices to release it.
+func lockFile(filepath string) fileOp {
+	return fileOp{func(c *ctx) error {
+		file, _, err := c.getNode(filepath, noCreate, resolveAllSyms)
+		if err != nil {
+			return err
+		}
+		return c.engine.LockFile(c.user, file, 10*time.Second)
+	}, Defaults, fmt.Sprintf("lockFile(%s)", filepath)}
+}
+
+// lockFileHeld checks that the advisory lock on the given file can't
+// be taken, because another device holds it.
+func lockFileHeld(filepath string) fileOp {
+	return fileOp{func(c *ctx) error {
+		file, _, err := c.getNode(filepath, noCreate, resolveAllSyms)
+		if err != nil {
+			return err
+		}
+		err = c.engine.LockFile(c.user, file, 100*time.Millisecond)
+		if err == nil {
+			return fmt.Errorf("Took the lock on %s while it was held",
+				filepath)
+		}
+		return nil
+	}, Defaults, fmt.Sprintf("lockFileHeld(%s)", filepath)}
+}
+
+func unlockFile(filepath string) fileOp {
+	return fileOp{func(c *ctx) error {
+		file, _, err := c.getNode(filepath, noCreate, resolveAllSyms)
+		if err != nil {
+			return err
+		}
+		return c.engine.UnlockFile(c.user, file)
+	}, Defaults, fmt.Sprintf("unlockFile(%s)", filepath)}
+}
+
 func mtime(filepath string, expectedMtime time.Time) fileOp {
 	return fileOp{func(c *ctx) error {
 		// If the expected time is zero, use the clock's current time.
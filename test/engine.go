@@ -118,6 +118,13 @@ type Engine interface {
 	// GetPrevResions is called by the test harness as the given user
 	// to get the previous revisions of the given file.
 	GetPrevRevisions(u User, file Node) (revs libkbfs.PrevRevisions, err error)
+	// LockFile is called by the test harness as the given user to
+	// take the advisory lock on the given file, giving up after
+	// `timeout` if it is held by another device.
+	LockFile(u User, file Node, timeout time.Duration) (err error)
+	// UnlockFile is called by the test harness as the given user to
+	// release the advisory lock on the given file.
+	UnlockFile(u User, file Node) (err error)
 	// SyncAll is called by the test harness as the given user to
 	// flush all writes buffered in memory to disk.
 	SyncAll(u User, tlfName string, t tlf.Type) (err error)
@@ -176,6 +183,10 @@ type Engine interface {
 	// TogglePrefetch is called by the test harness as the given user to toggle
 	// whether prefetching should be enabled
 	TogglePrefetch(u User, enable bool) error
+	// SetConflictMergeGlobs is called by the test harness to make the
+	// given user's conflict resolution merge conflicting writes to
+	// text files with names matching the given globs.
+	SetConflictMergeGlobs(u User, globs []string)
 	// Shutdown is called by the test harness when it is done with the
 	// given user.
 	Shutdown(u User) error
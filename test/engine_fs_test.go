@@ -499,6 +499,11 @@ func (*fsEngine) TogglePrefetch(user User, enable bool) error {
 		[]byte("1"), 0644)
 }
 
+// SetConflictMergeGlobs implements the Engine interface.
+func (*fsEngine) SetConflictMergeGlobs(user User, globs []string) {
+	user.(*fsUser).config.SetConflictMergeGlobs(globs)
+}
+
 // Shutdown is called by the test harness when it is done with the
 // given user.
 func (e *fsEngine) Shutdown(user User) error {
@@ -596,6 +601,19 @@ func (*fsEngine) GetMtime(u User, file Node) (mtime time.Time, err error) {
 	return fi.ModTime(), err
 }
 
+// LockFile implements the Engine interface.  Only the FUSE engine
+// can serve lock requests; Dokan would only lock the file within a
+// single mount.
+func (*fsEngine) LockFile(
+	u User, file Node, timeout time.Duration) (err error) {
+	return fmt.Errorf("file locking is not supported by this engine")
+}
+
+// UnlockFile implements the Engine interface.
+func (*fsEngine) UnlockFile(u User, file Node) (err error) {
+	return fmt.Errorf("file locking is not supported by this engine")
+}
+
 type prevRevisions struct {
 	PrevRevisions libkbfs.PrevRevisions
 }
@@ -574,6 +574,55 @@ func (k *LibKBFS) GetPrevRevisions(u User, file Node) (
 	return info.PrevRevisions, nil
 }
 
+// engineLockOwner is the lock owner used for all of a user's file
+// locks, since each user is a separate device.
+const engineLockOwner = 1
+
+func (k *LibKBFS) getFileLockID(ctx context.Context,
+	config libkbfs.Config, node libkbfs.Node) (keybase1.LockID, error) {
+	kbfsOps := config.KBFSOps()
+	md, err := kbfsOps.GetNodeMetadata(ctx, node)
+	if err != nil {
+		return 0, err
+	}
+	h, err := kbfsOps.GetTLFHandle(ctx, node)
+	if err != nil {
+		return 0, err
+	}
+	return libfs.FileLockID(h.Type(), md.PathFromRoot), nil
+}
+
+// LockFile implements the Engine interface.
+func (k *LibKBFS) LockFile(
+	u User, file Node, timeout time.Duration) (err error) {
+	config := u.(*libkbfs.ConfigLocal)
+	ctx, cancel := k.newContext(u)
+	defer cancel()
+	node := file.(libkbfs.Node)
+	lockID, err := k.getFileLockID(ctx, config, node)
+	if err != nil {
+		return err
+	}
+	ctx, cancel = context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return config.LockManager().Lock(ctx, node.GetFolderBranch(), lockID,
+		engineLockOwner, keybase1.MDPriorityNormal)
+}
+
+// UnlockFile implements the Engine interface.
+func (k *LibKBFS) UnlockFile(u User, file Node) (err error) {
+	config := u.(*libkbfs.ConfigLocal)
+	ctx, cancel := k.newContext(u)
+	defer cancel()
+	node := file.(libkbfs.Node)
+	lockID, err := k.getFileLockID(ctx, config, node)
+	if err != nil {
+		return err
+	}
+	return config.LockManager().Unlock(ctx, node.GetFolderBranch(), lockID,
+		engineLockOwner, keybase1.MDPriorityNormal)
+}
+
 // getRootNode is like GetRootDir, but doesn't check the canonical TLF
 // name.
 func getRootNode(ctx context.Context, config libkbfs.Config, tlfName string,
@@ -867,6 +916,11 @@ func (k *LibKBFS) TogglePrefetch(u User, enable bool) error {
 	return nil
 }
 
+// SetConflictMergeGlobs implements the Engine interface.
+func (k *LibKBFS) SetConflictMergeGlobs(u User, globs []string) {
+	u.(*libkbfs.ConfigLocal).SetConflictMergeGlobs(globs)
+}
+
 // Shutdown implements the Engine interface.
 func (k *LibKBFS) Shutdown(u User) error {
 	config := u.(*libkbfs.ConfigLocal)
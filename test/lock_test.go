@@ -0,0 +1,87 @@
+// Copyright 2018 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+// These tests check that advisory file locks exclude other devices.
+
+package test
+
+import (
+	"testing"
+)
+
+// alice holds the lock on a file while bob tries to take it.
+func TestLockExcludesOtherDevices(t *testing.T) {
+	test(t, skip("dokan", "Dokan can't serve lock requests"),
+		users("alice", "bob"),
+		as(alice,
+			mkfile("a", "hello"),
+			lockFile("a"),
+		),
+		as(bob,
+			lockFileHeld("a"),
+		),
+		as(alice,
+			unlockFile("a"),
+		),
+		as(bob,
+			lockFile("a"),
+		),
+		as(alice,
+			lockFileHeld("a"),
+		),
+		as(bob,
+			unlockFile("a"),
+		),
+	)
+}
+
+// bob sees alice's writes as soon as he takes the lock she wrote
+// under, without syncing first.
+func TestLockSeesPreviousHoldersWrites(t *testing.T) {
+	test(t, skip("dokan", "Dokan can't serve lock requests"),
+		users("alice", "bob"),
+		as(alice,
+			mkfile("a", "hello"),
+		),
+		as(bob,
+			read("a", "hello"),
+		),
+		as(alice,
+			lockFile("a"),
+			write("a", "world"),
+			unlockFile("a"),
+		),
+		as(bob, noSync(),
+			lockFile("a"),
+			read("a", "world"),
+			write("a", "again"),
+			unlockFile("a"),
+		),
+		as(alice,
+			lockFile("a"),
+			read("a", "again"),
+			unlockFile("a"),
+		),
+	)
+}
+
+// Locks on different files don't exclude each other.
+func TestLockDifferentFiles(t *testing.T) {
+	test(t, skip("dokan", "Dokan can't serve lock requests"),
+		users("alice", "bob"),
+		as(alice,
+			mkfile("a", "hello"),
+			mkfile("b/c", "world"),
+			lockFile("a"),
+		),
+		as(bob,
+			lockFile("b/c"),
+			lockFileHeld("a"),
+			unlockFile("b/c"),
+		),
+		as(alice,
+			unlockFile("a"),
+		),
+	)
+}
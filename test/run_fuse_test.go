@@ -7,6 +7,10 @@
 package test
 
 import (
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
 	"testing"
 	"time"
 
@@ -21,6 +25,11 @@ import (
 
 type fuseEngine struct {
 	fsEngine
+
+	// lockedFiles holds the open files that the engine has flock'd,
+	// keyed by path, since closing them would release the locks.
+	lockedFilesLock sync.Mutex
+	lockedFiles     map[string]*os.File
 }
 
 func createEngine(tb testing.TB) Engine {
@@ -33,6 +42,7 @@ func createEngine(tb testing.TB) Engine {
 			tb:         tb,
 			createUser: createUserFuse,
 		},
+		lockedFiles: make(map[string]*os.File),
 	}
 }
 
@@ -86,3 +96,49 @@ func createUserFuse(tb testing.TB, ith int, config *libkbfs.ConfigLocal,
 		close:    mnt.Close,
 	}
 }
+
+// LockFile implements the Engine interface for fuseEngine.
+func (e *fuseEngine) LockFile(
+	u User, file Node, timeout time.Duration) (err error) {
+	n := file.(fsNode)
+	f, err := os.Open(n.path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+		}
+	}()
+
+	deadline := time.Now().Add(timeout)
+	for {
+		err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err != syscall.EWOULDBLOCK || !time.Now().Before(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		return err
+	}
+
+	e.lockedFilesLock.Lock()
+	defer e.lockedFilesLock.Unlock()
+	e.lockedFiles[n.path] = f
+	return nil
+}
+
+// UnlockFile implements the Engine interface for fuseEngine.
+func (e *fuseEngine) UnlockFile(u User, file Node) (err error) {
+	n := file.(fsNode)
+	e.lockedFilesLock.Lock()
+	f, ok := e.lockedFiles[n.path]
+	delete(e.lockedFiles, n.path)
+	e.lockedFilesLock.Unlock()
+	if !ok {
+		return fmt.Errorf("%s isn't locked", n.path)
+	}
+	defer f.Close()
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}